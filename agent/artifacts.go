@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultArtifactDir is where downloaded artifacts are kept unless
+// AGENT_ARTIFACT_DIR is set.
+const defaultArtifactDir = "artifacts"
+
+// artifactFetcher downloads the artifacts of deployments, such as model
+// weights, before their containers start.
+type artifactFetcher struct {
+	http       *http.Client
+	dir        string // Where verified artifacts are kept, by checksum
+	hfEndpoint string
+	hfToken    string // Sent to Hugging Face for gated and private models, if set
+	s3Endpoint string
+}
+
+// artifactFetcherFromEnv configures artifact downloads from the
+// AGENT_ARTIFACT_DIR ("artifacts"), HF_ENDPOINT ("https://huggingface.co"),
+// HF_TOKEN, and S3_ENDPOINT ("https://s3.amazonaws.com") environment
+// variables.
+func artifactFetcherFromEnv() *artifactFetcher {
+	f := &artifactFetcher{
+		// Model weights can be large and links slow, so only a stalled
+		// download times out.
+		http: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, ResponseHeaderTimeout: 30 * time.Second},
+		},
+		dir:        os.Getenv("AGENT_ARTIFACT_DIR"),
+		hfEndpoint: strings.TrimSuffix(os.Getenv("HF_ENDPOINT"), "/"),
+		hfToken:    os.Getenv("HF_TOKEN"),
+		s3Endpoint: strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+	}
+	if f.dir == "" {
+		f.dir = defaultArtifactDir
+	}
+	if f.hfEndpoint == "" {
+		f.hfEndpoint = "https://huggingface.co"
+	}
+	if f.s3Endpoint == "" {
+		f.s3Endpoint = "https://s3.amazonaws.com"
+	}
+	return f
+}
+
+// sourceURL returns the HTTPS URL an artifact is downloaded from. Hugging
+// Face files are fetched from the revision given after "@", else main. S3
+// objects are fetched path-style without signing, so private objects need a
+// presigned https:// source instead.
+func (f *artifactFetcher) sourceURL(source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "hf://"):
+		repoPath, revision, _ := strings.Cut(strings.TrimPrefix(source, "hf://"), "@")
+		parts := strings.SplitN(repoPath, "/", 3)
+		if len(parts) < 3 {
+			return "", fmt.Errorf("invalid source %q", source)
+		}
+		if revision == "" {
+			revision = "main"
+		}
+		return fmt.Sprintf("%s/%s/%s/resolve/%s/%s", f.hfEndpoint, parts[0], parts[1], url.PathEscape(revision), parts[2]), nil
+	case strings.HasPrefix(source, "s3://"):
+		return f.s3Endpoint + "/" + strings.TrimPrefix(source, "s3://"), nil
+	case strings.HasPrefix(source, "https://"):
+		return source, nil
+	}
+	return "", fmt.Errorf("unsupported source %q", source)
+}
+
+// fetch returns the path of an artifact's file, downloading it unless a
+// verified copy is already on disk. The file is only kept if its checksum
+// matches.
+func (f *artifactFetcher) fetch(a Artifact) (string, error) {
+	path := filepath.Join(f.dir, a.SHA256)
+	if sum, err := fileSHA256(path); err == nil && sum == a.SHA256 {
+		return path, nil
+	}
+	src, err := f.sourceURL(a.Source)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return "", err
+	}
+	part := path + ".part"
+	if err := f.download(src, part, strings.HasPrefix(a.Source, "hf://")); err != nil {
+		return "", fmt.Errorf("could not download artifact %s from %s: %w", a.Name, a.Source, err)
+	}
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return "", err
+	}
+	if sum != a.SHA256 {
+		os.Remove(part)
+		return "", fmt.Errorf("artifact %s has checksum %s, expected %s", a.Name, sum, a.SHA256)
+	}
+	return path, os.Rename(part, path)
+}
+
+// download fetches a URL into a file, resuming a download that was
+// interrupted earlier if the server supports ranges.
+func (f *artifactFetcher) download(src, path string, huggingFace bool) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if huggingFace && f.hfToken != "" {
+		req.Header.Set("Authorization", "Bearer "+f.hfToken)
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		log.Printf("Resuming download of %s at byte %d", src, offset)
+	case http.StatusOK:
+		// The whole file is sent, so the partial file is started over.
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is complete, or stale; the checksum decides.
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.New(resp.Status + ": the source needs credentials, e.g. HF_TOKEN or a presigned URL")
+	default:
+		return errors.New(resp.Status)
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return fmt.Errorf("download interrupted: %w", err)
+	}
+	return nil
+}
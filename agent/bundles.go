@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+// defaultBundleDir is where downloaded bundles are kept unless AGENT_BUNDLE_DIR is set.
+const defaultBundleDir = "bundles"
+
+// bundleLoader downloads bundles from the control center for sites without
+// registry access, and checks them before their images are loaded.
+type bundleLoader struct {
+	cc  *client.Client
+	dir string            // Where verified archives are kept
+	key ed25519.PublicKey // nil if BUNDLE_PUBLIC_KEY is not set, so no bundle is trusted
+}
+
+// bundleLoaderFromEnv configures bundle downloads from the
+// CONTROL_CENTER_ADDR, BUNDLE_PUBLIC_KEY (path to the PEM-encoded Ed25519
+// public key matching the control center's BUNDLE_SIGNING_KEY), and
+// AGENT_BUNDLE_DIR ("bundles") environment variables.
+func bundleLoaderFromEnv() (*bundleLoader, error) {
+	l := &bundleLoader{
+		// Bundles can be large and links slow, so only a stalled download
+		// times out.
+		cc: client.NewFromEnv(client.WithHTTPClient(&http.Client{
+			Transport: &http.Transport{ResponseHeaderTimeout: 30 * time.Second},
+		}), client.WithDeprecationHandler(func(d client.Deprecation) {
+			log.Printf("Warning: %s", d)
+		})),
+		dir: os.Getenv("AGENT_BUNDLE_DIR"),
+	}
+	if l.dir == "" {
+		l.dir = defaultBundleDir
+	}
+	path := os.Getenv("BUNDLE_PUBLIC_KEY")
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read BUNDLE_PUBLIC_KEY: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("BUNDLE_PUBLIC_KEY is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BUNDLE_PUBLIC_KEY: %w", err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("BUNDLE_PUBLIC_KEY must be an Ed25519 key")
+	}
+	l.key = key
+	return l, nil
+}
+
+// fetch returns the path of a bundle's archive, downloading it unless a
+// verified copy is already on disk. The signature is checked before anything
+// is downloaded and the checksum after.
+func (l *bundleLoader) fetch(b Bundle) (string, error) {
+	if l.key == nil {
+		return "", errors.New("BUNDLE_PUBLIC_KEY is not set, so the bundle's signature cannot be verified")
+	}
+	sig, err := base64.StdEncoding.DecodeString(b.Signature)
+	if err != nil || !ed25519.Verify(l.key, b.SigningPayload(), sig) {
+		return "", fmt.Errorf("bundle %s has an invalid signature", b.ID)
+	}
+
+	path := filepath.Join(l.dir, b.ID+".tar")
+	if sum, err := fileSHA256(path); err == nil && sum == b.SHA256 {
+		return path, nil
+	}
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return "", err
+	}
+	part := path + ".part"
+	if err := l.download(b.ID, part); err != nil {
+		return "", err
+	}
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return "", err
+	}
+	if sum != b.SHA256 {
+		os.Remove(part)
+		return "", fmt.Errorf("bundle %s has checksum %s, expected %s", b.ID, sum, b.SHA256)
+	}
+	return path, os.Rename(part, path)
+}
+
+// download fetches a bundle's archive into a file, resuming a download that
+// was interrupted earlier.
+func (l *bundleLoader) download(id, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	content, start, err := l.cc.DownloadBundle(context.Background(), id, offset)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// The partial file is complete, or stale; the checksum decides.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not download bundle %s: %w", id, err)
+	}
+	defer content.Close()
+	if start > 0 {
+		log.Printf("Resuming download of bundle %s at byte %d", id, start)
+	} else if offset > 0 {
+		// The whole archive is sent, so the partial file is started over.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		return fmt.Errorf("download of bundle %s interrupted: %w", id, err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 checksum of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// faultInjector makes the agent misbehave on purpose, so that the control
+// center's rollout, retry, and failover logic can be tried out without a
+// real fleet. A nil faultInjector injects no faults.
+type faultInjector struct {
+	kubernetesErrorRate float64       // Fraction of Kubernetes calls that fail
+	reportDelay         time.Duration // Longest delay before a report is sent
+	heartbeatDropRate   float64       // Fraction of heartbeats that are not sent
+
+	mu   sync.Mutex // Guards rand, which the agent's goroutines share
+	rand *rand.Rand
+}
+
+// faultInjectorFromEnv reads the faults to inject from the
+// AGENT_FAULT_KUBERNETES_ERROR_RATE and AGENT_FAULT_HEARTBEAT_DROP_RATE
+// fractions (e.g. 0.2), AGENT_FAULT_REPORT_DELAY (e.g. 5s), and
+// AGENT_FAULT_SEED, which makes the faults repeatable. It returns nil if no
+// fault is set.
+func faultInjectorFromEnv() (*faultInjector, error) {
+	f := &faultInjector{}
+	var err error
+	if f.kubernetesErrorRate, err = faultRate("AGENT_FAULT_KUBERNETES_ERROR_RATE"); err != nil {
+		return nil, err
+	}
+	if f.heartbeatDropRate, err = faultRate("AGENT_FAULT_HEARTBEAT_DROP_RATE"); err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("AGENT_FAULT_REPORT_DELAY"); v != "" {
+		if f.reportDelay, err = time.ParseDuration(v); err != nil || f.reportDelay < 0 {
+			return nil, fmt.Errorf("invalid AGENT_FAULT_REPORT_DELAY %q: must be a duration such as 5s", v)
+		}
+	}
+	if f.kubernetesErrorRate == 0 && f.heartbeatDropRate == 0 && f.reportDelay == 0 {
+		return nil, nil
+	}
+	seed := uint64(time.Now().UnixNano())
+	if v := os.Getenv("AGENT_FAULT_SEED"); v != "" {
+		if seed, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid AGENT_FAULT_SEED %q: must be a non-negative integer", v)
+		}
+	}
+	f.rand = rand.New(rand.NewPCG(seed, seed))
+	log.Printf("Warning: injecting faults: %.0f%% of Kubernetes calls fail, %.0f%% of heartbeats are dropped, reports are delayed up to %s (seed %d)",
+		100*f.kubernetesErrorRate, 100*f.heartbeatDropRate, f.reportDelay, seed)
+	return f, nil
+}
+
+// faultRate reads a fraction between 0 and 1 from an environment variable.
+func faultRate(name string) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("invalid %s %q: must be a fraction between 0 and 1", name, v)
+	}
+	return rate, nil
+}
+
+// chance reports true with the given probability.
+func (f *faultInjector) chance(rate float64) bool {
+	if rate == 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64() < rate
+}
+
+// kubernetesCall returns an error for a Kubernetes call that is to fail.
+func (f *faultInjector) kubernetesCall() error {
+	if f == nil || !f.chance(f.kubernetesErrorRate) {
+		return nil
+	}
+	return fmt.Errorf("injected fault: the Kubernetes API is unavailable")
+}
+
+// dropHeartbeat reports whether a heartbeat is to be left unsent.
+func (f *faultInjector) dropHeartbeat() bool {
+	if f == nil || !f.chance(f.heartbeatDropRate) {
+		return false
+	}
+	log.Printf("Injected fault: dropping heartbeat")
+	return true
+}
+
+// delayReport waits a random time before a status report or operation
+// result is sent. Reports are delayed in place rather than sent later, so
+// they still arrive in order.
+func (f *faultInjector) delayReport() {
+	if f == nil || f.reportDelay == 0 {
+		return
+	}
+	f.mu.Lock()
+	d := time.Duration(f.rand.Int64N(int64(f.reportDelay) + 1))
+	f.mu.Unlock()
+	time.Sleep(d)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gpusFromEnv returns the GPUs the agent reports to the control center. They
+// are read from AGENT_GPUS, a comma-separated list of <model>=<count> or
+// "none", or else found with nvidia-smi. It returns nil if neither tells, and
+// the control center then does not check GPU requests against the agent.
+func gpusFromEnv() ([]GPUInventory, error) {
+	if v := os.Getenv("AGENT_GPUS"); v != "" {
+		return parseGPUs(v)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "nvidia-smi", "--query-gpu=name", "--format=csv,noheader").Output()
+	if err != nil {
+		return nil, nil
+	}
+	gpus := []GPUInventory{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			gpus = addGPUs(gpus, name, 1)
+		}
+	}
+	return gpus, nil
+}
+
+// parseGPUs parses an AGENT_GPUS value such as "NVIDIA L4=2,NVIDIA T4=1".
+func parseGPUs(v string) ([]GPUInventory, error) {
+	gpus := []GPUInventory{}
+	if v == "none" {
+		return gpus, nil
+	}
+	for _, entry := range strings.Split(v, ",") {
+		model, count, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || strings.TrimSpace(model) == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid AGENT_GPUS entry %q: must be <model>=<count>", entry)
+		}
+		gpus = addGPUs(gpus, strings.TrimSpace(model), n)
+	}
+	return gpus, nil
+}
+
+// addGPUs adds n GPUs of a model to an inventory.
+func addGPUs(gpus []GPUInventory, model string, n int) []GPUInventory {
+	for i := range gpus {
+		if gpus[i].Model == model {
+			gpus[i].Count += n
+			return gpus
+		}
+	}
+	return append(gpus, GPUInventory{Model: model, Count: n})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// fieldManager owns the fields the agent applies.
+	fieldManager = "edge-orchestration-agent"
+	// operationTimeout bounds how long one cluster operation may take.
+	operationTimeout = 2 * time.Minute
+)
+
+// operationReporter sends the results of cluster operations to the control
+// center.
+type operationReporter interface {
+	reportOperation(result StreamOperationResult)
+}
+
+// clusterOperator carries out the cluster operations the control center
+// sends against the agent's local Kubernetes API, one at a time in the order
+// they arrive, with server-side apply.
+type clusterOperator struct {
+	client    dynamic.Interface // nil unless AGENT_KUBERNETES is "true"
+	mapper    meta.ResettableRESTMapper
+	simulated *simulatedCluster // nil unless AGENT_KUBERNETES is "simulated"
+	faults    *faultInjector
+	queue     chan queuedOperation
+}
+
+// queuedOperation is an operation waiting to be carried out, with where to
+// report it.
+type queuedOperation struct {
+	op       ClusterOperation
+	reporter operationReporter
+}
+
+// clusterOperatorFromEnv connects to the cluster in KUBECONFIG, or else the
+// cluster the agent runs in, if AGENT_KUBERNETES is "true", or to a
+// simulated cluster if it is "simulated". Otherwise the operator fails every
+// operation, so the control center learns why. Kubernetes calls fail as
+// faults says.
+func clusterOperatorFromEnv(faults *faultInjector) (*clusterOperator, error) {
+	o := &clusterOperator{faults: faults, queue: make(chan queuedOperation, 100)}
+	go o.run()
+	switch v := os.Getenv("AGENT_KUBERNETES"); v {
+	case "", "false":
+		return o, nil
+	case "simulated":
+		o.simulated = newSimulatedCluster()
+		log.Printf("Carrying out cluster operations against a simulated cluster")
+		return o, nil
+	case "true":
+	default:
+		return nil, fmt.Errorf("invalid AGENT_KUBERNETES %q: must be true, false, or simulated", v)
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load Kubernetes client configuration: %w", err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	o.client = client
+	o.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	log.Printf("Carrying out cluster operations against %s", config.Host)
+	return o, nil
+}
+
+// enqueue queues an operation to be carried out and reported to reporter.
+// Operations the agent cannot keep up with are failed right away.
+func (o *clusterOperator) enqueue(op ClusterOperation, reporter operationReporter) {
+	select {
+	case o.queue <- queuedOperation{op: op, reporter: reporter}:
+	default:
+		reporter.reportOperation(StreamOperationResult{OperationID: op.ID, Error: "too many operations are waiting on the agent"})
+	}
+}
+
+// run carries out queued operations. It never returns.
+func (o *clusterOperator) run() {
+	for q := range o.queue {
+		result := o.execute(q.op)
+		log.Printf("Cluster operation %s: %s of %d objects done", q.op.ID, q.op.Action, len(q.op.Objects))
+		q.reporter.reportOperation(result)
+	}
+}
+
+// execute applies or deletes an operation's objects in order, going on past
+// objects that fail.
+func (o *clusterOperator) execute(op ClusterOperation) StreamOperationResult {
+	result := StreamOperationResult{OperationID: op.ID}
+	if o.client == nil && o.simulated == nil {
+		result.Error = "the agent has no Kubernetes API to use; start it with AGENT_KUBERNETES=true"
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+	for _, object := range op.Objects {
+		result.Results = append(result.Results, o.executeObject(ctx, op, &unstructured.Unstructured{Object: object}))
+	}
+	return result
+}
+
+// executeObject applies or deletes one object.
+func (o *clusterOperator) executeObject(ctx context.Context, op ClusterOperation, obj *unstructured.Unstructured) ObjectResult {
+	r := ObjectResult{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	fail := func(err error) ObjectResult {
+		r.Result, r.Error = "failed", err.Error()
+		return r
+	}
+	if err := o.faults.kubernetesCall(); err != nil {
+		return fail(err)
+	}
+	if o.simulated != nil {
+		return o.simulated.execute(op, r, obj)
+	}
+	gvk := obj.GroupVersionKind()
+	mapping, err := o.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// The kind may have been installed since discovery was cached.
+		o.mapper.Reset()
+		mapping, err = o.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	var resource dynamic.ResourceInterface = o.client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if r.Namespace == "" {
+			r.Namespace = op.Namespace
+		}
+		if r.Namespace == "" {
+			r.Namespace = metav1.NamespaceDefault
+		}
+		obj.SetNamespace(r.Namespace)
+		resource = o.client.Resource(mapping.Resource).Namespace(r.Namespace)
+	}
+
+	switch op.Action {
+	case "apply":
+		if _, err := resource.Apply(ctx, r.Name, obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+			return fail(err)
+		}
+		r.Result = "applied"
+	case "delete":
+		propagation := metav1.DeletePropagationBackground
+		err := resource.Delete(ctx, r.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		switch {
+		case apierrors.IsNotFound(err):
+			r.Result = "not_found"
+		case err != nil:
+			return fail(err)
+		default:
+			r.Result = "deleted"
+		}
+	default:
+		return fail(fmt.Errorf("unknown action %q", op.Action))
+	}
+	return r
+}
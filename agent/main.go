@@ -1,177 +1,389 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"net"
+	"net/url"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
 	"time"
 )
 
+// version is the agent's build version, reported to the control center. It
+// is set when building a release with -ldflags "-X main.version=1.4.2".
+var version = "dev"
+
 const (
 	// Default control center address; can be overridden by the CONTROL_CENTER_ADDR environment variable.
 	defaultControlCenterAddress = "http://localhost:8080"
+	// defaultStreamPort is the control center's agent stream port.
+	defaultStreamPort = "8081"
 )
 
-// AgentInfo holds the ID assigned by the control center upon registration.
-type AgentInfo struct {
-	ID string `json:"id"`
+// statusReporter sends deployment status changes to the control center.
+type statusReporter interface {
+	reportStatus(deploymentID string, status DeploymentStatus, reason string)
 }
 
-// Deployment matches the structure in the control-center.
-type Deployment struct {
-	ID       string `json:"id"`
-	AgentID  string `json:"agent_id"`
-	ImageURL string `json:"image_url"`
-	Status   string `json:"status"`
+// registration returns the message that registers the agent, or reconnects it
+// once it has an ID.
+func (a *agent) registration() *StreamRegister {
+	return &StreamRegister{
+		AgentID:         a.id,
+		Credential:      a.credential,
+		Address:         a.address,
+		Timezone:        a.timezone,
+		GPUs:            a.gpus,
+		Labels:          a.labels,
+		BootstrapToken:  a.bootstrapToken,
+		Version:         version,
+		ProtocolVersion: protocolVersion,
+	}
 }
 
-// RegistrationResponse is the expected response body from the registration endpoint.
-type RegistrationResponse struct {
-	ID      string `json:"id"`
-	Address string `json:"address"`
-	Status  string `json:"status"`
+// heartbeat returns the message that tells the control center the agent is
+// alive.
+func heartbeat() *StreamHeartbeat {
+	return &StreamHeartbeat{Version: version, ProtocolVersion: protocolVersion}
 }
 
-func main() {
-	// Determine control center address from environment variable or use default.
-	addr := os.Getenv("CONTROL_CENTER_ADDR")
-	if addr == "" {
-		addr = defaultControlCenterAddress
-	}
-
-	log.Printf("Agent starting, attempting to connect to control center at %s", addr)
+// agent holds the state an agent keeps across connections to the control center.
+type agent struct {
+	id         string // Assigned by the control center on first registration
+	credential string // Issued with the ID; sent to reconnect under it
+	address    string
+	timezone   string            // IANA time zone of the site, reported for deployment schedules
+	gpus       []GPUInventory    // Reported so the control center schedules GPU requests within them; nil if unknown
+	labels     map[string]string // Advertised so deployments can select the agent by them
+	// Sent when registering, for control centers that only let agents
+	// with a bootstrap token register.
+	bootstrapToken string
+	// Maps deployment IDs to the latest revision that has been handled.
+	processed map[string]int
+	bundles   *bundleLoader
+	artifacts *artifactFetcher
+	tunnel    *clusterTunnel // nil unless AGENT_TUNNEL_TARGET is set
+	operator  *clusterOperator
+	faults    *faultInjector // nil unless AGENT_FAULT_* variables are set
+	// Digest of the desired state last applied, compared with the one
+	// heartbeat replies name to notice missed changes.
+	desiredState string
+}
 
-	// 1. Register the agent with the control center.
-	agentInfo, err := registerAgent(addr)
+func main() {
+	log.Printf("Agent version %s, protocol version %d", version, protocolVersion)
+	// In a real scenario, this address would be the agent's actual listening address.
+	a := &agent{address: "agent-instance-1:9090", processed: make(map[string]int), bootstrapToken: os.Getenv("AGENT_BOOTSTRAP_TOKEN")}
+	bundles, err := bundleLoaderFromEnv()
 	if err != nil {
-		log.Fatalf("Fatal: Failed to register agent: %v", err)
+		log.Fatalf("Fatal: %v", err)
+	}
+	a.bundles = bundles
+	a.artifacts = artifactFetcherFromEnv()
+	if a.timezone, err = timezoneFromEnv(); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if a.gpus, err = gpusFromEnv(); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if a.gpus != nil {
+		log.Printf("Reporting GPUs: %v", a.gpus)
+	}
+	if a.labels, err = labelsFromEnv(); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if a.tunnel, err = tunnelFromEnv(); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if a.faults, err = faultInjectorFromEnv(); err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if a.operator, err = clusterOperatorFromEnv(a.faults); err != nil {
+		log.Fatalf("Fatal: %v", err)
 	}
-	log.Printf("Agent registered successfully with ID: %s", agentInfo.ID)
 
-	// 2. Start sending periodic heartbeats in a background goroutine.
-	go sendHeartbeats(addr, agentInfo.ID)
+	// AGENT_TRANSPORT selects how the agent reaches the control center: a
+	// gRPC stream (the default) or an MQTT broker.
+	switch transport := os.Getenv("AGENT_TRANSPORT"); transport {
+	case "", "grpc":
+		addr := controlCenterStreamAddress()
+		log.Printf("Agent starting, attempting to connect to control center at %s", addr)
+		a.run(addr)
+	case "mqtt":
+		cfg, err := mqttConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Fatal: %v", err)
+		}
+		log.Printf("Agent starting, attempting to reach control center through MQTT broker %s", cfg.broker)
+		a.runMQTT(cfg)
+	default:
+		log.Fatalf("Fatal: Unknown AGENT_TRANSPORT %q: must be grpc or mqtt", transport)
+	}
+}
 
-	// 3. Start polling for new deployments.
-	go pollForDeployments(addr, agentInfo.ID)
+// timezoneFromEnv returns the site's IANA time zone from AGENT_TIMEZONE, or
+// else TZ. It returns "" if neither is set, and the control center then
+// schedules the agent's deployments in UTC.
+func timezoneFromEnv() (string, error) {
+	tz := os.Getenv("AGENT_TIMEZONE")
+	if tz == "" {
+		tz = os.Getenv("TZ")
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return "", fmt.Errorf("invalid time zone %q: %v", tz, err)
+	}
+	return tz, nil
+}
 
-	// Keep the main application running indefinitely.
-	log.Println("Agent is running. Press Ctrl+C to exit.")
-	select {}
+// labelsFromEnv returns the labels the agent advertises: the comma-separated
+// key=value pairs in AGENT_LABELS, e.g. gpu=jetson,site=store-104, plus arch
+// and os labels from the agent's platform unless AGENT_LABELS sets them.
+func labelsFromEnv() (map[string]string, error) {
+	labels := map[string]string{"arch": runtime.GOARCH, "os": runtime.GOOS}
+	v := os.Getenv("AGENT_LABELS")
+	if v == "" {
+		return labels, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid AGENT_LABELS %q: expected comma-separated key=value pairs", v)
+		}
+		labels[key] = value
+	}
+	return labels, nil
 }
 
-func pollForDeployments(addr, agentID string) {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+// controlCenterStreamAddress returns the host:port of the control center's
+// agent stream, from CONTROL_CENTER_GRPC_ADDR or else the host of
+// CONTROL_CENTER_ADDR on port 8081.
+func controlCenterStreamAddress() string {
+	if addr := os.Getenv("CONTROL_CENTER_GRPC_ADDR"); addr != "" {
+		return addr
+	}
+	addr := os.Getenv("CONTROL_CENTER_ADDR")
+	if addr == "" {
+		addr = defaultControlCenterAddress
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Hostname() == "" {
+		log.Fatalf("Fatal: Invalid CONTROL_CENTER_ADDR %q", addr)
+	}
+	return net.JoinHostPort(u.Hostname(), defaultStreamPort)
+}
 
-	processedDeployments := make(map[string]bool)
+// apply reconciles the deployments the control center sent and records their
+// desired state.
+func (a *agent) apply(r statusReporter, state *StreamDeployments) {
+	a.reconcile(r, state.Deployments, state.Configs, state.Secrets, state.Bundles)
+	a.desiredState = state.DesiredState
+}
 
-	for {
-		<-ticker.C
-		log.Println("Polling for new deployments...")
+// outOfSync reports whether a heartbeat reply names another desired state
+// than the one last applied. Control centers that do not reply are trusted
+// to push every change.
+func (a *agent) outOfSync(reply *StreamHeartbeatReply) bool {
+	if reply.DesiredState == a.desiredState {
+		return false
+	}
+	log.Printf("Desired state %s differs from the applied %s, asking for deployments", reply.DesiredState, a.desiredState)
+	return true
+}
 
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/deployments?agent_id=%s", addr, agentID), nil)
-		if err != nil {
-			log.Printf("Error creating deployment request: %v", err)
+// reconcile brings the agent's workloads in line with the deployments the
+// control center pushed.
+func (a *agent) reconcile(r statusReporter, deployments []Deployment, configs map[string]Config, secrets map[string]string, bundles map[string]Bundle) {
+	listed := make(map[string]bool, len(deployments))
+	for _, dep := range deployments {
+		listed[dep.ID] = true
+		// Expired deployments are torn down once; the control center
+		// archives them after a grace period. Paused deployments are torn
+		// down too, and come back as a new revision when resumed.
+		if dep.Status == "expired" || dep.Status == "paused" {
+			if _, running := a.processed[dep.ID]; running {
+				log.Printf("Deployment %s %s, stopping workload (simulated)", dep.ID, dep.Status)
+				delete(a.processed, dep.ID)
+			}
 			continue
 		}
-
-		client := &http.Client{Timeout: 5 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Error polling for deployments: %v", err)
+		// Only deployments the control center has scheduled may be started;
+		// pending, failed, and retired deployments are skipped.
+		switch dep.Status {
+		case "scheduled", "deploying", "running", "degraded":
+		default:
 			continue
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Polling for deployments failed with status %d", resp.StatusCode)
-			resp.Body.Close()
-			continue
+		// A simple mechanism to avoid re-processing deployments; a new
+		// revision of a known deployment is handled again.
+		if dep.Revision > a.processed[dep.ID] {
+			log.Printf("Found deployment %s revision %d for image %s", dep.ID, dep.Revision, dep.ImageURL)
+			a.handleDeployment(r, dep, configs, secrets, bundles)
+			a.processed[dep.ID] = dep.Revision
 		}
-
-		var deployments []Deployment
-		if err := json.NewDecoder(resp.Body).Decode(&deployments); err != nil {
-			log.Printf("Error decoding deployment response: %v", err)
-			resp.Body.Close()
-			continue
+	}
+	// Deployments that were deleted are no longer listed and are torn down.
+	for id := range a.processed {
+		if !listed[id] {
+			log.Printf("Deployment %s deleted, stopping workload (simulated)", id)
+			delete(a.processed, id)
 		}
-		resp.Body.Close()
+	}
+}
 
-		for _, dep := range deployments {
-			// A simple mechanism to avoid re-processing deployments.
-			if !processedDeployments[dep.ID] {
-				log.Printf("Found new deployment %s for image %s", dep.ID, dep.ImageURL)
-				handleDeployment(dep)
-				processedDeployments[dep.ID] = true
+func (a *agent) handleDeployment(r statusReporter, dep Deployment, configs map[string]Config, secrets map[string]string, bundles map[string]Bundle) {
+	image := pinnedImage(dep)
+	if dep.Bundle != "" {
+		b, exists := bundles[dep.Bundle]
+		if !exists {
+			log.Printf("Error: bundle %s for deployment %s was not sent by the control center", dep.Bundle, dep.ID)
+			r.reportStatus(dep.ID, "failed", fmt.Sprintf("Bundle %s not found", dep.Bundle))
+			return
+		}
+		log.Printf("Handling deployment %s: Downloading bundle %s of image %s", dep.ID, b.ID, image)
+		r.reportStatus(dep.ID, "deploying", fmt.Sprintf("Downloading bundle %s (%d bytes)", b.ID, b.Size))
+		path, err := a.bundles.fetch(b)
+		if err != nil {
+			log.Printf("Error: deployment %s: %v", dep.ID, err)
+			r.reportStatus(dep.ID, "failed", err.Error())
+			return
+		}
+		// In a future step, this will load the archive into containerd.
+		log.Printf("Deployment %s: Loading bundle %s from %s into the container runtime (simulated)", dep.ID, b.ID, path)
+	} else {
+		log.Printf("Handling deployment %s: Pulling image %s", dep.ID, image)
+		r.reportStatus(dep.ID, "deploying", fmt.Sprintf("Pulling image %s", image))
+	}
+	for _, v := range dep.Volumes {
+		log.Printf("Deployment %s: Mounting %s at %s", dep.ID, describeVolume(v), v.MountPath)
+	}
+	// Artifacts are downloaded before the container starts, like an init
+	// container would, and a failed download or checksum fails the deployment.
+	for _, art := range dep.Artifacts {
+		log.Printf("Handling deployment %s: Fetching artifact %s from %s", dep.ID, art.Name, art.Source)
+		r.reportStatus(dep.ID, "deploying", fmt.Sprintf("Downloading artifact %s from %s", art.Name, art.Source))
+		path, err := a.artifacts.fetch(art)
+		if err != nil {
+			log.Printf("Error: deployment %s: %v", dep.ID, err)
+			r.reportStatus(dep.ID, "failed", err.Error())
+			return
+		}
+		log.Printf("Deployment %s: Mounting artifact %s from %s at %s (ro)", dep.ID, art.Name, path, art.MountPath)
+	}
+	for _, ref := range dep.Configs {
+		cfg, exists := configs[ref.Key()]
+		if !exists {
+			log.Printf("Error: config %s version %d for deployment %s was not sent by the control center", ref.Name, ref.Version, dep.ID)
+			r.reportStatus(dep.ID, "failed", fmt.Sprintf("Config %s version %d not found", ref.Name, ref.Version))
+			return
+		}
+		if ref.MountPath != "" {
+			log.Printf("Deployment %s: Mounting config %s version %d (%d files) at %s", dep.ID, cfg.Name, cfg.Version, len(cfg.Data), ref.MountPath)
+		}
+		if ref.Env {
+			injected := 0
+			for key := range cfg.Data {
+				if isEnvName(key) {
+					injected++
+				} else {
+					log.Printf("Deployment %s: Skipping config %s key %s, which is not a valid environment variable name", dep.ID, cfg.Name, key)
+				}
 			}
+			log.Printf("Deployment %s: Injecting config %s version %d as %d environment variables", dep.ID, cfg.Name, cfg.Version, injected)
 		}
 	}
-}
-
-func handleDeployment(dep Deployment) {
-	log.Printf("Handling deployment %s: Pulling image %s", dep.ID, dep.ImageURL)
+	// Secret values are only ever passed to the container, never logged.
+	for _, ref := range dep.Secrets {
+		if _, exists := secrets[ref.Key()]; !exists {
+			log.Printf("Error: secret %s version %d for deployment %s was not sent by the control center", ref.Name, ref.Version, dep.ID)
+			r.reportStatus(dep.ID, "failed", fmt.Sprintf("Secret %s version %d not found", ref.Name, ref.Version))
+			return
+		}
+		log.Printf("Deployment %s: Injecting secret %s version %d as %s", dep.ID, ref.Name, ref.Version, ref.Env)
+	}
+	for _, addon := range dep.Addons {
+		keys := make([]string, 0, len(addon.Env))
+		for key := range addon.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		log.Printf("Deployment %s: Injecting add-on %s connection details as %s", dep.ID, addon.Name, strings.Join(keys, ", "))
+	}
+	if dep.AddonOf != "" {
+		log.Printf("Deployment %s: Runs an add-on of deployment %s, reachable at host %s", dep.ID, dep.AddonOf, dep.ID)
+	}
+	if sb := dep.Sandbox; sb != nil {
+		dests := []string{"DNS"}
+		for _, addon := range dep.Addons {
+			dests = append(dests, addon.DeploymentID)
+		}
+		for _, rule := range sb.Egress {
+			dest := rule.Host + rule.CIDR
+			if len(rule.Ports) > 0 {
+				dest += fmt.Sprintf(" port %v", rule.Ports)
+			}
+			dests = append(dests, dest)
+		}
+		log.Printf("Deployment %s: Sandboxing container with seccomp %s and apparmor %s, egress limited to %s", dep.ID, sb.Seccomp, sb.AppArmor, strings.Join(dests, ", "))
+	}
+	if len(dep.Args) > 0 {
+		log.Printf("Deployment %s: Starting container with arguments %q", dep.ID, dep.Args)
+	}
 	// In a future step, this will be replaced with actual containerd logic.
 	log.Printf("Deployment %s handled (simulated).", dep.ID)
+	if dep.Hook != "" {
+		// Hook jobs run to completion rather than serving.
+		r.reportStatus(dep.ID, "succeeded", "Job completed")
+		return
+	}
+	r.reportStatus(dep.ID, "running", "Workload started")
 }
 
-
-// registerAgent sends a POST request to the control center to register this agent.
-func registerAgent(addr string) (*AgentInfo, error) {
-	// In a real scenario, this address would be the agent's actual listening address.
-	regData := map[string]string{"address": "agent-instance-1:9090"}
-	jsonData, err := json.Marshal(regData)
-	if err != nil {
-		return nil, fmt.Errorf("could not marshal registration data: %w", err)
+// pinnedImage returns the image reference to pull: the resolved digest when the
+// control center pinned one, otherwise the image URL as given.
+func pinnedImage(dep Deployment) string {
+	if dep.ImageDigest == "" || strings.Contains(dep.ImageURL, "@") {
+		return dep.ImageURL
 	}
-
-	resp, err := http.Post(fmt.Sprintf("%s/api/v1/agents", addr), "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("could not send registration request: %w", err)
+	name := dep.ImageURL
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
 	}
-	defer resp.Body.Close()
+	return name + "@" + dep.ImageDigest
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("registration failed with status %d: %s", resp.StatusCode, string(body))
+// isEnvName reports whether a config key can be used as an environment variable name.
+func isEnvName(key string) bool {
+	if key == "" || key[0] >= '0' && key[0] <= '9' {
+		return false
 	}
-
-	var regResponse RegistrationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&regResponse); err != nil {
-		return nil, fmt.Errorf("could not decode registration response: %w", err)
+	for _, c := range key {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
 	}
-
-	return &AgentInfo{ID: regResponse.ID}, nil
+	return true
 }
 
-// sendHeartbeats periodically sends a POST request to the control center's heartbeat endpoint.
-func sendHeartbeats(addr, agentID string) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		<-ticker.C
-		log.Println("Sending heartbeat...")
-
-		heartbeatData := map[string]string{"id": agentID}
-		jsonData, err := json.Marshal(heartbeatData)
-		if err != nil {
-			log.Printf("Error: could not marshal heartbeat data: %v", err)
-			continue
-		}
-
-		resp, err := http.Post(fmt.Sprintf("%s/api/v1/heartbeat", addr), "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			log.Printf("Error: could not send heartbeat: %v", err)
-			continue
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			log.Printf("Error: heartbeat failed with status %d: %s", resp.StatusCode, string(body))
+// describeVolume summarizes where a volume's data lives.
+func describeVolume(v Volume) string {
+	mode := "rw"
+	if v.ReadOnly {
+		mode = "ro"
+	}
+	switch {
+	case v.PVC != nil:
+		class := v.PVC.StorageClass
+		if class == "" {
+			class = "default"
 		}
-		resp.Body.Close()
+		return fmt.Sprintf("volume %s (claim %s, %s, storage class %s, %s)", v.Name, v.PVC.ClaimName, v.PVC.Size, class, mode)
+	case v.HostPath != nil:
+		return fmt.Sprintf("volume %s (host path %s, %s)", v.Name, v.HostPath.Path, mode)
+	case v.EmptyDir != nil && v.EmptyDir.Medium == "Memory":
+		return fmt.Sprintf("volume %s (empty dir in memory, %s)", v.Name, mode)
 	}
+	return fmt.Sprintf("volume %s (empty dir, %s)", v.Name, mode)
 }
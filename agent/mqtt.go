@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultMQTTTopicPrefix = "edge"
+	mqttQoS                = 1 // At least once; repeated deployment lists are harmless
+)
+
+// mqttConfig describes how to reach the control center through a broker.
+type mqttConfig struct {
+	broker   string
+	username string
+	password string
+	prefix   string
+}
+
+// mqttConfigFromEnv reads the MQTT_BROKER_URL (e.g. tcp://broker:1883),
+// MQTT_USERNAME, MQTT_PASSWORD, and MQTT_TOPIC_PREFIX ("edge") environment
+// variables.
+func mqttConfigFromEnv() (mqttConfig, error) {
+	cfg := mqttConfig{
+		broker:   os.Getenv("MQTT_BROKER_URL"),
+		username: os.Getenv("MQTT_USERNAME"),
+		password: os.Getenv("MQTT_PASSWORD"),
+		prefix:   strings.Trim(os.Getenv("MQTT_TOPIC_PREFIX"), "/"),
+	}
+	if cfg.broker == "" {
+		return cfg, fmt.Errorf("MQTT_BROKER_URL is required with AGENT_TRANSPORT=mqtt")
+	}
+	if cfg.prefix == "" {
+		cfg.prefix = defaultMQTTTopicPrefix
+	}
+	return cfg, nil
+}
+
+// mqttTransport connects the agent to the control center through an MQTT
+// broker. The agent registers on <prefix>/register/<token>, publishes
+// heartbeats and status reports on <prefix>/agents/<id>/up, and receives its
+// deployments on <prefix>/agents/<id>/down.
+type mqttTransport struct {
+	agent  *agent
+	client mqtt.Client
+	prefix string
+	token  string // Identifies this agent's registration replies
+
+	mu sync.Mutex // Guards the agent's state against the heartbeat loop
+}
+
+// runMQTT keeps the agent connected to the broker, sending heartbeats once
+// registered. It never returns.
+func (a *agent) runMQTT(cfg mqttConfig) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Fatal: could not generate registration token: %v", err)
+	}
+	t := &mqttTransport{agent: a, prefix: cfg.prefix, token: hex.EncodeToString(b)}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.broker).
+		SetClientID("edge-agent-" + t.token).
+		SetUsername(cfg.username).
+		SetPassword(cfg.password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(maxReconnectDelay).
+		SetOnConnectHandler(t.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("Connection to MQTT broker lost: %v", err)
+		})
+	t.client = mqtt.NewClient(opts)
+	t.client.Connect()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		t.mu.Lock()
+		id := a.id
+		t.mu.Unlock()
+		if id != "" && t.client.IsConnectionOpen() && !a.faults.dropHeartbeat() {
+			t.publish(t.upTopic(id), &AgentMessage{Heartbeat: heartbeat()})
+		}
+	}
+}
+
+func (t *mqttTransport) upTopic(id string) string   { return t.prefix + "/agents/" + id + "/up" }
+func (t *mqttTransport) downTopic(id string) string { return t.prefix + "/agents/" + id + "/down" }
+
+// onConnect registers the agent whenever the connection to the broker is
+// established, sending its previous ID so it keeps its identity.
+func (t *mqttTransport) onConnect(c mqtt.Client) {
+	log.Printf("Connected to MQTT broker")
+	reply := t.prefix + "/register/" + t.token + "/reply"
+	if token := c.Subscribe(reply, mqttQoS, t.onReply); token.Wait() && token.Error() != nil {
+		log.Printf("Error: could not subscribe to %s: %v", reply, token.Error())
+		return
+	}
+	t.mu.Lock()
+	id := t.agent.id
+	t.mu.Unlock()
+	if id != "" {
+		c.Subscribe(t.downTopic(id), mqttQoS, t.onDown)
+	}
+	t.register()
+}
+
+func (t *mqttTransport) register() {
+	t.mu.Lock()
+	req := t.agent.registration()
+	t.mu.Unlock()
+	t.publish(t.prefix+"/register/"+t.token, req)
+}
+
+// onReply handles the control center's answer to a registration.
+func (t *mqttTransport) onReply(c mqtt.Client, m mqtt.Message) {
+	var msg ControlMessage
+	if err := json.Unmarshal(m.Payload(), &msg); err != nil {
+		log.Printf("Error: invalid registration reply: %v", err)
+		return
+	}
+	if msg.Error != nil {
+		log.Printf("Error: registration failed: %s", msg.Error.Message)
+		return
+	}
+	if msg.Registered == nil {
+		return
+	}
+
+	t.mu.Lock()
+	previous := t.agent.id
+	t.agent.id = msg.Registered.AgentID
+	if msg.Registered.Credential != "" {
+		t.agent.credential = msg.Registered.Credential
+	}
+	credential := t.agent.credential
+	t.mu.Unlock()
+	t.agent.tunnel.setAgent(msg.Registered.AgentID, credential)
+	if previous == msg.Registered.AgentID {
+		log.Printf("Agent reconnected with ID: %s", previous)
+		return
+	}
+	log.Printf("Agent registered successfully with ID: %s", msg.Registered.AgentID)
+	if previous != "" {
+		c.Unsubscribe(t.downTopic(previous))
+	}
+	// Handlers must not wait for the broker, so the subscription completes
+	// in the background.
+	c.Subscribe(t.downTopic(msg.Registered.AgentID), mqttQoS, t.onDown)
+}
+
+// onDown handles deployments, heartbeat replies, and errors the control center
+// sends the agent.
+func (t *mqttTransport) onDown(_ mqtt.Client, m mqtt.Message) {
+	var msg ControlMessage
+	if err := json.Unmarshal(m.Payload(), &msg); err != nil {
+		log.Printf("Error: invalid message from control center: %v", err)
+		return
+	}
+	switch {
+	case msg.Deployments != nil:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.agent.apply(t, msg.Deployments)
+	case msg.Heartbeat != nil:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.agent.outOfSync(msg.Heartbeat) {
+			t.publish(t.upTopic(t.agent.id), &AgentMessage{Sync: &StreamSync{DesiredState: t.agent.desiredState}})
+		}
+	case msg.Operation != nil:
+		t.agent.operator.enqueue(*msg.Operation, t)
+	case msg.Error != nil && msg.Error.DeploymentID != "":
+		log.Printf("Error from control center for deployment %s: %s", msg.Error.DeploymentID, msg.Error.Message)
+	case msg.Error != nil:
+		log.Printf("Error from control center: %s; registering again", msg.Error.Message)
+		t.register()
+	}
+}
+
+// reportStatus notifies the control center of a deployment status change. It
+// is called with t.mu held.
+func (t *mqttTransport) reportStatus(deploymentID string, status DeploymentStatus, reason string) {
+	t.agent.faults.delayReport()
+	t.publish(t.upTopic(t.agent.id), &AgentMessage{Status: &StreamStatus{DeploymentID: deploymentID, Status: status, Reason: reason}})
+}
+
+// reportOperation sends the control center the result of a cluster
+// operation.
+func (t *mqttTransport) reportOperation(result StreamOperationResult) {
+	t.agent.faults.delayReport()
+	t.mu.Lock()
+	id := t.agent.id
+	t.mu.Unlock()
+	t.publish(t.upTopic(id), &AgentMessage{Operation: &result})
+}
+
+// publish sends a message without waiting for the broker, since it may be
+// called from a message handler.
+func (t *mqttTransport) publish(topic string, msg any) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error: could not encode message for %s: %v", topic, err)
+		return
+	}
+	token := t.client.Publish(topic, mqttQoS, false, payload)
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Error: could not publish to %s: %v", topic, token.Error())
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// clusterScopedKinds are the kinds the simulated cluster keeps outside of
+// namespaces; all other kinds are namespaced.
+var clusterScopedKinds = map[string]bool{
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"StorageClass":                   true,
+	"PriorityClass":                  true,
+	"IngressClass":                   true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"APIService":                     true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// simulatedCluster stands in for a Kubernetes API, so that cluster operations
+// can be tried out on agents without a cluster. It keeps applied objects in
+// memory and accepts any kind. It is only used by the operator's goroutine.
+type simulatedCluster struct {
+	objects map[string]map[string]any // By apiVersion/kind/namespace/name
+}
+
+func newSimulatedCluster() *simulatedCluster {
+	return &simulatedCluster{objects: make(map[string]map[string]any)}
+}
+
+// execute applies or deletes one object like executeObject does against a
+// real cluster, filling in r.
+func (c *simulatedCluster) execute(op ClusterOperation, r ObjectResult, obj *unstructured.Unstructured) ObjectResult {
+	if r.Name == "" {
+		r.Result, r.Error = "failed", "object has no name"
+		return r
+	}
+	if !clusterScopedKinds[r.Kind] {
+		if r.Namespace == "" {
+			r.Namespace = op.Namespace
+		}
+		if r.Namespace == "" {
+			r.Namespace = metav1.NamespaceDefault
+		}
+		obj.SetNamespace(r.Namespace)
+	}
+	key := strings.Join([]string{r.APIVersion, r.Kind, r.Namespace, r.Name}, "/")
+
+	switch op.Action {
+	case "apply":
+		c.objects[key] = obj.Object
+		r.Result = "applied"
+	case "delete":
+		if _, exists := c.objects[key]; !exists {
+			r.Result = "not_found"
+			break
+		}
+		delete(c.objects, key)
+		r.Result = "deleted"
+	default:
+		r.Result, r.Error = "failed", fmt.Sprintf("unknown action %q", op.Action)
+	}
+	return r
+}
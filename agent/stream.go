@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// agentStreamMethod is the full gRPC method name of the agent stream.
+	agentStreamMethod = "/edgeorchestration.v1.AgentService/Connect"
+	// heartbeatInterval is how often the agent tells the control center it is alive.
+	heartbeatInterval = 30 * time.Second
+	// maxReconnectDelay caps the backoff between connection attempts.
+	maxReconnectDelay = 30 * time.Second
+)
+
+// The control center exchanges JSON messages with agents over gRPC.
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes gRPC messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// controlStream is the agent's connection to the control center. Status
+// reports and heartbeats are sent from different goroutines, so sends are
+// serialized.
+type controlStream struct {
+	mu     sync.Mutex
+	stream grpc.ClientStream
+	faults *faultInjector
+}
+
+func (c *controlStream) send(msg *AgentMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stream.SendMsg(msg)
+}
+
+// reportStatus notifies the control center of a deployment status change so it
+// shows up in the deployment's event timeline.
+func (c *controlStream) reportStatus(deploymentID string, status DeploymentStatus, reason string) {
+	c.faults.delayReport()
+	err := c.send(&AgentMessage{Status: &StreamStatus{DeploymentID: deploymentID, Status: status, Reason: reason}})
+	if err != nil {
+		log.Printf("Error: could not report status for deployment %s: %v", deploymentID, err)
+	}
+}
+
+// reportOperation sends the control center the result of a cluster
+// operation.
+func (c *controlStream) reportOperation(result StreamOperationResult) {
+	c.faults.delayReport()
+	if err := c.send(&AgentMessage{Operation: &result}); err != nil {
+		log.Printf("Error: could not report cluster operation %s: %v", result.OperationID, err)
+	}
+}
+
+// run keeps the agent connected to the control center, reconnecting with
+// exponential backoff whenever the stream breaks. It never returns.
+func (a *agent) run(addr string) {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 10 * time.Second, PermitWithoutStream: true}),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsonCodec{}.Name())),
+	)
+	if err != nil {
+		log.Fatalf("Fatal: Invalid control center address %s: %v", addr, err)
+	}
+	defer conn.Close()
+
+	delay := time.Second
+	for {
+		start := time.Now()
+		err := a.session(conn)
+		log.Printf("Connection to control center lost: %v", err)
+		// A session that lasted a while means the control center was
+		// reachable, so the next attempt starts with a short delay again.
+		if time.Since(start) > maxReconnectDelay {
+			delay = time.Second
+		}
+		log.Printf("Reconnecting in %s", delay)
+		time.Sleep(delay)
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// session registers the agent over a new stream, then sends heartbeats and
+// handles pushed deployments until the stream breaks. A heartbeat reply that
+// names another desired state than the one applied asks for the deployments
+// again.
+func (a *agent) session(conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, agentStreamMethod)
+	if err != nil {
+		return err
+	}
+	cs := &controlStream{stream: stream, faults: a.faults}
+	if err := cs.send(&AgentMessage{Register: a.registration()}); err != nil {
+		return err
+	}
+
+	heartbeatErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if a.faults.dropHeartbeat() {
+					continue
+				}
+				if err := cs.send(&AgentMessage{Heartbeat: heartbeat()}); err != nil {
+					heartbeatErr <- err
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg ControlMessage
+		if err := stream.RecvMsg(&msg); err != nil {
+			select {
+			case hbErr := <-heartbeatErr:
+				return fmt.Errorf("heartbeat failed: %w", hbErr)
+			default:
+				return err
+			}
+		}
+		switch {
+		case msg.Registered != nil:
+			if a.id != msg.Registered.AgentID {
+				log.Printf("Agent registered successfully with ID: %s", msg.Registered.AgentID)
+			} else {
+				log.Printf("Agent reconnected with ID: %s", a.id)
+			}
+			a.id = msg.Registered.AgentID
+			if msg.Registered.Credential != "" {
+				a.credential = msg.Registered.Credential
+			}
+			a.tunnel.setAgent(a.id, a.credential)
+		case msg.Deployments != nil:
+			a.apply(cs, msg.Deployments)
+		case msg.Heartbeat != nil:
+			if a.outOfSync(msg.Heartbeat) {
+				if err := cs.send(&AgentMessage{Sync: &StreamSync{DesiredState: a.desiredState}}); err != nil {
+					return err
+				}
+			}
+		case msg.Operation != nil:
+			a.operator.enqueue(*msg.Operation, cs)
+		case msg.Error != nil:
+			log.Printf("Error from control center for deployment %s: %s", msg.Error.DeploymentID, msg.Error.Message)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/yamux"
+
+	"edge-orchestration/api/wsconn"
+)
+
+// clusterTunnel opens a reverse tunnel to the control center, so that it can
+// reach the agent's cluster API when the agent is behind NAT: the agent dials
+// out over a WebSocket, and serves the requests the control center sends
+// over yamux streams in it by passing them on to the cluster.
+type clusterTunnel struct {
+	controlCenter *url.URL
+	token         string // Bearer token for the control center, from CONTROL_CENTER_TOKEN
+	target        *url.URL
+	proxy         *httputil.ReverseProxy
+
+	mu         sync.Mutex
+	agentID    string
+	credential string // Proves the tunnel is opened by the agent
+	started    bool
+}
+
+// tunnelFromEnv configures the tunnel from AGENT_TUNNEL_TARGET, the base URL
+// of the cluster API to expose, e.g. https://127.0.0.1:6443;
+// AGENT_TUNNEL_TOKEN_FILE, a file holding the bearer token to call it with,
+// such as a service account token, which is read again for every request so
+// rotated tokens are picked up; and AGENT_TUNNEL_CA_FILE, the PEM-encoded CA
+// certificates to verify it with. It returns nil if AGENT_TUNNEL_TARGET is
+// not set.
+func tunnelFromEnv() (*clusterTunnel, error) {
+	v := os.Getenv("AGENT_TUNNEL_TARGET")
+	if v == "" {
+		return nil, nil
+	}
+	target, err := url.Parse(v)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid AGENT_TUNNEL_TARGET %q: must be an http or https URL", v)
+	}
+	addr := os.Getenv("CONTROL_CENTER_ADDR")
+	if addr == "" {
+		addr = defaultControlCenterAddress
+	}
+	controlCenter, err := url.Parse(addr)
+	if err != nil || controlCenter.Host == "" {
+		return nil, fmt.Errorf("invalid CONTROL_CENTER_ADDR %q", addr)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if path := os.Getenv("AGENT_TUNNEL_CA_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read AGENT_TUNNEL_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("AGENT_TUNNEL_CA_FILE holds no PEM-encoded certificates")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	tokenFile := os.Getenv("AGENT_TUNNEL_TOKEN_FILE")
+
+	return &clusterTunnel{
+		controlCenter: controlCenter,
+		token:         os.Getenv("CONTROL_CENTER_TOKEN"),
+		target:        target,
+		proxy: &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.Out.Host = ""
+				if tokenFile == "" {
+					return
+				}
+				token, err := os.ReadFile(tokenFile)
+				if err != nil {
+					log.Printf("Error: could not read AGENT_TUNNEL_TOKEN_FILE: %v", err)
+					return
+				}
+				pr.Out.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+			},
+			Transport:     transport,
+			FlushInterval: -1,
+		},
+	}, nil
+}
+
+// setAgent tells the tunnel the ID and credential the agent registered with.
+// The first call starts keeping the tunnel open; later ones take effect when
+// it reconnects. It does nothing on a nil tunnel.
+func (t *clusterTunnel) setAgent(id, credential string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.agentID, t.credential = id, credential
+	if !t.started {
+		t.started = true
+		go t.run()
+	}
+}
+
+// run keeps the tunnel open, reconnecting with exponential backoff whenever
+// it breaks. It never returns.
+func (t *clusterTunnel) run() {
+	delay := time.Second
+	for {
+		start := time.Now()
+		err := t.serve()
+		log.Printf("Tunnel to control center closed: %v", err)
+		if time.Since(start) > maxReconnectDelay {
+			delay = time.Second
+		}
+		time.Sleep(delay)
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// serve opens the tunnel and passes requests on to the cluster until it
+// breaks.
+func (t *clusterTunnel) serve() error {
+	t.mu.Lock()
+	id, credential := t.agentID, t.credential
+	t.mu.Unlock()
+
+	u := *t.controlCenter
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1/agents/" + url.PathEscape(id) + "/tunnel"
+	header := http.Header{"X-Agent-Credential": {credential}}
+	if t.token != "" {
+		header.Set("Authorization", "Bearer "+t.token)
+	}
+	ws, resp, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("control center answered %s", resp.Status)
+		}
+		return err
+	}
+	cfg := yamux.DefaultConfig()
+	cfg.LogOutput = log.Writer()
+	session, err := yamux.Server(wsconn.New(ws), cfg)
+	if err != nil {
+		ws.Close()
+		return err
+	}
+	defer session.Close()
+	log.Printf("Tunnel to control center open, exposing %s", t.target)
+	return http.Serve(session, t.proxy)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "edge-orchestration/api/types"
+
+// The deployments the agent runs and the messages of its stream are defined
+// in edge-orchestration/api/types and shared with the control center.
+type (
+	Deployment            = types.Deployment
+	DeploymentStatus      = types.DeploymentStatus
+	ConfigRef             = types.ConfigRef
+	Config                = types.Config
+	Volume                = types.Volume
+	Artifact              = types.Artifact
+	GPUInventory          = types.GPUInventory
+	Bundle                = types.Bundle
+	AgentMessage          = types.AgentMessage
+	StreamRegister        = types.StreamRegister
+	StreamHeartbeat       = types.StreamHeartbeat
+	StreamStatus          = types.StreamStatus
+	StreamSync            = types.StreamSync
+	StreamOperationResult = types.StreamOperationResult
+	ClusterOperation      = types.ClusterOperation
+	ObjectResult          = types.ObjectResult
+	ControlMessage        = types.ControlMessage
+	StreamDeployments     = types.StreamDeployments
+	StreamHeartbeatReply  = types.StreamHeartbeatReply
+)
+
+// protocolVersion is the version of the messages the agent exchanges with
+// the control center.
+const protocolVersion = types.ProtocolVersion
@@ -0,0 +1,7 @@
+module edge-orchestration/api
+
+go 1.24.3
+
+require github.com/gorilla/websocket v1.5.4-0.20250319132907-e064f32e3674
+
+require golang.org/x/net v0.26.0 // indirect
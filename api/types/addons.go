@@ -0,0 +1,14 @@
+package types
+
+// Addon is a service a deployment depends on, such as a vector database or a
+// cache, that the control center runs next to it on the same agent.
+type Addon struct {
+	Type      string     `json:"type"`                // redis or qdrant
+	Name      string     `json:"name,omitempty"`      // Distinguishes add-ons of the same type and prefixes their variables; defaults to the type
+	Version   string     `json:"version,omitempty"`   // Image tag; defaults to the one the control center was built with
+	Storage   string     `json:"storage,omitempty"`   // Size of a persistent volume claim for the add-on's data, e.g. "10Gi"; scratch space if unset
+	Resources *Resources `json:"resources,omitempty"` // Resources of the add-on's own deployment
+
+	DeploymentID string            `json:"deployment_id,omitempty"` // Deployment running the add-on; set by the control center
+	Env          map[string]string `json:"env,omitempty"`           // Connection details injected into the workload; set by the control center
+}
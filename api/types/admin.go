@@ -0,0 +1,27 @@
+package types
+
+import "time"
+
+// RegistryHealth is the circuit breaker state of a registry.
+type RegistryHealth struct {
+	Registry            string    `json:"registry"`
+	State               string    `json:"state"` // "healthy", "unreachable", or "probing"
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	RetryAt             time.Time `json:"retry_at,omitempty"` // When an unreachable registry is probed next
+}
+
+// RestoreResult reports how many records a restore loaded.
+type RestoreResult struct {
+	Agents       int `json:"agents"`
+	Deployments  int `json:"deployments"`
+	Configs      int `json:"configs"`
+	Secrets      int `json:"secrets"`
+	Quotas       int `json:"quotas"`
+	Applications int `json:"applications"`
+	Fleets       int `json:"fleets"`
+	Freezes      int `json:"freezes"`
+	Channels     int `json:"channels"`
+	AlertRules   int `json:"alert_rules"`
+}
@@ -0,0 +1,66 @@
+package types
+
+import "time"
+
+// Agent represents an edge agent connected to the control center.
+type Agent struct {
+	ID               string            `json:"id"`
+	Address          string            `json:"address"`
+	LastSeen         time.Time         `json:"last_seen"`
+	Status           string            `json:"status"`
+	Timezone         string            `json:"timezone,omitempty"`           // IANA time zone the agent reported, used for deployment schedules
+	Labels           map[string]string `json:"labels,omitempty"`             // Labels the agent advertised, e.g. arch=arm64 or site=store-104, that deployments select agents by
+	GPUs             []GPUInventory    `json:"gpus"`                         // GPUs the agent reported, null if it did not; GPU requests beyond them are queued or rejected
+	ImageRewrites    []ImageRewrite    `json:"image_rewrites,omitempty"`     // Applied to the images of deployments sent to the agent
+	Maintenance      *Maintenance      `json:"maintenance,omitempty"`        // Set while the agent is cordoned
+	StaleSince       *time.Time        `json:"stale_since,omitempty"`        // When the janitor found the agent silent for too long; cleared by its next heartbeat
+	Version          string            `json:"version,omitempty"`            // Build version the agent last reported, e.g. "1.4.2"
+	ProtocolVersion  int               `json:"protocol_version,omitempty"`   // Protocol version the agent last reported
+	VersionWarning   string            `json:"version_warning,omitempty"`    // Why the agent's version is not supported, while it may still connect
+	Prices           *Prices           `json:"prices,omitempty"`             // Overrides the control center's default price hints
+	BootstrapTokenID string            `json:"bootstrap_token_id,omitempty"` // Token the agent registered with, if any
+	BootstrapLabels  map[string]string `json:"bootstrap_labels,omitempty"`   // Labels of that token, which override the ones the agent advertises
+	ArchivedAt       *time.Time        `json:"archived_at,omitempty"`        // When the agent was deleted
+}
+
+// GPUInventory is the number of GPUs of one model an agent has.
+type GPUInventory struct {
+	Model string `json:"model"` // e.g. "NVIDIA A100-SXM4-80GB"
+	Count int    `json:"count"`
+}
+
+// AgentGPUs is the GPU capacity of an agent and how much of it deployments
+// request, by GPU model.
+type AgentGPUs struct {
+	AgentID   string `json:"agent_id"`
+	Status    string `json:"status"`
+	Model     string `json:"model"`
+	Total     int    `json:"total"`
+	Allocated int    `json:"allocated"` // Requested by active deployments; those without a gpu_model are counted against the agent's first models
+	Free      int    `json:"free"`
+}
+
+// AdmissionQueue is an agent's admission queue: the pending revisions of its
+// deployments that are being admitted or wait to be.
+type AdmissionQueue struct {
+	AgentID   string   `json:"agent_id"`
+	Ordered   bool     `json:"ordered"`   // Revisions are admitted one at a time, in submission order
+	Depth     int      `json:"depth"`     // Revisions being admitted or queued
+	Admitting []string `json:"admitting"` // Deployments an attempt is running or waiting to be retried for
+	Queued    []string `json:"queued"`    // Deployments waiting to be admitted, oldest first
+}
+
+// Maintenance cordons an agent, e.g. while it is upgraded: new deployments
+// to it are rejected or queued, and its existing deployments are left alone.
+type Maintenance struct {
+	Reason   string    `json:"reason,omitempty"`
+	OnDeploy string    `json:"on_deploy"` // "reject" or "queue" new deployments
+	Since    time.Time `json:"since"`
+}
+
+// ImageRewrite redirects pulls of images below a registry or repository
+// prefix to another location, such as a mirror at an edge site.
+type ImageRewrite struct {
+	From string `json:"from"` // e.g. "docker.io" or "ghcr.io/acme"
+	To   string `json:"to"`   // e.g. "mirror.local:5000"
+}
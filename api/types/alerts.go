@@ -0,0 +1,40 @@
+package types
+
+import "time"
+
+// AlertRule describes a condition of the fleet's health that raises an alert
+// and who is notified.
+type AlertRule struct {
+	Name      string          `json:"name"`
+	Condition string          `json:"condition"`          // "deployment_failed", "agent_offline", "crashloop", or "deployment_orphaned"
+	For       string          `json:"for,omitempty"`      // How long the condition must hold before the alert fires, e.g. "10m"
+	Failures  int             `json:"failures,omitempty"` // For crashloop: failures within window that count as a crash loop; defaults to 3
+	Window    string          `json:"window,omitempty"`   // For crashloop: defaults to "15m"
+	Project   string          `json:"project,omitempty"`  // Only deployments of this project; not for agent_offline
+	AgentID   string          `json:"agent_id,omitempty"` // Only this agent or its deployments
+	Receivers []AlertReceiver `json:"receivers,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// AlertReceiver is where alerts of a rule are sent when they fire and when
+// they resolve.
+type AlertReceiver struct {
+	Type string `json:"type"` // "webhook" posts the alert as JSON, "slack" posts a message to a Slack incoming webhook
+	URL  string `json:"url"`
+}
+
+// Alert is a rule's condition holding for an agent or a deployment.
+type Alert struct {
+	ID           string     `json:"id"`
+	Rule         string     `json:"rule"`
+	Condition    string     `json:"condition"`
+	State        string     `json:"state"` // "firing" or "resolved"
+	AgentID      string     `json:"agent_id"`
+	DeploymentID string     `json:"deployment_id,omitempty"`
+	Project      string     `json:"project,omitempty"`
+	Message      string     `json:"message"`
+	Since        time.Time  `json:"since"` // When the condition started to hold
+	FiredAt      time.Time  `json:"fired_at"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,42 @@
+package types
+
+import "time"
+
+// ApplicationComponent is one workload of an application.
+type ApplicationComponent struct {
+	Name      string      `json:"name"`
+	ImageURL  string      `json:"image_url"`
+	DependsOn []string    `json:"depends_on,omitempty"` // Components that must be running before this one starts
+	Resources *Resources  `json:"resources,omitempty"`
+	Volumes   []Volume    `json:"volumes,omitempty"`
+	Configs   []ConfigRef `json:"configs,omitempty"`
+}
+
+// Application groups several workloads on one agent that are deployed,
+// rolled back, and deleted as a unit. Components start in dependency order.
+type Application struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	AgentID     string                 `json:"agent_id"`
+	Project     string                 `json:"project,omitempty"`
+	Components  []ApplicationComponent `json:"components"`
+	Revision    int                    `json:"revision"`
+	Status      string                 `json:"status"`      // Derived from the component deployments
+	Deployments map[string]string      `json:"deployments"` // Component name to deployment ID
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// ApplicationRequest is the request body for creating or updating an
+// application. Only components may change on update.
+type ApplicationRequest struct {
+	Name       string                 `json:"name"`
+	AgentID    string                 `json:"agent_id"`
+	Project    string                 `json:"project,omitempty"`
+	Components []ApplicationComponent `json:"components"`
+}
+
+// RollbackRequest is the request body for rolling back an application.
+type RollbackRequest struct {
+	Revision int `json:"revision,omitempty"` // Defaults to the previous revision
+}
@@ -0,0 +1,12 @@
+package types
+
+// Artifact is a file the agent downloads before it starts a deployment's
+// container, e.g. model weights kept out of the image, and mounts read-only.
+// The download is verified against its checksum and reused by deployments
+// with the same checksum.
+type Artifact struct {
+	Name      string `json:"name"`
+	Source    string `json:"source"`     // "hf://<org>/<repo>/<file>[@<revision>]", "s3://<bucket>/<key>", or an https:// URL
+	MountPath string `json:"mount_path"` // Path of the file in the container
+	SHA256    string `json:"sha256"`     // Hex SHA-256 checksum of the file
+}
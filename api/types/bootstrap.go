@@ -0,0 +1,25 @@
+package types
+
+import "time"
+
+// BootstrapToken lets agents register themselves, e.g. from the manifests
+// applied to a new cluster, without an operator registering each one. Agents
+// that register with it get its labels.
+type BootstrapToken struct {
+	ID          string            `json:"id"`
+	Token       string            `json:"token,omitempty"` // <id>.<secret>; only returned when the token is created
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`   // Given to the agents that register with the token
+	MaxUses     int               `json:"max_uses,omitempty"` // Registrations the token allows; unlimited if 0
+	Uses        int               `json:"uses"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// BootstrapTokenRequest is the body of a POST /bootstrap-tokens request.
+type BootstrapTokenRequest struct {
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	MaxUses     int               `json:"max_uses,omitempty"`
+	TTLSeconds  int               `json:"ttl_seconds,omitempty"` // Defaults to 24 hours
+}
@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// Bundle is an image packaged as an OCI archive for agents at sites without
+// registry access. Agents download it from the control center and check its
+// checksum and signature before loading it into their container runtime.
+type Bundle struct {
+	ID        string    `json:"id"`
+	ImageURL  string    `json:"image_url"`          // Pinned to Digest when the digest is known
+	Digest    string    `json:"digest,omitempty"`   // Digest of the image the bundle was built from
+	Platform  string    `json:"platform,omitempty"` // e.g. linux/arm64; the control center's platform if empty
+	Status    string    `json:"status"`             // "building", "ready", or "failed"
+	Reason    string    `json:"reason,omitempty"`
+	Size      int64     `json:"size,omitempty"`      // Size of the archive in bytes
+	SHA256    string    `json:"sha256,omitempty"`    // Hex SHA-256 checksum of the archive
+	Signature string    `json:"signature,omitempty"` // Ed25519 signature of SigningPayload, base64 encoded
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SigningPayload is the message a bundle's signature covers. It binds the
+// archive's checksum to the bundle and image, so that a signed archive cannot
+// be passed off as another image.
+func (b *Bundle) SigningPayload() []byte {
+	return []byte("edge-bundle-v1\n" + b.ID + "\n" + b.ImageURL + "\n" + b.SHA256)
+}
+
+// BundleRequest is the body of a request to build a bundle.
+type BundleRequest struct {
+	ImageURL string `json:"image_url"`
+	Platform string `json:"platform,omitempty"`
+}
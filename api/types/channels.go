@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+// Channel is a named release channel, such as stable, beta, or nightly. It
+// holds the image last published to it for each repository, and deployments
+// that follow the channel are moved to those images instead of a fixed tag.
+type Channel struct {
+	Name      string           `json:"name"`
+	Releases  []ChannelRelease `json:"releases"` // Latest release of each repository, ordered by repository
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// ChannelRelease is an image published to a channel.
+type ChannelRelease struct {
+	Repository  string    `json:"repository"` // Normalized repository of the image, e.g. "ghcr.io/acme/web"
+	ImageURL    string    `json:"image_url"`
+	Note        string    `json:"note,omitempty"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// PublishRequest is the body of a POST /channels/{name}/releases request.
+type PublishRequest struct {
+	ImageURL string `json:"image_url"`
+	Note     string `json:"note,omitempty"`
+}
+
+// PublishResult reports how a release was rolled out to the deployments that
+// follow its channel.
+type PublishResult struct {
+	Channel   Channel        `json:"channel"`
+	Release   ChannelRelease `json:"release"`
+	Updated   []string       `json:"updated"`   // Deployments redeployed with the release
+	Available []string       `json:"available"` // Deployments the release waits for, by schedule, manual update, or the end of a freeze
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// Config is a named set of key-value pairs that deployments can mount as
+// files or inject as environment variables.
+type Config struct {
+	Name      string            `json:"name"`
+	Data      map[string]string `json:"data"`
+	Version   int               `json:"version"` // Incremented on every change
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// ConfigRef binds a config to a deployment. Each key is mounted as a file
+// under MountPath, injected as an environment variable if Env is set, or both.
+// A reference follows the latest version of the config unless Pin is set.
+type ConfigRef struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mount_path,omitempty"`
+	Env       bool   `json:"env,omitempty"`
+	Pin       int    `json:"pin,omitempty"`     // Version to keep using when the config changes
+	Version   int    `json:"version,omitempty"` // Config version used by the current revision; set by the control center
+}
+
+// Key identifies the config version a reference resolved to, e.g.
+// "prompts@3". Agents receive configs keyed this way.
+func (r ConfigRef) Key() string {
+	return r.Name + "@" + strconv.Itoa(r.Version)
+}
+
+// ConfigRollout is the progress of rolling a config version out to the
+// deployments that follow the config.
+type ConfigRollout struct {
+	Config      string     `json:"config"`
+	Version     int        `json:"version"`
+	BatchSize   int        `json:"batch_size,omitempty"` // Deployments redeployed at a time; 0 redeploys all at once
+	State       string     `json:"state"`                // in_progress, completed, or halted
+	Updated     []string   `json:"updated"`              // Deployments redeployed with the version
+	Pending     []string   `json:"pending"`              // Deployments still to be redeployed
+	HaltedBy    string     `json:"halted_by,omitempty"`  // Deployment that failed with the version
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
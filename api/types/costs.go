@@ -0,0 +1,43 @@
+package types
+
+import "time"
+
+// Prices are price hints for the resources deployments request, used to
+// estimate what deployments cost.
+type Prices struct {
+	CPU    float64 `json:"cpu"`    // Per CPU core and hour
+	Memory float64 `json:"memory"` // Per GiB of memory and hour
+	GPU    float64 `json:"gpu"`    // Per GPU and hour
+}
+
+// DeploymentCost is the estimated cost of a deployment.
+type DeploymentCost struct {
+	ID               string           `json:"id"`
+	AgentID          string           `json:"agent_id"`
+	Project          string           `json:"project,omitempty"`
+	Status           DeploymentStatus `json:"status"`
+	HourlyRate       float64          `json:"hourly_rate"`       // What the deployment costs per hour while it runs
+	RunningHours     float64          `json:"running_hours"`     // How long its workload ran
+	Accumulated      float64          `json:"accumulated"`       // What it cost so far
+	EstimatedMonthly float64          `json:"estimated_monthly"` // What it costs per month if it keeps running; 0 unless running
+}
+
+// ProjectCost sums the estimated costs of a project's deployments.
+type ProjectCost struct {
+	Project          string  `json:"project"` // Empty for deployments without a project
+	Deployments      int     `json:"deployments"`
+	HourlyRate       float64 `json:"hourly_rate"` // Of the deployments running now
+	Accumulated      float64 `json:"accumulated"`
+	EstimatedMonthly float64 `json:"estimated_monthly"`
+}
+
+// CostReport is the response of GET /reports/costs.
+type CostReport struct {
+	Currency         string           `json:"currency"`
+	GeneratedAt      time.Time        `json:"generated_at"`
+	Deployments      []DeploymentCost `json:"deployments"` // Deployments that ran, most expensive first
+	Projects         []ProjectCost    `json:"projects"`
+	HourlyRate       float64          `json:"hourly_rate"`
+	Accumulated      float64          `json:"accumulated"`
+	EstimatedMonthly float64          `json:"estimated_monthly"`
+}
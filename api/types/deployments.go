@@ -0,0 +1,171 @@
+package types
+
+import "time"
+
+// Deployment represents a workload to be deployed on an agent.
+type Deployment struct {
+	ID               string                         `json:"id"`
+	AgentID          string                         `json:"agent_id"`
+	AgentSelector    map[string]string              `json:"agent_selector,omitempty"` // Labels the agent was selected by, if any
+	ImageURL         string                         `json:"image_url"`
+	ImageDigest      string                         `json:"image_digest,omitempty"` // Digest the image tag resolved to when the revision was scheduled
+	Bundle           string                         `json:"bundle,omitempty"`       // Bundle the agent loads the image from, for sites without registry access
+	Project          string                         `json:"project,omitempty"`
+	Resources        *Resources                     `json:"resources,omitempty"`
+	Volumes          []Volume                       `json:"volumes,omitempty"`
+	Artifacts        []Artifact                     `json:"artifacts,omitempty"`
+	Configs          []ConfigRef                    `json:"configs,omitempty"`
+	Secrets          []SecretRef                    `json:"secrets,omitempty"`
+	Addons           []Addon                        `json:"addons,omitempty"`   // Services started next to the workload, with their connection details
+	AddonOf          string                         `json:"addon_of,omitempty"` // Deployment this one runs an add-on for, if any
+	Status           DeploymentStatus               `json:"status"`
+	StatusTimes      map[DeploymentStatus]time.Time `json:"status_times,omitempty"` // When the deployment last entered each status
+	Reason           string                         `json:"reason,omitempty"`       // Explains the current status, e.g. why the deployment failed
+	Revision         int                            `json:"revision"`               // Incremented each time the workload must be redeployed
+	ResourceVersion  int                            `json:"resource_version"`       // Incremented on every change; used for If-Match
+	AutoUpdate       bool                           `json:"auto_update"`            // Redeploy when the registry reports a push of the image
+	Scan             *ScanSummary                   `json:"scan,omitempty"`         // Vulnerability scan of the current revision's image
+	CreatedAt        time.Time                      `json:"created_at"`
+	GitSpec          string                         `json:"git_spec,omitempty"`          // Name of the git spec managing this deployment, if any
+	CommitSHA        string                         `json:"commit_sha,omitempty"`        // Commit the deployment was synced from
+	KubernetesObject string                         `json:"kubernetes_object,omitempty"` // Namespace/name of the ControlCenterDeployment managing this deployment, if any
+	ObjectGeneration int64                          `json:"object_generation,omitempty"` // Generation of that object the deployment was created from
+	AdoptedFrom      string                         `json:"adopted_from,omitempty"`      // Namespace/name of the Kubernetes Deployment this deployment was adopted from, if any
+	Application      string                         `json:"application,omitempty"`       // ID of the application this deployment is a component of
+	Component        string                         `json:"component,omitempty"`
+	Fleet            string                         `json:"fleet,omitempty"`            // Fleet the deployment was made to, if any
+	Hook             string                         `json:"hook,omitempty"`             // <rollout ID>/<hook name> of the rollout hook whose job this deployment runs to completion, if any
+	DependsOn        []string                       `json:"depends_on,omitempty"`       // Deployments that must be running before this one starts
+	ExpiresAt        *time.Time                     `json:"expires_at,omitempty"`       // When the deployment is torn down, if it has a TTL
+	ScheduleAt       *time.Time                     `json:"schedule_at,omitempty"`      // When a deferred deployment starts
+	Schedule         string                         `json:"schedule,omitempty"`         // Cron expression of recurring redeploys
+	Timezone         string                         `json:"timezone,omitempty"`         // IANA time zone the schedule is evaluated in
+	NextRun          *time.Time                     `json:"next_run,omitempty"`         // When the schedule next redeploys the deployment
+	Channel          string                         `json:"channel,omitempty"`          // Release channel whose images the deployment follows
+	ChannelStrategy  string                         `json:"channel_strategy,omitempty"` // How releases are deployed: "immediate", "scheduled", or "manual"
+	UpdatePolicy     string                         `json:"update_policy,omitempty"`    // Newer semantic version tags the deployment follows: "patch", "minor", or "major"
+	AvailableImage   string                         `json:"available_image,omitempty"`  // Newer image from the channel or update policy that is not deployed yet
+	SLO              *SLO                           `json:"slo,omitempty"`              // Availability objective of the workload
+	Sandbox          *Sandbox                       `json:"sandbox,omitempty"`          // Restricts what the workload can reach and do
+	ModelServing     *ModelServing                  `json:"model_serving,omitempty"`    // Set for model serving deployments
+	Args             []string                       `json:"args,omitempty"`             // Container arguments, e.g. those that start a model server
+	RescheduleAfter  string                         `json:"reschedule_after,omitempty"` // How long the agent may be unreachable before the deployment moves to another matching agent
+	OrphanedAt       *time.Time                     `json:"orphaned_at,omitempty"`      // When the deployment's agent went stale; cleared if the agent comes back
+	ArchivedAt       *time.Time                     `json:"archived_at,omitempty"`      // When the deployment was deleted or archived after expiring
+}
+
+// DeploymentRequest is the body of a POST /deployments request.
+type DeploymentRequest struct {
+	AgentID         string            `json:"agent_id"`
+	AgentSelector   map[string]string `json:"agent_selector,omitempty"` // Labels of the agents to deploy to, instead of agent_id; with agent_id, labels the agent must have
+	ImageURL        string            `json:"image_url"`
+	AutoUpdate      bool              `json:"auto_update"`
+	Project         string            `json:"project,omitempty"`
+	Resources       *Resources        `json:"resources,omitempty"`
+	Volumes         []Volume          `json:"volumes,omitempty"`
+	Artifacts       []Artifact        `json:"artifacts,omitempty"` // Files the agent downloads and mounts before starting the container
+	Configs         []ConfigRef       `json:"configs,omitempty"`
+	Secrets         []SecretRef       `json:"secrets,omitempty"`          // Managed secrets, such as provider API keys, injected as environment variables
+	Addons          []Addon           `json:"addons,omitempty"`           // Services, such as a vector database, started first on the same agent
+	TTLSeconds      int               `json:"ttl_seconds,omitempty"`      // Tear the deployment down this long after it was created
+	Bundle          string            `json:"bundle,omitempty"`           // ID of a bundle the agent loads the image from instead of a registry
+	ScheduleAt      *time.Time        `json:"schedule_at,omitempty"`      // Defer the deployment until this time
+	Schedule        string            `json:"schedule,omitempty"`         // Cron expression ("minute hour day-of-month month day-of-week") of recurring redeploys
+	Timezone        string            `json:"timezone,omitempty"`         // IANA time zone of the schedule; defaults to the agent's, else UTC
+	Channel         string            `json:"channel,omitempty"`          // Follow this release channel's images of image_url's repository
+	ChannelStrategy string            `json:"channel_strategy,omitempty"` // "immediate" (the default), "scheduled" to wait for the next run of schedule, or "manual"
+	UpdatePolicy    string            `json:"update_policy,omitempty"`    // Update to newer "patch", "minor", or "major" releases of image_url's semantic version tag
+	SLO             *SLO              `json:"slo,omitempty"`              // Availability objective of the workload
+	Sandbox         *Sandbox          `json:"sandbox,omitempty"`          // Restricts what the workload can reach and do
+	ModelServing    *ModelServing     `json:"model_serving,omitempty"`    // Serve a model; fills in image_url, the GPUs requested, and the server's arguments
+	RescheduleAfter string            `json:"reschedule_after,omitempty"` // With agent_selector: move the deployment to another matching agent once its agent has been unreachable this long, e.g. "15m"
+}
+
+// ModelServing describes a model served with an OpenAI-compatible inference
+// server. The control center expands it into the container arguments,
+// default image, and GPU request of the deployment.
+type ModelServing struct {
+	Server           string  `json:"server,omitempty"`             // "vllm" (the default) or "tgi" (Text Generation Inference)
+	Model            string  `json:"model"`                        // Hugging Face model ID or path, e.g. "meta-llama/Llama-3.1-8B-Instruct"
+	Quantization     string  `json:"quantization,omitempty"`       // e.g. "awq", "gptq", "fp8"
+	GPUs             int     `json:"gpus,omitempty"`               // GPUs the model is sharded across; defaults to 1
+	MaxContextLength int     `json:"max_context_length,omitempty"` // Maximum tokens of prompt and completion; defaults to the model's
+	Shadow           *Shadow `json:"shadow,omitempty"`             // Only receive copies of a model's requests, to be evaluated before promotion
+}
+
+// DryRun is what a deployment request would create, returned instead of
+// creating it when the request is made with ?dry_run=true.
+type DryRun struct {
+	Deployment Deployment       `json:"deployment"`       // As it would start: pending, waiting, queued, or deferred
+	Addons     []Deployment     `json:"addons,omitempty"` // Deployments that would run its add-ons
+	Manifests  []map[string]any `json:"manifests"`        // Kubernetes objects that run the deployment and its add-ons
+}
+
+// DeploymentEvent is a timestamped entry in a deployment's event timeline.
+type DeploymentEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // e.g., "created", "deploying", "running", "failed"
+	Message string    `json:"message,omitempty"`
+}
+
+// DeploymentPatch is the body of a PATCH /deployments/{id} request. Unset
+// fields are left unchanged.
+type DeploymentPatch struct {
+	ImageURL   *string `json:"image_url,omitempty"`
+	AutoUpdate *bool   `json:"auto_update,omitempty"`
+}
+
+// MaxBatchSize caps the number of operations in a single batch request.
+const MaxBatchSize = 500
+
+// BatchRequest is the body of a POST /deployments:batch request. Creates are
+// applied before deletes, each in the order given.
+type BatchRequest struct {
+	Create []DeploymentRequest `json:"create,omitempty"`
+	Delete []string            `json:"delete,omitempty"` // IDs of deployments to tear down and archive
+}
+
+// BatchResult is the outcome of one operation in a batch. Status is the HTTP
+// status the operation would have received as a single request.
+type BatchResult struct {
+	Operation  string       `json:"operation"` // "create" or "delete"
+	Index      int          `json:"index"`     // Position in the request's create or delete list
+	Status     int          `json:"status"`
+	ID         string       `json:"id,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"` // Fields of a create that do not match the deployment request schema
+	Deployment *Deployment  `json:"deployment,omitempty"`
+}
+
+// BatchResponse lists the result of every operation in a batch.
+type BatchResponse struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// DeploymentPage is a page of deployments, as version 2 of the API lists
+// them.
+type DeploymentPage struct {
+	Items         []Deployment `json:"items"`
+	NextPageToken string       `json:"next_page_token,omitempty"` // Fetches the next page; empty on the last one
+}
+
+// Resources are the compute resources requested by a deployment.
+type Resources struct {
+	CPU      string `json:"cpu,omitempty"`    // e.g., "500m", "2"
+	Memory   string `json:"memory,omitempty"` // e.g., "512Mi", "4Gi"
+	GPU      int    `json:"gpu,omitempty"`
+	GPUModel string `json:"gpu_model,omitempty"` // Only schedule on GPUs of this model, e.g. "NVIDIA L4"
+}
+
+// ScanSummary is the vulnerability scan result attached to a deployment.
+type ScanSummary struct {
+	Scanner   string         `json:"scanner"`
+	Image     string         `json:"image"`
+	ScannedAt time.Time      `json:"scanned_at"`
+	Counts    map[string]int `json:"counts"` // Vulnerabilities per severity
+	Threshold string         `json:"threshold"`
+	Blocking  bool           `json:"blocking"` // Whether findings at or above the threshold block deployment
+	Passed    bool           `json:"passed"`   // No findings at or above the threshold
+}
@@ -0,0 +1,15 @@
+// Package types defines the JSON contracts between the control center, its
+// agents, and its clients: the bodies of the HTTP API and the messages of the
+// agent stream. The control center, the agent, cctl, and the Go client all
+// use these definitions, so that a field cannot be added to one of them and
+// silently missed by another.
+//
+// The contracts are versioned with the API. Within a version, fields may be
+// added but not removed, renamed, or given a different meaning; readers must
+// ignore fields they do not know. Incompatible changes need a new version,
+// served under a new path prefix alongside the old one.
+package types
+
+// APIVersion is the version of the contracts in this package. The HTTP API
+// is served under /api/<APIVersion>.
+const APIVersion = "v1"
@@ -0,0 +1,122 @@
+package types
+
+import "time"
+
+// Fleet is a named group of agents, such as all retail stores in the EU, that
+// deployments can target together.
+type Fleet struct {
+	Name      string    `json:"name"`
+	Agents    []string  `json:"agents"` // IDs of the member agents
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FleetRequest is the body of a PUT /fleets/{name} request.
+type FleetRequest struct {
+	Agents []string `json:"agents"`
+}
+
+// FleetStatus is a fleet together with the aggregated status of its agents
+// and of the deployments made to it.
+type FleetStatus struct {
+	Fleet
+	AgentStatus      map[string]int `json:"agent_status"`      // Member agents per status, e.g. "online"; "maintenance" counts cordoned agents
+	DeploymentStatus map[string]int `json:"deployment_status"` // Active deployments made to the fleet per status
+}
+
+// RolloutRequest is the body of a POST /fleets/{name}/rollouts request.
+type RolloutRequest struct {
+	Deployment         DeploymentRequest `json:"deployment"`                     // Deployed to every agent of the fleet; agent_id must be empty
+	Waves              []string          `json:"waves,omitempty"`                // Cumulative agent counts ("1") or percentages ("10%") of the fleet; defaults to 1, 10%, 50%, 100%
+	MaxFailurePercent  int               `json:"max_failure_percent,omitempty"`  // Halt once more than this percentage of the deployments rolled out so far failed
+	Rollback           bool              `json:"rollback,omitempty"`             // Tear down the rollout's deployments when it halts
+	WaveTimeoutSeconds int               `json:"wave_timeout_seconds,omitempty"` // Deployments not running this long after their wave started count as failed; defaults to 600
+	ApproveBefore      []int             `json:"approve_before,omitempty"`       // Waves, numbered from 1, that wait for an approver before they start
+	Hooks              []RolloutHook     `json:"hooks,omitempty"`                // Run before and after each wave
+}
+
+// RolloutHook is a job or webhook run before or after each wave of a
+// rollout, e.g. to warm up a model or to run an evaluation suite.
+type RolloutHook struct {
+	Name           string   `json:"name"`
+	Phase          string   `json:"phase"`                      // "pre" runs before a wave's deployments are created, "post" once they all run
+	Webhook        string   `json:"webhook,omitempty"`          // URL a HookEvent is POSTed to; any 2xx response succeeds
+	Job            *HookJob `json:"job,omitempty"`              // Container run to completion on each agent of the wave
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`  // Defaults to 300
+	AbortOnFailure bool     `json:"abort_on_failure,omitempty"` // Halt the rollout if the hook fails; otherwise the failure is only recorded
+}
+
+// HookJob is a container a rollout hook runs to completion.
+type HookJob struct {
+	Image string   `json:"image"`
+	Args  []string `json:"args,omitempty"`
+}
+
+// HookRun records a run of a rollout hook for a wave.
+type HookRun struct {
+	Hook        string            `json:"hook"`
+	Phase       string            `json:"phase"`
+	Status      string            `json:"status"`                // "running", "succeeded", or "failed"
+	Reason      string            `json:"reason,omitempty"`      // Why the hook failed
+	Deployments map[string]string `json:"deployments,omitempty"` // Agent ID to the deployment running the hook's job
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+}
+
+// HookEvent is the body POSTed to the webhook of a rollout hook.
+type HookEvent struct {
+	Rollout     string            `json:"rollout"`
+	Fleet       string            `json:"fleet"`
+	Hook        string            `json:"hook"`
+	Phase       string            `json:"phase"`
+	Wave        int               `json:"wave"`  // Numbered from 1
+	Waves       int               `json:"waves"` // Number of waves of the rollout
+	ImageURL    string            `json:"image_url"`
+	Agents      []string          `json:"agents"`                // Agents of the wave
+	Deployments map[string]string `json:"deployments,omitempty"` // Agent ID to deployment ID; set for post hooks
+}
+
+// Rollout deploys a request to a fleet in waves. Each wave starts once every
+// deployment of the previous one is running, and the rollout halts if too
+// many of them fail.
+type Rollout struct {
+	ID                 string            `json:"id"`
+	Fleet              string            `json:"fleet"`
+	Deployment         DeploymentRequest `json:"deployment"`
+	Waves              []RolloutWave     `json:"waves"`
+	MaxFailurePercent  int               `json:"max_failure_percent"`
+	Rollback           bool              `json:"rollback"`
+	WaveTimeoutSeconds int               `json:"wave_timeout_seconds"`
+	Hooks              []RolloutHook     `json:"hooks,omitempty"`
+	Status             string            `json:"status"`           // "running", "awaiting_approval", "completed", "halted", or "rolled_back"
+	Reason             string            `json:"reason,omitempty"` // Why the rollout halted or is waiting
+	CurrentWave        int               `json:"current_wave"`     // Index of the wave being rolled out
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+// RolloutWave is one step of a rollout.
+type RolloutWave struct {
+	Agents           []string          `json:"agents"`
+	Status           string            `json:"status"`                      // "pending", "pre_hooks", "deploying", "post_hooks", "verified", or "failed"
+	RequiresApproval bool              `json:"requires_approval,omitempty"` // The wave waits for an approver before it starts
+	Approval         *RolloutApproval  `json:"approval,omitempty"`
+	Deployments      map[string]string `json:"deployments,omitempty"` // Agent ID to deployment ID
+	Failures         map[string]string `json:"failures,omitempty"`    // Agent ID to why its deployment failed
+	Hooks            []HookRun         `json:"hooks,omitempty"`       // Runs of the rollout's hooks for the wave
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	FinishedAt       *time.Time        `json:"finished_at,omitempty"`
+}
+
+// RolloutApproval records who let a wave of a rollout start.
+type RolloutApproval struct {
+	Approver   string    `json:"approver"` // Name of the approver whose token approved the wave
+	Comment    string    `json:"comment,omitempty"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// ApproveRequest is the optional body of a POST /rollouts/{id}/approve
+// request.
+type ApproveRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
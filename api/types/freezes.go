@@ -0,0 +1,42 @@
+package types
+
+import "time"
+
+// BreakGlassHeader carries the justification for a change made during a
+// freeze window. Requests that set it are let through and recorded on the
+// freeze.
+const BreakGlassHeader = "X-Break-Glass"
+
+// Freeze is a window during which deployments in its scope must not change,
+// such as a holiday change freeze.
+type Freeze struct {
+	ID        string           `json:"id"`
+	Scope     string           `json:"scope"`              // "global", "project", or "agent"
+	Project   string           `json:"project,omitempty"`  // Set for project freezes
+	AgentID   string           `json:"agent_id,omitempty"` // Set for agent freezes
+	Start     time.Time        `json:"start"`
+	End       time.Time        `json:"end"`
+	Reason    string           `json:"reason,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	Overrides []FreezeOverride `json:"overrides,omitempty"` // Break-glass changes made during the freeze
+}
+
+// FreezeRequest is the body of a POST /freezes request.
+type FreezeRequest struct {
+	Scope   string    `json:"scope"`
+	Project string    `json:"project,omitempty"`
+	AgentID string    `json:"agent_id,omitempty"`
+	Start   time.Time `json:"start,omitempty"` // Defaults to now
+	End     time.Time `json:"end"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// FreezeOverride records a change let through a freeze with a break-glass
+// justification.
+type FreezeOverride struct {
+	Operation     string    `json:"operation"` // Method and path of the request, e.g. "DELETE /api/v1/deployments/dep-1"
+	AgentID       string    `json:"agent_id,omitempty"`
+	Project       string    `json:"project,omitempty"`
+	Justification string    `json:"justification"`
+	At            time.Time `json:"at"`
+}
@@ -0,0 +1,50 @@
+package types
+
+// ModelEndpoint is a running model serving deployment the inference gateway
+// routes requests for its model to.
+type ModelEndpoint struct {
+	Model         string `json:"model"`
+	Server        string `json:"server"` // "vllm" or "tgi"
+	DeploymentID  string `json:"deployment_id"`
+	AgentID       string `json:"agent_id"`
+	Project       string `json:"project,omitempty"`
+	URL           string `json:"url"`                      // Base URL of the server's OpenAI-compatible API
+	InFlight      int    `json:"in_flight"`                // Requests the gateway is currently proxying to it
+	ShadowOf      string `json:"shadow_of,omitempty"`      // Set for shadows: the model whose requests are mirrored to it
+	ShadowPercent int    `json:"shadow_percent,omitempty"` // Share of those requests mirrored
+}
+
+// Shadow makes a model serving deployment a shadow: the inference gateway
+// sends it copies of the requests for a model and discards its responses, so
+// that it can be compared with the deployments serving them.
+type Shadow struct {
+	Model   string `json:"model,omitempty"`   // Model whose requests are mirrored; defaults to the deployment's own
+	Percent int    `json:"percent,omitempty"` // Share of the requests mirrored, from 1 to 100; defaults to 100
+}
+
+// ShadowStats compares a shadow deployment with the deployments that served
+// the requests mirrored to it.
+type ShadowStats struct {
+	DeploymentID string           `json:"deployment_id"`
+	AgentID      string           `json:"agent_id"`
+	Model        string           `json:"model"`
+	ShadowOf     string           `json:"shadow_of"`
+	Percent      int              `json:"percent"`
+	Status       DeploymentStatus `json:"status"`   // Status of the shadow deployment
+	Mirrored     int64            `json:"mirrored"` // Requests mirrored to the shadow
+	Dropped      int64            `json:"dropped"`  // Requests not mirrored because the shadow was too busy
+	Primary      LatencyStats     `json:"primary"`  // The deployments that served the mirrored requests
+	Shadow       LatencyStats     `json:"shadow"`
+}
+
+// LatencyStats summarizes the latency and errors of completed requests.
+// Latencies are measured until the whole response was received; the
+// percentiles cover the most recent requests.
+type LatencyStats struct {
+	Requests   int64   `json:"requests"`
+	Errors     int64   `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"` // Percentage of requests that failed
+	MeanMillis float64 `json:"mean_ms"`
+	P50Millis  float64 `json:"p50_ms"`
+	P95Millis  float64 `json:"p95_ms"`
+}
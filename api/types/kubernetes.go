@@ -0,0 +1,19 @@
+package types
+
+// KubernetesWorkload is a Deployment found in the cluster the control center
+// operates in, and the deployment it was adopted as, if any.
+type KubernetesWorkload struct {
+	Namespace    string   `json:"namespace"`
+	Name         string   `json:"name"`
+	Images       []string `json:"images"` // Images of its containers
+	Replicas     int32    `json:"replicas"`
+	ManagedBy    string   `json:"managed_by,omitempty"`    // Its app.kubernetes.io/managed-by label, e.g. Helm
+	DeploymentID string   `json:"deployment_id,omitempty"` // Deployment that adopted it; empty while it is unmanaged
+}
+
+// AdoptRequest places an adopted Kubernetes Deployment's workload under
+// control center management.
+type AdoptRequest struct {
+	AgentID string `json:"agent_id"` // Agent that runs the workload from now on
+	Project string `json:"project,omitempty"`
+}
@@ -0,0 +1,49 @@
+package types
+
+import "time"
+
+// ClusterOperation is a declarative change to the Kubernetes cluster of an
+// agent, for clusters only the agent can reach: the control center sends it
+// to the agent, which applies or deletes its objects against its local
+// Kubernetes API and reports the result of each.
+type ClusterOperation struct {
+	ID           string           `json:"id"`
+	AgentID      string           `json:"agent_id"`
+	Action       string           `json:"action"`                  // "apply" or "delete"
+	Namespace    string           `json:"namespace,omitempty"`     // Namespace of objects that do not name one; "default" if empty
+	DeploymentID string           `json:"deployment_id,omitempty"` // Deployment whose manifests the objects are, if any
+	Objects      []map[string]any `json:"objects"`
+	Status       string           `json:"status"` // "pending", "sent", "succeeded", or "failed"
+	Results      []ObjectResult   `json:"results,omitempty"`
+	Error        string           `json:"error,omitempty"` // Why the agent could not carry the operation out at all
+	CreatedAt    time.Time        `json:"created_at"`
+	SentAt       *time.Time       `json:"sent_at,omitempty"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+}
+
+// ObjectResult is what became of one object of a cluster operation.
+type ObjectResult struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Result     string `json:"result"` // "applied", "deleted", "not_found", or "failed"
+	Error      string `json:"error,omitempty"`
+}
+
+// ClusterOperationRequest is the body of a request to change an agent's
+// cluster. The objects are given as YAML or JSON documents in Manifests, or
+// rendered from a deployment of the agent if only DeploymentID is set.
+type ClusterOperationRequest struct {
+	Action       string `json:"action"`
+	Namespace    string `json:"namespace,omitempty"`
+	Manifests    string `json:"manifests,omitempty"`
+	DeploymentID string `json:"deployment_id,omitempty"`
+}
+
+// StreamOperationResult reports how an agent carried out a cluster operation.
+type StreamOperationResult struct {
+	OperationID string         `json:"operation_id"`
+	Results     []ObjectResult `json:"results,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
@@ -0,0 +1,33 @@
+package types
+
+// Quota limits the deployments of an agent or a project. Unset limits are unlimited.
+type Quota struct {
+	Scope          string `json:"scope"` // "agent" or "project"
+	Name           string `json:"name"`  // Agent ID or project name
+	MaxDeployments *int   `json:"max_deployments,omitempty"`
+	CPU            string `json:"cpu,omitempty"`
+	Memory         string `json:"memory,omitempty"`
+	GPU            *int   `json:"gpu,omitempty"`
+	OnExceed       string `json:"on_exceed"` // "reject" or "queue"
+}
+
+// QuotaUsage is the amount of a quota consumed by active deployments.
+type QuotaUsage struct {
+	Deployments int    `json:"deployments"`
+	CPU         string `json:"cpu"`
+	Memory      string `json:"memory"`
+	GPU         int    `json:"gpu"`
+	Queued      int    `json:"queued"` // Deployments waiting for quota
+}
+
+// QuotaStatus is a quota together with its current usage.
+type QuotaStatus struct {
+	Quota
+	Usage QuotaUsage `json:"usage"`
+}
+
+// Policy is a Rego module evaluated against every deployment request.
+type Policy struct {
+	ID   string `json:"id"`
+	Rego string `json:"rego"`
+}
@@ -0,0 +1,25 @@
+package types
+
+// Sandbox restricts what a deployment's workload can reach and do. Once set,
+// the workload may only connect to the destinations in Egress, DNS, and its
+// add-ons.
+type Sandbox struct {
+	Egress   []EgressRule `json:"egress,omitempty"`   // Destinations the workload may connect to
+	Seccomp  string       `json:"seccomp,omitempty"`  // runtime/default, unconfined, or localhost/<profile>; defaults to runtime/default
+	AppArmor string       `json:"apparmor,omitempty"` // runtime/default, unconfined, or localhost/<profile>; defaults to runtime/default
+}
+
+// EgressRule allows a sandboxed workload to connect to a host or network.
+type EgressRule struct {
+	Host  string `json:"host,omitempty"`  // DNS name or IP address, e.g. api.openai.com
+	CIDR  string `json:"cidr,omitempty"`  // Network, e.g. 10.0.0.0/8
+	Ports []int  `json:"ports,omitempty"` // TCP ports; any port if empty
+}
+
+// SandboxPolicy is the Kubernetes form of a deployment's sandbox: a
+// NetworkPolicy for its pod and the annotations that confine it.
+type SandboxPolicy struct {
+	DeploymentID   string            `json:"deployment_id"`
+	NetworkPolicy  map[string]any    `json:"network_policy"`
+	PodAnnotations map[string]string `json:"pod_annotations"`
+}
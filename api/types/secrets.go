@@ -0,0 +1,57 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// Secret is a managed secret, such as a model provider's API key. Its value
+// is write-only: the API never returns it, and only agents running
+// deployments that reference the secret receive it.
+type Secret struct {
+	Name      string    `json:"name"`
+	Provider  string    `json:"provider"` // openai, anthropic, or generic
+	Version   int       `json:"version"`  // Incremented on every rotation
+	CreatedAt time.Time `json:"created_at"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// SecretRequest is the body of a POST /secrets request.
+type SecretRequest struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider,omitempty"` // Defaults to generic
+	Value    string `json:"value"`
+}
+
+// RotateSecretRequest is the body of a POST /secrets/{name}/rotate request.
+type RotateSecretRequest struct {
+	Value     string `json:"value"`
+	BatchSize int    `json:"batch_size,omitempty"` // Deployments restarted at a time; 0 restarts all at once
+}
+
+// SecretRef injects a secret into a deployment as an environment variable.
+type SecretRef struct {
+	Name    string `json:"name"`
+	Env     string `json:"env,omitempty"`     // Variable name; defaults to the provider's, e.g. OPENAI_API_KEY
+	Version int    `json:"version,omitempty"` // Secret version used by the current revision; set by the control center
+}
+
+// Key identifies the secret version a reference resolved to, e.g.
+// "openai@2". Agents receive secret values keyed this way.
+func (r SecretRef) Key() string {
+	return r.Name + "@" + strconv.Itoa(r.Version)
+}
+
+// SecretRollout is the progress of restarting the deployments that use a
+// secret with its rotated value.
+type SecretRollout struct {
+	Secret      string     `json:"secret"`
+	Version     int        `json:"version"`
+	BatchSize   int        `json:"batch_size,omitempty"` // Deployments restarted at a time; 0 restarts all at once
+	State       string     `json:"state"`                // in_progress, completed, or halted
+	Updated     []string   `json:"updated"`              // Deployments restarted with the version
+	Pending     []string   `json:"pending"`              // Deployments still to be restarted
+	HaltedBy    string     `json:"halted_by,omitempty"`  // Deployment that failed with the version
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
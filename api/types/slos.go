@@ -0,0 +1,26 @@
+package types
+
+import "time"
+
+// SLO is an availability objective of a deployment's workload.
+type SLO struct {
+	Target float64 `json:"target"`           // Percentage of the time the workload must be up, e.g. 99.5
+	Window string  `json:"window,omitempty"` // Rolling window compliance is computed over, e.g. "30d" or "168h"; defaults to "30d"
+}
+
+// SLOStatus is a deployment's compliance with its SLO over the current
+// window, computed from the statuses its agent reported.
+type SLOStatus struct {
+	DeploymentID    string    `json:"deployment_id"`
+	AgentID         string    `json:"agent_id"`
+	Project         string    `json:"project,omitempty"`
+	SLO             SLO       `json:"slo"`
+	WindowStart     time.Time `json:"window_start"`
+	Availability    float64   `json:"availability"`     // Percentage of the measured time the workload was up; 100 before it first ran
+	UptimeSeconds   int64     `json:"uptime_seconds"`   // Time it was running within the window
+	DowntimeSeconds int64     `json:"downtime_seconds"` // Time it was failed within the window
+	BudgetSeconds   int64     `json:"budget_seconds"`   // Downtime the SLO allows over the whole window
+	BudgetRemaining float64   `json:"budget_remaining"` // Percentage of the error budget left; negative once it is exceeded
+	BurnRate        float64   `json:"burn_rate"`        // Budget spent in the last hour relative to an even spend over the window; above 1 exhausts it early
+	Compliant       bool      `json:"compliant"`        // The budget is not exceeded
+}
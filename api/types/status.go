@@ -0,0 +1,32 @@
+package types
+
+// DeploymentStatus is the state of a deployment's current revision. The
+// control center only moves a deployment between statuses along the
+// transitions its state machine allows; agents report the statuses a
+// workload goes through once it is scheduled.
+type DeploymentStatus string
+
+const (
+	StatusDeferred  DeploymentStatus = "deferred"  // Waiting for its schedule_at time
+	StatusQueued    DeploymentStatus = "queued"    // Waiting for quota, GPUs, or its agent to leave maintenance
+	StatusWaiting   DeploymentStatus = "waiting"   // Waiting for the deployments it depends on to run
+	StatusPending   DeploymentStatus = "pending"   // Going through admission: digest pinning, signature checks, and scans
+	StatusScheduled DeploymentStatus = "scheduled" // Admitted and handed to its agent
+
+	// Reported by agents.
+	StatusDeploying   DeploymentStatus = "deploying"    // Pulling the image and artifacts and starting the workload
+	StatusRunning     DeploymentStatus = "running"      // The workload is up
+	StatusDegraded    DeploymentStatus = "degraded"     // The workload is up but unhealthy
+	StatusRollingBack DeploymentStatus = "rolling_back" // The agent is restoring the workload it ran before the revision
+	StatusFailed      DeploymentStatus = "failed"
+	StatusSucceeded   DeploymentStatus = "succeeded" // A job ran to completion
+
+	StatusPaused    DeploymentStatus = "paused"    // Stopped until resumed, without releasing its spec
+	StatusCancelled DeploymentStatus = "cancelled" // Stopped before its agent started it
+
+	// Final: the deployment is torn down for good.
+	StatusExpired    DeploymentStatus = "expired"    // Its TTL passed
+	StatusSuperseded DeploymentStatus = "superseded" // Replaced by a new deployment of its spec, application, or object
+	StatusRemoved    DeploymentStatus = "removed"    // Its spec, application, object, or parent deployment was removed
+	StatusDeleted    DeploymentStatus = "deleted"    // Deleted through the API
+)
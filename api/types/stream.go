@@ -0,0 +1,98 @@
+package types
+
+// ProtocolVersion is the version of the messages agents and the control
+// center exchange. It is incremented by changes that agents or control
+// centers of an older version cannot handle.
+const ProtocolVersion = 1
+
+// AgentMessage is a message from an agent on its stream. Exactly one field is
+// set, and the first message must be Register.
+type AgentMessage struct {
+	Register  *StreamRegister        `json:"register,omitempty"`
+	Heartbeat *StreamHeartbeat       `json:"heartbeat,omitempty"`
+	Status    *StreamStatus          `json:"status,omitempty"`
+	Operation *StreamOperationResult `json:"operation,omitempty"`
+	Sync      *StreamSync            `json:"sync,omitempty"`
+}
+
+// StreamRegister registers an agent. An agent that reconnects sends the ID and
+// credential it was given to keep its identity and deployments.
+type StreamRegister struct {
+	AgentID    string            `json:"agent_id,omitempty"`
+	Credential string            `json:"credential,omitempty"` // Proves the agent is the one AgentID was issued to
+	Address    string            `json:"address"`
+	Timezone   string            `json:"timezone,omitempty"` // IANA time zone of the agent's site
+	GPUs       []GPUInventory    `json:"gpus"`               // GPUs the agent found, null if it cannot tell
+	Labels     map[string]string `json:"labels,omitempty"`   // e.g. arch=arm64, gpu=jetson, site=store-104
+	// BootstrapToken authorizes a new agent's registration; agents that
+	// reconnect with their ID and credential need none.
+	BootstrapToken  string `json:"bootstrap_token,omitempty"`
+	Version         string `json:"version,omitempty"`          // Build version of the agent, e.g. "1.4.2"
+	ProtocolVersion int    `json:"protocol_version,omitempty"` // ProtocolVersion of the agent; 1 if not set
+}
+
+// StreamHeartbeat tells the control center the agent is alive. Agents older
+// than the version fields send it empty.
+type StreamHeartbeat struct {
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+}
+
+// StreamSync asks the control center to send the agent's deployments, because
+// the desired state a heartbeat reply named differs from the one the agent
+// last applied.
+type StreamSync struct {
+	DesiredState string `json:"desired_state,omitempty"` // The digest the agent has, empty if none
+}
+
+// StreamStatus reports a status change of one of the agent's deployments.
+type StreamStatus struct {
+	DeploymentID string           `json:"deployment_id"`
+	Status       DeploymentStatus `json:"status"`
+	Reason       string           `json:"reason,omitempty"`
+}
+
+// ControlMessage is a message from the control center to an agent. Exactly
+// one field is set.
+type ControlMessage struct {
+	Registered  *StreamRegistered     `json:"registered,omitempty"`
+	Deployments *StreamDeployments    `json:"deployments,omitempty"`
+	Operation   *ClusterOperation     `json:"operation,omitempty"` // A change to make to the agent's cluster
+	Heartbeat   *StreamHeartbeatReply `json:"heartbeat,omitempty"`
+	Error       *StreamError          `json:"error,omitempty"`
+}
+
+// StreamRegistered tells an agent the ID it was registered under. A new agent
+// also gets the credential it must send with the ID to reconnect; the control
+// center keeps only its hash.
+type StreamRegistered struct {
+	AgentID    string `json:"agent_id"`
+	Credential string `json:"credential,omitempty"`
+}
+
+// StreamHeartbeatReply answers a heartbeat with the digest of the agent's
+// desired state. An agent whose last applied deployments have another digest
+// missed a change and sends a Sync.
+type StreamHeartbeatReply struct {
+	DesiredState string `json:"desired_state"`
+}
+
+// StreamDeployments is the full list of an agent's deployments, with the
+// contents of the config versions they use. It is sent when the agent
+// connects, when its desired state changes, and when the agent asks for it.
+// Status changes the agent reported itself do not change the desired state.
+type StreamDeployments struct {
+	DesiredState string            `json:"desired_state,omitempty"` // Digest of the deployments and what they use, e.g. "sha256:..."
+	Deployments  []Deployment      `json:"deployments"`
+	Configs      map[string]Config `json:"configs,omitempty"` // By ConfigRef.Key, e.g. "prompts@3"
+	Secrets      map[string]string `json:"secrets,omitempty"` // Values by SecretRef.Key, e.g. "openai@2"
+	Bundles      map[string]Bundle `json:"bundles,omitempty"` // Bundles the deployments load their images from
+}
+
+// StreamError reports a status report the control center rejected. An error
+// without a deployment ID means the control center does not know the agent,
+// which must register again.
+type StreamError struct {
+	DeploymentID string `json:"deployment_id,omitempty"`
+	Message      string `json:"message"`
+}
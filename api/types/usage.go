@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+// UsageSample is a count of the inference requests a deployment served since
+// its previous sample, as reported by a sidecar or exporter next to the
+// workload.
+type UsageSample struct {
+	Requests         int64 `json:"requests"`
+	Errors           int64 `json:"errors,omitempty"` // Requests that failed
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// DeploymentUsage is the inference usage of a deployment in a report's
+// period.
+type DeploymentUsage struct {
+	DeploymentID     string `json:"deployment_id"`
+	AgentID          string `json:"agent_id"`
+	Project          string `json:"project,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Requests         int64  `json:"requests"`
+	Errors           int64  `json:"errors"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// ProjectUsage sums the inference usage of a project's deployments.
+type ProjectUsage struct {
+	Project          string `json:"project"` // Empty for deployments without a project
+	Deployments      int    `json:"deployments"`
+	Requests         int64  `json:"requests"`
+	Errors           int64  `json:"errors"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// UsageReport is the response of GET /reports/usage.
+type UsageReport struct {
+	Since       time.Time         `json:"since"`
+	Until       time.Time         `json:"until"`
+	Deployments []DeploymentUsage `json:"deployments"` // Most tokens first
+	Projects    []ProjectUsage    `json:"projects"`
+}
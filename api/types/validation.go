@@ -0,0 +1,23 @@
+package types
+
+// ValidationError is the body of a 400 response to a request that does not
+// match the JSON Schema of its body.
+type ValidationError struct {
+	Message string       `json:"message"`
+	Schema  string       `json:"schema"` // Name of the schema, e.g. deployment-request.v1, served under /api/v1/schemas
+	Errors  []FieldError `json:"errors"`
+}
+
+// FieldError explains why a field of a request body is invalid.
+type FieldError struct {
+	Field   string `json:"field"` // Path of the field, e.g. volumes[0].mount_path; empty for the body as a whole
+	Message string `json:"message"`
+}
+
+// String renders the error as "field: message".
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
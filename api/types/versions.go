@@ -0,0 +1,21 @@
+package types
+
+import "time"
+
+const (
+	// AcceptVersionHeader lists the API versions a caller accepts, most
+	// preferred first, e.g. "v2, v1". It picks the version of unversioned
+	// paths such as /api/deployments.
+	AcceptVersionHeader = "Accept-Version"
+	// APIVersionHeader names the API version a response was served under.
+	APIVersionHeader = "API-Version"
+)
+
+// APIVersionInfo describes a version of the HTTP API the control center
+// serves.
+type APIVersionInfo struct {
+	Version      string     `json:"version"`
+	Status       string     `json:"status"`                  // "current", "supported", or "deprecated"
+	DeprecatedAt *time.Time `json:"deprecated_at,omitempty"` // When the version was or will be deprecated
+	SunsetAt     *time.Time `json:"sunset_at,omitempty"`     // When the version may stop being served
+}
@@ -0,0 +1,31 @@
+package types
+
+// Volume is storage mounted into a deployment's container. Exactly one
+// source (pvc, host_path, or empty_dir) must be set.
+type Volume struct {
+	Name      string          `json:"name"`
+	MountPath string          `json:"mount_path"`
+	ReadOnly  bool            `json:"read_only,omitempty"`
+	PVC       *PVCSource      `json:"pvc,omitempty"`
+	HostPath  *HostPathSource `json:"host_path,omitempty"`
+	EmptyDir  *EmptyDirSource `json:"empty_dir,omitempty"`
+}
+
+// PVCSource is a persistent volume claim, e.g. for model checkpoints or
+// vector indexes that must survive redeployments.
+type PVCSource struct {
+	ClaimName    string `json:"claim_name,omitempty"` // Defaults to "<deployment ID>-<volume name>"
+	StorageClass string `json:"storage_class,omitempty"`
+	Size         string `json:"size"` // e.g., "20Gi"
+}
+
+// HostPathSource is a directory on the edge device.
+type HostPathSource struct {
+	Path string `json:"path"`
+}
+
+// EmptyDirSource is scratch space that lives as long as the deployment revision.
+type EmptyDirSource struct {
+	Medium    string `json:"medium,omitempty"` // "" for disk or "Memory"
+	SizeLimit string `json:"size_limit,omitempty"`
+}
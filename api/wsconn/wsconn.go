@@ -0,0 +1,76 @@
+// Package wsconn carries byte streams over WebSockets. Reverse tunnels and
+// port forwards need a net.Conn-like stream, but WebSockets deliver messages;
+// Conn reads the binary messages as one stream and writes each Write as one
+// message. The control center, the agent, and the Go client share it, so the
+// two ends of a connection frame their data the same way.
+package wsconn
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn carries a byte stream in the binary messages of a WebSocket. Other
+// messages are skipped.
+type Conn struct {
+	ws     *websocket.Conn
+	reader io.Reader // The message being read, if any
+}
+
+// New returns a stream over ws.
+func New(ws *websocket.Conn) *Conn {
+	return &Conn{ws: ws}
+}
+
+// Read returns io.EOF when the peer closes the connection normally, and the
+// reason it gives otherwise.
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			kind, r, err := c.ws.NextReader()
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				if closeErr.Code == websocket.CloseNormalClosure {
+					return 0, io.EOF
+				}
+				if closeErr.Text != "" {
+					return 0, errors.New(closeErr.Text)
+				}
+			}
+			if err != nil {
+				return 0, err
+			}
+			if kind != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Write sends p as one message. Writes must not be concurrent; yamux, which
+// runs the tunnels over a Conn, serializes its own.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection, telling the peer first.
+func (c *Conn) Close() error {
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.ws.Close()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+func handleAlertsCmd(args []string) {
+	switch {
+	case len(args) >= 1 && args[0] == "list":
+		listCmd := flag.NewFlagSet("alerts list", flag.ExitOnError)
+		state := listCmd.String("state", "", "Only list firing or resolved alerts.")
+		listCmd.Parse(args[1:])
+		listAlerts(*state)
+	case len(args) == 1 && args[0] == "rules":
+		listAlertRules()
+	case len(args) >= 2 && args[0] == "set-rule":
+		rule := client.AlertRule{Name: args[1]}
+		ruleCmd := flag.NewFlagSet("alerts set-rule", flag.ExitOnError)
+		ruleCmd.StringVar(&rule.Condition, "condition", "", "deployment_failed, agent_offline, crashloop, or deployment_orphaned.")
+		ruleCmd.StringVar(&rule.For, "for", "", "How long the condition must hold before the alert fires, e.g. 10m.")
+		ruleCmd.IntVar(&rule.Failures, "failures", 0, "For crashloop: failures within --window that count as a crash loop (default 3).")
+		ruleCmd.StringVar(&rule.Window, "window", "", "For crashloop: the window failures are counted in (default 15m).")
+		ruleCmd.StringVar(&rule.Project, "project", "", "Only alert on deployments of this project.")
+		ruleCmd.StringVar(&rule.AgentID, "agent", "", "Only alert on this agent or its deployments.")
+		ruleCmd.Func("webhook", "Post alerts as JSON to this URL; may be repeated.", func(u string) error {
+			rule.Receivers = append(rule.Receivers, client.AlertReceiver{Type: "webhook", URL: u})
+			return nil
+		})
+		ruleCmd.Func("slack", "Post alerts to this Slack incoming webhook URL; may be repeated.", func(u string) error {
+			rule.Receivers = append(rule.Receivers, client.AlertReceiver{Type: "slack", URL: u})
+			return nil
+		})
+		ruleCmd.Parse(args[2:])
+		setAlertRule(rule)
+	case len(args) == 2 && args[0] == "delete-rule":
+		deleteAlertRule(args[1])
+	default:
+		fmt.Println("Usage: cctl alerts list [--state firing|resolved]")
+		fmt.Println("       cctl alerts rules")
+		fmt.Println("       cctl alerts set-rule <name> --condition <condition> [--for <duration>] [--failures <n>] [--window <duration>]")
+		fmt.Println("                            [--project <name>] [--agent <id>] [--webhook <url>]... [--slack <url>]...")
+		fmt.Println("       cctl alerts delete-rule <name>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// listAlerts prints firing and recently resolved alerts.
+func listAlerts(state string) {
+	alerts, err := cc.ListAlerts(context.Background(), state)
+	if err != nil {
+		fail(err, "Error: Failed to list alerts")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tRULE\tSTATE\tSINCE (UTC)\tMESSAGE")
+	for _, a := range alerts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", a.ID, a.Rule, a.State, a.Since.Format(time.RFC3339), a.Message)
+	}
+	w.Flush()
+}
+
+// listAlertRules prints all alert rules.
+func listAlertRules() {
+	rules, err := cc.ListAlertRules(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list alert rules")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCONDITION\tFOR\tSCOPE\tRECEIVERS")
+	for _, rule := range rules {
+		condition := rule.Condition
+		if rule.Condition == "crashloop" {
+			condition = fmt.Sprintf("crashloop (%d in %s)", rule.Failures, rule.Window)
+		}
+		var scope []string
+		if rule.Project != "" {
+			scope = append(scope, "project="+rule.Project)
+		}
+		if rule.AgentID != "" {
+			scope = append(scope, "agent="+rule.AgentID)
+		}
+		receivers := make([]string, 0, len(rule.Receivers))
+		for _, rcv := range rule.Receivers {
+			receivers = append(receivers, rcv.Type)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", rule.Name, condition, orDash(rule.For), orDash(strings.Join(scope, " ")), orDash(strings.Join(receivers, ", ")))
+	}
+	w.Flush()
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// setAlertRule creates or replaces an alert rule.
+func setAlertRule(rule client.AlertRule) {
+	if _, err := cc.PutAlertRule(context.Background(), rule); err != nil {
+		fail(err, "Error: Failed to set alert rule %s", rule.Name)
+	}
+	fmt.Printf("Alert rule %s set\n", rule.Name)
+}
+
+// deleteAlertRule deletes an alert rule.
+func deleteAlertRule(name string) {
+	if err := cc.DeleteAlertRule(context.Background(), name); err != nil {
+		fail(err, "Error: Failed to delete alert rule %s", name)
+	}
+	fmt.Printf("Alert rule %s deleted\n", name)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+func handleBootstrapTokensCmd(args []string) {
+	switch {
+	case len(args) >= 1 && args[0] == "create":
+		createCmd := flag.NewFlagSet("bootstrap-tokens create", flag.ExitOnError)
+		ttl := createCmd.Duration("ttl", 24*time.Hour, "How long the token is valid, at most 720h.")
+		maxUses := createCmd.Int("max-uses", 0, "Number of agents that can register with the token; 0 for any number.")
+		labels := createCmd.String("labels", "", "Labels agents that register with the token get, e.g. site=store-104.")
+		description := createCmd.String("description", "", "What the token is for.")
+		createCmd.Parse(args[1:])
+		createBootstrapToken(client.BootstrapTokenRequest{
+			Description: *description,
+			Labels:      parseSelector(*labels),
+			MaxUses:     *maxUses,
+			TTLSeconds:  int(ttl.Seconds()),
+		})
+	case len(args) == 1 && args[0] == "list":
+		listBootstrapTokens()
+	case len(args) == 2 && args[0] == "delete":
+		if err := cc.DeleteBootstrapToken(context.Background(), args[1]); err != nil {
+			fail(err, "Error: Failed to delete bootstrap token %s", args[1])
+		}
+		fmt.Printf("Bootstrap token %s revoked\n", args[1])
+	default:
+		fmt.Println("Usage: cctl bootstrap-tokens create [--ttl <duration>] [--max-uses <n>] [--labels <key>=<value>,...] [--description <text>]")
+		fmt.Println("       cctl bootstrap-tokens list")
+		fmt.Println("       cctl bootstrap-tokens delete <id>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// createBootstrapToken issues a bootstrap token and prints it, which is the
+// only time it is shown.
+func createBootstrapToken(req client.BootstrapTokenRequest) {
+	token, err := cc.CreateBootstrapToken(context.Background(), req)
+	if err != nil {
+		fail(err, "Error: Failed to create bootstrap token")
+	}
+	fmt.Println(token.Token)
+	fmt.Fprintf(os.Stderr, "Bootstrap token %s valid until %s; it is not shown again.\n", token.ID, token.ExpiresAt.Format(time.RFC3339))
+}
+
+// listBootstrapTokens prints the bootstrap tokens that have not expired.
+func listBootstrapTokens() {
+	tokens, err := cc.ListBootstrapTokens(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list bootstrap tokens")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSES\tLABELS\tEXPIRES\tDESCRIPTION")
+	for _, t := range tokens {
+		uses := fmt.Sprintf("%d", t.Uses)
+		if t.MaxUses > 0 {
+			uses += fmt.Sprintf("/%d", t.MaxUses)
+		}
+		labels, description := formatLabels(t.Labels), t.Description
+		if labels == "" {
+			labels = "-"
+		}
+		if description == "" {
+			description = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, uses, labels, t.ExpiresAt.Format(time.RFC3339), description)
+	}
+	w.Flush()
+}
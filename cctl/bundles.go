@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func handleBundlesCmd(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		listBundles()
+	case len(args) >= 2 && args[0] == "create":
+		createCmd := flag.NewFlagSet("bundles create", flag.ExitOnError)
+		platform := createCmd.String("platform", "", "Platform of the agents, e.g. linux/arm64; defaults to the control center's.")
+		createCmd.Parse(args[2:])
+		createBundle(args[1], *platform)
+	case len(args) == 2 && args[0] == "delete":
+		deleteBundle(args[1])
+	default:
+		fmt.Println("Usage: cctl bundles list")
+		fmt.Println("       cctl bundles create <image> [--platform <os/arch>]")
+		fmt.Println("       cctl bundles delete <id>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// listBundles prints the bundles the control center holds.
+func listBundles() {
+	bundles, err := cc.ListBundles(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list bundles")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tIMAGE\tPLATFORM\tSTATUS\tSIZE\tCREATED (UTC)")
+	for _, b := range bundles {
+		platform, status := b.Platform, b.Status
+		if platform == "" {
+			platform = "-"
+		}
+		if b.Reason != "" {
+			status += ": " + b.Reason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", b.ID, b.ImageURL, platform, status, b.Size, b.CreatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// createBundle asks the control center to package an image as a bundle.
+func createBundle(image, platform string) {
+	b, err := cc.CreateBundle(context.Background(), image, platform)
+	if err != nil {
+		fail(err, "Error: Failed to create bundle")
+	}
+	fmt.Printf("Bundle %s of %s is being built; deploy it with --bundle %s once `cctl bundles list` shows it ready\n", b.ID, b.ImageURL, b.ID)
+}
+
+// deleteBundle deletes a bundle that no deployment uses.
+func deleteBundle(id string) {
+	if err := cc.DeleteBundle(context.Background(), id); err != nil {
+		fail(err, "Error: Failed to delete bundle %s", id)
+	}
+	fmt.Printf("Bundle %s deleted\n", id)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+func handleChannelsCmd(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		listChannels()
+	case len(args) == 2 && args[0] == "get":
+		getChannel(args[1])
+	case len(args) >= 3 && args[0] == "publish":
+		publishCmd := flag.NewFlagSet("channels publish", flag.ExitOnError)
+		note := publishCmd.String("note", "", "Release notes recorded with the release.")
+		publishCmd.Parse(args[3:])
+		publishRelease(args[1], client.PublishRequest{ImageURL: args[2], Note: *note})
+	case len(args) == 2 && args[0] == "delete":
+		deleteChannel(args[1])
+	default:
+		fmt.Println("Usage: cctl channels list")
+		fmt.Println("       cctl channels get <name>")
+		fmt.Println("       cctl channels publish <name> <image> [--note <text>]")
+		fmt.Println("       cctl channels delete <name>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// listChannels prints all release channels with the images they hold.
+func listChannels() {
+	channels, err := cc.ListChannels(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list channels")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIMAGES\tUPDATED (UTC)")
+	for _, ch := range channels {
+		images := make([]string, 0, len(ch.Releases))
+		for _, r := range ch.Releases {
+			images = append(images, r.ImageURL)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", ch.Name, strings.Join(images, ", "), ch.UpdatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// getChannel prints a release channel's latest releases.
+func getChannel(name string) {
+	ch, err := cc.GetChannel(context.Background(), name)
+	if err != nil {
+		fail(err, "Error: Failed to get channel %s", name)
+	}
+	printChannel(ch)
+}
+
+func printChannel(ch *client.Channel) {
+	fmt.Printf("Name:    %s\n", ch.Name)
+	fmt.Printf("Updated: %s\n\n", ch.UpdatedAt.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tIMAGE\tPUBLISHED (UTC)\tNOTE")
+	for _, r := range ch.Releases {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Repository, r.ImageURL, r.PublishedAt.Format(time.RFC3339), r.Note)
+	}
+	w.Flush()
+}
+
+// publishRelease publishes an image to a channel and reports which
+// deployments were redeployed with it.
+func publishRelease(channel string, req client.PublishRequest) {
+	result, err := cc.PublishRelease(context.Background(), channel, req)
+	if err != nil {
+		fail(err, "Error: Failed to publish %s to channel %s", req.ImageURL, channel)
+	}
+	fmt.Printf("Published %s to channel %s\n", result.Release.ImageURL, channel)
+	fmt.Printf("  Redeployed: %d %s\n", len(result.Updated), strings.Join(result.Updated, " "))
+	fmt.Printf("  Waiting:    %d %s\n", len(result.Available), strings.Join(result.Available, " "))
+}
+
+// deleteChannel deletes a release channel.
+func deleteChannel(name string) {
+	if err := cc.DeleteChannel(context.Background(), name); err != nil {
+		fail(err, "Error: Failed to delete channel %s", name)
+	}
+	fmt.Printf("Channel %s deleted\n", name)
+}
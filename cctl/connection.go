@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"edge-orchestration/client"
+
+	"gopkg.in/yaml.v3"
+)
+
+// connectionSettings are the global flags that say how to reach the control
+// center, with the environment variables that set them when the flag is not
+// given. The config file sets them by the flag's name when neither is.
+var connectionSettings = []struct {
+	flag, env string
+	boolean   bool
+}{
+	{flag: "server", env: "CONTROL_CENTER_ADDR"},
+	{flag: "token", env: "CONTROL_CENTER_TOKEN"},
+	{flag: "timeout", env: "CONTROL_CENTER_TIMEOUT"},
+	{flag: "certificate-authority", env: "CONTROL_CENTER_CA_FILE"},
+	{flag: "insecure-skip-tls-verify", env: "CONTROL_CENTER_INSECURE_SKIP_TLS_VERIFY", boolean: true},
+	{flag: "retries", env: "CONTROL_CENTER_RETRIES"},
+	{flag: "retry-backoff", env: "CONTROL_CENTER_RETRY_BACKOFF"},
+}
+
+// connection is how cctl reaches the control center, resolved from global
+// flags, the environment, and the config file, in that order.
+type connection struct {
+	server   string
+	token    string
+	timeout  time.Duration
+	caFile   string
+	insecure bool
+	retries  int           // Retries of failed calls that are safe to repeat; -1 for the client's default
+	backoff  time.Duration // Wait before the first retry; 0 for the client's default
+}
+
+// connectionFlag returns the connection setting arg sets, if it is one, and
+// the value it gives it: "--timeout=5s", "--timeout 5s" (taking the next
+// argument), or "--insecure-skip-tls-verify". It reports whether it took
+// the next argument.
+func connectionFlag(arg, next string, hasNext bool) (name, value string, ok, tookNext bool) {
+	for _, s := range connectionSettings {
+		switch {
+		case arg == "--"+s.flag && s.boolean:
+			return s.flag, "true", true, false
+		case arg == "--"+s.flag && hasNext:
+			return s.flag, next, true, true
+		case len(arg) > len(s.flag)+3 && arg[:len(s.flag)+3] == "--"+s.flag+"=":
+			return s.flag, arg[len(s.flag)+3:], true, false
+		}
+	}
+	return "", "", false, false
+}
+
+// configPath returns the path of cctl's config file: CCTL_CONFIG, or
+// cctl/config.yaml in the user's config directory, e.g.
+// ~/.config/cctl/config.yaml. The second result reports whether the file
+// must exist.
+func configPath() (string, bool) {
+	if path := os.Getenv("CCTL_CONFIG"); path != "" {
+		return path, true
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, "cctl", "config.yaml"), false
+}
+
+// readConfig returns the settings in cctl's config file, by flag name. A
+// missing file has none, unless CCTL_CONFIG names it.
+func readConfig() (map[string]string, error) {
+	path, required := configPath()
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	settings := make(map[string]string, len(raw))
+	for key, value := range raw {
+		known := false
+		for _, s := range connectionSettings {
+			known = known || s.flag == key
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid config file %s: unknown setting %q", path, key)
+		}
+		settings[key] = fmt.Sprint(value)
+	}
+	return settings, nil
+}
+
+// resolveConnection combines the connection settings given as flags with
+// those in the environment and the config file.
+func resolveConnection(flags map[string]string) (connection, error) {
+	config, err := readConfig()
+	if err != nil {
+		return connection{}, err
+	}
+	value := func(flag string) (string, string) {
+		for _, s := range connectionSettings {
+			if s.flag != flag {
+				continue
+			}
+			if v, ok := flags[flag]; ok {
+				return v, "--" + flag
+			}
+			if v := os.Getenv(s.env); v != "" {
+				return v, s.env
+			}
+		}
+		return config[flag], flag + " in the config file"
+	}
+
+	c := connection{server: client.DefaultAddress, retries: -1}
+	if v, _ := value("server"); v != "" {
+		c.server = v
+	}
+	c.token, _ = value("token")
+	c.caFile, _ = value("certificate-authority")
+	if v, source := value("timeout"); v != "" {
+		if c.timeout, err = time.ParseDuration(v); err != nil || c.timeout < 0 {
+			return c, fmt.Errorf("invalid %s %q: must be a duration such as 30s", source, v)
+		}
+	}
+	if v, source := value("insecure-skip-tls-verify"); v != "" {
+		if c.insecure, err = strconv.ParseBool(v); err != nil {
+			return c, fmt.Errorf("invalid %s %q: must be true or false", source, v)
+		}
+	}
+	if v, source := value("retries"); v != "" {
+		if c.retries, err = strconv.Atoi(v); err != nil || c.retries < 0 {
+			return c, fmt.Errorf("invalid %s %q: must be a number of retries, 0 to disable them", source, v)
+		}
+	}
+	if v, source := value("retry-backoff"); v != "" {
+		if c.backoff, err = time.ParseDuration(v); err != nil || c.backoff <= 0 {
+			return c, fmt.Errorf("invalid %s %q: must be a positive duration such as 500ms", source, v)
+		}
+	}
+	return c, nil
+}
+
+// options returns the client options that reach the control center over c.
+func (c connection) options() ([]client.Option, error) {
+	opts := []client.Option{}
+	if c.token != "" {
+		opts = append(opts, client.WithToken(c.token))
+	}
+	if c.retries >= 0 {
+		opts = append(opts, client.WithRetries(c.retries))
+	}
+	if c.backoff > 0 {
+		opts = append(opts, client.WithBackoff(c.backoff))
+	}
+	if c.timeout == 0 && c.caFile == "" && !c.insecure {
+		return opts, nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.caFile != "" || c.insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: c.insecure}
+	}
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the certificate authority: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", c.caFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	return append(opts, client.WithHTTPClient(&http.Client{Transport: t, Timeout: c.timeout})), nil
+}
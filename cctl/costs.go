@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"edge-orchestration/client"
+)
+
+func handleCostsCmd(args []string) {
+	costsCmd := flag.NewFlagSet("costs", flag.ExitOnError)
+	project := costsCmd.String("project", "", "Only report the deployments of this project.")
+	agent := costsCmd.String("agent", "", "Only report the deployments on this agent.")
+	costsCmd.Parse(args)
+	if costsCmd.NArg() > 0 {
+		fmt.Println("Usage: cctl costs [--project <name>] [--agent <id>]")
+		os.Exit(exitInvalid)
+	}
+	reportCosts(*project, *agent)
+}
+
+// reportCosts prints the estimated cost of each deployment that ran and of
+// each project.
+func reportCosts(project, agentID string) {
+	report, err := cc.CostReport(context.Background(), project, agentID)
+	if err != nil {
+		fail(err, "Error: Failed to get the cost report")
+	}
+	cur := report.Currency
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tPROJECT\tAGENT\tSTATUS\tPER HOUR\tHOURS\tCOST\tPER MONTH")
+	for _, d := range report.Deployments {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.1f\t%s\t%s\n",
+			d.ID, d.Project, d.AgentID, d.Status, money(d.HourlyRate, cur), d.RunningHours, money(d.Accumulated, cur), money(d.EstimatedMonthly, cur))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tDEPLOYMENTS\tPER HOUR\tCOST\tPER MONTH")
+	for _, p := range report.Projects {
+		name := p.Project
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", name, p.Deployments, money(p.HourlyRate, cur), money(p.Accumulated, cur), money(p.EstimatedMonthly, cur))
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%s\t%s\t%s\n", len(report.Deployments), money(report.HourlyRate, cur), money(report.Accumulated, cur), money(report.EstimatedMonthly, cur))
+	w.Flush()
+}
+
+// money formats an amount in a currency, e.g. "12.50 USD".
+func money(amount float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// setAgentPrices sets the price hints of an agent's deployments.
+func setAgentPrices(id string, prices client.Prices) {
+	if _, err := cc.SetAgentPrices(context.Background(), id, prices); err != nil {
+		fail(err, "Error: Failed to set the prices of agent %s", id)
+	}
+	fmt.Printf("Agent %s priced at %g per CPU, %g per GiB of memory, and %g per GPU per hour\n", id, prices.CPU, prices.Memory, prices.GPU)
+}
+
+// clearAgentPrices makes an agent's deployments use the default prices.
+func clearAgentPrices(id string) {
+	if _, err := cc.ClearAgentPrices(context.Background(), id); err != nil {
+		fail(err, "Error: Failed to clear the prices of agent %s", id)
+	}
+	fmt.Printf("Agent %s uses the default prices\n", id)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"edge-orchestration/client"
+)
+
+// Exit codes of failed commands, for scripts to tell failures apart.
+const (
+	exitFailure  = 1 // Any other failure, e.g. the control center could not be reached
+	exitInvalid  = 2 // The command was used wrongly, its flags or input are invalid, or the control center rejected the request as invalid
+	exitNotFound = 3 // What the command refers to does not exist
+	exitServer   = 4 // The control center failed to carry out the request
+	exitTimeout  = 5 // The call did not finish within --timeout, or the control center timed out
+)
+
+// failInvalid logs why the command's flags, arguments, or input are invalid
+// and exits with exitInvalid.
+func failInvalid(format string, args ...any) {
+	log.Printf(format, args...)
+	os.Exit(exitInvalid)
+}
+
+// exitCode returns the exit code for a failed call to the control center.
+func exitCode(err error) int {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return exitTimeout
+	}
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return exitFailure
+	}
+	switch code := apiErr.StatusCode; {
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity || code == http.StatusRequestEntityTooLarge:
+		return exitInvalid
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return exitNotFound
+	case code == http.StatusGatewayTimeout:
+		return exitTimeout
+	case code >= 500:
+		return exitServer
+	}
+	return exitFailure
+}
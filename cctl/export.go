@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"edge-orchestration/client"
+	"gopkg.in/yaml.v3"
+)
+
+// exportVersion is the format version of exported resources.
+const exportVersion = 1
+
+// Export is a declarative description of the resources of a control center
+// that can be imported into another one. Agents register themselves, so they
+// are not exported; deployments refer to them by ID.
+type Export struct {
+	Version      int                         `json:"version"`
+	Configs      []ExportedConfig            `json:"configs,omitempty"`
+	Quotas       []client.Quota              `json:"quotas,omitempty"`
+	Policies     []client.Policy             `json:"policies,omitempty"`
+	Applications []client.ApplicationRequest `json:"applications,omitempty"`
+	Deployments  []client.DeploymentRequest  `json:"deployments,omitempty"`
+}
+
+// ExportedConfig is a config without its version history.
+type ExportedConfig struct {
+	Name string            `json:"name"`
+	Data map[string]string `json:"data"`
+}
+
+// agentMap collects repeated --agent flags of the form <old-id>=<new-id>.
+type agentMap map[string]string
+
+func (m agentMap) String() string { return fmt.Sprint(map[string]string(m)) }
+
+func (m agentMap) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=")
+	if !ok || from == "" || to == "" {
+		return fmt.Errorf("expected <old-id>=<new-id>, got %q", value)
+	}
+	m[from] = to
+	return nil
+}
+
+func handleExportCmd(args []string) {
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	output := exportCmd.String("o", "", "Write the export to this file instead of standard output.")
+	exportCmd.Parse(args)
+
+	data, err := toYAML(exportResources())
+	if err != nil {
+		log.Fatalf("Failed to encode export: %v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		log.Fatalf("Failed to write export: %v", err)
+	}
+	fmt.Printf("Exported resources to %s\n", *output)
+}
+
+func handleImportCmd(args []string) {
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	agents := agentMap{}
+	importCmd.Var(agents, "agent", "Replace an agent ID as <old-id>=<new-id>; may be repeated.")
+	importCmd.Parse(args)
+	if importCmd.NArg() != 1 {
+		fmt.Println("Usage: cctl import [--agent <old-id>=<new-id>]... <file>")
+		os.Exit(exitInvalid)
+	}
+
+	data, err := os.ReadFile(importCmd.Arg(0))
+	if err != nil {
+		failInvalid("Failed to read import: %v", err)
+	}
+	var doc Export
+	if err := fromYAML(data, &doc); err != nil {
+		failInvalid("Failed to parse import: %v", err)
+	}
+	if doc.Version != exportVersion {
+		failInvalid("Export version %d is not supported; expected version %d", doc.Version, exportVersion)
+	}
+	importResources(doc, agents)
+}
+
+// exportResources fetches the resources a control center manages directly.
+// Archived deployments and deployments owned by an application, a git spec,
+// or a Kubernetes object are left out.
+func exportResources() Export {
+	ctx := context.Background()
+	doc := Export{Version: exportVersion}
+
+	configs, err := cc.ListConfigs(ctx)
+	if err != nil {
+		fail(err, "Error: Failed to list configs")
+	}
+	for _, cfg := range configs {
+		doc.Configs = append(doc.Configs, ExportedConfig{Name: cfg.Name, Data: cfg.Data})
+	}
+	quotas, err := cc.ListQuotas(ctx)
+	if err != nil {
+		fail(err, "Error: Failed to list quotas")
+	}
+	for _, q := range quotas {
+		doc.Quotas = append(doc.Quotas, q.Quota)
+	}
+	var apiErr *client.APIError
+	if doc.Policies, err = cc.ListPolicies(ctx); errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+		// The policy engine is not configured.
+	} else if err != nil {
+		fail(err, "Error: Failed to list policies")
+	}
+
+	apps, err := cc.ListApplications(ctx)
+	if err != nil {
+		fail(err, "Error: Failed to list applications")
+	}
+	for _, app := range apps {
+		for i := range app.Components {
+			app.Components[i].Volumes = stripClaimNames(app.ID+"-"+app.Components[i].Name, app.Components[i].Volumes)
+			app.Components[i].Configs = stripConfigVersions(app.Components[i].Configs)
+		}
+		doc.Applications = append(doc.Applications, client.ApplicationRequest{
+			Name:       app.Name,
+			AgentID:    app.AgentID,
+			Project:    app.Project,
+			Components: app.Components,
+		})
+	}
+
+	agents, err := cc.ListAgents(ctx, false)
+	if err != nil {
+		fail(err, "Error: Failed to list agents")
+	}
+	for _, agent := range agents {
+		deployments, err := cc.ListDeployments(ctx, agent.ID, false)
+		if err != nil {
+			fail(err, "Error: Failed to list deployments of agent %s", agent.ID)
+		}
+		for _, dep := range deployments {
+			switch {
+			case dep.ArchivedAt != nil, dep.Application != "", dep.GitSpec != "", dep.KubernetesObject != "", dep.AddonOf != "", dep.Hook != "":
+				continue
+			case dep.Status == "superseded", dep.Status == "removed", dep.Status == "deleted", dep.Status == "expired", dep.Status == "cancelled", dep.Status == "succeeded":
+				continue
+			}
+			doc.Deployments = append(doc.Deployments, client.DeploymentRequest{
+				AgentID:    dep.AgentID,
+				ImageURL:   dep.ImageURL,
+				AutoUpdate: dep.AutoUpdate,
+				Project:    dep.Project,
+				Resources:  dep.Resources,
+				Volumes:    stripClaimNames(dep.ID, dep.Volumes),
+				Artifacts:  dep.Artifacts,
+				Configs:    stripConfigVersions(dep.Configs),
+				Secrets:    stripSecretVersions(dep.Secrets),
+				Addons:     stripAddonDeployments(dep.Addons),
+				Sandbox:    dep.Sandbox,
+				Bundle:     dep.Bundle,
+			})
+		}
+	}
+	return doc
+}
+
+// importResources creates the resources of an export. Configs, quotas, and
+// policies are created or replaced; applications and deployments are always
+// created anew.
+func importResources(doc Export, agents agentMap) {
+	ctx := context.Background()
+	mapAgent := func(id string) string {
+		if to, ok := agents[id]; ok {
+			return to
+		}
+		return id
+	}
+
+	for _, cfg := range doc.Configs {
+		if _, err := cc.SetConfig(ctx, cfg.Name, cfg.Data); err != nil {
+			fail(err, "Error: Failed to import config %s", cfg.Name)
+		}
+	}
+	for _, q := range doc.Quotas {
+		if q.Scope == "agent" {
+			q.Name = mapAgent(q.Name)
+		}
+		if _, err := cc.SetQuota(ctx, q); err != nil {
+			fail(err, "Error: Failed to import %s quota %s", q.Scope, q.Name)
+		}
+	}
+	for _, p := range doc.Policies {
+		if _, err := cc.SetPolicy(ctx, p.ID, p.Rego); err != nil {
+			fail(err, "Error: Failed to import policy %s", p.ID)
+		}
+	}
+	fmt.Printf("Imported %d configs, %d quotas, and %d policies\n", len(doc.Configs), len(doc.Quotas), len(doc.Policies))
+
+	failed := 0
+	for _, app := range doc.Applications {
+		app.AgentID = mapAgent(app.AgentID)
+		created, err := cc.CreateApplication(ctx, app)
+		if err != nil {
+			fmt.Printf("Application %s: %v\n", app.Name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Application %s created as %s\n", app.Name, created.ID)
+	}
+
+	if len(doc.Deployments) > 0 {
+		specs := make([]batchSpec, len(doc.Deployments))
+		for i, req := range doc.Deployments {
+			req.AgentID = mapAgent(req.AgentID)
+			specs[i] = batchSpec{File: fmt.Sprintf("deployments[%d]", i), Request: req}
+		}
+		deployBatch(specs)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// stripClaimNames removes PVC claim names that the control center derived
+// from the given prefix, so that the importing control center derives its own.
+func stripClaimNames(prefix string, volumes []client.Volume) []client.Volume {
+	for i, v := range volumes {
+		if v.PVC != nil && v.PVC.ClaimName == prefix+"-"+v.Name {
+			pvc := *v.PVC
+			pvc.ClaimName = ""
+			volumes[i].PVC = &pvc
+		}
+	}
+	return volumes
+}
+
+// stripConfigVersions removes the config versions the control center records
+// in config references.
+func stripConfigVersions(refs []client.ConfigRef) []client.ConfigRef {
+	for i := range refs {
+		refs[i].Version = 0
+	}
+	return refs
+}
+
+// stripSecretVersions removes the secret versions the control center records
+// in secret references. Secret values are never exported.
+func stripSecretVersions(refs []client.SecretRef) []client.SecretRef {
+	for i := range refs {
+		refs[i].Version = 0
+	}
+	return refs
+}
+
+// stripAddonDeployments removes the deployments and connection details the
+// control center records in add-ons, since importing creates them anew.
+func stripAddonDeployments(addons []client.Addon) []client.Addon {
+	for i := range addons {
+		addons[i].DeploymentID, addons[i].Env = "", nil
+	}
+	return addons
+}
+
+// toYAML renders a value as YAML with the same field names as its JSON form.
+func toYAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML, so decoding it into a node keeps the field order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	clearStyle(&node)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// clearStyle switches a node decoded from JSON to block style.
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
+// fromYAML decodes YAML into a value with JSON field names.
+func fromYAML(data []byte, v any) error {
+	var generic any
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
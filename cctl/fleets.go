@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"edge-orchestration/client"
+)
+
+func handleFleetsCmd(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		listFleets()
+	case len(args) == 2 && args[0] == "get":
+		getFleet(args[1])
+	case len(args) >= 2 && args[0] == "set":
+		setFleet(args[1], args[2:])
+	case len(args) == 2 && args[0] == "delete":
+		deleteFleet(args[1])
+	default:
+		fmt.Println("Usage: cctl fleets list")
+		fmt.Println("       cctl fleets get <name>")
+		fmt.Println("       cctl fleets set <name> <agent-id>...")
+		fmt.Println("       cctl fleets delete <name>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// formatCounts renders status counts as "running=3 failed=1", sorted by status.
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", k, counts[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// listFleets prints all fleets with their aggregated status.
+func listFleets() {
+	fleets, err := cc.ListFleets(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list fleets")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tAGENTS\tAGENT STATUS\tDEPLOYMENTS")
+	for _, f := range fleets {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", f.Name, len(f.Agents), formatCounts(f.AgentStatus), formatCounts(f.DeploymentStatus))
+	}
+	w.Flush()
+}
+
+// getFleet prints a fleet's agents and aggregated status.
+func getFleet(name string) {
+	f, err := cc.GetFleet(context.Background(), name)
+	if err != nil {
+		fail(err, "Error: Failed to get fleet %s", name)
+	}
+	printFleet(f)
+}
+
+// setFleet creates a fleet or replaces its agents.
+func setFleet(name string, agentIDs []string) {
+	f, err := cc.SetFleet(context.Background(), name, agentIDs)
+	if err != nil {
+		fail(err, "Error: Failed to set fleet %s", name)
+	}
+	printFleet(f)
+}
+
+func printFleet(f *client.FleetStatus) {
+	fmt.Printf("Name:         %s\n", f.Name)
+	fmt.Printf("Agents:       %s\n", strings.Join(f.Agents, ", "))
+	fmt.Printf("Agent Status: %s\n", formatCounts(f.AgentStatus))
+	fmt.Printf("Deployments:  %s\n", formatCounts(f.DeploymentStatus))
+}
+
+// deleteFleet deletes a fleet, leaving its deployments running.
+func deleteFleet(name string) {
+	if err := cc.DeleteFleet(context.Background(), name); err != nil {
+		fail(err, "Error: Failed to delete fleet %s", name)
+	}
+	fmt.Printf("Fleet %s deleted\n", name)
+}
+
+// deployToFleet creates a deployment on every agent of a fleet, prints the
+// outcome per agent, and returns the IDs of the deployments it created.
+func deployToFleet(name string, req client.DeploymentRequest) []string {
+	ctx := context.Background()
+	f, err := cc.GetFleet(ctx, name)
+	if err != nil {
+		fail(err, "Error: Failed to get fleet %s", name)
+	}
+	result, err := cc.DeployToFleet(ctx, name, req)
+	if err != nil {
+		fail(err, "Fleet deployment request failed")
+	}
+	printDeployResults(result, f.Agents)
+	return createdIDs(result)
+}
+
+// deployToSelector deploys a request to every agent whose labels match its
+// selector, and returns the IDs of the deployments it created.
+func deployToSelector(req client.DeploymentRequest) []string {
+	ctx := context.Background()
+	agents, err := cc.SelectAgents(ctx, req.AgentSelector)
+	if err != nil {
+		fail(err, "Error: Failed to list the agents of selector %s", formatLabels(req.AgentSelector))
+	}
+	// The control center deploys to the matching agents sorted by ID.
+	ids := make([]string, len(agents))
+	for i, agent := range agents {
+		ids[i] = agent.ID
+	}
+	sort.Strings(ids)
+	result, err := cc.DeployToSelector(ctx, req)
+	if err != nil {
+		fail(err, "Selector deployment request failed")
+	}
+	printDeployResults(result, ids)
+	return createdIDs(result)
+}
+
+// createdIDs returns the IDs of the deployments a batch created.
+func createdIDs(result *client.BatchResponse) []string {
+	var ids []string
+	for _, r := range result.Results {
+		if r.Operation == "create" && r.Deployment != nil {
+			ids = append(ids, r.Deployment.ID)
+		}
+	}
+	return ids
+}
+
+// printDeployResults prints the outcome of deploying to each of the given
+// agents, and exits with an error if any failed.
+func printDeployResults(result *client.BatchResponse, agents []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tSTATUS\tRESULT")
+	for _, r := range result.Results {
+		agentID, outcome := "-", r.ID
+		if r.Deployment != nil {
+			agentID = r.Deployment.AgentID
+		} else if r.Index < len(agents) {
+			agentID = agents[r.Index]
+		}
+		if r.Error != "" {
+			outcome = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", agentID, r.Status, outcome)
+	}
+	w.Flush()
+	fmt.Printf("\n%d created, %d failed\n", result.Succeeded, result.Failed)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
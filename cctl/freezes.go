@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+func handleFreezesCmd(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		listFreezes()
+	case len(args) == 2 && args[0] == "get":
+		getFreeze(args[1])
+	case len(args) >= 1 && args[0] == "create":
+		createCmd := flag.NewFlagSet("freezes create", flag.ExitOnError)
+		scope := createCmd.String("scope", "global", "What the freeze covers: global, project, or agent.")
+		project := createCmd.String("project", "", "The project to freeze, with --scope project.")
+		agentID := createCmd.String("agent", "", "The agent to freeze, with --scope agent.")
+		start := createCmd.String("start", "", "When the freeze starts, in RFC 3339; defaults to now.")
+		end := createCmd.String("end", "", "When the freeze ends, in RFC 3339, or how long it lasts, e.g. 72h.")
+		reason := createCmd.String("reason", "", "Why deployments are frozen.")
+		createCmd.Parse(args[1:])
+		createFreeze(*scope, *project, *agentID, *start, *end, *reason)
+	case len(args) == 2 && args[0] == "delete":
+		deleteFreeze(args[1])
+	default:
+		fmt.Println("Usage: cctl freezes list")
+		fmt.Println("       cctl freezes get <id>")
+		fmt.Println("       cctl freezes create [--scope global|project|agent] [--project <name>] [--agent <id>] [--start <time>] --end <time|duration> [--reason <text>]")
+		fmt.Println("       cctl freezes delete <id>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// freezeTarget describes what a freeze covers.
+func freezeTarget(f client.Freeze) string {
+	switch f.Scope {
+	case "project":
+		return "project " + f.Project
+	case "agent":
+		return "agent " + f.AgentID
+	}
+	return "all deployments"
+}
+
+// listFreezes prints all freeze windows.
+func listFreezes() {
+	freezes, err := cc.ListFreezes(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list freezes")
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tSCOPE\tSTART (UTC)\tEND (UTC)\tACTIVE\tOVERRIDES\tREASON")
+	for _, f := range freezes {
+		active := !now.Before(f.Start) && now.Before(f.End)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%d\t%s\n", f.ID, freezeTarget(f), f.Start.Format(time.RFC3339), f.End.Format(time.RFC3339), active, len(f.Overrides), f.Reason)
+	}
+	w.Flush()
+}
+
+// getFreeze prints a freeze window and its break-glass overrides.
+func getFreeze(id string) {
+	f, err := cc.GetFreeze(context.Background(), id)
+	if err != nil {
+		fail(err, "Error: Failed to get freeze %s", id)
+	}
+	printFreeze(f)
+}
+
+func printFreeze(f *client.Freeze) {
+	fmt.Printf("ID:     %s\n", f.ID)
+	fmt.Printf("Scope:  %s\n", freezeTarget(*f))
+	fmt.Printf("Start:  %s\n", f.Start.Format(time.RFC3339))
+	fmt.Printf("End:    %s\n", f.End.Format(time.RFC3339))
+	if f.Reason != "" {
+		fmt.Printf("Reason: %s\n", f.Reason)
+	}
+	if len(f.Overrides) == 0 {
+		return
+	}
+	fmt.Println("\nBreak-glass overrides:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TIME (UTC)\tOPERATION\tJUSTIFICATION")
+	for _, o := range f.Overrides {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", o.At.Format(time.RFC3339), o.Operation, o.Justification)
+	}
+	w.Flush()
+}
+
+// createFreeze creates a freeze window. The end may be a time or a duration
+// after the start.
+func createFreeze(scope, project, agentID, start, end, reason string) {
+	req := client.FreezeRequest{Scope: scope, Project: project, AgentID: agentID, Reason: reason}
+	req.Start = time.Now().UTC()
+	if start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			failInvalid("--start must be an RFC 3339 time, e.g. 2026-12-20T00:00:00Z: %v", err)
+		}
+		req.Start = t
+	}
+	if t, err := time.Parse(time.RFC3339, end); err == nil {
+		req.End = t
+	} else if d, err := time.ParseDuration(end); err == nil && d > 0 {
+		req.End = req.Start.Add(d)
+	} else {
+		failInvalid("--end must be an RFC 3339 time or a positive duration, e.g. 72h")
+	}
+	f, err := cc.CreateFreeze(context.Background(), req)
+	if err != nil {
+		fail(err, "Error: Failed to create freeze")
+	}
+	printFreeze(f)
+}
+
+// deleteFreeze deletes a freeze window, ending it early.
+func deleteFreeze(id string) {
+	if err := cc.DeleteFreeze(context.Background(), id); err != nil {
+		fail(err, "Error: Failed to delete freeze %s", id)
+	}
+	fmt.Printf("Freeze %s deleted\n", id)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func handleEndpointsCmd(args []string) {
+	if len(args) > 0 {
+		fmt.Println("Usage: cctl endpoints")
+		os.Exit(exitInvalid)
+	}
+	listEndpoints()
+}
+
+// listEndpoints prints the model endpoints the inference gateway routes to.
+func listEndpoints() {
+	endpoints, err := cc.ModelEndpoints(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list model endpoints")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tSERVER\tDEPLOYMENT\tAGENT\tURL\tIN FLIGHT\tSHADOW OF")
+	for _, e := range endpoints {
+		shadowOf := "-"
+		if e.ShadowOf != "" {
+			shadowOf = fmt.Sprintf("%s (%d%%)", e.ShadowOf, e.ShadowPercent)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", e.Model, e.Server, e.DeploymentID, e.AgentID, e.URL, e.InFlight, shadowOf)
+	}
+	w.Flush()
+}
+
+func handleShadowsCmd(args []string) {
+	if len(args) > 0 {
+		fmt.Println("Usage: cctl shadows")
+		os.Exit(exitInvalid)
+	}
+	listShadows()
+}
+
+// listShadows prints how shadow deployments compare with the deployments
+// serving the requests mirrored to them.
+func listShadows() {
+	shadows, err := cc.ListShadows(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list shadow deployments")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tMODEL\tSHADOW OF\tSTATUS\tMIRRORED\tDROPPED\tP50 MS (PRIMARY)\tP95 MS (PRIMARY)\tERRORS % (PRIMARY)")
+	for _, s := range shadows {
+		fmt.Fprintf(w, "%s\t%s\t%s (%d%%)\t%s\t%d\t%d\t%.0f (%.0f)\t%.0f (%.0f)\t%.1f (%.1f)\n",
+			s.DeploymentID, s.Model, s.ShadowOf, s.Percent, s.Status, s.Mirrored, s.Dropped,
+			s.Shadow.P50Millis, s.Primary.P50Millis, s.Shadow.P95Millis, s.Primary.P95Millis, s.Shadow.ErrorRate, s.Primary.ErrorRate)
+	}
+	w.Flush()
+}
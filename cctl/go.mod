@@ -1,3 +1,19 @@
 module edge-orchestration/cctl
 
 go 1.24.3
+
+require (
+	edge-orchestration/client v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	edge-orchestration/api v0.0.0 // indirect
+	github.com/gorilla/websocket v1.5.4-0.20250319132907-e064f32e3674 // indirect
+	golang.org/x/net v0.26.0 // indirect
+)
+
+replace (
+	edge-orchestration/api => ../api
+	edge-orchestration/client => ../client
+)
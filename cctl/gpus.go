@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func handleGPUsCmd(args []string) {
+	if len(args) > 0 {
+		fmt.Println("Usage: cctl gpus")
+		os.Exit(exitInvalid)
+	}
+	listGPUs()
+}
+
+// listGPUs prints the GPU capacity of each agent that reported its GPUs.
+func listGPUs() {
+	gpus, err := cc.GPUCapacity(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list GPU capacity")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tSTATUS\tMODEL\tTOTAL\tALLOCATED\tFREE")
+	for _, g := range gpus {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", g.AgentID, g.Status, g.Model, g.Total, g.Allocated, g.Free)
+	}
+	w.Flush()
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultAgentImage     = "edge-orchestration/agent:latest"
+	defaultAgentNamespace = "edge-system"
+	defaultAgentName      = "edge-agent"
+	defaultAgentBinary    = "/usr/local/bin/edge-agent"
+	// serviceAccountDir is where Kubernetes mounts a pod's service account
+	// token and the cluster's CA certificate.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// namePattern matches names that are valid Kubernetes object names and
+// systemd unit names alike.
+var namePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// installOptions configures the agent an install manifest or script runs.
+type installOptions struct {
+	format      string // "deployment", "daemonset", or "systemd"
+	addr        string
+	grpcAddr    string
+	token       string
+	bootstrap   string
+	labels      map[string]string
+	image       string
+	namespace   string
+	name        string
+	kubernetes  bool
+	clusterRole string
+	tunnel      bool
+	binary      string
+}
+
+func handleInstallCmd(args []string) {
+	installCmd := flag.NewFlagSet("agents install", flag.ExitOnError)
+	opts := installOptions{}
+	installCmd.StringVar(&opts.format, "format", "deployment", "What to generate: deployment or daemonset (Kubernetes manifests), or systemd (an install script for a host).")
+	installCmd.StringVar(&opts.addr, "addr", "", "Control center address the agent uses (default the one cctl uses).")
+	installCmd.StringVar(&opts.grpcAddr, "grpc-addr", "", "host:port of the control center's agent stream, if not port 8081 of --addr.")
+	installCmd.StringVar(&opts.token, "token", "", "Bearer token the agent sends to the control center, kept in a Secret or a file only root can read.")
+	installCmd.StringVar(&opts.bootstrap, "bootstrap-token", "", "Bootstrap token the agent registers with, from cctl bootstrap-tokens create, kept like --token.")
+	labels := installCmd.String("labels", "", "Labels the agent advertises, e.g. site=store-104,gpu=jetson.")
+	installCmd.StringVar(&opts.image, "image", defaultAgentImage, "Agent image, for deployment and daemonset.")
+	installCmd.StringVar(&opts.namespace, "namespace", defaultAgentNamespace, "Namespace to run the agent in, for deployment and daemonset.")
+	installCmd.StringVar(&opts.name, "name", defaultAgentName, "Name of the agent's Kubernetes objects or systemd unit.")
+	installCmd.BoolVar(&opts.kubernetes, "kubernetes", false, "Let the agent carry out cluster operations, bound to --cluster-role, for deployment and daemonset.")
+	installCmd.StringVar(&opts.clusterRole, "cluster-role", "edit", "ClusterRole the agent gets with --kubernetes.")
+	installCmd.BoolVar(&opts.tunnel, "tunnel", false, "Open a reverse tunnel to the cluster's API with the agent's service account, for deployment and daemonset.")
+	installCmd.StringVar(&opts.binary, "binary", defaultAgentBinary, "Path of the agent binary on the host, for systemd.")
+	installCmd.Parse(args)
+	if opts.addr == "" {
+		opts.addr = conn.server
+	}
+	opts.labels = parseSelector(*labels)
+	if !namePattern.MatchString(opts.name) {
+		failInvalid("Invalid --name %q: must be lowercase letters, digits, and '-'", opts.name)
+	}
+	if !namePattern.MatchString(opts.namespace) {
+		failInvalid("Invalid --namespace %q: must be lowercase letters, digits, and '-'", opts.namespace)
+	}
+	if !strings.HasPrefix(opts.binary, "/") || strings.ContainsAny(opts.binary, " \t'\"\\$`") {
+		failInvalid("Invalid --binary %q: must be an absolute path without spaces or quotes", opts.binary)
+	}
+
+	switch opts.format {
+	case "deployment", "daemonset":
+		data, err := toYAMLDocuments(agentManifests(opts))
+		if err != nil {
+			failInvalid("Failed to render manifests: %v", err)
+		}
+		os.Stdout.Write(data)
+	case "systemd":
+		fmt.Print(agentInstallScript(opts))
+	default:
+		failInvalid("Invalid --format %q: must be deployment, daemonset, or systemd", opts.format)
+	}
+}
+
+// agentEnv returns the environment variables that configure the agent, in
+// the order they are listed.
+func agentEnv(opts installOptions) [][2]string {
+	env := [][2]string{{"CONTROL_CENTER_ADDR", opts.addr}}
+	if opts.grpcAddr != "" {
+		env = append(env, [2]string{"CONTROL_CENTER_GRPC_ADDR", opts.grpcAddr})
+	}
+	if len(opts.labels) > 0 {
+		env = append(env, [2]string{"AGENT_LABELS", formatLabels(opts.labels)})
+	}
+	return env
+}
+
+// agentSecret is a secret setting of the agent: the environment variable it
+// is passed in and its key in the agent's Secret.
+type agentSecret struct {
+	env, key, value string
+}
+
+// agentSecrets returns the secret settings of the agent that are set.
+func agentSecrets(opts installOptions) []agentSecret {
+	var secrets []agentSecret
+	if opts.token != "" {
+		secrets = append(secrets, agentSecret{"CONTROL_CENTER_TOKEN", "token", opts.token})
+	}
+	if opts.bootstrap != "" {
+		secrets = append(secrets, agentSecret{"AGENT_BOOTSTRAP_TOKEN", "bootstrap-token", opts.bootstrap})
+	}
+	return secrets
+}
+
+// agentManifests renders the Kubernetes objects that run the agent: its
+// namespace, the Secret holding its tokens, its service account and role
+// binding, and a Deployment of one replica or a DaemonSet.
+func agentManifests(opts installOptions) []map[string]any {
+	labels := map[string]any{"app.kubernetes.io/name": opts.name, "app.kubernetes.io/part-of": "edge-orchestration"}
+	meta := func(name string, namespaced bool) map[string]any {
+		m := map[string]any{"name": name, "labels": labels}
+		if namespaced {
+			m["namespace"] = opts.namespace
+		}
+		return m
+	}
+
+	var env []any
+	if opts.format == "daemonset" {
+		// Each node runs an agent of its own, which advertises its node.
+		env = append(env, map[string]any{"name": "NODE_NAME", "valueFrom": map[string]any{"fieldRef": map[string]any{"fieldPath": "spec.nodeName"}}})
+		opts.labels = cloneLabels(opts.labels)
+		opts.labels["node"] = "$(NODE_NAME)"
+	}
+	for _, kv := range agentEnv(opts) {
+		env = append(env, map[string]any{"name": kv[0], "value": kv[1]})
+	}
+	manifests := []map[string]any{
+		{"apiVersion": "v1", "kind": "Namespace", "metadata": meta(opts.namespace, false)},
+		{"apiVersion": "v1", "kind": "ServiceAccount", "metadata": meta(opts.name, true)},
+	}
+	secret := map[string]any{}
+	for _, s := range agentSecrets(opts) {
+		secret[s.key] = s.value
+		env = append(env, map[string]any{"name": s.env, "valueFrom": map[string]any{
+			"secretKeyRef": map[string]any{"name": opts.name, "key": s.key},
+		}})
+	}
+	if len(secret) > 0 {
+		manifests = append(manifests, map[string]any{
+			"apiVersion": "v1", "kind": "Secret", "metadata": meta(opts.name, true),
+			"type": "Opaque", "stringData": secret,
+		})
+	}
+	if opts.kubernetes {
+		manifests = append(manifests, map[string]any{
+			"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRoleBinding", "metadata": meta(opts.name, false),
+			"roleRef":  map[string]any{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": opts.clusterRole},
+			"subjects": []any{map[string]any{"kind": "ServiceAccount", "name": opts.name, "namespace": opts.namespace}},
+		})
+		env = append(env, map[string]any{"name": "AGENT_KUBERNETES", "value": "true"})
+	}
+	if opts.tunnel {
+		env = append(env,
+			map[string]any{"name": "AGENT_TUNNEL_TARGET", "value": "https://kubernetes.default.svc"},
+			map[string]any{"name": "AGENT_TUNNEL_TOKEN_FILE", "value": serviceAccountDir + "/token"},
+			map[string]any{"name": "AGENT_TUNNEL_CA_FILE", "value": serviceAccountDir + "/ca.crt"},
+		)
+	}
+
+	selector := map[string]any{"app.kubernetes.io/name": opts.name}
+	spec := map[string]any{
+		"selector": map[string]any{"matchLabels": selector},
+		"template": map[string]any{
+			"metadata": map[string]any{"labels": labels},
+			"spec": map[string]any{
+				"serviceAccountName": opts.name,
+				"containers": []any{map[string]any{
+					"name":  "agent",
+					"image": opts.image,
+					"env":   env,
+					"resources": map[string]any{
+						"requests": map[string]any{"cpu": "50m", "memory": "64Mi"},
+						"limits":   map[string]any{"memory": "256Mi"},
+					},
+				}},
+			},
+		},
+	}
+	kind := "DaemonSet"
+	if opts.format == "deployment" {
+		kind = "Deployment"
+		spec["replicas"] = 1
+		// Two agents must not run for the same cluster at once.
+		spec["strategy"] = map[string]any{"type": "Recreate"}
+	}
+	return append(manifests, map[string]any{"apiVersion": "apps/v1", "kind": kind, "metadata": meta(opts.name, true), "spec": spec})
+}
+
+// cloneLabels copies labels, so that they can be changed.
+func cloneLabels(labels map[string]string) map[string]string {
+	c := make(map[string]string, len(labels)+1)
+	for key, value := range labels {
+		c[key] = value
+	}
+	return c
+}
+
+// toYAMLDocuments renders values as a stream of YAML documents.
+func toYAMLDocuments(values []map[string]any) ([]byte, error) {
+	var out []byte
+	for i, v := range values {
+		data, err := toYAML(v)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			out = append(out, "---\n"...)
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// agentInstallScript renders a shell script that installs the agent as a
+// systemd service on a host, with its configuration in an environment file
+// only root can read.
+func agentInstallScript(opts installOptions) string {
+	var env strings.Builder
+	for _, kv := range agentEnv(opts) {
+		fmt.Fprintf(&env, "%s=%s\n", kv[0], envFileQuote(kv[1]))
+	}
+	for _, s := range agentSecrets(opts) {
+		fmt.Fprintf(&env, "%s=%s\n", s.env, envFileQuote(s.value))
+	}
+	return fmt.Sprintf(`#!/bin/sh
+# Installs the edge orchestration agent as the systemd service %[1]s.
+# Run as root on the host, with the agent binary at %[2]s.
+set -eu
+
+if [ ! -x %[2]s ]; then
+	echo "The agent binary %[2]s is missing; build it from the agent module and copy it there." >&2
+	exit 1
+fi
+
+install -d -m 0700 /etc/%[1]s
+umask 077
+cat > /etc/%[1]s/env <<'EOF'
+%[3]sEOF
+
+cat > /etc/systemd/system/%[1]s.service <<'EOF'
+[Unit]
+Description=Edge orchestration agent
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+EnvironmentFile=/etc/%[1]s/env
+ExecStart=%[2]s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+EOF
+chmod 0644 /etc/systemd/system/%[1]s.service
+
+systemctl daemon-reload
+systemctl enable --now %[1]s.service
+echo "Agent installed; follow it with: journalctl -u %[1]s -f"
+`, opts.name, opts.binary, env.String())
+}
+
+// envFileQuote quotes a value for a systemd environment file.
+func envFileQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`).Replace(s) + `"`
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"edge-orchestration/client"
+)
+
+func handleKubernetesCmd(args []string) {
+	switch {
+	case len(args) >= 1 && args[0] == "list":
+		listCmd := flag.NewFlagSet("kubernetes list", flag.ExitOnError)
+		unmanaged := listCmd.Bool("unmanaged", false, "Only list Deployments no tool manages yet.")
+		listCmd.Parse(args[1:])
+		listKubernetesDeployments(*unmanaged)
+	case len(args) >= 2 && args[0] == "adopt":
+		adoptCmd := flag.NewFlagSet("kubernetes adopt", flag.ExitOnError)
+		agentID := adoptCmd.String("agent", "", "The agent that runs the workload from now on.")
+		project := adoptCmd.String("project", "", "The project the deployment belongs to.")
+		adoptCmd.Parse(args[2:])
+		namespace, name, found := strings.Cut(args[1], "/")
+		if !found || namespace == "" || name == "" || *agentID == "" {
+			fmt.Println("Usage: cctl kubernetes adopt <namespace>/<name> --agent <id> [--project <name>]")
+			os.Exit(exitInvalid)
+		}
+		adoptKubernetesDeployment(namespace, name, client.AdoptRequest{AgentID: *agentID, Project: *project})
+	default:
+		fmt.Println("Usage: cctl kubernetes list [--unmanaged]")
+		fmt.Println("       cctl kubernetes adopt <namespace>/<name> --agent <id> [--project <name>]")
+		os.Exit(exitInvalid)
+	}
+}
+
+// listKubernetesDeployments prints the Deployments in the cluster and the
+// deployments that adopted them.
+func listKubernetesDeployments(unmanaged bool) {
+	workloads, err := cc.ListKubernetesDeployments(context.Background(), unmanaged)
+	if err != nil {
+		fail(err, "Error: Failed to list Kubernetes Deployments")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tIMAGES\tREPLICAS\tMANAGED BY\tDEPLOYMENT")
+	for _, wl := range workloads {
+		managedBy, deployment := wl.ManagedBy, wl.DeploymentID
+		if managedBy == "" {
+			managedBy = "-"
+		}
+		if deployment == "" {
+			deployment = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", wl.Namespace, wl.Name, strings.Join(wl.Images, ","), wl.Replicas, managedBy, deployment)
+	}
+	w.Flush()
+}
+
+// adoptKubernetesDeployment places a Kubernetes Deployment's workload under
+// control center management.
+func adoptKubernetesDeployment(namespace, name string, req client.AdoptRequest) {
+	dep, err := cc.AdoptKubernetesDeployment(context.Background(), namespace, name, req)
+	if err != nil {
+		fail(err, "Error: Failed to adopt Kubernetes Deployment %s/%s", namespace, name)
+	}
+	fmt.Printf("Kubernetes Deployment %s/%s adopted as deployment %s (%s)\n", namespace, name, dep.ID, dep.Status)
+}
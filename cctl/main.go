@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -9,36 +9,283 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
-)
 
-const (
-	// Default control center address; can be overridden by the CONTROL_CENTER_ADDR environment variable.
-	defaultControlCenterAddress = "http://localhost:8080"
+	"edge-orchestration/client"
+
+	"gopkg.in/yaml.v3"
+
+	"strconv"
 )
 
-// Agent matches the structure defined in the control-center.
-type Agent struct {
-	ID       string    `json:"id"`
-	Address  string    `json:"address"`
-	LastSeen time.Time `json:"last_seen"`
-	Status   string    `json:"status"`
+// cc is the control center client, configured from the connection flags,
+// the environment, and the config file.
+var cc *client.Client
+
+// conn is how cc reaches the control center.
+var conn connection
+
+// configFlags collects repeated --config flags of the form
+// <name>[@<version>][:<mount-path>][:env]. A version pins the config.
+type configFlags []client.ConfigRef
+
+func (f *configFlags) String() string {
+	return fmt.Sprintf("%d configs", len(*f))
+}
+
+func (f *configFlags) Set(value string) error {
+	parts := strings.Split(value, ":")
+	ref := client.ConfigRef{Name: parts[0]}
+	if name, version, pinned := strings.Cut(parts[0], "@"); pinned {
+		n, err := strconv.Atoi(version)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid config version in %q: must be a positive number", value)
+		}
+		ref.Name, ref.Pin = name, n
+	}
+	for _, part := range parts[1:] {
+		switch {
+		case part == "env":
+			ref.Env = true
+		case strings.HasPrefix(part, "/") && ref.MountPath == "":
+			ref.MountPath = part
+		default:
+			return fmt.Errorf("expected <name>[@<version>][:<mount-path>][:env], got %q", value)
+		}
+	}
+	if ref.Name == "" || (ref.MountPath == "" && !ref.Env) {
+		return fmt.Errorf("expected <name>[@<version>][:<mount-path>][:env] with a mount path, env, or both, got %q", value)
+	}
+	*f = append(*f, ref)
+	return nil
+}
+
+// secretFlags collects repeated --secret flags of the form <name>[:<env>].
+type secretFlags []client.SecretRef
+
+func (f *secretFlags) String() string {
+	return fmt.Sprintf("%d secrets", len(*f))
+}
+
+func (f *secretFlags) Set(value string) error {
+	name, env, _ := strings.Cut(value, ":")
+	if name == "" {
+		return fmt.Errorf("expected <name>[:<env>], got %q", value)
+	}
+	*f = append(*f, client.SecretRef{Name: name, Env: env})
+	return nil
+}
+
+// addonFlags collects repeated --addon flags of the form
+// <type>[@<version>][:<name>][:<storage>], where storage is the size of a
+// persistent volume for the add-on's data, e.g. 10Gi.
+type addonFlags []client.Addon
+
+func (f *addonFlags) String() string {
+	return fmt.Sprintf("%d add-ons", len(*f))
+}
+
+func (f *addonFlags) Set(value string) error {
+	invalid := fmt.Errorf("expected <type>[@<version>][:<name>][:<storage>], got %q", value)
+	parts := strings.Split(value, ":")
+	var addon client.Addon
+	addon.Type, addon.Version, _ = strings.Cut(parts[0], "@")
+	if addon.Type == "" {
+		return invalid
+	}
+	// A storage size starts with a digit, a name with a letter.
+	for _, part := range parts[1:] {
+		switch {
+		case part == "" || addon.Storage != "":
+			return invalid
+		case part[0] >= '0' && part[0] <= '9':
+			addon.Storage = part
+		case addon.Name == "":
+			addon.Name = part
+		default:
+			return invalid
+		}
+	}
+	*f = append(*f, addon)
+	return nil
+}
+
+// egressFlags collects repeated --egress flags of the form
+// <host|cidr>[:<port>,...]. IPv6 addresses and networks with ports are
+// given in brackets, e.g. [2001:db8::/32]:443.
+type egressFlags []client.EgressRule
+
+func (f *egressFlags) String() string {
+	return fmt.Sprintf("%d egress rules", len(*f))
+}
+
+func (f *egressFlags) Set(value string) error {
+	dest, ports := value, ""
+	if rest, ok := strings.CutPrefix(value, "["); ok {
+		var found bool
+		if dest, ports, found = strings.Cut(rest, "]"); !found || ports != "" && ports[0] != ':' {
+			return fmt.Errorf("expected <host|cidr>[:<port>,...], got %q", value)
+		}
+		ports = strings.TrimPrefix(ports, ":")
+	} else if strings.Count(value, ":") == 1 {
+		dest, ports, _ = strings.Cut(value, ":")
+	}
+	var rule client.EgressRule
+	if strings.Contains(dest, "/") {
+		rule.CIDR = dest
+	} else {
+		rule.Host = dest
+	}
+	if ports != "" {
+		for _, p := range strings.Split(ports, ",") {
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				return fmt.Errorf("invalid port %q in %q", p, value)
+			}
+			rule.Ports = append(rule.Ports, port)
+		}
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+// hookFlags collects repeated --pre-hook or --post-hook flags of the form
+// <name>=<webhook-url> or <name>=job:<image>.
+type hookFlags struct {
+	phase string
+	hooks *[]client.RolloutHook
+}
+
+func (f hookFlags) String() string {
+	if f.hooks == nil {
+		return "0 hooks"
+	}
+	return fmt.Sprintf("%d hooks", len(*f.hooks))
+}
+
+func (f hookFlags) Set(value string) error {
+	name, target, found := strings.Cut(value, "=")
+	if !found || name == "" || target == "" {
+		return fmt.Errorf("expected <name>=<webhook-url> or <name>=job:<image>, got %q", value)
+	}
+	hook := client.RolloutHook{Name: name, Phase: f.phase}
+	if image, ok := strings.CutPrefix(target, "job:"); ok {
+		hook.Job = &client.HookJob{Image: image}
+	} else {
+		hook.Webhook = target
+	}
+	*f.hooks = append(*f.hooks, hook)
+	return nil
+}
+
+// volumeFlags collects repeated --volume flags of the form
+// <name>:<mount-path>:<type>[:<arg>][:ro], where type is pvc (arg is the size,
+// optionally followed by @<storage-class>), hostpath (arg is the host path),
+// or emptydir (arg is an optional size limit).
+type volumeFlags []client.Volume
+
+func (f *volumeFlags) String() string {
+	return fmt.Sprintf("%d volumes", len(*f))
 }
 
-// Deployment matches the structure defined in the control-center.
-type Deployment struct {
-	ID        string    `json:"id"`
-	AgentID   string    `json:"agent_id"`
-	ImageURL  string    `json:"image_url"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+func (f *volumeFlags) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 3 {
+		return fmt.Errorf("expected <name>:<mount-path>:<type>[:<arg>][:ro], got %q", value)
+	}
+	v := client.Volume{Name: parts[0], MountPath: parts[1]}
+	if last := parts[len(parts)-1]; len(parts) > 3 && last == "ro" {
+		v.ReadOnly = true
+		parts = parts[:len(parts)-1]
+	}
+	arg := ""
+	if len(parts) == 4 {
+		arg = parts[3]
+	} else if len(parts) > 4 {
+		return fmt.Errorf("too many fields in volume %q", value)
+	}
+	switch parts[2] {
+	case "pvc":
+		size, class, _ := strings.Cut(arg, "@")
+		if size == "" {
+			return fmt.Errorf("volume %s: pvc needs a size, e.g. %s:%s:pvc:20Gi", v.Name, v.Name, v.MountPath)
+		}
+		v.PVC = &client.PVCSource{Size: size, StorageClass: class}
+	case "hostpath":
+		if arg == "" {
+			return fmt.Errorf("volume %s: hostpath needs a path", v.Name)
+		}
+		v.HostPath = &client.HostPathSource{Path: arg}
+	case "emptydir":
+		v.EmptyDir = &client.EmptyDirSource{SizeLimit: arg}
+	default:
+		return fmt.Errorf("volume %s: unknown type %q, must be pvc, hostpath, or emptydir", v.Name, parts[2])
+	}
+	*f = append(*f, v)
+	return nil
 }
 
 func main() {
+	// --break-glass and -v apply to every command, so they may be given
+	// anywhere. Connection flags go before the command, since some commands
+	// have flags of the same name, such as agents install --token.
+	var opts []client.Option
+	flags := map[string]string{}
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		if os.Args[i] == "-v" || os.Args[i] == "--debug" {
+			// Traces go to stderr so that they do not mix with output
+			// meant for pipes, such as manifests.
+			trace := log.New(os.Stderr, "debug: ", log.Ltime|log.Lmicroseconds)
+			opts = append(opts, client.WithTrace(trace.Printf))
+			continue
+		}
+		if os.Args[i] == "--break-glass" && i+1 < len(os.Args) {
+			opts = append(opts, client.WithBreakGlass(os.Args[i+1]))
+			i++
+			continue
+		}
+		if justification, ok := strings.CutPrefix(os.Args[i], "--break-glass="); ok {
+			opts = append(opts, client.WithBreakGlass(justification))
+			continue
+		}
+		if len(args) == 1 {
+			next, hasNext := "", i+1 < len(os.Args)
+			if hasNext {
+				next = os.Args[i+1]
+			}
+			if name, value, ok, tookNext := connectionFlag(os.Args[i], next, hasNext); ok {
+				flags[name] = value
+				if tookNext {
+					i++
+				}
+				continue
+			}
+		}
+		args = append(args, os.Args[i])
+	}
+	os.Args = args
+	var err error
+	if conn, err = resolveConnection(flags); err != nil {
+		failInvalid("Error: %v", err)
+	}
+	connOpts, err := conn.options()
+	if err != nil {
+		failInvalid("Error: %v", err)
+	}
+	opts = append(connOpts, opts...)
+	opts = append(opts, client.WithDeprecationHandler(func(d client.Deprecation) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", d)
+	}))
+	cc = client.New(conn.server, opts...)
+
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitInvalid)
 	}
 
 	switch os.Args[1] {
@@ -46,74 +293,621 @@ func main() {
 		handleAgentsCmd(os.Args[2:])
 	case "deploy":
 		handleDeployCmd(os.Args[2:])
+	case "quotas":
+		handleQuotasCmd(os.Args[2:])
+	case "configs":
+		handleConfigsCmd(os.Args[2:])
+	case "registries":
+		handleRegistriesCmd(os.Args[2:])
+	case "bundles":
+		handleBundlesCmd(os.Args[2:])
+	case "fleets":
+		handleFleetsCmd(os.Args[2:])
+	case "rollouts":
+		handleRolloutsCmd(os.Args[2:])
+	case "approve":
+		handleApproveCmd(os.Args[2:])
+	case "freezes":
+		handleFreezesCmd(os.Args[2:])
+	case "channels":
+		handleChannelsCmd(os.Args[2:])
+	case "costs":
+		handleCostsCmd(os.Args[2:])
+	case "slos":
+		handleSLOsCmd(os.Args[2:])
+	case "endpoints":
+		handleEndpointsCmd(os.Args[2:])
+	case "shadows":
+		handleShadowsCmd(os.Args[2:])
+	case "kubernetes":
+		handleKubernetesCmd(os.Args[2:])
+	case "cluster":
+		handleClusterCmd(os.Args[2:])
+	case "bootstrap-tokens":
+		handleBootstrapTokensCmd(os.Args[2:])
+	case "port-forward":
+		handlePortForwardCmd(os.Args[2:])
+	case "gpus":
+		handleGPUsCmd(os.Args[2:])
+	case "secrets":
+		handleSecretsCmd(os.Args[2:])
+	case "usage":
+		handleUsageCmd(os.Args[2:])
+	case "alerts":
+		handleAlertsCmd(os.Args[2:])
+	case "deployments":
+		handleDeploymentsCmd(os.Args[2:])
+	case "admin":
+		handleAdminCmd(os.Args[2:])
+	case "export":
+		handleExportCmd(os.Args[2:])
+	case "import":
+		handleImportCmd(os.Args[2:])
 	default:
 		fmt.Printf("Unknown command: %s\n", os.Args[1])
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitInvalid)
 	}
 }
 
 func handleAgentsCmd(args []string) {
-	if len(args) < 1 || args[0] != "list" {
-		fmt.Println("Usage: cctl agents list")
-		os.Exit(1)
+	switch {
+	case len(args) >= 1 && args[0] == "list":
+		listCmd := flag.NewFlagSet("agents list", flag.ExitOnError)
+		archived := listCmd.Bool("archived", false, "Include deleted agents.")
+		selector := listCmd.String("selector", "", "Only list agents with these labels, e.g. arch=arm64,site=store-104.")
+		listCmd.Parse(args[1:])
+		listAgents(*archived, parseSelector(*selector))
+	case len(args) == 2 && args[0] == "delete":
+		deleteAgent(args[1])
+	case len(args) >= 2 && args[0] == "rewrite-images":
+		rules := []client.ImageRewrite{}
+		for _, arg := range args[2:] {
+			from, to, ok := strings.Cut(arg, "=")
+			if !ok {
+				failInvalid("Invalid image rewrite %q: expected <from>=<to>", arg)
+			}
+			rules = append(rules, client.ImageRewrite{From: from, To: to})
+		}
+		setImageRewrites(args[1], rules)
+	case len(args) >= 2 && args[0] == "cordon":
+		cordonCmd := flag.NewFlagSet("agents cordon", flag.ExitOnError)
+		reason := cordonCmd.String("reason", "", "Why the agent is in maintenance.")
+		queue := cordonCmd.Bool("queue", false, "Queue new deployments until the agent is uncordoned instead of rejecting them.")
+		cordonCmd.Parse(args[2:])
+		cordonAgent(args[1], *reason, *queue)
+	case len(args) == 2 && args[0] == "uncordon":
+		uncordonAgent(args[1])
+	case len(args) == 2 && args[0] == "queue":
+		showAdmissionQueue(args[1])
+	case len(args) >= 1 && args[0] == "install":
+		handleInstallCmd(args[1:])
+	case len(args) >= 3 && args[0] == "proxy":
+		proxyCmd := flag.NewFlagSet("agents proxy", flag.ExitOnError)
+		method := proxyCmd.String("method", http.MethodGet, "HTTP method of the request.")
+		data := proxyCmd.String("data", "", "File with the JSON request body, or - for standard input.")
+		proxyCmd.Parse(args[3:])
+		proxyToAgent(args[1], *method, args[2], *data)
+	case len(args) >= 2 && args[0] == "set-prices":
+		pricesCmd := flag.NewFlagSet("agents set-prices", flag.ExitOnError)
+		cpu := pricesCmd.Float64("cpu", 0, "Price per CPU core and hour.")
+		memory := pricesCmd.Float64("memory", 0, "Price per GiB of memory and hour.")
+		gpu := pricesCmd.Float64("gpu", 0, "Price per GPU and hour.")
+		pricesCmd.Parse(args[2:])
+		setAgentPrices(args[1], client.Prices{CPU: *cpu, Memory: *memory, GPU: *gpu})
+	case len(args) == 2 && args[0] == "clear-prices":
+		clearAgentPrices(args[1])
+	default:
+		fmt.Println("Usage: cctl agents list [--archived] [--selector <key>=<value>,...]")
+		fmt.Println("       cctl agents delete <id>")
+		fmt.Println("       cctl agents rewrite-images <id> [<from>=<to>]...")
+		fmt.Println("       cctl agents cordon <id> [--reason <text>] [--queue]")
+		fmt.Println("       cctl agents uncordon <id>")
+		fmt.Println("       cctl agents queue <id>")
+		fmt.Println("       cctl agents install [--format deployment|daemonset|systemd] [--addr <url>] [--token <token>] [--bootstrap-token <token>] [--labels <key>=<value>,...]")
+		fmt.Println("       cctl agents proxy <id> <path> [--method <method>] [--data <file>]")
+		fmt.Println("       cctl agents set-prices <id> [--cpu <price>] [--memory <price>] [--gpu <price>]")
+		fmt.Println("       cctl agents clear-prices <id>")
+		os.Exit(exitInvalid)
 	}
-	listAgents()
+}
+
+func handleDeploymentsCmd(args []string) {
+	if len(args) == 3 && args[0] == "set-image" {
+		setDeploymentImage(args[1], args[2])
+		return
+	}
+	if len(args) == 2 && args[0] == "sandbox" {
+		showSandbox(args[1])
+		return
+	}
+	if len(args) == 2 && args[0] == "manifest" {
+		showManifest(args[1])
+		return
+	}
+	if len(args) < 2 || (args[0] != "describe" && args[0] != "cancel" && args[0] != "pause" && args[0] != "resume" && args[0] != "delete" && args[0] != "promote") {
+		fmt.Println("Usage: cctl deployments describe|cancel|pause|resume|delete|promote <id>")
+		fmt.Println("       cctl deployments set-image <id> <image>")
+		fmt.Println("       cctl deployments sandbox <id>")
+		fmt.Println("       cctl deployments manifest <id>")
+		os.Exit(exitInvalid)
+	}
+	switch args[0] {
+	case "cancel":
+		cancelDeployment(args[1])
+	case "pause":
+		pauseDeployment(args[1])
+	case "resume":
+		resumeDeployment(args[1])
+	case "delete":
+		deleteDeployment(args[1])
+	case "promote":
+		promoteDeployment(args[1])
+	default:
+		describeDeployment(args[1])
+	}
+}
+
+// artifactFlags collects repeated --artifact flags of the form
+// <name>:<mount-path>:<sha256>:<source>.
+type artifactFlags []client.Artifact
+
+func (f *artifactFlags) String() string {
+	return fmt.Sprintf("%d artifacts", len(*f))
+}
+
+func (f *artifactFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) < 4 {
+		return fmt.Errorf("expected <name>:<mount-path>:<sha256>:<source>, got %q", value)
+	}
+	*f = append(*f, client.Artifact{Name: parts[0], MountPath: parts[1], SHA256: parts[2], Source: parts[3]})
+	return nil
 }
 
 func handleDeployCmd(args []string) {
 	deployCmd := flag.NewFlagSet("deploy", flag.ExitOnError)
 	agentID := deployCmd.String("agent", "", "The ID of the agent to deploy to.")
+	fleet := deployCmd.String("fleet", "", "The name of a fleet to deploy to every agent of, instead of --agent.")
+	selector := deployCmd.String("selector", "", "Deploy to every agent with these labels, e.g. arch=arm64,site=store-104; with --agent or --fleet, labels the agents must have.")
 	imageURL := deployCmd.String("image", "", "The URL of the container image to deploy.")
+	bundle := deployCmd.String("bundle", "", "The ID of a bundle to load the image from, for agents without registry access.")
+	autoUpdate := deployCmd.Bool("auto-update", false, "Redeploy automatically when the image is pushed to its registry.")
+	project := deployCmd.String("project", "", "The project the deployment belongs to.")
+	cpu := deployCmd.String("cpu", "", "Requested CPU, e.g. 500m or 2.")
+	memory := deployCmd.String("memory", "", "Requested memory, e.g. 512Mi or 4Gi.")
+	gpu := deployCmd.Int("gpu", 0, "Requested number of GPUs.")
+	gpuModel := deployCmd.String("gpu-model", "", "With --gpu, only run on GPUs of this model, e.g. \"NVIDIA L4\".")
+	var volumes volumeFlags
+	deployCmd.Var(&volumes, "volume", "Volume to mount as <name>:<mount-path>:<type>[:<arg>][:ro]; may be repeated.")
+	var artifacts artifactFlags
+	deployCmd.Var(&artifacts, "artifact", "File to download and mount read-only as <name>:<mount-path>:<sha256>:<source>; may be repeated.")
+	var configs configFlags
+	deployCmd.Var(&configs, "config", "Config to mount or inject as <name>[@<version>][:<mount-path>][:env]; may be repeated.")
+	var secrets secretFlags
+	deployCmd.Var(&secrets, "secret", "Secret to inject as <name>[:<env>]; the env defaults to the provider's, e.g. OPENAI_API_KEY. May be repeated.")
+	var addons addonFlags
+	deployCmd.Var(&addons, "addon", "Add-on to run next to the deployment as <type>[@<version>][:<name>][:<storage>], e.g. redis or qdrant:vectors:10Gi; may be repeated.")
+	sandbox := deployCmd.Bool("sandbox", false, "Only let the workload reach DNS, its add-ons, and the destinations given with --egress.")
+	var egress egressFlags
+	deployCmd.Var(&egress, "egress", "Sandbox the workload and let it reach <host|cidr>[:<port>,...], e.g. api.openai.com:443; may be repeated.")
+	seccomp := deployCmd.String("seccomp", "", "Sandbox the workload with this seccomp profile: runtime/default (the default), unconfined, or localhost/<profile>.")
+	apparmor := deployCmd.String("apparmor", "", "Sandbox the workload with this AppArmor profile: runtime/default (the default), unconfined, or localhost/<profile>.")
+	ttl := deployCmd.Duration("ttl", 0, "Tear the deployment down after this long, e.g. 2h.")
+	rescheduleAfter := deployCmd.Duration("reschedule-after", 0, "With --selector, move each deployment to another matching agent once its agent has been unreachable this long, e.g. 15m.")
+	at := deployCmd.String("at", "", "Defer the deployment until this RFC 3339 time, or for this long, e.g. 2026-12-24T02:00:00Z or 6h.")
+	schedule := deployCmd.String("schedule", "", "Redeploy on this cron schedule, e.g. \"0 3 * * 0\" or @daily.")
+	timezone := deployCmd.String("timezone", "", "IANA time zone of --schedule, e.g. Europe/Berlin; defaults to the agent's.")
+	channel := deployCmd.String("channel", "", "Follow the images a release channel publishes for the repository of --image, e.g. stable.")
+	updatePolicy := deployCmd.String("update-policy", "", "Update to newer patch, minor, or major releases of the --image version tag.")
+	model := deployCmd.String("model", "", "Serve this model, e.g. meta-llama/Llama-3.1-8B-Instruct; --image defaults to the server's image.")
+	modelServer := deployCmd.String("model-server", "", "With --model, the inference server: vllm (the default) or tgi.")
+	quantization := deployCmd.String("quantization", "", "With --model, the quantization method, e.g. awq, gptq, or fp8.")
+	maxContext := deployCmd.Int("max-context-length", 0, "With --model, the maximum tokens of prompt and completion.")
+	shadow := deployCmd.String("shadow", "", "With --model, only receive copies of the gateway's requests for this model, e.g. the one --model would replace.")
+	shadowPercent := deployCmd.Int("shadow-percent", 0, "With --shadow, the percentage of requests to copy; defaults to 100.")
+	slo := deployCmd.Float64("slo", 0, "Availability objective in percent, e.g. 99.5.")
+	sloWindow := deployCmd.String("slo-window", "", "With --slo, the rolling window it is computed over, e.g. 7d; defaults to 30d.")
+	channelStrategy := deployCmd.String("channel-strategy", "", "With --channel, deploy releases immediate (the default), scheduled with --schedule, or manual.")
+	waves := deployCmd.String("waves", "", "With --fleet, roll out in waves of cumulative agent counts or percentages, e.g. 1,10%,50%,100%.")
+	maxFailure := deployCmd.Int("max-failure-percent", 0, "With --waves, halt the rollout once more than this percentage of its deployments failed.")
+	rollback := deployCmd.Bool("rollback", false, "With --waves, delete the rollout's deployments when it halts.")
+	approveBefore := deployCmd.String("approve-before", "", "With --waves, waves (numbered from 1) that wait for `cctl approve` before they start, e.g. 2,3.")
+	var hooks []client.RolloutHook
+	deployCmd.Var(hookFlags{"pre", &hooks}, "pre-hook", "With --waves, run <name>=<webhook-url> or <name>=job:<image> before each wave deploys; may be repeated.")
+	deployCmd.Var(hookFlags{"post", &hooks}, "post-hook", "With --waves, run <name>=<webhook-url> or <name>=job:<image> after each wave deployed; may be repeated.")
+	abortOnHookFailure := deployCmd.Bool("abort-on-hook-failure", false, "With --pre-hook or --post-hook, halt the rollout when one of them fails.")
+	specPath := deployCmd.String("f", "", "A JSON or YAML deployment spec template, or a directory of them, to submit as one batch.")
+	targetsPath := deployCmd.String("from-file", "", "A CSV file of deployments to submit in batches, one per row, with a header row naming its columns, e.g. agent,image,project.")
+	var valueFiles, sets listFlags
+	deployCmd.Var(&valueFiles, "values", "With -f, a YAML file of values to render the specs with; may be repeated, later files override earlier ones.")
+	deployCmd.Var(&sets, "set", "With -f, set a value to render the specs with as <key>[.<key>]...=<value>, overriding --values; may be repeated.")
+	dryRun := deployCmd.Bool("dry-run", false, "Check the request and print the Kubernetes manifests it would create, without deploying.")
+	wait := deployCmd.Bool("wait", false, "Show the deployments' progress until they are running or failed, or the rollout finished.")
+	noColor := deployCmd.Bool("no-color", false, "With --wait, do not color the progress display.")
 	deployCmd.Parse(args)
 
-	if *agentID == "" || *imageURL == "" {
-		fmt.Println("Error: --agent and --image flags are required for deploy command.")
+	if *specPath != "" || *targetsPath != "" {
+		var specs []batchSpec
+		if *specPath != "" && *targetsPath != "" {
+			failInvalid("-f and --from-file cannot be combined")
+		} else if *targetsPath != "" {
+			specs = readTargets(*targetsPath)
+		} else {
+			values, err := specValues(valueFiles, sets)
+			if err != nil {
+				failInvalid("Error: %v", err)
+			}
+			specs = readSpecs(*specPath, values)
+		}
+		created := deployBatch(specs)
+		if *wait {
+			fmt.Println()
+			waitForDeployments(created, *noColor)
+		}
+		return
+	}
+	if (*agentID != "" && *fleet != "") || (*agentID == "" && *fleet == "" && *selector == "") || (*imageURL == "" && *bundle == "" && *model == "") {
+		fmt.Println("Error: --agent, --fleet, or --selector and --image, --bundle, or --model flags are required for deploy command.")
 		deployCmd.Usage()
-		os.Exit(1)
+		os.Exit(exitInvalid)
+	}
+	if *ttl < 0 || *ttl%time.Second != 0 {
+		failInvalid("--ttl must be a positive whole number of seconds, e.g. 90s or 2h")
 	}
-	deployWorkload(*agentID, *imageURL)
-}
 
-func printUsage() {
-	fmt.Println("Usage: cctl <command> [arguments]")
-	fmt.Println("\nCommands:")
-	fmt.Println("  agents list          List all registered agents")
-	fmt.Println("  deploy               Deploy a new workload to an agent")
-	fmt.Println("\nDeploy arguments:")
-	fmt.Println("  --agent <id>         ID of the agent")
-	fmt.Println("  --image <url>        URL of the container image")
+	req := client.DeploymentRequest{
+		AgentID:         *agentID,
+		AgentSelector:   parseSelector(*selector),
+		ImageURL:        *imageURL,
+		AutoUpdate:      *autoUpdate,
+		Project:         *project,
+		Volumes:         volumes,
+		Artifacts:       artifacts,
+		Configs:         configs,
+		Secrets:         secrets,
+		Addons:          addons,
+		TTLSeconds:      int(*ttl / time.Second),
+		Bundle:          *bundle,
+		Schedule:        *schedule,
+		Timezone:        *timezone,
+		Channel:         *channel,
+		ChannelStrategy: *channelStrategy,
+		UpdatePolicy:    *updatePolicy,
+	}
+	if *rescheduleAfter != 0 {
+		req.RescheduleAfter = rescheduleAfter.String()
+	}
+	if *at != "" {
+		if t, err := time.Parse(time.RFC3339, *at); err == nil {
+			req.ScheduleAt = &t
+		} else if d, err := time.ParseDuration(*at); err == nil && d > 0 {
+			t := time.Now().Add(d).UTC()
+			req.ScheduleAt = &t
+		} else {
+			failInvalid("--at must be an RFC 3339 time or a positive duration, e.g. 6h")
+		}
+	}
+	if *cpu != "" || *memory != "" || *gpu != 0 || *gpuModel != "" {
+		req.Resources = &client.Resources{CPU: *cpu, Memory: *memory, GPU: *gpu, GPUModel: *gpuModel}
+	}
+	if *model != "" {
+		req.ModelServing = &client.ModelServing{Server: *modelServer, Model: *model, Quantization: *quantization, GPUs: *gpu, MaxContextLength: *maxContext}
+		if *shadow != "" {
+			req.ModelServing.Shadow = &client.Shadow{Model: *shadow, Percent: *shadowPercent}
+		}
+	}
+	if *slo != 0 || *sloWindow != "" {
+		req.SLO = &client.SLO{Target: *slo, Window: *sloWindow}
+	}
+	if *sandbox || len(egress) > 0 || *seccomp != "" || *apparmor != "" {
+		req.Sandbox = &client.Sandbox{Egress: egress, Seccomp: *seccomp, AppArmor: *apparmor}
+	}
+	if *dryRun {
+		if *agentID == "" {
+			failInvalid("--dry-run requires --agent")
+		}
+		dryRunWorkload(req)
+		return
+	}
+	if *fleet != "" && (*waves != "" || *maxFailure != 0 || *rollback || *approveBefore != "" || len(hooks) > 0) {
+		for i := range hooks {
+			hooks[i].AbortOnFailure = *abortOnHookFailure
+		}
+		rollout := client.RolloutRequest{Deployment: req, MaxFailurePercent: *maxFailure, Rollback: *rollback, Hooks: hooks}
+		if *waves != "" {
+			rollout.Waves = strings.Split(*waves, ",")
+		}
+		for _, n := range strings.Split(*approveBefore, ",") {
+			if n == "" {
+				continue
+			}
+			wave, err := strconv.Atoi(n)
+			if err != nil {
+				failInvalid("--approve-before takes wave numbers, e.g. 2,3; got %q", n)
+			}
+			rollout.ApproveBefore = append(rollout.ApproveBefore, wave)
+		}
+		id := startRollout(*fleet, rollout)
+		if *wait {
+			waitForRollout(id, *noColor)
+		}
+		return
+	}
+	var created []string
+	switch {
+	case *fleet != "":
+		created = deployToFleet(*fleet, req)
+	case *agentID == "":
+		created = deployToSelector(req)
+	default:
+		created = []string{deployWorkload(req)}
+	}
+	if *wait {
+		fmt.Println()
+		waitForDeployments(created, *noColor)
+	}
 }
 
-func deployWorkload(agentID, imageURL string) {
-	addr := os.Getenv("CONTROL_CENTER_ADDR")
-	if addr == "" {
-		addr = defaultControlCenterAddress
+func handleQuotasCmd(args []string) {
+	if len(args) < 1 || args[0] != "list" {
+		fmt.Println("Usage: cctl quotas list")
+		os.Exit(exitInvalid)
 	}
+	listQuotas()
+}
 
-	deployData := map[string]string{
-		"agent_id":  agentID,
-		"image_url": imageURL,
+func handleConfigsCmd(args []string) {
+	usage := "Usage: cctl configs list | get <name>[@<version>] | versions <name> | set <name> [--batch-size <n>] <key>=<value>... | rollout <name> | delete <name>"
+	if len(args) < 1 {
+		fmt.Println(usage)
+		os.Exit(exitInvalid)
 	}
-	jsonData, err := json.Marshal(deployData)
-	if err != nil {
-		log.Fatalf("Failed to marshal deployment data: %v", err)
+	switch {
+	case args[0] == "list":
+		listConfigs()
+	case args[0] == "get" && len(args) == 2:
+		getConfig(args[1])
+	case args[0] == "versions" && len(args) == 2:
+		listConfigVersions(args[1])
+	case args[0] == "rollout" && len(args) == 2:
+		showConfigRollout(args[1])
+	case args[0] == "set" && len(args) >= 2:
+		setCmd := flag.NewFlagSet("configs set", flag.ExitOnError)
+		batchSize := setCmd.Int("batch-size", 0, "Redeploy this many deployments using the config at a time; 0 redeploys them all at once.")
+		setCmd.Parse(args[2:])
+		data := make(map[string]string)
+		for _, pair := range setCmd.Args() {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				failInvalid("Expected <key>=<value>, got %q", pair)
+			}
+			data[key] = value
+		}
+		setConfig(args[1], data, *batchSize)
+	case args[0] == "delete" && len(args) == 2:
+		deleteConfig(args[1])
+	default:
+		fmt.Println(usage)
+		os.Exit(exitInvalid)
 	}
+}
 
-	resp, err := http.Post(fmt.Sprintf("%s/api/v1/deployments", addr), "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Fatalf("Failed to send deployment request: %v", err)
+func handleRegistriesCmd(args []string) {
+	if len(args) < 1 || args[0] != "list" {
+		fmt.Println("Usage: cctl registries list")
+		os.Exit(exitInvalid)
 	}
-	defer resp.Body.Close()
+	listRegistries()
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		log.Fatalf("Deployment request failed with status %d: %s", resp.StatusCode, string(body))
+func handleAdminCmd(args []string) {
+	switch {
+	case len(args) == 2 && args[0] == "backup":
+		backup(args[1])
+	case len(args) == 2 && args[0] == "restore":
+		restore(args[1])
+	case len(args) == 1 && args[0] == "api-versions":
+		listAPIVersions()
+	default:
+		fmt.Println("Usage: cctl admin backup|restore <file>")
+		fmt.Println("       cctl admin api-versions")
+		os.Exit(exitInvalid)
 	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: cctl <command> [arguments]")
+	fmt.Println("\nCommands:")
+	fmt.Println("  agents list [--archived] [--selector <key>=<value>,...]")
+	fmt.Println("                       List registered agents and their labels, optionally including deleted ones or only those with some labels")
+	fmt.Println("  agents delete <id>   Archive an agent that has no active deployments")
+	fmt.Println("  agents rewrite-images <id> [<from>=<to>]...")
+	fmt.Println("                       Pull the agent's images below <from> from <to>, e.g. docker.io=mirror.local:5000")
+	fmt.Println("  agents cordon <id> [--reason <text>] [--queue]")
+	fmt.Println("                       Put an agent in maintenance, rejecting or queueing new deployments")
+	fmt.Println("  agents uncordon <id> Take an agent out of maintenance")
+	fmt.Println("  agents queue <id>    Show the deployments waiting for admission to an agent, in order")
+	fmt.Println("  agents install [--format deployment|daemonset|systemd] [--addr <url>] [--token <token>] [--bootstrap-token <token>] [--labels <key>=<value>,...]")
+	fmt.Println("                       Print Kubernetes manifests or a systemd install script that run an agent")
+	fmt.Println("  agents proxy <id> <path> [--method <method>] [--data <file>]")
+	fmt.Println("                       Call the API of an agent's cluster through its reverse tunnel, e.g. /api/v1/namespaces")
+	fmt.Println("  agents set-prices <id> [--cpu <price>] [--memory <price>] [--gpu <price>]")
+	fmt.Println("                       Price an agent's resources per hour for cost reports")
+	fmt.Println("  agents clear-prices <id>")
+	fmt.Println("                       Price an agent's resources at the control center's defaults")
+	fmt.Println("  deploy               Deploy a new workload to an agent, or to every agent of a fleet with --fleet")
+	fmt.Println("  deployments describe <id>")
+	fmt.Println("                       Show a deployment and its event timeline")
+	fmt.Println("  deployments cancel <id>")
+	fmt.Println("                       Cancel a deployment its agent has not started yet")
+	fmt.Println("  deployments pause <id>")
+	fmt.Println("                       Stop a deployment's workload, keeping its spec and history")
+	fmt.Println("  deployments resume <id>")
+	fmt.Println("                       Redeploy a paused deployment")
+	fmt.Println("  deployments delete <id>")
+	fmt.Println("                       Tear down and archive a deployment")
+	fmt.Println("  deployments set-image <id> <image>")
+	fmt.Println("                       Redeploy a deployment with a new image")
+	fmt.Println("  deployments promote <id>")
+	fmt.Println("                       Make a shadow deployment serve requests")
+	fmt.Println("  deployments sandbox <id>")
+	fmt.Println("                       Print the NetworkPolicy and pod annotations that enforce a deployment's sandbox")
+	fmt.Println("  deployments manifest <id>")
+	fmt.Println("                       Print the Kubernetes manifests that run a deployment")
+	fmt.Println("  port-forward <deployment-id> [<local-port>:]<remote-port>... [--address <ip>]")
+	fmt.Println("                       Forward local ports to a pod of a deployment through the control center")
+	fmt.Println("  quotas list          List quotas and their usage")
+	fmt.Println("  costs [--project <name>] [--agent <id>]")
+	fmt.Println("                       Estimate what deployments and projects cost")
+	fmt.Println("  slos [--project <name>] [--agent <id>]")
+	fmt.Println("                       Show how deployments with an SLO comply with it and burn their error budget")
+	fmt.Println("  endpoints            List the model endpoints the inference gateway routes to")
+	fmt.Println("  shadows              Compare shadow deployments with the deployments serving the requests mirrored to them")
+	fmt.Println("  gpus                 List the GPUs agents reported and how many are free")
+	fmt.Println("  kubernetes list [--unmanaged]")
+	fmt.Println("                       List the Deployments in the operator's cluster and the deployments that adopted them")
+	fmt.Println("  kubernetes adopt <namespace>/<name> --agent <id>")
+	fmt.Println("                       Place a Kubernetes Deployment's workload under control center management")
+	fmt.Println("  cluster apply|delete <agent-id> (-f <file> | --deployment <id>) [--namespace <name>] [--wait]")
+	fmt.Println("                       Have an agent apply or delete Kubernetes objects in its cluster")
+	fmt.Println("  cluster operations <agent-id>")
+	fmt.Println("                       List the operations sent to an agent's cluster and their status")
+	fmt.Println("  cluster operation <agent-id> <operation-id>")
+	fmt.Println("                       Show what became of each object of an operation")
+	fmt.Println("  bootstrap-tokens create [--ttl <duration>] [--max-uses <n>] [--labels <key>=<value>,...]")
+	fmt.Println("                       Issue a token agents register themselves with, e.g. from install manifests")
+	fmt.Println("  bootstrap-tokens list|delete <id>")
+	fmt.Println("                       List or revoke bootstrap tokens")
+	fmt.Println("  usage [--project <name>] [--agent <id>] [--since <time|duration>]")
+	fmt.Println("                       Report the inference requests and tokens of deployments and projects")
+	fmt.Println("  alerts list|rules|set-rule|delete-rule")
+	fmt.Println("                       Manage alert rules on deployment and agent health and list their alerts")
+	fmt.Println("  registries list      Show the health of registries that failed recently")
+	fmt.Println("  fleets list|get|set|delete")
+	fmt.Println("                       Manage named groups of agents")
+	fmt.Println("  rollouts list|get    Show the progress of fleet rollouts started with deploy --fleet --waves")
+	fmt.Println("  approve <rollout-id> [--comment <text>]")
+	fmt.Println("                       Start the rollout wave awaiting approval; CONTROL_CENTER_TOKEN identifies the approver")
+	fmt.Println("  freezes list|get|create|delete")
+	fmt.Println("                       Manage freeze windows that block deployment changes")
+	fmt.Println("  channels list|get|publish|delete")
+	fmt.Println("                       Publish images to release channels that deployments follow")
+	fmt.Println("  bundles list|create|delete")
+	fmt.Println("                       Manage signed image bundles for agents without registry access")
+	fmt.Println("  configs list|get|versions|set|rollout|delete")
+	fmt.Println("                       Manage configs that deployments mount or inject")
+	fmt.Println("  secrets list|create|rotate|rollout|delete")
+	fmt.Println("                       Manage provider API keys and other secrets; values are read from stdin")
+	fmt.Println("  admin backup <file>  Save a snapshot of the control center's state")
+	fmt.Println("  admin restore <file> Replace the control center's state with a snapshot")
+	fmt.Println("  admin api-versions   List the API versions the control center serves and when old ones are sunset")
+	fmt.Println("  export [-o <file>]   Export configs, quotas, policies, applications, and deployments as YAML")
+	fmt.Println("  import [--agent <old-id>=<new-id>]... <file>")
+	fmt.Println("                       Create the resources of an export")
+	fmt.Println("\nGlobal arguments:")
+	fmt.Println("  --server <address>   Address of the control center, or unix://<path> for its Unix socket")
+	fmt.Println("                       (default $CONTROL_CENTER_ADDR, then " + client.DefaultAddress + ")")
+	fmt.Println("  --token <token>      Bearer token to send (default $CONTROL_CENTER_TOKEN)")
+	fmt.Println("  --timeout <duration> Time limit for each call, e.g. 30s (default $CONTROL_CENTER_TIMEOUT, then none)")
+	fmt.Println("  --certificate-authority <file>")
+	fmt.Println("                       PEM file of the CAs to verify the control center with (default $CONTROL_CENTER_CA_FILE)")
+	fmt.Println("  --insecure-skip-tls-verify")
+	fmt.Println("                       Do not verify the control center's certificate; only for testing")
+	fmt.Println("                       (default $CONTROL_CENTER_INSECURE_SKIP_TLS_VERIFY)")
+	fmt.Println("  --retries <n>        Retries of calls that fail transiently and are safe to repeat, 0 for none")
+	fmt.Println("                       (default $CONTROL_CENTER_RETRIES, then 3)")
+	fmt.Println("  --retry-backoff <duration>")
+	fmt.Println("                       Wait before the first retry, doubled for each one after it")
+	fmt.Println("                       (default $CONTROL_CENTER_RETRY_BACKOFF, then 500ms)")
+	fmt.Println("  --break-glass <justification>")
+	fmt.Println("                       Make changes during a freeze window; the justification is recorded on the freeze")
+	fmt.Println("  -v, --debug          Log every request to the control center, its response, and retries to stderr,")
+	fmt.Println("                       with credentials redacted")
+	fmt.Println("  Connection arguments go before the command. Those not given as arguments or in the environment")
+	fmt.Println("  are read from the settings of the same name in $CCTL_CONFIG or ~/.config/cctl/config.yaml.")
+	fmt.Println("\nDeploy arguments:")
+	fmt.Println("  --agent <id>         ID of the agent")
+	fmt.Println("  --image <url>        URL of the container image")
+	fmt.Println("  --bundle <id>        Bundle to load the image from instead of a registry")
+	fmt.Println("  --auto-update        Redeploy when the image is pushed to its registry")
+	fmt.Println("  --project <name>     Project the deployment belongs to")
+	fmt.Println("  --cpu <quantity>     Requested CPU, e.g. 500m")
+	fmt.Println("  --memory <quantity>  Requested memory, e.g. 512Mi")
+	fmt.Println("  --gpu <count>        Requested number of GPUs")
+	fmt.Println("  --gpu-model <model>  With --gpu, only run on GPUs of this model")
+	fmt.Println("  --volume <spec>      Volume to mount, repeatable:")
+	fmt.Println("                         <name>:<path>:pvc:<size>[@<class>][:ro]")
+	fmt.Println("                         <name>:<path>:hostpath:<host-path>[:ro]")
+	fmt.Println("                         <name>:<path>:emptydir[:<size-limit>][:ro]")
+	fmt.Println("  --artifact <spec>    File to download, verify, and mount read-only, repeatable:")
+	fmt.Println("                         <name>:<path>:<sha256>:hf://<org>/<repo>/<file>[@<revision>]")
+	fmt.Println("                         <name>:<path>:<sha256>:s3://<bucket>/<key>")
+	fmt.Println("                         <name>:<path>:<sha256>:https://<url>")
+	fmt.Println("  --config <spec>      Config to mount, inject, or both, repeatable:")
+	fmt.Println("                         <name>[@<version>][:<mount-path>][:env]")
+	fmt.Println("                       A version pins the config; otherwise changes roll out")
+	fmt.Println("  --secret <name>[:<env>]")
+	fmt.Println("                       Secret to inject, repeatable; env defaults to the provider's")
+	fmt.Println("  --ttl <duration>     Tear the deployment down after this long, e.g. 2h")
+	fmt.Println("  --reschedule-after <duration>")
+	fmt.Println("                       With --selector, move to another matching agent once the")
+	fmt.Println("                       agent has been unreachable this long, e.g. 15m")
+	fmt.Println("  --at <time|duration> Defer the deployment until this time, or for this long")
+	fmt.Println("  --schedule <cron>    Redeploy on a cron schedule, e.g. \"0 3 * * 0\" or @daily")
+	fmt.Println("  --timezone <zone>    Time zone of --schedule; defaults to the agent's, else UTC")
+	fmt.Println("  --channel <name>     Follow a release channel's images of the --image repository")
+	fmt.Println("  --channel-strategy immediate|scheduled|manual")
+	fmt.Println("                       When channel releases are deployed")
+	fmt.Println("  --update-policy patch|minor|major")
+	fmt.Println("                       Update to newer releases of the image's version tag")
+	fmt.Println("  --model <id>         Serve a model with vLLM or TGI; --gpu sets the GPUs it is sharded across")
+	fmt.Println("  --model-server vllm|tgi")
+	fmt.Println("                       Inference server of --model; defaults to vllm")
+	fmt.Println("  --quantization <method>")
+	fmt.Println("                       Quantization of --model, e.g. awq, gptq, or fp8")
+	fmt.Println("  --max-context-length <tokens>")
+	fmt.Println("                       Maximum tokens of prompt and completion of --model")
+	fmt.Println("  --slo <percent>      Availability objective, e.g. 99.5")
+	fmt.Println("  --slo-window <window>")
+	fmt.Println("                       Rolling window of --slo, e.g. 7d or 168h; defaults to 30d")
+	fmt.Println("  --fleet <name>       Deploy to every agent of a fleet instead of --agent")
+	fmt.Println("  --selector <key>=<value>,...")
+	fmt.Println("                       Deploy to every agent with these labels instead of --agent; with --agent or --fleet, labels they must have")
+	fmt.Println("  --waves <list>       With --fleet, roll out in waves, e.g. 1,10%,50%,100%")
+	fmt.Println("  --max-failure-percent <n>")
+	fmt.Println("                       Halt the rollout once more than n% of its deployments failed")
+	fmt.Println("  --rollback           Delete the rollout's deployments when it halts")
+	fmt.Println("  --approve-before <list>")
+	fmt.Println("                       Waves, numbered from 1, that wait for `cctl approve`")
+	fmt.Println("  --pre-hook <name>=<webhook-url>|<name>=job:<image>")
+	fmt.Println("                       With --waves, run a webhook or job before each wave deploys")
+	fmt.Println("  --post-hook <name>=<webhook-url>|<name>=job:<image>")
+	fmt.Println("                       With --waves, run a webhook or job after each wave deployed")
+	fmt.Println("  --abort-on-hook-failure")
+	fmt.Println("                       Halt the rollout when one of its hooks fails")
+	fmt.Println("  -f <file|dir>        Submit JSON or YAML deployment spec templates as one batch instead")
+	fmt.Println("  --from-file <csv>    Submit a CSV file of deployments instead, one per row; the header row names the columns:")
+	fmt.Println("                         agent, selector, image, bundle, project, channel, auto-update, cpu, memory, gpu, gpu-model")
+	fmt.Println("  --values <file>      With -f, YAML file of values to render the specs with; repeatable")
+	fmt.Println("  --set <key>=<value>  With -f, value to render the specs with, e.g. image.tag=v1.2; repeatable")
+	fmt.Println("  --dry-run            Check the request and print the Kubernetes manifests it would create")
+	fmt.Println("  --wait               Show progress until the deployments are running or failed, or the rollout finished")
+	fmt.Println("  --no-color           With --wait, do not color the progress display (also with NO_COLOR set)")
+	fmt.Println("\nExit codes:")
+	fmt.Println("  0                    Success")
+	fmt.Println("  1                    Usage errors and other failures, e.g. the control center could not be reached")
+	fmt.Println("  2                    The control center rejected the request as invalid, or a flag could not be parsed")
+	fmt.Println("  3                    What the command refers to does not exist")
+	fmt.Println("  4                    The control center failed to carry out the request")
+	fmt.Println("  5                    The call timed out")
+}
 
-	var deployment Deployment
-	if err := json.NewDecoder(resp.Body).Decode(&deployment); err != nil {
-		log.Fatalf("Failed to decode deployment response: %v", err)
+// deployWorkload creates a deployment, prints it, and returns its ID.
+func deployWorkload(req client.DeploymentRequest) string {
+	deployment, err := cc.CreateDeployment(context.Background(), req)
+	if err != nil {
+		fail(err, "Deployment request failed")
 	}
 
 	fmt.Printf("Deployment created successfully!\n")
@@ -121,40 +915,783 @@ func deployWorkload(agentID, imageURL string) {
 	fmt.Printf("  Agent ID: %s\n", deployment.AgentID)
 	fmt.Printf("  Image: %s\n", deployment.ImageURL)
 	fmt.Printf("  Status: %s\n", deployment.Status)
+	return deployment.ID
 }
 
-// listAgents fetches the list of agents from the control center and prints them in a table.
-func listAgents() {
-	addr := os.Getenv("CONTROL_CENTER_ADDR")
-	if addr == "" {
-		addr = defaultControlCenterAddress
+// dryRunWorkload prints how a deployment request would start and the
+// Kubernetes manifests it would create, as YAML documents.
+func dryRunWorkload(req client.DeploymentRequest) {
+	result, err := cc.DryRunDeployment(context.Background(), req)
+	if err != nil {
+		fail(err, "Dry run failed")
+	}
+	for _, dep := range append([]client.Deployment{result.Deployment}, result.Addons...) {
+		fmt.Printf("# %s would be %s on agent %s with image %s", dep.ID, dep.Status, dep.AgentID, dep.ImageURL)
+		if dep.Reason != "" {
+			fmt.Printf(": %s", dep.Reason)
+		}
+		fmt.Println()
+	}
+	for _, manifest := range result.Manifests {
+		data, err := toYAML(manifest)
+		if err != nil {
+			fmt.Printf("Error: Failed to render the manifests: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("---")
+		os.Stdout.Write(data)
 	}
+}
 
-	resp, err := http.Get(fmt.Sprintf("%s/api/v1/agents", addr))
-	if err != nil {
-		log.Fatalf("Fatal: Failed to connect to control center: %v", err)
+// showManifest prints the Kubernetes manifests that run a deployment and its
+// add-ons as YAML documents.
+func showManifest(id string) {
+	if err := cc.DeploymentManifest(context.Background(), id, os.Stdout); err != nil {
+		fail(err, "Error: Failed to get the manifest of deployment %s", id)
 	}
-	defer resp.Body.Close()
+}
+
+// batchSpec is a deployment request read from a spec file.
+type batchSpec struct {
+	File    string
+	Request client.DeploymentRequest
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("Error: Control center returned non-OK status: %s", resp.Status)
+// readSpecs reads deployment requests from a JSON or YAML file, or from every
+// such file in a directory. A file holds one request or a list of requests,
+// and is rendered as a Go template with values first.
+func readSpecs(path string, values map[string]any) []batchSpec {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		failInvalid("Failed to read specs: %v", err)
+	} else if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				failInvalid("Failed to list specs in %s: %v", path, err)
+			}
+			files = append(files, matches...)
+		}
+		if len(files) == 0 {
+			failInvalid("No .json or .yaml specs found in %s", path)
+		}
+		sort.Strings(files)
 	}
 
-	var agents []*Agent
-	if err := json.NewDecoder(resp.Body).Decode(&agents); err != nil {
-		log.Fatalf("Fatal: Failed to decode response from control center: %v", err)
+	var specs []batchSpec
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			failInvalid("Failed to read spec %s: %v", file, err)
+		}
+		if data, err = renderSpec(file, data, values); err != nil {
+			failInvalid("Failed to render spec %s: %v", file, err)
+		}
+		// JSON is valid YAML, so both are decoded as YAML and then as JSON
+		// into requests.
+		var generic any
+		if err = yaml.Unmarshal(data, &generic); err == nil {
+			data, err = json.Marshal(generic)
+		}
+		var reqs []client.DeploymentRequest
+		if _, isList := generic.([]any); err == nil && isList {
+			err = json.Unmarshal(data, &reqs)
+		} else if err == nil {
+			var req client.DeploymentRequest
+			err = json.Unmarshal(data, &req)
+			reqs = append(reqs, req)
+		}
+		if err != nil {
+			failInvalid("Failed to parse spec %s: %v", file, err)
+		}
+		for _, req := range reqs {
+			specs = append(specs, batchSpec{File: file, Request: req})
+		}
+	}
+	return specs
+}
+
+// deployBatch submits deployment requests in batches of up to
+// client.MaxBatchSize, prints the result of each, and returns the IDs of the
+// deployments it created. It exits with an error if any of them failed.
+func deployBatch(specs []batchSpec) []string {
+	reqs := make([]client.DeploymentRequest, len(specs))
+	for i, spec := range specs {
+		reqs[i] = spec.Request
+	}
+	result := &client.BatchResponse{}
+	var batchErr error
+	var failedFrom int
+	for start := 0; start < len(reqs); start += client.MaxBatchSize {
+		part, err := cc.Batch(context.Background(), reqs[start:min(start+client.MaxBatchSize, len(reqs))], nil)
+		if err != nil {
+			// The batches before were carried out; report them first.
+			batchErr, failedFrom = err, start
+			break
+		}
+		for _, r := range part.Results {
+			r.Index += start
+			result.Results = append(result.Results, r)
+		}
+		result.Succeeded += part.Succeeded
+		result.Failed += part.Failed
+	}
+	if batchErr != nil && failedFrom == 0 {
+		fail(batchErr, "Batch request failed")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SPEC\tIMAGE\tSTATUS\tRESULT")
+	for _, r := range result.Results {
+		spec := specs[r.Index]
+		outcome := r.ID
+		if r.Error != "" {
+			outcome = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", spec.File, spec.Request.ImageURL, r.Status, outcome)
+		for _, f := range r.Fields {
+			fmt.Fprintf(w, "\t\t\t  %s\n", f)
+		}
+	}
+	w.Flush()
+	fmt.Printf("\n%d created, %d failed\n", result.Succeeded, result.Failed)
+	if batchErr != nil {
+		fail(batchErr, "Batch request for %s and the %d specs after it failed", specs[failedFrom].File, len(specs)-failedFrom-1)
+	}
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+	return createdIDs(result)
+}
+
+// listAgents fetches the list of agents from the control center and prints them in a table.
+func listAgents(includeArchived bool, selector map[string]string) {
+	var agents []client.Agent
+	var err error
+	if selector != nil {
+		agents, err = cc.SelectAgents(context.Background(), selector)
+	} else {
+		agents, err = cc.ListAgents(context.Background(), includeArchived)
+	}
+	if err != nil {
+		fail(err, "Error: Failed to list agents")
 	}
 
 	// Use the standard library's tabwriter to format the output.
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintln(w, "ID\tADDRESS\tSTATUS\tLAST SEEN (UTC)")
+	fmt.Fprintln(w, "ID\tADDRESS\tSTATUS\tVERSION\tLAST SEEN (UTC)\tLABELS")
 	for _, agent := range agents {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		status := agent.Status
+		if agent.Maintenance != nil {
+			status += " (maintenance)"
+		}
+		if agent.StaleSince != nil {
+			status += " (stale)"
+		}
+		version := agent.Version
+		if version == "" {
+			version = "-"
+		}
+		if agent.VersionWarning != "" {
+			version += " (unsupported)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
 			agent.ID,
 			agent.Address,
-			agent.Status,
+			status,
+			version,
 			agent.LastSeen.Format(time.RFC3339),
+			formatLabels(agent.Labels),
+		)
+	}
+	w.Flush()
+}
+
+// parseSelector parses comma-separated key=value labels, e.g.
+// arch=arm64,site=store-104. It returns nil for an empty string.
+func parseSelector(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	selector := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			failInvalid("Invalid selector %q: expected <key>=<value>,...", s)
+		}
+		selector[key] = value
+	}
+	return selector
+}
+
+// formatLabels writes labels as sorted, comma-separated key=value pairs.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// describeDeployment fetches a deployment and its event timeline and prints them.
+func describeDeployment(id string) {
+	ctx := context.Background()
+	deployment, err := cc.GetDeployment(ctx, id)
+	if err != nil {
+		fail(err, "Error: Failed to get deployment %s", id)
+	}
+	events, err := cc.DeploymentEvents(ctx, id)
+	if err != nil {
+		fail(err, "Error: Failed to get events for deployment %s", id)
+	}
+
+	fmt.Printf("ID:          %s\n", deployment.ID)
+	fmt.Printf("Agent ID:    %s\n", deployment.AgentID)
+	fmt.Printf("Image:       %s\n", deployment.ImageURL)
+	if deployment.ImageDigest != "" {
+		fmt.Printf("Digest:      %s\n", deployment.ImageDigest)
+	}
+	fmt.Printf("Status:      %s\n", deployment.Status)
+	if deployment.Reason != "" {
+		fmt.Printf("Reason:      %s\n", deployment.Reason)
+	}
+
+	if scan := deployment.Scan; scan != nil {
+		result := "passed"
+		if !scan.Passed {
+			result = "findings at or above " + scan.Threshold
+		}
+		fmt.Printf("Scan:        %s (critical %d, high %d, medium %d, low %d)\n", result,
+			scan.Counts["CRITICAL"], scan.Counts["HIGH"], scan.Counts["MEDIUM"], scan.Counts["LOW"])
+	}
+	fmt.Printf("Revision:    %d (resource version %d)\n", deployment.Revision, deployment.ResourceVersion)
+	fmt.Printf("Auto Update: %t\n", deployment.AutoUpdate)
+	if m := deployment.ModelServing; m != nil {
+		fmt.Printf("Model:       %s on %s (%d GPUs)\n", m.Model, m.Server, m.GPUs)
+		if m.Shadow != nil {
+			fmt.Printf("Shadow Of:   %s (%d%% of requests mirrored)\n", m.Shadow.Model, m.Shadow.Percent)
+		}
+	}
+	if len(deployment.Args) > 0 {
+		fmt.Printf("Args:        %s\n", strings.Join(deployment.Args, " "))
+	}
+	for i, v := range deployment.Volumes {
+		label := ""
+		if i == 0 {
+			label = "Volumes:"
+		}
+		fmt.Printf("%-13s%s -> %s\n", label, describeVolume(v), v.MountPath)
+	}
+	for i, art := range deployment.Artifacts {
+		label := ""
+		if i == 0 {
+			label = "Artifacts:"
+		}
+		fmt.Printf("%-13s%s (%s, sha256 %.12s) -> %s\n", label, art.Name, art.Source, art.SHA256, art.MountPath)
+	}
+	for i, ref := range deployment.Configs {
+		label := ""
+		if i == 0 {
+			label = "Configs:"
+		}
+		var targets []string
+		if ref.MountPath != "" {
+			targets = append(targets, ref.MountPath)
+		}
+		if ref.Env {
+			targets = append(targets, "env")
+		}
+		pinned := ""
+		if ref.Pin != 0 {
+			pinned = " (pinned)"
+		}
+		fmt.Printf("%-13s%s v%d%s -> %s\n", label, ref.Name, ref.Version, pinned, strings.Join(targets, ", "))
+	}
+	for i, ref := range deployment.Secrets {
+		label := ""
+		if i == 0 {
+			label = "Secrets:"
+		}
+		fmt.Printf("%-13s%s v%d -> %s\n", label, ref.Name, ref.Version, ref.Env)
+	}
+	for i, addon := range deployment.Addons {
+		label := ""
+		if i == 0 {
+			label = "Add-ons:"
+		}
+		fmt.Printf("%-13s%s (%s) -> %s\n", label, addon.Name, addon.Type, addon.DeploymentID)
+	}
+	if deployment.AddonOf != "" {
+		fmt.Printf("Add-on Of:   %s\n", deployment.AddonOf)
+	}
+	if deployment.Hook != "" {
+		fmt.Printf("Hook:        %s\n", deployment.Hook)
+	}
+	if deployment.AdoptedFrom != "" {
+		fmt.Printf("Adopted:     %s\n", deployment.AdoptedFrom)
+	}
+	if sb := deployment.Sandbox; sb != nil {
+		egress := "no egress"
+		if len(sb.Egress) > 0 {
+			dests := make([]string, len(sb.Egress))
+			for i, rule := range sb.Egress {
+				dests[i] = rule.Host + rule.CIDR
+				if strings.Contains(dests[i], ":") && len(rule.Ports) > 0 {
+					dests[i] = "[" + dests[i] + "]"
+				}
+				for j, port := range rule.Ports {
+					sep := ","
+					if j == 0 {
+						sep = ":"
+					}
+					dests[i] += sep + strconv.Itoa(port)
+				}
+			}
+			egress = "egress to " + strings.Join(dests, ", ")
+		}
+		fmt.Printf("Sandbox:     %s; seccomp %s, apparmor %s\n", egress, sb.Seccomp, sb.AppArmor)
+	}
+
+	fmt.Printf("Created At:  %s\n", deployment.CreatedAt.Format(time.RFC3339))
+	if deployment.ExpiresAt != nil {
+		fmt.Printf("Expires At:  %s\n", deployment.ExpiresAt.Format(time.RFC3339))
+	}
+	if deployment.ScheduleAt != nil {
+		fmt.Printf("Deferred To: %s\n", deployment.ScheduleAt.Format(time.RFC3339))
+	}
+	if deployment.Schedule != "" {
+		fmt.Printf("Schedule:    %s (%s)\n", deployment.Schedule, deployment.Timezone)
+	}
+	if deployment.NextRun != nil {
+		fmt.Printf("Next Run:    %s\n", deployment.NextRun.Format(time.RFC3339))
+	}
+	if deployment.Channel != "" {
+		fmt.Printf("Channel:     %s (%s)\n", deployment.Channel, deployment.ChannelStrategy)
+	}
+	if deployment.UpdatePolicy != "" {
+		fmt.Printf("Updates:     %s releases\n", deployment.UpdatePolicy)
+	}
+	if deployment.AvailableImage != "" {
+		fmt.Printf("Available:   %s\n", deployment.AvailableImage)
+	}
+	if deployment.SLO != nil {
+		if slo, err := cc.DeploymentSLO(ctx, id); err == nil {
+			fmt.Printf("SLO:         %g%% over %s: %.3f%% available, %.1f%% of error budget left, burn rate %.1f\n",
+				slo.SLO.Target, slo.SLO.Window, slo.Availability, slo.BudgetRemaining, slo.BurnRate)
+		}
+	}
+	if deployment.ArchivedAt != nil {
+		fmt.Printf("Archived At: %s\n", deployment.ArchivedAt.Format(time.RFC3339))
+	}
+	fmt.Println("\nEvents:")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "TIME (UTC)\tTYPE\tMESSAGE")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\n",
+			event.Time.Format(time.RFC3339),
+			event.Type,
+			event.Message,
+		)
+	}
+	w.Flush()
+}
+
+// cancelDeployment cancels a deployment that its agent has not started yet.
+func cancelDeployment(id string) {
+	if _, err := cc.CancelDeployment(context.Background(), id, ""); err != nil {
+		fail(err, "Error: Failed to cancel deployment %s", id)
+	}
+	fmt.Printf("Deployment %s cancelled\n", id)
+}
+
+// pauseDeployment stops a deployment's workload until it is resumed.
+func pauseDeployment(id string) {
+	if _, err := cc.PauseDeployment(context.Background(), id, ""); err != nil {
+		fail(err, "Error: Failed to pause deployment %s", id)
+	}
+	fmt.Printf("Deployment %s paused\n", id)
+}
+
+// resumeDeployment redeploys a paused deployment.
+func resumeDeployment(id string) {
+	dep, err := cc.ResumeDeployment(context.Background(), id)
+	if err != nil {
+		fail(err, "Error: Failed to resume deployment %s", id)
+	}
+	fmt.Printf("Deployment %s resumed as revision %d (%s)\n", id, dep.Revision, dep.Status)
+}
+
+// promoteDeployment makes a shadow deployment serve requests.
+func promoteDeployment(id string) {
+	dep, err := cc.PromoteDeployment(context.Background(), id)
+	if err != nil {
+		fail(err, "Error: Failed to promote deployment %s", id)
+	}
+	fmt.Printf("Deployment %s promoted and now serves model %s\n", id, dep.ModelServing.Model)
+}
+
+// setDeploymentImage redeploys a deployment with a new image. The update is
+// conditional on the deployment not having changed since it was fetched.
+func setDeploymentImage(id, image string) {
+	ctx := context.Background()
+	current, err := cc.GetDeployment(ctx, id)
+	if err != nil {
+		fail(err, "Error: Failed to get deployment %s", id)
+	}
+	deployment, err := cc.UpdateDeployment(ctx, id, current.ResourceVersion, client.DeploymentPatch{ImageURL: &image})
+	if err != nil {
+		fail(err, "Error: Failed to update deployment %s", id)
+	}
+	fmt.Printf("Deployment %s updated to %s (revision %d, status %s)\n", id, deployment.ImageURL, deployment.Revision, deployment.Status)
+}
+
+// describeVolume summarizes a volume's source, e.g. "models (pvc models-claim, 20Gi)".
+func describeVolume(v client.Volume) string {
+	var source string
+	switch {
+	case v.PVC != nil:
+		source = fmt.Sprintf("pvc %s, %s", v.PVC.ClaimName, v.PVC.Size)
+		if v.PVC.StorageClass != "" {
+			source += ", class " + v.PVC.StorageClass
+		}
+	case v.HostPath != nil:
+		source = "hostpath " + v.HostPath.Path
+	case v.EmptyDir != nil:
+		source = "emptydir"
+		if v.EmptyDir.SizeLimit != "" {
+			source += ", " + v.EmptyDir.SizeLimit
+		}
+	}
+	if v.ReadOnly {
+		source += ", read-only"
+	}
+	return fmt.Sprintf("%s (%s)", v.Name, source)
+}
+
+// listQuotas fetches quotas and their usage from the control center and prints them in a table.
+func listQuotas() {
+	quotas, err := cc.ListQuotas(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list quotas")
+	}
+
+	// limit renders "used/limit", or just the usage if there is no limit.
+	limit := func(used, max string) string {
+		if max == "" {
+			return used
+		}
+		return used + "/" + max
+	}
+	intLimit := func(used int, max *int) string {
+		if max == nil {
+			return limit(fmt.Sprint(used), "")
+		}
+		return limit(fmt.Sprint(used), fmt.Sprint(*max))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SCOPE\tNAME\tDEPLOYMENTS\tCPU\tMEMORY\tGPU\tQUEUED\tON EXCEED")
+	for _, q := range quotas {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			q.Scope,
+			q.Name,
+			intLimit(q.Usage.Deployments, q.MaxDeployments),
+			limit(q.Usage.CPU, q.CPU),
+			limit(q.Usage.Memory, q.Memory),
+			intLimit(q.Usage.GPU, q.GPU),
+			q.Usage.Queued,
+			q.OnExceed,
 		)
 	}
 	w.Flush()
 }
+
+// listConfigs fetches configs from the control center and prints them in a table.
+func listConfigs() {
+	configs, err := cc.ListConfigs(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list configs")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKEYS\tVERSION\tUPDATED AT (UTC)")
+	for _, cfg := range configs {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", cfg.Name, len(cfg.Data), cfg.Version, cfg.UpdatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// getConfig prints the keys and values of a config, or of one of its
+// versions if the name is followed by @<version>.
+func getConfig(name string) {
+	var cfg *client.Config
+	var err error
+	if base, v, ok := strings.Cut(name, "@"); ok {
+		version, convErr := strconv.Atoi(v)
+		if convErr != nil || version <= 0 {
+			failInvalid("Invalid config version %q", v)
+		}
+		cfg, err = cc.GetConfigVersion(context.Background(), base, version)
+	} else {
+		cfg, err = cc.GetConfig(context.Background(), name)
+	}
+	if err != nil {
+		fail(err, "Error: Failed to get config %s", name)
+	}
+
+	keys := make([]string, 0, len(cfg.Data))
+	for key := range cfg.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Printf("Name:    %s\n", cfg.Name)
+	fmt.Printf("Version: %d\n", cfg.Version)
+	fmt.Println("\nData:")
+	for _, key := range keys {
+		fmt.Printf("  %s=%s\n", key, cfg.Data[key])
+	}
+}
+
+// setConfig creates or replaces a config. Deployments using it are rolled
+// out, batchSize at a time unless it is 0.
+func setConfig(name string, data map[string]string, batchSize int) {
+	cfg, err := cc.SetConfigInBatches(context.Background(), name, data, batchSize)
+	if err != nil {
+		fail(err, "Config request failed")
+	}
+	fmt.Printf("Config %s stored as version %d\n", cfg.Name, cfg.Version)
+}
+
+// listConfigVersions prints every version of a config in a table.
+func listConfigVersions(name string) {
+	versions, err := cc.ConfigVersions(context.Background(), name)
+	if err != nil {
+		fail(err, "Error: Failed to list versions of config %s", name)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tKEYS\tUPDATED AT (UTC)")
+	for _, cfg := range versions {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", cfg.Version, len(cfg.Data), cfg.UpdatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// showConfigRollout prints the progress of the latest rollout of a config.
+func showConfigRollout(name string) {
+	rollout, err := cc.ConfigRollout(context.Background(), name)
+	if err != nil {
+		fail(err, "Error: Failed to get rollout of config %s", name)
+	}
+	batch := "all at once"
+	if rollout.BatchSize > 0 {
+		batch = strconv.Itoa(rollout.BatchSize)
+	}
+	fmt.Printf("Config:     %s v%d\n", rollout.Config, rollout.Version)
+	fmt.Printf("State:      %s\n", rollout.State)
+	fmt.Printf("Batch Size: %s\n", batch)
+	fmt.Printf("Started At: %s\n", rollout.StartedAt.Format(time.RFC3339))
+	if rollout.HaltedBy != "" {
+		fmt.Printf("Halted By:  %s\n", rollout.HaltedBy)
+	}
+	fmt.Printf("Updated:    %s\n", strings.Join(rollout.Updated, ", "))
+	fmt.Printf("Pending:    %s\n", strings.Join(rollout.Pending, ", "))
+}
+
+// deleteConfig deletes a config that no deployment uses.
+func deleteConfig(name string) {
+	if err := cc.DeleteConfig(context.Background(), name); err != nil {
+		fail(err, "Config request failed")
+	}
+	fmt.Printf("Config %s deleted\n", name)
+}
+
+// deleteAgent archives an agent. The control center keeps archived records
+// until they are purged.
+func deleteAgent(id string) {
+	if _, err := cc.DeleteAgent(context.Background(), id); err != nil {
+		fail(err, "Error: Failed to delete agent %s", id)
+	}
+	fmt.Printf("Agent %s deleted and archived\n", id)
+}
+
+// deleteDeployment tears down and archives a deployment. The control center
+// keeps archived records until they are purged.
+func deleteDeployment(id string) {
+	if _, err := cc.DeleteDeployment(context.Background(), id); err != nil {
+		fail(err, "Error: Failed to delete deployment %s", id)
+	}
+	fmt.Printf("Deployment %s deleted and archived\n", id)
+}
+
+// setImageRewrites replaces an agent's image rewrite rules; no rules clears them.
+func setImageRewrites(id string, rules []client.ImageRewrite) {
+	agent, err := cc.SetImageRewrites(context.Background(), id, rules)
+	if err != nil {
+		fail(err, "Image rewrite request failed")
+	}
+	if len(agent.ImageRewrites) == 0 {
+		fmt.Printf("Agent %s pulls images as given\n", agent.ID)
+		return
+	}
+	fmt.Printf("Agent %s pulls images from:\n", agent.ID)
+	for _, r := range agent.ImageRewrites {
+		fmt.Printf("  %s => %s\n", r.From, r.To)
+	}
+}
+
+// cordonAgent puts an agent in maintenance.
+func cordonAgent(id, reason string, queue bool) {
+	agent, err := cc.CordonAgent(context.Background(), id, reason, queue)
+	if err != nil {
+		fail(err, "Error: Failed to cordon agent %s", id)
+	}
+	action := "rejected"
+	if agent.Maintenance.OnDeploy == "queue" {
+		action = "queued"
+	}
+	fmt.Printf("Agent %s is in maintenance; new deployments are %s\n", agent.ID, action)
+}
+
+// uncordonAgent takes an agent out of maintenance.
+func uncordonAgent(id string) {
+	if _, err := cc.UncordonAgent(context.Background(), id); err != nil {
+		fail(err, "Error: Failed to uncordon agent %s", id)
+	}
+	fmt.Printf("Agent %s is out of maintenance\n", id)
+}
+
+// showAdmissionQueue prints the deployments being admitted to an agent and
+// the ones waiting for their turn.
+func showAdmissionQueue(id string) {
+	q, err := cc.AdmissionQueue(context.Background(), id)
+	if err != nil {
+		fail(err, "Error: Failed to get the admission queue of agent %s", id)
+	}
+	order := "submission order, one at a time"
+	if !q.Ordered {
+		order = "unordered"
+	}
+	fmt.Printf("Agent %s: %d in admission (%s)\n", q.AgentID, q.Depth, order)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tSTATE")
+	for _, id := range q.Admitting {
+		fmt.Fprintf(w, "%s\tadmitting\n", id)
+	}
+	for _, id := range q.Queued {
+		fmt.Fprintf(w, "%s\tqueued\n", id)
+	}
+	w.Flush()
+}
+
+// proxyToAgent calls the API of an agent's cluster through its tunnel and
+// copies the response to standard output as it arrives, so logs can be
+// followed.
+func proxyToAgent(id, method, path, data string) {
+	var body []byte
+	var err error
+	switch data {
+	case "":
+	case "-":
+		body, err = io.ReadAll(os.Stdin)
+	default:
+		body, err = os.ReadFile(data)
+	}
+	if err != nil {
+		log.Fatalf("Error: Failed to read request body: %v", err)
+	}
+	resp, err := cc.AgentProxy(context.Background(), id, method, path, body)
+	if err != nil {
+		fail(err, "Error: Failed to call the cluster of agent %s", id)
+	}
+	defer resp.Close()
+	if _, err := io.Copy(os.Stdout, resp); err != nil {
+		log.Fatalf("Error: Failed to read response: %v", err)
+	}
+}
+
+// backup downloads a snapshot of the control center's state to a file.
+func backup(file string) {
+	// Write to a temporary file first so that a failed download does not
+	// replace an earlier backup.
+	tmp := file + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		log.Fatalf("Fatal: Failed to create backup file: %v", err)
+	}
+	n, err := cc.Backup(context.Background(), out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fail(err, "Error: Backup failed")
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		log.Fatalf("Fatal: Failed to write backup file: %v", err)
+	}
+	fmt.Printf("Backup saved to %s (%d bytes)\n", file, n)
+}
+
+// restore replaces the control center's state with a snapshot from a file.
+func restore(file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		failInvalid("Failed to read backup file: %v", err)
+	}
+	defer f.Close()
+	result, err := cc.Restore(context.Background(), f)
+	if err != nil {
+		fail(err, "Error: Restore failed")
+	}
+	fmt.Printf("Restored %d agents, %d deployments, %d configs, %d secrets, %d quotas, %d applications, %d fleets, %d freezes, %d channels, and %d alert rules\n",
+		result.Agents, result.Deployments, result.Configs, result.Secrets, result.Quotas, result.Applications, result.Fleets, result.Freezes, result.Channels, result.AlertRules)
+}
+
+// listAPIVersions prints the API versions the control center serves in a
+// table, marking the one cctl speaks.
+func listAPIVersions() {
+	versions, err := cc.APIVersions(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list API versions")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tDEPRECATED AT (UTC)\tSUNSET AT (UTC)")
+	for _, v := range versions {
+		version, deprecatedAt, sunsetAt := v.Version, "-", "-"
+		if version == client.APIVersion {
+			version += " (cctl)"
+		}
+		if v.DeprecatedAt != nil {
+			deprecatedAt = v.DeprecatedAt.Format(time.RFC3339)
+		}
+		if v.SunsetAt != nil {
+			sunsetAt = v.SunsetAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", version, v.Status, deprecatedAt, sunsetAt)
+	}
+	w.Flush()
+}
+
+// listRegistries fetches registry health from the control center and prints it in a table.
+func listRegistries() {
+	registries, err := cc.ListRegistries(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list registries")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "REGISTRY\tSTATE\tFAILURES\tNEXT PROBE (UTC)\tLAST ERROR")
+	for _, r := range registries {
+		nextProbe := "-"
+		if !r.RetryAt.IsZero() {
+			nextProbe = r.RetryAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.Registry, r.State, r.ConsecutiveFailures, nextProbe, r.LastError)
+	}
+	w.Flush()
+}
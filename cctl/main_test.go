@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cctlBinary is the cctl binary TestMain builds for the tests to run.
+var cctlBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "cctl-test")
+	if err != nil {
+		panic(err)
+	}
+	cctlBinary = filepath.Join(dir, "cctl")
+	if out, err := exec.Command("go", "build", "-o", cctlBinary, ".").CombinedOutput(); err != nil {
+		panic("building cctl failed: " + string(out))
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runCctl runs cctl against the control center at addr, without the
+// caller's connection settings, and returns its exit code and output.
+func runCctl(t *testing.T, addr string, args ...string) (int, string) {
+	t.Helper()
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(config, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(cctlBinary, args...)
+	cmd.Dir = dir
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "CONTROL_CENTER_") && !strings.HasPrefix(env, "CCTL_") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, "CCTL_CONFIG="+config, "CONTROL_CENTER_ADDR="+addr, "CONTROL_CENTER_RETRIES=0")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(out)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0, string(out)
+}
+
+func TestExitCodes(t *testing.T) {
+	// The control center answers agent lists, knows no deployments, and
+	// fails everything else.
+	cc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/agents":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("[]"))
+		case strings.HasPrefix(r.URL.Path, "/api/v1/deployments/"):
+			http.Error(w, "Deployment not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+		}
+	}))
+	defer cc.Close()
+
+	targets := filepath.Join(t.TempDir(), "targets.csv")
+	if err := os.WriteFile(targets, []byte("agent,image,colour\na1,nginx:1.27,blue\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate := filepath.Join(t.TempDir(), "duplicate.csv")
+	if err := os.WriteFile(duplicate, []byte("agent,image,Image\na1,nginx:1.27,nginx:1.28\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"agents", "list"}, 0},
+		{"no command", nil, exitInvalid},
+		{"unknown command", []string{"frobnicate"}, exitInvalid},
+		{"unknown flag", []string{"agents", "list", "--nope"}, exitInvalid},
+		{"invalid timeout", []string{"--timeout=abc", "agents", "list"}, exitInvalid},
+		{"invalid selector", []string{"agents", "list", "--selector", "foo"}, exitInvalid},
+		{"invalid image rewrite", []string{"agents", "rewrite-images", "agent-1", "foo"}, exitInvalid},
+		{"missing deploy flags", []string{"deploy", "--image", "nginx:1.27"}, exitInvalid},
+		{"invalid ttl", []string{"deploy", "--agent", "agent-1", "--image", "nginx:1.27", "--ttl", "1.5s"}, exitInvalid},
+		{"unknown targets column", []string{"deploy", "--from-file", targets}, exitInvalid},
+		{"duplicate targets column", []string{"deploy", "--from-file", duplicate}, exitInvalid},
+		{"missing spec file", []string{"deploy", "-f", "/nonexistent.yaml"}, exitInvalid},
+		{"missing targets file", []string{"deploy", "--from-file", "/nonexistent.csv"}, exitInvalid},
+		{"missing import file", []string{"import", "/nonexistent.yaml"}, exitInvalid},
+		{"invalid install format", []string{"agents", "install", "--format", "rpm"}, exitInvalid},
+		{"invalid port", []string{"port-forward", "dep-1", "http"}, exitInvalid},
+		{"not found", []string{"deployments", "describe", "dep-1"}, exitNotFound},
+		{"server error", []string{"fleets", "list"}, exitServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, out := runCctl(t, cc.URL, tt.args...); code != tt.want {
+				t.Errorf("cctl %s exited with %d, want %d; output:\n%s", strings.Join(tt.args, " "), code, tt.want, out)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		if code, out := runCctl(t, "http://127.0.0.1:1", "agents", "list"); code != exitFailure {
+			t.Errorf("cctl agents list exited with %d, want %d; output:\n%s", code, exitFailure, out)
+		}
+	})
+}
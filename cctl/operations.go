@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+// operationPollInterval is how often --wait checks on a cluster operation.
+const operationPollInterval = time.Second
+
+func handleClusterCmd(args []string) {
+	switch {
+	case len(args) >= 2 && (args[0] == "apply" || args[0] == "delete"):
+		opCmd := flag.NewFlagSet("cluster "+args[0], flag.ExitOnError)
+		file := opCmd.String("f", "", "File with the YAML or JSON manifests of the objects, or - for standard input.")
+		deploymentID := opCmd.String("deployment", "", "Use the manifests of this deployment of the agent instead of a file.")
+		namespace := opCmd.String("namespace", "", "Namespace of objects that do not name one (default \"default\").")
+		wait := opCmd.Bool("wait", false, "Wait until the agent has carried the operation out and print its results.")
+		opCmd.Parse(args[2:])
+		if (*file == "") == (*deploymentID == "") {
+			fmt.Printf("Usage: cctl cluster %s <agent-id> (-f <file> | --deployment <id>) [--namespace <name>] [--wait]\n", args[0])
+			os.Exit(exitInvalid)
+		}
+		req := client.ClusterOperationRequest{Action: args[0], Namespace: *namespace, DeploymentID: *deploymentID}
+		if *file != "" {
+			req.Manifests = string(readInput(*file))
+		}
+		createOperation(args[1], req, *wait)
+	case len(args) == 2 && args[0] == "operations":
+		listOperations(args[1])
+	case len(args) == 3 && args[0] == "operation":
+		showOperation(args[1], args[2])
+	default:
+		fmt.Println("Usage: cctl cluster apply <agent-id> (-f <file> | --deployment <id>) [--namespace <name>] [--wait]")
+		fmt.Println("       cctl cluster delete <agent-id> (-f <file> | --deployment <id>) [--namespace <name>] [--wait]")
+		fmt.Println("       cctl cluster operations <agent-id>")
+		fmt.Println("       cctl cluster operation <agent-id> <operation-id>")
+		os.Exit(exitInvalid)
+	}
+}
+
+// readInput reads a file, or standard input for "-".
+func readInput(file string) []byte {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		failInvalid("Failed to read %s: %v", file, err)
+	}
+	return data
+}
+
+// createOperation queues a cluster operation on an agent and, with wait,
+// prints its results once the agent has carried it out.
+func createOperation(agentID string, req client.ClusterOperationRequest, wait bool) {
+	ctx := context.Background()
+	op, err := cc.CreateOperation(ctx, agentID, req)
+	if err != nil {
+		fail(err, "Error: Failed to send the %s to agent %s", req.Action, agentID)
+	}
+	fmt.Printf("Operation %s queued: %s %d objects on agent %s\n", op.ID, op.Action, len(op.Objects), agentID)
+	if !wait {
+		return
+	}
+	id := op.ID
+	for op.CompletedAt == nil {
+		time.Sleep(operationPollInterval)
+		if op, err = cc.GetOperation(ctx, agentID, id); err != nil {
+			fail(err, "Error: Failed to get operation %s", id)
+		}
+	}
+	printOperation(op)
+	if op.Status == "failed" {
+		os.Exit(1)
+	}
+}
+
+// listOperations prints an agent's recent cluster operations.
+func listOperations(agentID string) {
+	ops, err := cc.ListOperations(context.Background(), agentID)
+	if err != nil {
+		fail(err, "Error: Failed to list the operations of agent %s", agentID)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tACTION\tOBJECTS\tDEPLOYMENT\tSTATUS\tCREATED")
+	for _, op := range ops {
+		deployment := op.DeploymentID
+		if deployment == "" {
+			deployment = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", op.ID, op.Action, len(op.Objects), deployment, op.Status, op.CreatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// showOperation prints a cluster operation and what became of its objects.
+func showOperation(agentID, id string) {
+	op, err := cc.GetOperation(context.Background(), agentID, id)
+	if err != nil {
+		fail(err, "Error: Failed to get operation %s", id)
+	}
+	printOperation(op)
+}
+
+func printOperation(op *client.ClusterOperation) {
+	fmt.Printf("Operation %s (%s): %s\n", op.ID, op.Action, op.Status)
+	if op.Error != "" {
+		fmt.Printf("Error: %s\n", op.Error)
+	}
+	if len(op.Results) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tRESULT\tERROR")
+	for _, r := range op.Results {
+		namespace, msg := r.Namespace, r.Error
+		if namespace == "" {
+			namespace = "-"
+		}
+		if msg == "" {
+			msg = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Kind, namespace, r.Name, r.Result, msg)
+	}
+	w.Flush()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func handlePortForwardCmd(args []string) {
+	pfCmd := flag.NewFlagSet("port-forward", flag.ExitOnError)
+	address := pfCmd.String("address", "127.0.0.1", "Local address to listen on.")
+	if len(args) < 2 {
+		fmt.Println("Usage: cctl port-forward <deployment-id> [<local-port>:]<remote-port>... [--address <ip>]")
+		os.Exit(exitInvalid)
+	}
+	deploymentID := args[0]
+	var specs []string
+	rest := args[1:]
+	for len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		specs, rest = append(specs, rest[0]), rest[1:]
+	}
+	pfCmd.Parse(rest)
+	specs = append(specs, pfCmd.Args()...)
+
+	locals := make([]int, len(specs))
+	remotes := make([]int, len(specs))
+	for i, spec := range specs {
+		var err error
+		if locals[i], remotes[i], err = parsePortSpec(spec); err != nil {
+			failInvalid("Invalid port %q: %v", spec, err)
+		}
+	}
+
+	// Fail right away for a deployment that does not exist, not on the
+	// first connection.
+	if _, err := cc.GetDeployment(context.Background(), deploymentID); err != nil {
+		fail(err, "Error: Failed to get deployment %s", deploymentID)
+	}
+	var listeners []net.Listener
+	for i, local := range locals {
+		l, err := net.Listen("tcp", net.JoinHostPort(*address, strconv.Itoa(local)))
+		if err != nil {
+			log.Fatalf("Error: Failed to listen: %v", err)
+		}
+		fmt.Printf("Forwarding from %s -> %d of deployment %s\n", l.Addr(), remotes[i], deploymentID)
+		listeners = append(listeners, l)
+	}
+
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			forwardConnections(l, deploymentID, remotes[i])
+		}()
+	}
+	wg.Wait()
+}
+
+// parsePortSpec reads [<local-port>:]<remote-port>. A local port of 0 picks
+// a free one.
+func parsePortSpec(spec string) (int, int, error) {
+	localSpec, remoteSpec, found := strings.Cut(spec, ":")
+	if !found {
+		localSpec, remoteSpec = spec, spec
+	}
+	local, err := strconv.Atoi(localSpec)
+	if err != nil || local < 0 || local > 65535 {
+		return 0, 0, errors.New("local port must be a number from 0 to 65535")
+	}
+	remote, err := strconv.Atoi(remoteSpec)
+	if err != nil || remote < 1 || remote > 65535 {
+		return 0, 0, errors.New("remote port must be a number from 1 to 65535")
+	}
+	return local, remote, nil
+}
+
+// forwardConnections forwards each connection accepted on l to a port of
+// the deployment, each over a connection of its own to the control center.
+func forwardConnections(l net.Listener, deploymentID string, port int) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalf("Error: Failed to accept connections: %v", err)
+		}
+		go func() {
+			defer conn.Close()
+			remote, err := cc.PortForward(context.Background(), deploymentID, port)
+			if err != nil {
+				log.Printf("Error: Failed to forward a connection to port %d: %v", port, err)
+				return
+			}
+			defer remote.Close()
+			fmt.Printf("Handling connection for %d\n", port)
+			localDone := make(chan struct{})
+			go func() {
+				io.Copy(remote, conn)
+				// Forwarded connections cannot be half closed.
+				close(localDone)
+				remote.Close()
+			}()
+			_, err = io.Copy(conn, remote)
+			select {
+			case <-localDone:
+			default:
+				if err != nil {
+					log.Printf("Error: Connection to port %d failed: %v", port, err)
+				}
+			}
+		}()
+	}
+}
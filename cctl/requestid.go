@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"edge-orchestration/client"
+)
+
+// fail logs a failed call to the control center and exits with the code of
+// its kind of failure, see exitCode. Calls that reached
+// the control center are logged with their request ID, so that they can be
+// found in its logs. Fields of the request that do not match its schema are
+// listed one per line.
+func fail(err error, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...) + ": " + err.Error()
+	fields := client.InvalidFields(err)
+	var apiErr *client.APIError
+	if len(fields) > 0 && errors.As(err, &apiErr) {
+		msg = fmt.Sprintf(format, args...) + ": " + apiErr.Message
+	}
+	if id := client.RequestID(err); id != "" {
+		msg += " (request ID: " + id + ")"
+	}
+	for _, f := range fields {
+		msg += "\n  " + f.String()
+	}
+	log.Print(msg)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+
+	"flag"
+)
+
+func handleRolloutsCmd(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		listRollouts()
+	case len(args) == 2 && args[0] == "get":
+		getRollout(args[1])
+	default:
+		fmt.Println("Usage: cctl rollouts list")
+		fmt.Println("       cctl rollouts get <id>")
+		os.Exit(exitInvalid)
+	}
+}
+
+func handleApproveCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: cctl approve <rollout-id> [--comment <text>]")
+		os.Exit(exitInvalid)
+	}
+	approveCmd := flag.NewFlagSet("approve", flag.ExitOnError)
+	comment := approveCmd.String("comment", "", "Why the wave may start, recorded with the approval.")
+	approveCmd.Parse(args[1:])
+	approveRollout(args[0], *comment)
+}
+
+// approveRollout starts the wave a rollout is waiting at.
+func approveRollout(id, comment string) {
+	r, err := cc.ApproveRollout(context.Background(), id, comment)
+	if err != nil {
+		fail(err, "Error: Failed to approve rollout %s", id)
+	}
+	printRollout(r)
+}
+
+// startRollout starts a rollout to a fleet, prints its waves, and returns its
+// ID.
+func startRollout(fleet string, req client.RolloutRequest) string {
+	r, err := cc.StartRollout(context.Background(), fleet, req)
+	if err != nil {
+		fail(err, "Rollout request failed")
+	}
+	printRollout(r)
+	fmt.Printf("\nFollow it with `cctl rollouts get %s`\n", r.ID)
+	return r.ID
+}
+
+// listRollouts prints all rollouts, newest first.
+func listRollouts() {
+	rollouts, err := cc.ListRollouts(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list rollouts")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tFLEET\tIMAGE\tSTATUS\tWAVE\tCREATED (UTC)")
+	for _, r := range rollouts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d\t%s\n", r.ID, r.Fleet, r.Deployment.ImageURL, r.Status, r.CurrentWave+1, len(r.Waves), r.CreatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// getRollout prints a rollout and the outcome of each wave.
+func getRollout(id string) {
+	r, err := cc.GetRollout(context.Background(), id)
+	if err != nil {
+		fail(err, "Error: Failed to get rollout %s", id)
+	}
+	printRollout(r)
+}
+
+func printRollout(r *client.Rollout) {
+	fmt.Printf("ID:          %s\n", r.ID)
+	fmt.Printf("Fleet:       %s\n", r.Fleet)
+	fmt.Printf("Image:       %s\n", r.Deployment.ImageURL)
+	fmt.Printf("Status:      %s\n", r.Status)
+	if r.Reason != "" {
+		fmt.Printf("Reason:      %s\n", r.Reason)
+	}
+	fmt.Printf("Max Failure: %d%%\n", r.MaxFailurePercent)
+	fmt.Printf("Rollback:    %t\n", r.Rollback)
+	for _, h := range r.Hooks {
+		target := h.Webhook
+		if h.Job != nil {
+			target = "job " + strings.Join(append([]string{h.Job.Image}, h.Job.Args...), " ")
+		}
+		abort := ""
+		if h.AbortOnFailure {
+			abort = ", aborts on failure"
+		}
+		fmt.Printf("Hook:        %s (%s) %s%s\n", h.Name, h.Phase, target, abort)
+	}
+
+	fmt.Println("\nWaves:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "WAVE\tAGENT\tSTATUS\tDEPLOYMENT")
+	for i, wave := range r.Waves {
+		for _, agentID := range wave.Agents {
+			outcome := wave.Deployments[agentID]
+			if reason, failed := wave.Failures[agentID]; failed {
+				outcome = strings.TrimSpace(outcome + " " + reason)
+			}
+			if outcome == "" {
+				outcome = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, agentID, wave.Status, outcome)
+		}
+	}
+	w.Flush()
+
+	var runs [][]string
+	for i, wave := range r.Waves {
+		for _, run := range wave.Hooks {
+			deployments := make([]string, 0, len(run.Deployments))
+			for _, id := range run.Deployments {
+				if id != "" {
+					deployments = append(deployments, id)
+				}
+			}
+			sort.Strings(deployments)
+			outcome := strings.TrimSpace(strings.Join(deployments, ",") + " " + run.Reason)
+			if outcome == "" {
+				outcome = "-"
+			}
+			runs = append(runs, []string{strconv.Itoa(i + 1), run.Hook, run.Phase, run.Status, outcome})
+		}
+	}
+	if len(runs) > 0 {
+		fmt.Println("\nHooks:")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "WAVE\tHOOK\tPHASE\tSTATUS\tOUTCOME")
+		for _, run := range runs {
+			fmt.Fprintln(w, strings.Join(run, "\t"))
+		}
+		w.Flush()
+	}
+
+	for i, wave := range r.Waves {
+		switch {
+		case wave.Approval != nil:
+			fmt.Printf("\nWave %d approved by %s at %s", i+1, wave.Approval.Approver, wave.Approval.ApprovedAt.Format(time.RFC3339))
+			if wave.Approval.Comment != "" {
+				fmt.Printf(": %s", wave.Approval.Comment)
+			}
+			fmt.Println()
+		case wave.RequiresApproval:
+			fmt.Printf("\nWave %d requires approval: cctl approve %s\n", i+1, r.ID)
+		}
+	}
+}
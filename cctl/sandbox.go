@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// showSandbox prints the NetworkPolicy that enforces a deployment's sandbox
+// as YAML, ready for kubectl apply, followed by the pod annotations of its
+// seccomp and AppArmor profiles as comments.
+func showSandbox(id string) {
+	policy, err := cc.DeploymentSandbox(context.Background(), id)
+	if err != nil {
+		fail(err, "Error: Failed to get the sandbox of deployment %s", id)
+	}
+	data, err := toYAML(policy.NetworkPolicy)
+	if err != nil {
+		fmt.Printf("Error: Failed to render the NetworkPolicy: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(data)
+	keys := make([]string, 0, len(policy.PodAnnotations))
+	for key := range policy.PodAnnotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Println("# Pod annotations:")
+	for _, key := range keys {
+		fmt.Printf("#   %s: %s\n", key, policy.PodAnnotations[key])
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+func handleSecretsCmd(args []string) {
+	usage := "Usage: cctl secrets list | create <name> [--provider openai|anthropic|generic] [--from-env <var>] | rotate <name> [--batch-size <n>] [--from-env <var>] | rollout <name> | delete <name>"
+	if len(args) < 1 {
+		fmt.Println(usage)
+		os.Exit(exitInvalid)
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		listSecrets()
+	case args[0] == "create" && len(args) >= 2:
+		createCmd := flag.NewFlagSet("secrets create", flag.ExitOnError)
+		provider := createCmd.String("provider", "generic", "Provider the key is for: openai, anthropic, or generic.")
+		fromEnv := createCmd.String("from-env", "", "Read the value from this environment variable instead of standard input.")
+		createCmd.Parse(args[2:])
+		createSecret(client.SecretRequest{Name: args[1], Provider: *provider, Value: readSecretValue(*fromEnv)})
+	case args[0] == "rotate" && len(args) >= 2:
+		rotateCmd := flag.NewFlagSet("secrets rotate", flag.ExitOnError)
+		batchSize := rotateCmd.Int("batch-size", 0, "Restart this many deployments using the secret at a time; 0 restarts them all at once.")
+		fromEnv := rotateCmd.String("from-env", "", "Read the value from this environment variable instead of standard input.")
+		rotateCmd.Parse(args[2:])
+		rotateSecret(args[1], client.RotateSecretRequest{Value: readSecretValue(*fromEnv), BatchSize: *batchSize})
+	case args[0] == "rollout" && len(args) == 2:
+		showSecretRollout(args[1])
+	case args[0] == "delete" && len(args) == 2:
+		deleteSecret(args[1])
+	default:
+		fmt.Println(usage)
+		os.Exit(exitInvalid)
+	}
+}
+
+// readSecretValue reads a secret value from an environment variable, or else
+// the first line of standard input, so that it never appears in the command
+// line or shell history.
+func readSecretValue(fromEnv string) string {
+	if fromEnv != "" {
+		value := os.Getenv(fromEnv)
+		if value == "" {
+			failInvalid("%s is not set", fromEnv)
+		}
+		return value
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		if err != nil {
+			fail(err, "Error: Failed to read the secret value from standard input")
+		}
+		failInvalid("The secret value read from standard input is empty")
+	}
+	return value
+}
+
+// listSecrets prints secrets, without their values, in a table.
+func listSecrets() {
+	secrets, err := cc.ListSecrets(context.Background())
+	if err != nil {
+		fail(err, "Error: Failed to list secrets")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPROVIDER\tVERSION\tROTATED AT (UTC)")
+	for _, s := range secrets {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Name, s.Provider, s.Version, s.RotatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// createSecret stores a new secret.
+func createSecret(req client.SecretRequest) {
+	secret, err := cc.CreateSecret(context.Background(), req)
+	if err != nil {
+		fail(err, "Secret request failed")
+	}
+	fmt.Printf("Secret %s stored for provider %s\n", secret.Name, secret.Provider)
+}
+
+// rotateSecret stores a new value of a secret and prints the rollout that
+// restarts the deployments using it.
+func rotateSecret(name string, req client.RotateSecretRequest) {
+	rollout, err := cc.RotateSecret(context.Background(), name, req)
+	if err != nil {
+		fail(err, "Secret request failed")
+	}
+	fmt.Printf("Secret %s rotated to version %d\n\n", name, rollout.Version)
+	printSecretRollout(rollout)
+}
+
+// showSecretRollout prints the progress of the latest rotation of a secret.
+func showSecretRollout(name string) {
+	rollout, err := cc.SecretRollout(context.Background(), name)
+	if err != nil {
+		fail(err, "Error: Failed to get rollout of secret %s", name)
+	}
+	printSecretRollout(rollout)
+}
+
+func printSecretRollout(rollout *client.SecretRollout) {
+	batch := "all at once"
+	if rollout.BatchSize > 0 {
+		batch = strconv.Itoa(rollout.BatchSize)
+	}
+	fmt.Printf("Secret:     %s v%d\n", rollout.Secret, rollout.Version)
+	fmt.Printf("State:      %s\n", rollout.State)
+	fmt.Printf("Batch Size: %s\n", batch)
+	fmt.Printf("Started At: %s\n", rollout.StartedAt.Format(time.RFC3339))
+	if rollout.HaltedBy != "" {
+		fmt.Printf("Halted By:  %s\n", rollout.HaltedBy)
+	}
+	fmt.Printf("Restarted:  %s\n", strings.Join(rollout.Updated, ", "))
+	fmt.Printf("Pending:    %s\n", strings.Join(rollout.Pending, ", "))
+}
+
+// deleteSecret deletes a secret that no deployment uses.
+func deleteSecret(name string) {
+	if err := cc.DeleteSecret(context.Background(), name); err != nil {
+		fail(err, "Secret request failed")
+	}
+	fmt.Printf("Secret %s deleted\n", name)
+}
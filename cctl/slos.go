@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func handleSLOsCmd(args []string) {
+	slosCmd := flag.NewFlagSet("slos", flag.ExitOnError)
+	project := slosCmd.String("project", "", "Only show the deployments of this project.")
+	agent := slosCmd.String("agent", "", "Only show the deployments on this agent.")
+	slosCmd.Parse(args)
+	if slosCmd.NArg() > 0 {
+		fmt.Println("Usage: cctl slos [--project <name>] [--agent <id>]")
+		os.Exit(exitInvalid)
+	}
+	listSLOs(*project, *agent)
+}
+
+// listSLOs prints the SLO compliance of deployments, least error budget left
+// first.
+func listSLOs(project, agentID string) {
+	statuses, err := cc.SLOReport(context.Background(), project, agentID)
+	if err != nil {
+		fail(err, "Error: Failed to get the SLO report")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tPROJECT\tOBJECTIVE\tAVAILABILITY\tDOWNTIME\tBUDGET LEFT\tBURN RATE\tCOMPLIANT")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%g%% / %s\t%.3f%%\t%ds\t%.1f%%\t%.1f\t%t\n",
+			s.DeploymentID, s.Project, s.SLO.Target, s.SLO.Window, s.Availability, s.DowntimeSeconds, s.BudgetRemaining, s.BurnRate, s.Compliant)
+	}
+	w.Flush()
+}
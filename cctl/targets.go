@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"edge-orchestration/client"
+)
+
+// targetColumns are the columns a targets file may have, named like the
+// deploy flags they stand for, and how each sets a deployment request.
+var targetColumns = map[string]func(req *client.DeploymentRequest, value string) error{
+	"agent": func(req *client.DeploymentRequest, value string) error {
+		req.AgentID = value
+		return nil
+	},
+	"selector": func(req *client.DeploymentRequest, value string) error {
+		req.AgentSelector = make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			key, label, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected <key>=<value>,..., got %q", value)
+			}
+			req.AgentSelector[key] = label
+		}
+		return nil
+	},
+	"image": func(req *client.DeploymentRequest, value string) error {
+		req.ImageURL = value
+		return nil
+	},
+	"bundle": func(req *client.DeploymentRequest, value string) error {
+		req.Bundle = value
+		return nil
+	},
+	"project": func(req *client.DeploymentRequest, value string) error {
+		req.Project = value
+		return nil
+	},
+	"channel": func(req *client.DeploymentRequest, value string) error {
+		req.Channel = value
+		return nil
+	},
+	"auto-update": func(req *client.DeploymentRequest, value string) (err error) {
+		req.AutoUpdate, err = strconv.ParseBool(value)
+		return err
+	},
+	"reschedule-after": func(req *client.DeploymentRequest, value string) error {
+		req.RescheduleAfter = value
+		return nil
+	},
+	"cpu": func(req *client.DeploymentRequest, value string) error {
+		resources(req).CPU = value
+		return nil
+	},
+	"memory": func(req *client.DeploymentRequest, value string) error {
+		resources(req).Memory = value
+		return nil
+	},
+	"gpu": func(req *client.DeploymentRequest, value string) (err error) {
+		resources(req).GPU, err = strconv.Atoi(value)
+		return err
+	},
+	"gpu-model": func(req *client.DeploymentRequest, value string) error {
+		resources(req).GPUModel = value
+		return nil
+	},
+}
+
+// resources returns the resources of a request, adding them if it has none.
+func resources(req *client.DeploymentRequest) *client.Resources {
+	if req.Resources == nil {
+		req.Resources = &client.Resources{}
+	}
+	return req.Resources
+}
+
+// readTargets reads deployment requests from a CSV file with a header row
+// naming its columns, one request per row, e.g.
+//
+//	agent,image,project
+//	store-104,registry.example.com/pos:2.3,retail
+//
+// Each column may appear once. Empty cells are left unset, and lines starting with # are skipped. Each
+// request is labeled with the file and line it came from.
+func readTargets(path string) []batchSpec {
+	f, err := os.Open(path)
+	if err != nil {
+		failInvalid("Failed to read targets: %v", err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		failInvalid("Failed to read the header of %s: %v", path, err)
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := targetColumns[header[i]]; !ok {
+			known := make([]string, 0, len(targetColumns))
+			for name := range targetColumns {
+				known = append(known, name)
+			}
+			slices.Sort(known)
+			failInvalid("Unknown column %q in %s; columns are %s", name, path, strings.Join(known, ", "))
+		}
+		if slices.Contains(header[:i], header[i]) {
+			failInvalid("Duplicate column %q in %s", name, path)
+		}
+	}
+
+	var specs []batchSpec
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			failInvalid("Failed to parse targets: %v", err)
+		}
+		line, _ := r.FieldPos(0)
+		spec := batchSpec{File: fmt.Sprintf("%s:%d", path, line)}
+		for i, value := range row {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			if err := targetColumns[header[i]](&spec.Request, value); err != nil {
+				failInvalid("Invalid %s in %s: %v", header[i], spec.File, err)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		failInvalid("No targets found in %s", path)
+	}
+	return specs
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// listFlags collects the values of a repeated flag.
+type listFlags []string
+
+func (f *listFlags) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *listFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// templateFuncs are the functions spec templates can call besides Go's
+// built-in ones.
+var templateFuncs = template.FuncMap{
+	// toJson renders a value as JSON, e.g. to quote a string in a JSON spec.
+	"toJson": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// specValues reads the values spec templates are rendered with: the YAML
+// files in valueFiles merged in order, then each --set of the form
+// <key>[.<key>]...=<value>. Later values override earlier ones.
+func specValues(valueFiles, sets []string) (map[string]any, error) {
+	values := map[string]any{}
+	for _, file := range valueFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fileValues map[string]any
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("invalid values file %s: %w", file, err)
+		}
+		mergeValues(values, fileValues)
+	}
+	for _, set := range sets {
+		path, raw, ok := strings.Cut(set, "=")
+		keys := strings.Split(path, ".")
+		if !ok || slices.Contains(keys, "") {
+			return nil, fmt.Errorf("invalid --set %q: expected <key>[.<key>]...=<value>", set)
+		}
+		// Integers and booleans are set as such. Anything else, such as
+		// 1.20, is the string given, so that versions keep their digits.
+		var value any = raw
+		var parsed any
+		if yaml.Unmarshal([]byte(raw), &parsed) == nil {
+			switch parsed.(type) {
+			case bool, int, uint64:
+				value = parsed
+			}
+		}
+		nested := values
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := nested[key].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				nested[key] = next
+			}
+			nested = next
+		}
+		nested[keys[len(keys)-1]] = value
+	}
+	return values, nil
+}
+
+// mergeValues merges src into dst, recursing into maps both have.
+func mergeValues(dst, src map[string]any) {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]any); ok {
+			if dstMap, ok := dst[key].(map[string]any); ok {
+				mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// renderSpec renders a spec file as a Go template with values as its data.
+// Referring to a value that is not set is an error, so that a missing --set
+// does not deploy an empty field.
+func renderSpec(file string, data []byte, values map[string]any) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(file)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func handleUsageCmd(args []string) {
+	usageCmd := flag.NewFlagSet("usage", flag.ExitOnError)
+	project := usageCmd.String("project", "", "Only report the deployments of this project.")
+	agent := usageCmd.String("agent", "", "Only report the deployments on this agent.")
+	since := usageCmd.String("since", "", "Only report usage since this RFC 3339 time, or for this long, e.g. 720h; defaults to everything retained.")
+	usageCmd.Parse(args)
+	if usageCmd.NArg() > 0 {
+		fmt.Println("Usage: cctl usage [--project <name>] [--agent <id>] [--since <time|duration>]")
+		os.Exit(exitInvalid)
+	}
+	var from time.Time
+	if *since != "" {
+		if t, err := time.Parse(time.RFC3339, *since); err == nil {
+			from = t
+		} else if d, err := time.ParseDuration(*since); err == nil && d > 0 {
+			from = time.Now().Add(-d).UTC()
+		} else {
+			failInvalid("--since must be an RFC 3339 time or a positive duration, e.g. 720h")
+		}
+	}
+	reportUsage(*project, *agent, from)
+}
+
+// reportUsage prints the inference requests and tokens of each deployment
+// and project.
+func reportUsage(project, agentID string, since time.Time) {
+	report, err := cc.UsageReport(context.Background(), project, agentID, since)
+	if err != nil {
+		fail(err, "Error: Failed to get the usage report")
+	}
+	fmt.Printf("Usage from %s to %s\n\n", report.Since.Format(time.RFC3339), report.Until.Format(time.RFC3339))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tPROJECT\tMODEL\tREQUESTS\tERRORS\tPROMPT TOKENS\tCOMPLETION TOKENS\tTOTAL TOKENS")
+	for _, d := range report.Deployments {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			d.DeploymentID, d.Project, orDash(d.Model), d.Requests, d.Errors, d.PromptTokens, d.CompletionTokens, d.TotalTokens)
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tDEPLOYMENTS\tREQUESTS\tERRORS\tPROMPT TOKENS\tCOMPLETION TOKENS\tTOTAL TOKENS")
+	for _, p := range report.Projects {
+		name := p.Project
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", name, p.Deployments, p.Requests, p.Errors, p.PromptTokens, p.CompletionTokens, p.TotalTokens)
+	}
+	w.Flush()
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-orchestration/client"
+)
+
+const (
+	// rolloutPollInterval is how often --wait checks on a rollout's waves.
+	rolloutPollInterval = 2 * time.Second
+	// watchRetryInterval is how long --wait waits before reopening a
+	// deployment's event stream that ended.
+	watchRetryInterval = time.Second
+	// maxProgressRows caps the deployments the live display lists.
+	maxProgressRows = 10
+)
+
+// ANSI escape sequences of the live display.
+const (
+	ansiClearLine = "\r\033[K"
+	ansiUp        = "\033[%dA"
+	ansiGreen     = "\033[32m"
+	ansiYellow    = "\033[33m"
+	ansiRed       = "\033[31m"
+	ansiReset     = "\033[0m"
+)
+
+// errSettled stops watching a deployment that reached a final status.
+var errSettled = errors.New("deployment settled")
+
+// settled reports whether --wait is done with a deployment in the given
+// status, and if so, whether it came up.
+func settled(status client.DeploymentStatus) (done, ok bool) {
+	switch status {
+	case client.StatusRunning, client.StatusSucceeded:
+		return true, true
+	case client.StatusFailed, client.StatusPaused, client.StatusCancelled, client.StatusExpired, client.StatusSuperseded, client.StatusRemoved, client.StatusDeleted:
+		return true, false
+	}
+	return false, false
+}
+
+// progress tracks deployments --wait waits for and shows how far they got:
+// redrawn in place on a terminal, and as a line per change otherwise.
+type progress struct {
+	mu      sync.Mutex
+	start   time.Time
+	live    bool // Redraw the display in place
+	color   bool
+	drawn   int    // Lines of the display drawn last
+	phase   string // What a rollout is doing, if waiting for one
+	ids     []string
+	deps    map[string]*client.Deployment
+	events  map[string]client.DeploymentEvent // Latest timeline entry of each deployment
+	changed chan struct{}
+}
+
+// newProgress returns a display that draws in place and in color on a
+// terminal, unless noColor is set or NO_COLOR is.
+func newProgress(noColor bool) *progress {
+	live := false
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb" {
+		live = true
+	}
+	return &progress{
+		start:   time.Now(),
+		live:    live,
+		color:   live && !noColor && os.Getenv("NO_COLOR") == "",
+		deps:    make(map[string]*client.Deployment),
+		events:  make(map[string]client.DeploymentEvent),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// watch follows a deployment until it settles or ctx is done, reopening its
+// event stream when it ends.
+func (p *progress) watch(ctx context.Context, id string) {
+	p.mu.Lock()
+	p.ids = append(p.ids, id)
+	p.mu.Unlock()
+	for {
+		err := cc.WatchDeployment(ctx, id, func(change client.DeploymentChange) error {
+			return p.update(id, change)
+		})
+		if errors.Is(err, errSettled) || ctx.Err() != nil {
+			return
+		}
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+			p.log(id, fmt.Sprintf("Stopped watching: %v", err))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// update records a change to a deployment, and reports errSettled once it
+// reached a final status.
+func (p *progress) update(id string, change client.DeploymentChange) error {
+	p.mu.Lock()
+	if change.Deployment != nil {
+		old := p.deps[id]
+		p.deps[id] = change.Deployment
+		if !p.live && (old == nil || old.Status != change.Deployment.Status) {
+			p.printLine(id, change.Deployment, change.Deployment.Reason)
+		}
+	}
+	if change.Event != nil {
+		latest, seen := p.events[id]
+		if !seen || change.Event.Time.After(latest.Time) {
+			p.events[id] = *change.Event
+			if !p.live && seen && change.Event.Message != "" {
+				p.printLine(id, p.deps[id], change.Event.Message)
+			}
+		}
+	}
+	dep := p.deps[id]
+	p.mu.Unlock()
+	p.signal()
+	if dep != nil {
+		if done, _ := settled(dep.Status); done {
+			return errSettled
+		}
+	}
+	return nil
+}
+
+// setPhase sets what a rollout is doing.
+func (p *progress) setPhase(phase string) {
+	p.mu.Lock()
+	changed := phase != p.phase
+	p.phase = phase
+	if changed && !p.live {
+		fmt.Printf("%s  %s\n", p.elapsed(), phase)
+	}
+	p.mu.Unlock()
+	p.signal()
+}
+
+// log notes something about a deployment, shown like a timeline entry.
+func (p *progress) log(id, msg string) {
+	p.mu.Lock()
+	p.events[id] = client.DeploymentEvent{Time: time.Now(), Message: msg}
+	if !p.live {
+		p.printLine(id, p.deps[id], msg)
+	}
+	p.mu.Unlock()
+	p.signal()
+}
+
+func (p *progress) signal() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// counts returns how many deployments came up and how many settled without.
+func (p *progress) counts() (ready, failed int) {
+	for _, id := range p.ids {
+		if dep := p.deps[id]; dep != nil {
+			if done, ok := settled(dep.Status); ok {
+				ready++
+			} else if done {
+				failed++
+			}
+		}
+	}
+	return ready, failed
+}
+
+// elapsed renders the time since the wait started, e.g. "01:05".
+func (p *progress) elapsed() string {
+	d := time.Since(p.start).Round(time.Second)
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// printLine prints a line about a deployment for displays that do not
+// redraw. The caller must hold the lock.
+func (p *progress) printLine(id string, dep *client.Deployment, msg string) {
+	status := "unknown"
+	if dep != nil {
+		status = string(dep.Status)
+	}
+	line := fmt.Sprintf("%s  %s  %s", p.elapsed(), id, status)
+	if msg != "" {
+		line += ": " + msg
+	}
+	fmt.Println(line)
+}
+
+// draw redraws the live display in place. The caller must hold the lock.
+func (p *progress) draw() {
+	if p.drawn > 0 {
+		fmt.Printf(ansiUp, p.drawn)
+	}
+	ready, failed := p.counts()
+	lines := []string{fmt.Sprintf("%d/%d ready", ready, len(p.ids))}
+	if failed > 0 {
+		lines[0] += fmt.Sprintf(", %s", p.paint(ansiRed, fmt.Sprintf("%d failed", failed)))
+	}
+	if p.phase != "" {
+		lines[0] += "  " + p.phase
+	}
+	lines[0] += "  " + p.elapsed()
+
+	ids := append([]string(nil), p.ids...)
+	// Deployments still in progress come first, then failed ones.
+	rank := func(id string) int {
+		if dep := p.deps[id]; dep != nil {
+			if done, ok := settled(dep.Status); done && ok {
+				return 2
+			} else if done {
+				return 1
+			}
+		}
+		return 0
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return rank(ids[i]) < rank(ids[j]) })
+	for i, id := range ids {
+		if i == maxProgressRows {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(ids)-maxProgressRows))
+			break
+		}
+		status, color, msg := "unknown", ansiYellow, ""
+		if event, ok := p.events[id]; ok {
+			msg = event.Message
+			if msg == "" {
+				msg = event.Type
+			}
+		}
+		if dep := p.deps[id]; dep != nil {
+			status = string(dep.Status)
+			if done, ok := settled(dep.Status); ok {
+				color = ansiGreen
+			} else if done {
+				color = ansiRed
+				if dep.Reason != "" {
+					msg = dep.Reason
+				}
+			}
+		}
+		line := fmt.Sprintf("  %-14s %s %s", id, p.paint(color, fmt.Sprintf("%-12s", status)), msg)
+		lines = append(lines, line)
+	}
+	for _, line := range lines {
+		fmt.Print(ansiClearLine + line + "\n")
+	}
+	p.drawn = len(lines)
+}
+
+// paint colors s if the display is in color.
+func (p *progress) paint(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// run redraws the live display until done is closed, then prints a summary
+// and reports whether every deployment came up.
+func (p *progress) run(done <-chan struct{}) bool {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		p.mu.Lock()
+		if p.live {
+			p.draw()
+		}
+		p.mu.Unlock()
+		select {
+		case <-done:
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.live {
+				p.draw()
+			}
+			ready, failed := p.counts()
+			summary := fmt.Sprintf("%d/%d ready, %d failed after %s", ready, len(p.ids), failed, p.elapsed())
+			if p.phase != "" {
+				summary = p.phase + "; " + summary
+			}
+			fmt.Println(summary)
+			return failed == 0 && ready == len(p.ids)
+		case <-p.changed:
+		case <-tick.C:
+		}
+	}
+}
+
+// waitForDeployments shows the deployments' progress until each of them is
+// running or has failed, and exits with an error if any failed.
+func waitForDeployments(ids []string, noColor bool) {
+	p := newProgress(noColor)
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.watch(context.Background(), id)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	if !p.run(done) {
+		os.Exit(exitFailure)
+	}
+}
+
+// waitForRollout shows a rollout's progress, and that of the deployments of
+// its waves as they start, until it completes, halts, or is rolled back. It
+// exits with an error unless it completed.
+func waitForRollout(id string, noColor bool) {
+	p := newProgress(noColor)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	watching := make(map[string]bool)
+	done := make(chan struct{})
+	completed := false
+	go func() {
+		defer close(done)
+		for {
+			r, err := cc.GetRollout(ctx, id)
+			if err != nil {
+				var apiErr *client.APIError
+				if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+					fail(err, "Error: Failed to get rollout %s", id)
+				}
+				time.Sleep(rolloutPollInterval)
+				continue
+			}
+			for _, wave := range r.Waves {
+				for _, depID := range wave.Deployments {
+					if !watching[depID] {
+						watching[depID] = true
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							p.watch(ctx, depID)
+						}()
+					}
+				}
+			}
+			phase := fmt.Sprintf("wave %d/%d %s", min(r.CurrentWave+1, len(r.Waves)), len(r.Waves), strings.ReplaceAll(r.Status, "_", " "))
+			if r.Status == "running" && r.CurrentWave < len(r.Waves) {
+				phase = fmt.Sprintf("wave %d/%d %s", r.CurrentWave+1, len(r.Waves), strings.ReplaceAll(r.Waves[r.CurrentWave].Status, "_", " "))
+			}
+			if r.Reason != "" {
+				phase += ": " + r.Reason
+			}
+			p.setPhase(phase)
+			switch r.Status {
+			case "completed", "halted", "rolled_back":
+				completed = r.Status == "completed"
+				// Deployments a halted rollout leaves behind keep going;
+				// there is nothing left to wait for.
+				if !completed {
+					cancel()
+				}
+				wg.Wait()
+				return
+			}
+			time.Sleep(rolloutPollInterval)
+		}
+	}()
+	if !p.run(done) || !completed {
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// ListRegistries returns the health of registries that failed recently.
+func (c *Client) ListRegistries(ctx context.Context) ([]RegistryHealth, error) {
+	var registries []RegistryHealth
+	err := c.call(ctx, http.MethodGet, apiV1+"/registries", nil, &registries)
+	return registries, err
+}
+
+// APIVersions returns the versions of the API the control center serves,
+// oldest first.
+func (c *Client) APIVersions(ctx context.Context) ([]APIVersionInfo, error) {
+	var versions []APIVersionInfo
+	err := c.call(ctx, http.MethodGet, "/api/versions", nil, &versions)
+	return versions, err
+}
+
+// Backup writes a snapshot of the control center's state to w and returns
+// its size.
+func (c *Client) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	resp, err := c.send(ctx, http.MethodGet, apiV1+"/admin/backup", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// Restore replaces the control center's state with a snapshot written by Backup.
+func (c *Client) Restore(ctx context.Context, backup io.Reader) (*RestoreResult, error) {
+	body, err := io.ReadAll(backup)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, http.MethodPost, apiV1+"/admin/restore", body, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result RestoreResult
+	if err := decode(resp, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ListAgents returns the registered agents, including deleted ones if
+// includeArchived is set.
+func (c *Client) ListAgents(ctx context.Context, includeArchived bool) ([]Agent, error) {
+	var agents []Agent
+	err := c.call(ctx, http.MethodGet, apiV1+"/agents?include_archived="+strconv.FormatBool(includeArchived), nil, &agents)
+	return agents, err
+}
+
+// SelectAgents returns the agents that are not deleted and have every label
+// of a selector.
+func (c *Client) SelectAgents(ctx context.Context, selector map[string]string) ([]Agent, error) {
+	pairs := make([]string, 0, len(selector))
+	for key, value := range selector {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	var agents []Agent
+	err := c.call(ctx, http.MethodGet, apiV1+"/agents?selector="+url.QueryEscape(strings.Join(pairs, ",")), nil, &agents)
+	return agents, err
+}
+
+// GetAgent returns an agent.
+func (c *Client) GetAgent(ctx context.Context, id string) (*Agent, error) {
+	var agent Agent
+	if err := c.call(ctx, http.MethodGet, apiV1+"/agents/"+url.PathEscape(id), nil, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// AdmissionQueue returns the deployments being admitted to an agent and the
+// ones waiting to be.
+func (c *Client) AdmissionQueue(ctx context.Context, id string) (*AdmissionQueue, error) {
+	var q AdmissionQueue
+	if err := c.call(ctx, http.MethodGet, apiV1+"/agents/"+url.PathEscape(id)+"/queue", nil, &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// AgentProxy sends a request through an agent's reverse tunnel to its
+// cluster's API, e.g. GET /api/v1/namespaces/default/pods/web/log, and
+// returns the response body as the cluster streams it. The path may have a
+// query. The caller must close the body. It fails with status 503 if the
+// agent has no tunnel open.
+func (c *Client) AgentProxy(ctx context.Context, id, method, path string, body []byte) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, method, apiV1+"/agents/"+url.PathEscape(id)+"/proxy/"+strings.TrimPrefix(path, "/"), body, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DeleteAgent archives an agent that has no active deployments.
+func (c *Client) DeleteAgent(ctx context.Context, id string) (*Agent, error) {
+	var agent Agent
+	if err := c.call(ctx, http.MethodDelete, apiV1+"/agents/"+url.PathEscape(id), nil, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// SetImageRewrites replaces an agent's image rewrite rules; no rules clears them.
+func (c *Client) SetImageRewrites(ctx context.Context, id string, rules []ImageRewrite) (*Agent, error) {
+	if rules == nil {
+		rules = []ImageRewrite{}
+	}
+	var agent Agent
+	if err := c.call(ctx, http.MethodPut, apiV1+"/agents/"+url.PathEscape(id)+"/image-rewrites", rules, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// CordonAgent puts an agent in maintenance. New deployments to it are
+// rejected, or queued until UncordonAgent if queue is set.
+func (c *Client) CordonAgent(ctx context.Context, id, reason string, queue bool) (*Agent, error) {
+	m := Maintenance{Reason: reason, OnDeploy: "reject"}
+	if queue {
+		m.OnDeploy = "queue"
+	}
+	var agent Agent
+	if err := c.call(ctx, http.MethodPut, apiV1+"/agents/"+url.PathEscape(id)+"/maintenance", m, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// UncordonAgent takes an agent out of maintenance and admits the deployments
+// queued for it.
+func (c *Client) UncordonAgent(ctx context.Context, id string) (*Agent, error) {
+	var agent Agent
+	if err := c.call(ctx, http.MethodDelete, apiV1+"/agents/"+url.PathEscape(id)+"/maintenance", nil, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
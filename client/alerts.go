@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListAlertRules returns all alert rules.
+func (c *Client) ListAlertRules(ctx context.Context) ([]AlertRule, error) {
+	var rules []AlertRule
+	err := c.call(ctx, http.MethodGet, apiV1+"/alert-rules", nil, &rules)
+	return rules, err
+}
+
+// GetAlertRule returns an alert rule.
+func (c *Client) GetAlertRule(ctx context.Context, name string) (*AlertRule, error) {
+	var rule AlertRule
+	if err := c.call(ctx, http.MethodGet, apiV1+"/alert-rules/"+url.PathEscape(name), nil, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// PutAlertRule creates an alert rule or replaces the one with the same name.
+func (c *Client) PutAlertRule(ctx context.Context, rule AlertRule) (*AlertRule, error) {
+	var created AlertRule
+	if err := c.call(ctx, http.MethodPut, apiV1+"/alert-rules/"+url.PathEscape(rule.Name), rule, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// DeleteAlertRule deletes an alert rule.
+func (c *Client) DeleteAlertRule(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/alert-rules/"+url.PathEscape(name), nil, nil)
+}
+
+// ListAlerts returns firing alerts and recently resolved ones, or only those
+// in the given state ("firing" or "resolved") if it is not empty.
+func (c *Client) ListAlerts(ctx context.Context, state string) ([]Alert, error) {
+	path := apiV1 + "/alerts"
+	if state != "" {
+		path += "?state=" + url.QueryEscape(state)
+	}
+	var alerts []Alert
+	err := c.call(ctx, http.MethodGet, path, nil, &alerts)
+	return alerts, err
+}
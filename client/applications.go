@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListApplications returns all applications.
+func (c *Client) ListApplications(ctx context.Context) ([]Application, error) {
+	var apps []Application
+	err := c.call(ctx, http.MethodGet, apiV1+"/applications", nil, &apps)
+	return apps, err
+}
+
+// CreateApplication creates an application and deploys its components.
+func (c *Client) CreateApplication(ctx context.Context, req ApplicationRequest) (*Application, error) {
+	var app Application
+	if err := c.call(ctx, http.MethodPost, apiV1+"/applications", req, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// GetApplication returns an application.
+func (c *Client) GetApplication(ctx context.Context, id string) (*Application, error) {
+	var app Application
+	if err := c.call(ctx, http.MethodGet, apiV1+"/applications/"+url.PathEscape(id), nil, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// DeleteApplication tears down an application's deployments and deletes it.
+func (c *Client) DeleteApplication(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/applications/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateBootstrapToken issues a token agents can register themselves with.
+// The returned token is the only copy of its secret.
+func (c *Client) CreateBootstrapToken(ctx context.Context, req BootstrapTokenRequest) (*BootstrapToken, error) {
+	var token BootstrapToken
+	if err := c.call(ctx, http.MethodPost, apiV1+"/bootstrap-tokens", req, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListBootstrapTokens returns the bootstrap tokens that have not expired,
+// without their secrets, oldest first.
+func (c *Client) ListBootstrapTokens(ctx context.Context) ([]BootstrapToken, error) {
+	var tokens []BootstrapToken
+	if err := c.call(ctx, http.MethodGet, apiV1+"/bootstrap-tokens", nil, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteBootstrapToken revokes a bootstrap token.
+func (c *Client) DeleteBootstrapToken(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/bootstrap-tokens/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"edge-orchestration/api/types"
+)
+
+// ListBundles returns all bundles, oldest first.
+func (c *Client) ListBundles(ctx context.Context) ([]Bundle, error) {
+	var bundles []Bundle
+	err := c.call(ctx, http.MethodGet, apiV1+"/bundles", nil, &bundles)
+	return bundles, err
+}
+
+// CreateBundle starts packaging an image as a bundle for the given platform,
+// e.g. "linux/arm64", or the control center's if empty. The bundle can be
+// deployed once its status is "ready".
+func (c *Client) CreateBundle(ctx context.Context, imageURL, platform string) (*Bundle, error) {
+	var b Bundle
+	body := types.BundleRequest{ImageURL: imageURL, Platform: platform}
+	if err := c.call(ctx, http.MethodPost, apiV1+"/bundles", body, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetBundle returns a bundle.
+func (c *Client) GetBundle(ctx context.Context, id string) (*Bundle, error) {
+	var b Bundle
+	if err := c.call(ctx, http.MethodGet, apiV1+"/bundles/"+url.PathEscape(id), nil, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// DeleteBundle deletes a bundle that no deployment uses.
+func (c *Client) DeleteBundle(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/bundles/"+url.PathEscape(id), nil, nil)
+}
+
+// DownloadBundle opens a bundle's archive starting at byte offset, to resume
+// an interrupted download. It returns the archive's content and the offset it
+// starts at, which is 0 if the control center sends the whole archive. The
+// caller must close the content. An offset at or past the end of the archive
+// fails with status 416.
+func (c *Client) DownloadBundle(ctx context.Context, id string, offset int64) (io.ReadCloser, int64, error) {
+	var header http.Header
+	if offset > 0 {
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", offset)}}
+	}
+	resp, err := c.send(ctx, http.MethodGet, apiV1+"/bundles/"+url.PathEscape(id)+"/content", nil, header)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		offset = 0
+	}
+	return resp.Body, offset, nil
+}
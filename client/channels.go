@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListChannels returns all release channels.
+func (c *Client) ListChannels(ctx context.Context) ([]Channel, error) {
+	var channels []Channel
+	err := c.call(ctx, http.MethodGet, apiV1+"/channels", nil, &channels)
+	return channels, err
+}
+
+// GetChannel returns a release channel and its latest release of each
+// repository.
+func (c *Client) GetChannel(ctx context.Context, name string) (*Channel, error) {
+	var ch Channel
+	if err := c.call(ctx, http.MethodGet, apiV1+"/channels/"+url.PathEscape(name), nil, &ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// PublishRelease publishes an image to a release channel, creating the
+// channel if needed, and rolls it out to the deployments that follow it.
+func (c *Client) PublishRelease(ctx context.Context, channel string, req PublishRequest) (*PublishResult, error) {
+	var result PublishResult
+	if err := c.call(ctx, http.MethodPost, apiV1+"/channels/"+url.PathEscape(channel)+"/releases", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteChannel deletes a release channel. Deployments that follow it keep
+// their images.
+func (c *Client) DeleteChannel(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/channels/"+url.PathEscape(name), nil, nil)
+}
@@ -0,0 +1,401 @@
+// Package client is a Go client for the control center's HTTP API.
+//
+// A Client is safe for concurrent use. Every call takes a context, sends an
+// X-Request-ID so that it can be found in the control center's logs, and is
+// retried when the control center rate-limits it or, for calls that are safe
+// to repeat, when it cannot be reached:
+//
+//	cc := client.New("http://control-center:8080", client.WithToken(token))
+//	dep, err := cc.CreateDeployment(ctx, client.DeploymentRequest{
+//		AgentID:  agentID,
+//		ImageURL: "nginx:1.27",
+//	})
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+const (
+	// DefaultAddress is the control center address used when none is configured.
+	DefaultAddress = "http://localhost:8080"
+	// RequestIDHeader carries the ID of an API call in requests and responses.
+	RequestIDHeader = "X-Request-ID"
+	// APIVersion is the version of the API the client speaks.
+	APIVersion = types.APIVersion
+
+	apiV1          = "/api/" + APIVersion
+	defaultRetries = 3
+	// maxRetryWait caps how long a rate-limited call waits before retrying,
+	// whatever Retry-After asks for.
+	maxRetryWait = 30 * time.Second
+)
+
+// Client calls the control center's HTTP API.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string // Sent as a bearer token if set
+	breakGlass string // Justification for changes during freeze windows, if set
+	retries    int    // Attempts after the first one
+	backoff    time.Duration
+
+	onDeprecation   func(Deprecation) // Called once when the API version is deprecated, if set
+	deprecationOnce sync.Once
+	tracef          func(format string, args ...any) // Logs requests, responses, and retries, if set
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for calls, e.g. to set timeouts or
+// TLS settings. The default is http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken sends a bearer token with every call. The control center only
+// checks it to identify approvers of rollout waves and for backups and
+// restores, which require its ADMIN_TOKEN; otherwise it is for gateways and
+// proxies in front of it.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithBreakGlass sends a justification that lets changes through freeze
+// windows with every call. The control center records it on the freeze.
+func WithBreakGlass(justification string) Option {
+	return func(c *Client) { c.breakGlass = justification }
+}
+
+// WithRetries sets how often a failed call is retried; 0 disables retries.
+// The default is 3.
+func WithRetries(retries int) Option {
+	return func(c *Client) { c.retries = retries }
+}
+
+// WithBackoff sets how long the first retry of a call waits; each further
+// retry waits twice as long as the one before. Retry-After on rate-limited
+// calls takes precedence. The default is 500ms.
+func WithBackoff(backoff time.Duration) Option {
+	return func(c *Client) { c.backoff = backoff }
+}
+
+// WithDeprecationHandler calls fn the first time the control center reports
+// that the API version the client speaks is deprecated, e.g. to warn the user
+// to upgrade before it is sunset.
+func WithDeprecationHandler(fn func(Deprecation)) Option {
+	return func(c *Client) { c.onDeprecation = fn }
+}
+
+// WithTrace logs every request, response, and retry through logf, e.g.
+// log.Printf, to diagnose failing calls. Credentials in headers are
+// redacted, and request bodies, which may carry secrets, are only counted.
+func WithTrace(logf func(format string, args ...any)) Option {
+	return func(c *Client) { c.tracef = logf }
+}
+
+// Deprecation is the control center's announcement that an API version is
+// deprecated.
+type Deprecation struct {
+	Version   string    // e.g. "v1"
+	Since     time.Time // When the version was or will be deprecated
+	Sunset    time.Time // When the version may stop being served; zero if not announced
+	Successor string    // Path of the endpoint in the version that replaces it, if given
+}
+
+func (d Deprecation) String() string {
+	msg := fmt.Sprintf("API %s of the control center is deprecated since %s", d.Version, d.Since.Format(time.DateOnly))
+	if time.Now().Before(d.Since) {
+		msg = fmt.Sprintf("API %s of the control center will be deprecated on %s", d.Version, d.Since.Format(time.DateOnly))
+	}
+	if !d.Sunset.IsZero() {
+		msg += fmt.Sprintf(" and may stop being served on %s", d.Sunset.Format(time.DateOnly))
+	}
+	return msg + "; upgrade this client"
+}
+
+// New creates a client for the control center at baseURL, e.g.
+// "http://localhost:8080", or at the Unix socket of a local control center,
+// e.g. "unix:///run/control-center/api.sock".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    500 * time.Millisecond,
+	}
+	socket, overSocket := strings.CutPrefix(baseURL, "unix://")
+	if overSocket {
+		c.baseURL = "http://localhost"
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if overSocket {
+		c.httpClient = dialingSocket(c.httpClient, socket)
+	}
+	return c
+}
+
+// dialingSocket returns a copy of hc that connects to a Unix socket whatever
+// the host of the URL. Clients with transports other than *http.Transport
+// are returned as they are, since their connections cannot be redirected.
+func dialingSocket(hc *http.Client, socket string) *http.Client {
+	var t *http.Transport
+	switch rt := hc.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		return hc
+	}
+	t.Proxy = nil
+	t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	copied := *hc
+	copied.Transport = t
+	return &copied
+}
+
+// NewFromEnv creates a client for the control center in CONTROL_CENTER_ADDR,
+// or DefaultAddress, that sends the bearer token in CONTROL_CENTER_TOKEN, if
+// set. Options override the environment.
+func NewFromEnv(opts ...Option) *Client {
+	addr := os.Getenv("CONTROL_CENTER_ADDR")
+	if addr == "" {
+		addr = DefaultAddress
+	}
+	if token := os.Getenv("CONTROL_CENTER_TOKEN"); token != "" {
+		opts = append([]Option{WithToken(token)}, opts...)
+	}
+	return New(addr, opts...)
+}
+
+// APIError is returned when the control center answers a call with an error
+// status.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string       // The response body, e.g. "Deployment not found"
+	Fields     []FieldError // Fields of the request body that do not match its schema, if that is why it failed
+	RequestID  string       // ID the control center logged the call under
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s failed with status %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+	for _, f := range e.Fields {
+		msg += "; " + f.String()
+	}
+	return msg
+}
+
+// InvalidFields returns the fields of the request body that err reports do
+// not match its schema, if any.
+func InvalidFields(err error) []FieldError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Fields
+	}
+	return nil
+}
+
+// IsNotFound reports whether err is an APIError for a resource that does not exist.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// RequestID returns the ID of the failed call err comes from, or "" if it
+// did not reach the control center.
+func RequestID(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RequestID
+	}
+	return ""
+}
+
+// call sends a JSON request body, unless in is nil, and decodes the JSON
+// response into out, unless out is nil.
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	resp, err := c.send(ctx, method, path, body, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return decode(resp, out)
+}
+
+// decode decodes a JSON response body.
+func decode(resp *http.Response, v any) error {
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// send makes a call and returns the response if its status is 2xx; the caller
+// must close its body. Other statuses are returned as an APIError.
+func (c *Client) send(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if c.breakGlass != "" {
+			req.Header.Set(types.BreakGlassHeader, c.breakGlass)
+		}
+		// Retries keep the ID, so that all attempts can be found together.
+		req.Header.Set(RequestIDHeader, requestID)
+		req.Header.Set(types.AcceptVersionHeader, APIVersion)
+
+		c.traceRequest(req, len(body), attempt)
+		start := time.Now()
+		resp, err := c.httpClient.Do(req)
+		c.traceResponse(method, req.URL.String(), resp, err, time.Since(start))
+		wait, retry := c.shouldRetry(method, resp, err, attempt)
+		if retry {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			c.trace("Retrying %s %s in %s (attempt %d of %d)", method, path, wait, attempt+2, c.retries+1)
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to control center: %w", err)
+		}
+		c.checkDeprecation(resp)
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		apiErr := &APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+			// The control center echoes the ID, or replaces it if a proxy
+			// sent an invalid one.
+			RequestID: resp.Header.Get(RequestIDHeader),
+		}
+		var invalid ValidationError
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") && json.Unmarshal(message, &invalid) == nil && len(invalid.Errors) > 0 {
+			apiErr.Message, apiErr.Fields = invalid.Message, invalid.Errors
+		}
+		return nil, apiErr
+	}
+}
+
+// checkDeprecation passes the deprecation a response announces to the
+// deprecation handler, the first time there is one.
+func (c *Client) checkDeprecation(resp *http.Response) {
+	value := resp.Header.Get("Deprecation")
+	if c.onDeprecation == nil || value == "" {
+		return
+	}
+	c.deprecationOnce.Do(func() {
+		d := Deprecation{Version: resp.Header.Get(types.APIVersionHeader)}
+		if seconds, err := strconv.ParseInt(strings.TrimPrefix(value, "@"), 10, 64); err == nil {
+			d.Since = time.Unix(seconds, 0).UTC()
+		}
+		if sunset, err := http.ParseTime(resp.Header.Get("Sunset")); err == nil {
+			d.Sunset = sunset.UTC()
+		}
+		for _, link := range resp.Header.Values("Link") {
+			if target, params, ok := strings.Cut(link, ";"); ok && strings.Contains(params, `rel="successor-version"`) {
+				d.Successor = strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+		c.onDeprecation(d)
+	})
+}
+
+// shouldRetry decides whether a call is retried and how long to wait first.
+// Rate-limited calls are always retried, since the control center rejected
+// them before doing anything. Calls that may have been carried out are only
+// retried if repeating them is harmless.
+func (c *Client) shouldRetry(method string, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.retries {
+		return 0, false
+	}
+	wait := c.backoff << attempt
+	idempotent := method == http.MethodGet || method == http.MethodHead || method == http.MethodPut || method == http.MethodDelete
+	switch {
+	case err != nil:
+		return wait, idempotent && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return min(wait, maxRetryWait), true
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		// Only a Retry-After says the control center or a proxy in front of
+		// it is briefly unavailable, e.g. while restarting; otherwise what
+		// is missing, such as an agent's tunnel, may not come back soon.
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return min(time.Duration(seconds)*time.Second, maxRetryWait), err == nil && idempotent
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout:
+		// A proxy in front of the control center could not reach it.
+		return wait, idempotent
+	}
+	return 0, false
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
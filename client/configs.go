@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListConfigs returns all configs.
+func (c *Client) ListConfigs(ctx context.Context) ([]Config, error) {
+	var configs []Config
+	err := c.call(ctx, http.MethodGet, apiV1+"/configs", nil, &configs)
+	return configs, err
+}
+
+// GetConfig returns a config.
+func (c *Client) GetConfig(ctx context.Context, name string) (*Config, error) {
+	var cfg Config
+	if err := c.call(ctx, http.MethodGet, apiV1+"/configs/"+url.PathEscape(name), nil, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SetConfig creates or replaces a config. Deployments using it are rolled
+// out all at once.
+func (c *Client) SetConfig(ctx context.Context, name string, data map[string]string) (*Config, error) {
+	return c.SetConfigInBatches(ctx, name, data, 0)
+}
+
+// SetConfigInBatches creates or replaces a config. Deployments using it
+// without pinning a version are rolled out batchSize at a time, or all at
+// once if it is 0.
+func (c *Client) SetConfigInBatches(ctx context.Context, name string, data map[string]string, batchSize int) (*Config, error) {
+	var cfg Config
+	body := struct {
+		Data      map[string]string `json:"data"`
+		BatchSize int               `json:"batch_size,omitempty"`
+	}{data, batchSize}
+	if err := c.call(ctx, http.MethodPut, apiV1+"/configs/"+url.PathEscape(name), body, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ConfigVersions returns every version of a config, oldest first.
+func (c *Client) ConfigVersions(ctx context.Context, name string) ([]Config, error) {
+	var versions []Config
+	err := c.call(ctx, http.MethodGet, apiV1+"/configs/"+url.PathEscape(name)+"/versions", nil, &versions)
+	return versions, err
+}
+
+// GetConfigVersion returns one version of a config.
+func (c *Client) GetConfigVersion(ctx context.Context, name string, version int) (*Config, error) {
+	var cfg Config
+	if err := c.call(ctx, http.MethodGet, apiV1+"/configs/"+url.PathEscape(name)+"/versions/"+strconv.Itoa(version), nil, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ConfigRollout returns the progress of the latest rollout of a config.
+func (c *Client) ConfigRollout(ctx context.Context, name string) (*ConfigRollout, error) {
+	var rollout ConfigRollout
+	if err := c.call(ctx, http.MethodGet, apiV1+"/configs/"+url.PathEscape(name)+"/rollout", nil, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// DeleteConfig deletes a config that no deployment uses.
+func (c *Client) DeleteConfig(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/configs/"+url.PathEscape(name), nil, nil)
+}
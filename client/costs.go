@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CostReport estimates what deployments cost, optionally only those of a
+// project or an agent.
+func (c *Client) CostReport(ctx context.Context, project, agentID string) (*CostReport, error) {
+	q := url.Values{}
+	if project != "" {
+		q.Set("project", project)
+	}
+	if agentID != "" {
+		q.Set("agent_id", agentID)
+	}
+	path := apiV1 + "/reports/costs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var report CostReport
+	if err := c.call(ctx, http.MethodGet, path, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// SetAgentPrices sets the price hints an agent's deployments are estimated
+// with.
+func (c *Client) SetAgentPrices(ctx context.Context, id string, prices Prices) (*Agent, error) {
+	var agent Agent
+	if err := c.call(ctx, http.MethodPut, apiV1+"/agents/"+url.PathEscape(id)+"/prices", prices, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// ClearAgentPrices makes an agent's deployments use the control center's
+// default price hints.
+func (c *Client) ClearAgentPrices(ctx context.Context, id string) (*Agent, error) {
+	var agent Agent
+	if err := c.call(ctx, http.MethodDelete, apiV1+"/agents/"+url.PathEscape(id)+"/prices", nil, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
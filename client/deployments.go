@@ -0,0 +1,273 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"edge-orchestration/api/types"
+)
+
+// ListDeployments returns an agent's deployments, including archived ones if
+// includeArchived is set.
+func (c *Client) ListDeployments(ctx context.Context, agentID string, includeArchived bool) ([]Deployment, error) {
+	query := url.Values{"agent_id": {agentID}, "include_archived": {strconv.FormatBool(includeArchived)}}
+	var deployments []Deployment
+	err := c.call(ctx, http.MethodGet, apiV1+"/deployments?"+query.Encode(), nil, &deployments)
+	return deployments, err
+}
+
+// CreateDeployment creates a deployment.
+func (c *Client) CreateDeployment(ctx context.Context, req DeploymentRequest) (*Deployment, error) {
+	var dep Deployment
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments", req, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// DeployToSelector creates a deployment from req on every agent whose labels
+// match req.AgentSelector; req.AgentID must be empty. It returns the outcome
+// per agent.
+func (c *Client) DeployToSelector(ctx context.Context, req DeploymentRequest) (*BatchResponse, error) {
+	var result BatchResponse
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DryRunDeployment validates a deployment request and checks it against
+// admission policies, freezes, and quotas like CreateDeployment, and returns
+// what it would create, with its Kubernetes manifests, without creating it.
+func (c *Client) DryRunDeployment(ctx context.Context, req DeploymentRequest) (*DryRun, error) {
+	var result DryRun
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments?dry_run=true", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetDeployment returns a deployment.
+func (c *Client) GetDeployment(ctx context.Context, id string) (*Deployment, error) {
+	var dep Deployment
+	if err := c.call(ctx, http.MethodGet, apiV1+"/deployments/"+url.PathEscape(id), nil, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// UpdateDeployment applies a patch to a deployment if it is still at the
+// given resource version, so that concurrent changes are not lost. A new
+// image starts a new revision. The control center answers 412 if the
+// deployment changed since it was read.
+func (c *Client) UpdateDeployment(ctx context.Context, id string, resourceVersion int, patch DeploymentPatch) (*Deployment, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"If-Match": {strconv.Quote(strconv.Itoa(resourceVersion))}}
+	resp, err := c.send(ctx, http.MethodPatch, apiV1+"/deployments/"+url.PathEscape(id), body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var dep Deployment
+	if err := decode(resp, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// DeleteDeployment tears a deployment down and archives it.
+func (c *Client) DeleteDeployment(ctx context.Context, id string) (*Deployment, error) {
+	var dep Deployment
+	if err := c.call(ctx, http.MethodDelete, apiV1+"/deployments/"+url.PathEscape(id), nil, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// CancelDeployment cancels a deployment its agent has not started yet.
+func (c *Client) CancelDeployment(ctx context.Context, id, reason string) (*Deployment, error) {
+	var dep Deployment
+	body := map[string]string{"reason": reason}
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments/"+url.PathEscape(id)+"/cancel", body, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// PauseDeployment stops a deployment's workload and releases its quota
+// until it is resumed.
+func (c *Client) PauseDeployment(ctx context.Context, id, reason string) (*Deployment, error) {
+	var dep Deployment
+	body := map[string]string{"reason": reason}
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments/"+url.PathEscape(id)+"/pause", body, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// ResumeDeployment redeploys a paused deployment as a new revision.
+func (c *Client) ResumeDeployment(ctx context.Context, id string) (*Deployment, error) {
+	var dep Deployment
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments/"+url.PathEscape(id)+"/resume", nil, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// PromoteDeployment makes a shadow deployment serve the requests for its
+// model.
+func (c *Client) PromoteDeployment(ctx context.Context, id string) (*Deployment, error) {
+	var dep Deployment
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments/"+url.PathEscape(id)+"/promote", nil, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
+
+// DeploymentEvents returns a deployment's event timeline, oldest first.
+func (c *Client) DeploymentEvents(ctx context.Context, id string) ([]DeploymentEvent, error) {
+	var events []DeploymentEvent
+	err := c.call(ctx, http.MethodGet, apiV1+"/deployments/"+url.PathEscape(id)+"/events", nil, &events)
+	return events, err
+}
+
+// maxEventSize caps the size of a line of a deployment's event stream.
+const maxEventSize = 1 << 20
+
+// DeploymentChange is a change WatchDeployment reports: the deployment as it
+// is now, or an entry added to its timeline.
+type DeploymentChange struct {
+	Deployment *Deployment      // Set when the deployment changed
+	Event      *DeploymentEvent // Set for a new entry of its timeline
+}
+
+// WatchDeployment calls fn with a deployment and every entry of its
+// timeline, and then with each change to them, until ctx is done or fn
+// returns an error, which it returns. It returns nil if the control center
+// ends the stream, e.g. because the deployment was purged or a proxy closed
+// the connection; calling it again starts over from the current state.
+func (c *Client) WatchDeployment(ctx context.Context, id string, fn func(DeploymentChange) error) error {
+	header := http.Header{"Accept": {"text/event-stream"}}
+	resp, err := c.send(ctx, http.MethodGet, apiV1+"/deployments/"+url.PathEscape(id)+"/events", nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxEventSize)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			var change DeploymentChange
+			switch event {
+			case "deployment":
+				change.Deployment = new(Deployment)
+				err = json.Unmarshal([]byte(data), change.Deployment)
+			case "event":
+				change.Event = new(DeploymentEvent)
+				err = json.Unmarshal([]byte(data), change.Event)
+			default:
+				// Newer control centers may send events this client does
+				// not know.
+				event, data = "", ""
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("GET %s: invalid %s event: %w", resp.Request.URL.Path, event, err)
+			}
+			if err := fn(change); err != nil {
+				return err
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("GET %s: %w", resp.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// DeploymentSLO returns a deployment's compliance with its SLO.
+func (c *Client) DeploymentSLO(ctx context.Context, id string) (*SLOStatus, error) {
+	var status SLOStatus
+	if err := c.call(ctx, http.MethodGet, apiV1+"/deployments/"+url.PathEscape(id)+"/slo", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// DeploymentSandbox returns the NetworkPolicy and pod annotations that
+// enforce a deployment's sandbox.
+func (c *Client) DeploymentSandbox(ctx context.Context, id string) (*SandboxPolicy, error) {
+	var policy SandboxPolicy
+	if err := c.call(ctx, http.MethodGet, apiV1+"/deployments/"+url.PathEscape(id)+"/sandbox", nil, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeploymentManifest writes the Kubernetes manifests that run a deployment
+// and its add-ons to w as YAML documents.
+func (c *Client) DeploymentManifest(ctx context.Context, id string, w io.Writer) error {
+	resp, err := c.send(ctx, http.MethodGet, apiV1+"/deployments/"+url.PathEscape(id)+"/manifest", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// SLOReport returns the compliance of the active deployments with an SLO,
+// optionally only those of a project or an agent, least error budget left
+// first.
+func (c *Client) SLOReport(ctx context.Context, project, agentID string) ([]SLOStatus, error) {
+	q := url.Values{}
+	if project != "" {
+		q.Set("project", project)
+	}
+	if agentID != "" {
+		q.Set("agent_id", agentID)
+	}
+	path := apiV1 + "/reports/slos"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var statuses []SLOStatus
+	err := c.call(ctx, http.MethodGet, path, nil, &statuses)
+	return statuses, err
+}
+
+// MaxBatchSize caps the number of creates and deletes of a Batch call.
+const MaxBatchSize = types.MaxBatchSize
+
+// Batch creates and deletes deployments in one call. Operations succeed or
+// fail individually; the response reports each of them.
+func (c *Client) Batch(ctx context.Context, create []DeploymentRequest, delete []string) (*BatchResponse, error) {
+	body := types.BatchRequest{Create: create, Delete: delete}
+	var result BatchResponse
+	if err := c.call(ctx, http.MethodPost, apiV1+"/deployments:batch", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"edge-orchestration/api/types"
+)
+
+// ListFleets returns all fleets with the aggregated status of their agents
+// and deployments.
+func (c *Client) ListFleets(ctx context.Context) ([]FleetStatus, error) {
+	var fleets []FleetStatus
+	err := c.call(ctx, http.MethodGet, apiV1+"/fleets", nil, &fleets)
+	return fleets, err
+}
+
+// GetFleet returns a fleet with the aggregated status of its agents and
+// deployments.
+func (c *Client) GetFleet(ctx context.Context, name string) (*FleetStatus, error) {
+	var fleet FleetStatus
+	if err := c.call(ctx, http.MethodGet, apiV1+"/fleets/"+url.PathEscape(name), nil, &fleet); err != nil {
+		return nil, err
+	}
+	return &fleet, nil
+}
+
+// SetFleet creates a fleet or replaces its agents.
+func (c *Client) SetFleet(ctx context.Context, name string, agentIDs []string) (*FleetStatus, error) {
+	if agentIDs == nil {
+		agentIDs = []string{}
+	}
+	var fleet FleetStatus
+	if err := c.call(ctx, http.MethodPut, apiV1+"/fleets/"+url.PathEscape(name), types.FleetRequest{Agents: agentIDs}, &fleet); err != nil {
+		return nil, err
+	}
+	return &fleet, nil
+}
+
+// DeleteFleet deletes a fleet. Deployments made to it keep running.
+func (c *Client) DeleteFleet(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/fleets/"+url.PathEscape(name), nil, nil)
+}
+
+// DeployToFleet creates a deployment on every agent of a fleet; req.AgentID
+// must be empty. Deployments succeed or fail per agent, and the response
+// reports each of them, indexed by the agent's position in the fleet.
+func (c *Client) DeployToFleet(ctx context.Context, name string, req DeploymentRequest) (*BatchResponse, error) {
+	var result BatchResponse
+	if err := c.call(ctx, http.MethodPost, apiV1+"/fleets/"+url.PathEscape(name)+"/deployments", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// StartRollout deploys a request to a fleet in waves; req.Deployment.AgentID
+// must be empty. The rollout runs on the control center, and GetRollout
+// reports its progress.
+func (c *Client) StartRollout(ctx context.Context, name string, req RolloutRequest) (*Rollout, error) {
+	var rollout Rollout
+	if err := c.call(ctx, http.MethodPost, apiV1+"/fleets/"+url.PathEscape(name)+"/rollouts", req, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// ListRollouts returns all rollouts, newest first.
+func (c *Client) ListRollouts(ctx context.Context) ([]Rollout, error) {
+	var rollouts []Rollout
+	err := c.call(ctx, http.MethodGet, apiV1+"/rollouts", nil, &rollouts)
+	return rollouts, err
+}
+
+// GetRollout returns a rollout and the state of its waves.
+func (c *Client) GetRollout(ctx context.Context, id string) (*Rollout, error) {
+	var rollout Rollout
+	if err := c.call(ctx, http.MethodGet, apiV1+"/rollouts/"+url.PathEscape(id), nil, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// ApproveRollout lets the wave a rollout is waiting at start. The client's
+// token identifies the approver and must be one of the control center's
+// ROLLOUT_APPROVERS.
+func (c *Client) ApproveRollout(ctx context.Context, id, comment string) (*Rollout, error) {
+	var rollout Rollout
+	if err := c.call(ctx, http.MethodPost, apiV1+"/rollouts/"+url.PathEscape(id)+"/approve", types.ApproveRequest{Comment: comment}, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
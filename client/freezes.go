@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListFreezes returns all freeze windows, including past ones.
+func (c *Client) ListFreezes(ctx context.Context) ([]Freeze, error) {
+	var freezes []Freeze
+	err := c.call(ctx, http.MethodGet, apiV1+"/freezes", nil, &freezes)
+	return freezes, err
+}
+
+// GetFreeze returns a freeze window and the break-glass changes made during
+// it.
+func (c *Client) GetFreeze(ctx context.Context, id string) (*Freeze, error) {
+	var f Freeze
+	if err := c.call(ctx, http.MethodGet, apiV1+"/freezes/"+url.PathEscape(id), nil, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// CreateFreeze creates a freeze window during which deployments in its scope
+// cannot be changed without a break-glass justification.
+func (c *Client) CreateFreeze(ctx context.Context, req FreezeRequest) (*Freeze, error) {
+	var f Freeze
+	if err := c.call(ctx, http.MethodPost, apiV1+"/freezes", req, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// DeleteFreeze deletes a freeze window, ending it early.
+func (c *Client) DeleteFreeze(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/freezes/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ModelEndpoints lists the running model serving deployments the inference
+// gateway routes requests to.
+func (c *Client) ModelEndpoints(ctx context.Context) ([]ModelEndpoint, error) {
+	var list []ModelEndpoint
+	if err := c.call(ctx, http.MethodGet, apiV1+"/gateway/endpoints", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListShadows returns the shadow deployments and how they compare with the
+// deployments serving the requests mirrored to them.
+func (c *Client) ListShadows(ctx context.Context) ([]ShadowStats, error) {
+	var list []ShadowStats
+	if err := c.call(ctx, http.MethodGet, apiV1+"/gateway/shadows", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,12 @@
+module edge-orchestration/client
+
+go 1.24.3
+
+require (
+	edge-orchestration/api v0.0.0
+	github.com/gorilla/websocket v1.5.4-0.20250319132907-e064f32e3674
+)
+
+require golang.org/x/net v0.26.0 // indirect
+
+replace edge-orchestration/api => ../api
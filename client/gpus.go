@@ -0,0 +1,16 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// GPUCapacity lists the GPUs of the agents that reported theirs, and how many
+// of them deployments request.
+func (c *Client) GPUCapacity(ctx context.Context) ([]AgentGPUs, error) {
+	var list []AgentGPUs
+	if err := c.call(ctx, http.MethodGet, apiV1+"/gpus", nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
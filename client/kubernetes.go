@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListKubernetesDeployments lists the Deployments in the cluster the control
+// center operates in and the deployments that adopted them. With unmanaged,
+// only Deployments no tool manages are listed.
+func (c *Client) ListKubernetesDeployments(ctx context.Context, unmanaged bool) ([]KubernetesWorkload, error) {
+	path := apiV1 + "/kubernetes/deployments"
+	if unmanaged {
+		path += "?unmanaged=true"
+	}
+	var list []KubernetesWorkload
+	if err := c.call(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// AdoptKubernetesDeployment places a Kubernetes Deployment's workload under
+// control center management and returns the deployment that took it over.
+func (c *Client) AdoptKubernetesDeployment(ctx context.Context, namespace, name string, req AdoptRequest) (*Deployment, error) {
+	var dep Deployment
+	path := apiV1 + "/kubernetes/deployments/" + url.PathEscape(namespace) + "/" + url.PathEscape(name) + "/adopt"
+	if err := c.call(ctx, http.MethodPost, path, req, &dep); err != nil {
+		return nil, err
+	}
+	return &dep, nil
+}
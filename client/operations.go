@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateOperation queues an apply or delete of Kubernetes objects in an
+// agent's cluster, which the agent carries out against its local Kubernetes
+// API. The operation is returned before the agent has carried it out; poll
+// GetOperation for its results.
+func (c *Client) CreateOperation(ctx context.Context, agentID string, req ClusterOperationRequest) (*ClusterOperation, error) {
+	var op ClusterOperation
+	if err := c.call(ctx, http.MethodPost, apiV1+"/agents/"+url.PathEscape(agentID)+"/operations", req, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// ListOperations returns an agent's recent cluster operations, oldest first.
+func (c *Client) ListOperations(ctx context.Context, agentID string) ([]ClusterOperation, error) {
+	var ops []ClusterOperation
+	if err := c.call(ctx, http.MethodGet, apiV1+"/agents/"+url.PathEscape(agentID)+"/operations", nil, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// GetOperation returns one of an agent's cluster operations.
+func (c *Client) GetOperation(ctx context.Context, agentID, id string) (*ClusterOperation, error) {
+	var op ClusterOperation
+	if err := c.call(ctx, http.MethodGet, apiV1+"/agents/"+url.PathEscape(agentID)+"/operations/"+url.PathEscape(id), nil, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"edge-orchestration/api/types"
+	"edge-orchestration/api/wsconn"
+)
+
+// PortForward opens a connection to a port of a running pod of a deployment,
+// through the control center and, if the deployment's cluster is behind its
+// agent, the agent's reverse tunnel. Each call forwards one connection; the
+// caller must close it.
+func (c *Client) PortForward(ctx context.Context, deploymentID string, port int) (io.ReadWriteCloser, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	path := apiV1 + "/deployments/" + url.PathEscape(deploymentID) + "/port-forward"
+	u.Path += path
+	u.RawQuery = url.Values{"port": {strconv.Itoa(port)}}.Encode()
+
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set(RequestIDHeader, requestID)
+	header.Set(types.AcceptVersionHeader, APIVersion)
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	dialer := &websocket.Dialer{Proxy: http.ProxyFromEnvironment}
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		dialer.Proxy, dialer.TLSClientConfig, dialer.NetDialContext = t.Proxy, t.TLSClientConfig, t.DialContext
+	}
+	c.trace("> GET %s (request ID %s, WebSocket upgrade)", u, requestID)
+	c.traceHeaders(">", header)
+	start := time.Now()
+	ws, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if resp != nil {
+		// A refused upgrade is an error too, but its status tells more.
+		c.traceResponse(http.MethodGet, u.String(), resp, nil, time.Since(start))
+	} else {
+		c.traceResponse(http.MethodGet, u.String(), nil, err, time.Since(start))
+	}
+	if err != nil {
+		if resp == nil {
+			return nil, fmt.Errorf("failed to connect to control center: %w", err)
+		}
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, &APIError{
+			Method:     http.MethodGet,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+			RequestID:  resp.Header.Get(RequestIDHeader),
+		}
+	}
+	return wsconn.New(ws), nil
+}
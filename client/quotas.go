@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListQuotas returns all quotas and their usage.
+func (c *Client) ListQuotas(ctx context.Context) ([]QuotaStatus, error) {
+	var quotas []QuotaStatus
+	err := c.call(ctx, http.MethodGet, apiV1+"/quotas", nil, &quotas)
+	return quotas, err
+}
+
+// SetQuota creates or replaces the quota of an agent or project.
+func (c *Client) SetQuota(ctx context.Context, q Quota) (*QuotaStatus, error) {
+	var status QuotaStatus
+	if err := c.call(ctx, http.MethodPut, apiV1+"/quotas/"+url.PathEscape(q.Scope)+"/"+url.PathEscape(q.Name), q, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// DeleteQuota deletes the quota of an agent or project.
+func (c *Client) DeleteQuota(ctx context.Context, scope, name string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/quotas/"+url.PathEscape(scope)+"/"+url.PathEscape(name), nil, nil)
+}
+
+// ListPolicies returns all admission policies. The control center answers
+// 503 if its policy engine is not configured.
+func (c *Client) ListPolicies(ctx context.Context) ([]Policy, error) {
+	var policies []Policy
+	err := c.call(ctx, http.MethodGet, apiV1+"/policies", nil, &policies)
+	return policies, err
+}
+
+// SetPolicy creates or replaces an admission policy.
+func (c *Client) SetPolicy(ctx context.Context, id, rego string) (*Policy, error) {
+	var policy Policy
+	if err := c.call(ctx, http.MethodPut, apiV1+"/policies/"+url.PathEscape(id), map[string]string{"rego": rego}, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeletePolicy deletes an admission policy.
+func (c *Client) DeletePolicy(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/policies/"+url.PathEscape(id), nil, nil)
+}
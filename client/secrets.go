@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListSecrets returns all secrets, without their values.
+func (c *Client) ListSecrets(ctx context.Context) ([]Secret, error) {
+	var secrets []Secret
+	err := c.call(ctx, http.MethodGet, apiV1+"/secrets", nil, &secrets)
+	return secrets, err
+}
+
+// CreateSecret stores a new secret.
+func (c *Client) CreateSecret(ctx context.Context, req SecretRequest) (*Secret, error) {
+	var secret Secret
+	if err := c.call(ctx, http.MethodPost, apiV1+"/secrets", req, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// GetSecret returns a secret, without its value.
+func (c *Client) GetSecret(ctx context.Context, name string) (*Secret, error) {
+	var secret Secret
+	if err := c.call(ctx, http.MethodGet, apiV1+"/secrets/"+url.PathEscape(name), nil, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// RotateSecret stores a new value of a secret and starts restarting the
+// deployments that use it.
+func (c *Client) RotateSecret(ctx context.Context, name string, req RotateSecretRequest) (*SecretRollout, error) {
+	var rollout SecretRollout
+	if err := c.call(ctx, http.MethodPost, apiV1+"/secrets/"+url.PathEscape(name)+"/rotate", req, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// SecretRollout returns the progress of the latest rotation of a secret.
+func (c *Client) SecretRollout(ctx context.Context, name string) (*SecretRollout, error) {
+	var rollout SecretRollout
+	if err := c.call(ctx, http.MethodGet, apiV1+"/secrets/"+url.PathEscape(name)+"/rollout", nil, &rollout); err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// DeleteSecret deletes a secret that no deployment uses.
+func (c *Client) DeleteSecret(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, apiV1+"/secrets/"+url.PathEscape(name), nil, nil)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// redactedHeaders carry credentials, so traces leave out their values.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// trace logs a line if tracing is on.
+func (c *Client) trace(format string, args ...any) {
+	if c.tracef != nil {
+		c.tracef(format, args...)
+	}
+}
+
+// traceRequest logs a request about to be sent, with its headers.
+func (c *Client) traceRequest(req *http.Request, bodySize, attempt int) {
+	if c.tracef == nil {
+		return
+	}
+	c.tracef("> %s %s (request ID %s, attempt %d, %d byte body)", req.Method, req.URL, req.Header.Get(RequestIDHeader), attempt+1, bodySize)
+	c.traceHeaders(">", req.Header)
+}
+
+// traceResponse logs the response to a request, with its headers, or why
+// there was none.
+func (c *Client) traceResponse(method, target string, resp *http.Response, err error, elapsed time.Duration) {
+	if c.tracef == nil {
+		return
+	}
+	elapsed = elapsed.Round(time.Millisecond)
+	if err != nil {
+		c.tracef("< %s %s failed after %s: %v", method, target, elapsed, err)
+		return
+	}
+	c.tracef("< %s %s: %s in %s (request ID %s)", method, target, resp.Status, elapsed, resp.Header.Get(RequestIDHeader))
+	c.traceHeaders("<", resp.Header)
+}
+
+// traceHeaders logs headers in name order, redacting credentials.
+func (c *Client) traceHeaders(prefix string, header http.Header) {
+	if c.tracef == nil {
+		return
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if slices.Contains(redactedHeaders, http.CanonicalHeaderKey(name)) {
+			value = "[redacted]"
+		}
+		c.tracef("%s   %s: %s", prefix, name, value)
+	}
+}
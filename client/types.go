@@ -0,0 +1,119 @@
+package client
+
+import "edge-orchestration/api/types"
+
+// The request and response bodies of the control center's API are defined in
+// edge-orchestration/api/types and shared with the control center itself.
+type (
+	Agent                   = types.Agent
+	ImageRewrite            = types.ImageRewrite
+	Maintenance             = types.Maintenance
+	Deployment              = types.Deployment
+	DeploymentStatus        = types.DeploymentStatus
+	DeploymentRequest       = types.DeploymentRequest
+	DeploymentPatch         = types.DeploymentPatch
+	DeploymentEvent         = types.DeploymentEvent
+	BatchRequest            = types.BatchRequest
+	BatchResponse           = types.BatchResponse
+	BatchResult             = types.BatchResult
+	Resources               = types.Resources
+	Volume                  = types.Volume
+	Artifact                = types.Artifact
+	PVCSource               = types.PVCSource
+	HostPathSource          = types.HostPathSource
+	EmptyDirSource          = types.EmptyDirSource
+	ScanSummary             = types.ScanSummary
+	Config                  = types.Config
+	ConfigRef               = types.ConfigRef
+	ConfigRollout           = types.ConfigRollout
+	Secret                  = types.Secret
+	SecretRequest           = types.SecretRequest
+	RotateSecretRequest     = types.RotateSecretRequest
+	SecretRef               = types.SecretRef
+	SecretRollout           = types.SecretRollout
+	Addon                   = types.Addon
+	Sandbox                 = types.Sandbox
+	EgressRule              = types.EgressRule
+	SandboxPolicy           = types.SandboxPolicy
+	Shadow                  = types.Shadow
+	ShadowStats             = types.ShadowStats
+	LatencyStats            = types.LatencyStats
+	RolloutHook             = types.RolloutHook
+	HookJob                 = types.HookJob
+	HookRun                 = types.HookRun
+	HookEvent               = types.HookEvent
+	KubernetesWorkload      = types.KubernetesWorkload
+	AdoptRequest            = types.AdoptRequest
+	DryRun                  = types.DryRun
+	ValidationError         = types.ValidationError
+	FieldError              = types.FieldError
+	Quota                   = types.Quota
+	QuotaStatus             = types.QuotaStatus
+	QuotaUsage              = types.QuotaUsage
+	Policy                  = types.Policy
+	Application             = types.Application
+	ApplicationRequest      = types.ApplicationRequest
+	ApplicationComponent    = types.ApplicationComponent
+	Bundle                  = types.Bundle
+	Fleet                   = types.Fleet
+	FleetStatus             = types.FleetStatus
+	RolloutRequest          = types.RolloutRequest
+	Rollout                 = types.Rollout
+	RolloutWave             = types.RolloutWave
+	RolloutApproval         = types.RolloutApproval
+	Freeze                  = types.Freeze
+	FreezeRequest           = types.FreezeRequest
+	FreezeOverride          = types.FreezeOverride
+	Channel                 = types.Channel
+	ChannelRelease          = types.ChannelRelease
+	PublishRequest          = types.PublishRequest
+	PublishResult           = types.PublishResult
+	Prices                  = types.Prices
+	DeploymentCost          = types.DeploymentCost
+	ProjectCost             = types.ProjectCost
+	CostReport              = types.CostReport
+	AlertRule               = types.AlertRule
+	AlertReceiver           = types.AlertReceiver
+	Alert                   = types.Alert
+	SLO                     = types.SLO
+	SLOStatus               = types.SLOStatus
+	ModelServing            = types.ModelServing
+	ModelEndpoint           = types.ModelEndpoint
+	GPUInventory            = types.GPUInventory
+	AgentGPUs               = types.AgentGPUs
+	AdmissionQueue          = types.AdmissionQueue
+	ClusterOperation        = types.ClusterOperation
+	ClusterOperationRequest = types.ClusterOperationRequest
+	BootstrapToken          = types.BootstrapToken
+	BootstrapTokenRequest   = types.BootstrapTokenRequest
+	ObjectResult            = types.ObjectResult
+	UsageSample             = types.UsageSample
+	DeploymentUsage         = types.DeploymentUsage
+	ProjectUsage            = types.ProjectUsage
+	UsageReport             = types.UsageReport
+	RegistryHealth          = types.RegistryHealth
+	APIVersionInfo          = types.APIVersionInfo
+	RestoreResult           = types.RestoreResult
+)
+
+// Statuses of deployments; see edge-orchestration/api/types for what they
+// mean.
+const (
+	StatusDeferred    = types.StatusDeferred
+	StatusQueued      = types.StatusQueued
+	StatusWaiting     = types.StatusWaiting
+	StatusPending     = types.StatusPending
+	StatusScheduled   = types.StatusScheduled
+	StatusDeploying   = types.StatusDeploying
+	StatusRunning     = types.StatusRunning
+	StatusDegraded    = types.StatusDegraded
+	StatusRollingBack = types.StatusRollingBack
+	StatusFailed      = types.StatusFailed
+	StatusSucceeded   = types.StatusSucceeded
+	StatusPaused      = types.StatusPaused
+	StatusCancelled   = types.StatusCancelled
+	StatusExpired     = types.StatusExpired
+	StatusSuperseded  = types.StatusSuperseded
+	StatusRemoved     = types.StatusRemoved
+	StatusDeleted     = types.StatusDeleted
+)
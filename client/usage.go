@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ReportUsage adds the inference requests and tokens a deployment served
+// since its previous sample.
+func (c *Client) ReportUsage(ctx context.Context, id string, sample UsageSample) error {
+	return c.call(ctx, http.MethodPost, apiV1+"/deployments/"+url.PathEscape(id)+"/usage", sample, nil)
+}
+
+// UsageReport sums the inference usage of deployments since the given time,
+// or everything retained if it is zero, optionally only those of a project or
+// an agent.
+func (c *Client) UsageReport(ctx context.Context, project, agentID string, since time.Time) (*UsageReport, error) {
+	q := url.Values{}
+	if project != "" {
+		q.Set("project", project)
+	}
+	if agentID != "" {
+		q.Set("agent_id", agentID)
+	}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339))
+	}
+	path := apiV1 + "/reports/usage"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var report UsageReport
+	if err := c.call(ctx, http.MethodGet, path, nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// addonTemplate describes how an add-on type is run and reached.
+type addonTemplate struct {
+	image   string // Repository, tagged with the add-on's version
+	version string // Default tag
+	port    int
+	scheme  string // Scheme of the URL handed to the workload
+	dataDir string // Where the add-on keeps its data
+}
+
+// addonTemplates are the add-on types deployments can declare.
+var addonTemplates = map[string]addonTemplate{
+	"redis":  {image: "redis", version: "7.4", port: 6379, scheme: "redis", dataDir: "/data"},
+	"qdrant": {image: "qdrant/qdrant", version: "v1.12.4", port: 6333, scheme: "http", dataDir: "/qdrant/storage"},
+}
+
+// validateAddons checks a request's add-ons, fills in their names, and clears
+// the fields the control center sets.
+func validateAddons(addons []Addon) error {
+	names := make(map[string]bool, len(addons))
+	for i := range addons {
+		a := &addons[i]
+		if _, known := addonTemplates[a.Type]; !known {
+			return fmt.Errorf("unknown add-on type %q: must be qdrant or redis", a.Type)
+		}
+		if a.Name == "" {
+			a.Name = a.Type
+		}
+		if !validAddonName(a.Name) {
+			return fmt.Errorf("invalid add-on name %q: names must start with a letter and may only contain lowercase letters, digits, and dashes", a.Name)
+		}
+		if names[a.Name] {
+			return fmt.Errorf("add-on %s is declared more than once; give add-ons of the same type a name", a.Name)
+		}
+		names[a.Name] = true
+		if strings.ContainsAny(a.Version, ":@/ ") {
+			return fmt.Errorf("add-on %s: invalid version %q: must be an image tag, e.g. 7.4", a.Name, a.Version)
+		}
+		if a.Storage != "" {
+			if _, err := parseMemory(a.Storage); err != nil {
+				return fmt.Errorf("add-on %s: invalid storage %q", a.Name, a.Storage)
+			}
+		}
+		if _, err := requestedAmounts(a.Resources); err != nil {
+			return fmt.Errorf("add-on %s: %w", a.Name, err)
+		}
+		a.DeploymentID, a.Env = "", nil
+	}
+	return nil
+}
+
+// validAddonName reports whether a name can be used as an add-on name, which
+// also prefixes the environment variables of its connection details.
+func validAddonName(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '-' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// addonEnv returns the connection details of an add-on run by the deployment
+// with the given ID, which is the host name agents give its container. The
+// variables are prefixed with the add-on's name, e.g. REDIS_URL.
+func addonEnv(a Addon, host string) map[string]string {
+	tmpl := addonTemplates[a.Type]
+	prefix := strings.ToUpper(strings.ReplaceAll(a.Name, "-", "_"))
+	port := strconv.Itoa(tmpl.port)
+	return map[string]string{
+		prefix + "_HOST": host,
+		prefix + "_PORT": port,
+		prefix + "_URL":  tmpl.scheme + "://" + host + ":" + port,
+	}
+}
+
+// addonRequest returns the request for the deployment that runs one of a
+// request's add-ons on the same agent. It lives and expires with the
+// workload.
+func addonRequest(req DeploymentRequest, a Addon) DeploymentRequest {
+	tmpl := addonTemplates[a.Type]
+	version := a.Version
+	if version == "" {
+		version = tmpl.version
+	}
+	data := Volume{Name: "data", MountPath: tmpl.dataDir, EmptyDir: &EmptyDirSource{}}
+	if a.Storage != "" {
+		data.EmptyDir, data.PVC = nil, &PVCSource{Size: a.Storage}
+	}
+	return DeploymentRequest{
+		DeploymentRequest: types.DeploymentRequest{
+			AgentID:    req.AgentID,
+			ImageURL:   tmpl.image + ":" + version,
+			Project:    req.Project,
+			Resources:  a.Resources,
+			Volumes:    []Volume{data},
+			TTLSeconds: req.TTLSeconds,
+			ScheduleAt: req.ScheduleAt,
+		},
+		Fleet: req.Fleet,
+	}
+}
+
+// createWithAddons creates the deployments that run a request's add-ons and
+// then the deployment itself, which waits for them to run and receives their
+// connection details. Admission is held back until all of them exist, and
+// none are kept if one cannot be created. The caller must hold the lock.
+func (s *DeploymentStore) createWithAddons(req DeploymentRequest) (*Deployment, error) {
+	s.held = []*Deployment{}
+	defer func() { s.held = nil }()
+
+	req.Addons = slices.Clone(req.Addons)
+	req.dependsOnIDs = slices.Clone(req.dependsOnIDs)
+	var created []*Deployment
+	discard := func() {
+		for _, d := range created {
+			s.discard(d)
+		}
+	}
+	for i, a := range req.Addons {
+		dep, err := s.create(addonRequest(req, a))
+		if err != nil {
+			discard()
+			return nil, fmt.Errorf("add-on %s: %w", a.Name, err)
+		}
+		created = append(created, dep)
+		req.Addons[i].DeploymentID = dep.ID
+		req.Addons[i].Env = addonEnv(a, dep.ID)
+		req.dependsOnIDs = append(req.dependsOnIDs, dep.ID)
+	}
+	dep, err := s.create(req)
+	if err != nil {
+		discard()
+		return nil, err
+	}
+	for i, d := range created {
+		d.AddonOf = dep.ID
+		s.recordEvent(d.ID, "addon", fmt.Sprintf("Runs add-on %s (%s) for deployment %s", req.Addons[i].Name, req.Addons[i].Type, dep.ID))
+	}
+
+	for _, d := range s.held {
+		if s.onPending != nil {
+			s.onPending(d.ID, d.AgentID, d.Revision, pendingImage(d))
+		}
+	}
+	return dep, nil
+}
+
+// archiveAddons removes and archives the deployments that run a deployment's
+// add-ons. The caller must hold the lock.
+func (s *DeploymentStore) archiveAddons(dep *Deployment, now time.Time) {
+	for _, a := range dep.Addons {
+		d, exists := s.deployments[a.DeploymentID]
+		if !exists || d.ArchivedAt != nil {
+			continue
+		}
+		if !retired(d.Status) {
+			s.setStatus(d, types.StatusRemoved)
+			d.Reason = fmt.Sprintf("Deployment %s was deleted", dep.ID)
+			s.recordEvent(d.ID, "removed", d.Reason)
+		}
+		archivedAt := now
+		d.ArchivedAt = &archivedAt
+		s.recordEvent(d.ID, "archived", fmt.Sprintf("Deployment archived with %s", dep.ID))
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRetryBackoff caps the delay between admission attempts.
+const maxRetryBackoff = 5 * time.Minute
+
+// RetryPolicy controls how many workers admit revisions, in which order, how
+// long an attempt may take, and how transient failures, such as an
+// unreachable registry, are retried.
+type RetryPolicy struct {
+	Workers     int
+	Ordered     bool // Admit the revisions for each agent one at a time, in submission order
+	MaxAttempts int
+	Backoff     time.Duration // Delay before the second attempt; doubled for each further attempt
+	Timeout     time.Duration // Limit for a single attempt, including registry, cosign, and trivy calls
+}
+
+// RetryPolicyFromEnv reads the retry policy from the ADMISSION_WORKERS (4),
+// ADMISSION_ORDERED (true), ADMISSION_MAX_ATTEMPTS (5),
+// ADMISSION_RETRY_BACKOFF (2s), and ADMISSION_TIMEOUT (5m) environment
+// variables.
+func RetryPolicyFromEnv() (RetryPolicy, error) {
+	p := RetryPolicy{Workers: 4, Ordered: true, MaxAttempts: 5, Backoff: 2 * time.Second, Timeout: 5 * time.Minute}
+	if v := os.Getenv("ADMISSION_ORDERED"); v != "" {
+		ordered, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid ADMISSION_ORDERED %q: must be true or false", v)
+		}
+		p.Ordered = ordered
+	}
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{{"ADMISSION_WORKERS", &p.Workers}, {"ADMISSION_MAX_ATTEMPTS", &p.MaxAttempts}} {
+		if v := os.Getenv(setting.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return p, fmt.Errorf("invalid %s %q: must be a positive integer", setting.name, v)
+			}
+			*setting.value = n
+		}
+	}
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{{"ADMISSION_RETRY_BACKOFF", &p.Backoff}, {"ADMISSION_TIMEOUT", &p.Timeout}} {
+		if v := os.Getenv(setting.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return p, fmt.Errorf("invalid %s %q: must be a positive duration", setting.name, v)
+			}
+			*setting.value = d
+		}
+	}
+	return p, nil
+}
+
+// backoff returns the delay after the given failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
+
+// admissionJob is one attempt at admitting a deployment revision.
+type admissionJob struct {
+	id       string
+	agentID  string
+	revision int
+	imageURL string
+	attempt  int
+	queued   time.Time // When the job was last queued
+}
+
+// Admission prepares pending deployment revisions before agents may pick them
+// up. Preparation pins the image tag to its digest so that every agent deploys
+// exactly the same content, and optionally verifies the image's signature and
+// scans it for vulnerabilities. Revisions are admitted by a pool of workers
+// that retry transient failures with exponential backoff. When ordered, the
+// revisions for an agent are admitted one at a time, so that they are
+// scheduled in the order they were submitted even when an earlier one takes
+// longer or is retried.
+type Admission struct {
+	store    *DeploymentStore
+	registry *RegistryClient    // nil when digest resolution is disabled
+	verifier *SignatureVerifier // nil when signature verification is disabled
+	scanner  *ImageScanner      // nil when vulnerability scanning is disabled
+	retry    RetryPolicy
+
+	mu        sync.Mutex
+	ready     *sync.Cond
+	queue     []admissionJob
+	inFlight  map[string]context.CancelFunc // Cancels the running attempt, by deployment ID
+	admitting map[string]string             // Agent of the revisions an attempt is running or waiting to be retried for, by deployment ID
+}
+
+// NewAdmission creates an admission stage for the store and starts its
+// workers. A nil registry client, verifier, or scanner disables the
+// corresponding step.
+func NewAdmission(store *DeploymentStore, registry *RegistryClient, verifier *SignatureVerifier, scanner *ImageScanner, retry RetryPolicy) *Admission {
+	a := &Admission{
+		store:     store,
+		registry:  registry,
+		verifier:  verifier,
+		scanner:   scanner,
+		retry:     retry,
+		inFlight:  make(map[string]context.CancelFunc),
+		admitting: make(map[string]string),
+	}
+	a.ready = sync.NewCond(&a.mu)
+	for i := 0; i < retry.Workers; i++ {
+		go a.work()
+	}
+	return a
+}
+
+// Submit queues a pending deployment revision for admission. It does not block.
+func (a *Admission) Submit(id, agentID string, revision int, imageURL string) {
+	a.enqueue(admissionJob{id: id, agentID: agentID, revision: revision, imageURL: imageURL, attempt: 1})
+}
+
+func (a *Admission) enqueue(job admissionJob) {
+	job.queued = time.Now()
+	a.mu.Lock()
+	a.queue = append(a.queue, job)
+	a.mu.Unlock()
+	a.ready.Broadcast()
+}
+
+// next takes the first queued job that may be admitted now: when ordered, a
+// revision waits while one submitted before it for the same agent is being
+// admitted, and retries keep their agent's turn. The caller must hold a.mu.
+func (a *Admission) next() (admissionJob, bool) {
+	for i, job := range a.queue {
+		if a.retry.Ordered && job.attempt == 1 && a.busy(job.agentID) {
+			continue
+		}
+		a.queue = slices.Delete(a.queue, i, i+1)
+		a.admitting[job.id] = job.agentID
+		return job, true
+	}
+	return admissionJob{}, false
+}
+
+// busy reports whether a revision for an agent is being admitted. The caller
+// must hold a.mu.
+func (a *Admission) busy(agentID string) bool {
+	for _, id := range a.admitting {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// done ends the admission of a revision, so that the next one for its agent
+// may start.
+func (a *Admission) done(job admissionJob) {
+	a.mu.Lock()
+	delete(a.admitting, job.id)
+	a.mu.Unlock()
+	a.ready.Broadcast()
+}
+
+// work admits queued revisions until the process exits.
+func (a *Admission) work() {
+	for {
+		a.mu.Lock()
+		job, ok := a.next()
+		for !ok {
+			a.ready.Wait()
+			job, ok = a.next()
+		}
+		a.mu.Unlock()
+		admissionWait.Observe(time.Since(job.queued).Seconds())
+
+		if !a.store.IsPending(job.id, job.revision) {
+			// The revision was superseded, removed, or redeployed while queued.
+			a.done(job)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), a.retry.Timeout)
+		a.mu.Lock()
+		a.inFlight[job.id] = cancel
+		a.mu.Unlock()
+
+		start := time.Now()
+		err := a.admit(ctx, job.id, job.revision, job.imageURL)
+		result := "succeeded"
+		if err != nil {
+			result = "failed"
+		}
+		admissionDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+
+		a.mu.Lock()
+		delete(a.inFlight, job.id)
+		a.mu.Unlock()
+		cancel()
+		if err == nil || !a.store.IsPending(job.id, job.revision) {
+			// Admitted, failed for good, or cancelled while running.
+			a.done(job)
+			continue
+		}
+		if job.attempt >= a.retry.MaxAttempts {
+			log.Printf("Deployment %s: admission failed after %d attempts: %v", job.id, job.attempt, err)
+			a.store.MarkFailed(job.id, job.revision, fmt.Sprintf("Admission failed after %d attempts: %v", job.attempt, err))
+			a.done(job)
+			continue
+		}
+		delay := a.retry.backoff(job.attempt)
+		log.Printf("Deployment %s: admission attempt %d failed, retrying in %s: %v", job.id, job.attempt, delay, err)
+		a.store.RecordEvent(job.id, "retrying", fmt.Sprintf("Attempt %d of %d failed: %v; retrying in %s", job.attempt, a.retry.MaxAttempts, err, delay))
+		job.attempt++
+		time.AfterFunc(delay, func() { a.enqueue(job) })
+	}
+}
+
+// Queue returns an agent's admission queue.
+func (a *Admission) Queue(agentID string) AdmissionQueue {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q := AdmissionQueue{AgentID: agentID, Ordered: a.retry.Ordered, Admitting: []string{}, Queued: []string{}}
+	for id, agent := range a.admitting {
+		if agent == agentID {
+			q.Admitting = append(q.Admitting, id)
+		}
+	}
+	sort.Strings(q.Admitting)
+	for _, job := range a.queue {
+		if job.agentID == agentID && job.attempt == 1 {
+			q.Queued = append(q.Queued, job.id)
+		}
+	}
+	q.Depth = len(q.Admitting) + len(q.Queued)
+	return q
+}
+
+// Cancel aborts the running admission attempt of a deployment, if any. Queued
+// attempts are dropped by the workers once the deployment is no longer pending.
+func (a *Admission) Cancel(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cancel, exists := a.inFlight[id]; exists {
+		cancel()
+	}
+}
+
+// admit runs the admission steps for a revision. Failures that may be
+// transient are returned as errors for the caller to retry; all other
+// outcomes are recorded in the store.
+func (a *Admission) admit(ctx context.Context, id string, revision int, imageURL string) error {
+	digest := ""
+	if i := strings.Index(imageURL, "@"); i >= 0 {
+		// The image is already pinned, by the user or for the revision.
+		digest = imageURL[i+1:]
+	} else if a.registry != nil {
+		d, err := a.registry.ResolveDigest(ctx, imageURL)
+		if err != nil {
+			return fmt.Errorf("could not resolve image %s: %w", imageURL, err)
+		}
+		digest = d
+	}
+
+	if a.verifier != nil {
+		ref := pinnedImageRef(imageURL, digest)
+		if err := a.verifier.Verify(ctx, ref); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("signature verification of %s did not finish: %w", ref, ctx.Err())
+			}
+			log.Printf("Deployment %s: signature verification failed for %s: %v", id, ref, err)
+			a.store.MarkFailed(id, revision, fmt.Sprintf("Image signature verification failed for %s: %v", ref, err))
+			return nil
+		}
+		a.store.RecordEvent(id, "verified", fmt.Sprintf("Signature of %s verified", ref))
+	}
+
+	if a.scanner != nil {
+		ref := pinnedImageRef(imageURL, digest)
+		summary, err := a.scanner.Scan(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("vulnerability scan of %s failed: %w", ref, err)
+		}
+		if !a.store.SetScan(id, revision, ref, summary) {
+			return nil
+		}
+	}
+
+	a.store.MarkScheduled(id, revision, digest)
+	return nil
+}
+
+// handleAdmissionQueue serves GET /api/v1/agents/{id}/queue, the revisions
+// being admitted to an agent and the ones waiting to be.
+func (s *Server) handleAdmissionQueue(w http.ResponseWriter, r *http.Request) {
+	agent, exists := s.agents.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s.admission.Queue(agent.ID))
+}
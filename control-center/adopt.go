@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// managedByLabel names the tool that manages a Kubernetes object.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	// managedByControlCenter is the managedByLabel of adopted Deployments.
+	managedByControlCenter = "edge-orchestration"
+	// gpuResource is the extended resource GPUs are requested as.
+	gpuResource = "nvidia.com/gpu"
+)
+
+// kubernetesDeployments identifies the Deployment resource.
+var kubernetesDeployments = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+// Workloads lists the Deployments in the operator's namespace, or in every
+// namespace but the kube-* system namespaces, ordered by namespace and name.
+// Deployments that were adopted report the deployment that manages them as
+// long as it is not archived.
+func (o *Operator) Workloads(ctx context.Context) ([]KubernetesWorkload, error) {
+	list, err := o.client.Resource(kubernetesDeployments).Namespace(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list Kubernetes Deployments: %w", err)
+	}
+	workloads := []KubernetesWorkload{}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if o.namespace == "" && strings.HasPrefix(obj.GetNamespace(), "kube-") {
+			continue
+		}
+		workloads = append(workloads, o.workload(obj))
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Namespace != workloads[j].Namespace {
+			return workloads[i].Namespace < workloads[j].Namespace
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+	return workloads, nil
+}
+
+// workload summarizes a Deployment.
+func (o *Operator) workload(obj *unstructured.Unstructured) KubernetesWorkload {
+	labels := obj.GetLabels()
+	w := KubernetesWorkload{
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Images:    []string{},
+		Replicas:  1,
+		ManagedBy: labels[managedByLabel],
+	}
+	if replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); found {
+		w.Replicas = int32(replicas)
+	}
+	for _, c := range containers(obj) {
+		image, _ := c["image"].(string)
+		w.Images = append(w.Images, image)
+	}
+	if w.ManagedBy == managedByControlCenter {
+		if dep, exists := o.server.deployments.Get(labels[deploymentLabel]); exists && dep.ArchivedAt == nil {
+			w.DeploymentID = dep.ID
+		}
+	}
+	return w
+}
+
+// containers returns the containers of a Deployment's pod template.
+func containers(obj *unstructured.Unstructured) []map[string]any {
+	list, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	var result []map[string]any
+	for _, c := range list {
+		if m, ok := c.(map[string]any); ok {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// adoptedRequest converts a single-container Deployment to the request for
+// the deployment that takes its workload over: its image, arguments, and
+// requested CPU, memory, and GPUs. Its replicas, environment, volumes, and
+// probes are not carried over.
+func adoptedRequest(obj *unstructured.Unstructured, adopt AdoptRequest) (DeploymentRequest, error) {
+	cs := containers(obj)
+	if len(cs) != 1 {
+		return DeploymentRequest{}, fmt.Errorf("Kubernetes Deployment %s/%s has %d containers; only single-container Deployments can be adopted", obj.GetNamespace(), obj.GetName(), len(cs))
+	}
+	c := cs[0]
+	req := DeploymentRequest{AdoptedFrom: obj.GetNamespace() + "/" + obj.GetName()}
+	req.AgentID, req.Project = adopt.AgentID, adopt.Project
+	req.ImageURL, _ = c["image"].(string)
+	args, _, _ := unstructured.NestedStringSlice(c, "args")
+	req.args = args
+
+	quantity := func(kind, name string) string {
+		v, found, _ := unstructured.NestedFieldNoCopy(c, "resources", kind, name)
+		if !found {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+	var res Resources
+	for _, kind := range []string{"requests", "limits"} {
+		if res.CPU == "" {
+			res.CPU = quantity(kind, "cpu")
+		}
+		if res.Memory == "" {
+			res.Memory = quantity(kind, "memory")
+		}
+	}
+	if gpus := quantity("limits", gpuResource); gpus != "" {
+		n, err := strconv.Atoi(gpus)
+		if err != nil {
+			return DeploymentRequest{}, fmt.Errorf("invalid %s limit %q", gpuResource, gpus)
+		}
+		res.GPU = n
+	}
+	if res != (Resources{}) {
+		req.Resources = &res
+	}
+	return req, nil
+}
+
+// Adopt places a Deployment's workload under control center management: it
+// creates a deployment for it on the given agent like the API does, and
+// labels the Deployment with the tool that manages it and the deployment's
+// ID. Deployments another tool, such as Helm, manages are refused. It returns
+// the status code to answer with if it fails.
+func (o *Operator) Adopt(ctx context.Context, r *http.Request, namespace, name string, adopt AdoptRequest) (*Deployment, int, error) {
+	s := o.server
+	if o.namespace != "" && namespace != o.namespace {
+		return nil, http.StatusNotFound, fmt.Errorf("Kubernetes Deployment %s/%s not found", namespace, name)
+	}
+	obj, err := o.client.Resource(kubernetesDeployments).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, http.StatusNotFound, fmt.Errorf("Kubernetes Deployment %s/%s not found", namespace, name)
+	}
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("could not get Kubernetes Deployment %s/%s: %w", namespace, name, err)
+	}
+	w := o.workload(obj)
+	switch {
+	case w.DeploymentID != "":
+		return nil, http.StatusConflict, fmt.Errorf("Kubernetes Deployment %s/%s is already adopted as deployment %s", namespace, name, w.DeploymentID)
+	case w.ManagedBy != "" && w.ManagedBy != managedByControlCenter:
+		return nil, http.StatusConflict, fmt.Errorf("Kubernetes Deployment %s/%s is managed by %s", namespace, name, w.ManagedBy)
+	}
+
+	req, err := adoptedRequest(obj, adopt)
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	if code, err := validateDeploymentRequest(ctx, s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &req); err != nil {
+		return nil, code, err
+	}
+	if err := s.freezes.check(r, req.Project, req.AgentID); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	dep, err := s.deployments.Create(req)
+	if err != nil {
+		return nil, http.StatusForbidden, err
+	}
+
+	patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{"labels": map[string]string{
+		managedByLabel:  managedByControlCenter,
+		deploymentLabel: dep.ID,
+	}}})
+	_, err = o.client.Resource(kubernetesDeployments).Namespace(namespace).Patch(ctx, name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		// Without the labels nothing marks the Deployment as adopted, so the
+		// deployment is not kept either.
+		if _, _, archiveErr := s.deployments.Archive(dep.ID, 0, "Kubernetes Deployment could not be labeled as adopted"); archiveErr == nil {
+			s.admission.Cancel(dep.ID)
+		}
+		return nil, http.StatusBadGateway, fmt.Errorf("could not label Kubernetes Deployment %s/%s: %w", namespace, name, err)
+	}
+	s.deployments.RecordEvent(dep.ID, "adopted", fmt.Sprintf("Adopted Kubernetes Deployment %s/%s", namespace, name))
+	log.Printf("Kubernetes operator: Deployment %s/%s adopted as deployment %s", namespace, name, dep.ID)
+	dep, _ = s.deployments.Get(dep.ID)
+	return dep, http.StatusCreated, nil
+}
+
+// requireOperator answers 404 for Kubernetes routes when the operator is not
+// enabled.
+func (s *Server) requireOperator(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.operator == nil {
+			http.Error(w, "Kubernetes operator is not enabled; set KUBERNETES_OPERATOR=true", http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleListKubernetesDeployments serves GET
+// /api/v1/kubernetes/deployments, the Deployments in the cluster and the
+// deployments that adopted them. With ?unmanaged=true, only Deployments no
+// tool manages are listed.
+func (s *Server) handleListKubernetesDeployments(w http.ResponseWriter, r *http.Request) {
+	workloads, err := s.operator.Workloads(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if r.URL.Query().Get("unmanaged") == "true" {
+		unmanaged := []KubernetesWorkload{}
+		for _, wl := range workloads {
+			if wl.DeploymentID == "" && (wl.ManagedBy == "" || wl.ManagedBy == managedByControlCenter) {
+				unmanaged = append(unmanaged, wl)
+			}
+		}
+		workloads = unmanaged
+	}
+	json.NewEncoder(w).Encode(workloads)
+}
+
+// handleAdoptKubernetesDeployment serves POST
+// /api/v1/kubernetes/deployments/{namespace}/{name}/adopt, which places a
+// Deployment's workload under control center management.
+func (s *Server) handleAdoptKubernetesDeployment(w http.ResponseWriter, r *http.Request) {
+	var req AdoptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.AgentID == "" {
+		http.Error(w, "agent_id is required", http.StatusBadRequest)
+		return
+	}
+	dep, code, err := s.operator.Adopt(r.Context(), r, r.PathValue("namespace"), r.PathValue("name"), req)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(dep)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// agentCredentialBytes is the number of random bytes in an agent
+	// credential.
+	agentCredentialBytes = 32
+	// agentCredentialHeader carries an agent's credential on the HTTP
+	// requests it makes as the agent, such as opening its tunnel.
+	agentCredentialHeader = "X-Agent-Credential"
+)
+
+// issueCredential gives an agent a new credential, which it must present to
+// reconnect under its ID, and returns it. Only its hash is kept.
+func (s *AgentStore) issueCredential(id string) (string, error) {
+	b := make([]byte, agentCredentialBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	credential := base64.RawURLEncoding.EncodeToString(b)
+	s.Lock()
+	defer s.Unlock()
+	s.credentials[id] = sha256.Sum256([]byte(credential))
+	return credential, nil
+}
+
+// checkCredential reports whether credential is the one issued to the agent.
+// Agents that were never issued one, e.g. because they registered over HTTP,
+// cannot present it.
+func (s *AgentStore) checkCredential(id, credential string) bool {
+	s.Lock()
+	defer s.Unlock()
+	want, exists := s.credentials[id]
+	got := sha256.Sum256([]byte(credential))
+	return exists && credential != "" && subtle.ConstantTimeCompare(got[:], want[:]) == 1
+}
+
+// credentialHashes returns the hex-encoded hashes of the agents' credentials,
+// by agent ID, for backups.
+func (s *AgentStore) credentialHashes() map[string]string {
+	s.Lock()
+	defer s.Unlock()
+	hashes := make(map[string]string, len(s.credentials))
+	for id, hash := range s.credentials {
+		hashes[id] = hex.EncodeToString(hash[:])
+	}
+	return hashes
+}
+
+// parseCredentialHashes reads the credential hashes credentialHashes
+// returned.
+func parseCredentialHashes(hashes map[string]string) (map[string][sha256.Size]byte, error) {
+	credentials := make(map[string][sha256.Size]byte, len(hashes))
+	for id, h := range hashes {
+		b, err := hex.DecodeString(h)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("agent %s: invalid credential hash", id)
+		}
+		credentials[id] = [sha256.Size]byte(b)
+	}
+	return credentials, nil
+}
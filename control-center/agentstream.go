@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// defaultAgentStreamAddr is where agents connect unless AGENT_GRPC_ADDR is set.
+const defaultAgentStreamAddr = ":8081"
+
+// Agents and the control center exchange JSON messages over gRPC, so that the
+// messages share their types with the HTTP API and need no generated code.
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes gRPC messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// AgentService serves the streams agents use to register, send heartbeats,
+// receive their deployments, and report status, all over one connection.
+type AgentService struct {
+	agents      *AgentStore
+	deployments *DeploymentStore
+	configs     *ConfigStore
+	secrets     *SecretStore
+	bundles     *BundleStore // nil when bundles are not enabled
+	operations  *OperationStore
+	bootstrap   *BootstrapTokenStore
+}
+
+// ServeAgentStreams serves agent streams on the address in AGENT_GRPC_ADDR
+// (default ":8081"), and on the sockets systemd passed for them, which
+// replace the default address unless AGENT_GRPC_ADDR is set. It returns when
+// a listener fails.
+func ServeAgentStreams(svc *AgentService, activated []net.Listener) error {
+	listeners := activated
+	if addr := os.Getenv("AGENT_GRPC_ADDR"); addr != "" || len(activated) == 0 {
+		if addr == "" {
+			addr = defaultAgentStreamAddr
+		}
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+	server := grpc.NewServer(
+		// Detect agents that vanished without closing their connection.
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: 30 * time.Second, Timeout: 10 * time.Second}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: 10 * time.Second, PermitWithoutStream: true}),
+	)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "edgeorchestration.v1.AgentService",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Connect",
+			Handler:       func(_ any, stream grpc.ServerStream) error { return svc.connect(stream) },
+			ServerStreams: true,
+			ClientStreams: true,
+		}},
+	}, svc)
+	errs := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		log.Printf("Agent stream server starting on %s", describeListener(lis))
+		go func() { errs <- server.Serve(lis) }()
+	}
+	return <-errs
+}
+
+// connect serves one agent's stream until the agent disconnects.
+func (svc *AgentService) connect(stream grpc.ServerStream) error {
+	var first AgentMessage
+	if err := stream.RecvMsg(&first); err != nil {
+		return err
+	}
+	if first.Register == nil {
+		return status.Error(codes.FailedPrecondition, "first message must register the agent")
+	}
+	registered, err := svc.register(*first.Register)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&ControlMessage{Registered: registered}); err != nil {
+		return err
+	}
+	agentID := registered.AgentID
+
+	changes, unwatch := svc.deployments.Watch(agentID)
+	defer unwatch()
+	operations, unwatchOperations := svc.operations.Watch(agentID)
+	defer unwatchOperations()
+
+	// Messages are received in the background so that deployment changes can
+	// be pushed while waiting; only this goroutine sends.
+	received := make(chan AgentMessage)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			var msg AgentMessage
+			if err := stream.RecvMsg(&msg); err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case received <- msg:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	// sent is the desired state the agent was last sent; changes that leave
+	// it as it was, such as the agent's own status reports, are not pushed.
+	sent, err := svc.pushDeployments(stream, agentID, "")
+	if err != nil {
+		return err
+	}
+	if err := svc.pushOperations(stream, agentID, true); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-changes:
+			if sent, err = svc.pushDeployments(stream, agentID, sent); err != nil {
+				return err
+			}
+		case <-operations:
+			if err := svc.pushOperations(stream, agentID, false); err != nil {
+				return err
+			}
+		case msg := <-received:
+			if msg.Sync != nil {
+				log.Printf("Agent %s asked for its deployments", agentID)
+				if sent, err = svc.pushDeployments(stream, agentID, ""); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := svc.handle(stream, agentID, msg); err != nil {
+				return err
+			}
+		case err := <-recvErr:
+			log.Printf("Agent %s disconnected: %v", agentID, err)
+			return nil
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// register registers a new agent, or reconnects an agent that sends a known
+// ID with the credential it was issued, and returns what to tell the agent.
+// An agent whose credential does not match is registered under a new ID, as
+// one the control center lost is.
+func (svc *AgentService) register(req StreamRegister) (*StreamRegistered, error) {
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid timezone: %v", err)
+	}
+	gpus, err := validateGPUInventory(req.GPUs)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := svc.agents.CheckVersion(req.Version, req.ProtocolVersion); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if req.AgentID != "" {
+		agent, exists := svc.agents.Get(req.AgentID)
+		switch {
+		case exists && agent.ArchivedAt != nil:
+			return nil, status.Errorf(codes.PermissionDenied, "agent %s was deleted", req.AgentID)
+		case exists && !svc.agents.checkCredential(req.AgentID, req.Credential):
+			log.Printf("Agent %s: reconnect without its credential refused; registering under a new ID", req.AgentID)
+		case exists && svc.agents.Heartbeat(req.AgentID):
+			svc.agents.SetTimezone(req.AgentID, req.Timezone)
+			svc.agents.SetGPUs(req.AgentID, gpus)
+			svc.agents.SetLabels(req.AgentID, req.Labels)
+			svc.agents.SetVersion(req.AgentID, req.Version, req.ProtocolVersion)
+			// Reported GPUs may fit deployments queued for them.
+			svc.deployments.AdmitQueued()
+			log.Printf("Agent reconnected: %s", req.AgentID)
+			return &StreamRegistered{AgentID: req.AgentID}, nil
+		}
+		// Otherwise the control center lost the agent, e.g. after a
+		// restart, so it registers again under a new ID.
+	}
+	if req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "address is required")
+	}
+	token, err := svc.bootstrap.Redeem(req.BootstrapToken)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	agent := svc.agents.Register(req.Address, req.Timezone, gpus, req.Labels, token)
+	svc.agents.SetVersion(agent.ID, req.Version, req.ProtocolVersion)
+	credential, err := svc.agents.issueCredential(agent.ID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not issue a credential: %v", err)
+	}
+	return &StreamRegistered{AgentID: agent.ID, Credential: credential}, nil
+}
+
+// handle acts on a heartbeat or status report from an agent, and answers a
+// heartbeat with the digest of the agent's desired state.
+func (svc *AgentService) handle(stream grpc.ServerStream, agentID string, msg AgentMessage) error {
+	switch {
+	case msg.Heartbeat != nil:
+		if err := svc.agents.heartbeatVersion(agentID, msg.Heartbeat); err != nil {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if !svc.agents.Heartbeat(agentID) {
+			return status.Errorf(codes.NotFound, "agent %s not found", agentID)
+		}
+		return stream.SendMsg(&ControlMessage{Heartbeat: &StreamHeartbeatReply{DesiredState: svc.desiredState(agentID)}})
+	case msg.Status != nil:
+		if err := svc.reportStatus(agentID, *msg.Status); err != nil {
+			return stream.SendMsg(&ControlMessage{Error: &StreamError{DeploymentID: msg.Status.DeploymentID, Message: err.Error()}})
+		}
+	case msg.Operation != nil:
+		if err := svc.reportOperation(agentID, *msg.Operation); err != nil {
+			log.Printf("Agent %s: %v", agentID, err)
+		}
+	default:
+		return status.Error(codes.InvalidArgument, "unsupported message")
+	}
+	return nil
+}
+
+// reportStatus records a status change for one of the agent's deployments.
+func (svc *AgentService) reportStatus(agentID string, report StreamStatus) error {
+	if report.Status == "" {
+		return fmt.Errorf("status is required")
+	}
+	dep, exists := svc.deployments.Get(report.DeploymentID)
+	if !exists || dep.AgentID != agentID {
+		return fmt.Errorf("deployment %s not found", report.DeploymentID)
+	}
+	// A workload that was still starting when it was paused must not
+	// overwrite the pause.
+	if dep.Status == "paused" {
+		return fmt.Errorf("deployment %s is paused", report.DeploymentID)
+	}
+	_, _, err := svc.deployments.UpdateStatus(report.DeploymentID, 0, report.Status, report.Reason)
+	return err
+}
+
+// pushDeployments sends an agent its current deployments and the config
+// versions they use, unless their desired state is still the one it was
+// sent. It returns the desired state the agent has now.
+func (svc *AgentService) pushDeployments(stream grpc.ServerStream, agentID, sent string) (string, error) {
+	state := svc.deploymentsFor(agentID)
+	if state.DesiredState == sent {
+		return sent, nil
+	}
+	return state.DesiredState, stream.SendMsg(&ControlMessage{Deployments: state})
+}
+
+// pushOperations sends an agent the cluster operations it has not been sent,
+// and with resend also the ones it has not reported.
+func (svc *AgentService) pushOperations(stream grpc.ServerStream, agentID string, resend bool) error {
+	for _, op := range svc.operations.Take(agentID, resend) {
+		if err := stream.SendMsg(&ControlMessage{Operation: &op}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deploymentsFor returns an agent's current deployments, with their images
+// rewritten by the agent's rules, and the config versions, secret values, and
+// bundles they use.
+func (svc *AgentService) deploymentsFor(agentID string) *StreamDeployments {
+	deps := svc.deployments.snapshotForAgent(agentID)
+	rewrites := svc.agents.imageRewrites(agentID)
+	configs := make(map[string]Config)
+	secrets := make(map[string]string)
+	bundles := make(map[string]Bundle)
+	for i, dep := range deps {
+		if dep.Bundle == "" {
+			deps[i].ImageURL = rewriteImage(dep.ImageURL, rewrites)
+		} else if svc.bundles != nil {
+			// Bundled images are loaded locally and keep their name.
+			if b, exists := svc.bundles.Get(dep.Bundle); exists {
+				bundles[b.ID] = b
+			}
+		}
+		for _, ref := range dep.Configs {
+			if cfg, exists := svc.configs.Version(ref.Name, ref.Version); exists {
+				configs[ref.Key()] = cfg
+			}
+		}
+		for _, ref := range dep.Secrets {
+			if value, exists := svc.secrets.Value(ref.Name, ref.Version); exists {
+				secrets[ref.Key()] = value
+			}
+		}
+	}
+	state := &StreamDeployments{Deployments: deps, Configs: configs, Secrets: secrets, Bundles: bundles}
+	state.DesiredState = desiredStateDigest(state)
+	return state
+}
+
+// Watch returns a channel that is signalled whenever one of the agent's
+// deployments changes, and a function to stop watching.
+func (s *DeploymentStore) Watch(agentID string) (<-chan struct{}, func()) {
+	s.Lock()
+	defer s.Unlock()
+	ch := make(chan struct{}, 1)
+	if s.watchers[agentID] == nil {
+		s.watchers[agentID] = make(map[chan struct{}]bool)
+	}
+	s.watchers[agentID][ch] = true
+	return ch, func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.watchers[agentID], ch)
+		if len(s.watchers[agentID]) == 0 {
+			delete(s.watchers, agentID)
+		}
+	}
+}
+
+// notifyWatchers signals everyone watching the agent's deployments without
+// blocking; a pending signal already covers the change. The caller must hold
+// the lock.
+func (s *DeploymentStore) notifyWatchers(agentID string) {
+	for ch := range s.watchers[agentID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// snapshotForAgent returns copies of the agent's unarchived deployments.
+func (s *DeploymentStore) snapshotForAgent(agentID string) []Deployment {
+	s.Lock()
+	defer s.Unlock()
+	deps := make([]Deployment, 0, len(s.byAgent[agentID]))
+	for _, dep := range s.byAgent[agentID] {
+		if dep.ArchivedAt == nil {
+			deps = append(deps, *cloneDeployment(dep))
+		}
+	}
+	return deps
+}
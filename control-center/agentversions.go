@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"edge-orchestration/api/types"
+)
+
+// AgentVersionPolicy is the oldest agent the control center supports, and
+// whether older agents are refused or only warned about.
+type AgentVersionPolicy struct {
+	MinVersion  string // Oldest supported build version; any if empty
+	MinProtocol int    // Oldest supported protocol version
+	Reject      bool
+}
+
+// AgentVersionPolicyFromEnv reads the agent version policy from the
+// AGENT_MIN_VERSION (none), AGENT_MIN_PROTOCOL_VERSION (1), and
+// AGENT_VERSION_ENFORCEMENT ("warn" or "reject"; warn) environment variables.
+func AgentVersionPolicyFromEnv() (AgentVersionPolicy, error) {
+	p := AgentVersionPolicy{MinVersion: os.Getenv("AGENT_MIN_VERSION"), MinProtocol: 1}
+	if _, ok := parseSemver(p.MinVersion); p.MinVersion != "" && !ok {
+		return p, fmt.Errorf("invalid AGENT_MIN_VERSION %q: must be a semantic version such as 1.4.0", p.MinVersion)
+	}
+	if v := os.Getenv("AGENT_MIN_PROTOCOL_VERSION"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > types.ProtocolVersion {
+			return p, fmt.Errorf("invalid AGENT_MIN_PROTOCOL_VERSION %q: must be between 1 and %d", v, types.ProtocolVersion)
+		}
+		p.MinProtocol = n
+	}
+	switch v := os.Getenv("AGENT_VERSION_ENFORCEMENT"); v {
+	case "", "warn":
+	case "reject":
+		p.Reject = true
+	default:
+		return p, fmt.Errorf("invalid AGENT_VERSION_ENFORCEMENT %q: must be warn or reject", v)
+	}
+	return p, nil
+}
+
+// AgentVersionError is returned when an agent older than the minimum
+// supported version registers or sends a heartbeat while such agents are
+// rejected.
+type AgentVersionError struct {
+	Reason string
+}
+
+func (e *AgentVersionError) Error() string {
+	return e.Reason + "; upgrade the agent"
+}
+
+// check returns why an agent of a version is not supported, or "" if it is.
+// older is set if the agent is known to be older than the minimum; agents
+// whose version cannot be compared, such as development builds, are only
+// warned about. Agents that report no protocol version speak version 1.
+func (p AgentVersionPolicy) check(version string, protocol int) (warning string, older bool) {
+	if protocol == 0 {
+		protocol = 1
+	}
+	switch {
+	case protocol < p.MinProtocol:
+		return fmt.Sprintf("agent protocol version %d is older than the minimum supported %d", protocol, p.MinProtocol), true
+	case protocol > types.ProtocolVersion:
+		return fmt.Sprintf("agent protocol version %d is newer than the control center's %d", protocol, types.ProtocolVersion), false
+	case p.MinVersion == "":
+		return "", false
+	}
+	minimum, _ := parseSemver(p.MinVersion)
+	v, ok := parseSemver(version)
+	switch {
+	case version == "":
+		return fmt.Sprintf("agent reports no version; the minimum supported is %s", p.MinVersion), false
+	case !ok:
+		return fmt.Sprintf("agent version %q cannot be compared with the minimum supported %s", version, p.MinVersion), false
+	case v.less(minimum):
+		return fmt.Sprintf("agent version %s is older than the minimum supported %s", version, p.MinVersion), true
+	}
+	return "", false
+}
+
+// CheckVersion returns an *AgentVersionError if an agent of a version must
+// be refused.
+func (s *AgentStore) CheckVersion(version string, protocol int) error {
+	s.Lock()
+	defer s.Unlock()
+	if warning, older := s.versions.check(version, protocol); older && s.versions.Reject {
+		return &AgentVersionError{Reason: warning}
+	}
+	return nil
+}
+
+// heartbeatVersion records the version a heartbeat reports, if it reports
+// one; agents older than the version fields send heartbeats without.
+func (s *AgentStore) heartbeatVersion(id string, hb *StreamHeartbeat) error {
+	if hb.Version == "" && hb.ProtocolVersion == 0 {
+		return nil
+	}
+	return s.SetVersion(id, hb.Version, hb.ProtocolVersion)
+}
+
+// SetVersion records the version an agent reported, with a warning if it is
+// not supported. It returns an *AgentVersionError, and records nothing, if
+// the agent must be refused.
+func (s *AgentStore) SetVersion(id, version string, protocol int) error {
+	s.Lock()
+	defer s.Unlock()
+	agent, exists := s.agents[id]
+	if !exists {
+		return nil
+	}
+	warning, older := s.versions.check(version, protocol)
+	if older && s.versions.Reject {
+		log.Printf("Agent %s refused: %s", id, warning)
+		return &AgentVersionError{Reason: warning}
+	}
+	if warning != "" && warning != agent.VersionWarning {
+		log.Printf("Warning: agent %s: %s", id, warning)
+	}
+	if agent.Version != version || agent.ProtocolVersion != protocol || agent.VersionWarning != warning {
+		agent.Version, agent.ProtocolVersion, agent.VersionWarning = version, protocol, warning
+		s.revision++
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// alertInterval is how often alert rules are evaluated.
+	alertInterval = 30 * time.Second
+	// maxResolvedAlerts is how many resolved alerts are kept for listing.
+	maxResolvedAlerts = 200
+	// defaultCrashLoopFailures and defaultCrashLoopWindow define a crash loop
+	// for rules that do not set failures and window.
+	defaultCrashLoopFailures = 3
+	defaultCrashLoopWindow   = "15m"
+)
+
+// AlertStore manages alert rules and the alerts they raise.
+type AlertStore struct {
+	sync.Mutex
+	rules      map[string]*AlertRule
+	firing     map[string]*Alert // By rule name and subject key
+	resolved   []Alert           // Oldest first
+	httpClient *http.Client
+}
+
+// NewAlertStore creates a new in-memory alert store.
+func NewAlertStore() *AlertStore {
+	return &AlertStore{
+		rules:      make(map[string]*AlertRule),
+		firing:     make(map[string]*Alert),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// validateAlertRule checks a rule and fills in the defaults of its crash
+// loop condition.
+func validateAlertRule(rule *AlertRule) error {
+	if !validConfigKey(rule.Name) {
+		return fmt.Errorf("invalid alert rule name %q: names may only contain letters, digits, dashes, underscores, and dots", rule.Name)
+	}
+	switch rule.Condition {
+	case "deployment_failed", "crashloop", "deployment_orphaned":
+	case "agent_offline":
+		if rule.Project != "" {
+			return errors.New("project cannot be set for agent_offline rules")
+		}
+	default:
+		return errors.New("condition must be deployment_failed, agent_offline, crashloop, or deployment_orphaned")
+	}
+	if rule.For != "" {
+		if d, err := time.ParseDuration(rule.For); err != nil || d < 0 {
+			return fmt.Errorf("invalid for %q: must be a duration such as 10m", rule.For)
+		}
+	}
+	if rule.Condition == "crashloop" {
+		if rule.Failures == 0 {
+			rule.Failures = defaultCrashLoopFailures
+		}
+		if rule.Failures < 2 {
+			return errors.New("failures must be at least 2")
+		}
+		if rule.Window == "" {
+			rule.Window = defaultCrashLoopWindow
+		}
+		if d, err := time.ParseDuration(rule.Window); err != nil || d <= 0 {
+			return fmt.Errorf("invalid window %q: must be a positive duration such as 15m", rule.Window)
+		}
+	} else if rule.Failures != 0 || rule.Window != "" {
+		return errors.New("failures and window can only be set for crashloop rules")
+	}
+	for _, rcv := range rule.Receivers {
+		if rcv.Type != "webhook" && rcv.Type != "slack" {
+			return errors.New("receiver type must be webhook or slack")
+		}
+		u, err := url.Parse(rcv.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid receiver url %q: must be an http or https URL", rcv.URL)
+		}
+	}
+	return nil
+}
+
+// Put creates an alert rule or replaces it. Alerts the rule already raised
+// keep firing until its new condition no longer holds.
+func (s *AlertStore) Put(rule AlertRule) AlertRule {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().UTC()
+	rule.CreatedAt, rule.UpdatedAt = now, now
+	if old, exists := s.rules[rule.Name]; exists {
+		rule.CreatedAt = old.CreatedAt
+	}
+	s.rules[rule.Name] = &rule
+	log.Printf("Alert rule %s: %s", rule.Name, rule.Condition)
+	return rule
+}
+
+// Get returns the alert rule with the given name.
+func (s *AlertStore) Get(name string) (AlertRule, bool) {
+	s.Lock()
+	defer s.Unlock()
+	rule, exists := s.rules[name]
+	if !exists {
+		return AlertRule{}, false
+	}
+	return *rule, true
+}
+
+// List returns all alert rules ordered by name.
+func (s *AlertStore) List() []AlertRule {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]AlertRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		list = append(list, *rule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete removes an alert rule and drops the alerts it raised without
+// notifying anyone. It returns false if the rule does not exist.
+func (s *AlertStore) Delete(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.rules[name]; !exists {
+		return false
+	}
+	delete(s.rules, name)
+	for key, alert := range s.firing {
+		if alert.Rule == name {
+			delete(s.firing, key)
+		}
+	}
+	log.Printf("Alert rule %s deleted", name)
+	return true
+}
+
+// restore replaces all alert rules. Firing alerts are dropped and raised
+// again by the next evaluation if their condition still holds.
+func (s *AlertStore) restore(rules []AlertRule) {
+	s.Lock()
+	defer s.Unlock()
+	s.rules = make(map[string]*AlertRule, len(rules))
+	for _, rule := range rules {
+		s.rules[rule.Name] = &rule
+	}
+	s.firing = make(map[string]*Alert)
+}
+
+// Alerts returns the firing alerts, most recent first, followed by recently
+// resolved ones unless state is "firing". With state "resolved", only
+// resolved alerts are returned.
+func (s *AlertStore) Alerts(state string) []Alert {
+	s.Lock()
+	defer s.Unlock()
+	list := []Alert{}
+	if state != "resolved" {
+		for _, alert := range s.firing {
+			list = append(list, *alert)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].FiredAt.After(list[j].FiredAt) })
+	}
+	if state != "firing" {
+		for i := len(s.resolved) - 1; i >= 0; i-- {
+			list = append(list, s.resolved[i])
+		}
+	}
+	return list
+}
+
+// alertSubject is an agent or a deployment a rule's condition holds for.
+type alertSubject struct {
+	agentID      string
+	deploymentID string
+	project      string
+	since        time.Time // When the condition started to hold
+	message      string
+}
+
+// key identifies the subject among those of a rule.
+func (a alertSubject) key() string {
+	if a.deploymentID != "" {
+		return a.deploymentID
+	}
+	return a.agentID
+}
+
+// failedDeployments returns the active deployments that are failed, with
+// the time they failed.
+func (s *DeploymentStore) failedDeployments() []alertSubject {
+	s.Lock()
+	defer s.Unlock()
+	var list []alertSubject
+	for _, dep := range s.deployments {
+		if dep.Status != "failed" || dep.ArchivedAt != nil {
+			continue
+		}
+		since := dep.CreatedAt
+		for _, ev := range s.events[dep.ID] {
+			if ev.Type == "failed" {
+				since = ev.Time
+			}
+		}
+		list = append(list, alertSubject{
+			agentID:      dep.AgentID,
+			deploymentID: dep.ID,
+			project:      dep.Project,
+			since:        since,
+			message:      fmt.Sprintf("Deployment %s (%s) on agent %s failed: %s", dep.ID, dep.ImageURL, dep.AgentID, dep.Reason),
+		})
+	}
+	return list
+}
+
+// crashLooping returns the active deployments that failed at least failures
+// times within the window before now. The condition holds from the first of
+// those failures.
+func (s *DeploymentStore) crashLooping(failures int, window time.Duration, now time.Time) []alertSubject {
+	s.Lock()
+	defer s.Unlock()
+	var list []alertSubject
+	for _, dep := range s.deployments {
+		if dep.ArchivedAt != nil || retired(dep.Status) {
+			continue
+		}
+		var failed []time.Time
+		for _, ev := range s.events[dep.ID] {
+			if ev.Type == "failed" && now.Sub(ev.Time) <= window {
+				failed = append(failed, ev.Time)
+			}
+		}
+		if len(failed) < failures {
+			continue
+		}
+		list = append(list, alertSubject{
+			agentID:      dep.AgentID,
+			deploymentID: dep.ID,
+			project:      dep.Project,
+			since:        failed[0],
+			message:      fmt.Sprintf("Deployment %s (%s) on agent %s failed %d times in the last %s", dep.ID, dep.ImageURL, dep.AgentID, len(failed), window),
+		})
+	}
+	return list
+}
+
+// orphanedDeployments returns the active deployments the janitor found
+// orphaned on a stale agent, with the time they were orphaned.
+func (s *DeploymentStore) orphanedDeployments() []alertSubject {
+	s.Lock()
+	defer s.Unlock()
+	var list []alertSubject
+	for _, dep := range s.deployments {
+		if dep.OrphanedAt == nil || dep.ArchivedAt != nil || retired(dep.Status) {
+			continue
+		}
+		list = append(list, alertSubject{
+			agentID:      dep.AgentID,
+			deploymentID: dep.ID,
+			project:      dep.Project,
+			since:        *dep.OrphanedAt,
+			message:      fmt.Sprintf("Deployment %s (%s) is orphaned: agent %s has been silent since it was flagged stale", dep.ID, dep.ImageURL, dep.AgentID),
+		})
+	}
+	return list
+}
+
+// offlineAgents returns the agents that missed their heartbeats, with the
+// time they were last seen. Agents in maintenance are expected to go
+// offline and are left out.
+func (s *AgentStore) offlineAgents() []alertSubject {
+	s.Lock()
+	defer s.Unlock()
+	s.refreshStatus()
+	var list []alertSubject
+	for _, agent := range s.agents {
+		if agent.ArchivedAt != nil || agent.Status != "offline" || agent.Maintenance != nil {
+			continue
+		}
+		list = append(list, alertSubject{
+			agentID: agent.ID,
+			since:   agent.LastSeen,
+			message: fmt.Sprintf("Agent %s (%s) has been offline since %s", agent.ID, agent.Address, agent.LastSeen.Format(time.RFC3339)),
+		})
+	}
+	return list
+}
+
+// alertNotification is an alert to send to a receiver.
+type alertNotification struct {
+	receiver AlertReceiver
+	alert    Alert
+}
+
+// Run evaluates the alert rules on every interval. It never returns.
+func (s *AlertStore) Run(agents *AgentStore, deployments *DeploymentStore) {
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.Evaluate(agents, deployments, time.Now().UTC())
+	}
+}
+
+// Evaluate fires the alerts of rules whose condition has held for long
+// enough and resolves those whose condition no longer holds, and notifies
+// the rules' receivers of both.
+func (s *AlertStore) Evaluate(agents *AgentStore, deployments *DeploymentStore, now time.Time) {
+	rules := s.List()
+	subjects := make(map[string][]alertSubject, len(rules))
+	var failed, offline []alertSubject
+	for _, rule := range rules {
+		switch rule.Condition {
+		case "deployment_failed":
+			if failed == nil {
+				failed = deployments.failedDeployments()
+			}
+			subjects[rule.Name] = failed
+		case "agent_offline":
+			if offline == nil {
+				offline = agents.offlineAgents()
+			}
+			subjects[rule.Name] = offline
+		case "crashloop":
+			window, _ := time.ParseDuration(rule.Window)
+			subjects[rule.Name] = deployments.crashLooping(rule.Failures, window, now)
+		case "deployment_orphaned":
+			subjects[rule.Name] = deployments.orphanedDeployments()
+		}
+	}
+
+	s.Lock()
+	var notifications []alertNotification
+	holding := make(map[string]bool)
+	for _, rule := range rules {
+		hold, _ := time.ParseDuration(rule.For)
+		for _, sub := range subjects[rule.Name] {
+			if rule.Project != "" && sub.project != rule.Project || rule.AgentID != "" && sub.agentID != rule.AgentID {
+				continue
+			}
+			key := rule.Name + "/" + sub.key()
+			holding[key] = true
+			if _, firing := s.firing[key]; firing || now.Sub(sub.since) < hold {
+				continue
+			}
+			alert := &Alert{
+				ID:           fmt.Sprintf("alert-%s", uuid.New().String()[:8]),
+				Rule:         rule.Name,
+				Condition:    rule.Condition,
+				State:        "firing",
+				AgentID:      sub.agentID,
+				DeploymentID: sub.deploymentID,
+				Project:      sub.project,
+				Message:      sub.message,
+				Since:        sub.since,
+				FiredAt:      now,
+			}
+			s.firing[key] = alert
+			log.Printf("Alert %s firing for rule %s: %s", alert.ID, rule.Name, alert.Message)
+			for _, rcv := range rule.Receivers {
+				notifications = append(notifications, alertNotification{rcv, *alert})
+			}
+		}
+	}
+	for key, alert := range s.firing {
+		if holding[key] {
+			continue
+		}
+		delete(s.firing, key)
+		resolvedAt := now
+		alert.State = "resolved"
+		alert.ResolvedAt = &resolvedAt
+		s.resolved = append(s.resolved, *alert)
+		log.Printf("Alert %s for rule %s resolved", alert.ID, alert.Rule)
+		if rule, exists := s.rules[alert.Rule]; exists {
+			for _, rcv := range rule.Receivers {
+				notifications = append(notifications, alertNotification{rcv, *alert})
+			}
+		}
+	}
+	if n := len(s.resolved) - maxResolvedAlerts; n > 0 {
+		s.resolved = append([]Alert(nil), s.resolved[n:]...)
+	}
+	s.Unlock()
+
+	for _, n := range notifications {
+		go s.notify(n.receiver, n.alert)
+	}
+}
+
+// notify sends an alert to a receiver. Failures are logged; the alert is
+// not sent again.
+func (s *AlertStore) notify(rcv AlertReceiver, alert Alert) {
+	var body any = alert
+	if rcv.Type == "slack" {
+		prefix := ":rotating_light: *FIRING*"
+		if alert.State == "resolved" {
+			prefix = ":white_check_mark: *RESOLVED*"
+		}
+		body = map[string]string{"text": fmt.Sprintf("%s [%s] %s", prefix, alert.Rule, alert.Message)}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Alert %s: could not encode notification: %v", alert.ID, err)
+		return
+	}
+	resp, err := s.httpClient.Post(rcv.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Alert %s: could not notify %s receiver: %v", alert.ID, rcv.Type, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Alert %s: %s receiver answered %s", alert.ID, rcv.Type, resp.Status)
+	}
+}
+
+// handleListAlertRules lists alert rules.
+func (s *Server) handleListAlertRules(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.alerts.List())
+}
+
+// handleGetAlertRule returns an alert rule.
+func (s *Server) handleGetAlertRule(w http.ResponseWriter, r *http.Request) {
+	rule, exists := s.alerts.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rule)
+}
+
+// handlePutAlertRule creates an alert rule or replaces it.
+func (s *Server) handlePutAlertRule(w http.ResponseWriter, r *http.Request) {
+	var rule AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	rule.Name = r.PathValue("name")
+	if err := validateAlertRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(s.alerts.Put(rule))
+}
+
+// handleDeleteAlertRule deletes an alert rule.
+func (s *Server) handleDeleteAlertRule(w http.ResponseWriter, r *http.Request) {
+	if !s.alerts.Delete(r.PathValue("name")) {
+		http.Error(w, "Alert rule not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListAlerts lists firing and recently resolved alerts, or only those
+// in the state given as query parameter.
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state != "" && state != "firing" && state != "resolved" {
+		http.Error(w, "state must be firing or resolved", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(s.alerts.Alerts(state))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// apiVersions lists the versions of the API the control center serves,
+// oldest first. The last one is the current version, which unversioned paths
+// such as /api/deployments get unless Accept-Version asks for another.
+//
+// A version only needs routes of its own for the endpoints it changed; the
+// others are served by the nearest version that has them, newest first. v2
+// changes GET /deployments, which lists the deployments of all agents in
+// pages, so its route is registered next to the v1 one, which existing cctl
+// and agents keep calling; for every other endpoint v2 serves the v1 route.
+var apiVersions = []string{"v1", "v2"}
+
+// currentAPIVersion is the version unversioned paths get by default.
+var currentAPIVersion = apiVersions[len(apiVersions)-1]
+
+// apiVersionsPath lists the versions of the API. It is not versioned itself.
+const apiVersionsPath = "/api/versions"
+
+// apiLifecycle is when a version of the API was or will be deprecated, and
+// when it may stop being served.
+type apiLifecycle struct {
+	deprecatedAt time.Time
+	sunsetAt     time.Time
+}
+
+// APIVersions announces the deprecation of versions of the API and resolves
+// which version and route serve a request.
+type APIVersions struct {
+	lifecycles map[string]apiLifecycle // By version; versions without one are supported
+}
+
+// APIVersionsFromEnv reads when the versions before the current one are
+// deprecated and sunset from API_<VERSION>_DEPRECATED_AT and
+// API_<VERSION>_SUNSET_AT, e.g. API_V1_DEPRECATED_AT=2027-01-01 and
+// API_V1_SUNSET_AT=2027-07-01, as dates or RFC 3339 times.
+func APIVersionsFromEnv() (APIVersions, error) {
+	v := APIVersions{lifecycles: make(map[string]apiLifecycle)}
+	for _, version := range apiVersions[:len(apiVersions)-1] {
+		var lc apiLifecycle
+		for _, setting := range []struct {
+			name string
+			t    *time.Time
+		}{
+			{"API_" + strings.ToUpper(version) + "_DEPRECATED_AT", &lc.deprecatedAt},
+			{"API_" + strings.ToUpper(version) + "_SUNSET_AT", &lc.sunsetAt},
+		} {
+			value := os.Getenv(setting.name)
+			if value == "" {
+				continue
+			}
+			t, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				if t, err = time.Parse(time.RFC3339, value); err != nil {
+					return v, fmt.Errorf("invalid %s %q: must be a date such as 2027-01-01 or an RFC 3339 time", setting.name, value)
+				}
+			}
+			*setting.t = t.UTC()
+		}
+		if lc.sunsetAt.IsZero() && lc.deprecatedAt.IsZero() {
+			continue
+		}
+		if lc.deprecatedAt.IsZero() {
+			// A version going away is deprecated from now on.
+			lc.deprecatedAt = time.Now().UTC()
+		}
+		if !lc.sunsetAt.IsZero() && lc.sunsetAt.Before(lc.deprecatedAt) {
+			return v, fmt.Errorf("API %s is sunset at %s, before it is deprecated at %s", version, lc.sunsetAt.Format(time.RFC3339), lc.deprecatedAt.Format(time.RFC3339))
+		}
+		v.lifecycles[version] = lc
+	}
+	return v, nil
+}
+
+// List describes the versions of the API, oldest first.
+func (v APIVersions) List() []APIVersionInfo {
+	now := time.Now()
+	list := make([]APIVersionInfo, 0, len(apiVersions))
+	for _, version := range apiVersions {
+		info := APIVersionInfo{Version: version, Status: "supported"}
+		if version == currentAPIVersion {
+			info.Status = "current"
+		}
+		if lc, ok := v.lifecycles[version]; ok {
+			info.DeprecatedAt = &lc.deprecatedAt
+			if !lc.sunsetAt.IsZero() {
+				info.SunsetAt = &lc.sunsetAt
+			}
+			if !lc.deprecatedAt.After(now) {
+				info.Status = "deprecated"
+			}
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+// negotiate resolves the version of every API request: the one in its path,
+// or for unversioned paths the first one in Accept-Version the control
+// center serves, and the current one without the header. Callers whose
+// Accept-Version rules out the version of the path they called get 406 Not
+// Acceptable. The request is then routed to the nearest version that has
+// the endpoint. Responses carry the version in API-Version, and those of
+// deprecated versions carry Deprecation, Sunset, and a Link to the
+// successor version's path.
+func (v APIVersions) negotiate(mux *http.ServeMux) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rest, ok := strings.CutPrefix(r.URL.Path, "/api/")
+			if !ok || r.URL.Path == apiVersionsPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+			accepted := r.Header.Get(types.AcceptVersionHeader)
+			version, path, _ := strings.Cut(rest, "/")
+			switch {
+			case slices.Contains(apiVersions, version):
+				if listed := parseAcceptVersion(accepted); accepted != "" && !slices.Contains(listed, version) && !slices.Contains(listed, "*") {
+					http.Error(w, fmt.Sprintf("API %s is not in Accept-Version %q; call /api/<version>/%s with one of them instead", version, accepted, path), http.StatusNotAcceptable)
+					return
+				}
+			case isVersionSegment(version):
+				http.Error(w, fmt.Sprintf("API %s is not served; supported versions are %s", version, strings.Join(apiVersions, ", ")), http.StatusNotFound)
+				return
+			default:
+				path = rest
+				if version, ok = pickAPIVersion(accepted); !ok {
+					http.Error(w, fmt.Sprintf("None of the API versions in Accept-Version %q is served; supported versions are %s", accepted, strings.Join(apiVersions, ", ")), http.StatusNotAcceptable)
+					return
+				}
+				w.Header().Add("Vary", types.AcceptVersionHeader)
+			}
+
+			w.Header().Set(types.APIVersionHeader, version)
+			if lc, ok := v.lifecycles[version]; ok {
+				w.Header().Set("Deprecation", "@"+strconv.FormatInt(lc.deprecatedAt.Unix(), 10))
+				if !lc.sunsetAt.IsZero() {
+					w.Header().Set("Sunset", lc.sunsetAt.Format(http.TimeFormat))
+				}
+				w.Header().Add("Link", fmt.Sprintf("</api/%s/%s>; rel=\"successor-version\"", currentAPIVersion, path))
+			}
+			next.ServeHTTP(w, routeAPIVersion(mux, r, version, path))
+		})
+	}
+}
+
+// routeAPIVersion returns r for the route of the endpoint at path in the
+// given version, or if that version does not have it, in the nearest one
+// that does, preferring newer versions. If no version has the endpoint for
+// r's method, r goes to the nearest one that has it for another method, so
+// that the router answers 405 rather than 404.
+func routeAPIVersion(mux *http.ServeMux, r *http.Request, version, path string) *http.Request {
+	candidates := []*http.Request{withPath(r, "/api/"+version+"/"+path)}
+	for i := len(apiVersions) - 1; i >= 0; i-- {
+		if apiVersions[i] != version {
+			candidates = append(candidates, withPath(r, "/api/"+apiVersions[i]+"/"+path))
+		}
+	}
+	for _, routed := range candidates {
+		if _, pattern := mux.Handler(routed); pattern != "" {
+			return routed
+		}
+	}
+	for _, routed := range candidates {
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			probe := *routed
+			probe.Method = method
+			if _, pattern := mux.Handler(&probe); pattern != "" {
+				return routed
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// withPath returns a shallow copy of r for another path.
+func withPath(r *http.Request, path string) *http.Request {
+	if r.URL.Path == path {
+		return r
+	}
+	routed := new(http.Request)
+	*routed = *r
+	routed.URL = new(url.URL)
+	*routed.URL = *r.URL
+	routed.URL.Path, routed.URL.RawPath = path, ""
+	return routed
+}
+
+// parseAcceptVersion returns the versions an Accept-Version header lists, in
+// order, accepting "2" for "v2". "*" stands for any version.
+func parseAcceptVersion(header string) []string {
+	var versions []string
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" && v[0] >= '0' && v[0] <= '9' {
+			v = "v" + v
+		}
+		if v != "" {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// pickAPIVersion returns the first version in an Accept-Version header the
+// control center serves, or the current version if the header is empty.
+func pickAPIVersion(header string) (string, bool) {
+	if strings.TrimSpace(header) == "" {
+		return currentAPIVersion, true
+	}
+	for _, v := range parseAcceptVersion(header) {
+		if v == "*" {
+			return currentAPIVersion, true
+		}
+		if slices.Contains(apiVersions, v) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// isVersionSegment reports whether a path segment names an API version,
+// such as "v3".
+func isVersionSegment(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+// handleAPIVersions serves GET /api/versions.
+func (s *Server) handleAPIVersions(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.versions.List())
+}
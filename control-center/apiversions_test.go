@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// apiServer returns a server with the stores the deployment routes use, and
+// its router.
+func apiServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	agents := NewAgentStore()
+	s := &Server{
+		agents:      agents,
+		deployments: NewDeploymentStore(NewQuotaStore(), agents, NewFreezeStore()),
+		dashboard:   &Dashboard{},
+	}
+	return s, s.routes()
+}
+
+func TestListDeploymentsV2(t *testing.T) {
+	s, h := apiServer(t)
+	for _, agent := range []string{"agent-1", "agent-1", "agent-2"} {
+		if _, err := s.deployments.Create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: agent, ImageURL: "nginx:1.27"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(path, acceptVersion string) (int, DeploymentPage) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptVersion != "" {
+			r.Header.Set(types.AcceptVersionHeader, acceptVersion)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var page DeploymentPage
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("GET %s: %v: %s", path, err, w.Body)
+			}
+		}
+		return w.Code, page
+	}
+
+	code, first := get("/api/v2/deployments?limit=2", "")
+	if code != http.StatusOK || len(first.Items) != 2 || first.NextPageToken == "" {
+		t.Fatalf("first page: %d with %d deployments and token %q", code, len(first.Items), first.NextPageToken)
+	}
+	_, second := get("/api/v2/deployments?limit=2&page_token="+first.NextPageToken, "")
+	if len(second.Items) != 1 || second.NextPageToken != "" {
+		t.Fatalf("second page has %d deployments and token %q, want 1 and none", len(second.Items), second.NextPageToken)
+	}
+	seen := map[string]bool{}
+	for _, dep := range append(first.Items, second.Items...) {
+		seen[dep.ID] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("pages listed %d distinct deployments, want 3", len(seen))
+	}
+	if _, page := get("/api/v2/deployments?agent_id=agent-2", ""); len(page.Items) != 1 {
+		t.Errorf("agent-2 has %d deployments, want 1", len(page.Items))
+	}
+	if code, _ := get("/api/v2/deployments?page_token=x", ""); code != http.StatusBadRequest {
+		t.Errorf("invalid page token answered %d", code)
+	}
+
+	// Version 1 still requires agent_id, also for unversioned paths that ask
+	// for it, which otherwise get the current version.
+	if code, _ := get("/api/v1/deployments", ""); code != http.StatusBadRequest {
+		t.Errorf("v1 list without agent_id answered %d", code)
+	}
+	if code, _ := get("/api/deployments", "v1"); code != http.StatusBadRequest {
+		t.Errorf("unversioned list with Accept-Version v1 answered %d", code)
+	}
+	if _, page := get("/api/deployments", ""); len(page.Items) != 3 {
+		t.Errorf("unversioned list has %d deployments, want 3", len(page.Items))
+	}
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"GET /api/v1/things", "POST /api/v1/things", "GET /api/v2/things", "GET /api/v1/only-v1", "GET " + apiVersionsPath} {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Path))
+		})
+	}
+	v := APIVersions{lifecycles: map[string]apiLifecycle{"v1": {deprecatedAt: time.Now()}}}
+	h := v.negotiate(mux)(mux)
+
+	tests := []struct {
+		name, method, path, accept string
+		want                       int
+		wantPath, wantVersion      string // Route served, and API-Version
+	}{
+		{"v1", "GET", "/api/v1/things", "", http.StatusOK, "/api/v1/things", "v1"},
+		{"v2", "GET", "/api/v2/things", "", http.StatusOK, "/api/v2/things", "v2"},
+		{"unversioned", "GET", "/api/things", "", http.StatusOK, "/api/v2/things", "v2"},
+		{"unversioned accepting v1", "GET", "/api/things", "v1", http.StatusOK, "/api/v1/things", "v1"},
+		{"unversioned accepting 1", "GET", "/api/things", "3, 1", http.StatusOK, "/api/v1/things", "v1"},
+		{"unversioned accepting any", "GET", "/api/things", "*", http.StatusOK, "/api/v2/things", "v2"},
+		{"unversioned accepting none served", "GET", "/api/things", "v3", http.StatusNotAcceptable, "", ""},
+		{"path ruled out by Accept-Version", "GET", "/api/v2/things", "v1", http.StatusNotAcceptable, "", ""},
+		{"path in Accept-Version", "GET", "/api/v2/things", "v1, v2", http.StatusOK, "/api/v2/things", "v2"},
+		{"unknown version", "GET", "/api/v3/things", "", http.StatusNotFound, "", ""},
+		{"falls back to v1", "GET", "/api/v2/only-v1", "", http.StatusOK, "/api/v1/only-v1", "v2"},
+		{"falls back to v1 for method", "POST", "/api/v2/things", "", http.StatusOK, "/api/v1/things", "v2"},
+		{"method no version has", "DELETE", "/api/v2/things", "", http.StatusMethodNotAllowed, "", "v2"},
+		{"versions list", "GET", apiVersionsPath, "v3", http.StatusOK, apiVersionsPath, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.accept != "" {
+				r.Header.Set(types.AcceptVersionHeader, tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.wantPath != "" && w.Body.String() != tt.wantPath {
+				t.Errorf("served by %s, want %s", w.Body, tt.wantPath)
+			}
+			if got := w.Header().Get(types.APIVersionHeader); got != tt.wantVersion {
+				t.Errorf("API-Version = %q, want %q", got, tt.wantVersion)
+			}
+			if deprecated := w.Header().Get("Deprecation") != ""; deprecated != (tt.wantVersion == "v1") {
+				t.Errorf("Deprecation = %q for %s", w.Header().Get("Deprecation"), tt.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-orchestration/api/types"
+	"github.com/google/uuid"
+)
+
+// orderComponents validates components and returns them in startup order:
+// every component comes after the components it depends on.
+func orderComponents(components []ApplicationComponent) ([]ApplicationComponent, error) {
+	if len(components) == 0 {
+		return nil, fmt.Errorf("at least one component is required")
+	}
+	byName := make(map[string]ApplicationComponent, len(components))
+	for _, c := range components {
+		if c.Name == "" || c.ImageURL == "" {
+			return nil, fmt.Errorf("every component needs a name and an image_url")
+		}
+		if _, exists := byName[c.Name]; exists {
+			return nil, fmt.Errorf("duplicate component %q", c.Name)
+		}
+		if _, err := requestedAmounts(c.Resources); err != nil {
+			return nil, fmt.Errorf("component %s: %w", c.Name, err)
+		}
+		if err := validateVolumes(c.Volumes); err != nil {
+			return nil, fmt.Errorf("component %s: %w", c.Name, err)
+		}
+		byName[c.Name] = c
+	}
+	for _, c := range components {
+		for _, dep := range c.DependsOn {
+			if _, exists := byName[dep]; !exists {
+				return nil, fmt.Errorf("component %s depends on unknown component %q", c.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]ApplicationComponent, 0, len(components))
+	placed := make(map[string]bool, len(components))
+	for len(ordered) < len(components) {
+		progress := false
+		for _, c := range components {
+			if placed[c.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range c.DependsOn {
+				ready = ready && placed[dep]
+			}
+			if ready {
+				ordered = append(ordered, c)
+				placed[c.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			var cycle []string
+			for _, c := range components {
+				if !placed[c.Name] {
+					cycle = append(cycle, c.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between components %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// DeployGroup creates a deployment for each component of an application and
+// supersedes the application's previous deployments. Components must be in
+// startup order. If any component cannot be created, nothing changes.
+func (s *DeploymentStore) DeployGroup(app *Application, components []ApplicationComponent, previous map[string]string) (map[string]*Deployment, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Superseded deployments no longer count towards quotas, so the new
+	// revision may take their place.
+	restore := make(map[*Deployment]DeploymentStatus)
+	for _, id := range previous {
+		if dep, exists := s.deployments[id]; exists && !retired(dep.Status) {
+			restore[dep] = dep.Status
+			s.setStatus(dep, types.StatusSuperseded)
+		}
+	}
+
+	// Hold back admission until the whole group exists.
+	s.held = []*Deployment{}
+	defer func() { s.held = nil }()
+
+	created := make(map[string]*Deployment, len(components))
+	for _, c := range components {
+		req := DeploymentRequest{
+			DeploymentRequest: types.DeploymentRequest{
+				AgentID:   app.AgentID,
+				ImageURL:  c.ImageURL,
+				Project:   app.Project,
+				Resources: c.Resources,
+				Volumes:   c.Volumes,
+				Configs:   c.Configs,
+			},
+			Application: app.ID,
+			Component:   c.Name,
+		}
+		for _, name := range c.DependsOn {
+			req.dependsOnIDs = append(req.dependsOnIDs, created[name].ID)
+		}
+		dep, err := s.create(req)
+		if err != nil {
+			for _, d := range created {
+				s.discard(d)
+			}
+			// Undo the supersede rather than transition back out of a
+			// final status.
+			for d, status := range restore {
+				d.Status = status
+				delete(d.StatusTimes, types.StatusSuperseded)
+			}
+			return nil, fmt.Errorf("component %s: %w", c.Name, err)
+		}
+		created[c.Name] = dep
+	}
+
+	for dep := range restore {
+		s.recordEvent(dep.ID, "superseded", fmt.Sprintf("Application %s updated to revision %d", app.ID, app.Revision+1))
+	}
+	for _, dep := range s.held {
+		if s.onPending != nil {
+			s.onPending(dep.ID, dep.AgentID, dep.Revision, pendingImage(dep))
+		}
+	}
+	return created, nil
+}
+
+// RemoveGroup marks the given deployments removed.
+func (s *DeploymentStore) RemoveGroup(ids map[string]string, reason string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, id := range ids {
+		if dep, exists := s.deployments[id]; exists && !retired(dep.Status) {
+			s.setStatus(dep, types.StatusRemoved)
+			s.recordEvent(id, "removed", reason)
+		}
+	}
+	s.admitQueued()
+}
+
+// GroupStatus summarizes the status of a group of deployments: "failed" if
+// any failed, "running" once all run, "queued" while any waits for quota,
+// "paused" if any was paused, and "deploying" otherwise.
+func (s *DeploymentStore) GroupStatus(ids map[string]string) string {
+	s.Lock()
+	defer s.Unlock()
+	running, queued, paused := 0, false, false
+	for _, id := range ids {
+		dep, exists := s.deployments[id]
+		if !exists {
+			continue
+		}
+		switch dep.Status {
+		case "failed":
+			return "failed"
+		case "running":
+			running++
+		case "queued":
+			queued = true
+		case "paused":
+			paused = true
+		}
+	}
+	switch {
+	case running == len(ids):
+		return "running"
+	case queued:
+		return "queued"
+	case paused:
+		return "paused"
+	}
+	return "deploying"
+}
+
+// discard deletes a deployment that was never handed out. The caller must hold the lock.
+func (s *DeploymentStore) discard(dep *Deployment) {
+	delete(s.deployments, dep.ID)
+	delete(s.events, dep.ID)
+	s.changed(dep.AgentID)
+	deps := s.byAgent[dep.AgentID]
+	for i, d := range deps {
+		if d == dep {
+			s.byAgent[dep.AgentID] = append(deps[:i:i], deps[i+1:]...)
+			break
+		}
+	}
+}
+
+// ApplicationStore manages applications and the revisions of their components.
+type ApplicationStore struct {
+	sync.Mutex
+	applications map[string]*Application
+	history      map[string]map[int][]ApplicationComponent // Components of every revision, by application
+	deployments  *DeploymentStore
+	configs      *ConfigStore
+}
+
+// NewApplicationStore creates a new in-memory application store.
+func NewApplicationStore(deployments *DeploymentStore, configs *ConfigStore) *ApplicationStore {
+	return &ApplicationStore{
+		applications: make(map[string]*Application),
+		history:      make(map[string]map[int][]ApplicationComponent),
+		deployments:  deployments,
+		configs:      configs,
+	}
+}
+
+// Create validates and deploys a new application.
+func (s *ApplicationStore) Create(req ApplicationRequest) (*Application, error) {
+	ordered, err := orderComponents(req.Components)
+	if err != nil {
+		return nil, err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+	app := &Application{
+		ID:        fmt.Sprintf("app-%s", uuid.New().String()[:8]),
+		Name:      req.Name,
+		AgentID:   req.AgentID,
+		Project:   req.Project,
+		CreatedAt: now,
+	}
+	if err := s.deploy(app, ordered); err != nil {
+		return nil, err
+	}
+	s.applications[app.ID] = app
+	s.history[app.ID] = make(map[int][]ApplicationComponent)
+	s.history[app.ID][app.Revision] = app.Components
+	log.Printf("Application %s (%s) created for agent %s with %d components", app.ID, app.Name, app.AgentID, len(app.Components))
+	return s.view(app), nil
+}
+
+// Update deploys a new revision of an application with the given components.
+// It reports false if the application does not exist.
+func (s *ApplicationStore) Update(id string, components []ApplicationComponent) (*Application, bool, error) {
+	ordered, err := orderComponents(components)
+	if err != nil {
+		return nil, true, err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	app, exists := s.applications[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := s.deploy(app, ordered); err != nil {
+		return nil, true, err
+	}
+	s.history[id][app.Revision] = app.Components
+	log.Printf("Application %s updated to revision %d", id, app.Revision)
+	return s.view(app), true, nil
+}
+
+// Rollback redeploys the components of an earlier revision as a new
+// revision. A revision of 0 selects the previous revision. It reports false
+// if the application does not exist.
+func (s *ApplicationStore) Rollback(id string, revision int) (*Application, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	app, exists := s.applications[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if revision == 0 {
+		revision = app.Revision - 1
+	}
+	components, exists := s.history[id][revision]
+	if !exists || revision == app.Revision {
+		return nil, true, fmt.Errorf("application %s has no earlier revision %d", id, revision)
+	}
+	// Components were ordered when the revision was first deployed.
+	if err := s.deploy(app, components); err != nil {
+		return nil, true, err
+	}
+	s.history[id][app.Revision] = app.Components
+	for _, depID := range app.Deployments {
+		s.deployments.RecordEvent(depID, "rolled_back", fmt.Sprintf("Application %s rolled back to revision %d", id, revision))
+	}
+	log.Printf("Application %s rolled back to revision %d as revision %d", id, revision, app.Revision)
+	return s.view(app), true, nil
+}
+
+// Delete removes an application and all of its deployments. It reports
+// false if the application does not exist.
+func (s *ApplicationStore) Delete(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	app, exists := s.applications[id]
+	if !exists {
+		return false
+	}
+	s.deployments.RemoveGroup(app.Deployments, fmt.Sprintf("Application %s deleted", id))
+	delete(s.applications, id)
+	delete(s.history, id)
+	log.Printf("Application %s deleted", id)
+	return true
+}
+
+// Get returns the application with the given ID.
+func (s *ApplicationStore) Get(id string) (*Application, bool) {
+	s.Lock()
+	defer s.Unlock()
+	app, exists := s.applications[id]
+	if !exists {
+		return nil, false
+	}
+	return s.view(app), true
+}
+
+// List returns all applications, oldest first.
+func (s *ApplicationStore) List() []*Application {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]*Application, 0, len(s.applications))
+	for _, app := range s.applications {
+		list = append(list, s.view(app))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// deploy deploys components as the next revision of app. The caller must hold the lock.
+func (s *ApplicationStore) deploy(app *Application, components []ApplicationComponent) error {
+	// Configs may have changed or been deleted since the components were
+	// last deployed, e.g. when rolling back.
+	components = append([]ApplicationComponent(nil), components...)
+	for i, c := range components {
+		c.Configs = append([]ConfigRef(nil), c.Configs...)
+		if err := s.configs.Resolve(c.Configs); err != nil {
+			return fmt.Errorf("component %s: %w", c.Name, err)
+		}
+		components[i] = c
+	}
+	created, err := s.deployments.DeployGroup(app, components, app.Deployments)
+
+	if err != nil {
+		return err
+	}
+	app.Components = components
+	app.Revision++
+	app.UpdatedAt = time.Now().UTC()
+	app.Deployments = make(map[string]string, len(created))
+	for name, dep := range created {
+		app.Deployments[name] = dep.ID
+	}
+	return nil
+}
+
+// view returns a copy of app with its current status. The caller must hold the lock.
+func (s *ApplicationStore) view(app *Application) *Application {
+	v := *app
+	v.Status = s.deployments.GroupStatus(app.Deployments)
+	return &v
+}
+
+// handleListApplications serves GET /api/v1/applications.
+func (s *Server) handleListApplications(w http.ResponseWriter, r *http.Request) {
+	encodeList(w, s.apps.List())
+}
+
+// handleCreateApplication serves POST /api/v1/applications.
+func (s *Server) handleCreateApplication(w http.ResponseWriter, r *http.Request) {
+	var req ApplicationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.Name == "" || req.AgentID == "" {
+		http.Error(w, "name and agent_id are required", http.StatusBadRequest)
+		return
+	}
+	if err := validateComponents(s.configs, req.Components); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkComponentPolicies(w, r, s.engine, s.agents, req.AgentID, req.Project, req.Components) {
+		return
+	}
+	if err := s.freezes.check(r, req.Project, req.AgentID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	app, err := s.apps.Create(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(app)
+}
+
+// applicationFrozen writes a 403 response and reports true if a freeze holds
+// an application's deployments, which changing the application changes.
+func (s *Server) applicationFrozen(w http.ResponseWriter, r *http.Request, id string) bool {
+	if app, exists := s.apps.Get(id); exists {
+		if err := s.freezes.check(r, app.Project, app.AgentID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return true
+		}
+	}
+	return false
+}
+
+// handleGetApplication serves GET /api/v1/applications/{id}.
+func (s *Server) handleGetApplication(w http.ResponseWriter, r *http.Request) {
+	app, exists := s.apps.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Application not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(app)
+}
+
+// handleUpdateApplication serves PUT /api/v1/applications/{id}, which
+// replaces an application's components as its next revision.
+func (s *Server) handleUpdateApplication(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.applicationFrozen(w, r, id) {
+		return
+	}
+	var req ApplicationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	current, exists := s.apps.Get(id)
+	if !exists {
+		http.Error(w, "Application not found", http.StatusNotFound)
+		return
+	}
+	if err := validateComponents(s.configs, req.Components); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !checkComponentPolicies(w, r, s.engine, s.agents, current.AgentID, current.Project, req.Components) {
+		return
+	}
+	app, exists, err := s.apps.Update(id, req.Components)
+	if !exists {
+		http.Error(w, "Application not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	json.NewEncoder(w).Encode(app)
+}
+
+// handleDeleteApplication serves DELETE /api/v1/applications/{id}.
+func (s *Server) handleDeleteApplication(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.applicationFrozen(w, r, id) {
+		return
+	}
+	if !s.apps.Delete(id) {
+		http.Error(w, "Application not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRollbackApplication serves POST /api/v1/applications/{id}/rollback,
+// which redeploys an earlier revision, by default the previous one.
+func (s *Server) handleRollbackApplication(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.applicationFrozen(w, r, id) {
+		return
+	}
+	var req RollbackRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidBody(w, err, "Invalid request body")
+			return
+		}
+	}
+	app, exists, err := s.apps.Rollback(id, req.Revision)
+	if !exists {
+		http.Error(w, "Application not found", http.StatusNotFound)
+		return
+	}
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(app)
+}
+
+// validateComponents checks components and the configs they reference.
+func validateComponents(configs *ConfigStore, components []ApplicationComponent) error {
+	if _, err := orderComponents(components); err != nil {
+		return err
+	}
+	for _, c := range components {
+		if err := configs.Resolve(c.Configs); err != nil {
+			return fmt.Errorf("component %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkComponentPolicies evaluates every component as a deployment request
+// and writes an error response for the first one that is not admitted.
+func checkComponentPolicies(w http.ResponseWriter, r *http.Request, engine *PolicyEngine, agents *AgentStore, agentID, project string, components []ApplicationComponent) bool {
+	for _, c := range components {
+		req := types.DeploymentRequest{AgentID: agentID, ImageURL: c.ImageURL, Project: project, Resources: c.Resources}
+		if !checkPolicies(w, r, engine, agents, req) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// ApproversFromEnv reads the people who may approve rollout waves from
+// ROLLOUT_APPROVERS, a comma-separated list of <name>:<token> pairs. It
+// returns the approvers' names by token.
+func ApproversFromEnv() (map[string]string, error) {
+	approvers := make(map[string]string)
+	v := os.Getenv("ROLLOUT_APPROVERS")
+	if v == "" {
+		return approvers, nil
+	}
+	for _, entry := range strings.Split(v, ",") {
+		name, token, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid ROLLOUT_APPROVERS entry %q: expected <name>:<token>", entry)
+		}
+		if _, exists := approvers[token]; exists {
+			return nil, fmt.Errorf("invalid ROLLOUT_APPROVERS: approver %s reuses another approver's token", name)
+		}
+		approvers[token] = name
+	}
+	log.Printf("%d rollout approvers configured", len(approvers))
+	return approvers, nil
+}
+
+// approver returns the name of the approver the request's bearer token
+// identifies.
+func (m *Rollouts) approver(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	for t, name := range m.approvers {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Approve lets the wave a rollout is waiting at start, recording who
+// approved it. It returns false if the rollout does not exist and an error if
+// it is not awaiting approval.
+func (m *Rollouts) Approve(id, approver, comment string) (*Rollout, bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	r, exists := m.rollouts[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if r.Status != "awaiting_approval" {
+		return nil, true, fmt.Errorf("rollout %s is %s, not awaiting approval", id, r.Status)
+	}
+	now := time.Now().UTC()
+	r.Waves[r.CurrentWave].Approval = &RolloutApproval{Approver: approver, Comment: comment, ApprovedAt: now}
+	r.Status = "running"
+	log.Printf("Rollout %s: wave %d of %d approved by %s", id, r.CurrentWave+1, len(r.Waves), approver)
+	m.advance(r, now)
+	approved := *r
+	return &approved, true, nil
+}
+
+// handleApproveRollout starts the wave a rollout is waiting at. The approver
+// is identified by a bearer token from ROLLOUT_APPROVERS.
+func (s *Server) handleApproveRollout(w http.ResponseWriter, r *http.Request) {
+	approver, ok := s.rollouts.approver(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Approving rollouts requires an approver token from ROLLOUT_APPROVERS", http.StatusUnauthorized)
+		return
+	}
+	var req types.ApproveRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidBody(w, err, "Invalid request body")
+			return
+		}
+	}
+	rollout, exists, err := s.rollouts.Approve(r.PathValue("id"), approver, req.Comment)
+	if !exists {
+		http.Error(w, "Rollout not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(rollout)
+}
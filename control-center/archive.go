@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// includeArchived reports whether a list request asked for archived records
+// with ?include_archived=true.
+func includeArchived(r *http.Request) bool {
+	return r.URL.Query().Get("include_archived") == "true"
+}
+
+// Archive soft-deletes a deployment: it is torn down, hidden from default
+// lists, and kept with its event timeline until purged. It returns false if
+// the deployment does not exist.
+func (s *DeploymentStore) Archive(id string, expected int, reason string) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if dep.ArchivedAt != nil {
+		return nil, true, fmt.Errorf("deployment %s is already archived", id)
+	}
+	if dep.Application != "" && !retired(dep.Status) {
+		return nil, true, fmt.Errorf("deployment %s is managed by application %s; delete the application instead", id, dep.Application)
+	}
+	if dep.GitSpec != "" && !retired(dep.Status) {
+		return nil, true, fmt.Errorf("deployment %s is managed by git spec %s; delete the spec instead", id, dep.GitSpec)
+	}
+	if dep.KubernetesObject != "" && !retired(dep.Status) {
+		return nil, true, fmt.Errorf("deployment %s is managed by ControlCenterDeployment %s; delete the object instead", id, dep.KubernetesObject)
+	}
+	if dep.AddonOf != "" && !retired(dep.Status) {
+		return nil, true, fmt.Errorf("deployment %s runs an add-on of deployment %s; delete that instead", id, dep.AddonOf)
+	}
+
+	if !retired(dep.Status) {
+		s.setStatus(dep, types.StatusDeleted)
+		dep.Reason = reason
+		s.recordEvent(id, "deleted", reason)
+	}
+	now := time.Now().UTC()
+	dep.ArchivedAt = &now
+	s.recordEvent(id, "archived", "Deployment archived")
+	s.archiveAddons(dep, now)
+	log.Printf("Deployment %s archived", id)
+	s.admitQueued()
+	return cloneDeployment(dep), true, nil
+}
+
+// ActiveForAgent returns the IDs of the agent's deployments that are neither
+// retired nor archived.
+func (s *DeploymentStore) ActiveForAgent(agentID string) []string {
+	s.Lock()
+	defer s.Unlock()
+	var ids []string
+	for _, dep := range s.byAgent[agentID] {
+		if dep.ArchivedAt == nil && !retired(dep.Status) {
+			ids = append(ids, dep.ID)
+		}
+	}
+	return ids
+}
+
+// Purge permanently deletes deployments that were archived before the cutoff,
+// along with their event timelines, and returns how many it deleted.
+func (s *DeploymentStore) Purge(cutoff time.Time) int {
+	s.Lock()
+	defer s.Unlock()
+
+	purged := 0
+	for id, dep := range s.deployments {
+		if dep.ArchivedAt == nil || dep.ArchivedAt.After(cutoff) {
+			continue
+		}
+		deps := s.byAgent[dep.AgentID]
+		for i, d := range deps {
+			if d == dep {
+				s.byAgent[dep.AgentID] = append(deps[:i:i], deps[i+1:]...)
+				break
+			}
+		}
+		delete(s.deployments, id)
+		delete(s.events, id)
+		s.changed(dep.AgentID)
+		purged++
+	}
+	return purged
+}
+
+// Archive soft-deletes an agent. Archived agents are hidden from default
+// lists and their heartbeats are rejected.
+func (s *AgentStore) Archive(id string) (*Agent, bool) {
+	s.Lock()
+	defer s.Unlock()
+	agent, exists := s.agents[id]
+	if !exists || agent.ArchivedAt != nil {
+		return nil, false
+	}
+	now := time.Now().UTC()
+	agent.ArchivedAt = &now
+	agent.Status = "archived"
+	s.revision++
+	log.Printf("Agent %s archived", id)
+	s.recordEvent(agent, "archived")
+	return cloneAgent(agent), true
+}
+
+// Purge permanently deletes agents that were archived before the cutoff and
+// returns how many it deleted.
+func (s *AgentStore) Purge(cutoff time.Time) int {
+	s.Lock()
+	defer s.Unlock()
+	purged := 0
+	for id, agent := range s.agents {
+		if agent.ArchivedAt != nil && !agent.ArchivedAt.After(cutoff) {
+			delete(s.agents, id)
+			delete(s.credentials, id)
+			purged++
+		}
+	}
+	if purged > 0 {
+		s.revision++
+	}
+	return purged
+}
+
+// PurgeResult reports how many archived records a purge deleted.
+type PurgeResult struct {
+	Deployments int `json:"deployments"`
+	Agents      int `json:"agents"`
+}
+
+// handleGetAgent returns a single agent.
+func (s *Server) handleGetAgent(w http.ResponseWriter, r *http.Request) {
+	agent, exists := s.agents.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(agent)
+}
+
+// handleDeleteAgent archives an agent that has no active deployments.
+func (s *Server) handleDeleteAgent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if active := s.deployments.ActiveForAgent(id); len(active) > 0 {
+		http.Error(w, fmt.Sprintf("Agent %s still has deployments %s", id, strings.Join(active, ", ")), http.StatusConflict)
+		return
+	}
+	agent, ok := s.agents.Archive(id)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(agent)
+}
+
+// handlePurge serves POST /api/v1/purge, which permanently deletes
+// deployments and agents archived more than ?older_than ago, or all archived
+// records if unset.
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	cutoff := time.Now().UTC()
+	if v := r.URL.Query().Get("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, fmt.Sprintf("Invalid older_than %q: expected a duration such as 720h", v), http.StatusBadRequest)
+			return
+		}
+		cutoff = cutoff.Add(-d)
+	}
+	result := PurgeResult{Deployments: s.deployments.Purge(cutoff), Agents: s.agents.Purge(cutoff)}
+	logf(r.Context(), "Purged %d deployments and %d agents archived before %s", result.Deployments, result.Agents, cutoff.Format(time.RFC3339))
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// validateArtifacts checks that artifact names are unique, that their sources
+// are Hugging Face, S3, or HTTPS locations, and that they are mounted at
+// absolute paths no volume or other artifact uses.
+func validateArtifacts(artifacts []Artifact, volumes []Volume) error {
+	mounts := make(map[string]bool, len(volumes)+len(artifacts))
+	for _, v := range volumes {
+		mounts[path.Clean(v.MountPath)] = true
+	}
+	names := make(map[string]bool, len(artifacts))
+	for _, a := range artifacts {
+		if a.Name == "" {
+			return fmt.Errorf("every artifact needs a name")
+		}
+		if names[a.Name] {
+			return fmt.Errorf("duplicate artifact %q", a.Name)
+		}
+		names[a.Name] = true
+		if err := validateArtifactSource(a.Source); err != nil {
+			return fmt.Errorf("artifact %s: %w", a.Name, err)
+		}
+		if !path.IsAbs(a.MountPath) {
+			return fmt.Errorf("artifact %s: mount_path must be an absolute path", a.Name)
+		}
+		if mounts[path.Clean(a.MountPath)] {
+			return fmt.Errorf("artifact %s: mount_path %s is already in use", a.Name, a.MountPath)
+		}
+		mounts[path.Clean(a.MountPath)] = true
+		if sum, err := hex.DecodeString(a.SHA256); err != nil || len(sum) != 32 {
+			return fmt.Errorf("artifact %s: sha256 must be the file's hex SHA-256 checksum", a.Name)
+		}
+	}
+	return nil
+}
+
+// validateArtifactSource checks that a source names a single file:
+// hf://<org>/<repo>/<file>[@<revision>], s3://<bucket>/<key>, or an https://
+// URL.
+func validateArtifactSource(source string) error {
+	switch {
+	case strings.HasPrefix(source, "hf://"):
+		repoPath, _, _ := strings.Cut(strings.TrimPrefix(source, "hf://"), "@")
+		if parts := strings.SplitN(repoPath, "/", 3); len(parts) < 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("invalid source %q: expected hf://<org>/<repo>/<file>[@<revision>]", source)
+		}
+	case strings.HasPrefix(source, "s3://"):
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(source, "s3://"), "/")
+		if bucket == "" || key == "" {
+			return fmt.Errorf("invalid source %q: expected s3://<bucket>/<key>", source)
+		}
+	case strings.HasPrefix(source, "https://"):
+		if u, err := url.Parse(source); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid source %q", source)
+		}
+	default:
+		return fmt.Errorf("invalid source %q: must start with hf://, s3://, or https://", source)
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupVersion is the format version of backups written by this control
+// center. Version 1 backups, which held secret values in plaintext, can
+// still be restored; backups of newer versions are refused.
+const backupVersion = 2
+
+// maxBackupSize caps the size of a backup accepted for restore.
+const maxBackupSize = 256 << 20
+
+// Backup is a snapshot of the control center's state. Agents' credentials are
+// included as hashes, so that agents can reconnect after a restore. Left out
+// are admission policies, which live in Open Policy Agent; registry
+// credentials, which come from the Docker config file, and registry health
+// and GitOps sync state, which are rebuilt at runtime; short-lived fleet and
+// config rollouts; bootstrap tokens, which expire within 30 days and are
+// issued again as needed; and alerts, which fire again from their rules if
+// their condition still holds.
+type Backup struct {
+	Version            int                                       `json:"version"`
+	CreatedAt          time.Time                                 `json:"created_at"`
+	Agents             []Agent                                   `json:"agents"`
+	AgentCredentials   map[string]string                         `json:"agent_credentials,omitempty"` // SHA-256 hashes of the credentials agents reconnect with, by agent ID
+	Deployments        []Deployment                              `json:"deployments"`
+	Events             map[string][]DeploymentEvent              `json:"events"` // Event timelines, by deployment ID
+	Configs            []Config                                  `json:"configs"`
+	ConfigHistory      map[string][]Config                       `json:"config_history,omitempty"` // Every version of every config, by name
+	Secrets            []SecretBackup                            `json:"secrets,omitempty"`
+	Quotas             []Quota                                   `json:"quotas"`
+	Applications       []Application                             `json:"applications"`
+	ApplicationHistory map[string]map[int][]ApplicationComponent `json:"application_history"` // Components of every revision, by application ID
+	Fleets             []Fleet                                   `json:"fleets,omitempty"`
+	Freezes            []Freeze                                  `json:"freezes,omitempty"`
+	Channels           []Channel                                 `json:"channels,omitempty"`
+	AlertRules         []AlertRule                               `json:"alert_rules,omitempty"`
+}
+
+// BackupSettings guard the admin endpoints, which back up and restore the
+// control center's state and issue bootstrap tokens.
+type BackupSettings struct {
+	token string      // Bearer token the admin endpoints require; they are disabled without one
+	key   cipher.AEAD // Encrypts secret values in backups; nil leaves them out
+}
+
+// BackupSettingsFromEnv reads the bearer token the admin endpoints require
+// from ADMIN_TOKEN, and from BACKUP_ENCRYPTION_KEY the base64-encoded 32-byte
+// key secret values in backups are encrypted with. Without a key, backups
+// leave secret values out.
+func BackupSettingsFromEnv() (*BackupSettings, error) {
+	b := &BackupSettings{token: os.Getenv("ADMIN_TOKEN")}
+	if v := os.Getenv("BACKUP_ENCRYPTION_KEY"); v != "" {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid BACKUP_ENCRYPTION_KEY: must be 32 bytes encoded in base64, e.g. from openssl rand -base64 32")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if b.key, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case b.token == "":
+		log.Printf("Backup, restore, and bootstrap tokens are disabled; set ADMIN_TOKEN to enable them")
+	case b.key == nil:
+		log.Printf("Backups leave secret values out; set BACKUP_ENCRYPTION_KEY to include them encrypted")
+	}
+	return b, nil
+}
+
+// authorize answers requests to the admin endpoints that do not carry
+// ADMIN_TOKEN as a bearer token, and reports whether the request may go on.
+func (b *BackupSettings) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if b.token == "" {
+		http.Error(w, "Admin endpoints are disabled; set ADMIN_TOKEN on the control center", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(b.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Admin endpoints require the token in ADMIN_TOKEN", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// requireAdmin wraps a handler of an admin endpoint so that it only serves
+// requests that carry ADMIN_TOKEN.
+func (s *Server) requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.admin.authorize(w, r) {
+			h(w, r)
+		}
+	}
+}
+
+// seal encrypts the value of a secret version. The secret's name and version
+// are authenticated with it, so that values cannot be swapped in a backup.
+func (b *BackupSettings) seal(name string, version int, value string) (string, error) {
+	nonce := make([]byte, b.key.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.key.Seal(nonce, nonce, []byte(value), secretBackupData(name, version))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts the value of a secret version sealed by seal.
+func (b *BackupSettings) open(name string, version int, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < b.key.NonceSize() {
+		return "", fmt.Errorf("secret %s version %d: malformed encrypted value", name, version)
+	}
+	nonce, ciphertext := data[:b.key.NonceSize()], data[b.key.NonceSize():]
+	value, err := b.key.Open(nil, nonce, ciphertext, secretBackupData(name, version))
+	if err != nil {
+		return "", fmt.Errorf("secret %s version %d: value cannot be decrypted; is BACKUP_ENCRYPTION_KEY the key the backup was created with?", name, version)
+	}
+	return string(value), nil
+}
+
+// secretBackupData is the data authenticated with a secret version's
+// encrypted value.
+func secretBackupData(name string, version int) []byte {
+	return []byte(fmt.Sprintf("%s/%d", name, version))
+}
+
+// encryptSecrets replaces the values of secrets with their encrypted values,
+// or drops them without a key.
+func (b *BackupSettings) encryptSecrets(secrets []SecretBackup) error {
+	for i := range secrets {
+		values := secrets[i].Values
+		secrets[i].Values = nil
+		if b.key == nil {
+			continue
+		}
+		secrets[i].EncryptedValues = make(map[int]string, len(values))
+		for version, value := range values {
+			sealed, err := b.seal(secrets[i].Name, version, value)
+			if err != nil {
+				return err
+			}
+			secrets[i].EncryptedValues[version] = sealed
+		}
+	}
+	return nil
+}
+
+// decryptSecrets replaces the encrypted values of secrets from a backup with
+// their values. Backups of version 1 carry plaintext values, which are kept.
+func (b *BackupSettings) decryptSecrets(secrets []SecretBackup) error {
+	for i := range secrets {
+		if secrets[i].EncryptedValues == nil {
+			continue
+		}
+		if b.key == nil {
+			return fmt.Errorf("secret values are encrypted; set BACKUP_ENCRYPTION_KEY to the key the backup was created with")
+		}
+		secrets[i].Values = make(map[int]string, len(secrets[i].EncryptedValues))
+		for version, sealed := range secrets[i].EncryptedValues {
+			value, err := b.open(secrets[i].Name, version, sealed)
+			if err != nil {
+				return err
+			}
+			secrets[i].Values[version] = value
+		}
+		secrets[i].EncryptedValues = nil
+	}
+	return nil
+}
+
+// snapshot returns copies of all agents ordered by ID.
+func (s *AgentStore) snapshot() []Agent {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Agent, 0, len(s.agents))
+	for _, agent := range s.agents {
+		list = append(list, *cloneAgent(agent))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// restore replaces all agents and their credentials.
+func (s *AgentStore) restore(agents []Agent, credentials map[string][sha256.Size]byte) {
+	s.Lock()
+	defer s.Unlock()
+	s.agents = make(map[string]*Agent, len(agents))
+	for _, agent := range agents {
+		s.agents[agent.ID] = &agent
+	}
+	s.credentials = credentials
+	s.revision++
+}
+
+// snapshot returns copies of all deployments ordered by creation time, and
+// their event timelines.
+func (s *DeploymentStore) snapshot() ([]Deployment, map[string][]DeploymentEvent) {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Deployment, 0, len(s.deployments))
+	events := make(map[string][]DeploymentEvent, len(s.events))
+	for id, dep := range s.deployments {
+		list = append(list, *cloneDeployment(dep))
+		events[id] = append([]DeploymentEvent(nil), s.events[id]...)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, events
+}
+
+// restore replaces all deployments and their event timelines, and hands
+// pending revisions to admission again.
+func (s *DeploymentStore) restore(deployments []Deployment, events map[string][]DeploymentEvent) {
+	s.Lock()
+	defer s.Unlock()
+	s.deployments = make(map[string]*Deployment, len(deployments))
+	s.byAgent = make(map[string][]*Deployment)
+	s.events = make(map[string][]DeploymentEvent, len(deployments))
+	s.refRollouts = make(map[string]*refRollout)
+	for _, dep := range deployments {
+		s.deployments[dep.ID] = &dep
+		s.byAgent[dep.AgentID] = append(s.byAgent[dep.AgentID], &dep)
+		s.events[dep.ID] = events[dep.ID]
+	}
+	for _, dep := range s.deployments {
+		if dep.Status == "pending" {
+			s.notifyPending(dep)
+		}
+	}
+	// Revisions only ever grow, so that ETags handed out before the restore
+	// do not match the restored lists by accident.
+	for agentID := range s.revisions {
+		s.changed(agentID)
+	}
+	for agentID := range s.byAgent {
+		if _, seen := s.revisions[agentID]; !seen {
+			s.changed(agentID)
+		}
+	}
+}
+
+// snapshot returns every version of every config, by name.
+func (s *ConfigStore) snapshot() map[string][]Config {
+	s.Lock()
+	defer s.Unlock()
+	history := make(map[string][]Config, len(s.history))
+	for name, versions := range s.history {
+		for _, cfg := range versions {
+			history[name] = append(history[name], cfg)
+		}
+		sort.Slice(history[name], func(i, j int) bool { return history[name][i].Version < history[name][j].Version })
+	}
+	return history
+}
+
+// restore replaces all configs and their versions. Backups taken before
+// versions were kept only hold the latest one.
+func (s *ConfigStore) restore(configs []Config, history map[string][]Config) {
+	s.Lock()
+	defer s.Unlock()
+	s.configs = make(map[string]*Config, len(configs))
+	s.history = make(map[string]map[int]Config, len(configs))
+	for _, cfg := range configs {
+		s.configs[cfg.Name] = &cfg
+		s.history[cfg.Name] = map[int]Config{cfg.Version: cfg}
+		for _, version := range history[cfg.Name] {
+			s.history[cfg.Name][version.Version] = version
+		}
+	}
+}
+
+// SecretBackup is a secret with the value of every version. Backups only
+// carry values encrypted with BACKUP_ENCRYPTION_KEY, or none without it.
+type SecretBackup struct {
+	Secret
+	EncryptedValues map[int]string `json:"encrypted_values,omitempty"` // Base64-encoded AES-GCM nonce and ciphertext, by version
+	Values          map[int]string `json:"values,omitempty"`           // Plaintext values; only read from backups of version 1
+}
+
+// snapshot returns all secrets ordered by name, with their values.
+func (s *SecretStore) snapshot() []SecretBackup {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]SecretBackup, 0, len(s.secrets))
+	for name, secret := range s.secrets {
+		list = append(list, SecretBackup{Secret: *secret, Values: maps.Clone(s.values[name])})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// restore replaces all secrets and their values. Secrets backed up without
+// values keep the values this control center has for them, if any.
+func (s *SecretStore) restore(secrets []SecretBackup) {
+	s.Lock()
+	defer s.Unlock()
+	previous := s.values
+	s.secrets = make(map[string]*Secret, len(secrets))
+	s.values = make(map[string]map[int]string, len(secrets))
+	for _, b := range secrets {
+		secret := b.Secret
+		s.secrets[secret.Name] = &secret
+		s.values[secret.Name] = maps.Clone(b.Values)
+		if b.Values == nil {
+			s.values[secret.Name] = previous[secret.Name]
+		}
+		if s.values[secret.Name] == nil {
+			s.values[secret.Name] = make(map[int]string)
+		}
+	}
+}
+
+// restore replaces all quotas.
+func (s *QuotaStore) restore(quotas []Quota) {
+	s.Lock()
+	defer s.Unlock()
+	s.quotas = make(map[string]Quota, len(quotas))
+	for _, q := range quotas {
+		s.quotas[q.Scope+"/"+q.Name] = q
+	}
+}
+
+// snapshot returns copies of all applications ordered by ID, and the
+// components of every revision.
+func (s *ApplicationStore) snapshot() ([]Application, map[string]map[int][]ApplicationComponent) {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Application, 0, len(s.applications))
+	history := make(map[string]map[int][]ApplicationComponent, len(s.history))
+	for id, app := range s.applications {
+		list = append(list, *app)
+		history[id] = make(map[int][]ApplicationComponent, len(s.history[id]))
+		for revision, components := range s.history[id] {
+			history[id][revision] = components
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, history
+}
+
+// restore replaces all applications and their revision history.
+func (s *ApplicationStore) restore(applications []Application, history map[string]map[int][]ApplicationComponent) {
+	s.Lock()
+	defer s.Unlock()
+	s.applications = make(map[string]*Application, len(applications))
+	s.history = make(map[string]map[int][]ApplicationComponent, len(applications))
+	for _, app := range applications {
+		s.applications[app.ID] = &app
+		s.history[app.ID] = history[app.ID]
+		if s.history[app.ID] == nil {
+			s.history[app.ID] = make(map[int][]ApplicationComponent)
+		}
+	}
+}
+
+// validate checks that a backup can be restored by this control center.
+func (b *Backup) validate() error {
+	if b.Version < 1 || b.Version > backupVersion {
+		return fmt.Errorf("backup version %d is not supported; expected version 1 to %d", b.Version, backupVersion)
+	}
+	agents := make(map[string]bool, len(b.Agents))
+	for _, agent := range b.Agents {
+		if agent.ID == "" || agents[agent.ID] {
+			return fmt.Errorf("agent IDs must be present and unique")
+		}
+		agents[agent.ID] = true
+	}
+	deployments := make(map[string]bool, len(b.Deployments))
+	for _, dep := range b.Deployments {
+		if dep.ID == "" || deployments[dep.ID] {
+			return fmt.Errorf("deployment IDs must be present and unique")
+		}
+		deployments[dep.ID] = true
+	}
+	fleets := make(map[string]bool, len(b.Fleets))
+	for _, fleet := range b.Fleets {
+		if err := validateFleetName(fleet.Name); err != nil || fleets[fleet.Name] {
+			return fmt.Errorf("fleet names must be valid and unique")
+		}
+		fleets[fleet.Name] = true
+	}
+	freezes := make(map[string]bool, len(b.Freezes))
+	for _, f := range b.Freezes {
+		if f.ID == "" || freezes[f.ID] {
+			return fmt.Errorf("freeze IDs must be present and unique")
+		}
+		freezes[f.ID] = true
+	}
+	channels := make(map[string]bool, len(b.Channels))
+	for _, ch := range b.Channels {
+		if err := validateChannelName(ch.Name); err != nil || channels[ch.Name] {
+			return fmt.Errorf("channel names must be valid and unique")
+		}
+		channels[ch.Name] = true
+	}
+	rules := make(map[string]bool, len(b.AlertRules))
+	for _, rule := range b.AlertRules {
+		if err := validateAlertRule(&rule); err != nil || rules[rule.Name] {
+			return fmt.Errorf("alert rules must be valid and have unique names")
+		}
+		rules[rule.Name] = true
+	}
+	for _, app := range b.Applications {
+		for component, id := range app.Deployments {
+			if !deployments[id] {
+				return fmt.Errorf("application %s component %s refers to unknown deployment %s", app.ID, component, id)
+			}
+		}
+	}
+	return nil
+}
+
+// handleBackup serves GET /api/v1/admin/backup, which returns a snapshot of
+// the control center's state with secret values encrypted.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	b := Backup{Version: backupVersion, CreatedAt: time.Now().UTC()}
+	b.Agents = s.agents.snapshot()
+	b.AgentCredentials = s.agents.credentialHashes()
+	b.Deployments, b.Events = s.deployments.snapshot()
+	b.Configs = s.configs.List()
+	b.ConfigHistory = s.configs.snapshot()
+	b.Secrets = s.secrets.snapshot()
+	if err := s.admin.encryptSecrets(b.Secrets); err != nil {
+		http.Error(w, "Failed to encrypt secret values: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b.Quotas = s.quotas.List()
+	b.Applications, b.ApplicationHistory = s.apps.snapshot()
+	b.Fleets = s.fleets.List()
+	b.Freezes = s.freezes.List()
+	b.Channels = s.channels.List()
+	b.AlertRules = s.alerts.List()
+	logf(r.Context(), "Backup created with %d agents, %d deployments, %d configs, %d secrets, %d quotas, %d applications, %d fleets, %d freezes, %d channels, and %d alert rules",
+		len(b.Agents), len(b.Deployments), len(b.Configs), len(b.Secrets), len(b.Quotas), len(b.Applications), len(b.Fleets), len(b.Freezes), len(b.Channels), len(b.AlertRules))
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=control-center-%s.json", b.CreatedAt.Format("20060102T150405Z")))
+	json.NewEncoder(w).Encode(b)
+}
+
+// handleRestore serves POST /api/v1/admin/restore, which replaces the
+// control center's state with a backup. Pending revisions are admitted again.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	var b Backup
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBackupSize)).Decode(&b); err != nil {
+		invalidBody(w, err, "Invalid backup")
+		return
+	}
+	if err := b.validate(); err != nil {
+		http.Error(w, "Invalid backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.admin.decryptSecrets(b.Secrets); err != nil {
+		http.Error(w, "Invalid backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	credentials, err := parseCredentialHashes(b.AgentCredentials)
+	if err != nil {
+		http.Error(w, "Invalid backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.agents.restore(b.Agents, credentials)
+	s.configs.restore(b.Configs, b.ConfigHistory)
+	s.secrets.restore(b.Secrets)
+	s.quotas.restore(b.Quotas)
+	s.apps.restore(b.Applications, b.ApplicationHistory)
+	s.fleets.restore(b.Fleets)
+	s.freezes.restore(b.Freezes)
+	s.channels.restore(b.Channels)
+	s.alerts.restore(b.AlertRules)
+	s.deployments.restore(b.Deployments, b.Events)
+	result := RestoreResult{
+		Agents:       len(b.Agents),
+		Deployments:  len(b.Deployments),
+		Configs:      len(b.Configs),
+		Secrets:      len(b.Secrets),
+		Quotas:       len(b.Quotas),
+		Applications: len(b.Applications),
+		Fleets:       len(b.Fleets),
+		Freezes:      len(b.Freezes),
+		Channels:     len(b.Channels),
+		AlertRules:   len(b.AlertRules),
+	}
+	logf(r.Context(), "Restored backup from %s with %d agents, %d deployments, %d configs, %d secrets, %d quotas, %d applications, %d fleets, %d freezes, %d channels, and %d alert rules",
+		b.CreatedAt.Format(time.RFC3339), result.Agents, result.Deployments, result.Configs, result.Secrets, result.Quotas, result.Applications, result.Fleets, result.Freezes, result.Channels, result.AlertRules)
+
+	json.NewEncoder(w).Encode(result)
+}
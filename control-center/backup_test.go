@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// backupSettings returns settings with the given token and a random key.
+func backupSettings(t *testing.T, token string) *BackupSettings {
+	t.Helper()
+	key := make([]byte, 32)
+	rand.Read(key)
+	t.Setenv("ADMIN_TOKEN", token)
+	t.Setenv("BACKUP_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(key))
+	b, err := BackupSettingsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBackupSecretValues(t *testing.T) {
+	settings := backupSettings(t, "admin")
+	secrets := []SecretBackup{{Secret: Secret{Name: "openai", Version: 2}, Values: map[int]string{1: "sk-old", 2: "sk-new"}}}
+	if err := settings.encryptSecrets(secrets); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(secrets)
+	if strings.Contains(string(b), "sk-") {
+		t.Fatalf("backup contains a secret value in plaintext: %s", b)
+	}
+
+	var restored []SecretBackup
+	json.Unmarshal(b, &restored)
+	if err := settings.decryptSecrets(restored); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored[0].Values; got[1] != "sk-old" || got[2] != "sk-new" {
+		t.Errorf("decrypted values = %v, want the original ones", got)
+	}
+
+	// Values cannot be moved to another version.
+	json.Unmarshal(b, &restored)
+	v := restored[0].EncryptedValues
+	v[1], v[2] = v[2], v[1]
+	if err := settings.decryptSecrets(restored); err == nil {
+		t.Error("decrypting swapped values succeeded")
+	}
+
+	json.Unmarshal(b, &restored)
+	if err := backupSettings(t, "admin").decryptSecrets(restored); err == nil {
+		t.Error("decrypting with another key succeeded")
+	}
+	json.Unmarshal(b, &restored)
+	if err := (&BackupSettings{}).decryptSecrets(restored); err == nil {
+		t.Error("decrypting without a key succeeded")
+	}
+
+	// Without a key, values are left out.
+	secrets = []SecretBackup{{Secret: Secret{Name: "openai", Version: 1}, Values: map[int]string{1: "sk-old"}}}
+	(&BackupSettings{}).encryptSecrets(secrets)
+	if secrets[0].Values != nil || secrets[0].EncryptedValues != nil {
+		t.Errorf("backup without a key has values %v and %v", secrets[0].Values, secrets[0].EncryptedValues)
+	}
+}
+
+func TestBackupAuthorization(t *testing.T) {
+	tests := []struct {
+		name          string
+		token, header string
+		want          int
+	}{
+		{"disabled", "", "Bearer x", http.StatusForbidden},
+		{"no token", "admin", "", http.StatusUnauthorized},
+		{"wrong token", "admin", "Bearer other", http.StatusUnauthorized},
+		{"token", "admin", "Bearer admin", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := backupSettings(t, tt.token)
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/backup", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			if settings.authorize(w, r) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"edge-orchestration/api/types"
+)
+
+// maxBatchSize caps the number of operations in a single batch request.
+const maxBatchSize = types.MaxBatchSize
+
+// validateDeploymentRequest checks a deployment request, evaluates admission
+// policies, and resolves its config and secret references. It returns the HTTP status and
+// error to respond with if the request cannot be created.
+func validateDeploymentRequest(ctx context.Context, engine *PolicyEngine, agents *AgentStore, configs *ConfigStore, secrets *SecretStore, bundles *BundleStore, channels *ChannelStore, req *DeploymentRequest) (int, error) {
+	if err := expandModelServing(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := bundles.Resolve(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := channels.Resolve(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.AgentID == "" || req.ImageURL == "" {
+		return http.StatusBadRequest, errors.New("agent_id and image_url or bundle are required")
+	}
+	if err := validateLabels(req.AgentSelector); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid agent_selector: %w", err)
+	}
+	agent, exists := agents.Get(req.AgentID)
+	if !exists || agent.ArchivedAt != nil {
+		return http.StatusNotFound, fmt.Errorf("agent %s not found", req.AgentID)
+	}
+	if !matchesSelector(agent.Labels, req.AgentSelector) {
+		return http.StatusBadRequest, fmt.Errorf("agent %s does not match agent_selector %s", req.AgentID, formatSelector(req.AgentSelector))
+	}
+	if code, err := evaluatePolicies(ctx, engine, agents, req.DeploymentRequest); err != nil {
+		return code, err
+	}
+
+	if _, err := requestedAmounts(req.Resources); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateVolumes(req.Volumes); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateArtifacts(req.Artifacts, req.Volumes); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateAddons(req.Addons); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := configs.Resolve(req.Configs); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := secrets.Resolve(req.Secrets); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.TTLSeconds < 0 {
+		return http.StatusBadRequest, errors.New("ttl_seconds must not be negative")
+	}
+	if err := validateSchedule(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateUpdatePolicy(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateSandbox(req.Sandbox); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateSLO(req.SLO); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := validateRescheduleAfter(req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// handleBatch serves POST /api/v1/deployments:batch, which creates and
+// deletes many deployments in one request. Operations succeed or fail
+// independently.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	var req BatchRequest
+	// The creates are also kept as sent, to check them against the schema.
+	var raw struct {
+		Create []json.RawMessage `json:"create"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	json.Unmarshal(body, &raw)
+	if n := len(req.Create) + len(req.Delete); n == 0 {
+		http.Error(w, "create or delete is required", http.StatusBadRequest)
+		return
+	} else if n > maxBatchSize {
+		http.Error(w, fmt.Sprintf("A batch may contain at most %d operations, got %d", maxBatchSize, n), http.StatusBadRequest)
+		return
+	}
+
+	resp := BatchResponse{Results: make([]BatchResult, 0, len(req.Create)+len(req.Delete))}
+	for i, create := range req.Create {
+		result := BatchResult{Operation: "create", Index: i}
+		item := DeploymentRequest{DeploymentRequest: create}
+		if fields, _ := deploymentRequestErrors(raw.Create[i]); len(fields) > 0 {
+			result.Status, result.Error, result.Fields = http.StatusBadRequest, invalidDeploymentRequest, fields
+		} else if code, err := validateDeploymentRequest(r.Context(), s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &item); err != nil {
+			result.Status, result.Error = code, err.Error()
+		} else if err := s.freezes.check(r, item.Project, item.AgentID); err != nil {
+			result.Status, result.Error = http.StatusForbidden, err.Error()
+		} else if dep, err := s.deployments.Create(item); err != nil {
+			result.Status, result.Error = http.StatusForbidden, err.Error()
+		} else {
+			result.Status, result.ID, result.Deployment = http.StatusCreated, dep.ID, dep
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	for i, id := range req.Delete {
+		result := BatchResult{Operation: "delete", Index: i, ID: id}
+		if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+			result.Status, result.Error = http.StatusForbidden, err.Error()
+		} else if dep, exists, err := s.deployments.Archive(id, 0, "Deployment deleted in batch"); !exists {
+			result.Status, result.Error = http.StatusNotFound, "Deployment not found"
+		} else if err != nil {
+			result.Status, result.Error = http.StatusConflict, err.Error()
+		} else {
+			s.admission.Cancel(id)
+			result.Status, result.Deployment = http.StatusOK, dep
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	for _, result := range resp.Results {
+		if result.Error == "" {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	logf(r.Context(), "Batch: %d operations succeeded, %d failed", resp.Succeeded, resp.Failed)
+	json.NewEncoder(w).Encode(resp)
+}
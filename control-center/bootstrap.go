@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBootstrapTokenTTL is how long bootstrap tokens are valid unless
+	// requested otherwise.
+	defaultBootstrapTokenTTL = 24 * time.Hour
+	// maxBootstrapTokenTTL caps how long bootstrap tokens are valid.
+	maxBootstrapTokenTTL = 30 * 24 * time.Hour
+	// bootstrapTokenAlphabet is what token IDs and secrets are made of.
+	bootstrapTokenAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// bootstrapTokenPattern matches bootstrap tokens, <id>.<secret>, in the format
+// of Kubernetes bootstrap tokens.
+var bootstrapTokenPattern = regexp.MustCompile(`^([a-z0-9]{6})\.([a-z0-9]{16})$`)
+
+// errInvalidBootstrapToken is returned for tokens that are unknown, expired,
+// or used up; which one is not revealed to the agent.
+var errInvalidBootstrapToken = errors.New("invalid, expired, or used up bootstrap token")
+
+// BootstrapTokenStore keeps the tokens agents register themselves with. Only
+// a hash of each token's secret is kept.
+type BootstrapTokenStore struct {
+	sync.Mutex
+	required bool // Whether new agents must register with a token
+	tokens   map[string]*bootstrapToken
+}
+
+// bootstrapToken is a token and the hash of its secret.
+type bootstrapToken struct {
+	BootstrapToken
+	secretHash [sha256.Size]byte
+}
+
+// NewBootstrapTokenStoreFromEnv creates an empty token store. If
+// AGENT_BOOTSTRAP_REQUIRED is "true", agents can only register with a token.
+// Tokens are issued through the admin endpoints, which need ADMIN_TOKEN.
+func NewBootstrapTokenStoreFromEnv() *BootstrapTokenStore {
+	s := &BootstrapTokenStore{required: os.Getenv("AGENT_BOOTSTRAP_REQUIRED") == "true", tokens: make(map[string]*bootstrapToken)}
+	switch {
+	case s.required && os.Getenv("ADMIN_TOKEN") == "":
+		log.Printf("Warning: agents must register with a bootstrap token, but none can be issued without ADMIN_TOKEN")
+	case s.required:
+		log.Printf("Agents must register with a bootstrap token")
+	}
+	return s
+}
+
+// randomString returns n random characters of bootstrapTokenAlphabet.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		// 256 is not a multiple of 36, which skews the distribution a
+		// little; the secret still has more than 80 bits.
+		b[i] = bootstrapTokenAlphabet[int(b[i])%len(bootstrapTokenAlphabet)]
+	}
+	return string(b), nil
+}
+
+// Create issues a token and returns it with its secret, which is not kept.
+func (s *BootstrapTokenStore) Create(req BootstrapTokenRequest) (BootstrapToken, error) {
+	s.Lock()
+	defer s.Unlock()
+	var id string
+	for id == "" || s.tokens[id] != nil {
+		var err error
+		if id, err = randomString(6); err != nil {
+			return BootstrapToken{}, err
+		}
+	}
+	secret, err := randomString(16)
+	if err != nil {
+		return BootstrapToken{}, err
+	}
+	ttl := defaultBootstrapTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	now := time.Now().UTC()
+	t := &bootstrapToken{
+		BootstrapToken: BootstrapToken{
+			ID:          id,
+			Description: req.Description,
+			Labels:      req.Labels,
+			MaxUses:     req.MaxUses,
+			ExpiresAt:   now.Add(ttl),
+			CreatedAt:   now,
+		},
+		secretHash: sha256.Sum256([]byte(secret)),
+	}
+	s.tokens[id] = t
+	log.Printf("Bootstrap token %s created, valid until %s", id, t.ExpiresAt.Format(time.RFC3339))
+	created := t.BootstrapToken
+	created.Token = id + "." + secret
+	return created, nil
+}
+
+// List returns the tokens, without their secrets, oldest first. Expired
+// tokens are forgotten.
+func (s *BootstrapTokenStore) List() []BootstrapToken {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	list := make([]BootstrapToken, 0, len(s.tokens))
+	for id, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, id)
+			continue
+		}
+		list = append(list, t.BootstrapToken)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete revokes a token. Agents that registered with it stay registered.
+func (s *BootstrapTokenStore) Delete(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.tokens[id]; !exists {
+		return false
+	}
+	delete(s.tokens, id)
+	log.Printf("Bootstrap token %s revoked", id)
+	return true
+}
+
+// Redeem checks a token an agent registers with, counts the use, and returns
+// the token. An empty token is accepted, and nil returned, unless tokens are
+// required.
+func (s *BootstrapTokenStore) Redeem(token string) (*BootstrapToken, error) {
+	if token == "" {
+		if s.required {
+			return nil, errors.New("a bootstrap token is required to register")
+		}
+		return nil, nil
+	}
+	m := bootstrapTokenPattern.FindStringSubmatch(token)
+	if m == nil {
+		return nil, errInvalidBootstrapToken
+	}
+	s.Lock()
+	defer s.Unlock()
+	t, exists := s.tokens[m[1]]
+	hash := sha256.Sum256([]byte(m[2]))
+	if !exists || subtle.ConstantTimeCompare(hash[:], t.secretHash[:]) != 1 ||
+		time.Now().After(t.ExpiresAt) || (t.MaxUses > 0 && t.Uses >= t.MaxUses) {
+		return nil, errInvalidBootstrapToken
+	}
+	t.Uses++
+	redeemed := t.BootstrapToken
+	return &redeemed, nil
+}
+
+// mergeLabels returns labels with overrides set over them, e.g. those of
+// the bootstrap token an agent registered with, which were set by whoever
+// issued it.
+func mergeLabels(labels, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return labels
+	}
+	merged := maps.Clone(labels)
+	if merged == nil {
+		merged = make(map[string]string, len(overrides))
+	}
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// handleCreateBootstrapToken serves POST /api/v1/bootstrap-tokens, which
+// requires ADMIN_TOKEN. The token is only ever returned in this response.
+func (s *Server) handleCreateBootstrapToken(w http.ResponseWriter, r *http.Request) {
+	var req BootstrapTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MaxUses < 0 || req.TTLSeconds < 0 {
+		http.Error(w, "Max uses and TTL must not be negative", http.StatusBadRequest)
+		return
+	}
+	// Compared in seconds, since converting a huge TTL to a duration
+	// overflows.
+	if maxSeconds := int(maxBootstrapTokenTTL / time.Second); req.TTLSeconds > maxSeconds {
+		http.Error(w, fmt.Sprintf("TTL must be at most %d seconds", maxSeconds), http.StatusBadRequest)
+		return
+	}
+	token, err := s.bootstrap.Create(req)
+	if err != nil {
+		http.Error(w, "Could not create bootstrap token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logf(r.Context(), "Bootstrap token %s created", token.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+// handleListBootstrapTokens serves GET /api/v1/bootstrap-tokens, the tokens
+// that have not expired, without their secrets. It requires ADMIN_TOKEN.
+func (s *Server) handleListBootstrapTokens(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.bootstrap.List())
+}
+
+// handleDeleteBootstrapToken serves DELETE /api/v1/bootstrap-tokens/{id},
+// which requires ADMIN_TOKEN.
+func (s *Server) handleDeleteBootstrapToken(w http.ResponseWriter, r *http.Request) {
+	if !s.bootstrap.Delete(r.PathValue("id")) {
+		http.Error(w, "Bootstrap token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
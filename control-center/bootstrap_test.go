@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateBootstrapToken(t *testing.T) {
+	maxTTL := strconv.Itoa(int(maxBootstrapTokenTTL.Seconds()))
+	tests := []struct {
+		name         string
+		header, body string
+		want         int
+	}{
+		{"no token", "", `{}`, http.StatusUnauthorized},
+		{"wrong token", "Bearer other", `{}`, http.StatusUnauthorized},
+		{"default ttl", "Bearer admin", `{}`, http.StatusCreated},
+		{"max ttl", "Bearer admin", `{"ttl_seconds": ` + maxTTL + `}`, http.StatusCreated},
+		{"ttl too long", "Bearer admin", `{"ttl_seconds": ` + maxTTL + `1}`, http.StatusBadRequest},
+		// Converted to a duration, this TTL wraps around to 0.29 seconds.
+		{"ttl overflowing", "Bearer admin", `{"ttl_seconds": 18446744074}`, http.StatusBadRequest},
+		{"negative ttl", "Bearer admin", `{"ttl_seconds": -1}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{bootstrap: NewBootstrapTokenStoreFromEnv(), admin: backupSettings(t, "admin")}
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/bootstrap-tokens", strings.NewReader(tt.body))
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.requireAdmin(s.handleCreateBootstrapToken)(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.want, w.Body)
+			}
+			if created := len(s.bootstrap.List()); (w.Code == http.StatusCreated) != (created == 1) {
+				t.Errorf("%d tokens were created", created)
+			}
+		})
+	}
+}
+
+func TestAgentReconnect(t *testing.T) {
+	svc := &AgentService{agents: NewAgentStore(), deployments: NewDeploymentStore(NewQuotaStore(), NewAgentStore(), NewFreezeStore()), bootstrap: NewBootstrapTokenStoreFromEnv()}
+	first, err := svc.register(StreamRegister{Address: "a:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Credential == "" {
+		t.Fatal("new agent got no credential")
+	}
+
+	tests := []struct {
+		name       string
+		credential string
+		sameID     bool
+	}{
+		{"credential", first.Credential, true},
+		{"no credential", "", false},
+		{"wrong credential", first.Credential + "x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.register(StreamRegister{AgentID: first.AgentID, Credential: tt.credential, Address: "b:1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got.AgentID == first.AgentID) != tt.sameID {
+				t.Errorf("reconnected as %s, same ID %s: %v, want %v", got.AgentID, first.AgentID, !tt.sameID, tt.sameID)
+			}
+			// Only new agents get a credential.
+			if (got.Credential == "") != tt.sameID {
+				t.Errorf("got credential %q", got.Credential)
+			}
+		})
+	}
+	if agent, _ := svc.agents.Get(first.AgentID); agent.Address != "a:1" {
+		t.Errorf("agent's address is %s after reconnects that were refused, want a:1", agent.Address)
+	}
+
+	// Only the agent can open its tunnel.
+	s := &Server{agents: svc.agents}
+	for _, credential := range []string{"", "x", first.Credential} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/agents/"+first.AgentID+"/tunnel", nil)
+		r.SetPathValue("id", first.AgentID)
+		r.Header.Set(agentCredentialHeader, credential)
+		w := httptest.NewRecorder()
+		s.handleAgentTunnel(w, r)
+		if refused := w.Code == http.StatusUnauthorized; refused != (credential != first.Credential) {
+			t.Errorf("tunnel with credential %q answered %d", credential, w.Code)
+		}
+	}
+}
+
+func TestRedeemBootstrapToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxUses  int
+		expired  bool
+		token    func(token string) string // What the agent sends
+		required bool
+		want     []bool // Whether each redemption in turn succeeds
+	}{
+		{"single use", 1, false, nil, false, []bool{true, false}},
+		{"two uses", 2, false, nil, false, []bool{true, true, false}},
+		{"unlimited", 0, false, nil, false, []bool{true, true, true}},
+		{"expired", 0, true, nil, false, []bool{false}},
+		{"wrong secret", 0, false, func(token string) string { return token[:7] + "aaaaaaaaaaaaaaaa" }, false, []bool{false}},
+		{"unknown ID", 0, false, func(token string) string { return "zzzzzz" + token[6:] }, false, []bool{false}},
+		{"malformed", 0, false, func(token string) string { return token + "x" }, false, []bool{false}},
+		{"none", 0, false, func(string) string { return "" }, false, []bool{true, true}},
+		{"none when required", 0, false, func(string) string { return "" }, true, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewBootstrapTokenStoreFromEnv()
+			s.required = tt.required
+			created, err := s.Create(BootstrapTokenRequest{MaxUses: tt.maxUses})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expired {
+				s.tokens[created.ID].ExpiresAt = time.Now().Add(-time.Second)
+			}
+			token := created.Token
+			if tt.token != nil {
+				token = tt.token(token)
+			}
+			for i, want := range tt.want {
+				if _, err := s.Redeem(token); (err == nil) != want {
+					t.Errorf("redemption %d: error %v, want success %v", i+1, err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold is the number of consecutive failures after which a
+	// registry is marked unreachable.
+	breakerThreshold = 5
+	// breakerCooldown is how long an unreachable registry is left alone
+	// before a single probe request is let through.
+	breakerCooldown = 30 * time.Second
+)
+
+// circuitBreaker stops requests to registries that keep failing and lets a
+// single probe through once the cooldown has passed.
+type circuitBreaker struct {
+	mu     sync.Mutex
+	health map[string]*RegistryHealth
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{health: make(map[string]*RegistryHealth)}
+}
+
+// allow reports an error if requests to the registry should not be sent.
+func (b *circuitBreaker) allow(registry string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h, exists := b.health[registry]
+	if !exists {
+		return nil
+	}
+	switch h.State {
+	case "unreachable":
+		if time.Now().Before(h.RetryAt) {
+			return fmt.Errorf("registry %s is unreachable after %d consecutive failures, next probe at %s", registry, h.ConsecutiveFailures, h.RetryAt.Format(time.RFC3339))
+		}
+		h.State = "probing"
+		log.Printf("Probing unreachable registry %s", registry)
+	case "probing":
+		return fmt.Errorf("registry %s is unreachable, a probe is in progress", registry)
+	}
+	return nil
+}
+
+// record updates the registry's state with the outcome of a request.
+func (b *circuitBreaker) record(registry string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h, exists := b.health[registry]
+	if err == nil {
+		if exists && h.State != "healthy" {
+			log.Printf("Registry %s is reachable again", registry)
+		}
+		if exists {
+			h.State = "healthy"
+			h.ConsecutiveFailures = 0
+			h.RetryAt = time.Time{}
+		}
+		return
+	}
+
+	if !exists {
+		h = &RegistryHealth{Registry: registry, State: "healthy"}
+		b.health[registry] = h
+	}
+	now := time.Now().UTC()
+	h.ConsecutiveFailures++
+	h.LastError = err.Error()
+	h.LastFailure = now
+	if h.State == "probing" || h.ConsecutiveFailures >= breakerThreshold {
+		if h.State == "healthy" {
+			log.Printf("Registry %s marked unreachable after %d consecutive failures: %v", registry, h.ConsecutiveFailures, err)
+		}
+		h.State = "unreachable"
+		h.RetryAt = now.Add(breakerCooldown)
+	}
+}
+
+// list returns the state of every registry that has failed at least once.
+func (b *circuitBreaker) list() []RegistryHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]RegistryHealth, 0, len(b.health))
+	for _, h := range b.health {
+		list = append(list, *h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Registry < list[j].Registry })
+	return list
+}
+
+// handleRegistries serves GET /api/v1/registries, the health of the
+// registries the control center resolves image digests from.
+func (s *Server) handleRegistries(w http.ResponseWriter, r *http.Request) {
+	if s.registry == nil {
+		http.Error(w, "Image digest resolution is disabled", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s.registry.breaker.list())
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBundleDir = "bundles"
+	// bundleBuildTimeout bounds how long copying an image into a bundle may take.
+	bundleBuildTimeout = 30 * time.Minute
+)
+
+// BundleStore builds, signs, and keeps bundles in a directory, each as an
+// archive with a JSON metadata file next to it, so that bundles survive
+// restarts of the control center.
+type BundleStore struct {
+	sync.Mutex
+	dir      string
+	key      ed25519.PrivateKey
+	registry *RegistryClient // nil when digest resolution is disabled
+	bundles  map[string]*Bundle
+}
+
+// NewBundleStoreFromEnv creates a bundle store from the BUNDLE_SIGNING_KEY
+// (path to a PEM-encoded PKCS #8 Ed25519 private key) and BUNDLE_DIR
+// ("bundles") environment variables, and loads the bundles already in the
+// directory. It returns nil if no signing key is set, since agents only load
+// signed bundles.
+func NewBundleStoreFromEnv(registry *RegistryClient) (*BundleStore, error) {
+	keyPath := os.Getenv("BUNDLE_SIGNING_KEY")
+	if keyPath == "" {
+		return nil, nil
+	}
+	key, err := loadBundleSigningKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := os.Getenv("BUNDLE_DIR")
+	if dir == "" {
+		dir = defaultBundleDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create BUNDLE_DIR: %w", err)
+	}
+	s := &BundleStore{dir: dir, key: key, registry: registry, bundles: make(map[string]*Bundle)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadBundleSigningKey reads an Ed25519 private key, which can be created with
+// `openssl genpkey -algorithm ed25519`.
+func loadBundleSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read BUNDLE_SIGNING_KEY: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("BUNDLE_SIGNING_KEY is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BUNDLE_SIGNING_KEY: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("BUNDLE_SIGNING_KEY must be an Ed25519 key")
+	}
+	return key, nil
+}
+
+// load reads the metadata of the bundles in the store's directory. Bundles
+// that were still building when the control center stopped are marked failed.
+func (s *BundleStore) load() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("could not read bundle metadata: %w", err)
+		}
+		var b Bundle
+		if err := json.Unmarshal(data, &b); err != nil {
+			return fmt.Errorf("invalid bundle metadata %s: %w", file, err)
+		}
+		if b.Status == "building" {
+			b.Status, b.Reason = "failed", "The control center stopped while the bundle was being built"
+			s.save(&b)
+		}
+		s.bundles[b.ID] = &b
+	}
+	if len(s.bundles) > 0 {
+		log.Printf("Loaded %d bundles from %s", len(s.bundles), s.dir)
+	}
+	return nil
+}
+
+func (s *BundleStore) archivePath(id string) string  { return filepath.Join(s.dir, id+".tar") }
+func (s *BundleStore) metadataPath(id string) string { return filepath.Join(s.dir, id+".json") }
+
+// save writes a bundle's metadata. Errors are logged, since the bundle stays
+// usable until the control center restarts.
+func (s *BundleStore) save(b *Bundle) {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err == nil {
+		tmp := s.metadataPath(b.ID) + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, s.metadataPath(b.ID))
+		}
+	}
+	if err != nil {
+		log.Printf("Could not save metadata of bundle %s: %v", b.ID, err)
+	}
+}
+
+// Create starts building a bundle in the background and returns it while it
+// is building.
+func (s *BundleStore) Create(req BundleRequest) (*Bundle, error) {
+	if req.ImageURL == "" {
+		return nil, errors.New("image_url is required")
+	}
+	if req.Platform != "" {
+		if parts := strings.Split(req.Platform, "/"); len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid platform %q: expected os/arch or os/arch/variant", req.Platform)
+		}
+	}
+	b := &Bundle{
+		ID:        fmt.Sprintf("bundle-%s", uuid.New().String()[:8]),
+		ImageURL:  req.ImageURL,
+		Platform:  req.Platform,
+		Status:    "building",
+		CreatedAt: time.Now().UTC(),
+	}
+	s.Lock()
+	s.bundles[b.ID] = b
+	s.save(b)
+	copied := *b
+	s.Unlock()
+
+	go s.build(b.ID, req)
+	log.Printf("Building bundle %s for image %s", b.ID, req.ImageURL)
+	return &copied, nil
+}
+
+// build copies the image into an archive with skopeo, then checksums and
+// signs it.
+func (s *BundleStore) build(id string, req BundleRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), bundleBuildTimeout)
+	defer cancel()
+
+	ref, digest := req.ImageURL, ""
+	if i := strings.Index(ref, "@"); i >= 0 {
+		digest = ref[i+1:]
+	} else if s.registry != nil {
+		d, err := s.registry.ResolveDigest(ctx, ref)
+		if err != nil {
+			s.fail(id, fmt.Sprintf("Could not resolve image %s: %v", ref, err))
+			return
+		}
+		digest = d
+		ref = pinnedImageRef(ref, digest)
+	}
+
+	tmp := s.archivePath(id) + ".tmp"
+	args := []string{"copy", "--quiet"}
+	if req.Platform != "" {
+		parts := strings.Split(req.Platform, "/")
+		args = append(args, "--override-os", parts[0], "--override-arch", parts[1])
+		if len(parts) == 3 {
+			args = append(args, "--override-variant", parts[2])
+		}
+	}
+	args = append(args, "docker://"+ref, "oci-archive:"+tmp)
+	cmd := exec.CommandContext(ctx, "skopeo", args...)
+	cmd.WaitDelay = commandWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		s.fail(id, fmt.Sprintf("Could not copy image %s: %v: %s", ref, err, lastLine(stderr.String())))
+		return
+	}
+
+	sum, size, err := fileSHA256(tmp)
+	if err == nil {
+		err = os.Rename(tmp, s.archivePath(id))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		s.fail(id, fmt.Sprintf("Could not store the bundle: %v", err))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	b, exists := s.bundles[id]
+	if !exists {
+		// Deleted while building.
+		os.Remove(s.archivePath(id))
+		return
+	}
+	b.ImageURL, b.Digest, b.Size, b.SHA256 = ref, digest, size, sum
+	b.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, b.SigningPayload()))
+	b.Status = "ready"
+	s.save(b)
+	log.Printf("Bundle %s of image %s is ready (%d bytes)", id, ref, size)
+}
+
+// fail records why a bundle could not be built.
+func (s *BundleStore) fail(id, reason string) {
+	s.Lock()
+	defer s.Unlock()
+	if b, exists := s.bundles[id]; exists {
+		b.Status, b.Reason = "failed", reason
+		s.save(b)
+	}
+	log.Printf("Bundle %s failed: %s", id, reason)
+}
+
+// fileSHA256 returns the hex SHA-256 checksum and size of a file.
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// Get returns a copy of the bundle with the given ID.
+func (s *BundleStore) Get(id string) (Bundle, bool) {
+	s.Lock()
+	defer s.Unlock()
+	b, exists := s.bundles[id]
+	if !exists {
+		return Bundle{}, false
+	}
+	return *b, true
+}
+
+// List returns copies of all bundles, oldest first.
+func (s *BundleStore) List() []Bundle {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Bundle, 0, len(s.bundles))
+	for _, b := range s.bundles {
+		list = append(list, *b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete removes a bundle and its archive. It returns false if the bundle
+// does not exist.
+func (s *BundleStore) Delete(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.bundles[id]; !exists {
+		return false
+	}
+	delete(s.bundles, id)
+	os.Remove(s.archivePath(id))
+	os.Remove(s.metadataPath(id))
+	log.Printf("Bundle %s deleted", id)
+	return true
+}
+
+// Resolve points a deployment request at a ready bundle, pinning its image
+// to the bundle's image.
+func (s *BundleStore) Resolve(req *DeploymentRequest) error {
+	if req.Bundle == "" {
+		return nil
+	}
+	if s == nil {
+		return errors.New("bundles are not enabled; set BUNDLE_SIGNING_KEY")
+	}
+	b, exists := s.Get(req.Bundle)
+	if !exists {
+		return fmt.Errorf("bundle %s not found", req.Bundle)
+	}
+	if b.Status != "ready" {
+		return fmt.Errorf("bundle %s is %s", b.ID, b.Status)
+	}
+	if req.ImageURL != "" && req.ImageURL != b.ImageURL {
+		return fmt.Errorf("image_url %s does not match image %s of bundle %s; leave image_url empty", req.ImageURL, b.ImageURL, b.ID)
+	}
+	if req.AutoUpdate {
+		return errors.New("deployments from a bundle cannot auto update")
+	}
+	req.ImageURL = b.ImageURL
+	return nil
+}
+
+// requireBundles answers 404 for bundle routes when bundles are not enabled.
+func (s *Server) requireBundles(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.bundles == nil {
+			http.Error(w, "Bundles are not enabled; set BUNDLE_SIGNING_KEY", http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleListBundles lists bundles, oldest first.
+func (s *Server) handleListBundles(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.bundles.List())
+}
+
+// handleCreateBundle starts building a bundle; it is ready to deploy once its
+// status is "ready".
+func (s *Server) handleCreateBundle(w http.ResponseWriter, r *http.Request) {
+	var req BundleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	b, err := s.bundles.Create(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(b)
+}
+
+// handleGetBundle returns a bundle's metadata.
+func (s *Server) handleGetBundle(w http.ResponseWriter, r *http.Request) {
+	b, exists := s.bundles.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Bundle not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(b)
+}
+
+// handleBundleContent serves a ready bundle's archive. Range requests are
+// supported, so agents on unreliable links can resume a download.
+func (s *Server) handleBundleContent(w http.ResponseWriter, r *http.Request) {
+	b, exists := s.bundles.Get(r.PathValue("id"))
+	if !exists || b.Status != "ready" {
+		http.Error(w, "Bundle not found or not ready", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(s.bundles.archivePath(b.ID))
+	if err != nil {
+		logf(r.Context(), "Could not open archive of bundle %s: %v", b.ID, err)
+		http.Error(w, "Bundle archive is missing", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("ETag", `"`+b.SHA256+`"`)
+	http.ServeContent(w, r, b.ID+".tar", b.CreatedAt, f)
+}
+
+// handleDeleteBundle deletes a bundle that no deployment uses.
+func (s *Server) handleDeleteBundle(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if users := s.deployments.UsingBundle(id); len(users) > 0 {
+		http.Error(w, fmt.Sprintf("Bundle %s is used by deployments %s", id, strings.Join(users, ", ")), http.StatusConflict)
+		return
+	}
+	if !s.bundles.Delete(id) {
+		http.Error(w, "Bundle not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UsingBundle returns the IDs of unarchived deployments that run a bundle.
+func (s *DeploymentStore) UsingBundle(bundleID string) []string {
+	s.Lock()
+	defer s.Unlock()
+	var ids []string
+	for _, dep := range s.deployments {
+		if dep.Bundle == bundleID && dep.ArchivedAt == nil {
+			ids = append(ids, dep.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChannelStore manages the collection of release channels.
+type ChannelStore struct {
+	sync.Mutex
+	channels map[string]*Channel
+}
+
+// NewChannelStore creates a new in-memory channel store.
+func NewChannelStore() *ChannelStore {
+	return &ChannelStore{channels: make(map[string]*Channel)}
+}
+
+// validateChannelName reports whether a name can be used for a channel.
+func validateChannelName(name string) error {
+	if !validConfigKey(name) {
+		return fmt.Errorf("invalid channel name %q: names may only contain letters, digits, dashes, underscores, and dots", name)
+	}
+	return nil
+}
+
+// imageRepository returns the normalized repository of an image reference,
+// which identifies the image across its tags.
+func imageRepository(ref string) string {
+	img := parseImageName(ref)
+	return img.Registry + "/" + img.Repository
+}
+
+// Publish records an image as a channel's latest release of its repository,
+// creating the channel if needed.
+func (s *ChannelStore) Publish(name string, req PublishRequest) (Channel, ChannelRelease) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+	ch, exists := s.channels[name]
+	if !exists {
+		ch = &Channel{Name: name, CreatedAt: now}
+		s.channels[name] = ch
+	}
+	release := ChannelRelease{Repository: imageRepository(req.ImageURL), ImageURL: req.ImageURL, Note: req.Note, PublishedAt: now}
+	releases := []ChannelRelease{release}
+	for _, r := range ch.Releases {
+		if r.Repository != release.Repository {
+			releases = append(releases, r)
+		}
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Repository < releases[j].Repository })
+	ch.Releases = releases
+	ch.UpdatedAt = now
+	log.Printf("Channel %s: published %s", name, req.ImageURL)
+	return *ch, release
+}
+
+// Get returns the channel with the given name.
+func (s *ChannelStore) Get(name string) (Channel, bool) {
+	s.Lock()
+	defer s.Unlock()
+	ch, exists := s.channels[name]
+	if !exists {
+		return Channel{}, false
+	}
+	return *ch, true
+}
+
+// List returns all channels ordered by name.
+func (s *ChannelStore) List() []Channel {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Channel, 0, len(s.channels))
+	for _, ch := range s.channels {
+		list = append(list, *ch)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete removes a channel and its releases. Deployments that follow it keep
+// their images and pick up the next release published under the same name.
+// It returns false if the channel does not exist.
+func (s *ChannelStore) Delete(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.channels[name]; !exists {
+		return false
+	}
+	delete(s.channels, name)
+	log.Printf("Channel %s deleted", name)
+	return true
+}
+
+// restore replaces all channels.
+func (s *ChannelStore) restore(channels []Channel) {
+	s.Lock()
+	defer s.Unlock()
+	s.channels = make(map[string]*Channel, len(channels))
+	for _, ch := range channels {
+		s.channels[ch.Name] = &ch
+	}
+}
+
+// Resolve checks a request's channel subscription and points it at the
+// channel's latest release of its image's repository, if there is one.
+// Channels need not exist yet; deployments follow them from their first
+// release on.
+func (s *ChannelStore) Resolve(req *DeploymentRequest) error {
+	if req.Channel == "" {
+		if req.ChannelStrategy != "" {
+			return errors.New("channel_strategy requires channel")
+		}
+		return nil
+	}
+	if err := validateChannelName(req.Channel); err != nil {
+		return err
+	}
+	switch req.ChannelStrategy {
+	case "":
+		req.ChannelStrategy = "immediate"
+	case "immediate", "manual":
+	case "scheduled":
+		if req.Schedule == "" {
+			return errors.New("channel_strategy scheduled requires schedule")
+		}
+	default:
+		return errors.New("channel_strategy must be immediate, scheduled, or manual")
+	}
+	if req.Bundle != "" {
+		return errors.New("deployments from a bundle cannot follow a channel")
+	}
+	if req.ImageURL == "" {
+		return errors.New("image_url is required to follow a channel; its repository selects the channel's releases")
+	}
+	ch, exists := s.Get(req.Channel)
+	if !exists {
+		return nil
+	}
+	repository := imageRepository(req.ImageURL)
+	for _, r := range ch.Releases {
+		if r.Repository == repository {
+			req.ImageURL = r.ImageURL
+		}
+	}
+	return nil
+}
+
+// PublishRelease rolls a channel release out to the active deployments that
+// follow the channel with an image of the release's repository, according to
+// each one's strategy. It returns the IDs of the deployments it redeployed
+// and of those the release waits for.
+func (s *DeploymentStore) PublishRelease(channel string, release ChannelRelease) (updated, available []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	updated, available = []string{}, []string{}
+	for _, dep := range s.deployments {
+		if dep.Channel != channel || retired(dep.Status) || dep.ArchivedAt != nil || imageRepository(dep.ImageURL) != release.Repository {
+			continue
+		}
+		if dep.ImageURL == release.ImageURL {
+			dep.AvailableImage = ""
+			continue
+		}
+		dep.AvailableImage = release.ImageURL
+		var wait string
+		switch dep.ChannelStrategy {
+		case "scheduled":
+			wait = "it is deployed on the next scheduled run"
+		case "manual":
+			wait = "set the deployment's image to deploy it"
+		default:
+			if f := s.frozen(dep.Project, dep.AgentID); f != nil {
+				wait = fmt.Sprintf("it is deployed once freeze %s ends at %s", f.ID, f.End.Format(time.RFC3339))
+				break
+			}
+			s.applyRelease(dep)
+			updated = append(updated, dep.ID)
+			continue
+		}
+		s.recordEvent(dep.ID, "release_available", fmt.Sprintf("Channel %s released %s; %s", channel, release.ImageURL, wait))
+		available = append(available, dep.ID)
+	}
+	sort.Strings(updated)
+	sort.Strings(available)
+	return updated, available
+}
+
+// applyRelease moves a deployment to the channel release available to it
+// and redeploys it as a new revision. Queued, deferred, and paused
+// deployments deploy the release once they start. The caller must hold the
+// lock and check for freezes.
+func (s *DeploymentStore) applyRelease(dep *Deployment) {
+	dep.ImageURL = dep.AvailableImage
+	dep.ImageDigest = ""
+	dep.AvailableImage = ""
+	switch dep.Status {
+	case "queued", "deferred", "paused":
+		s.recordEvent(dep.ID, "updated", fmt.Sprintf("Channel %s released %s; it is deployed once the deployment starts", dep.Channel, dep.ImageURL))
+		return
+	}
+	dep.Revision++
+	dep.Reason = ""
+	dep.Scan = nil
+	s.recordEvent(dep.ID, "updated", fmt.Sprintf("Channel %s released %s, redeploying as revision %d", dep.Channel, dep.ImageURL, dep.Revision))
+	log.Printf("Deployment %s redeploying channel %s release %s as revision %d", dep.ID, dep.Channel, dep.ImageURL, dep.Revision)
+	s.start(dep)
+}
+
+// handleListChannels lists release channels.
+func (s *Server) handleListChannels(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.channels.List())
+}
+
+// handleGetChannel returns a release channel and its latest releases.
+func (s *Server) handleGetChannel(w http.ResponseWriter, r *http.Request) {
+	ch, exists := s.channels.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(ch)
+}
+
+// handlePublishRelease publishes an image to a release channel, creating the
+// channel if needed, and rolls it out to the deployments that follow it.
+func (s *Server) handlePublishRelease(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := validateChannelName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req PublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.ImageURL == "" {
+		http.Error(w, "image_url is required", http.StatusBadRequest)
+		return
+	}
+	ch, release := s.channels.Publish(name, req)
+	result := PublishResult{Channel: ch, Release: release}
+	result.Updated, result.Available = s.deployments.PublishRelease(name, release)
+	logf(r.Context(), "Channel %s released %s: %d deployments redeployed, %d waiting", name, req.ImageURL, len(result.Updated), len(result.Available))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleDeleteChannel deletes a release channel.
+func (s *Server) handleDeleteChannel(w http.ResponseWriter, r *http.Request) {
+	if !s.channels.Delete(r.PathValue("name")) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response body worth compressing; smaller
+// ones are sent as they are.
+const minCompressSize = 1024
+
+// gzipWriters holds gzip writers for reuse across responses.
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// withCompression gzips responses for callers that accept it, when they are
+// of a compressible type and large enough to be worth it. Bodies are
+// compressed as they are written rather than buffered, so that large lists
+// and manifests stream. WebSocket upgrades, range requests, and bodies the
+// handler encoded itself are passed through.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if coding = strings.TrimSpace(coding); coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressible reports whether a response of the given content type is
+// worth compressing. Event streams are left alone so that proxies in between
+// do not hold back events.
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/yaml", "application/x-yaml", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// to compress it: once minCompressSize bytes were written, the handler
+// flushed, or it returned.
+type compressWriter struct {
+	http.ResponseWriter
+	status  int    // Status the handler set, if it did
+	buf     []byte // Body written before deciding
+	decided bool
+	gz      *gzip.Writer // Set if compressing
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		// Informational responses such as 103 Early Hints go out right away.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < minCompressSize {
+			return len(p), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends what was written so far, compressing it if the response is
+// compressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close finishes the response once the handler has returned.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz == nil {
+		return nil
+	}
+	err := w.gz.Close()
+	w.gz.Reset(nil)
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+	return err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide starts the response, compressed if enough of it was held back and
+// its headers allow.
+func (w *compressWriter) decide() error {
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	return w.start(len(w.buf) >= minCompressSize && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && compressible(h.Get("Content-Type")))
+}
+
+// start writes the status and headers, and the body held back so far.
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		// The compressed body is a different representation, so its
+		// entity tag is only weakly equal to the uncompressed one's.
+		if tag := h.Get("ETag"); tag != "" && !strings.HasPrefix(tag, "W/") {
+			h.Set("ETag", "W/"+tag)
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if !compress {
+		if len(buf) == 0 {
+			return nil
+		}
+		_, err := w.ResponseWriter.Write(buf)
+		return err
+	}
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	_, err := w.gz.Write(buf)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressionETag(t *testing.T) {
+	const tag = `"abc-1"`
+	large := `[` + strings.Repeat(`{"id":"dep-1"},`, 200) + `{}]`
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		body           string
+		want           int
+		wantGzip       bool
+		wantETag       string
+	}{
+		{"large", "gzip", "", large, http.StatusOK, true, "W/" + tag},
+		{"small", "gzip", "", `[]`, http.StatusOK, false, tag},
+		{"gzip not accepted", "", "", large, http.StatusOK, false, tag},
+		{"gzip refused", "gzip;q=0", "", large, http.StatusOK, false, tag},
+		{"weak tag sent back", "gzip", "W/" + tag, large, http.StatusNotModified, false, tag},
+		{"strong tag sent back", "", tag, large, http.StatusNotModified, false, tag},
+		{"other tag sent back", "gzip", `W/"abc-0"`, large, http.StatusOK, true, "W/" + tag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if notModified(w, r, tag) {
+					return
+				}
+				io.WriteString(w, tt.body)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/agents", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", got, tt.wantETag)
+			}
+			gzipped := w.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tt.wantGzip {
+				t.Fatalf("gzipped: %v, want %v", gzipped, tt.wantGzip)
+			}
+			body := w.Body.String()
+			if gzipped {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+			}
+			if tt.want == http.StatusNotModified {
+				if body != "" {
+					t.Errorf("304 has a body of %d bytes", len(body))
+				}
+			} else if body != tt.body {
+				t.Errorf("body differs from the one written: %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxConfigSize caps the size of a config accepted by the API.
+const maxConfigSize = 1 << 20
+
+// ConfigStore manages the collection of configs and keeps every version of
+// them, so that deployments can pin one and each revision can be reproduced.
+type ConfigStore struct {
+	sync.Mutex
+	configs map[string]*Config
+	history map[string]map[int]Config // Every version of every config, by name
+}
+
+// NewConfigStore creates a new in-memory config store.
+func NewConfigStore() *ConfigStore {
+	return &ConfigStore{configs: make(map[string]*Config), history: make(map[string]map[int]Config)}
+}
+
+// Put creates or replaces a config. It reports whether the data changed.
+func (s *ConfigStore) Put(name string, data map[string]string) (Config, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+	cfg, exists := s.configs[name]
+	if !exists {
+		cfg = &Config{Name: name, CreatedAt: now}
+		s.configs[name] = cfg
+		s.history[name] = make(map[int]Config)
+	} else if equalData(cfg.Data, data) {
+		return *cfg, false
+	}
+	cfg.Data = data
+	cfg.Version++
+	cfg.UpdatedAt = now
+	s.history[name][cfg.Version] = *cfg
+	log.Printf("Config %s stored as version %d", name, cfg.Version)
+	return *cfg, true
+}
+
+// Get returns the config with the given name.
+func (s *ConfigStore) Get(name string) (Config, bool) {
+	s.Lock()
+	defer s.Unlock()
+	cfg, exists := s.configs[name]
+	if !exists {
+		return Config{}, false
+	}
+	return *cfg, true
+}
+
+// Version returns a version of the config with the given name.
+func (s *ConfigStore) Version(name string, version int) (Config, bool) {
+	s.Lock()
+	defer s.Unlock()
+	cfg, exists := s.history[name][version]
+	return cfg, exists
+}
+
+// Versions returns every version of the config with the given name, oldest
+// first. It reports false if the config does not exist.
+func (s *ConfigStore) Versions(name string) ([]Config, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.configs[name]; !exists {
+		return nil, false
+	}
+	list := make([]Config, 0, len(s.history[name]))
+	for _, cfg := range s.history[name] {
+		list = append(list, cfg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, true
+}
+
+// List returns all configs ordered by name.
+func (s *ConfigStore) List() []Config {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Config, 0, len(s.configs))
+	for _, cfg := range s.configs {
+		list = append(list, *cfg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete removes a config. It reports false if the config did not exist.
+func (s *ConfigStore) Delete(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.configs[name]; !exists {
+		return false
+	}
+	delete(s.configs, name)
+	delete(s.history, name)
+	log.Printf("Config %s deleted", name)
+	return true
+}
+
+// Resolve checks that every referenced config exists and is bound to a mount
+// path or the environment, and records the config versions in refs: the
+// pinned version, which must exist, or else the latest.
+func (s *ConfigStore) Resolve(refs []ConfigRef) error {
+	seen := make(map[string]bool, len(refs))
+	for i, ref := range refs {
+		if ref.Name == "" {
+			return fmt.Errorf("every config reference needs a name")
+		}
+		if seen[ref.Name] {
+			return fmt.Errorf("config %s is referenced more than once", ref.Name)
+		}
+		seen[ref.Name] = true
+		if ref.MountPath == "" && !ref.Env {
+			return fmt.Errorf("config %s: mount_path or env is required", ref.Name)
+		}
+		if ref.MountPath != "" && !path.IsAbs(ref.MountPath) {
+			return fmt.Errorf("config %s: mount_path must be an absolute path", ref.Name)
+		}
+		if ref.Pin < 0 {
+			return fmt.Errorf("config %s: pin must be a positive version", ref.Name)
+		}
+		cfg, exists := s.Get(ref.Name)
+		if !exists {
+			return fmt.Errorf("config %s not found", ref.Name)
+		}
+		if ref.Pin > 0 {
+			if _, exists := s.Version(ref.Name, ref.Pin); !exists {
+				return fmt.Errorf("config %s has no version %d; the latest is %d", ref.Name, ref.Pin, cfg.Version)
+			}
+			refs[i].Version = ref.Pin
+			continue
+		}
+		refs[i].Version = cfg.Version
+	}
+	return nil
+}
+
+func equalData(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, exists := b[k]; !exists || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// validConfigKey reports whether a key can be used as a file name. Keys that
+// are not valid environment variable names are skipped when injecting.
+func validConfigKey(key string) bool {
+	if key == "" || key == "." || key == ".." {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '_' || c == '-' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// RolloutConfig starts rolling a config version out to every active
+// deployment that references the config without pinning a version. With a
+// batch size of 0 they are all redeployed at once; otherwise batch of them
+// are, and RunSchedules redeploys the next ones once those are running. A
+// rollout replaces any earlier one of the same config.
+func (s *DeploymentStore) RolloutConfig(name string, version, batch int) ConfigRollout {
+	s.Lock()
+	defer s.Unlock()
+	return s.startRefRollout("config", name, version, batch).configRollout()
+}
+
+// ConfigRollout returns the latest rollout of a config.
+func (s *DeploymentStore) ConfigRollout(name string) (ConfigRollout, bool) {
+	s.Lock()
+	defer s.Unlock()
+	rollout, exists := s.refRollouts["config/"+name]
+	if !exists {
+		return ConfigRollout{}, false
+	}
+	return rollout.configRollout(), true
+}
+
+// ConfigUsers returns the IDs of active deployments that reference the config.
+func (s *DeploymentStore) ConfigUsers(name string) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	var ids []string
+	for _, dep := range s.deployments {
+		if retired(dep.Status) {
+			continue
+		}
+		for _, ref := range dep.Configs {
+			if ref.Name == name {
+				ids = append(ids, dep.ID)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// handleListConfigs serves GET /api/v1/configs.
+func (s *Server) handleListConfigs(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.configs.List())
+}
+
+// handleGetConfig serves GET /api/v1/configs/{name}, the latest version of a
+// config.
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, exists := s.configs.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Config not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// handlePutConfig serves PUT /api/v1/configs/{name}, which stores a config's
+// data as its next version and redeploys the deployments that use it.
+func (s *Server) handlePutConfig(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req struct {
+		Data      map[string]string `json:"data"`
+		BatchSize int               `json:"batch_size"` // Deployments redeployed at a time; 0 redeploys all at once
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConfigSize)).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	for key := range req.Data {
+		if !validConfigKey(key) {
+			http.Error(w, fmt.Sprintf("Invalid key %q: keys may only contain letters, digits, dashes, underscores, and dots", key), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.BatchSize < 0 {
+		http.Error(w, "batch_size must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Data == nil {
+		req.Data = map[string]string{}
+	}
+	// Changing a config redeploys the deployments that use it.
+	for _, id := range s.deployments.ConfigUsers(name) {
+		if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	cfg, changed := s.configs.Put(name, req.Data)
+	if changed && cfg.Version > 1 {
+		s.deployments.RolloutConfig(name, cfg.Version, req.BatchSize)
+	}
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// handleDeleteConfig serves DELETE /api/v1/configs/{name}, which deletes a
+// config that no deployment uses.
+func (s *Server) handleDeleteConfig(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if users := s.deployments.ConfigUsers(name); len(users) > 0 {
+		http.Error(w, fmt.Sprintf("Config %s is used by deployments %s", name, strings.Join(users, ", ")), http.StatusConflict)
+		return
+	}
+	if !s.configs.Delete(name) {
+		http.Error(w, "Config not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleConfigVersions serves GET /api/v1/configs/{name}/versions, every
+// version of a config, oldest first.
+func (s *Server) handleConfigVersions(w http.ResponseWriter, r *http.Request) {
+	versions, exists := s.configs.Versions(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Config not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(versions)
+}
+
+// handleConfigVersion serves GET /api/v1/configs/{name}/versions/{version},
+// one version of a config.
+func (s *Server) handleConfigVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version <= 0 {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	cfg, exists := s.configs.Version(r.PathValue("name"), version)
+	if !exists {
+		http.Error(w, "Config version not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// handleConfigRollout serves GET /api/v1/configs/{name}/rollout, the
+// progress of the latest rollout of a config.
+func (s *Server) handleConfigRollout(w http.ResponseWriter, r *http.Request) {
+	rollout, exists := s.deployments.ConfigRollout(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Config has not been rolled out", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rollout)
+}
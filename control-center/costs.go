@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// hoursPerMonth is the average number of hours in a month, used to project
+// what running deployments cost per month.
+const hoursPerMonth = 730
+
+// workloadStops lists the deployment events after which its workload no
+// longer runs until the agent reports it running again.
+var workloadStops = map[string]bool{
+	"failed":     true,
+	"paused":     true,
+	"cancelled":  true,
+	"superseded": true,
+	"removed":    true,
+	"expired":    true,
+	"deleted":    true,
+	"succeeded":  true,
+	"archived":   true,
+}
+
+// Costs are the price hints deployment costs are estimated with.
+type Costs struct {
+	Currency string
+	Prices   Prices // Used for agents without prices of their own
+}
+
+// CostsFromEnv reads the default price hints from the COST_CPU_HOUR,
+// COST_MEMORY_GB_HOUR, and COST_GPU_HOUR (0) environment variables, in
+// COST_CURRENCY (USD).
+func CostsFromEnv() (Costs, error) {
+	c := Costs{Currency: "USD"}
+	if v := os.Getenv("COST_CURRENCY"); v != "" {
+		c.Currency = v
+	}
+	for _, hint := range []struct {
+		env   string
+		price *float64
+	}{
+		{"COST_CPU_HOUR", &c.Prices.CPU},
+		{"COST_MEMORY_GB_HOUR", &c.Prices.Memory},
+		{"COST_GPU_HOUR", &c.Prices.GPU},
+	} {
+		v := os.Getenv(hint.env)
+		if v == "" {
+			continue
+		}
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || !validPrice(price) {
+			return c, fmt.Errorf("invalid %s %q: must be a non-negative price per hour", hint.env, v)
+		}
+		*hint.price = price
+	}
+	return c, nil
+}
+
+// validPrice reports whether a price hint is a non-negative number.
+func validPrice(p float64) bool {
+	return p >= 0 && !math.IsInf(p, 0)
+}
+
+// hourlyRate returns what a deployment requesting the given resources costs
+// per hour at the given prices. Memory is priced per GiB.
+func hourlyRate(r *Resources, p Prices) float64 {
+	a, err := requestedAmounts(r)
+	if err != nil {
+		return 0
+	}
+	return float64(a.cpuMillis)/1000*p.CPU + float64(a.memoryBytes)/(1<<30)*p.Memory + float64(a.gpu)*p.GPU
+}
+
+// runningTime returns how long a deployment's workload ran according to its
+// event timeline: from each time the agent reported it running until it
+// stopped, or until now if it still runs. Redeploys do not stop the clock,
+// since the previous revision keeps running until it is replaced.
+func runningTime(events []DeploymentEvent, now time.Time) time.Duration {
+	var total time.Duration
+	var since time.Time
+	for _, ev := range events {
+		switch {
+		case ev.Type == "running" && since.IsZero():
+			since = ev.Time
+		case workloadStops[ev.Type] && !since.IsZero():
+			total += ev.Time.Sub(since)
+			since = time.Time{}
+		}
+	}
+	if !since.IsZero() {
+		total += now.Sub(since)
+	}
+	return total
+}
+
+// SetPrices sets the price hints of an agent, or makes it use the defaults
+// if p is nil. It returns false if the agent does not exist or was deleted.
+func (s *AgentStore) SetPrices(id string, p *Prices) (*Agent, bool) {
+	s.Lock()
+	defer s.Unlock()
+	agent, exists := s.agents[id]
+	if !exists || agent.ArchivedAt != nil {
+		return nil, false
+	}
+	agent.Prices = p
+	s.revision++
+	return cloneAgent(agent), true
+}
+
+// prices returns the agent's price hints, or nil if it uses the defaults.
+func (s *AgentStore) prices(id string) *Prices {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		return agent.Prices
+	}
+	return nil
+}
+
+// Costs returns the estimated costs of the deployments that ran, including
+// deleted ones that were not garbage collected yet, optionally only those
+// of a project or an agent. Each deployment is priced at its agent's price
+// hints, or at the defaults.
+func (s *DeploymentStore) Costs(project, agentID string, defaults Prices, now time.Time) []DeploymentCost {
+	s.Lock()
+	defer s.Unlock()
+
+	costs := []DeploymentCost{}
+	for _, dep := range s.deployments {
+		if project != "" && dep.Project != project || agentID != "" && dep.AgentID != agentID {
+			continue
+		}
+		running := runningTime(s.events[dep.ID], now)
+		if running == 0 {
+			continue
+		}
+		prices := defaults
+		if s.agents != nil {
+			if p := s.agents.prices(dep.AgentID); p != nil {
+				prices = *p
+			}
+		}
+		rate := hourlyRate(dep.Resources, prices)
+		c := DeploymentCost{
+			ID:           dep.ID,
+			AgentID:      dep.AgentID,
+			Project:      dep.Project,
+			Status:       dep.Status,
+			HourlyRate:   rate,
+			RunningHours: running.Hours(),
+			Accumulated:  rate * running.Hours(),
+		}
+		if dep.Status == "running" {
+			c.EstimatedMonthly = rate * hoursPerMonth
+		}
+		costs = append(costs, c)
+	}
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Accumulated != costs[j].Accumulated {
+			return costs[i].Accumulated > costs[j].Accumulated
+		}
+		return costs[i].ID < costs[j].ID
+	})
+	return costs
+}
+
+// costReport sums deployment costs by project and in total.
+func costReport(currency string, costs []DeploymentCost, now time.Time) CostReport {
+	report := CostReport{Currency: currency, GeneratedAt: now, Deployments: costs, Projects: []ProjectCost{}}
+	byProject := make(map[string]*ProjectCost)
+	for _, c := range costs {
+		p, exists := byProject[c.Project]
+		if !exists {
+			p = &ProjectCost{Project: c.Project}
+			byProject[c.Project] = p
+		}
+		p.Deployments++
+		p.Accumulated += c.Accumulated
+		p.EstimatedMonthly += c.EstimatedMonthly
+		if c.Status == "running" {
+			p.HourlyRate += c.HourlyRate
+		}
+		report.Accumulated += c.Accumulated
+		report.EstimatedMonthly += c.EstimatedMonthly
+		if c.Status == "running" {
+			report.HourlyRate += c.HourlyRate
+		}
+	}
+	for _, p := range byProject {
+		report.Projects = append(report.Projects, *p)
+	}
+	sort.Slice(report.Projects, func(i, j int) bool {
+		if report.Projects[i].Accumulated != report.Projects[j].Accumulated {
+			return report.Projects[i].Accumulated > report.Projects[j].Accumulated
+		}
+		return report.Projects[i].Project < report.Projects[j].Project
+	})
+	return report
+}
+
+// handleCostReport serves GET /api/v1/reports/costs, which estimates what
+// deployments cost, optionally only those of the project or agent_id given
+// as query parameters.
+func (s *Server) handleCostReport(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	q := r.URL.Query()
+	costs := s.deployments.Costs(q.Get("project"), q.Get("agent_id"), s.costs.Prices, now)
+	json.NewEncoder(w).Encode(costReport(s.costs.Currency, costs, now))
+}
+
+// handleSetPrices serves PUT /api/v1/agents/{id}/prices, which sets the
+// price hints an agent's deployments are estimated with.
+func (s *Server) handleSetPrices(w http.ResponseWriter, r *http.Request) {
+	var p Prices
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if !validPrice(p.CPU) || !validPrice(p.Memory) || !validPrice(p.GPU) {
+		http.Error(w, "Prices must not be negative", http.StatusBadRequest)
+		return
+	}
+	agent, ok := s.agents.SetPrices(r.PathValue("id"), &p)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	logf(r.Context(), "Agent %s now has prices cpu=%g memory=%g gpu=%g per hour", agent.ID, p.CPU, p.Memory, p.GPU)
+	json.NewEncoder(w).Encode(agent)
+}
+
+// handleClearPrices serves DELETE /api/v1/agents/{id}/prices, which makes an
+// agent's deployments use the default price hints again.
+func (s *Server) handleClearPrices(w http.ResponseWriter, r *http.Request) {
+	agent, ok := s.agents.SetPrices(r.PathValue("id"), nil)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	logf(r.Context(), "Agent %s now uses the default prices", agent.ID)
+	json.NewEncoder(w).Encode(agent)
+}
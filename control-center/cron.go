@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the shorthands accepted in place of a cron expression.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSchedule is a parsed five-field cron expression. Each field is a bit
+// set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // Whether the day fields were "*", so that only the other restricts days
+}
+
+// parseCron parses a cron expression of the form "minute hour day-of-month
+// month day-of-week", or one of the macros such as "@daily". Fields accept
+// "*", values, ranges ("1-5"), steps ("*/15", "0-30/10"), and lists of them
+// ("1,15"). Day of week runs from 0 (Sunday) to 6; 7 is Sunday as well.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+	c := &cronSchedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	for _, f := range []struct {
+		name     string
+		bits     *uint64
+		min, max int
+	}{
+		{"minute", &c.minute, 0, 59},
+		{"hour", &c.hour, 0, 23},
+		{"day of month", &c.dom, 1, 31},
+		{"month", &c.month, 1, 12},
+		{"day of week", &c.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[0], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		*f.bits = bits
+		fields = fields[1:]
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parseCronField returns the set of values between min and max one field of
+// a cron expression matches.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if span != "*" {
+			from, to, isRange := strings.Cut(span, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			switch {
+			case isRange:
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first time after t the schedule matches, in t's location.
+// It returns false if the schedule matches no time in the next five years,
+// e.g. for February 30th.
+func (c *cronSchedule) next(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dayMatches reports whether the schedule runs on t's day. As in cron, a day
+// matches either day field when both are restricted.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 1, 12, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+		{"5", 0, 59, []int{5}},
+		{"1-5", 0, 6, []int{1, 2, 3, 4, 5}},
+		{"*/20", 0, 59, []int{0, 20, 40}},
+		{"0-30/10", 0, 59, []int{0, 10, 20, 30}},
+		{"10/20", 0, 59, []int{10, 30, 50}},
+		{"1,15", 1, 31, []int{1, 15}},
+		{"1-3,10-20/5,30", 1, 31, []int{1, 2, 3, 10, 15, 20, 30}},
+	}
+	for _, tt := range tests {
+		got, err := parseCronField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("parseCronField(%q) failed: %v", tt.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.want {
+			want |= 1 << uint(v)
+		}
+		if got != want {
+			t.Errorf("parseCronField(%q) = %b, want %b", tt.field, got, want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@every",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// 2024-01-01 is a Monday.
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string // Empty if the schedule never matches
+	}{
+		{"every minute", "* * * * *", "2024-01-01 10:07:30", "2024-01-01 10:08:00"},
+		{"strictly after", "0 10 * * *", "2024-01-01 10:00:00", "2024-01-02 10:00:00"},
+		{"step", "*/15 * * * *", "2024-01-01 10:07:00", "2024-01-01 10:15:00"},
+		{"step wraps to next hour", "*/15 * * * *", "2024-01-01 10:50:00", "2024-01-01 11:00:00"},
+		{"range with step", "0 9-17/4 * * *", "2024-01-01 10:00:00", "2024-01-01 13:00:00"},
+		{"list", "0 0 1,15 * *", "2024-01-02 00:00:00", "2024-01-15 00:00:00"},
+		{"macro", "@hourly", "2024-01-01 10:59:30", "2024-01-01 11:00:00"},
+		{"day of month only", "0 0 13 * *", "2024-01-01 00:00:00", "2024-01-13 00:00:00"},
+		{"day of week only", "0 0 * * 1-5", "2024-01-05 12:00:00", "2024-01-08 00:00:00"},
+		{"sunday as 7", "0 12 * * 7", "2024-01-01 00:00:00", "2024-01-07 12:00:00"},
+		{"day of month or week, week first", "0 0 13 * 5", "2024-01-06 00:00:00", "2024-01-12 00:00:00"},
+		{"day of month or week, month first", "0 0 13 * 5", "2024-01-12 00:00:00", "2024-01-13 00:00:00"},
+		{"month rollover", "30 2 * * *", "2024-01-31 03:00:00", "2024-02-01 02:30:00"},
+		{"skips months without the day", "0 0 31 * *", "2024-01-31 01:00:00", "2024-03-31 00:00:00"},
+		{"year rollover", "0 0 1 1 *", "2024-06-01 00:00:00", "2025-01-01 00:00:00"},
+		{"restricted month", "0 0 1 3-4 *", "2024-04-02 00:00:00", "2025-03-01 00:00:00"},
+		{"leap day", "0 0 29 2 *", "2025-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"never", "0 0 30 2 *", "2024-01-01 00:00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q) failed: %v", tt.expr, err)
+			}
+			got, ok := c.next(at(tt.from))
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("next(%s) = %s, want no match", tt.from, got)
+				}
+				return
+			}
+			if !ok || !got.Equal(at(tt.want)) {
+				t.Errorf("next(%s) = %s, %v, want %s", tt.from, got, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+const (
+	// sessionCookie is the name of the cookie that carries a session ID.
+	sessionCookie = "cc_session"
+	// csrfHeader carries a session's CSRF token on state-changing requests.
+	csrfHeader = "X-CSRF-Token"
+	// defaultSessionTTL is how long a dashboard session lasts.
+	defaultSessionTTL = 12 * time.Hour
+)
+
+// Session is a browser session of the web dashboard.
+type Session struct {
+	id        string
+	CSRFToken string    `json:"csrf_token"` // Must be sent in X-CSRF-Token on state-changing requests
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Dashboard lets a browser-based dashboard on another origin use the API. It
+// answers CORS requests from allowed origins, rejects state-changing requests
+// from other origins, and, if a dashboard password is set, requires browsers
+// to log in to a cookie-based session protected by a CSRF token. Clients that
+// are not browsers, such as cctl and agents, send no Origin header or session
+// cookie and are not affected.
+type Dashboard struct {
+	origins      map[string]bool // Allowed origins, e.g. "https://dashboard.example.com"
+	anyOrigin    bool            // CORS_ALLOWED_ORIGINS is "*"; only allowed without sessions
+	password     string          // Enables sessions when set
+	ttl          time.Duration
+	secureCookie bool
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewDashboardFromEnv configures dashboard support from the
+// CORS_ALLOWED_ORIGINS (comma-separated origins or "*"), DASHBOARD_PASSWORD,
+// SESSION_TTL (12h), and SESSION_COOKIE_SECURE (true) environment variables.
+func NewDashboardFromEnv() (*Dashboard, error) {
+	d := &Dashboard{
+		origins:      make(map[string]bool),
+		password:     os.Getenv("DASHBOARD_PASSWORD"),
+		ttl:          defaultSessionTTL,
+		secureCookie: os.Getenv("SESSION_COOKIE_SECURE") != "false",
+		sessions:     make(map[string]*Session),
+	}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		switch {
+		case origin == "":
+		case origin == "*":
+			d.anyOrigin = true
+		default:
+			u, err := url.Parse(origin)
+			if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+				return nil, fmt.Errorf("invalid origin %q in CORS_ALLOWED_ORIGINS: expected scheme://host[:port]", origin)
+			}
+			d.origins[origin] = true
+		}
+	}
+	if d.anyOrigin && d.password != "" {
+		return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS=* cannot be combined with DASHBOARD_PASSWORD; list the dashboard's origins instead")
+	}
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid SESSION_TTL %q: must be a positive duration", v)
+		}
+		d.ttl = ttl
+	}
+	if len(d.origins) > 0 || d.anyOrigin {
+		log.Printf("CORS enabled for origins %s", os.Getenv("CORS_ALLOWED_ORIGINS"))
+	}
+	if d.password != "" {
+		log.Printf("Dashboard sessions enabled, lasting %s", d.ttl)
+	}
+	return d, nil
+}
+
+// Wrap applies CORS, origin checks, sessions, and CSRF protection to a handler.
+// A session is only required of requests with an Origin header, which browsers
+// send cross-origin and on same-origin requests that change state; other
+// requests are served without one, so sessions do not authenticate clients.
+func (d *Dashboard) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin == "" || d.sameOrigin(r, origin) || d.anyOrigin || d.origins[origin]
+		if origin != "" && allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Deprecation, Sunset, Link, "+types.APIVersionHeader+", "+requestIDHeader)
+			w.Header().Add("Vary", "Origin")
+			if !d.anyOrigin {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, "+types.AcceptVersionHeader+", "+csrfHeader+", "+requestIDHeader+", "+types.BreakGlassHeader)
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		// Browsers send simple cross-origin POSTs without a preflight, so
+		// state-changing requests from unknown origins must be refused here.
+		if !allowed && !safeMethod(r.Method) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		// Logging in and out is handled by handleSession.
+		if r.URL.Path == "/api/v1/session" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			session, ok := d.session(cookie.Value)
+			if !ok {
+				d.clearCookie(w)
+				http.Error(w, "Session expired", http.StatusUnauthorized)
+				return
+			}
+			if !safeMethod(r.Method) && subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(session.CSRFToken)) != 1 {
+				http.Error(w, "Missing or invalid "+csrfHeader+" header", http.StatusForbidden)
+				return
+			}
+		} else if d.password != "" && origin != "" {
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether the request comes from a page served by the
+// control center itself.
+func (d *Dashboard) sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// session returns the unexpired session with the given ID.
+func (d *Dashboard) session(id string) (*Session, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session, exists := d.sessions[id]
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(session.ExpiresAt) {
+		delete(d.sessions, id)
+		return nil, false
+	}
+	return session, true
+}
+
+// login starts a new session, dropping expired ones.
+func (d *Dashboard) login() (*Session, error) {
+	id, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &Session{id: id, CSRFToken: csrf, ExpiresAt: now.Add(d.ttl).UTC()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, s := range d.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(d.sessions, id)
+		}
+	}
+	d.sessions[session.id] = session
+	return session, nil
+}
+
+func (d *Dashboard) logout(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sessions, id)
+}
+
+func (d *Dashboard) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: d.secureCookie, SameSite: http.SameSiteLaxMode})
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requireSessions answers 404 for the session endpoints when the dashboard
+// has no password.
+func (s *Server) requireSessions(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.dashboard.password == "" {
+			http.Error(w, "Dashboard sessions are not enabled", http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleLogin serves POST /api/v1/session, which logs in with the dashboard
+// password and sets the session cookie.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	d := s.dashboard
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Password), []byte(d.password)) != 1 {
+		logf(r.Context(), "Dashboard login failed from %s", r.RemoteAddr)
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+	session, err := d.login()
+	if err != nil {
+		logf(r.Context(), "Error creating session: %v", err)
+		http.Error(w, "Could not create session", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.id,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   d.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	logf(r.Context(), "Dashboard session started from %s", r.RemoteAddr)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// handleGetSession serves GET /api/v1/session, the current session.
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return
+	}
+	session, ok := s.dashboard.session(cookie.Value)
+	if !ok {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(session)
+}
+
+// handleLogout serves DELETE /api/v1/session, which ends the current session
+// and clears its cookie.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.dashboard.logout(cookie.Value)
+	}
+	s.dashboard.clearCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDashboardWrap(t *testing.T) {
+	const dashboard = "https://dashboard.example.com"
+	d := &Dashboard{origins: map[string]bool{dashboard: true}, password: "secret", ttl: time.Hour, sessions: make(map[string]*Session)}
+	session, err := d.login()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := d.login()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	h := d.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name, method, path, origin string
+		session                    *Session
+		csrf                       string
+		want                       int
+	}{
+		// Clients that are not browsers send no Origin and need no session.
+		{"no origin", "POST", "/api/v1/deployments", "", nil, "", http.StatusOK},
+		{"no origin, expired session", "GET", "/api/v1/agents", "", expired, "", http.StatusUnauthorized},
+		{"dashboard without session", "GET", "/api/v1/agents", dashboard, nil, "", http.StatusUnauthorized},
+		{"dashboard with session", "GET", "/api/v1/agents", dashboard, session, "", http.StatusOK},
+		{"dashboard with expired session", "GET", "/api/v1/agents", dashboard, expired, "", http.StatusUnauthorized},
+		{"dashboard change without CSRF token", "POST", "/api/v1/deployments", dashboard, session, "", http.StatusForbidden},
+		{"dashboard change with wrong CSRF token", "POST", "/api/v1/deployments", dashboard, session, "x", http.StatusForbidden},
+		{"dashboard change with CSRF token", "POST", "/api/v1/deployments", dashboard, session, session.CSRFToken, http.StatusOK},
+		{"dashboard login", "POST", "/api/v1/session", dashboard, nil, "", http.StatusOK},
+		{"dashboard preflight", "OPTIONS", "/api/v1/deployments", dashboard, nil, "", http.StatusNoContent},
+		{"same origin change without session", "POST", "/api/v1/deployments", "http://example.com", nil, "", http.StatusUnauthorized},
+		{"other origin read", "GET", "/api/v1/agents", "https://evil.example.com", session, "", http.StatusOK},
+		{"other origin change", "POST", "/api/v1/deployments", "https://evil.example.com", session, session.CSRFToken, http.StatusForbidden},
+		{"other origin login", "POST", "/api/v1/session", "https://evil.example.com", nil, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			if tt.session != nil {
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.session.id})
+			}
+			if tt.csrf != "" {
+				r.Header.Set(csrfHeader, tt.csrf)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.want, w.Body)
+			}
+			allowed := tt.origin == dashboard || tt.origin == "http://example.com"
+			if got := w.Header().Get("Access-Control-Allow-Origin"); (got != "") != allowed {
+				t.Errorf("Access-Control-Allow-Origin = %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPageSize is how many deployments a page holds unless ?limit
+	// asks for another number.
+	defaultPageSize = 100
+	// maxPageSize caps ?limit.
+	maxPageSize = 500
+)
+
+// pageCursor marks where a page of deployments ends: the creation time and
+// ID of its last deployment. Deployments are listed in creation order, and
+// by ID among those created at the same time.
+type pageCursor struct {
+	createdAt time.Time
+	id        string
+}
+
+// follows reports whether dep is listed after the cursor.
+func (c pageCursor) follows(dep *Deployment) bool {
+	if !dep.CreatedAt.Equal(c.createdAt) {
+		return dep.CreatedAt.After(c.createdAt)
+	}
+	return dep.ID > c.id
+}
+
+// token encodes the cursor as an opaque page token.
+func (c pageCursor) token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.createdAt.Format(time.RFC3339Nano) + " " + c.id))
+}
+
+// parsePageToken decodes a page token made by token.
+func parsePageToken(token string) (pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid page_token")
+	}
+	created, id, ok := strings.Cut(string(b), " ")
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if !ok || err != nil || id == "" {
+		return pageCursor{}, errors.New("invalid page_token")
+	}
+	return pageCursor{createdAt: t, id: id}, nil
+}
+
+// Page returns up to limit deployments in creation order that follow the
+// cursor, or from the first one if it is nil, of the given agent or, if
+// agentID is empty, of all agents. It also reports whether more follow.
+func (s *DeploymentStore) Page(agentID string, includeArchived bool, after *pageCursor, limit int) ([]*Deployment, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	var deps []*Deployment
+	add := func(dep *Deployment) {
+		if (dep.ArchivedAt == nil || includeArchived) && (after == nil || after.follows(dep)) {
+			deps = append(deps, dep)
+		}
+	}
+	if agentID != "" {
+		for _, dep := range s.byAgent[agentID] {
+			add(dep)
+		}
+	} else {
+		for _, dep := range s.deployments {
+			add(dep)
+		}
+	}
+	slices.SortFunc(deps, func(a, b *Deployment) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	more := len(deps) > limit
+	deps = deps[:min(len(deps), limit)]
+	for i, dep := range deps {
+		deps[i] = cloneDeployment(dep)
+	}
+	return deps, more
+}
+
+// handleListDeploymentsV2 serves GET /api/v2/deployments. Unlike version 1,
+// agent_id is optional, so that the deployments of all agents can be listed,
+// and deployments come in pages of ?limit (100 by default, at most 500), in
+// creation order. A page's next_page_token, passed back as ?page_token,
+// fetches the next one.
+func (s *Server) handleListDeploymentsV2(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			http.Error(w, fmt.Sprintf("Invalid limit %q: must be between 1 and %d", v, maxPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var after *pageCursor
+	if v := query.Get("page_token"); v != "" {
+		cursor, err := parsePageToken(v)
+		if err != nil {
+			http.Error(w, "Invalid page_token; pass the next_page_token of the previous page", http.StatusBadRequest)
+			return
+		}
+		after = &cursor
+	}
+
+	deps, more := s.deployments.Page(query.Get("agent_id"), includeArchived(r), after, limit)
+	page := DeploymentPage{Items: make([]Deployment, 0, len(deps))}
+	for _, dep := range deps {
+		page.Items = append(page.Items, *dep)
+	}
+	if more {
+		last := deps[len(deps)-1]
+		page.NextPageToken = pageCursor{createdAt: last.CreatedAt, id: last.ID}.token()
+	}
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// desiredStateDigest returns the digest of what an agent is told to run: its
+// deployments and the configs, secrets, and bundles they use. Statuses agents
+// report, and the reasons and timestamps that come with them, are left out,
+// so that an agent's own status reports do not change its desired state.
+func desiredStateDigest(state *StreamDeployments) string {
+	deps := make([]Deployment, len(state.Deployments))
+	for i, dep := range state.Deployments {
+		if slices.Contains(reportableStatuses, reportedStatus(dep.Status)) {
+			dep.Status = ""
+		}
+		dep.StatusTimes = nil
+		dep.Reason = ""
+		dep.ResourceVersion = 0
+		deps[i] = dep
+	}
+	slices.SortFunc(deps, func(a, b Deployment) int { return strings.Compare(a.ID, b.ID) })
+	// Maps are encoded with sorted keys, so equal states encode equally.
+	b, err := json.Marshal(StreamDeployments{Deployments: deps, Configs: state.Configs, Secrets: state.Secrets, Bundles: state.Bundles})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// desiredState returns the digest of an agent's desired state.
+func (svc *AgentService) desiredState(agentID string) string {
+	return svc.deploymentsFor(agentID).DesiredState
+}
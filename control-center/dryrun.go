@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"edge-orchestration/api/types"
+)
+
+// dryRunID stands in for the ID of a deployment that is not created; the
+// deployments of its add-ons are named after it.
+const dryRunID = "dep-dry-run"
+
+// DryRun returns the deployment a request would create, and the deployments
+// of its add-ons, as they would start, without storing them. It fails like
+// Create would.
+func (s *DeploymentStore) DryRun(req DeploymentRequest) (*Deployment, []Deployment, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	req.Addons = slices.Clone(req.Addons)
+	req.dependsOnIDs = slices.Clone(req.dependsOnIDs)
+	var addons []Deployment
+	for i, a := range req.Addons {
+		d, err := s.plan(dryRunID+"-"+a.Name, addonRequest(req, a))
+		if err != nil {
+			return nil, nil, fmt.Errorf("add-on %s: %w", a.Name, err)
+		}
+		d.AddonOf = dryRunID
+		addons = append(addons, *d)
+		req.Addons[i].DeploymentID = d.ID
+		req.Addons[i].Env = addonEnv(a, d.ID)
+		req.dependsOnIDs = append(req.dependsOnIDs, d.ID)
+	}
+	dep, err := s.plan(dryRunID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dep.Status == types.StatusPending {
+		if waitingFor := s.unreadyDependencies(dep); len(waitingFor) > 0 {
+			s.setStatus(dep, types.StatusWaiting)
+			dep.Reason = "Waiting for dependencies: " + strings.Join(waitingFor, ", ")
+		}
+	}
+	return dep, addons, nil
+}
+
+// handleDryRun answers a POST /api/v1/deployments?dry_run=true request that
+// passed validation, admission policies, and freezes with what it would
+// create, including its Kubernetes manifests, without creating it.
+func (s *Server) handleDryRun(w http.ResponseWriter, r *http.Request, req DeploymentRequest) {
+	dep, addons, err := s.deployments.DryRun(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), egressLookupTimeout)
+	defer cancel()
+	result := DryRun{Deployment: *dep, Addons: addons, Manifests: []map[string]any{}}
+	for _, d := range append([]Deployment{*dep}, addons...) {
+		manifests, err := workloadManifests(ctx, d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		result.Manifests = append(result.Manifests, manifests...)
+	}
+	json.NewEncoder(w).Encode(result)
+}
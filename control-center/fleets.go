@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FleetStore manages the collection of fleets.
+type FleetStore struct {
+	sync.Mutex
+	fleets map[string]*Fleet
+}
+
+// NewFleetStore creates a new in-memory fleet store.
+func NewFleetStore() *FleetStore {
+	return &FleetStore{fleets: make(map[string]*Fleet)}
+}
+
+// Put creates a fleet or replaces its members.
+func (s *FleetStore) Put(name string, agents []string) Fleet {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+	fleet, exists := s.fleets[name]
+	if !exists {
+		fleet = &Fleet{Name: name, CreatedAt: now}
+		s.fleets[name] = fleet
+	}
+	fleet.Agents = agents
+	fleet.UpdatedAt = now
+	log.Printf("Fleet %s now has %d agents", name, len(agents))
+	return *fleet
+}
+
+// Get returns the fleet with the given name.
+func (s *FleetStore) Get(name string) (Fleet, bool) {
+	s.Lock()
+	defer s.Unlock()
+	fleet, exists := s.fleets[name]
+	if !exists {
+		return Fleet{}, false
+	}
+	return *fleet, true
+}
+
+// List returns all fleets ordered by name.
+func (s *FleetStore) List() []Fleet {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Fleet, 0, len(s.fleets))
+	for _, fleet := range s.fleets {
+		list = append(list, *fleet)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete removes a fleet. Deployments made to it are left running. It
+// returns false if the fleet does not exist.
+func (s *FleetStore) Delete(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.fleets[name]; !exists {
+		return false
+	}
+	delete(s.fleets, name)
+	return true
+}
+
+// restore replaces all fleets.
+func (s *FleetStore) restore(fleets []Fleet) {
+	s.Lock()
+	defer s.Unlock()
+	s.fleets = make(map[string]*Fleet, len(fleets))
+	for _, fleet := range fleets {
+		s.fleets[fleet.Name] = &fleet
+	}
+}
+
+// FleetDeploymentStatus counts the active deployments made to a fleet by
+// status.
+func (s *DeploymentStore) FleetDeploymentStatus(name string) map[string]int {
+	s.Lock()
+	defer s.Unlock()
+	counts := make(map[string]int)
+	for _, dep := range s.deployments {
+		if dep.Fleet == name && dep.ArchivedAt == nil && !retired(dep.Status) {
+			counts[string(dep.Status)]++
+		}
+	}
+	return counts
+}
+
+// countStatuses counts agents by status, those in maintenance also as
+// "maintenance", and IDs of agents that do not exist as "unknown".
+func (s *AgentStore) countStatuses(ids []string) map[string]int {
+	s.Lock()
+	defer s.Unlock()
+	s.refreshStatus()
+	counts := make(map[string]int)
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		agent, exists := s.agents[id]
+		if !exists {
+			counts["unknown"]++
+			continue
+		}
+		counts[agent.Status]++
+		if agent.Maintenance != nil {
+			counts["maintenance"]++
+		}
+	}
+	return counts
+}
+
+// fleetStatus aggregates the status of a fleet's agents and deployments.
+func (s *Server) fleetStatus(fleet Fleet) FleetStatus {
+	return FleetStatus{
+		Fleet:            fleet,
+		AgentStatus:      s.agents.countStatuses(fleet.Agents),
+		DeploymentStatus: s.deployments.FleetDeploymentStatus(fleet.Name),
+	}
+}
+
+// validateFleetName reports whether a name can be used for a fleet.
+func validateFleetName(name string) error {
+	if !validConfigKey(name) {
+		return fmt.Errorf("invalid fleet name %q: names may only contain letters, digits, dashes, underscores, and dots", name)
+	}
+	return nil
+}
+
+// handleListFleets lists fleets with their aggregated status.
+func (s *Server) handleListFleets(w http.ResponseWriter, r *http.Request) {
+	fleets := s.fleets.List()
+	list := make([]FleetStatus, 0, len(fleets))
+	for _, fleet := range fleets {
+		list = append(list, s.fleetStatus(fleet))
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleGetFleet returns a fleet with its aggregated status.
+func (s *Server) handleGetFleet(w http.ResponseWriter, r *http.Request) {
+	fleet, exists := s.fleets.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Fleet not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s.fleetStatus(fleet))
+}
+
+// handlePutFleet creates a fleet or replaces its members.
+func (s *Server) handlePutFleet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := validateFleetName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req FleetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	agents := make([]string, 0, len(req.Agents))
+	seen := make(map[string]bool, len(req.Agents))
+	for _, id := range req.Agents {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if agent, exists := s.agents.Get(id); !exists || agent.ArchivedAt != nil {
+			http.Error(w, fmt.Sprintf("Agent %s not found", id), http.StatusBadRequest)
+			return
+		}
+		agents = append(agents, id)
+	}
+	fleet := s.fleets.Put(name, agents)
+	json.NewEncoder(w).Encode(s.fleetStatus(fleet))
+}
+
+// handleDeleteFleet deletes a fleet, leaving the deployments made to it
+// running.
+func (s *Server) handleDeleteFleet(w http.ResponseWriter, r *http.Request) {
+	if !s.fleets.Delete(r.PathValue("name")) {
+		http.Error(w, "Fleet not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeployToFleet creates a deployment on every agent of a fleet. Each
+// one is validated and created on its own, and the response reports them
+// like a batch, indexed by the agent's position in the fleet.
+func (s *Server) handleDeployToFleet(w http.ResponseWriter, r *http.Request) {
+	fleet, exists := s.fleets.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Fleet not found", http.StatusNotFound)
+		return
+	}
+	var req DeploymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.AgentID != "" {
+		http.Error(w, "agent_id must not be set; the fleet's agents are deployed to", http.StatusBadRequest)
+		return
+	}
+	if len(fleet.Agents) == 0 {
+		http.Error(w, fmt.Sprintf("Fleet %s has no agents", fleet.Name), http.StatusConflict)
+		return
+	}
+
+	req.Fleet = fleet.Name
+	resp := s.deployToAgents(r, req, fleet.Agents)
+	logf(r.Context(), "Fleet %s: %d deployments created, %d failed", fleet.Name, resp.Succeeded, resp.Failed)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// deployToAgents creates a deployment from a request on each of the given
+// agents, validating each like a single request, and returns the outcome per
+// agent.
+func (s *Server) deployToAgents(r *http.Request, req DeploymentRequest, agentIDs []string) BatchResponse {
+	resp := BatchResponse{Results: make([]BatchResult, 0, len(agentIDs))}
+	for i, agentID := range agentIDs {
+		result := BatchResult{Operation: "create", Index: i}
+		item := req
+		item.AgentID = agentID
+		// Requests are copied per agent, since validation resolves them.
+		item.Configs = append([]ConfigRef(nil), req.Configs...)
+		item.Secrets = append([]SecretRef(nil), req.Secrets...)
+		item.Addons = append([]Addon(nil), req.Addons...)
+		if agent, exists := s.agents.Get(agentID); !exists || agent.ArchivedAt != nil {
+			result.Status, result.Error = http.StatusNotFound, fmt.Sprintf("Agent %s not found", agentID)
+		} else if code, err := validateDeploymentRequest(r.Context(), s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &item); err != nil {
+			result.Status, result.Error = code, err.Error()
+		} else if err := s.freezes.check(r, item.Project, item.AgentID); err != nil {
+			result.Status, result.Error = http.StatusForbidden, err.Error()
+		} else if dep, err := s.deployments.Create(item); err != nil {
+			result.Status, result.Error = http.StatusForbidden, err.Error()
+		} else {
+			result.Status, result.ID, result.Deployment = http.StatusCreated, dep.ID, dep
+		}
+		if result.Error == "" {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp
+}
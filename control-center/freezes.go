@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"edge-orchestration/api/types"
+	"github.com/google/uuid"
+)
+
+// FreezeError is returned when a change is made to a deployment in a freeze
+// window without a break-glass justification.
+type FreezeError struct {
+	Freeze Freeze
+}
+
+func (e *FreezeError) Error() string {
+	scope := "all deployments"
+	switch e.Freeze.Scope {
+	case "project":
+		scope = "deployments of project " + e.Freeze.Project
+	case "agent":
+		scope = "deployments to agent " + e.Freeze.AgentID
+	}
+	msg := fmt.Sprintf("%s are frozen until %s by freeze %s", scope, e.Freeze.End.Format(time.RFC3339), e.Freeze.ID)
+	if e.Freeze.Reason != "" {
+		msg += " (" + e.Freeze.Reason + ")"
+	}
+	return msg + "; send a justification in " + types.BreakGlassHeader + " to override it"
+}
+
+// FreezeStore manages the collection of freeze windows.
+type FreezeStore struct {
+	sync.Mutex
+	freezes map[string]*Freeze
+}
+
+// NewFreezeStore creates a new in-memory freeze store.
+func NewFreezeStore() *FreezeStore {
+	return &FreezeStore{freezes: make(map[string]*Freeze)}
+}
+
+// validateFreezeRequest checks a freeze's scope and window, defaulting its
+// start to now.
+func validateFreezeRequest(req *FreezeRequest) error {
+	switch req.Scope {
+	case "global":
+		if req.Project != "" || req.AgentID != "" {
+			return fmt.Errorf("global freezes take neither project nor agent_id")
+		}
+	case "project":
+		if req.Project == "" || req.AgentID != "" {
+			return fmt.Errorf("project freezes require project and take no agent_id")
+		}
+	case "agent":
+		if req.AgentID == "" || req.Project != "" {
+			return fmt.Errorf("agent freezes require agent_id and take no project")
+		}
+	default:
+		return fmt.Errorf("scope must be global, project, or agent")
+	}
+	if req.Start.IsZero() {
+		req.Start = time.Now().UTC()
+	}
+	if !req.End.After(req.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+	return nil
+}
+
+// Create stores a new freeze window.
+func (s *FreezeStore) Create(req FreezeRequest) Freeze {
+	s.Lock()
+	defer s.Unlock()
+	f := &Freeze{
+		ID:        fmt.Sprintf("freeze-%s", uuid.New().String()[:8]),
+		Scope:     req.Scope,
+		Project:   req.Project,
+		AgentID:   req.AgentID,
+		Start:     req.Start.UTC(),
+		End:       req.End.UTC(),
+		Reason:    req.Reason,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.freezes[f.ID] = f
+	log.Printf("Freeze %s (%s) created from %s to %s", f.ID, f.Scope, f.Start.Format(time.RFC3339), f.End.Format(time.RFC3339))
+	return *f
+}
+
+// List returns all freezes ordered by start.
+func (s *FreezeStore) List() []Freeze {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Freeze, 0, len(s.freezes))
+	for _, f := range s.freezes {
+		list = append(list, *f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	return list
+}
+
+// Get returns the freeze with the given ID.
+func (s *FreezeStore) Get(id string) (Freeze, bool) {
+	s.Lock()
+	defer s.Unlock()
+	f, exists := s.freezes[id]
+	if !exists {
+		return Freeze{}, false
+	}
+	return *f, true
+}
+
+// Delete removes a freeze, ending it early. It returns false if the freeze
+// does not exist.
+func (s *FreezeStore) Delete(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.freezes[id]; !exists {
+		return false
+	}
+	delete(s.freezes, id)
+	log.Printf("Freeze %s deleted", id)
+	return true
+}
+
+// restore replaces all freezes.
+func (s *FreezeStore) restore(freezes []Freeze) {
+	s.Lock()
+	defer s.Unlock()
+	s.freezes = make(map[string]*Freeze, len(freezes))
+	for _, f := range freezes {
+		s.freezes[f.ID] = &f
+	}
+}
+
+// Active returns a freeze in effect at the given time that covers
+// deployments of the project to the agent, or nil if there is none.
+func (s *FreezeStore) Active(project, agentID string, at time.Time) *Freeze {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, f := range s.freezes {
+		if at.Before(f.Start) || !at.Before(f.End) {
+			continue
+		}
+		if f.Scope == "global" || f.Scope == "project" && f.Project == project || f.Scope == "agent" && f.AgentID == agentID {
+			active := *f
+			return &active
+		}
+	}
+	return nil
+}
+
+// check returns a *FreezeError if a request would change a deployment of the
+// project to the agent during a freeze. Requests with a break-glass
+// justification are let through and recorded on the freeze.
+func (s *FreezeStore) check(r *http.Request, project, agentID string) error {
+	f := s.Active(project, agentID, time.Now())
+	if f == nil {
+		return nil
+	}
+	justification := strings.TrimSpace(r.Header.Get(types.BreakGlassHeader))
+	if justification == "" {
+		return &FreezeError{Freeze: *f}
+	}
+	override := FreezeOverride{
+		Operation:     r.Method + " " + r.URL.Path,
+		AgentID:       agentID,
+		Project:       project,
+		Justification: justification,
+		At:            time.Now().UTC(),
+	}
+	s.Lock()
+	if stored, exists := s.freezes[f.ID]; exists {
+		stored.Overrides = append(stored.Overrides, override)
+	}
+	s.Unlock()
+	logf(r.Context(), "Break-glass override of freeze %s for %s: %s", f.ID, override.Operation, justification)
+	return nil
+}
+
+// checkDeployment is check for a change to an existing deployment. Unknown
+// deployments are let through so that the handler reports them.
+func (s *FreezeStore) checkDeployment(r *http.Request, deployments *DeploymentStore, id string) error {
+	dep, exists := deployments.Get(id)
+	if !exists {
+		return nil
+	}
+	return s.check(r, dep.Project, dep.AgentID)
+}
+
+// frozen returns the freeze that keeps a deployment of the project to the
+// agent from changing now, or nil. Changes the control center makes on its
+// own, such as automatic redeploys, wait for freezes to end.
+func (s *DeploymentStore) frozen(project, agentID string) *Freeze {
+	return s.freezes.Active(project, agentID, time.Now())
+}
+
+// handleListFreezes lists freeze windows, including past ones.
+func (s *Server) handleListFreezes(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.freezes.List())
+}
+
+// handleCreateFreeze creates a freeze window.
+func (s *Server) handleCreateFreeze(w http.ResponseWriter, r *http.Request) {
+	var req FreezeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if err := validateFreezeRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := s.freezes.Create(req)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+// handleGetFreeze returns a freeze window and its break-glass overrides.
+func (s *Server) handleGetFreeze(w http.ResponseWriter, r *http.Request) {
+	f, exists := s.freezes.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Freeze not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(f)
+}
+
+// handleDeleteFreeze deletes a freeze window, ending it early.
+func (s *Server) handleDeleteFreeze(w http.ResponseWriter, r *http.Request) {
+	if !s.freezes.Delete(r.PathValue("id")) {
+		http.Error(w, "Freeze not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gatewayPrefix is the path prefix of the inference gateway. It matches the
+// prefix of the OpenAI-compatible APIs of the model servers, so clients use
+// the control center as their base URL.
+const gatewayPrefix = "/v1"
+
+// Gateway routes inference requests to the running deployments that serve
+// the requested model, so clients need not know which agent runs them. Each
+// request goes to the endpoint with the fewest requests in flight, taking
+// turns among equally busy ones. The requests and tokens each endpoint
+// served are metered. Requests are also mirrored to the shadows of their
+// model.
+type Gateway struct {
+	deployments *DeploymentStore
+	agents      *AgentStore
+	usage       *UsageStore
+	shadows     *ShadowStore
+	transport   http.RoundTripper
+
+	mu       sync.Mutex
+	inFlight map[string]int // By deployment ID
+	turn     map[string]int // By model, to rotate between equally busy endpoints
+}
+
+// NewGateway creates an inference gateway over the deployments of agents
+// that records their usage.
+func NewGateway(deployments *DeploymentStore, agents *AgentStore, usage *UsageStore) *Gateway {
+	return &Gateway{
+		deployments: deployments,
+		agents:      agents,
+		usage:       usage,
+		shadows:     NewShadowStore(),
+		transport:   http.DefaultTransport,
+		inFlight:    make(map[string]int),
+		turn:        make(map[string]int),
+	}
+}
+
+// onlineAddresses returns the addresses of the agents that are online.
+func (s *AgentStore) onlineAddresses() map[string]string {
+	s.Lock()
+	defer s.Unlock()
+	s.refreshStatus()
+	addrs := make(map[string]string)
+	for _, agent := range s.agents {
+		if agent.ArchivedAt == nil && agent.Status == "online" {
+			addrs[agent.ID] = agent.Address
+		}
+	}
+	return addrs
+}
+
+// modelEndpoints returns the running model serving deployments on the given
+// agents, by model and deployment ID.
+func (s *DeploymentStore) modelEndpoints(addrs map[string]string) []ModelEndpoint {
+	s.Lock()
+	defer s.Unlock()
+	list := []ModelEndpoint{}
+	for _, dep := range s.deployments {
+		m := dep.ModelServing
+		addr, online := addrs[dep.AgentID]
+		if m == nil || dep.Status != "running" || dep.ArchivedAt != nil || !online {
+			continue
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		e := ModelEndpoint{
+			Model:        m.Model,
+			Server:       m.Server,
+			DeploymentID: dep.ID,
+			AgentID:      dep.AgentID,
+			Project:      dep.Project,
+			URL:          "http://" + net.JoinHostPort(host, strconv.Itoa(modelServers[m.Server].port)) + gatewayPrefix,
+		}
+		if m.Shadow != nil {
+			e.ShadowOf, e.ShadowPercent = m.Shadow.Model, m.Shadow.Percent
+		}
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Model != list[j].Model {
+			return list[i].Model < list[j].Model
+		}
+		return list[i].DeploymentID < list[j].DeploymentID
+	})
+	return list
+}
+
+// Endpoints returns the endpoints the gateway routes to, with the requests in
+// flight to each.
+func (g *Gateway) Endpoints() []ModelEndpoint {
+	list := g.deployments.modelEndpoints(g.agents.onlineAddresses())
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range list {
+		list[i].InFlight = g.inFlight[list[i].DeploymentID]
+	}
+	return list
+}
+
+// pick chooses the endpoint of a model to send a request to and counts the
+// request as in flight until done is called. It returns false if no running
+// deployment serves the model. Shadows never serve requests.
+func (g *Gateway) pick(model string) (endpoint ModelEndpoint, done func(), ok bool) {
+	var candidates []ModelEndpoint
+	for _, e := range g.deployments.modelEndpoints(g.agents.onlineAddresses()) {
+		if e.Model == model && e.ShadowOf == "" {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return ModelEndpoint{}, nil, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.turn[model]++
+	best := -1
+	for i := range candidates {
+		c := (g.turn[model] + i) % len(candidates)
+		if best == -1 || g.inFlight[candidates[c].DeploymentID] < g.inFlight[candidates[best].DeploymentID] {
+			best = c
+		}
+	}
+	endpoint = candidates[best]
+	g.inFlight[endpoint.DeploymentID]++
+	done = func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.inFlight[endpoint.DeploymentID]--; g.inFlight[endpoint.DeploymentID] <= 0 {
+			delete(g.inFlight, endpoint.DeploymentID)
+		}
+	}
+	return endpoint, done, true
+}
+
+// handleInference serves POST /v1/..., e.g. /v1/chat/completions, by
+// proxying the request to an endpoint serving the model its body names.
+// Streamed responses are passed on as they arrive. The request is also
+// mirrored to the shadows of the model, and the time until the response was
+// passed on in full is measured for comparison with them.
+func (g *Gateway) handleInference(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.Model == "" {
+		http.Error(w, "Request body must be JSON naming a model", http.StatusBadRequest)
+		return
+	}
+	endpoint, done, ok := g.pick(req.Model)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No running deployment serves model %q", req.Model), http.StatusNotFound)
+		return
+	}
+	defer done()
+	start := time.Now()
+	shadows := g.mirror(r, req.Model, body)
+
+	target, _ := url.Parse(endpoint.URL)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// The servers' API has the gateway's prefix, so the path is
+			// passed on as is.
+			pr.SetURL(target)
+			pr.Out.URL.Path, pr.Out.URL.RawPath = r.URL.Path, r.URL.RawPath
+			pr.SetXForwarded()
+		},
+		Transport:     g.transport,
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			failed := resp.StatusCode >= 400
+			resp.Body = &usageMeter{
+				ReadCloser: resp.Body,
+				stream:     strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"),
+				record: func(u tokenUsage) {
+					sample := UsageSample{Requests: 1, PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+					if failed {
+						sample.Errors = 1
+					}
+					g.usage.Record(endpoint.DeploymentID, sample, time.Now().UTC())
+					g.shadows.recordPrimary(shadows, time.Since(start), failed)
+				},
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logf(r.Context(), "Gateway: deployment %s at %s failed: %v", endpoint.DeploymentID, endpoint.URL, err)
+			g.usage.Record(endpoint.DeploymentID, UsageSample{Requests: 1, Errors: 1}, time.Now().UTC())
+			g.shadows.recordPrimary(shadows, time.Since(start), true)
+			http.Error(w, fmt.Sprintf("Deployment %s serving model %q is unreachable", endpoint.DeploymentID, req.Model), http.StatusBadGateway)
+		},
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	w.Header().Set("X-Served-By", endpoint.DeploymentID)
+	proxy.ServeHTTP(w, r)
+}
+
+// handleModels serves GET /v1/models, the models the gateway routes to in
+// the format of the OpenAI API.
+func (g *Gateway) handleModels(w http.ResponseWriter, r *http.Request) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		OwnedBy string `json:"owned_by"`
+	}
+	list := struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}{Object: "list", Data: []model{}}
+	seen := make(map[string]bool)
+	for _, e := range g.deployments.modelEndpoints(g.agents.onlineAddresses()) {
+		if e.ShadowOf == "" && !seen[e.Model] {
+			seen[e.Model] = true
+			list.Data = append(list.Data, model{ID: e.Model, Object: "model", OwnedBy: e.Project})
+		}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleListEndpoints serves GET /api/v1/gateway/endpoints, the registry of
+// model endpoints the gateway routes to.
+func (g *Gateway) handleListEndpoints(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(g.Endpoints())
+}
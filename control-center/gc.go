@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// GCPolicy controls how often expired deployments are collected and how long
+// agents see an expired deployment before it is archived.
+type GCPolicy struct {
+	Interval time.Duration
+	Grace    time.Duration // Time agents have to tear down an expired deployment
+}
+
+// GCPolicyFromEnv reads the garbage collection policy from the
+// DEPLOYMENT_GC_INTERVAL (30s) and DEPLOYMENT_GC_GRACE (5m) environment variables.
+func GCPolicyFromEnv() (GCPolicy, error) {
+	p := GCPolicy{Interval: 30 * time.Second, Grace: 5 * time.Minute}
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{{"DEPLOYMENT_GC_INTERVAL", &p.Interval}, {"DEPLOYMENT_GC_GRACE", &p.Grace}} {
+		if v := os.Getenv(setting.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return p, fmt.Errorf("invalid %s %q: must be a positive duration", setting.name, v)
+			}
+			*setting.value = d
+		}
+	}
+	return p, nil
+}
+
+// RunGC collects expired deployments, and the secret versions no deployment
+// uses any more, on every interval. It never returns.
+func (s *DeploymentStore) RunGC(p GCPolicy, secrets *SecretStore) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		expired, archived := s.CollectExpired(now.UTC(), p.Grace)
+		pruned := secrets.Prune(s.SecretVersions())
+		if expired+archived+pruned > 0 {
+			log.Printf("Deployment GC: %d expired, %d archived, %d secret versions pruned", expired, archived, pruned)
+		}
+	}
+}
+
+// CollectExpired tears down deployments whose TTL has passed by marking them
+// expired, which tells their agents to stop them. Once the grace period has
+// passed as well, expired deployments are archived: they are hidden from their
+// agent but can still be fetched by ID until purged.
+func (s *DeploymentStore) CollectExpired(now time.Time, grace time.Duration) (expired, archived int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, dep := range s.deployments {
+		if dep.ExpiresAt == nil || now.Before(*dep.ExpiresAt) || dep.ArchivedAt != nil {
+			continue
+		}
+		if dep.Status != "expired" {
+			if retired(dep.Status) {
+				continue
+			}
+			s.setStatus(dep, types.StatusExpired)
+			dep.Reason = fmt.Sprintf("TTL expired at %s", dep.ExpiresAt.Format(time.RFC3339))
+			s.recordEvent(dep.ID, "expired", dep.Reason)
+			log.Printf("Deployment %s expired", dep.ID)
+			expired++
+			continue
+		}
+		if now.Before(dep.ExpiresAt.Add(grace)) {
+			continue
+		}
+		archivedAt := now
+		dep.ArchivedAt = &archivedAt
+		s.recordEvent(dep.ID, "archived", "Deployment archived after its TTL expired")
+		archived++
+	}
+	if expired > 0 {
+		s.admitQueued()
+	}
+	return expired, archived
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultGitOpsBranch   = "main"
+	defaultGitOpsInterval = 60 * time.Second
+)
+
+// DeploymentSpec is a declarative deployment definition stored in a git repository.
+type DeploymentSpec struct {
+	Name     string `yaml:"name"`
+	AgentID  string `yaml:"agent_id"`
+	ImageURL string `yaml:"image_url"`
+}
+
+// GitSyncStatus reports the state of the most recent git sync.
+type GitSyncStatus struct {
+	Repository string    `json:"repository"`
+	Branch     string    `json:"branch"`
+	Path       string    `json:"path"`
+	CommitSHA  string    `json:"commit_sha,omitempty"`
+	LastSync   time.Time `json:"last_sync"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// GitSyncer periodically pulls a git repository of deployment specs and
+// reconciles them against the deployment store, making git the source of truth
+// for the deployments it manages.
+type GitSyncer struct {
+	repoURL  string
+	branch   string
+	path     string
+	workDir  string
+	interval time.Duration
+	store    *DeploymentStore
+
+	mu     sync.Mutex
+	status GitSyncStatus
+}
+
+// NewGitSyncerFromEnv creates a GitSyncer from the GITOPS_* environment
+// variables. It returns nil if GITOPS_REPO is not set.
+func NewGitSyncerFromEnv(store *DeploymentStore) (*GitSyncer, error) {
+	repoURL := os.Getenv("GITOPS_REPO")
+	if repoURL == "" {
+		return nil, nil
+	}
+
+	branch := os.Getenv("GITOPS_BRANCH")
+	if branch == "" {
+		branch = defaultGitOpsBranch
+	}
+	path := os.Getenv("GITOPS_PATH")
+	if path == "" {
+		path = "."
+	}
+	workDir := os.Getenv("GITOPS_DIR")
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "control-center-gitops")
+	}
+	interval := defaultGitOpsInterval
+	if v := os.Getenv("GITOPS_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GITOPS_INTERVAL %q: %w", v, err)
+		}
+		interval = d
+	}
+
+	return &GitSyncer{
+		repoURL:  repoURL,
+		branch:   branch,
+		path:     path,
+		workDir:  workDir,
+		interval: interval,
+		store:    store,
+		status:   GitSyncStatus{Repository: repoURL, Branch: branch, Path: path},
+	}, nil
+}
+
+// Run syncs immediately and then on every interval. It never returns.
+func (g *GitSyncer) Run() {
+	log.Printf("GitOps sync enabled for %s (branch %s, path %s) every %s", g.repoURL, g.branch, g.path, g.interval)
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		g.syncOnce()
+		<-ticker.C
+	}
+}
+
+// Status returns the state of the most recent sync.
+func (g *GitSyncer) Status() GitSyncStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status
+}
+
+func (g *GitSyncer) syncOnce() {
+	// A sync that has not finished by the time the next one is due is
+	// abandoned, so a hung git server cannot stall syncing forever.
+	ctx, cancel := context.WithTimeout(context.Background(), g.interval)
+	defer cancel()
+	sha, err := g.sync(ctx)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status.LastSync = time.Now().UTC()
+	if err != nil {
+		log.Printf("GitOps sync failed: %v", err)
+		g.status.Error = err.Error()
+		return
+	}
+	g.status.CommitSHA = sha
+	g.status.Error = ""
+}
+
+// sync pulls the latest commit, loads its specs, and reconciles them against the store.
+func (g *GitSyncer) sync(ctx context.Context) (string, error) {
+	if err := g.pull(ctx); err != nil {
+		return "", err
+	}
+	sha, err := g.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	specs, err := loadDeploymentSpecs(filepath.Join(g.workDir, g.path))
+	if err != nil {
+		return "", err
+	}
+
+	created, superseded, removed := g.store.ReconcileGitSpecs(specs, sha)
+	if created+superseded+removed > 0 {
+		log.Printf("GitOps sync at %s: %d created, %d superseded, %d removed", shortSHA(sha), created, superseded, removed)
+	}
+	return sha, nil
+}
+
+// pull clones the repository on first use and hard-resets to the remote branch afterwards.
+func (g *GitSyncer) pull(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(g.workDir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(g.workDir), 0o755); err != nil {
+			return fmt.Errorf("could not create git work directory: %w", err)
+		}
+		cmd := exec.CommandContext(ctx, "git", "clone", "--quiet", "--depth", "1", "--branch", g.branch, g.repoURL, g.workDir)
+		cmd.WaitDelay = commandWaitDelay
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git clone failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	if _, err := g.git(ctx, "fetch", "--quiet", "--depth", "1", "origin", g.branch); err != nil {
+		return err
+	}
+	_, err := g.git(ctx, "reset", "--quiet", "--hard", "FETCH_HEAD")
+	return err
+}
+
+// git runs a git command inside the work directory and returns its trimmed output.
+func (g *GitSyncer) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.workDir}, args...)...)
+	cmd.WaitDelay = commandWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// loadDeploymentSpecs reads every .yaml, .yml, and .json file in dir as a
+// deployment spec. A spec without a name is named after its file.
+func loadDeploymentSpecs(dir string) ([]DeploymentSpec, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read spec directory: %w", err)
+	}
+
+	var specs []DeploymentSpec
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", entry.Name(), err)
+		}
+		var spec DeploymentSpec
+		if err := yaml.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", entry.Name(), err)
+		}
+		if spec.Name == "" {
+			spec.Name = strings.TrimSuffix(entry.Name(), ext)
+		}
+		if spec.AgentID == "" || spec.ImageURL == "" {
+			return nil, fmt.Errorf("%s: agent_id and image_url are required", entry.Name())
+		}
+		if other, exists := seen[spec.Name]; exists {
+			return nil, fmt.Errorf("%s: spec name %q is already used by %s", entry.Name(), spec.Name, other)
+		}
+		seen[spec.Name] = entry.Name()
+		specs = append(specs, spec)
+	}
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+)
+
+// GPUShortageFromEnv reports whether GPU requests an agent lacks the free
+// GPUs for are rejected rather than queued, from GPU_SHORTAGE ("queue" or
+// "reject"; "queue" by default).
+func GPUShortageFromEnv() (reject bool, err error) {
+	switch v := os.Getenv("GPU_SHORTAGE"); v {
+	case "", "queue":
+		return false, nil
+	case "reject":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid GPU_SHORTAGE %q: must be queue or reject", v)
+	}
+}
+
+// validateGPUInventory checks the GPUs an agent reported and merges entries
+// of the same model.
+func validateGPUInventory(gpus []GPUInventory) ([]GPUInventory, error) {
+	if gpus == nil {
+		return nil, nil
+	}
+	merged := []GPUInventory{}
+	for _, g := range gpus {
+		if g.Model == "" || g.Count < 0 {
+			return nil, fmt.Errorf("invalid gpu inventory: every entry needs a model and a count that is not negative")
+		}
+		i := slices.IndexFunc(merged, func(m GPUInventory) bool { return m.Model == g.Model })
+		if i < 0 {
+			merged = append(merged, g)
+		} else {
+			merged[i].Count += g.Count
+		}
+	}
+	return merged, nil
+}
+
+// SetGPUs records the GPUs a reconnecting agent reported.
+func (s *AgentStore) SetGPUs(id string, gpus []GPUInventory) {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		agent.GPUs = gpus
+		s.revision++
+	}
+}
+
+// gpus returns a copy of the GPUs an agent reported, or nil if it did not
+// report any.
+func (s *AgentStore) gpus(id string) []GPUInventory {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		return slices.Clone(agent.GPUs)
+	}
+	return nil
+}
+
+// gpuAllocation returns how many GPUs of each model in an agent's inventory
+// its active deployments request. Requests without a gpu_model take GPUs of
+// the models with GPUs left, in inventory order. The caller must hold the
+// lock.
+func (s *DeploymentStore) gpuAllocation(agentID string, inventory []GPUInventory) map[string]int {
+	allocated := make(map[string]int, len(inventory))
+	unmodeled := 0
+	for _, dep := range s.byAgent[agentID] {
+		if dep.Resources == nil || dep.Resources.GPU == 0 || !consumesQuota(dep.Status) || dep.ArchivedAt != nil {
+			continue
+		}
+		if dep.Resources.GPUModel == "" {
+			unmodeled += dep.Resources.GPU
+		} else {
+			allocated[dep.Resources.GPUModel] += dep.Resources.GPU
+		}
+	}
+	for _, g := range inventory {
+		n := min(unmodeled, max(g.Count-allocated[g.Model], 0))
+		allocated[g.Model] += n
+		unmodeled -= n
+	}
+	// Requests beyond the inventory, e.g. made before the agent reported
+	// fewer GPUs, still count against its first model.
+	if unmodeled > 0 && len(inventory) > 0 {
+		allocated[inventory[0].Model] += unmodeled
+	}
+	return allocated
+}
+
+// gpuShortage describes why an agent lacks the free GPUs requested, or
+// returns "" if it has them or never reported its GPUs. The caller must hold
+// the lock.
+func (s *DeploymentStore) gpuShortage(agentID string, requested resourceAmounts) string {
+	if requested.gpu == 0 || s.agents == nil {
+		return ""
+	}
+	inventory := s.agents.gpus(agentID)
+	if inventory == nil {
+		return ""
+	}
+	allocated := s.gpuAllocation(agentID, inventory)
+	total, free := 0, 0
+	for _, g := range inventory {
+		if requested.gpuModel == "" || g.Model == requested.gpuModel {
+			total += g.Count
+			free += max(g.Count-allocated[g.Model], 0)
+		}
+	}
+	kind := "gpus"
+	if requested.gpuModel != "" {
+		kind = requested.gpuModel + " gpus"
+	}
+	if free >= requested.gpu {
+		return ""
+	}
+	if total == 0 {
+		return fmt.Sprintf("agent %s has no %s", agentID, kind)
+	}
+	return fmt.Sprintf("agent %s has %d %s, %d in use", agentID, total, kind, total-free)
+}
+
+// GPUCapacity returns the GPU capacity of each agent that reported its GPUs,
+// and how much of it deployments request, by agent and model.
+func (s *DeploymentStore) GPUCapacity(agents []*Agent) []AgentGPUs {
+	s.Lock()
+	defer s.Unlock()
+	list := []AgentGPUs{}
+	for _, agent := range agents {
+		inventory := s.agents.gpus(agent.ID)
+		allocated := s.gpuAllocation(agent.ID, inventory)
+		for _, g := range inventory {
+			list = append(list, AgentGPUs{
+				AgentID:   agent.ID,
+				Status:    agent.Status,
+				Model:     g.Model,
+				Total:     g.Count,
+				Allocated: allocated[g.Model],
+				Free:      max(g.Count-allocated[g.Model], 0),
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].AgentID != list[j].AgentID {
+			return list[i].AgentID < list[j].AgentID
+		}
+		return list[i].Model < list[j].Model
+	})
+	return list
+}
+
+// handleGPUCapacity serves GET /api/v1/gpus, the GPU capacity of the agents
+// that reported their GPUs and how much of it is free.
+func (s *Server) handleGPUCapacity(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.deployments.GPUCapacity(s.agents.List(false)))
+}
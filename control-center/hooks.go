@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// maxWebhookBodySize caps the size of registry webhook payloads.
+const maxWebhookBodySize = 1 << 20
+
+// registryPushEvent is the union of the push payload fields sent by Docker Hub,
+// Harbor, and GitHub (GHCR) that are needed to identify the pushed image.
+type registryPushEvent struct {
+	// Docker Hub
+	PushData *struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository *struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+
+	// Harbor
+	Type      string `json:"type"`
+	EventData *struct {
+		Resources []struct {
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+
+	// GitHub package event (GHCR)
+	Action  string `json:"action"`
+	Package *struct {
+		Name           string `json:"name"`
+		PackageType    string `json:"package_type"`
+		PackageVersion *struct {
+			PackageURL        string `json:"package_url"`
+			ContainerMetadata *struct {
+				Tag struct {
+					Name string `json:"name"`
+				} `json:"tag"`
+			} `json:"container_metadata"`
+		} `json:"package_version"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"package"`
+}
+
+// RegistryWebhookResponse is the response body of the registry webhook.
+type RegistryWebhookResponse struct {
+	Images  []string      `json:"images"`
+	Updated []*Deployment `json:"updated"`
+}
+
+// handleRegistryWebhook serves POST /api/v1/hooks/registry, which redeploys
+// auto-updating deployments whose image was pushed.
+func (s *Server) handleRegistryWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if !verifyWebhookSecret(r, body, os.Getenv("REGISTRY_WEBHOOK_SECRET")) {
+		http.Error(w, "Invalid webhook credentials", http.StatusUnauthorized)
+		return
+	}
+
+	var event registryPushEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	images, err := event.pushedImages()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := RegistryWebhookResponse{Images: images, Updated: []*Deployment{}}
+	for _, image := range images {
+		logf(r.Context(), "Registry push received for image %s", image)
+		resp.Updated = append(resp.Updated, s.deployments.RedeployImage(image)...)
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// pushedImages returns the image references announced by a push event.
+func (e *registryPushEvent) pushedImages() ([]string, error) {
+	switch {
+	case e.PushData != nil && e.Repository != nil:
+		if e.Repository.RepoName == "" || e.PushData.Tag == "" {
+			return nil, errors.New("docker hub payload is missing repository or tag")
+		}
+		return []string{e.Repository.RepoName + ":" + e.PushData.Tag}, nil
+
+	case e.EventData != nil:
+		if e.Type != "PUSH_ARTIFACT" && e.Type != "pushImage" {
+			return nil, errors.New("unsupported harbor event type: " + e.Type)
+		}
+		var images []string
+		for _, res := range e.EventData.Resources {
+			if res.ResourceURL != "" {
+				images = append(images, res.ResourceURL)
+			}
+		}
+		if len(images) == 0 {
+			return nil, errors.New("harbor payload contains no resources")
+		}
+		return images, nil
+
+	case e.Package != nil:
+		if e.Package.PackageType != "" && !strings.EqualFold(e.Package.PackageType, "container") {
+			return nil, errors.New("unsupported package type: " + e.Package.PackageType)
+		}
+		v := e.Package.PackageVersion
+		if v == nil {
+			return nil, errors.New("github payload is missing package_version")
+		}
+		if v.PackageURL != "" {
+			return []string{v.PackageURL}, nil
+		}
+		if v.ContainerMetadata == nil || v.ContainerMetadata.Tag.Name == "" {
+			return nil, errors.New("github payload is missing the container tag")
+		}
+		return []string{"ghcr.io/" + strings.ToLower(e.Package.Owner.Login) + "/" + e.Package.Name + ":" + v.ContainerMetadata.Tag.Name}, nil
+	}
+	return nil, errors.New("unrecognized registry webhook payload")
+}
+
+// verifyWebhookSecret checks the shared secret in the way each registry can
+// send it: a GitHub HMAC signature, an Authorization header (Harbor), or a
+// token query parameter (Docker Hub). An empty secret disables verification.
+func verifyWebhookSecret(r *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return true
+	}
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(sig), []byte(expected))
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		auth = strings.TrimPrefix(auth, "Bearer ")
+		return subtle.ConstantTimeCompare([]byte(auth), []byte(secret)) == 1
+	}
+	token := r.URL.Query().Get("token")
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// normalizeImageRef expands an image reference to registry/repository:tag so
+// that "nginx", "docker.io/library/nginx:latest", and
+// "index.docker.io/library/nginx" compare equal. Any digest is dropped.
+func normalizeImageRef(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+
+	name, tag := ref, "latest"
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, tag = ref[:i], ref[i+1:]
+	}
+
+	registry, repo := "docker.io", name
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			registry, repo = first, name[i+1:]
+		}
+	}
+	if registry == "index.docker.io" || registry == "registry-1.docker.io" {
+		registry = "docker.io"
+	}
+	if registry == "docker.io" && !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return strings.ToLower(registry+"/"+repo) + ":" + tag
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// JanitorPolicy controls when agents that stopped sending heartbeats are
+// flagged stale and what happens to the deployments they leave orphaned.
+type JanitorPolicy struct {
+	Interval   time.Duration
+	StaleAfter time.Duration // Silence after which an agent is flagged stale
+	// Orphans is "alert" to leave orphaned deployments where they are for
+	// deployment_orphaned alert rules to report, or "reschedule" to move
+	// those deployed by agent selector to another healthy matching agent.
+	Orphans string
+}
+
+// JanitorPolicyFromEnv reads the janitor policy from the JANITOR_INTERVAL
+// (1m), AGENT_STALE_AFTER (10m), and ORPHANED_DEPLOYMENTS (alert)
+// environment variables.
+func JanitorPolicyFromEnv() (JanitorPolicy, error) {
+	p := JanitorPolicy{Interval: time.Minute, StaleAfter: 10 * time.Minute, Orphans: "alert"}
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{{"JANITOR_INTERVAL", &p.Interval}, {"AGENT_STALE_AFTER", &p.StaleAfter}} {
+		if v := os.Getenv(setting.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return p, fmt.Errorf("invalid %s %q: must be a positive duration", setting.name, v)
+			}
+			*setting.value = d
+		}
+	}
+	if v := os.Getenv("ORPHANED_DEPLOYMENTS"); v != "" {
+		if v != "alert" && v != "reschedule" {
+			return p, fmt.Errorf("invalid ORPHANED_DEPLOYMENTS %q: must be alert or reschedule", v)
+		}
+		p.Orphans = v
+	}
+	return p, nil
+}
+
+// RunJanitor flags stale agents and handles their orphaned deployments on
+// every interval. It never returns.
+func (s *DeploymentStore) RunJanitor(agents *AgentStore, p JanitorPolicy) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.Sweep(agents, p, now.UTC())
+	}
+}
+
+// Sweep flags the agents that have been silent for longer than the policy
+// allows as stale and marks their active deployments orphaned. Deployments
+// whose agent came back are no longer orphaned. Deployments made by agent
+// selector are then replaced by one on the healthy matching agent with the
+// fewest active deployments that does not run their image already: those
+// with a reschedule_after once their agent has been unreachable that long,
+// and, if the policy reschedules orphans, the other orphaned ones.
+func (s *DeploymentStore) Sweep(agents *AgentStore, p JanitorPolicy, now time.Time) {
+	stale := agents.flagStale(p.StaleAfter, now)
+	orphaned, reclaimed := s.markOrphans(stale, now)
+	if len(orphaned)+reclaimed > 0 {
+		log.Printf("Janitor: %d stale agents, %d deployments newly orphaned, %d reclaimed", len(stale), len(orphaned), reclaimed)
+	}
+	moves := s.unreachable(agents.lastSeen(), now)
+	if p.Orphans == "reschedule" {
+		for _, id := range s.orphans() {
+			if _, own := moves[id]; !own {
+				moves[id] = "its agent went stale"
+			}
+		}
+	}
+	if len(moves) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(moves))
+	for id := range moves {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	healthy := agents.healthy()
+	for _, id := range ids {
+		dep, exists := s.Get(id)
+		if !exists || !reschedulable(dep) {
+			continue
+		}
+		target := s.rescheduleTarget(dep, healthy)
+		if target == "" {
+			s.noteOnce(id, "not_rescheduled", fmt.Sprintf("No healthy agent matching agent_selector %s is free to take over", formatSelector(dep.AgentSelector)))
+			continue
+		}
+		replacement, err := s.Reschedule(id, target, moves[id])
+		if err != nil {
+			log.Printf("Janitor: could not reschedule deployment %s to agent %s: %v", id, target, err)
+			s.noteOnce(id, "not_rescheduled", fmt.Sprintf("Could not reschedule to agent %s: %v", target, err))
+			continue
+		}
+		log.Printf("Janitor: rescheduled deployment %s from agent %s to agent %s as %s because %s", id, dep.AgentID, target, replacement.ID, moves[id])
+	}
+}
+
+// flagStale flags the agents that have not sent a heartbeat for longer than
+// staleAfter, and returns the IDs of all stale agents. Agents in
+// maintenance are expected to go silent and are not flagged.
+func (s *AgentStore) flagStale(staleAfter time.Duration, now time.Time) map[string]bool {
+	s.Lock()
+	defer s.Unlock()
+	stale := make(map[string]bool)
+	for _, agent := range s.agents {
+		if agent.ArchivedAt != nil || agent.Maintenance != nil || now.Sub(agent.LastSeen) <= staleAfter {
+			continue
+		}
+		if agent.StaleSince == nil {
+			staleSince := now
+			agent.StaleSince = &staleSince
+			s.revision++
+			s.recordEvent(agent, "stale")
+			log.Printf("Agent %s has been silent since %s and is stale", agent.ID, agent.LastSeen.Format(time.RFC3339))
+		}
+		stale[agent.ID] = true
+	}
+	return stale
+}
+
+// lastSeen returns when each agent that is neither archived nor in
+// maintenance last sent a heartbeat, by ID.
+func (s *AgentStore) lastSeen() map[string]time.Time {
+	s.Lock()
+	defer s.Unlock()
+	seen := make(map[string]time.Time)
+	for id, agent := range s.agents {
+		if agent.ArchivedAt == nil && agent.Maintenance == nil {
+			seen[id] = agent.LastSeen
+		}
+	}
+	return seen
+}
+
+// healthy returns copies of the agents deployments can be rescheduled to:
+// those that are online, not stale, and not in maintenance, by ID.
+func (s *AgentStore) healthy() map[string]*Agent {
+	s.Lock()
+	defer s.Unlock()
+	s.refreshStatus()
+	healthy := make(map[string]*Agent)
+	for id, agent := range s.agents {
+		if agent.ArchivedAt == nil && agent.Status == "online" && agent.StaleSince == nil && agent.Maintenance == nil {
+			healthy[id] = cloneAgent(agent)
+		}
+	}
+	return healthy
+}
+
+// markOrphans marks the active deployments of stale agents orphaned and
+// clears the mark of those whose agent is no longer stale. It returns the
+// IDs of the deployments it orphaned and how many it reclaimed.
+func (s *DeploymentStore) markOrphans(stale map[string]bool, now time.Time) (orphaned map[string]bool, reclaimed int) {
+	s.Lock()
+	defer s.Unlock()
+	orphaned = make(map[string]bool)
+	for _, dep := range s.deployments {
+		if dep.ArchivedAt != nil || retired(dep.Status) {
+			continue
+		}
+		switch {
+		case stale[dep.AgentID] && dep.OrphanedAt == nil:
+			orphanedAt := now
+			dep.OrphanedAt = &orphanedAt
+			s.recordEvent(dep.ID, "orphaned", fmt.Sprintf("Agent %s went stale", dep.AgentID))
+			orphaned[dep.ID] = true
+		case !stale[dep.AgentID] && dep.OrphanedAt != nil:
+			dep.OrphanedAt = nil
+			s.recordEvent(dep.ID, "reclaimed", fmt.Sprintf("Agent %s is back", dep.AgentID))
+			reclaimed++
+		}
+	}
+	return orphaned, reclaimed
+}
+
+// unreachable returns the active deployments with a reschedule_after whose
+// agent has not been seen for longer than it, with why they are moved.
+func (s *DeploymentStore) unreachable(lastSeen map[string]time.Time, now time.Time) map[string]string {
+	s.Lock()
+	defer s.Unlock()
+	moves := make(map[string]string)
+	for _, dep := range s.deployments {
+		if dep.RescheduleAfter == "" || dep.ArchivedAt != nil || retired(dep.Status) {
+			continue
+		}
+		seen, tracked := lastSeen[dep.AgentID]
+		grace, err := time.ParseDuration(dep.RescheduleAfter)
+		if tracked && err == nil && now.Sub(seen) > grace {
+			moves[dep.ID] = fmt.Sprintf("its agent was unreachable for more than %s", dep.RescheduleAfter)
+		}
+	}
+	return moves
+}
+
+// orphans returns the IDs of the active orphaned deployments without a
+// reschedule_after of their own.
+func (s *DeploymentStore) orphans() []string {
+	s.Lock()
+	defer s.Unlock()
+	var ids []string
+	for _, dep := range s.deployments {
+		if dep.OrphanedAt != nil && dep.RescheduleAfter == "" && dep.ArchivedAt == nil && !retired(dep.Status) {
+			ids = append(ids, dep.ID)
+		}
+	}
+	return ids
+}
+
+// noteOnce records an event on a deployment unless it is the deployment's
+// latest one already, so that a retry on every run does not flood its
+// timeline.
+func (s *DeploymentStore) noteOnce(id, eventType, message string) {
+	s.Lock()
+	defer s.Unlock()
+	if events := s.events[id]; len(events) > 0 && events[len(events)-1].Type == eventType && events[len(events)-1].Message == message {
+		return
+	}
+	s.recordEvent(id, eventType, message)
+}
+
+// validateRescheduleAfter checks a request's reschedule_after, which only
+// deployments made by agent selector may have.
+func validateRescheduleAfter(req *DeploymentRequest) error {
+	if req.RescheduleAfter == "" {
+		return nil
+	}
+	if len(req.AgentSelector) == 0 {
+		return errors.New("reschedule_after requires agent_selector, which names the agents the deployment may move to")
+	}
+	if d, err := time.ParseDuration(req.RescheduleAfter); err != nil || d <= 0 {
+		return fmt.Errorf("invalid reschedule_after %q: must be a positive duration such as 15m", req.RescheduleAfter)
+	}
+	return nil
+}
+
+// reschedulable reports whether the janitor may move a deployment to
+// another agent: it was made by agent selector, so any matching agent can
+// run it, and nothing else manages where it runs.
+func reschedulable(dep *Deployment) bool {
+	return len(dep.AgentSelector) > 0 && dep.Application == "" && dep.AddonOf == "" && dep.Hook == "" &&
+		dep.GitSpec == "" && dep.KubernetesObject == "" && dep.Fleet == ""
+}
+
+// rescheduleTarget picks the healthy agent matching a deployment's selector
+// with the fewest active deployments that does not already run its image,
+// or returns "" if there is none.
+func (s *DeploymentStore) rescheduleTarget(dep *Deployment, healthy map[string]*Agent) string {
+	s.Lock()
+	defer s.Unlock()
+	target, fewest := "", 0
+	for id, agent := range healthy {
+		if id == dep.AgentID || !matchesSelector(agent.Labels, dep.AgentSelector) {
+			continue
+		}
+		active, runsImage := 0, false
+		for _, other := range s.byAgent[id] {
+			if other.ArchivedAt != nil || retired(other.Status) {
+				continue
+			}
+			active++
+			if other.ImageURL == dep.ImageURL {
+				runsImage = true
+			}
+		}
+		if runsImage {
+			continue
+		}
+		if target == "" || active < fewest || active == fewest && id < target {
+			target, fewest = id, active
+		}
+	}
+	return target
+}
+
+// Reschedule replaces a deployment made by agent selector with one of the
+// same workload on another agent, and supersedes it, recording why in both
+// timelines. It returns a *FreezeError while either agent is frozen.
+func (s *DeploymentStore) Reschedule(id, agentID, why string) (*Deployment, error) {
+	s.Lock()
+	defer s.Unlock()
+	old, exists := s.deployments[id]
+	if !exists || retired(old.Status) || !reschedulable(old) {
+		return nil, fmt.Errorf("deployment %s cannot be rescheduled", id)
+	}
+	for _, agent := range []string{old.AgentID, agentID} {
+		if f := s.frozen(old.Project, agent); f != nil {
+			return nil, &FreezeError{Freeze: *f}
+		}
+	}
+	dep, err := s.create(DeploymentRequest{
+		DeploymentRequest: types.DeploymentRequest{
+			AgentID:         agentID,
+			AgentSelector:   old.AgentSelector,
+			ImageURL:        old.ImageURL,
+			Bundle:          old.Bundle,
+			AutoUpdate:      old.AutoUpdate,
+			Project:         old.Project,
+			Resources:       old.Resources,
+			Volumes:         old.Volumes,
+			Artifacts:       old.Artifacts,
+			Configs:         old.Configs,
+			Secrets:         old.Secrets,
+			Channel:         old.Channel,
+			ChannelStrategy: old.ChannelStrategy,
+			UpdatePolicy:    old.UpdatePolicy,
+			SLO:             old.SLO,
+			Sandbox:         old.Sandbox,
+			ModelServing:    old.ModelServing,
+			RescheduleAfter: old.RescheduleAfter,
+		},
+		AdoptedFrom: old.AdoptedFrom,
+		args:        old.Args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(dep.ID, "rescheduled", fmt.Sprintf("Rescheduled from deployment %s on agent %s because %s", old.ID, old.AgentID, why))
+	s.setStatus(old, types.StatusSuperseded)
+	old.Reason = fmt.Sprintf("Rescheduled to agent %s as %s because %s", agentID, dep.ID, why)
+	s.recordEvent(old.ID, "superseded", old.Reason)
+	s.admitQueued()
+	return cloneDeployment(dep), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// TestAgentCopies picks reschedule targets and reads agents while their
+// labels change, as the janitor and the API handlers do; run it with -race.
+func TestAgentCopies(t *testing.T) {
+	agents := NewAgentStore()
+	store := NewDeploymentStore(NewQuotaStore(), agents, NewFreezeStore())
+	from := agents.Register("a:1", "", nil, map[string]string{"site": "a"}, nil)
+	to := agents.Register("b:1", "", nil, map[string]string{"site": "b"}, nil)
+	dep := &Deployment{AgentID: from.ID, AgentSelector: map[string]string{"site": "b"}}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			agents.SetLabels(to.ID, map[string]string{"site": "b", "rack": string(rune('a' + i%26))})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			if target := store.rescheduleTarget(dep, agents.healthy()); target != to.ID {
+				t.Errorf("reschedule target = %q, want %s", target, to.ID)
+				return
+			}
+			got, _ := agents.Get(to.ID)
+			if _, err := json.Marshal(got); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := json.Marshal(agents.List(false)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	got, _ := agents.Get(to.ID)
+	got.Labels["site"] = "c"
+	got.Status = "offline"
+	if again, _ := agents.Get(to.ID); again.Labels["site"] != "b" || again.Status != "online" {
+		t.Error("changing a copy Get returned changed the stored agent")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// lifecycleEventSchemaVersion is bumped on incompatible changes to LifecycleEvent.
+	lifecycleEventSchemaVersion = 1
+	defaultKafkaTopic           = "edge-lifecycle-events"
+	// kafkaBufferSize is how many events are held while the proxy is
+	// unreachable; further events are dropped.
+	kafkaBufferSize    = 10000
+	kafkaMaxBatch      = 500
+	kafkaFlushInterval = time.Second
+	kafkaMaxRetryDelay = 30 * time.Second
+)
+
+// LifecycleEvent is the record exported to Kafka for every deployment event
+// and agent state change. Fields are only added in later schema versions;
+// consumers should ignore fields they do not know.
+type LifecycleEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"` // Unique; consumers deduplicate on it since delivery is at least once
+	Time          time.Time `json:"time"`
+	Kind          string    `json:"kind"` // "deployment" or "agent"
+	Type          string    `json:"type"` // The deployment event type, or registered, online, offline, stale, archived
+	AgentID       string    `json:"agent_id"`
+	DeploymentID  string    `json:"deployment_id,omitempty"`
+	Revision      int       `json:"revision,omitempty"`
+	Status        string    `json:"status,omitempty"` // Deployment or agent status when the event was recorded
+	ImageURL      string    `json:"image_url,omitempty"`
+	Project       string    `json:"project,omitempty"`
+	Application   string    `json:"application,omitempty"`
+	Address       string    `json:"address,omitempty"` // Agent address, for agent events
+	Message       string    `json:"message,omitempty"`
+}
+
+// deploymentLifecycleEvent describes an event in a deployment's timeline.
+func deploymentLifecycleEvent(dep *Deployment, ev DeploymentEvent) LifecycleEvent {
+	return LifecycleEvent{
+		SchemaVersion: lifecycleEventSchemaVersion,
+		ID:            uuid.New().String(),
+		Time:          ev.Time,
+		Kind:          "deployment",
+		Type:          ev.Type,
+		AgentID:       dep.AgentID,
+		DeploymentID:  dep.ID,
+		Revision:      dep.Revision,
+		Status:        string(dep.Status),
+		ImageURL:      dep.ImageURL,
+		Project:       dep.Project,
+		Application:   dep.Application,
+		Message:       ev.Message,
+	}
+}
+
+// agentLifecycleEvent describes a change of an agent's state.
+func agentLifecycleEvent(agent *Agent, eventType string) LifecycleEvent {
+	return LifecycleEvent{
+		SchemaVersion: lifecycleEventSchemaVersion,
+		ID:            uuid.New().String(),
+		Time:          time.Now().UTC(),
+		Kind:          "agent",
+		Type:          eventType,
+		AgentID:       agent.ID,
+		Status:        agent.Status,
+		Address:       agent.Address,
+	}
+}
+
+// KafkaExporter publishes lifecycle events to a Kafka topic through a Kafka
+// REST Proxy (the Confluent v2 API, also served by Redpanda's HTTP Proxy), so
+// the control center needs no Kafka client. Records are keyed by agent ID,
+// which keeps each agent's events in order within a partition.
+type KafkaExporter struct {
+	endpoint   string // URL of the topic on the proxy
+	username   string
+	password   string
+	httpClient *http.Client
+	events     chan LifecycleEvent
+}
+
+// NewKafkaExporterFromEnv configures the exporter from the KAFKA_REST_URL
+// (e.g. http://kafka-rest:8082), KAFKA_TOPIC ("edge-lifecycle-events"),
+// KAFKA_REST_USERNAME, and KAFKA_REST_PASSWORD environment variables. It
+// returns nil if no proxy is set.
+func NewKafkaExporterFromEnv() (*KafkaExporter, error) {
+	proxy := os.Getenv("KAFKA_REST_URL")
+	if proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid KAFKA_REST_URL %q: must be an http or https URL", proxy)
+	}
+	topic := os.Getenv("KAFKA_TOPIC")
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	if strings.ContainsAny(topic, "/?#") {
+		return nil, fmt.Errorf("invalid KAFKA_TOPIC %q", topic)
+	}
+	return &KafkaExporter{
+		endpoint:   strings.TrimSuffix(proxy, "/") + "/topics/" + topic,
+		username:   os.Getenv("KAFKA_REST_USERNAME"),
+		password:   os.Getenv("KAFKA_REST_PASSWORD"),
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		events:     make(chan LifecycleEvent, kafkaBufferSize),
+	}, nil
+}
+
+// Publish queues an event for export. It never blocks, so stores can call it
+// with their lock held; if the buffer is full, the event is dropped.
+func (e *KafkaExporter) Publish(ev LifecycleEvent) {
+	select {
+	case e.events <- ev:
+	default:
+		log.Printf("Kafka export: buffer full, dropping %s event %s", ev.Kind, ev.ID)
+	}
+}
+
+// Run sends queued events to the proxy in batches, retrying failed batches
+// with exponential backoff so that events are not lost while Kafka is down.
+// It never returns.
+func (e *KafkaExporter) Run() {
+	log.Printf("Kafka export: publishing lifecycle events to %s", e.endpoint)
+	var batch []LifecycleEvent
+	ticker := time.NewTicker(kafkaFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev := <-e.events:
+			batch = append(batch, ev)
+			if len(batch) < kafkaMaxBatch {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		delay := time.Second
+		for {
+			err := e.send(batch)
+			if err == nil {
+				break
+			}
+			log.Printf("Kafka export: could not publish %d events, retrying in %s: %v", len(batch), delay, err)
+			time.Sleep(delay)
+			delay = min(2*delay, kafkaMaxRetryDelay)
+		}
+		batch = batch[:0]
+	}
+}
+
+// kafkaRecords is the request body of the REST Proxy's produce endpoint.
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string         `json:"key"`
+	Value LifecycleEvent `json:"value"`
+}
+
+// kafkaOffsets is the response of the produce endpoint. Records that could
+// not be produced have an error.
+type kafkaOffsets struct {
+	Offsets []struct {
+		Error string `json:"error"`
+	} `json:"offsets"`
+}
+
+// send produces a batch of events with one request.
+func (e *KafkaExporter) send(batch []LifecycleEvent) error {
+	body := kafkaRecords{Records: make([]kafkaRecord, len(batch))}
+	for i, ev := range batch {
+		body.Records[i] = kafkaRecord{Key: ev.AgentID, Value: ev}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("proxy returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	// The whole batch is retried if any record failed; consumers drop the
+	// duplicates by event ID.
+	var offsets kafkaOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return fmt.Errorf("invalid proxy response: %w", err)
+	}
+	for _, o := range offsets.Offsets {
+		if o.Error != "" {
+			return fmt.Errorf("record not produced: %s", o.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// labelKeyPattern matches label keys: a name, optionally prefixed with a
+	// DNS subdomain, e.g. site or example.com/site.
+	labelKeyPattern = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]*[a-z0-9])?/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	// labelValuePattern matches label values, which may be empty.
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+)
+
+// maxLabelLength caps label names and values.
+const maxLabelLength = 63
+
+// validateLabels checks the keys and values of agent labels or a selector.
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		name := key[strings.LastIndex(key, "/")+1:]
+		if !labelKeyPattern.MatchString(key) || len(name) > maxLabelLength {
+			return fmt.Errorf("invalid label key %q: must be a name of up to %d letters, digits, '-', '_', or '.', optionally prefixed with a DNS subdomain and '/'", key, maxLabelLength)
+		}
+		if !labelValuePattern.MatchString(value) || len(value) > maxLabelLength {
+			return fmt.Errorf("invalid value %q of label %s: must be up to %d letters, digits, '-', '_', or '.'", value, key, maxLabelLength)
+		}
+	}
+	return nil
+}
+
+// matchesSelector reports whether labels have every label of a selector.
+func matchesSelector(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if v, exists := labels[key]; !exists || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSelector parses a selector written as comma-separated key=value
+// pairs, e.g. arch=arm64,site=store-104.
+func parseSelector(s string) (map[string]string, error) {
+	selector := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid selector %q: expected comma-separated key=value pairs", s)
+		}
+		selector[key] = value
+	}
+	return selector, validateLabels(selector)
+}
+
+// formatSelector writes a selector the way parseSelector reads it, with its
+// keys sorted.
+func formatSelector(selector map[string]string) string {
+	pairs := make([]string, 0, len(selector))
+	for key, value := range selector {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// SetLabels replaces the labels an agent advertises. Those of the bootstrap
+// token it registered with still override them.
+func (s *AgentStore) SetLabels(id string, labels map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		agent.Labels = mergeLabels(labels, agent.BootstrapLabels)
+		s.revision++
+	}
+}
+
+// Select returns the IDs of the agents that are not archived and whose labels
+// match a selector, sorted.
+func (s *AgentStore) Select(selector map[string]string) []string {
+	s.Lock()
+	defer s.Unlock()
+	var ids []string
+	for id, agent := range s.agents {
+		if agent.ArchivedAt == nil && matchesSelector(agent.Labels, selector) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// handleDeployToSelector creates a deployment on every agent whose labels
+// match a request's agent_selector, validating each like a single request,
+// and answers with the outcome per agent.
+func (s *Server) handleDeployToSelector(w http.ResponseWriter, r *http.Request, req DeploymentRequest) {
+	if err := validateLabels(req.AgentSelector); err != nil {
+		http.Error(w, "Invalid agent_selector: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		http.Error(w, "dry_run needs an agent_id; list the agents a selector matches with GET "+apiV1+"/agents?selector=...", http.StatusBadRequest)
+		return
+	}
+	agentIDs := s.agents.Select(req.AgentSelector)
+	if len(agentIDs) == 0 {
+		http.Error(w, fmt.Sprintf("No agent matches agent_selector %s", formatSelector(req.AgentSelector)), http.StatusConflict)
+		return
+	}
+	resp := s.deployToAgents(r, req, agentIDs)
+	logf(r.Context(), "Selector %s: %d deployments created, %d failed", formatSelector(req.AgentSelector), resp.Succeeded, resp.Failed)
+	json.NewEncoder(w).Encode(resp)
+}
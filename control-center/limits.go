@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxBodySize caps request bodies unless a route allows more. The
+	// largest ones this server takes are cluster operations that apply many
+	// Kubernetes objects, requests proxied to an agent's cluster API, where
+	// a single CRD can exceed a megabyte, and batches of up to
+	// types.MaxBatchSize deployment requests.
+	defaultMaxBodySize = 16 << 20
+	// bucketIdleTTL is how long an unused client bucket is kept.
+	bucketIdleTTL = 10 * time.Minute
+)
+
+// bodyLimits lists routes that accept larger bodies than MAX_REQUEST_BODY_SIZE.
+var bodyLimits = map[string]int64{
+	apiV1 + "/admin/restore": maxBackupSize,
+}
+
+// Limits protects the API from clients that send too many or too large
+// requests, such as a CI job stuck in a loop.
+type Limits struct {
+	Rate        float64 // Requests per second allowed per client; 0 disables rate limiting
+	Burst       int     // Requests a client may send at once before being limited
+	MaxBodySize int64   // Largest request body accepted, in bytes
+}
+
+// LimitsFromEnv reads API limits from the API_RATE_LIMIT (20 requests per
+// second per client, 0 to disable), API_RATE_BURST (40), and
+// MAX_REQUEST_BODY_SIZE (16 MiB, in bytes) environment variables.
+func LimitsFromEnv() (Limits, error) {
+	l := Limits{Rate: 20, Burst: 40, MaxBodySize: defaultMaxBodySize}
+	if v := os.Getenv("API_RATE_LIMIT"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || math.IsInf(rate, 0) {
+			return l, fmt.Errorf("invalid API_RATE_LIMIT %q: must be a non-negative number of requests per second", v)
+		}
+		l.Rate = rate
+	}
+	if v := os.Getenv("API_RATE_BURST"); v != "" {
+		burst, err := strconv.Atoi(v)
+		if err != nil || burst < 1 {
+			return l, fmt.Errorf("invalid API_RATE_BURST %q: must be a positive integer", v)
+		}
+		l.Burst = burst
+	}
+	if v := os.Getenv("MAX_REQUEST_BODY_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size < 1 {
+			return l, fmt.Errorf("invalid MAX_REQUEST_BODY_SIZE %q: must be a positive number of bytes", v)
+		}
+		l.MaxBodySize = size
+	}
+	return l, nil
+}
+
+// limitBody rejects request bodies larger than the route allows, with 413.
+// Bodies without a Content-Length are cut off at the limit, and handlers
+// report the error with invalidBody.
+func (l Limits) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		max := l.MaxBodySize
+		if routeMax, ok := bodyLimits[r.URL.Path]; ok && routeMax > max {
+			max = routeMax
+		}
+		if r.ContentLength > max {
+			http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", max), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// invalidBody responds to a request body that could not be decoded, with 413
+// if it was too large and 400 otherwise.
+func invalidBody(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, msg, http.StatusBadRequest)
+}
+
+// rateLimiter keeps a token bucket for each client address.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimit rejects requests from clients that exceed the rate limit with 429
+// and a Retry-After header. Requests over the Unix socket are local and have
+// no address to tell clients apart by, so they are not limited.
+func (l Limits) rateLimit(next http.Handler) http.Handler {
+	if l.Rate == 0 {
+		return next
+	}
+	rl := &rateLimiter{rate: l.Rate, burst: float64(l.Burst), buckets: make(map[string]*bucket)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fromUnixSocket(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := rl.allow(clientAddr(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Rate limit exceeded; retry later", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from the client's bucket. If none is left, it reports
+// how long until one is.
+func (rl *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if now.Sub(rl.lastSweep) > bucketIdleTTL {
+		for c, b := range rl.buckets {
+			if now.Sub(b.last) > bucketIdleTTL {
+				delete(rl.buckets, c)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, exists := rl.buckets[client]
+	if !exists {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientAddr identifies the client that sent a request by its IP address.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
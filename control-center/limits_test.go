@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	type step struct {
+		client   string
+		at       time.Duration // Since the first request
+		want     bool
+		wantWait time.Duration // Until the next token, if refused
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"burst", []step{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+			{"a", 0, false, 500 * time.Millisecond},
+		}},
+		{"refill", []step{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+			{"a", 250 * time.Millisecond, false, 250 * time.Millisecond},
+			{"a", 500 * time.Millisecond, true, 0},
+			{"a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+		}},
+		{"refill capped at burst", []step{
+			{"a", 0, true, 0},
+			{"a", time.Hour, true, 0},
+			{"a", time.Hour, true, 0},
+			{"a", time.Hour, false, 500 * time.Millisecond},
+		}},
+		{"clients apart", []step{
+			{"a", 0, true, 0},
+			{"a", 0, true, 0},
+			{"a", 0, false, 500 * time.Millisecond},
+			{"b", 0, true, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := &rateLimiter{rate: 2, burst: 2, buckets: make(map[string]*bucket)}
+			start := time.Now()
+			for i, s := range tt.steps {
+				ok, wait := rl.allow(s.client, start.Add(s.at))
+				if ok != s.want || wait != s.wantWait {
+					t.Errorf("request %d: allowed %v, wait %s; want %v, %s", i+1, ok, wait, s.want, s.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := Limits{Rate: 1, Burst: 1}.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/agents", nil))
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+		if retry := w.Header().Get("Retry-After"); (retry != "") != (want == http.StatusTooManyRequests) || (retry != "" && retry != "1") {
+			t.Errorf("request %d: Retry-After = %q", i+1, retry)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultAPIAddr is where the API listens unless API_ADDR says otherwise.
+	defaultAPIAddr = ":8080"
+	// defaultSocketMode lets the control center's user and group use its
+	// Unix socket.
+	defaultSocketMode = 0o660
+	// listenFDsStart is the first file descriptor systemd passes.
+	listenFDsStart = 3
+)
+
+// Names of systemd sockets, as set with FileDescriptorName=, that are not
+// the API's. Sockets with any other name serve the API.
+const (
+	agentStreamSocketName = "agent-stream"
+	adminSocketName       = "admin"
+)
+
+// Listeners holds the sockets the control center serves on, by what it
+// serves on them.
+type Listeners struct {
+	api         []net.Listener
+	agentStream []net.Listener // Sockets systemd passed for the agent stream
+	admin       []net.Listener // Sockets systemd passed for the admin server
+}
+
+// ListenersFromEnv opens the API's listeners: TCP on API_ADDR (default
+// ":8080", or "none"), and a Unix socket at API_SOCKET, if set, with the
+// permissions in API_SOCKET_MODE (default "0660"). Sockets systemd passed by
+// socket activation are used as well, and replace the default TCP listener
+// unless API_ADDR is set.
+func ListenersFromEnv() (*Listeners, error) {
+	l, err := activatedListeners()
+	if err != nil {
+		return nil, err
+	}
+	addr, explicit := os.LookupEnv("API_ADDR")
+	if addr == "" {
+		addr, explicit = defaultAPIAddr, false
+	}
+	if addr != "none" && (explicit || len(l.api) == 0) {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		l.api = append(l.api, lis)
+	}
+	if path := os.Getenv("API_SOCKET"); path != "" {
+		mode := fs.FileMode(defaultSocketMode)
+		if v := os.Getenv("API_SOCKET_MODE"); v != "" {
+			m, err := strconv.ParseUint(v, 8, 32)
+			if err != nil || m > 0o777 {
+				return nil, fmt.Errorf("invalid API_SOCKET_MODE %q: must be octal permissions such as 0660", v)
+			}
+			mode = fs.FileMode(m)
+		}
+		lis, err := listenUnix(path, mode)
+		if err != nil {
+			return nil, err
+		}
+		l.api = append(l.api, lis)
+	}
+	if len(l.api) == 0 {
+		return nil, fmt.Errorf("API_ADDR is none, but neither API_SOCKET nor socket activation gives the API a listener")
+	}
+	return l, nil
+}
+
+// listenUnix listens on a Unix socket at path with the given permissions,
+// replacing a socket left behind by an earlier run.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("API_SOCKET %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// activatedListeners returns the sockets systemd passed to this process by
+// socket activation, grouped by their names in LISTEN_FDNAMES. The LISTEN_*
+// variables are cleared so that commands the control center runs do not
+// take the sockets for theirs.
+func activatedListeners() (*Listeners, error) {
+	l := &Listeners{}
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != strconv.Itoa(os.Getpid()) {
+		return l, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		// FileListener works on a duplicate, which commands the control
+		// center runs do not inherit, so the original is closed.
+		f := os.NewFile(uintptr(fd), name)
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %d (%q) from systemd is not a listening socket: %w", fd, name, err)
+		}
+		switch name {
+		case agentStreamSocketName:
+			l.agentStream = append(l.agentStream, lis)
+		case adminSocketName:
+			l.admin = append(l.admin, lis)
+		default:
+			l.api = append(l.api, lis)
+		}
+	}
+	return l, nil
+}
+
+// ServeAPI serves h on every API listener. It returns when one of them
+// fails.
+func (l *Listeners) ServeAPI(h http.Handler) error {
+	errs := make(chan error, len(l.api))
+	for _, lis := range l.api {
+		log.Printf("Control Center API server starting on %s", describeListener(lis))
+		go func() { errs <- http.Serve(lis, h) }()
+	}
+	return <-errs
+}
+
+// describeListener renders a listener's address for logs, e.g. "[::]:8080"
+// or "unix:/run/control-center/api.sock".
+func describeListener(lis net.Listener) string {
+	if addr := lis.Addr(); addr.Network() != "tcp" {
+		return addr.Network() + ":" + addr.String()
+	}
+	return lis.Addr().String()
+}
+
+// fromUnixSocket reports whether a request came in over a Unix socket.
+func fromUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
@@ -1,101 +1,765 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/sha256"
 	"log"
-	"net/http"
-//	"strings"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"fmt"
-//	"strings"
 
+	"edge-orchestration/api/types"
 	"github.com/google/uuid"
 )
 
-// Deployment represents a workload to be deployed on an agent.
-type Deployment struct {
-	ID        string    `json:"id"`
-	AgentID   string    `json:"agent_id"`
-	ImageURL  string    `json:"image_url"`
-	Status    string    `json:"status"` // e.g., "pending", "running", "failed"
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// DeploymentRequest is the body for a POST /deployments request.
-type DeploymentRequest struct {
-	AgentID  string `json:"agent_id"`
-	ImageURL string `json:"image_url"`
-}
-
 // DeploymentStore manages the collection of deployments.
 type DeploymentStore struct {
 	sync.Mutex
 	deployments map[string]*Deployment
 	byAgent     map[string][]*Deployment // Index for quick lookup by agent
+	events      map[string][]DeploymentEvent
+	onPending   func(id, agentID string, revision int, imageURL string) // Called for every new pending revision
+	held        []*Deployment                                           // Pending revisions not yet handed to onPending; nil unless holding
+	quotas      *QuotaStore
+	agents      *AgentStore                       // Consulted for agents in maintenance and their time zones
+	freezes     *FreezeStore                      // Consulted before changing deployments on the control center's own
+	watchers    map[string]map[chan struct{}]bool // Agent ID to channels signalled when its deployments change
+	revisions   map[string]int                    // Agent ID to a counter bumped when its deployments change, for the list's ETag
+	onEvent     func(LifecycleEvent)              // Called for every recorded event, e.g. to export it
+
+	refRollouts map[string]*refRollout // Latest rollout of every changed config and rotated secret, by kind and name
+
+	rejectGPUShortage bool // Reject rather than queue requests for more GPUs than their agent has free
 }
 
 // NewDeploymentStore creates a new in-memory deployment store.
-func NewDeploymentStore() *DeploymentStore {
+func NewDeploymentStore(quotas *QuotaStore, agents *AgentStore, freezes *FreezeStore) *DeploymentStore {
 	return &DeploymentStore{
 		deployments: make(map[string]*Deployment),
 		byAgent:     make(map[string][]*Deployment),
+		events:      make(map[string][]DeploymentEvent),
+		quotas:      quotas,
+		agents:      agents,
+		freezes:     freezes,
+		watchers:    make(map[string]map[chan struct{}]bool),
+		revisions:   make(map[string]int),
+
+		refRollouts: make(map[string]*refRollout),
 	}
 }
 
-// Create creates a new deployment and stores it.
-func (s *DeploymentStore) Create(agentID, imageURL string) *Deployment {
+// Create creates a new deployment and stores it. It returns a
+// *QuotaExceededError if the request exceeds a quota that rejects excess
+// deployments, and a *MaintenanceError if its agent is in maintenance and
+// rejects new deployments; requests exceeding queueing quotas or for agents
+// in maintenance that queue them are stored as "queued", and requests
+// scheduled for later as "deferred".
+func (s *DeploymentStore) Create(req DeploymentRequest) (*Deployment, error) {
 	s.Lock()
 	defer s.Unlock()
+	create := s.create
+	if len(req.Addons) > 0 {
+		create = s.createWithAddons
+	}
+	dep, err := create(req)
+	if err != nil {
+		return nil, err
+	}
+	return cloneDeployment(dep), nil
+}
 
-	dep := &Deployment{
-		ID:        fmt.Sprintf("dep-%s", uuid.New().String()[:8]),
-		AgentID:   agentID,
-		ImageURL:  imageURL,
-		Status:    "pending",
-		CreatedAt: time.Now().UTC(),
+// create creates and stores a new deployment. The caller must hold the lock.
+func (s *DeploymentStore) create(req DeploymentRequest) (*Deployment, error) {
+	dep, err := s.plan(fmt.Sprintf("dep-%s", uuid.New().String()[:8]), req)
+	if err != nil {
+		return nil, err
 	}
 	s.deployments[dep.ID] = dep
-	s.byAgent[agentID] = append(s.byAgent[agentID], dep)
+	s.byAgent[dep.AgentID] = append(s.byAgent[dep.AgentID], dep)
+	message := fmt.Sprintf("Deployment created for agent %s with image %s", dep.AgentID, dep.ImageURL)
+	if len(dep.Configs) > 0 {
+		// Recorded so that the revision can be reproduced after the configs change.
+		keys := make([]string, len(dep.Configs))
+		for i, ref := range dep.Configs {
+			keys[i] = ref.Key()
+		}
+		message += " and configs " + strings.Join(keys, ", ")
+	}
+	s.recordEvent(dep.ID, "created", message)
+	switch dep.Status {
+	case "deferred", "queued":
+		s.recordEvent(dep.ID, string(dep.Status), dep.Reason)
+	default:
+		s.start(dep)
+	}
+
+	log.Printf("Deployment %s created for agent %s with image %s", dep.ID, dep.AgentID, dep.ImageURL)
+	return dep, nil
+}
+
+// plan returns the deployment a request creates with the given ID without
+// storing it: pending, or deferred or queued and why, after checking it
+// against quotas and its agent's maintenance. The caller must hold the lock.
+func (s *DeploymentStore) plan(id string, req DeploymentRequest) (*Deployment, error) {
+	requested, err := requestedAmounts(req.Resources)
+	if err != nil {
+		return nil, err
+	}
+	status := types.StatusPending
+	var violations []string
+	var held string
+	if deferred(req.ScheduleAt) {
+		// Quotas and maintenance are checked once the deployment is due.
+		status = types.StatusDeferred
+	} else {
+		var queue bool
+		violations, queue = s.quotaViolations(req, requested)
+		if len(violations) > 0 && !queue {
+			return nil, &QuotaExceededError{Violations: violations}
+		}
+		if held, err = s.maintenanceHold(req.AgentID); err != nil {
+			return nil, err
+		}
+		if len(violations) > 0 || held != "" {
+			status = types.StatusQueued
+		}
+	}
 
-	log.Printf("Deployment %s created for agent %s with image %s", dep.ID, agentID, imageURL)
-	return dep
+	now := time.Now().UTC()
+	dep := &Deployment{
+		ID:              id,
+		AgentID:         req.AgentID,
+		AgentSelector:   req.AgentSelector,
+		ImageURL:        req.ImageURL,
+		Bundle:          req.Bundle,
+		Project:         req.Project,
+		Resources:       req.Resources,
+		Status:          status,
+		StatusTimes:     map[DeploymentStatus]time.Time{status: now},
+		Revision:        1,
+		AutoUpdate:      req.AutoUpdate,
+		CreatedAt:       now,
+		Application:     req.Application,
+		Component:       req.Component,
+		DependsOn:       req.dependsOnIDs,
+		Fleet:           req.Fleet,
+		Hook:            req.Hook,
+		AdoptedFrom:     req.AdoptedFrom,
+		Args:            req.args,
+		Channel:         req.Channel,
+		ChannelStrategy: req.ChannelStrategy,
+		UpdatePolicy:    req.UpdatePolicy,
+		SLO:             req.SLO,
+		Sandbox:         req.Sandbox,
+		ModelServing:    req.ModelServing,
+		RescheduleAfter: req.RescheduleAfter,
+	}
+	// Claims of application components outlive the component's deployments
+	// so that a new application revision finds its data again.
+	claimPrefix := dep.ID
+	if req.Application != "" {
+		claimPrefix = req.Application + "-" + req.Component
+	}
+	dep.Volumes = claimNames(claimPrefix, req.Volumes)
+	dep.Artifacts = append([]Artifact(nil), req.Artifacts...)
+	dep.Configs = append([]ConfigRef(nil), req.Configs...)
+	dep.Secrets = append([]SecretRef(nil), req.Secrets...)
+	dep.Addons = append([]Addon(nil), req.Addons...)
+	if req.ModelServing != nil {
+		dep.Args = modelServingArgs(req.ModelServing)
+	}
+	if req.TTLSeconds > 0 {
+		expiresAt := dep.CreatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+		dep.ExpiresAt = &expiresAt
+	}
+	s.schedule(dep, req)
+	switch status {
+	case "deferred":
+		dep.Reason = "Deferred until " + dep.ScheduleAt.Format(time.RFC3339)
+	case "queued":
+		dep.Reason = held
+		if len(violations) > 0 {
+			dep.Reason = (&QuotaExceededError{Violations: violations}).Error()
+		}
+	}
+	return dep, nil
 }
 
-// ListForAgent returns all deployments for a given agent.
-func (s *DeploymentStore) ListForAgent(agentID string) []*Deployment {
+// consumesQuota reports whether a deployment in the given status counts
+// towards its quotas.
+func consumesQuota(status DeploymentStatus) bool {
+	switch status {
+	case types.StatusDeferred, types.StatusQueued, types.StatusPaused, types.StatusFailed, types.StatusCancelled, types.StatusSucceeded:
+		return false
+	}
+	return !retired(status)
+}
+
+// retired reports whether a deployment in the given status has been replaced
+// or torn down for good, or its job has completed, and can no longer be
+// redeployed.
+func retired(status DeploymentStatus) bool {
+	switch status {
+	case types.StatusExpired, types.StatusSuperseded, types.StatusRemoved, types.StatusDeleted, types.StatusSucceeded:
+		return true
+	}
+	return false
+}
+
+// quotaViolations checks a request against its quotas and against the free
+// GPUs of its agent, which act as a quota of the agent. queue reports whether
+// every violated quota queues excess deployments rather than rejecting them.
+// The caller must hold the lock.
+func (s *DeploymentStore) quotaViolations(req DeploymentRequest, requested resourceAmounts) (violations []string, queue bool) {
+	queue = true
+	if s.quotas != nil {
+		for _, q := range s.quotas.applicable(req) {
+			v := exceededLimits(&q, s.usage(q), requested)
+			if len(v) > 0 && q.OnExceed != "queue" {
+				queue = false
+			}
+			violations = append(violations, v...)
+		}
+	}
+	if v := s.gpuShortage(req.AgentID, requested); v != "" {
+		violations = append(violations, v)
+		queue = queue && !s.rejectGPUShortage
+	}
+	return violations, queue
+}
+
+// usage sums the resources of the active deployments governed by a quota. The
+// caller must hold the lock.
+func (s *DeploymentStore) usage(q Quota) resourceAmounts {
+	var total resourceAmounts
+	for _, dep := range s.deployments {
+		if !consumesQuota(dep.Status) || !quotaGoverns(q, dep) {
+			continue
+		}
+		// Resources were validated when the deployment was created.
+		amounts, _ := requestedAmounts(dep.Resources)
+		total.add(amounts)
+	}
+	return total
+}
+
+func quotaGoverns(q Quota, dep *Deployment) bool {
+	return (q.Scope == "agent" && dep.AgentID == q.Name) || (q.Scope == "project" && dep.Project == q.Name)
+}
+
+// QuotaUsage reports how much of a quota is in use and how many deployments are waiting for it.
+func (s *DeploymentStore) QuotaUsage(q Quota) QuotaUsage {
 	s.Lock()
 	defer s.Unlock()
-	// A copy is returned to avoid race conditions on the slice itself
-	deps := make([]*Deployment, len(s.byAgent[agentID]))
-	copy(deps, s.byAgent[agentID])
+
+	used := s.usage(q)
+	usage := QuotaUsage{
+		Deployments: used.deployments,
+		CPU:         formatCPU(used.cpuMillis),
+		Memory:      formatMemory(used.memoryBytes),
+		GPU:         used.gpu,
+	}
+	for _, dep := range s.deployments {
+		if dep.Status == "queued" && quotaGoverns(q, dep) {
+			usage.Queued++
+		}
+	}
+	return usage
+}
+
+// AdmitQueued moves queued deployments that now fit their quotas, and whose
+// agents are not in maintenance, to pending, oldest first.
+func (s *DeploymentStore) AdmitQueued() {
+	s.Lock()
+	defer s.Unlock()
+	s.admitQueued()
+}
+
+// admitQueued is AdmitQueued for callers that hold the lock.
+func (s *DeploymentStore) admitQueued() {
+	var queued []*Deployment
+	for _, dep := range s.deployments {
+		if dep.Status == "queued" {
+			queued = append(queued, dep)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].CreatedAt.Before(queued[j].CreatedAt) })
+
+	for _, dep := range queued {
+		if held, _ := s.maintenanceHold(dep.AgentID); held != "" {
+			continue
+		}
+		requested, _ := requestedAmounts(dep.Resources)
+		req := DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: dep.AgentID, Project: dep.Project}}
+		if violations, _ := s.quotaViolations(req, requested); len(violations) > 0 {
+			continue
+		}
+		dep.Reason = ""
+		s.recordEvent(dep.ID, "admitted", "Quota and agent available, deployment admitted")
+		s.start(dep)
+	}
+}
+
+// start moves a new revision to pending, or to waiting if it depends on
+// deployments that are not running yet. The caller must hold the lock.
+func (s *DeploymentStore) start(dep *Deployment) {
+	if waitingFor := s.unreadyDependencies(dep); len(waitingFor) > 0 {
+		s.setStatus(dep, types.StatusWaiting)
+		s.recordEvent(dep.ID, "waiting", "Waiting for dependencies: "+strings.Join(waitingFor, ", "))
+		return
+	}
+	s.setStatus(dep, types.StatusPending)
+	s.notifyPending(dep)
+}
+
+// unreadyDependencies lists the dependencies of a deployment that are not
+// running. The caller must hold the lock.
+func (s *DeploymentStore) unreadyDependencies(dep *Deployment) []string {
+	var unready []string
+	for _, id := range dep.DependsOn {
+		if d, exists := s.deployments[id]; !exists || d.Status != "running" {
+			unready = append(unready, id)
+		}
+	}
+	return unready
+}
+
+// releaseWaiting starts waiting deployments whose dependencies are all
+// running. The caller must hold the lock.
+func (s *DeploymentStore) releaseWaiting() {
+	for _, dep := range s.deployments {
+		if dep.Status == "waiting" && len(s.unreadyDependencies(dep)) == 0 {
+			s.recordEvent(dep.ID, "pending", "Dependencies are running")
+			s.start(dep)
+		}
+	}
+}
+
+// SetPendingHandler registers the function that is called whenever a
+// deployment revision becomes pending. It must not block.
+func (s *DeploymentStore) SetPendingHandler(fn func(id, agentID string, revision int, imageURL string)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onPending = fn
+}
+
+// SetEventHandler registers the function that is called for every event
+// recorded in a deployment's timeline. It must not block.
+func (s *DeploymentStore) SetEventHandler(fn func(LifecycleEvent)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onEvent = fn
+}
+
+// notifyPending hands a pending revision to the pending handler. The caller must hold the lock.
+func (s *DeploymentStore) notifyPending(dep *Deployment) {
+	if s.held != nil {
+		s.held = append(s.held, dep)
+		return
+	}
+	if s.onPending != nil {
+		s.onPending(dep.ID, dep.AgentID, dep.Revision, pendingImage(dep))
+	}
+}
+
+// pendingImage returns the image a new revision is admitted with. An
+// ImageDigest set before admission, e.g. by an update policy, pins it, so
+// that admission does not resolve the tag again; revisions that are to
+// resolve it clear ImageDigest.
+func pendingImage(dep *Deployment) string {
+	return pinnedImageRef(dep.ImageURL, dep.ImageDigest)
+}
+
+// IsPending reports whether the given revision of a deployment is pending.
+func (s *DeploymentStore) IsPending(id string, revision int) bool {
+	s.Lock()
+	defer s.Unlock()
+	dep, exists := s.deployments[id]
+	return exists && dep.Revision == revision && dep.Status == "pending"
+}
+
+// MarkScheduled records that a pending revision passed admission and is ready
+// for its agent. It reports false if the revision is no longer pending.
+func (s *DeploymentStore) MarkScheduled(id string, revision int, digest string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists || dep.Revision != revision || dep.Status != "pending" {
+		return false
+	}
+	dep.ImageDigest = digest
+	s.setStatus(dep, types.StatusScheduled)
+	dep.Reason = ""
+	message := fmt.Sprintf("Revision %d scheduled on agent %s", revision, dep.AgentID)
+	if digest != "" {
+		message = fmt.Sprintf("Revision %d scheduled on agent %s with image digest %s", revision, dep.AgentID, digest)
+	}
+	s.recordEvent(id, "scheduled", message)
+	return true
+}
+
+// SetScan attaches the vulnerability scan summary of ref to a pending
+// revision and records the outcome on its timeline, failing the revision if
+// the findings block it. It reports whether the revision may go on.
+func (s *DeploymentStore) SetScan(id string, revision int, ref string, summary *ScanSummary) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists || dep.Revision != revision || dep.Status != "pending" {
+		return false
+	}
+	dep.Scan = summary
+	switch {
+	case summary.Passed:
+		s.recordEvent(id, "scanned", fmt.Sprintf("Vulnerability scan of %s passed: %s", ref, describeFindings(summary)))
+	case summary.Blocking:
+		return !s.markFailed(id, revision, fmt.Sprintf("Vulnerability scan of %s found %s", ref, describeFindings(summary)))
+	default:
+		s.recordEvent(id, "scan_warning", fmt.Sprintf("Vulnerability scan of %s found %s", ref, describeFindings(summary)))
+	}
+	return true
+}
+
+// MarkFailed records that a pending revision could not be admitted. It reports
+// false if the revision is no longer pending.
+func (s *DeploymentStore) MarkFailed(id string, revision int, reason string) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.markFailed(id, revision, reason)
+}
+
+// markFailed is MarkFailed with the lock held.
+func (s *DeploymentStore) markFailed(id string, revision int, reason string) bool {
+	dep, exists := s.deployments[id]
+	if !exists || dep.Revision != revision || dep.Status != "pending" {
+		return false
+	}
+	s.setStatus(dep, types.StatusFailed)
+	dep.Reason = reason
+	s.recordEvent(id, "failed", reason)
+	s.admitQueued()
+	return true
+}
+
+// Cancel stops a deployment that has not been started by its agent yet. It
+// returns false if the deployment does not exist and an error if it can no
+// longer be cancelled or is not at the expected resource version.
+func (s *DeploymentStore) Cancel(id string, expected int, reason string) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if dep.Status == types.StatusCancelled || !canTransition(dep.Status, types.StatusCancelled) {
+		return nil, true, fmt.Errorf("deployment %s is %s and can no longer be cancelled", id, dep.Status)
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("Revision %d cancelled", dep.Revision)
+	}
+	s.setStatus(dep, types.StatusCancelled)
+	dep.Reason = reason
+	s.recordEvent(id, "cancelled", reason)
+	log.Printf("Deployment %s cancelled", id)
+	s.admitQueued()
+	return cloneDeployment(dep), true, nil
+}
+
+// RedeployImage starts a new revision of every auto-updating deployment whose
+// image matches the given reference, and returns the deployments it updated.
+func (s *DeploymentStore) RedeployImage(imageRef string) []*Deployment {
+	s.Lock()
+	defer s.Unlock()
+
+	target := normalizeImageRef(imageRef)
+	var updated []*Deployment
+	for _, dep := range s.deployments {
+		if !dep.AutoUpdate || retired(dep.Status) || dep.Status == "paused" {
+			continue
+		}
+		if normalizeImageRef(dep.ImageURL) != target {
+			continue
+		}
+		if f := s.frozen(dep.Project, dep.AgentID); f != nil {
+			s.recordEvent(dep.ID, "frozen", fmt.Sprintf("Image %s was pushed, but freeze %s holds deployments until %s", imageRef, f.ID, f.End.Format(time.RFC3339)))
+			continue
+		}
+		dep.Revision++
+		dep.ImageDigest = ""
+		dep.Reason = ""
+		dep.Scan = nil
+
+		s.recordEvent(dep.ID, "updated", fmt.Sprintf("Image %s was pushed, redeploying as revision %d", imageRef, dep.Revision))
+		log.Printf("Deployment %s redeploying image %s as revision %d", dep.ID, dep.ImageURL, dep.Revision)
+		s.start(dep)
+
+		updated = append(updated, cloneDeployment(dep))
+	}
+	return updated
+}
+
+// ListForAgent returns the deployments for a given agent, leaving out
+// archived deployments unless includeArchived is set.
+func (s *DeploymentStore) ListForAgent(agentID string, includeArchived bool) []*Deployment {
+	deps, _ := s.ListForAgentWithRevision(agentID, includeArchived)
 	return deps
 }
 
-// Agent represents an edge agent connected to the control center.
-type Agent struct {
-	ID       string    `json:"id"`
-	Address  string    `json:"address"`
-	LastSeen time.Time `json:"last_seen"`
-	Status   string    `json:"status"`
+// ListForAgentWithRevision is ListForAgent that also returns the revision of
+// the agent's deployments as of the list, which changes whenever any of them
+// does.
+func (s *DeploymentStore) ListForAgentWithRevision(agentID string, includeArchived bool) ([]*Deployment, int) {
+	s.Lock()
+	defer s.Unlock()
+	deps := make([]*Deployment, 0, len(s.byAgent[agentID]))
+	for _, dep := range s.byAgent[agentID] {
+		if dep.ArchivedAt == nil || includeArchived {
+			deps = append(deps, cloneDeployment(dep))
+		}
+	}
+	return deps, s.revisions[agentID]
+}
+
+// changed bumps the revision of an agent's deployments and signals those
+// watching them. The caller must hold the lock.
+func (s *DeploymentStore) changed(agentID string) {
+	s.revisions[agentID]++
+	s.notifyWatchers(agentID)
+}
+
+// ReconcileGitSpecs brings the git-managed deployments in line with the given
+// specs from commit sha. New specs are deployed, changed specs supersede their
+// previous deployment, and deployments whose spec was deleted are marked removed.
+func (s *DeploymentStore) ReconcileGitSpecs(specs []DeploymentSpec, sha string) (created, superseded, removed int) {
+	s.Lock()
+	defer s.Unlock()
+
+	active := make(map[string]*Deployment)
+	for _, dep := range s.deployments {
+		if dep.GitSpec != "" && !retired(dep.Status) {
+			active[dep.GitSpec] = dep
+		}
+	}
+
+	for _, spec := range specs {
+		current, exists := active[spec.Name]
+		delete(active, spec.Name)
+		if exists && current.AgentID == spec.AgentID && current.ImageURL == spec.ImageURL {
+			continue
+		}
+		// Changes wait for freezes to end; later syncs apply them.
+		if s.frozen("", spec.AgentID) != nil || exists && s.frozen(current.Project, current.AgentID) != nil {
+			continue
+		}
+		if exists {
+			s.setStatus(current, types.StatusSuperseded)
+			s.recordEvent(current.ID, "superseded", fmt.Sprintf("Spec %s changed at commit %s", spec.Name, shortSHA(sha)))
+			superseded++
+		}
+		dep, err := s.create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: spec.AgentID, ImageURL: spec.ImageURL}})
+		if err != nil {
+			log.Printf("GitOps: could not create deployment for spec %s: %v", spec.Name, err)
+			continue
+		}
+		dep.GitSpec = spec.Name
+		dep.CommitSHA = sha
+		created++
+	}
+
+	for name, dep := range active {
+		if s.frozen(dep.Project, dep.AgentID) != nil {
+			continue
+		}
+		s.setStatus(dep, types.StatusRemoved)
+		s.recordEvent(dep.ID, "removed", fmt.Sprintf("Spec %s deleted at commit %s", name, shortSHA(sha)))
+		removed++
+	}
+	if superseded+removed > 0 {
+		s.admitQueued()
+	}
+	return created, superseded, removed
+}
+
+// Get returns a copy of the deployment with the given ID.
+func (s *DeploymentStore) Get(id string) (*Deployment, bool) {
+	s.Lock()
+	defer s.Unlock()
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false
+	}
+	return cloneDeployment(dep), true
+}
+
+// cloneDeployment returns a deep copy of a deployment, which callers can read
+// after releasing the lock while the store goes on changing the original.
+// The caller must hold the lock.
+func cloneDeployment(dep *Deployment) *Deployment {
+	if dep == nil {
+		return nil
+	}
+	d := *dep
+	d.AgentSelector = maps.Clone(dep.AgentSelector)
+	d.StatusTimes = maps.Clone(dep.StatusTimes)
+	d.Resources = clonePtr(dep.Resources)
+	d.Volumes = slices.Clone(dep.Volumes)
+	for i, v := range d.Volumes {
+		d.Volumes[i].PVC = clonePtr(v.PVC)
+		d.Volumes[i].HostPath = clonePtr(v.HostPath)
+		d.Volumes[i].EmptyDir = clonePtr(v.EmptyDir)
+	}
+	d.Artifacts = slices.Clone(dep.Artifacts)
+	d.Configs = slices.Clone(dep.Configs)
+	d.Secrets = slices.Clone(dep.Secrets)
+	d.Addons = slices.Clone(dep.Addons)
+	for i, a := range d.Addons {
+		d.Addons[i].Resources = clonePtr(a.Resources)
+		d.Addons[i].Env = maps.Clone(a.Env)
+	}
+	if dep.Scan != nil {
+		scan := *dep.Scan
+		scan.Counts = maps.Clone(dep.Scan.Counts)
+		d.Scan = &scan
+	}
+	d.DependsOn = slices.Clone(dep.DependsOn)
+	d.ExpiresAt = clonePtr(dep.ExpiresAt)
+	d.ScheduleAt = clonePtr(dep.ScheduleAt)
+	d.NextRun = clonePtr(dep.NextRun)
+	d.SLO = clonePtr(dep.SLO)
+	if dep.Sandbox != nil {
+		sandbox := *dep.Sandbox
+		sandbox.Egress = slices.Clone(dep.Sandbox.Egress)
+		for i, rule := range sandbox.Egress {
+			sandbox.Egress[i].Ports = slices.Clone(rule.Ports)
+		}
+		d.Sandbox = &sandbox
+	}
+	if dep.ModelServing != nil {
+		serving := *dep.ModelServing
+		serving.Shadow = clonePtr(dep.ModelServing.Shadow)
+		d.ModelServing = &serving
+	}
+	d.Args = slices.Clone(dep.Args)
+	d.OrphanedAt = clonePtr(dep.OrphanedAt)
+	d.ArchivedAt = clonePtr(dep.ArchivedAt)
+	return &d
+}
+
+// clonePtr returns a pointer to a copy of *p, or nil if p is nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// UpdateStatus records a status an agent reported for a deployment's
+// workload and records the change in its event timeline. If expected is not
+// 0, the deployment must be at that resource version. It returns a
+// *TransitionError if the deployment cannot move to the status.
+func (s *DeploymentStore) UpdateStatus(id string, expected int, status DeploymentStatus, reason string) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if err := checkReportable(status); err != nil {
+		return nil, true, err
+	}
+	status = reportedStatus(status)
+	if !s.setStatus(dep, status) {
+		return nil, true, &TransitionError{ID: id, From: dep.Status, To: status}
+	}
+	dep.Reason = reason
+	s.recordEvent(id, string(status), reason)
+	log.Printf("Deployment %s status changed to %s", id, status)
+	if !consumesQuota(status) {
+		s.admitQueued()
+	}
+	if status == types.StatusRunning {
+		s.releaseWaiting()
+	}
+	return cloneDeployment(dep), true, nil
+}
+
+// Events returns the event timeline for a deployment, oldest first.
+func (s *DeploymentStore) Events(id string) ([]DeploymentEvent, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.deployments[id]; !exists {
+		return nil, false
+	}
+	events := make([]DeploymentEvent, len(s.events[id]))
+	copy(events, s.events[id])
+	return events, true
+}
+
+// RecordEvent appends an event to a deployment's timeline.
+func (s *DeploymentStore) RecordEvent(id, eventType, message string) {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.deployments[id]; exists {
+		s.recordEvent(id, eventType, message)
+	}
+}
+
+// recordEvent appends an event to a deployment's timeline. Every change to a
+// deployment is recorded as an event, so this also bumps the deployment's
+// resource version. The caller must hold the lock.
+func (s *DeploymentStore) recordEvent(id, eventType, message string) {
+	ev := DeploymentEvent{
+		Time:    time.Now().UTC(),
+		Type:    eventType,
+		Message: message,
+	}
+	if dep, exists := s.deployments[id]; exists {
+		dep.ResourceVersion++
+		s.changed(dep.AgentID)
+		if s.onEvent != nil {
+			s.onEvent(deploymentLifecycleEvent(dep, ev))
+		}
+	}
+	s.events[id] = append(s.events[id], ev)
 }
 
 // AgentStore manages the collection of registered agents.
 type AgentStore struct {
 	sync.Mutex
-	agents map[string]*Agent
+	agents      map[string]*Agent
+	credentials map[string][sha256.Size]byte // Hashes of the credentials agents reconnect with, by agent ID
+	onEvent     func(LifecycleEvent)         // Called when an agent registers or changes status
+	revision    int                          // Bumped on every change to any agent, for the list's ETag
+	versions    AgentVersionPolicy           // Oldest agents supported
 }
 
 // NewAgentStore creates a new in-memory agent store.
 func NewAgentStore() *AgentStore {
 	return &AgentStore{
-		agents: make(map[string]*Agent),
+		agents:      make(map[string]*Agent),
+		credentials: make(map[string][sha256.Size]byte),
 	}
 }
 
 // Register creates a new agent, assigns it an ID, and stores it.
-func (s *AgentStore) Register(addr string) *Agent {
+func (s *AgentStore) Register(addr, timezone string, gpus []GPUInventory, labels map[string]string, token *BootstrapToken) *Agent {
 	s.Lock()
 	defer s.Unlock()
 
@@ -105,10 +769,46 @@ func (s *AgentStore) Register(addr string) *Agent {
 		Address:  addr,
 		LastSeen: time.Now().UTC(),
 		Status:   "online",
+		Timezone: timezone,
+		GPUs:     gpus,
+		Labels:   labels,
+	}
+	if token != nil {
+		agent.BootstrapTokenID, agent.BootstrapLabels = token.ID, token.Labels
+		agent.Labels = mergeLabels(labels, token.Labels)
 	}
 	s.agents[id] = agent
+	s.revision++
 	log.Printf("Agent registered: %s at %s", id, addr)
-	return agent
+	s.recordEvent(agent, "registered")
+	return cloneAgent(agent)
+}
+
+// Get returns a copy of the agent with the given ID.
+func (s *AgentStore) Get(id string) (*Agent, bool) {
+	s.Lock()
+	defer s.Unlock()
+	agent, exists := s.agents[id]
+	return cloneAgent(agent), exists
+}
+
+// cloneAgent returns a deep copy of an agent, which callers can read after
+// releasing the lock while the store goes on changing the original. The
+// caller must hold the lock.
+func cloneAgent(agent *Agent) *Agent {
+	if agent == nil {
+		return nil
+	}
+	a := *agent
+	a.Labels = maps.Clone(agent.Labels)
+	a.GPUs = slices.Clone(agent.GPUs)
+	a.ImageRewrites = slices.Clone(agent.ImageRewrites)
+	a.Maintenance = clonePtr(agent.Maintenance)
+	a.StaleSince = clonePtr(agent.StaleSince)
+	a.Prices = clonePtr(agent.Prices)
+	a.BootstrapLabels = maps.Clone(agent.BootstrapLabels)
+	a.ArchivedAt = clonePtr(agent.ArchivedAt)
+	return &a
 }
 
 // Heartbeat updates an agent's last seen time.
@@ -117,127 +817,286 @@ func (s *AgentStore) Heartbeat(id string) bool {
 	defer s.Unlock()
 
 	agent, exists := s.agents[id]
-	if !exists {
+	if !exists || agent.ArchivedAt != nil {
 		return false
 	}
 	agent.LastSeen = time.Now().UTC()
-	agent.Status = "online"
+	agent.StaleSince = nil
+	s.revision++
+	if agent.Status != "online" {
+		agent.Status = "online"
+		s.recordEvent(agent, "online")
+	}
 	log.Printf("Heartbeat from agent: %s", id)
 	return true
 }
 
-// List returns all registered agents, updating their status if they've missed heartbeats.
-func (s *AgentStore) List() []*Agent {
+// SetTimezone records the time zone a reconnecting agent reported.
+func (s *AgentStore) SetTimezone(id, timezone string) {
 	s.Lock()
 	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists && timezone != "" {
+		agent.Timezone = timezone
+		s.revision++
+	}
+}
 
-	// Update status based on last seen time before listing.
-	// An agent is considered offline if it hasn't sent a heartbeat in over 45 seconds.
+// List returns copies of the registered agents, updating their status if they've missed
+// heartbeats. Archived agents are left out unless includeArchived is set.
+func (s *AgentStore) List(includeArchived bool) []*Agent {
+	list, _ := s.ListWithRevision(includeArchived)
+	return list
+}
+
+// ListWithRevision is List that also returns the store's revision as of the
+// list, which changes whenever any agent does.
+func (s *AgentStore) ListWithRevision(includeArchived bool) ([]*Agent, int) {
+	s.Lock()
+	defer s.Unlock()
+	s.refreshStatus()
+	list := make([]*Agent, 0, len(s.agents))
 	for _, agent := range s.agents {
-		if time.Since(agent.LastSeen) > 45*time.Second {
-			agent.Status = "offline"
+		if agent.ArchivedAt == nil || includeArchived {
+			list = append(list, cloneAgent(agent))
 		}
 	}
+	return list, s.revision
+}
 
-	list := make([]*Agent, 0, len(s.agents))
+// refreshStatus marks the agents that have not sent a heartbeat in over 45
+// seconds offline. The caller must hold the lock.
+func (s *AgentStore) refreshStatus() {
 	for _, agent := range s.agents {
-		list = append(list, agent)
+		if agent.ArchivedAt == nil && agent.Status != "offline" && time.Since(agent.LastSeen) > 45*time.Second {
+			agent.Status = "offline"
+			s.revision++
+			s.recordEvent(agent, "offline")
+		}
+	}
+}
+
+// SetEventHandler registers the function that is called when an agent
+// registers or changes status. It must not block.
+func (s *AgentStore) SetEventHandler(fn func(LifecycleEvent)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onEvent = fn
+}
+
+// recordEvent passes an agent state change to the event handler. The caller
+// must hold the lock.
+func (s *AgentStore) recordEvent(agent *Agent, eventType string) {
+	if s.onEvent != nil {
+		s.onEvent(agentLifecycleEvent(agent, eventType))
 	}
-	return list
 }
 
 // RegisterRequest defines the body for the agent registration request.
 type RegisterRequest struct {
-	Address string `json:"address"`
+	Address  string            `json:"address"`
+	Timezone string            `json:"timezone,omitempty"` // IANA time zone of the agent's site
+	GPUs     []GPUInventory    `json:"gpus"`               // GPUs the agent has, if it reports them
+	Labels   map[string]string `json:"labels,omitempty"`   // e.g. arch=arm64, gpu=jetson, site=store-104
+	// BootstrapToken authorizes the registration; required if
+	// AGENT_BOOTSTRAP_REQUIRED is "true".
+	BootstrapToken  string `json:"bootstrap_token,omitempty"`
+	Version         string `json:"version,omitempty"`          // Build version of the agent, e.g. "1.4.2"
+	ProtocolVersion int    `json:"protocol_version,omitempty"` // Protocol version the agent speaks; 1 if not set
+}
+
+// StatusRequest defines the body for a deployment status report from an agent.
+type StatusRequest struct {
+	Status DeploymentStatus `json:"status"`
+	Reason string           `json:"reason,omitempty"`
 }
 
 // HeartbeatRequest defines the body for the agent heartbeat request.
 type HeartbeatRequest struct {
-	ID string `json:"id"`
+	ID              string `json:"id"`
+	Version         string `json:"version,omitempty"` // Reported again so that upgrades are noticed
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+}
+
+// HeartbeatResponse answers a heartbeat with the digest of the agent's
+// desired state, as StreamHeartbeatReply does on the agent stream.
+type HeartbeatResponse struct {
+	DesiredState string `json:"desired_state"`
 }
 
 func main() {
 	agentStore := NewAgentStore()
-	deploymentStore := NewDeploymentStore()
-
-	http.HandleFunc("/api/v1/deployments", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		switch r.Method {
-		case http.MethodGet:
-			agentID := r.URL.Query().Get("agent_id")
-			if agentID == "" {
-				http.Error(w, "agent_id query parameter is required", http.StatusBadRequest)
-				return
-			}
-			deps := deploymentStore.ListForAgent(agentID)
-			json.NewEncoder(w).Encode(deps)
-		case http.MethodPost:
-			var req DeploymentRequest
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, "Invalid request body", http.StatusBadRequest)
-				return
-			}
-			if req.AgentID == "" || req.ImageURL == "" {
-				http.Error(w, "agent_id and image_url are required", http.StatusBadRequest)
-				return
-			}
-			// TODO: Check if agent exists before creating deployment.
-			dep := deploymentStore.Create(req.AgentID, req.ImageURL)
-			w.WriteHeader(http.StatusCreated)
-			json.NewEncoder(w).Encode(dep)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// Handler for /api/v1/agents
-	// GET: List agents
-	// POST: Register a new agent
-	http.HandleFunc("/api/v1/agents", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		switch r.Method {
-		case http.MethodGet:
-			agents := agentStore.List()
-			json.NewEncoder(w).Encode(agents)
-		case http.MethodPost:
-			var req RegisterRequest
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				http.Error(w, "Invalid request body", http.StatusBadRequest)
-				return
-			}
-			if req.Address == "" {
-				http.Error(w, "Address is required", http.StatusBadRequest)
-				return
-			}
-			agent := agentStore.Register(req.Address)
-			w.WriteHeader(http.StatusCreated)
-			json.NewEncoder(w).Encode(agent)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
-
-	// Handler for /api/v1/heartbeat
-	// POST: Receives a heartbeat from a registered agent
-	http.HandleFunc("/api/v1/heartbeat", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		var req HeartbeatRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-		if !agentStore.Heartbeat(req.ID) {
-			http.Error(w, "Agent not found", http.StatusNotFound)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-	})
-
-	log.Println("Control Center API server starting on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	quotaStore := NewQuotaStore()
+	configStore := NewConfigStore()
+	secretStore := NewSecretStore()
+	freezeStore := NewFreezeStore()
+	deploymentStore := NewDeploymentStore(quotaStore, agentStore, freezeStore)
+	applicationStore := NewApplicationStore(deploymentStore, configStore)
+
+	// Resolve image tags to digests unless disabled, e.g. for air-gapped sites.
+	var registryClient *RegistryClient
+	if os.Getenv("RESOLVE_IMAGE_DIGESTS") != "false" {
+		registryClient = NewRegistryClient()
+	}
+	signatureVerifier, err := NewSignatureVerifierFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure image signature verification: %v", err)
+	}
+	imageScanner, err := NewImageScannerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure image vulnerability scanning: %v", err)
+	}
+	policyEngine := NewPolicyEngineFromEnv()
+	retryPolicy, err := RetryPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure admission retries: %v", err)
+	}
+	admission := NewAdmission(deploymentStore, registryClient, signatureVerifier, imageScanner, retryPolicy)
+	registerAdmissionMetrics(admission)
+	deploymentStore.SetPendingHandler(admission.Submit)
+
+	kafkaExporter, err := NewKafkaExporterFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure Kafka export: %v", err)
+	}
+	if kafkaExporter != nil {
+		agentStore.SetEventHandler(kafkaExporter.Publish)
+		deploymentStore.SetEventHandler(kafkaExporter.Publish)
+		go kafkaExporter.Run()
+	}
+
+	gitSyncer, err := NewGitSyncerFromEnv(deploymentStore)
+	if err != nil {
+		log.Fatalf("Failed to configure GitOps sync: %v", err)
+	}
+	if gitSyncer != nil {
+		go gitSyncer.Run()
+	}
+
+	bundleStore, err := NewBundleStoreFromEnv(registryClient)
+	if err != nil {
+		log.Fatalf("Failed to configure bundles: %v", err)
+	}
+
+	dashboard, err := NewDashboardFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure dashboard support: %v", err)
+	}
+
+	limits, err := LimitsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure API limits: %v", err)
+	}
+	listeners, err := ListenersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to listen for API requests: %v", err)
+	}
+
+	versions, err := APIVersionsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure API versions: %v", err)
+	}
+
+	approvers, err := ApproversFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure rollout approvers: %v", err)
+	}
+
+	gcPolicy, err := GCPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure deployment garbage collection: %v", err)
+	}
+	if agentStore.versions, err = AgentVersionPolicyFromEnv(); err != nil {
+		log.Fatalf("Failed to configure supported agent versions: %v", err)
+	}
+	if deploymentStore.rejectGPUShortage, err = GPUShortageFromEnv(); err != nil {
+		log.Fatalf("Failed to configure GPU scheduling: %v", err)
+	}
+	costs, err := CostsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure cost estimation: %v", err)
+	}
+
+	janitorPolicy, err := JanitorPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure the stale agent janitor: %v", err)
+	}
+	admin, err := BackupSettingsFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure backups: %v", err)
+	}
+
+	go deploymentStore.RunGC(gcPolicy, secretStore)
+	go deploymentStore.RunScheduler()
+	go deploymentStore.RunJanitor(agentStore, janitorPolicy)
+
+	updatePoller, err := NewUpdatePollerFromEnv(deploymentStore, registryClient)
+	if err != nil {
+		log.Fatalf("Failed to configure update policies: %v", err)
+	}
+	if updatePoller != nil {
+		go updatePoller.Run()
+	}
+
+	alertStore := NewAlertStore()
+	go alertStore.Run(agentStore, deploymentStore)
+
+	usageStore := NewUsageStore()
+	server := &Server{
+		agents:      agentStore,
+		deployments: deploymentStore,
+		configs:     configStore,
+		secrets:     secretStore,
+		quotas:      quotaStore,
+		apps:        applicationStore,
+		fleets:      NewFleetStore(),
+		freezes:     freezeStore,
+		channels:    NewChannelStore(),
+		alerts:      alertStore,
+		usage:       usageStore,
+		gateway:     NewGateway(deploymentStore, agentStore, usageStore),
+		engine:      policyEngine,
+		admission:   admission,
+		registry:    registryClient,
+		gitSyncer:   gitSyncer,
+		bundles:     bundleStore,
+		dashboard:   dashboard,
+		limits:      limits,
+		versions:    versions,
+		costs:       costs,
+		tunnels:     NewTunnelHub(),
+		operations:  NewOperationStore(),
+		bootstrap:   NewBootstrapTokenStoreFromEnv(),
+		admin:       admin,
+	}
+	server.rollouts = NewRollouts(server, approvers)
+	go server.rollouts.Run()
+
+	operator, err := NewOperatorFromEnv(server)
+	if err != nil {
+		log.Fatalf("Failed to configure Kubernetes operator: %v", err)
+	}
+	if operator != nil {
+		server.operator = operator
+		go operator.Run()
+	}
+
+	agentService := &AgentService{agents: agentStore, deployments: deploymentStore, configs: configStore, secrets: secretStore, bundles: bundleStore, operations: server.operations, bootstrap: server.bootstrap}
+	server.streams = agentService
+	mqttBridge, err := NewMQTTBridgeFromEnv(agentService)
+	if err != nil {
+		log.Fatalf("Failed to configure MQTT transport: %v", err)
+	}
+	if mqttBridge != nil {
+		mqttBridge.Start()
+	}
+	go func() {
+		if err := ServeAgentStreams(agentService, listeners.agentStream); err != nil {
+			log.Fatalf("Failed to start agent stream server: %v", err)
+		}
+	}()
+
+	ServeAdmin(listeners.admin)
+	if err := listeners.ServeAPI(server.routes()); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MaintenanceError is returned when a deployment is created for an agent
+// that is in maintenance and rejects new deployments.
+type MaintenanceError struct {
+	AgentID string
+	Reason  string
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("agent %s is in maintenance and does not accept new deployments", e.AgentID)
+	}
+	return fmt.Sprintf("agent %s is in maintenance (%s) and does not accept new deployments", e.AgentID, e.Reason)
+}
+
+// SetMaintenance puts an agent in maintenance, or takes it out if m is nil.
+// It returns false if the agent does not exist or was deleted.
+func (s *AgentStore) SetMaintenance(id string, m *Maintenance) (*Agent, bool) {
+	s.Lock()
+	defer s.Unlock()
+	agent, exists := s.agents[id]
+	if !exists || agent.ArchivedAt != nil {
+		return nil, false
+	}
+	if m != nil && agent.Maintenance != nil {
+		// Changing the reason or mode does not restart the maintenance.
+		m.Since = agent.Maintenance.Since
+	}
+	agent.Maintenance = m
+	s.revision++
+	if m != nil {
+		s.recordEvent(agent, "maintenance")
+	} else {
+		s.recordEvent(agent, "maintenance_ended")
+	}
+	return cloneAgent(agent), true
+}
+
+// maintenance returns the agent's maintenance, or nil if it is not in
+// maintenance.
+func (s *AgentStore) maintenance(id string) *Maintenance {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		return agent.Maintenance
+	}
+	return nil
+}
+
+// maintenanceHold returns the reason a new deployment for the agent is
+// queued because the agent is in maintenance, or a *MaintenanceError if it
+// must be rejected. The caller must hold the lock.
+func (s *DeploymentStore) maintenanceHold(agentID string) (string, error) {
+	if s.agents == nil {
+		return "", nil
+	}
+	m := s.agents.maintenance(agentID)
+	if m == nil {
+		return "", nil
+	}
+	if m.OnDeploy != "queue" {
+		return "", &MaintenanceError{AgentID: agentID, Reason: m.Reason}
+	}
+	if m.Reason == "" {
+		return fmt.Sprintf("Agent %s is in maintenance", agentID), nil
+	}
+	return fmt.Sprintf("Agent %s is in maintenance: %s", agentID, m.Reason), nil
+}
+
+// handleSetMaintenance serves PUT /api/v1/agents/{id}/maintenance, which
+// cordons an agent.
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var m Maintenance
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			invalidBody(w, err, "Invalid request body")
+			return
+		}
+	}
+	switch m.OnDeploy {
+	case "":
+		m.OnDeploy = "reject"
+	case "reject", "queue":
+	default:
+		http.Error(w, "on_deploy must be reject or queue", http.StatusBadRequest)
+		return
+	}
+	m.Since = time.Now().UTC()
+	agent, ok := s.agents.SetMaintenance(r.PathValue("id"), &m)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	logf(r.Context(), "Agent %s is in maintenance, new deployments: %s", agent.ID, m.OnDeploy)
+	json.NewEncoder(w).Encode(agent)
+}
+
+// handleEndMaintenance serves DELETE /api/v1/agents/{id}/maintenance, which
+// uncordons an agent and admits the deployments queued for it.
+func (s *Server) handleEndMaintenance(w http.ResponseWriter, r *http.Request) {
+	agent, ok := s.agents.SetMaintenance(r.PathValue("id"), nil)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	logf(r.Context(), "Agent %s is out of maintenance", agent.ID)
+	s.deployments.AdmitQueued()
+	json.NewEncoder(w).Encode(agent)
+}
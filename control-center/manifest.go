@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// versionedName names the ConfigMap or Secret holding a version of a config
+// or secret, e.g. prompts-v3.
+func versionedName(name string, version int) string {
+	return name + "-v" + strconv.Itoa(version)
+}
+
+// workloadManifests renders the Kubernetes objects that run a deployment: a
+// Deployment of one replica whose pod and container are named after it, the
+// PersistentVolumeClaims of its pvc volumes, and the NetworkPolicy of its
+// sandbox. Configs and secrets are read from ConfigMaps and Secrets named
+// after their versions. Artifacts are downloaded by the agent and are not
+// part of the manifests.
+func workloadManifests(ctx context.Context, dep Deployment) ([]map[string]any, error) {
+	labels := map[string]any{deploymentLabel: dep.ID}
+	container := map[string]any{"name": dep.ID, "image": dep.ImageURL}
+	if len(dep.Args) > 0 {
+		container["args"] = dep.Args
+	}
+	if r := dep.Resources; r != nil {
+		resources := map[string]any{}
+		requests := map[string]any{}
+		if r.CPU != "" {
+			requests["cpu"] = r.CPU
+		}
+		if r.Memory != "" {
+			requests["memory"] = r.Memory
+		}
+		if len(requests) > 0 {
+			resources["requests"] = requests
+		}
+		if r.GPU > 0 {
+			resources["limits"] = map[string]any{gpuResource: r.GPU}
+		}
+		if len(resources) > 0 {
+			container["resources"] = resources
+		}
+	}
+
+	var env, envFrom, volumes, mounts []any
+	for _, a := range dep.Addons {
+		keys := make([]string, 0, len(a.Env))
+		for key := range a.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			env = append(env, map[string]any{"name": key, "value": a.Env[key]})
+		}
+	}
+	for _, ref := range dep.Secrets {
+		env = append(env, map[string]any{"name": ref.Env, "valueFrom": map[string]any{
+			"secretKeyRef": map[string]any{"name": versionedName(ref.Name, ref.Version), "key": "value"},
+		}})
+	}
+	for _, ref := range dep.Configs {
+		name := versionedName(ref.Name, ref.Version)
+		if ref.Env {
+			envFrom = append(envFrom, map[string]any{"configMapRef": map[string]any{"name": name}})
+		}
+		if ref.MountPath != "" {
+			volumes = append(volumes, map[string]any{"name": "config-" + ref.Name, "configMap": map[string]any{"name": name}})
+			mounts = append(mounts, map[string]any{"name": "config-" + ref.Name, "mountPath": ref.MountPath, "readOnly": true})
+		}
+	}
+	var manifests []map[string]any
+	for _, v := range dep.Volumes {
+		volume := map[string]any{"name": v.Name}
+		switch {
+		case v.PVC != nil:
+			volume["persistentVolumeClaim"] = map[string]any{"claimName": v.PVC.ClaimName}
+			spec := map[string]any{
+				"accessModes": []any{"ReadWriteOnce"},
+				"resources":   map[string]any{"requests": map[string]any{"storage": v.PVC.Size}},
+			}
+			if v.PVC.StorageClass != "" {
+				spec["storageClassName"] = v.PVC.StorageClass
+			}
+			manifests = append(manifests, map[string]any{
+				"apiVersion": "v1",
+				"kind":       "PersistentVolumeClaim",
+				"metadata":   map[string]any{"name": v.PVC.ClaimName, "labels": labels},
+				"spec":       spec,
+			})
+		case v.HostPath != nil:
+			volume["hostPath"] = map[string]any{"path": v.HostPath.Path}
+		case v.EmptyDir != nil:
+			emptyDir := map[string]any{}
+			if v.EmptyDir.Medium != "" {
+				emptyDir["medium"] = v.EmptyDir.Medium
+			}
+			if v.EmptyDir.SizeLimit != "" {
+				emptyDir["sizeLimit"] = v.EmptyDir.SizeLimit
+			}
+			volume["emptyDir"] = emptyDir
+		}
+		volumes = append(volumes, volume)
+		mounts = append(mounts, map[string]any{"name": v.Name, "mountPath": v.MountPath, "readOnly": v.ReadOnly})
+	}
+	if len(env) > 0 {
+		container["env"] = env
+	}
+	if len(envFrom) > 0 {
+		container["envFrom"] = envFrom
+	}
+	if len(mounts) > 0 {
+		container["volumeMounts"] = mounts
+	}
+
+	podSpec := map[string]any{"containers": []any{container}}
+	if len(volumes) > 0 {
+		podSpec["volumes"] = volumes
+	}
+	podMetadata := map[string]any{"labels": labels}
+	var policy map[string]any
+	if dep.Sandbox != nil {
+		p, err := sandboxPolicy(ctx, dep)
+		if err != nil {
+			return nil, err
+		}
+		annotations := make(map[string]any, len(p.PodAnnotations))
+		for key, value := range p.PodAnnotations {
+			annotations[key] = value
+		}
+		podMetadata["annotations"] = annotations
+		policy = p.NetworkPolicy
+	}
+	manifests = append([]map[string]any{{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": dep.ID, "labels": labels},
+		"spec": map[string]any{
+			"replicas": 1,
+			"selector": map[string]any{"matchLabels": labels},
+			"template": map[string]any{"metadata": podMetadata, "spec": podSpec},
+		},
+	}}, manifests...)
+	if policy != nil {
+		manifests = append(manifests, policy)
+	}
+	return manifests, nil
+}
+
+// handleDeploymentManifest serves GET /api/v1/deployments/{id}/manifest, the
+// Kubernetes manifests that run a deployment and its add-ons as YAML
+// documents. Deployments that have not started yet get the manifests they
+// will run with.
+func (s *Server) handleDeploymentManifest(w http.ResponseWriter, r *http.Request) {
+	dep, exists := s.deployments.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	manifests, err := s.deploymentManifests(r.Context(), dep)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, m := range manifests {
+		if err := enc.Encode(m); err != nil {
+			log.Printf("Could not write the manifest of deployment %s: %v", dep.ID, err)
+			return
+		}
+	}
+	enc.Close()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds the control center's metrics, which the admin
+// listener serves.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controlcenter_http_request_duration_seconds",
+		Help:    "Time to answer API requests, by route pattern and status code. WebSocket routes count until the connection closes.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "code"})
+	admissionWait = promauto.With(metricsRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "controlcenter_admission_wait_seconds",
+		Help:    "Time deployment revisions wait in the admission queue before a worker takes them, including retry backoff.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+	admissionDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controlcenter_admission_attempt_duration_seconds",
+		Help:    "Time admission attempts take, by whether they succeeded.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+	kubernetesRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "controlcenter_kubernetes_request_duration_seconds",
+		Help:    "Time Kubernetes API calls take until their response headers arrive, by cluster (\"operator\" or the agent ID of a tunnel), method, and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"cluster", "method", "code"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// registerAdmissionMetrics exports the depth of an admission queue and the
+// number of revisions being admitted.
+func registerAdmissionMetrics(a *Admission) {
+	metricsRegistry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "controlcenter_admission_queue_depth",
+			Help: "Deployment revisions waiting for an admission worker.",
+		}, func() float64 {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return float64(len(a.queue))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "controlcenter_admission_in_flight",
+			Help: "Deployment revisions admission workers are admitting.",
+		}, func() float64 {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return float64(len(a.inFlight))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "controlcenter_admission_workers",
+			Help: "Admission workers.",
+		}, func() float64 { return float64(a.retry.Workers) }),
+	)
+}
+
+// withMetrics observes how long the router's requests take by their route
+// pattern, so that paths with IDs in them are counted together.
+func withMetrics(mux *http.ServeMux) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			httpRequestDuration.WithLabelValues(route, strconv.Itoa(sw.status)).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// instrumentedTransport observes the Kubernetes API calls made to a cluster.
+type instrumentedTransport struct {
+	cluster string
+	next    http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	kubernetesRequestDuration.WithLabelValues(t.cluster, req.Method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// ServeAdmin serves the control center's metrics at /metrics and its
+// profiles at /debug/pprof/ on the address in ADMIN_ADDR, e.g.
+// "127.0.0.1:9090", and on the sockets systemd passed for them. Neither is
+// served otherwise, since profiles expose the process's internals; keep the
+// address off public networks.
+func ServeAdmin(activated []net.Listener) {
+	listeners := activated
+	if addr := os.Getenv("ADMIN_ADDR"); addr != "" {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Failed to start admin server: %v", err)
+		}
+		listeners = append(listeners, lis)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{Registry: metricsRegistry}))
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	for _, lis := range listeners {
+		log.Printf("Admin server with metrics and profiles starting on %s", describeListener(lis))
+		go func() {
+			if err := http.Serve(lis, mux); err != nil {
+				log.Fatalf("Failed to start admin server: %v", err)
+			}
+		}()
+	}
+}
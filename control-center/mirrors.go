@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validateImageRewrites checks rewrite rules and normalizes their prefixes
+// the way image references are normalized, so "index.docker.io" and
+// "docker.io" match the same images.
+func validateImageRewrites(rules []ImageRewrite) error {
+	seen := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		r.From = strings.Trim(r.From, "/")
+		r.To = strings.Trim(r.To, "/")
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("image rewrite %d: from and to are required", i+1)
+		}
+		for _, v := range []string{r.From, r.To} {
+			if strings.Contains(v, "://") || strings.ContainsAny(v, "@ \t") {
+				return fmt.Errorf("image rewrite %d: %q is not a registry or repository prefix", i+1, v)
+			}
+		}
+		r.From = normalizeImagePrefix(r.From)
+		if seen[r.From] {
+			return fmt.Errorf("image rewrite %d: duplicate rule for %s", i+1, r.From)
+		}
+		seen[r.From] = true
+	}
+	return nil
+}
+
+// normalizeImagePrefix normalizes a registry host or repository prefix.
+// Prefixes that do not start with a registry host are below Docker Hub.
+func normalizeImagePrefix(prefix string) string {
+	host, path, _ := strings.Cut(strings.ToLower(prefix), "/")
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		host, path = "docker.io", strings.ToLower(prefix)
+	}
+	if host == "index.docker.io" || host == "registry-1.docker.io" {
+		host = "docker.io"
+	}
+	if path == "" {
+		return host
+	}
+	return host + "/" + path
+}
+
+// rewriteImage applies the rule with the longest matching prefix to an image
+// reference, keeping its tag and digest. References no rule matches are
+// returned unchanged.
+func rewriteImage(ref string, rules []ImageRewrite) string {
+	if len(rules) == 0 {
+		return ref
+	}
+	name, suffix := ref, ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, suffix = name[:i], name[i:]+suffix
+	}
+	full := strings.TrimSuffix(normalizeImageRef(name), ":latest")
+
+	var match *ImageRewrite
+	for i, r := range rules {
+		if (full == r.From || strings.HasPrefix(full, r.From+"/")) && (match == nil || len(r.From) > len(match.From)) {
+			match = &rules[i]
+		}
+	}
+	if match == nil {
+		return ref
+	}
+	return match.To + strings.TrimPrefix(full, match.From) + suffix
+}
+
+// SetImageRewrites replaces an agent's image rewrite rules. It returns false
+// if the agent does not exist or was deleted.
+func (s *AgentStore) SetImageRewrites(id string, rules []ImageRewrite) (*Agent, bool) {
+	s.Lock()
+	defer s.Unlock()
+	agent, exists := s.agents[id]
+	if !exists || agent.ArchivedAt != nil {
+		return nil, false
+	}
+	agent.ImageRewrites = rules
+	s.revision++
+	return cloneAgent(agent), true
+}
+
+// imageRewrites returns the agent's image rewrite rules.
+func (s *AgentStore) imageRewrites(id string) []ImageRewrite {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		return agent.ImageRewrites
+	}
+	return nil
+}
+
+// handleSetImageRewrites serves PUT /api/v1/agents/{id}/image-rewrites,
+// which replaces the rules the agent's images are rewritten with.
+func (s *Server) handleSetImageRewrites(w http.ResponseWriter, r *http.Request) {
+	var rules []ImageRewrite
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		invalidBody(w, err, "Invalid request body: expected a list of image rewrites")
+		return
+	}
+	if err := validateImageRewrites(rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	agent, ok := s.agents.SetImageRewrites(r.PathValue("id"), rules)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	logf(r.Context(), "Agent %s now has %d image rewrite rules", agent.ID, len(rules))
+	json.NewEncoder(w).Encode(agent)
+}
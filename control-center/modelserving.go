@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// modelServer is an inference server that model serving deployments can
+// run.
+type modelServer struct {
+	image         string   // Used unless the request sets image_url or bundle
+	port          int      // Port the server's OpenAI-compatible API listens on
+	quantizations []string // Supported quantization methods
+}
+
+// modelServers lists the supported inference servers by name.
+var modelServers = map[string]modelServer{
+	"vllm": {image: "vllm/vllm-openai:latest", port: 8000, quantizations: []string{"awq", "gptq", "fp8", "bitsandbytes"}},
+	"tgi":  {image: "ghcr.io/huggingface/text-generation-inference:latest", port: 80, quantizations: []string{"awq", "gptq", "eetq", "fp8", "bitsandbytes"}},
+}
+
+// expandModelServing checks a model serving request and fills in its
+// defaults: the server, the GPU count, the model and share of requests a
+// shadow receives, the server's image if the request has none, and a GPU
+// request matching the GPUs the model is sharded across.
+func expandModelServing(req *DeploymentRequest) error {
+	m := req.ModelServing
+	if m == nil {
+		return nil
+	}
+	if m.Server == "" {
+		m.Server = "vllm"
+	}
+	server, ok := modelServers[m.Server]
+	if !ok {
+		return errors.New("model_serving server must be vllm or tgi")
+	}
+	if m.Model == "" || strings.ContainsAny(m.Model, " \t\n") {
+		return errors.New("model_serving model is required and must not contain whitespace")
+	}
+	if m.Quantization != "" && !slices.Contains(server.quantizations, m.Quantization) {
+		return fmt.Errorf("model_serving quantization %s is not supported by %s; use one of %s", m.Quantization, m.Server, strings.Join(server.quantizations, ", "))
+	}
+	if m.GPUs == 0 {
+		m.GPUs = 1
+	}
+	if m.GPUs < 0 || m.MaxContextLength < 0 {
+		return errors.New("model_serving gpus and max_context_length must not be negative")
+	}
+	if s := m.Shadow; s != nil {
+		if s.Model == "" {
+			s.Model = m.Model
+		}
+		if strings.ContainsAny(s.Model, " \t\n") {
+			return errors.New("model_serving shadow model must not contain whitespace")
+		}
+		if s.Percent == 0 {
+			s.Percent = 100
+		}
+		if s.Percent < 0 || s.Percent > 100 {
+			return errors.New("model_serving shadow percent must be between 1 and 100")
+		}
+	}
+	if req.ImageURL == "" && req.Bundle == "" {
+		req.ImageURL = server.image
+	}
+	resources := Resources{GPU: m.GPUs}
+	if req.Resources != nil {
+		resources = *req.Resources
+	}
+	switch resources.GPU {
+	case 0:
+		resources.GPU = m.GPUs
+	case m.GPUs:
+	default:
+		return fmt.Errorf("resources gpu %d does not match model_serving gpus %d", resources.GPU, m.GPUs)
+	}
+	req.Resources = &resources
+	return nil
+}
+
+// modelServingArgs returns the container arguments that start the model
+// server of an expanded model serving request.
+func modelServingArgs(m *ModelServing) []string {
+	port := strconv.Itoa(modelServers[m.Server].port)
+	gpus := strconv.Itoa(m.GPUs)
+	var args []string
+	switch m.Server {
+	case "vllm":
+		args = []string{"--model", m.Model, "--tensor-parallel-size", gpus, "--port", port}
+		if m.MaxContextLength > 0 {
+			args = append(args, "--max-model-len", strconv.Itoa(m.MaxContextLength))
+		}
+		if m.Quantization != "" {
+			args = append(args, "--quantization", m.Quantization)
+		}
+	case "tgi":
+		args = []string{"--model-id", m.Model, "--num-shard", gpus, "--port", port}
+		if m.MaxContextLength > 0 {
+			args = append(args, "--max-total-tokens", strconv.Itoa(m.MaxContextLength))
+		}
+		if m.Quantization != "" {
+			args = append(args, "--quantize", m.Quantization)
+		}
+	}
+	return args
+}
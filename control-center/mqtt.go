@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT topics, below a configurable prefix:
+//
+//	<prefix>/register/<token>        Agents publish a StreamRegister; <token> is chosen by the agent
+//	<prefix>/register/<token>/reply  The control center replies with a ControlMessage carrying the agent ID
+//	<prefix>/agents/<id>/up          Agents publish AgentMessages with heartbeats and status reports
+//	<prefix>/agents/<id>/down        The control center publishes ControlMessages; deployments are retained
+const (
+	defaultMQTTTopicPrefix = "edge"
+	mqttQoS                = 1 // At least once; agents handle repeated messages
+)
+
+// MQTTBridge serves agents that talk to the control center through an MQTT
+// broker instead of the gRPC stream. It shares registration, status handling,
+// and the deployment messages with the AgentService.
+type MQTTBridge struct {
+	svc    *AgentService
+	client mqtt.Client
+	prefix string
+
+	mu       sync.Mutex
+	watching map[string]bool // Agents whose deployments are published
+}
+
+// NewMQTTBridgeFromEnv configures the MQTT bridge from the MQTT_BROKER_URL
+// (e.g. tcp://broker:1883), MQTT_USERNAME, MQTT_PASSWORD, and
+// MQTT_TOPIC_PREFIX ("edge") environment variables. It returns nil if no
+// broker is set.
+func NewMQTTBridgeFromEnv(svc *AgentService) (*MQTTBridge, error) {
+	broker := os.Getenv("MQTT_BROKER_URL")
+	if broker == "" {
+		return nil, nil
+	}
+	prefix := strings.Trim(os.Getenv("MQTT_TOPIC_PREFIX"), "/")
+	if prefix == "" {
+		prefix = defaultMQTTTopicPrefix
+	}
+	if strings.ContainsAny(prefix, "+#") {
+		return nil, fmt.Errorf("invalid MQTT_TOPIC_PREFIX %q: must not contain wildcards", prefix)
+	}
+	b := &MQTTBridge{svc: svc, prefix: prefix, watching: make(map[string]bool)}
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID("control-center").
+		SetUsername(os.Getenv("MQTT_USERNAME")).
+		SetPassword(os.Getenv("MQTT_PASSWORD")).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(30 * time.Second).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT: connection to broker lost: %v", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	return b, nil
+}
+
+// Start connects to the broker in the background, retrying until it succeeds.
+func (b *MQTTBridge) Start() {
+	log.Printf("MQTT: connecting to broker with topic prefix %s", b.prefix)
+	b.client.Connect()
+}
+
+// onConnect subscribes to agent topics whenever the connection is
+// established, since the broker forgets subscriptions of clean sessions.
+func (b *MQTTBridge) onConnect(c mqtt.Client) {
+	log.Printf("MQTT: connected to broker")
+	subs := map[string]byte{
+		b.prefix + "/register/+":  mqttQoS,
+		b.prefix + "/agents/+/up": mqttQoS,
+	}
+	if token := c.SubscribeMultiple(subs, b.onMessage); token.Wait() && token.Error() != nil {
+		log.Printf("MQTT: could not subscribe to agent topics: %v", token.Error())
+	}
+}
+
+// onMessage dispatches a message from an agent by its topic.
+func (b *MQTTBridge) onMessage(_ mqtt.Client, m mqtt.Message) {
+	parts := strings.Split(strings.TrimPrefix(m.Topic(), b.prefix+"/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "register":
+		b.handleRegister(parts[1], m.Payload())
+	case len(parts) == 3 && parts[0] == "agents" && parts[2] == "up":
+		b.handleUp(parts[1], m.Payload())
+	}
+}
+
+// handleRegister registers an agent and replies with its ID.
+func (b *MQTTBridge) handleRegister(token string, payload []byte) {
+	var req StreamRegister
+	reply := &ControlMessage{}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		reply.Error = &StreamError{Message: "invalid registration"}
+	} else if registered, err := b.svc.register(req); err != nil {
+		reply.Error = &StreamError{Message: err.Error()}
+	} else {
+		reply.Registered = registered
+		b.watch(registered.AgentID)
+		// The agent may have missed operations while it was away.
+		defer b.publishOperations(registered.AgentID, true)
+	}
+	b.publish(b.prefix+"/register/"+token+"/reply", false, reply)
+}
+
+// handleUp acts on a heartbeat, status report, or sync request from an agent,
+// and answers a heartbeat with the digest of the agent's desired state.
+func (b *MQTTBridge) handleUp(agentID string, payload []byte) {
+	var msg AgentMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("MQTT: invalid message from agent %s: %v", agentID, err)
+		return
+	}
+	switch {
+	case msg.Heartbeat != nil:
+		if err := b.svc.agents.heartbeatVersion(agentID, msg.Heartbeat); err != nil {
+			b.publishDown(agentID, &ControlMessage{Error: &StreamError{Message: err.Error()}})
+			return
+		}
+		if !b.svc.agents.Heartbeat(agentID) {
+			b.publishDown(agentID, &ControlMessage{Error: &StreamError{Message: fmt.Sprintf("agent %s not found", agentID)}})
+			return
+		}
+		// The control center may have restarted since the agent registered.
+		b.watch(agentID)
+		b.publishDown(agentID, &ControlMessage{Heartbeat: &StreamHeartbeatReply{DesiredState: b.svc.desiredState(agentID)}})
+	case msg.Sync != nil:
+		log.Printf("MQTT: agent %s asked for its deployments", agentID)
+		b.publishDown(agentID, &ControlMessage{Deployments: b.deploymentsFor(agentID)})
+	case msg.Status != nil:
+		if err := b.svc.reportStatus(agentID, *msg.Status); err != nil {
+			b.publishDown(agentID, &ControlMessage{Error: &StreamError{DeploymentID: msg.Status.DeploymentID, Message: err.Error()}})
+		}
+	case msg.Operation != nil:
+		if err := b.svc.reportOperation(agentID, *msg.Operation); err != nil {
+			log.Printf("MQTT: agent %s: %v", agentID, err)
+		}
+	}
+}
+
+// watch publishes an agent's deployments now and whenever their desired
+// state changes, and its cluster operations, for as long as the control
+// center runs.
+func (b *MQTTBridge) watch(agentID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.watching[agentID] {
+		return
+	}
+	b.watching[agentID] = true
+	changes, _ := b.svc.deployments.Watch(agentID)
+	operations, _ := b.svc.operations.Watch(agentID)
+	go func() {
+		state := b.deploymentsFor(agentID)
+		b.publishDown(agentID, &ControlMessage{Deployments: state})
+		sent := state.DesiredState
+		for {
+			select {
+			case <-changes:
+				if state := b.deploymentsFor(agentID); state.DesiredState != sent {
+					b.publishDown(agentID, &ControlMessage{Deployments: state})
+					sent = state.DesiredState
+				}
+			case <-operations:
+				b.publishOperations(agentID, false)
+			}
+		}
+	}()
+}
+
+// deploymentsFor returns an agent's deployments without secret values. The
+// broker hands the retained deployment list to any client allowed to
+// subscribe to the agent's topic, so secret values are only sent over the
+// gRPC stream, to agents that presented their credential. The desired state
+// digest still covers them, so that it matches the one heartbeat replies name.
+func (b *MQTTBridge) deploymentsFor(agentID string) *StreamDeployments {
+	state := b.svc.deploymentsFor(agentID)
+	state.Secrets = nil
+	return state
+}
+
+// publishOperations sends an agent the cluster operations it has not been
+// sent, and with resend also the ones it has not reported.
+func (b *MQTTBridge) publishOperations(agentID string, resend bool) {
+	for _, op := range b.svc.operations.Take(agentID, resend) {
+		b.publishDown(agentID, &ControlMessage{Operation: &op})
+	}
+}
+
+// publishDown sends a message to an agent. The deployment list is retained so
+// that an agent receives it as soon as it subscribes.
+func (b *MQTTBridge) publishDown(agentID string, msg *ControlMessage) {
+	b.publish(b.prefix+"/agents/"+agentID+"/down", msg.Deployments != nil, msg)
+}
+
+func (b *MQTTBridge) publish(topic string, retained bool, msg *ControlMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("MQTT: could not encode message for %s: %v", topic, err)
+		return
+	}
+	token := b.client.Publish(topic, mqttQoS, retained, payload)
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			log.Printf("MQTT: could not publish to %s: %v", topic, token.Error())
+		}
+	}()
+}
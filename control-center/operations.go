@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// maxCompletedOperations caps the completed cluster operations kept per
+// agent; older ones are forgotten.
+const maxCompletedOperations = 100
+
+// OperationStore keeps the cluster operations sent to agents, oldest first
+// per agent, and signals agent connections when there are new ones to send.
+type OperationStore struct {
+	sync.Mutex
+	byAgent  map[string][]*ClusterOperation
+	watchers map[string]map[chan struct{}]bool // Agent ID to channels signalled when it has new operations
+}
+
+// NewOperationStore returns an empty operation store.
+func NewOperationStore() *OperationStore {
+	return &OperationStore{
+		byAgent:  make(map[string][]*ClusterOperation),
+		watchers: make(map[string]map[chan struct{}]bool),
+	}
+}
+
+// Add queues an operation for its agent.
+func (s *OperationStore) Add(op *ClusterOperation) {
+	s.Lock()
+	defer s.Unlock()
+	s.byAgent[op.AgentID] = append(s.byAgent[op.AgentID], op)
+	for ch := range s.watchers[op.AgentID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// List returns copies of an agent's operations, oldest first.
+func (s *OperationStore) List(agentID string) []ClusterOperation {
+	s.Lock()
+	defer s.Unlock()
+	ops := make([]ClusterOperation, len(s.byAgent[agentID]))
+	for i, op := range s.byAgent[agentID] {
+		ops[i] = *op
+	}
+	return ops
+}
+
+// Get returns a copy of one of an agent's operations.
+func (s *OperationStore) Get(agentID, id string) (*ClusterOperation, bool) {
+	s.Lock()
+	defer s.Unlock()
+	for _, op := range s.byAgent[agentID] {
+		if op.ID == id {
+			c := *op
+			return &c, true
+		}
+	}
+	return nil, false
+}
+
+// Take marks an agent's pending operations as sent and returns copies of
+// them. With resend, operations that were sent but not completed are
+// returned again, e.g. when the agent reconnects, since it may not have
+// carried them out; agents apply and delete idempotently.
+func (s *OperationStore) Take(agentID string, resend bool) []ClusterOperation {
+	s.Lock()
+	defer s.Unlock()
+	var ops []ClusterOperation
+	for _, op := range s.byAgent[agentID] {
+		if op.Status == "pending" || (resend && op.Status == "sent") {
+			now := time.Now().UTC()
+			op.Status, op.SentAt = "sent", &now
+			ops = append(ops, *op)
+		}
+	}
+	return ops
+}
+
+// Complete records an agent's report of an operation and returns a copy of
+// the completed operation. It fails if the agent has no such operation or
+// already reported it.
+func (s *OperationStore) Complete(agentID string, report StreamOperationResult) (*ClusterOperation, error) {
+	s.Lock()
+	defer s.Unlock()
+	ops := s.byAgent[agentID]
+	for _, op := range ops {
+		if op.ID != report.OperationID {
+			continue
+		}
+		if op.CompletedAt != nil {
+			return nil, fmt.Errorf("operation %s was already reported", op.ID)
+		}
+		now := time.Now().UTC()
+		op.Status, op.Results, op.Error, op.CompletedAt = "succeeded", report.Results, report.Error, &now
+		if report.Error != "" {
+			op.Status = "failed"
+		}
+		for _, r := range report.Results {
+			if r.Result == "failed" {
+				op.Status = "failed"
+			}
+		}
+		c := *op
+		s.trim(agentID)
+		return &c, nil
+	}
+	return nil, fmt.Errorf("operation %s not found", report.OperationID)
+}
+
+// trim forgets an agent's oldest completed operations beyond
+// maxCompletedOperations. The caller must hold the lock.
+func (s *OperationStore) trim(agentID string) {
+	completed := 0
+	for _, op := range s.byAgent[agentID] {
+		if op.CompletedAt != nil {
+			completed++
+		}
+	}
+	kept := s.byAgent[agentID][:0]
+	for _, op := range s.byAgent[agentID] {
+		if op.CompletedAt != nil && completed > maxCompletedOperations {
+			completed--
+			continue
+		}
+		kept = append(kept, op)
+	}
+	s.byAgent[agentID] = kept
+}
+
+// Watch returns a channel that is signalled whenever an agent has new
+// operations, and a function to stop watching.
+func (s *OperationStore) Watch(agentID string) (<-chan struct{}, func()) {
+	s.Lock()
+	defer s.Unlock()
+	ch := make(chan struct{}, 1)
+	if s.watchers[agentID] == nil {
+		s.watchers[agentID] = make(map[chan struct{}]bool)
+	}
+	s.watchers[agentID][ch] = true
+	return ch, func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.watchers[agentID], ch)
+		if len(s.watchers[agentID]) == 0 {
+			delete(s.watchers, agentID)
+		}
+	}
+}
+
+// reportOperation records an agent's report of a cluster operation, and adds
+// its outcome to the timeline of the deployment it was for.
+func (svc *AgentService) reportOperation(agentID string, report StreamOperationResult) error {
+	op, err := svc.operations.Complete(agentID, report)
+	if err != nil {
+		return err
+	}
+	log.Printf("Agent %s: cluster operation %s (%s) %s", agentID, op.ID, op.Action, op.Status)
+	if op.DeploymentID != "" {
+		msg := fmt.Sprintf("Operation %s to %s %d objects in the agent's cluster %s", op.ID, op.Action, len(op.Objects), op.Status)
+		if op.Error != "" {
+			msg += ": " + op.Error
+		}
+		svc.deployments.RecordEvent(op.DeploymentID, "cluster_"+op.Action, msg)
+	}
+	return nil
+}
+
+// parseManifests reads the objects of YAML or JSON documents and checks that
+// each names its API version, kind, and name.
+func parseManifests(manifests string) ([]map[string]any, error) {
+	var objects []map[string]any
+	dec := yaml.NewDecoder(strings.NewReader(manifests))
+	for i := 0; ; i++ {
+		var obj map[string]any
+		if err := dec.Decode(&obj); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		if obj == nil {
+			continue
+		}
+		metadata, _ := obj["metadata"].(map[string]any)
+		if s, _ := obj["apiVersion"].(string); s == "" {
+			return nil, fmt.Errorf("document %d: apiVersion is required", i)
+		}
+		if s, _ := obj["kind"].(string); s == "" {
+			return nil, fmt.Errorf("document %d: kind is required", i)
+		}
+		if s, _ := metadata["name"].(string); s == "" {
+			return nil, fmt.Errorf("document %d: metadata.name is required", i)
+		}
+		objects = append(objects, obj)
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("manifests contain no objects")
+	}
+	return objects, nil
+}
+
+// deploymentManifests renders the Kubernetes manifests that run a deployment
+// and its add-ons.
+func (s *Server) deploymentManifests(ctx context.Context, dep *Deployment) ([]map[string]any, error) {
+	deployments := []Deployment{*dep}
+	for _, a := range dep.Addons {
+		if addon, exists := s.deployments.Get(a.DeploymentID); exists {
+			deployments = append(deployments, *addon)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, egressLookupTimeout)
+	defer cancel()
+	var manifests []map[string]any
+	for _, d := range deployments {
+		m, err := workloadManifests(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m...)
+	}
+	return manifests, nil
+}
+
+// handleCreateOperation serves POST /api/v1/agents/{id}/operations, which
+// queues an apply or delete of Kubernetes objects in the agent's cluster. The
+// agent carries it out against its local Kubernetes API when it is connected,
+// and the operation is answered with 202 before it has.
+func (s *Server) handleCreateOperation(w http.ResponseWriter, r *http.Request) {
+	agentID := r.PathValue("id")
+	agent, exists := s.agents.Get(agentID)
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	if agent.ArchivedAt != nil {
+		http.Error(w, fmt.Sprintf("Agent %s is archived", agentID), http.StatusConflict)
+		return
+	}
+	var req ClusterOperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.Action != "apply" && req.Action != "delete" {
+		http.Error(w, "Action must be apply or delete", http.StatusBadRequest)
+		return
+	}
+
+	var objects []map[string]any
+	var err error
+	switch {
+	case req.Manifests != "":
+		if objects, err = parseManifests(req.Manifests); err != nil {
+			http.Error(w, "Invalid manifests: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	case req.DeploymentID != "":
+		dep, exists := s.deployments.Get(req.DeploymentID)
+		if !exists || dep.AgentID != agentID {
+			http.Error(w, fmt.Sprintf("Agent %s has no deployment %s", agentID, req.DeploymentID), http.StatusBadRequest)
+			return
+		}
+		if objects, err = s.deploymentManifests(r.Context(), dep); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "Manifests or deployment_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.Action == "delete" {
+		// Dependents go first, e.g. a Deployment before the claims it
+		// mounts.
+		for i, j := 0, len(objects)-1; i < j; i, j = i+1, j-1 {
+			objects[i], objects[j] = objects[j], objects[i]
+		}
+	}
+
+	op := &ClusterOperation{
+		ID:           fmt.Sprintf("op-%s", uuid.New().String()[:8]),
+		AgentID:      agentID,
+		Action:       req.Action,
+		Namespace:    req.Namespace,
+		DeploymentID: req.DeploymentID,
+		Objects:      objects,
+		Status:       "pending",
+		CreatedAt:    time.Now().UTC(),
+	}
+	s.operations.Add(op)
+	logf(r.Context(), "Agent %s: queued cluster operation %s to %s %d objects", agentID, op.ID, op.Action, len(objects))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(op)
+}
+
+// handleListOperations serves GET /api/v1/agents/{id}/operations, the agent's
+// recent cluster operations, oldest first.
+func (s *Server) handleListOperations(w http.ResponseWriter, r *http.Request) {
+	agentID := r.PathValue("id")
+	if _, exists := s.agents.Get(agentID); !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s.operations.List(agentID))
+}
+
+// handleGetOperation serves GET /api/v1/agents/{id}/operations/{op}.
+func (s *Server) handleGetOperation(w http.ResponseWriter, r *http.Request) {
+	op, exists := s.operations.Get(r.PathValue("id"), r.PathValue("op"))
+	if !exists {
+		http.Error(w, "Operation not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(op)
+}
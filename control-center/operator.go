@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"edge-orchestration/api/types"
+	"errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// operatorResyncInterval is how often the status of ControlCenterDeployments
+	// is refreshed from their deployments.
+	operatorResyncInterval = 10 * time.Second
+	operatorTimeout        = 30 * time.Second
+)
+
+// controlCenterDeployments identifies the ControlCenterDeployment custom resource.
+var controlCenterDeployments = schema.GroupVersionResource{
+	Group:    "edgeorchestration.io",
+	Version:  "v1alpha1",
+	Resource: "controlcenterdeployments",
+}
+
+// ControlCenterDeploymentSpec is the spec of a ControlCenterDeployment. It
+// mirrors DeploymentRequest with Kubernetes field names.
+type ControlCenterDeploymentSpec struct {
+	AgentID    string `json:"agentId"`
+	Image      string `json:"image,omitempty"`
+	Bundle     string `json:"bundle,omitempty"`
+	AutoUpdate bool   `json:"autoUpdate,omitempty"`
+	Project    string `json:"project,omitempty"`
+	Resources  *struct {
+		CPU    string `json:"cpu,omitempty"`
+		Memory string `json:"memory,omitempty"`
+		GPU    int    `json:"gpu,omitempty"`
+	} `json:"resources,omitempty"`
+	Configs []struct {
+		Name      string `json:"name"`
+		MountPath string `json:"mountPath,omitempty"`
+		Env       bool   `json:"env,omitempty"`
+	} `json:"configs,omitempty"`
+	TTLSeconds int `json:"ttlSeconds,omitempty"`
+}
+
+// request converts the spec to the request the REST API would receive.
+func (spec *ControlCenterDeploymentSpec) request() DeploymentRequest {
+	req := DeploymentRequest{DeploymentRequest: types.DeploymentRequest{
+		AgentID:    spec.AgentID,
+		ImageURL:   spec.Image,
+		Bundle:     spec.Bundle,
+		AutoUpdate: spec.AutoUpdate,
+		Project:    spec.Project,
+		TTLSeconds: spec.TTLSeconds,
+	}}
+	if r := spec.Resources; r != nil {
+		req.Resources = &Resources{CPU: r.CPU, Memory: r.Memory, GPU: r.GPU}
+	}
+	for _, c := range spec.Configs {
+		req.Configs = append(req.Configs, ConfigRef{Name: c.Name, MountPath: c.MountPath, Env: c.Env})
+	}
+	return req
+}
+
+// ControlCenterDeploymentStatus is written back to a ControlCenterDeployment.
+type ControlCenterDeploymentStatus struct {
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"` // Generation the deployment was created from
+	DeploymentID       string `json:"deploymentId,omitempty"`
+	Phase              string `json:"phase,omitempty"` // The deployment's status, "rejected" if the spec was refused, or "frozen" while a freeze holds it back
+	Revision           int    `json:"revision,omitempty"`
+	Reason             string `json:"reason,omitempty"`
+}
+
+// Operator lets platform teams declare deployments as ControlCenterDeployment
+// objects in a Kubernetes cluster. It creates deployments through the same
+// validation, policies, and quotas as the REST API, replaces a deployment
+// when its object changes, removes it when the object is deleted, and
+// reports the deployment's status on the object.
+type Operator struct {
+	server    *Server
+	client    dynamic.Interface
+	config    *rest.Config
+	namespace string // Watched namespace; all namespaces if empty
+	trigger   chan struct{}
+	rejected  map[string]rejection // Objects whose current generation was refused, by namespace/name
+}
+
+// rejection records why a generation of an object was not deployed, so that
+// it is not retried until the object changes.
+type rejection struct {
+	generation int64
+	reason     string
+}
+
+// NewOperatorFromEnv creates the operator if KUBERNETES_OPERATOR is "true".
+// It connects to the cluster in KUBECONFIG, or else the cluster it runs in,
+// and watches the namespace in OPERATOR_NAMESPACE, or all namespaces.
+func NewOperatorFromEnv(server *Server) (*Operator, error) {
+	if os.Getenv("KUBERNETES_OPERATOR") != "true" {
+		return nil, nil
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load Kubernetes client configuration: %w", err)
+	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &instrumentedTransport{cluster: "operator", next: rt}
+	})
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Operator{
+		server:    server,
+		client:    client,
+		config:    config,
+		namespace: os.Getenv("OPERATOR_NAMESPACE"),
+		trigger:   make(chan struct{}, 1),
+		rejected:  make(map[string]rejection),
+	}, nil
+}
+
+// Run watches ControlCenterDeployments and reconciles them whenever one
+// changes and on every resync interval. It never returns.
+func (o *Operator) Run() {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(o.client, 10*time.Minute, o.namespace, nil)
+	informer := factory.ForResource(controlCenterDeployments).Informer()
+	kick := func(any) {
+		select {
+		case o.trigger <- struct{}{}:
+		default:
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    kick,
+		UpdateFunc: func(_, obj any) { kick(obj) },
+		DeleteFunc: kick,
+	})
+	factory.Start(make(chan struct{}))
+
+	scope := "all namespaces"
+	if o.namespace != "" {
+		scope = "namespace " + o.namespace
+	}
+	log.Printf("Kubernetes operator: watching ControlCenterDeployments in %s", scope)
+	// Nothing is removed before the full list of objects is known.
+	for !informer.HasSynced() {
+		time.Sleep(time.Second)
+	}
+
+	ticker := time.NewTicker(operatorResyncInterval)
+	defer ticker.Stop()
+	for {
+		o.reconcile(informer.GetStore().List())
+		select {
+		case <-o.trigger:
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile applies every object and removes the deployments of objects that
+// no longer exist.
+func (o *Operator) reconcile(items []any) {
+	ctx, cancel := context.WithTimeout(context.Background(), operatorTimeout)
+	defer cancel()
+
+	exists := make(map[string]bool, len(items))
+	for _, item := range items {
+		obj, ok := item.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		key := obj.GetNamespace() + "/" + obj.GetName()
+		exists[key] = true
+		o.writeStatus(ctx, obj, o.apply(ctx, key, obj))
+	}
+	for _, key := range o.server.deployments.ManagedObjects() {
+		if !exists[key] {
+			o.server.deployments.RemoveObject(key, fmt.Sprintf("ControlCenterDeployment %s deleted", key))
+			log.Printf("Kubernetes operator: removed the deployment of deleted ControlCenterDeployment %s", key)
+		}
+	}
+	for key := range o.rejected {
+		if !exists[key] {
+			delete(o.rejected, key)
+		}
+	}
+}
+
+// apply deploys the current generation of an object unless it already is,
+// and returns the status to report on it.
+func (o *Operator) apply(ctx context.Context, key string, obj *unstructured.Unstructured) ControlCenterDeploymentStatus {
+	generation := obj.GetGeneration()
+	dep, exists := o.server.deployments.ForObject(key)
+	if !exists || dep.ObjectGeneration != generation {
+		if r, rejected := o.rejected[key]; rejected && r.generation == generation {
+			return rejectedStatus(dep, r)
+		}
+		d, err := o.deploy(ctx, key, obj)
+		var freezeErr *FreezeError
+		if errors.As(err, &freezeErr) {
+			// Not remembered as rejected, so that the next resync after the
+			// freeze deploys the generation.
+			return ControlCenterDeploymentStatus{
+				ObservedGeneration: dep.ObjectGeneration,
+				DeploymentID:       dep.ID,
+				Phase:              "frozen",
+				Revision:           dep.Revision,
+				Reason:             err.Error(),
+			}
+		}
+		if err != nil {
+			r := rejection{generation: generation, reason: err.Error()}
+			o.rejected[key] = r
+			log.Printf("Kubernetes operator: ControlCenterDeployment %s generation %d rejected: %v", key, generation, err)
+			return rejectedStatus(dep, r)
+		}
+		delete(o.rejected, key)
+		log.Printf("Kubernetes operator: ControlCenterDeployment %s generation %d deployed as %s", key, generation, d.ID)
+		dep = *d
+	}
+	return ControlCenterDeploymentStatus{
+		ObservedGeneration: dep.ObjectGeneration,
+		DeploymentID:       dep.ID,
+		Phase:              string(dep.Status),
+		Revision:           dep.Revision,
+		Reason:             dep.Reason,
+	}
+}
+
+// rejectedStatus reports a refused generation. The deployment of an earlier
+// generation, if any, keeps running.
+func rejectedStatus(dep Deployment, r rejection) ControlCenterDeploymentStatus {
+	return ControlCenterDeploymentStatus{
+		ObservedGeneration: r.generation,
+		DeploymentID:       dep.ID,
+		Phase:              "rejected",
+		Revision:           dep.Revision,
+		Reason:             r.reason,
+	}
+}
+
+// deploy validates an object's spec like the REST API does and replaces the
+// object's deployment with a new one.
+func (o *Operator) deploy(ctx context.Context, key string, obj *unstructured.Unstructured) (*Deployment, error) {
+	data, err := json.Marshal(obj.Object["spec"])
+	if err != nil {
+		return nil, err
+	}
+	var spec ControlCenterDeploymentSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	req := spec.request()
+	s := o.server
+	if _, err := validateDeploymentRequest(ctx, s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &req); err != nil {
+		return nil, err
+	}
+	return s.deployments.ApplyObject(key, obj.GetGeneration(), req)
+}
+
+// writeStatus updates an object's status if it changed.
+func (o *Operator) writeStatus(ctx context.Context, obj *unstructured.Unstructured, status ControlCenterDeploymentStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	var desired map[string]any
+	if err := json.Unmarshal(data, &desired); err != nil {
+		return
+	}
+	if current, _ := obj.Object["status"].(map[string]any); reflect.DeepEqual(current, desired) {
+		return
+	}
+	updated := obj.DeepCopy()
+	updated.Object["status"] = desired
+	_, err = o.client.Resource(controlCenterDeployments).Namespace(obj.GetNamespace()).UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		// The object changed meanwhile; the next pass retries.
+		log.Printf("Kubernetes operator: could not update status of ControlCenterDeployment %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+}
+
+// ForObject returns a copy of the current deployment of a Kubernetes object.
+func (s *DeploymentStore) ForObject(key string) (Deployment, bool) {
+	s.Lock()
+	defer s.Unlock()
+	var current *Deployment
+	for _, dep := range s.deployments {
+		if dep.KubernetesObject == key && dep.ArchivedAt == nil && dep.Status != "superseded" &&
+			(current == nil || dep.CreatedAt.After(current.CreatedAt)) {
+			current = dep
+		}
+	}
+	if current == nil {
+		return Deployment{}, false
+	}
+	return *cloneDeployment(current), true
+}
+
+// ManagedObjects returns the Kubernetes objects that have unarchived deployments.
+func (s *DeploymentStore) ManagedObjects() []string {
+	s.Lock()
+	defer s.Unlock()
+	seen := make(map[string]bool)
+	var keys []string
+	for _, dep := range s.deployments {
+		if dep.KubernetesObject != "" && dep.ArchivedAt == nil && !seen[dep.KubernetesObject] {
+			seen[dep.KubernetesObject] = true
+			keys = append(keys, dep.KubernetesObject)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ApplyObject creates the deployment for a generation of a Kubernetes object,
+// superseding the deployment of its previous generation. It returns a
+// *FreezeError while either deployment is frozen.
+func (s *DeploymentStore) ApplyObject(key string, generation int64, req DeploymentRequest) (*Deployment, error) {
+	s.Lock()
+	defer s.Unlock()
+	if f := s.frozen(req.Project, req.AgentID); f != nil {
+		return nil, &FreezeError{Freeze: *f}
+	}
+	for _, old := range s.deployments {
+		if old.KubernetesObject == key && old.ArchivedAt == nil && !retired(old.Status) {
+			if f := s.frozen(old.Project, old.AgentID); f != nil {
+				return nil, &FreezeError{Freeze: *f}
+			}
+		}
+	}
+	dep, err := s.create(req)
+	if err != nil {
+		return nil, err
+	}
+	superseded := false
+	for _, old := range s.deployments {
+		if old != dep && old.KubernetesObject == key && old.ArchivedAt == nil && !retired(old.Status) {
+			s.setStatus(old, types.StatusSuperseded)
+			s.recordEvent(old.ID, "superseded", fmt.Sprintf("ControlCenterDeployment %s changed to generation %d", key, generation))
+			superseded = true
+		}
+	}
+	dep.KubernetesObject = key
+	dep.ObjectGeneration = generation
+	if superseded {
+		s.admitQueued()
+	}
+	return cloneDeployment(dep), nil
+}
+
+// RemoveObject tears down and archives the deployments of a deleted
+// Kubernetes object.
+func (s *DeploymentStore) RemoveObject(key, reason string) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().UTC()
+	for _, dep := range s.deployments {
+		if dep.KubernetesObject != key || dep.ArchivedAt != nil {
+			continue
+		}
+		// Frozen deployments are removed by a later reconcile.
+		if s.frozen(dep.Project, dep.AgentID) != nil {
+			continue
+		}
+		if !retired(dep.Status) {
+			s.setStatus(dep, types.StatusRemoved)
+			dep.Reason = reason
+			s.recordEvent(dep.ID, "removed", reason)
+		}
+		dep.ArchivedAt = &now
+		s.recordEvent(dep.ID, "archived", "Deployment archived")
+	}
+	s.admitQueued()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"edge-orchestration/api/types"
+)
+
+// Pause stops a deployment's workload on its agent without deleting the
+// deployment, so that it can be resumed later with the same spec. Paused
+// deployments release their quota. It returns false if the deployment does
+// not exist and an error if it cannot be paused or is not at the expected
+// resource version.
+func (s *DeploymentStore) Pause(id string, expected int, reason string) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if dep.Status == types.StatusPaused {
+		return nil, true, fmt.Errorf("deployment %s is already paused", id)
+	}
+	if !canTransition(dep.Status, types.StatusPaused) {
+		return nil, true, &TransitionError{ID: id, From: dep.Status, To: types.StatusPaused}
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("Revision %d paused", dep.Revision)
+	}
+	s.setStatus(dep, types.StatusPaused)
+	dep.Reason = reason
+	s.recordEvent(id, "paused", reason)
+	log.Printf("Deployment %s paused", id)
+	s.admitQueued()
+	return cloneDeployment(dep), true, nil
+}
+
+// Resume redeploys a paused deployment as a new revision. Like a new
+// deployment, it must fit its quotas again: it returns a *QuotaExceededError
+// if it exceeds a quota that rejects excess deployments, and is queued if it
+// exceeds a queueing quota.
+func (s *DeploymentStore) Resume(id string, expected int) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if dep.Status != "paused" {
+		return nil, true, fmt.Errorf("deployment %s is %s, not paused", id, dep.Status)
+	}
+	requested, _ := requestedAmounts(dep.Resources)
+	req := DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: dep.AgentID, Project: dep.Project}}
+	violations, queue := s.quotaViolations(req, requested)
+	if len(violations) > 0 && !queue {
+		return nil, true, &QuotaExceededError{Violations: violations}
+	}
+
+	// A new revision makes the agent start the workload again.
+	dep.Revision++
+	dep.ImageDigest = ""
+	dep.Reason = ""
+	dep.Scan = nil
+	s.recordEvent(id, "resumed", fmt.Sprintf("Deployment resumed as revision %d", dep.Revision))
+	log.Printf("Deployment %s resumed as revision %d", id, dep.Revision)
+	if len(violations) > 0 {
+		s.setStatus(dep, types.StatusQueued)
+		dep.Reason = (&QuotaExceededError{Violations: violations}).Error()
+		s.recordEvent(id, "queued", dep.Reason)
+	} else {
+		s.start(dep)
+	}
+	return cloneDeployment(dep), true, nil
+}
+
+// handlePauseDeployment stops a deployment's workload until it is resumed.
+func (s *Server) handlePauseDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidBody(w, err, "Invalid request body")
+			return
+		}
+	}
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dep, exists, err := s.deployments.Pause(id, expected, req.Reason)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.admission.Cancel(id)
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handleResumeDeployment redeploys a paused deployment.
+func (s *Server) handleResumeDeployment(w http.ResponseWriter, r *http.Request) {
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dep, exists, err := s.deployments.Resume(id, expected)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
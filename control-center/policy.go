@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+const (
+	// policyIDPrefix namespaces the control center's policies inside OPA.
+	policyIDPrefix = "edge-orchestration/"
+	// admissionDenyPath is the OPA document that collects deny messages.
+	admissionDenyPath = "/v1/data/edge/admission/deny"
+	// maxPolicySize caps the size of a Rego module accepted by the API.
+	maxPolicySize = 256 << 10
+)
+
+// PolicyInput is the document deployment requests are evaluated against,
+// available to policies as `input`.
+type PolicyInput struct {
+	Deployment types.DeploymentRequest `json:"deployment"`
+	Image      imageName               `json:"image"`
+	Agent      *Agent                  `json:"agent,omitempty"`
+}
+
+// PolicyDeniedError lists the reasons a deployment request was rejected.
+type PolicyDeniedError struct {
+	Reasons []string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return "denied by policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// PolicyEngine evaluates deployment requests with Rego policies hosted in an
+// Open Policy Agent server. Policies must declare `package edge.admission` and
+// add a message to the `deny` set for every violation.
+type PolicyEngine struct {
+	addr       string
+	httpClient *http.Client
+}
+
+// NewPolicyEngineFromEnv creates a policy engine for the OPA server at
+// OPA_ADDR. It returns nil if OPA_ADDR is not set.
+func NewPolicyEngineFromEnv() *PolicyEngine {
+	addr := strings.TrimSuffix(os.Getenv("OPA_ADDR"), "/")
+	if addr == "" {
+		return nil
+	}
+	return &PolicyEngine{addr: addr, httpClient: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Evaluate returns a *PolicyDeniedError if any policy denies the input, or
+// another error if the policies could not be evaluated.
+func (e *PolicyEngine) Evaluate(ctx context.Context, input PolicyInput) error {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return fmt.Errorf("could not marshal policy input: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.addr+admissionDenyPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach policy engine: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("policy evaluation failed with status %d: %s", resp.StatusCode, opaErrorMessage(resp.Body))
+	}
+
+	var result struct {
+		Result []interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("could not decode policy decision: %w", err)
+	}
+	if len(result.Result) == 0 {
+		return nil
+	}
+	reasons := make([]string, 0, len(result.Result))
+	for _, r := range result.Result {
+		if msg, ok := r.(string); ok {
+			reasons = append(reasons, msg)
+		} else {
+			b, _ := json.Marshal(r)
+			reasons = append(reasons, string(b))
+		}
+	}
+	sort.Strings(reasons)
+	return &PolicyDeniedError{Reasons: reasons}
+}
+
+// List returns all policies managed by the control center.
+func (e *PolicyEngine) List(ctx context.Context) ([]Policy, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.addr+"/v1/policies", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach policy engine: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing policies failed with status %d: %s", resp.StatusCode, opaErrorMessage(resp.Body))
+	}
+
+	var result struct {
+		Result []struct {
+			ID  string `json:"id"`
+			Raw string `json:"raw"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode policies: %w", err)
+	}
+	policies := []Policy{}
+	for _, p := range result.Result {
+		if id, ok := strings.CutPrefix(p.ID, policyIDPrefix); ok {
+			policies = append(policies, Policy{ID: id, Rego: p.Raw})
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].ID < policies[j].ID })
+	return policies, nil
+}
+
+// Get returns a single policy. It reports false if the policy does not exist.
+func (e *PolicyEngine) Get(ctx context.Context, id string) (*Policy, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.addr+"/v1/policies/"+policyIDPrefix+id, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not reach policy engine: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("getting policy failed with status %d: %s", resp.StatusCode, opaErrorMessage(resp.Body))
+	}
+
+	var result struct {
+		Result struct {
+			Raw string `json:"raw"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, false, fmt.Errorf("could not decode policy: %w", err)
+	}
+	return &Policy{ID: id, Rego: result.Result.Raw}, true, nil
+}
+
+// errInvalidPolicy wraps compile errors reported by OPA for a submitted policy.
+var errInvalidPolicy = errors.New("invalid policy")
+
+// Put creates or replaces a policy. Rego that does not compile is rejected
+// with an error wrapping errInvalidPolicy.
+func (e *PolicyEngine) Put(ctx context.Context, p Policy) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, e.addr+"/v1/policies/"+policyIDPrefix+p.ID, strings.NewReader(p.Rego))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach policy engine: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", errInvalidPolicy, opaErrorMessage(resp.Body))
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("storing policy failed with status %d: %s", resp.StatusCode, opaErrorMessage(resp.Body))
+	}
+	return nil
+}
+
+// Delete removes a policy. It reports false if the policy does not exist.
+func (e *PolicyEngine) Delete(ctx context.Context, id string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, e.addr+"/v1/policies/"+policyIDPrefix+id, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("could not reach policy engine: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("deleting policy failed with status %d: %s", resp.StatusCode, opaErrorMessage(resp.Body))
+}
+
+// opaErrorMessage extracts the human-readable part of an OPA error response.
+func opaErrorMessage(body io.Reader) string {
+	var opaErr struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message  string `json:"message"`
+			Location *struct {
+				Row int `json:"row"`
+			} `json:"location"`
+		} `json:"errors"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(body, 64<<10))
+	if err := json.Unmarshal(data, &opaErr); err != nil {
+		return strings.TrimSpace(string(data))
+	}
+	msgs := []string{opaErr.Message}
+	for _, e := range opaErr.Errors {
+		if e.Location != nil {
+			msgs = append(msgs, fmt.Sprintf("line %d: %s", e.Location.Row, e.Message))
+		} else {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// requirePolicies answers 503 for the policy routes when no policy engine is
+// configured.
+func (s *Server) requirePolicies(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.engine == nil {
+			http.Error(w, "Policy engine is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleListPolicies serves GET /api/v1/policies.
+func (s *Server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.engine.List(r.Context())
+	if err != nil {
+		logf(r.Context(), "Error listing policies: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(policies)
+}
+
+// handleGetPolicy serves GET /api/v1/policies/{id}.
+func (s *Server) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	policy, exists, err := s.engine.Get(r.Context(), id)
+	if err != nil {
+		logf(r.Context(), "Error getting policy %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !exists {
+		http.Error(w, "Policy not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(policy)
+}
+
+// handlePutPolicy serves PUT /api/v1/policies/{id}, which creates or
+// replaces a policy.
+func (s *Server) handlePutPolicy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req struct {
+		Rego string `json:"rego"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPolicySize)).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.Rego == "" {
+		http.Error(w, "rego is required", http.StatusBadRequest)
+		return
+	}
+	policy := Policy{ID: id, Rego: req.Rego}
+	if err := s.engine.Put(r.Context(), policy); err != nil {
+		if errors.Is(err, errInvalidPolicy) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logf(r.Context(), "Error storing policy %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	logf(r.Context(), "Policy %s stored", id)
+	json.NewEncoder(w).Encode(policy)
+}
+
+// handleDeletePolicy serves DELETE /api/v1/policies/{id}.
+func (s *Server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	deleted, err := s.engine.Delete(r.Context(), id)
+	if err != nil {
+		logf(r.Context(), "Error deleting policy %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Policy not found", http.StatusNotFound)
+		return
+	}
+	logf(r.Context(), "Policy %s deleted", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkPolicies evaluates a deployment request and writes an error response
+// if it is not admitted. It reports whether the request may proceed.
+func checkPolicies(w http.ResponseWriter, r *http.Request, engine *PolicyEngine, agents *AgentStore, req types.DeploymentRequest) bool {
+	if code, err := evaluatePolicies(r.Context(), engine, agents, req); err != nil {
+		http.Error(w, err.Error(), code)
+		return false
+	}
+	return true
+}
+
+// evaluatePolicies evaluates a deployment request and returns the HTTP status
+// and error to respond with if it is not admitted.
+func evaluatePolicies(ctx context.Context, engine *PolicyEngine, agents *AgentStore, req types.DeploymentRequest) (int, error) {
+	if engine == nil {
+		return http.StatusOK, nil
+	}
+	input := PolicyInput{Deployment: req, Image: parseImageName(req.ImageURL)}
+	if agent, exists := agents.Get(req.AgentID); exists {
+		input.Agent = agent
+	}
+	var denied *PolicyDeniedError
+	if err := engine.Evaluate(ctx, input); errors.As(err, &denied) {
+		return http.StatusForbidden, err
+	} else if err != nil {
+		logf(ctx, "Error evaluating policies: %v", err)
+		return http.StatusServiceUnavailable, errors.New("Policy evaluation failed")
+	}
+	return http.StatusOK, nil
+}
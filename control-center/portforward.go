@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/rest"
+
+	"edge-orchestration/api/wsconn"
+)
+
+const (
+	// portForwardProtocol is the WebSocket subprotocol of Kubernetes port
+	// forwarding: binary messages whose first byte is the channel.
+	portForwardProtocol = "v4.channel.k8s.io"
+	// portForwardTimeout bounds finding a deployment's pod and connecting to
+	// it.
+	portForwardTimeout = 30 * time.Second
+)
+
+// portForwardUpgrader accepts the WebSocket connections cctl forwards local
+// connections over.
+var portForwardUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin:     func(*http.Request) bool { return true },
+}
+
+// clusterAPI reaches a Kubernetes API server, through an agent's tunnel or
+// directly.
+type clusterAPI struct {
+	name   string   // e.g. "agent 1234's cluster", for messages
+	base   *url.URL // Scheme and host of the API server
+	client *http.Client
+	dialer *websocket.Dialer
+	header http.Header // Credentials, if the connection does not add them
+}
+
+// clusterOf returns how to reach the cluster a deployment of an agent runs
+// in: through the agent's tunnel if it has one open, or else the operator's
+// cluster, where deployments it adopted run.
+func (s *Server) clusterOf(agentID string) (*clusterAPI, error) {
+	if t := s.tunnels.get(agentID); t != nil {
+		return &clusterAPI{
+			name:   fmt.Sprintf("agent %s's cluster", agentID),
+			base:   &url.URL{Scheme: "http", Host: agentID},
+			client: &http.Client{Transport: t.transport},
+			dialer: &websocket.Dialer{
+				NetDialContext: func(context.Context, string, string) (net.Conn, error) {
+					return t.session.Open()
+				},
+				Subprotocols: []string{portForwardProtocol},
+			},
+		}, nil
+	}
+	if s.operator != nil {
+		return s.operator.clusterAPI()
+	}
+	return nil, fmt.Errorf("agent %s has no tunnel open", agentID)
+}
+
+// clusterAPI returns how to reach the operator's cluster. Port forwarding
+// needs its credentials to be a bearer token or a client certificate.
+func (o *Operator) clusterAPI() (*clusterAPI, error) {
+	base, err := url.Parse(o.config.Host)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid Kubernetes API server %q", o.config.Host)
+	}
+	client, err := rest.HTTPClientFor(o.config)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := rest.TLSConfigFor(o.config)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	token := o.config.BearerToken
+	if o.config.BearerTokenFile != "" {
+		// The file is read every time, since service account tokens are
+		// rotated.
+		data, err := os.ReadFile(o.config.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return &clusterAPI{
+		name:   "the operator's cluster",
+		base:   base,
+		client: client,
+		dialer: &websocket.Dialer{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+			Subprotocols:    []string{portForwardProtocol},
+		},
+		header: header,
+	}, nil
+}
+
+// get decodes the JSON response to a GET request to the API server.
+func (c *clusterAPI) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := *c.base
+	u.Path, u.RawQuery = path, query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// objectList is the part of a list of pods or Deployments port forwarding
+// needs.
+type objectList struct {
+	Items []struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Selector struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"selector"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// runningPod returns the namespace and name of a running pod of a deployment:
+// one labeled with it, as the pods of its manifests are, or else one of a
+// Kubernetes Deployment labeled with it, as adopted Deployments are.
+func (c *clusterAPI) runningPod(ctx context.Context, deploymentID string) (string, string, error) {
+	selector := deploymentLabel + "=" + deploymentID
+	namespace, name, err := c.runningPodMatching(ctx, selector)
+	if err != nil || name != "" {
+		return namespace, name, err
+	}
+	var deployments objectList
+	if err := c.get(ctx, "/apis/apps/v1/deployments", url.Values{"labelSelector": {selector}}, &deployments); err != nil {
+		return "", "", fmt.Errorf("could not list Deployments in %s: %w", c.name, err)
+	}
+	for _, d := range deployments.Items {
+		if len(d.Spec.Selector.MatchLabels) == 0 {
+			continue
+		}
+		namespace, name, err := c.runningPodMatching(ctx, formatSelector(d.Spec.Selector.MatchLabels))
+		if err != nil || name != "" {
+			return namespace, name, err
+		}
+	}
+	return "", "", errNoRunningPod
+}
+
+// runningPodMatching returns the namespace and name of a running pod that
+// matches a label selector, or empty strings if none does.
+func (c *clusterAPI) runningPodMatching(ctx context.Context, selector string) (string, string, error) {
+	var pods objectList
+	query := url.Values{"labelSelector": {selector}, "fieldSelector": {"status.phase=Running"}}
+	if err := c.get(ctx, "/api/v1/pods", query, &pods); err != nil {
+		return "", "", fmt.Errorf("could not list pods in %s: %w", c.name, err)
+	}
+	if len(pods.Items) == 0 {
+		return "", "", nil
+	}
+	return pods.Items[0].Metadata.Namespace, pods.Items[0].Metadata.Name, nil
+}
+
+// errNoRunningPod is returned when a deployment has no running pod to forward
+// to.
+var errNoRunningPod = errors.New("no running pod")
+
+// portForward connects to a port of a pod.
+func (c *clusterAPI) portForward(ctx context.Context, namespace, pod string, port int) (*podPortStream, error) {
+	u := *c.base
+	u.Scheme = "ws"
+	if c.base.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	u.Path = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, pod)
+	u.RawQuery = url.Values{"ports": {strconv.Itoa(port)}}.Encode()
+	ws, resp, err := c.dialer.DialContext(ctx, u.String(), c.header)
+	if err != nil {
+		if resp != nil {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("could not forward to pod %s/%s in %s: %s: %s", namespace, pod, c.name, resp.Status, bytes.TrimSpace(msg))
+		}
+		return nil, fmt.Errorf("could not forward to pod %s/%s in %s: %w", namespace, pod, c.name, err)
+	}
+	return &podPortStream{ws: ws}, nil
+}
+
+// podPortStream is the byte stream of a forwarded pod port. Kubernetes sends
+// the data of the port on channel 0 and errors on channel 1, each starting
+// with the port number.
+type podPortStream struct {
+	ws       *websocket.Conn
+	pending  []byte // Data read but not returned yet
+	skipped  [2]int // Bytes of the port number skipped on each channel
+	errorMsg []byte
+}
+
+func (p *podPortStream) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		kind, msg, err := p.ws.ReadMessage()
+		if err != nil {
+			if len(p.errorMsg) > 0 {
+				return 0, errors.New(string(p.errorMsg))
+			}
+			// The API server may drop the connection rather than close it
+			// when the pod closes the port.
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if kind != websocket.BinaryMessage || len(msg) == 0 || msg[0] > 1 {
+			continue
+		}
+		channel, data := msg[0], msg[1:]
+		if skip := min(2-p.skipped[channel], len(data)); skip > 0 {
+			p.skipped[channel] += skip
+			data = data[skip:]
+		}
+		if channel == 1 {
+			p.errorMsg = append(p.errorMsg, data...)
+			continue
+		}
+		p.pending = data
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// Write sends b on the data channel.
+func (p *podPortStream) Write(b []byte) (int, error) {
+	if err := p.ws.WriteMessage(websocket.BinaryMessage, append([]byte{0}, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *podPortStream) Close() error { return p.ws.Close() }
+
+// handleDeploymentPortForward serves GET
+// /api/v1/deployments/{id}/port-forward?port=<port>, which upgrades to a
+// WebSocket carrying one connection to the port of a running pod of the
+// deployment in binary messages. The pod is reached through the agent's
+// tunnel, or in the operator's cluster if the agent has none open.
+func (s *Server) handleDeploymentPortForward(w http.ResponseWriter, r *http.Request) {
+	dep, exists := s.deployments.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if dep.ArchivedAt != nil {
+		http.Error(w, fmt.Sprintf("Deployment %s is archived", dep.ID), http.StatusConflict)
+		return
+	}
+	port, err := strconv.Atoi(r.URL.Query().Get("port"))
+	if err != nil || port < 1 || port > 65535 {
+		http.Error(w, "Port must be a number from 1 to 65535", http.StatusBadRequest)
+		return
+	}
+	cluster, err := s.clusterOf(dep.AgentID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Cannot reach the cluster of deployment %s: %v", dep.ID, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), portForwardTimeout)
+	defer cancel()
+	namespace, pod, err := cluster.runningPod(ctx, dep.ID)
+	if errors.Is(err, errNoRunningPod) {
+		http.Error(w, fmt.Sprintf("Deployment %s has no running pod in %s", dep.ID, cluster.name), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	stream, err := cluster.portForward(ctx, namespace, pod, port)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer stream.Close()
+
+	ws, err := portForwardUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request.
+		logf(r.Context(), "Deployment %s: could not forward port %d: %v", dep.ID, port, err)
+		return
+	}
+	defer ws.Close()
+	logf(r.Context(), "Deployment %s: forwarding a connection to port %d of pod %s/%s in %s", dep.ID, port, namespace, pod, cluster.name)
+
+	conn := wsconn.New(ws)
+	callerDone := make(chan struct{})
+	go func() {
+		io.Copy(stream, conn)
+		close(callerDone)
+		stream.Close()
+	}()
+	_, err = io.Copy(conn, stream)
+	select {
+	case <-callerDone:
+		// The caller closed its connection.
+		return
+	default:
+	}
+	reason := ""
+	code := websocket.CloseNormalClosure
+	if err != nil {
+		code, reason = websocket.CloseInternalServerErr, err.Error()
+		// Close reasons must fit in a control frame.
+		if len(reason) > 120 {
+			reason = reason[:120]
+		}
+		logf(r.Context(), "Deployment %s: port forward to pod %s/%s ended: %v", dep.ID, namespace, pod, err)
+	}
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
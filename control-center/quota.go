@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// resourceAmounts is the parsed, additive form of resource quantities.
+type resourceAmounts struct {
+	deployments int
+	cpuMillis   int64
+	memoryBytes int64
+	gpu         int
+	gpuModel    string // GPU model a single deployment requires, if any; not summed
+}
+
+func (a *resourceAmounts) add(b resourceAmounts) {
+	a.deployments += b.deployments
+	a.cpuMillis += b.cpuMillis
+	a.memoryBytes += b.memoryBytes
+	a.gpu += b.gpu
+}
+
+// requestedAmounts parses the requested resources of a single deployment.
+func requestedAmounts(r *Resources) (resourceAmounts, error) {
+	a := resourceAmounts{deployments: 1}
+	if r == nil {
+		return a, nil
+	}
+	var err error
+	if a.cpuMillis, err = parseCPU(r.CPU); err != nil {
+		return a, err
+	}
+	if a.memoryBytes, err = parseMemory(r.Memory); err != nil {
+		return a, err
+	}
+	if r.GPU < 0 {
+		return a, fmt.Errorf("invalid gpu count %d", r.GPU)
+	}
+	if r.GPUModel != "" && r.GPU == 0 {
+		return a, fmt.Errorf("gpu_model %q requires a gpu count", r.GPUModel)
+	}
+	a.gpu, a.gpuModel = r.GPU, r.GPUModel
+	return a, nil
+}
+
+// parseCPU parses a CPU quantity ("2", "0.5", "500m") into millicores.
+func parseCPU(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if m, ok := strings.CutSuffix(s, "m"); ok {
+		n, err := strconv.ParseInt(m, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid cpu quantity %q", s)
+		}
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid cpu quantity %q", s)
+	}
+	return int64(math.Round(f * 1000)), nil
+}
+
+// memoryUnits maps quantity suffixes to their multiplier in bytes.
+var memoryUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// parseMemory parses a memory quantity ("512Mi", "1G", "1048576") into bytes.
+func parseMemory(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	number, multiplier := s, int64(1)
+	for _, unit := range memoryUnits {
+		if n, ok := strings.CutSuffix(s, unit.suffix); ok {
+			number, multiplier = n, unit.multiplier
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid memory quantity %q", s)
+	}
+	return int64(f * float64(multiplier)), nil
+}
+
+// formatCPU renders millicores as a CPU quantity.
+func formatCPU(millis int64) string {
+	if millis%1000 == 0 {
+		return strconv.FormatInt(millis/1000, 10)
+	}
+	return strconv.FormatInt(millis, 10) + "m"
+}
+
+// formatMemory renders bytes using the largest binary unit that divides them evenly.
+func formatMemory(bytes int64) string {
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"Ti", 1 << 40}, {"Gi", 1 << 30}, {"Mi", 1 << 20}, {"Ki", 1 << 10}} {
+		if bytes != 0 && bytes%unit.multiplier == 0 {
+			return strconv.FormatInt(bytes/unit.multiplier, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// validateQuota checks a quota definition and fills in defaults.
+func validateQuota(q *Quota) error {
+	if q.Scope != "agent" && q.Scope != "project" {
+		return fmt.Errorf("scope must be agent or project")
+	}
+	if q.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if q.OnExceed == "" {
+		q.OnExceed = "reject"
+	}
+	if q.OnExceed != "reject" && q.OnExceed != "queue" {
+		return fmt.Errorf("on_exceed must be reject or queue")
+	}
+	if q.MaxDeployments != nil && *q.MaxDeployments < 0 {
+		return fmt.Errorf("max_deployments must not be negative")
+	}
+	if q.GPU != nil && *q.GPU < 0 {
+		return fmt.Errorf("gpu must not be negative")
+	}
+	if _, err := parseCPU(q.CPU); err != nil {
+		return err
+	}
+	_, err := parseMemory(q.Memory)
+	return err
+}
+
+// exceededLimits describes each limit of a quota that usage plus the
+// requested amounts would exceed.
+func exceededLimits(q *Quota, usage, requested resourceAmounts) []string {
+	var v []string
+	if q.MaxDeployments != nil && usage.deployments+requested.deployments > *q.MaxDeployments {
+		v = append(v, fmt.Sprintf("%s %s allows %d deployments, %d in use", q.Scope, q.Name, *q.MaxDeployments, usage.deployments))
+	}
+	if limit, _ := parseCPU(q.CPU); q.CPU != "" && usage.cpuMillis+requested.cpuMillis > limit {
+		v = append(v, fmt.Sprintf("%s %s allows %s cpu, %s in use", q.Scope, q.Name, q.CPU, formatCPU(usage.cpuMillis)))
+	}
+	if limit, _ := parseMemory(q.Memory); q.Memory != "" && usage.memoryBytes+requested.memoryBytes > limit {
+		v = append(v, fmt.Sprintf("%s %s allows %s memory, %s in use", q.Scope, q.Name, q.Memory, formatMemory(usage.memoryBytes)))
+	}
+	if q.GPU != nil && usage.gpu+requested.gpu > *q.GPU {
+		v = append(v, fmt.Sprintf("%s %s allows %d gpu, %d in use", q.Scope, q.Name, *q.GPU, usage.gpu))
+	}
+	return v
+}
+
+// QuotaExceededError is returned when a deployment request does not fit its quotas.
+type QuotaExceededError struct {
+	Violations []string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return "quota exceeded: " + strings.Join(e.Violations, "; ")
+}
+
+// QuotaStore manages quota definitions. Usage is derived from the deployment store.
+type QuotaStore struct {
+	sync.Mutex
+	quotas map[string]Quota // Keyed by "scope/name"
+}
+
+// NewQuotaStore creates a new in-memory quota store.
+func NewQuotaStore() *QuotaStore {
+	return &QuotaStore{quotas: make(map[string]Quota)}
+}
+
+// Put creates or replaces a quota.
+func (s *QuotaStore) Put(q Quota) {
+	s.Lock()
+	defer s.Unlock()
+	s.quotas[q.Scope+"/"+q.Name] = q
+	log.Printf("Quota for %s %s set", q.Scope, q.Name)
+}
+
+// Get returns the quota for a scope and name.
+func (s *QuotaStore) Get(scope, name string) (Quota, bool) {
+	s.Lock()
+	defer s.Unlock()
+	q, exists := s.quotas[scope+"/"+name]
+	return q, exists
+}
+
+// Delete removes a quota. It reports false if the quota did not exist.
+func (s *QuotaStore) Delete(scope, name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	key := scope + "/" + name
+	if _, exists := s.quotas[key]; !exists {
+		return false
+	}
+	delete(s.quotas, key)
+	log.Printf("Quota for %s %s deleted", scope, name)
+	return true
+}
+
+// List returns all quotas ordered by scope and name.
+func (s *QuotaStore) List() []Quota {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Quota, 0, len(s.quotas))
+	for _, q := range s.quotas {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Scope != list[j].Scope {
+			return list[i].Scope < list[j].Scope
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// applicable returns the quotas that govern a deployment request.
+func (s *QuotaStore) applicable(req DeploymentRequest) []Quota {
+	s.Lock()
+	defer s.Unlock()
+	var list []Quota
+	if q, exists := s.quotas["agent/"+req.AgentID]; exists {
+		list = append(list, q)
+	}
+	if req.Project != "" {
+		if q, exists := s.quotas["project/"+req.Project]; exists {
+			list = append(list, q)
+		}
+	}
+	return list
+}
+
+// handleListQuotas serves GET /api/v1/quotas, every quota with its usage.
+func (s *Server) handleListQuotas(w http.ResponseWriter, r *http.Request) {
+	statuses := []QuotaStatus{}
+	for _, q := range s.quotas.List() {
+		statuses = append(statuses, QuotaStatus{Quota: q, Usage: s.deployments.QuotaUsage(q)})
+	}
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// handleGetQuota serves GET /api/v1/quotas/{scope}/{name}.
+func (s *Server) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	q, exists := s.quotas.Get(r.PathValue("scope"), r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Quota not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(QuotaStatus{Quota: q, Usage: s.deployments.QuotaUsage(q)})
+}
+
+// handlePutQuota serves PUT /api/v1/quotas/{scope}/{name}, which creates or
+// replaces a quota.
+func (s *Server) handlePutQuota(w http.ResponseWriter, r *http.Request) {
+	var q Quota
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	q.Scope, q.Name = r.PathValue("scope"), r.PathValue("name")
+	if err := validateQuota(&q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.quotas.Put(q)
+	// A raised limit may let queued deployments proceed.
+	s.deployments.AdmitQueued()
+	json.NewEncoder(w).Encode(QuotaStatus{Quota: q, Usage: s.deployments.QuotaUsage(q)})
+}
+
+// handleDeleteQuota serves DELETE /api/v1/quotas/{scope}/{name}.
+func (s *Server) handleDeleteQuota(w http.ResponseWriter, r *http.Request) {
+	if !s.quotas.Delete(r.PathValue("scope"), r.PathValue("name")) {
+		http.Error(w, "Quota not found", http.StatusNotFound)
+		return
+	}
+	s.deployments.AdmitQueued()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// refRollout is the progress of rolling a new version of a config or secret
+// out to the deployments that reference it. Deployments are redeployed in
+// creation order, batch at a time, or all at once if batch is 0.
+type refRollout struct {
+	kind        string // "config" or "secret"
+	name        string
+	version     int
+	batch       int
+	state       string // in_progress, completed, or halted
+	updated     []string
+	pending     []string
+	haltedBy    string
+	startedAt   time.Time
+	completedAt *time.Time
+}
+
+// refKinds describes how rollouts of each kind of reference are recorded.
+var refKinds = map[string]struct {
+	title string // Capitalized kind, for messages
+	event string // Event recorded on each redeployed deployment
+	verb  string
+}{
+	"config": {"Config", "config_changed", "changed"},
+	"secret": {"Secret", "secret_rotated", "rotated"},
+}
+
+// refVersion returns the version field of a deployment's reference to the
+// named config or secret that follows its latest version, or nil if the
+// deployment has none.
+func refVersion(dep *Deployment, kind, name string) *int {
+	switch kind {
+	case "config":
+		for i, ref := range dep.Configs {
+			if ref.Name == name && ref.Pin == 0 {
+				return &dep.Configs[i].Version
+			}
+		}
+	case "secret":
+		for i, ref := range dep.Secrets {
+			if ref.Name == name {
+				return &dep.Secrets[i].Version
+			}
+		}
+	}
+	return nil
+}
+
+// startRefRollout starts rolling a version of a config or secret out to the
+// active deployments that follow it, replacing any earlier rollout of it.
+// The caller must hold the lock.
+func (s *DeploymentStore) startRefRollout(kind, name string, version, batch int) *refRollout {
+	var ids []string
+	for _, dep := range s.deployments {
+		if retired(dep.Status) || dep.ArchivedAt != nil {
+			continue
+		}
+		if v := refVersion(dep, kind, name); v != nil && *v != version {
+			ids = append(ids, dep.ID)
+		}
+	}
+	rollout := &refRollout{kind: kind, name: name, version: version, batch: batch, state: "in_progress", updated: []string{}, startedAt: time.Now().UTC()}
+	for _, dep := range s.lookup(ids) {
+		rollout.pending = append(rollout.pending, dep.ID)
+	}
+	s.refRollouts[kind+"/"+name] = rollout
+	s.advanceRefRollout(rollout)
+	return rollout
+}
+
+// advanceRefRollout redeploys the pending deployments of a rollout that its
+// batch size allows, and completes the rollout once none are left. If a
+// deployment redeployed with the version failed, the rollout halts. The
+// caller must hold the lock.
+func (s *DeploymentStore) advanceRefRollout(rollout *refRollout) {
+	if rollout.state != "in_progress" {
+		return
+	}
+	kind := refKinds[rollout.kind]
+	starting := 0
+	for _, id := range rollout.updated {
+		dep, exists := s.deployments[id]
+		if !exists {
+			continue
+		}
+		switch dep.Status {
+		case "failed":
+			rollout.state, rollout.haltedBy = "halted", id
+			for _, pending := range rollout.pending {
+				s.recordEvent(pending, rollout.kind+"_rollout_halted", fmt.Sprintf("Rollout of %s %s version %d halted: deployment %s failed with it", rollout.kind, rollout.name, rollout.version, id))
+			}
+			log.Printf("Rollout of %s %s version %d halted, deployment %s failed with it", rollout.kind, rollout.name, rollout.version, id)
+			return
+		case "waiting", "pending", "scheduled", "deploying":
+			starting++
+		}
+	}
+
+	var pending []string
+	for _, id := range rollout.pending {
+		dep, exists := s.deployments[id]
+		if !exists || retired(dep.Status) || dep.ArchivedAt != nil {
+			continue
+		}
+		v := refVersion(dep, rollout.kind, rollout.name)
+		if v == nil || *v == rollout.version {
+			continue
+		}
+		if rollout.batch > 0 && starting >= rollout.batch || s.frozen(dep.Project, dep.AgentID) != nil {
+			pending = append(pending, id)
+			continue
+		}
+		previous := *v
+		*v = rollout.version
+		dep.Revision++
+		dep.ImageDigest = ""
+		dep.Reason = ""
+		dep.Scan = nil
+		s.recordEvent(dep.ID, kind.event, fmt.Sprintf("%s %s %s from version %d to %d, redeploying as revision %d", kind.title, rollout.name, kind.verb, previous, rollout.version, dep.Revision))
+		log.Printf("Deployment %s rolling out %s %s version %d as revision %d", dep.ID, rollout.kind, rollout.name, rollout.version, dep.Revision)
+		if dep.Status != "queued" && dep.Status != "deferred" {
+			s.start(dep)
+			starting++
+		}
+		rollout.updated = append(rollout.updated, id)
+	}
+	rollout.pending = pending
+	if len(pending) == 0 {
+		now := time.Now().UTC()
+		rollout.state, rollout.completedAt = "completed", &now
+		log.Printf("Rollout of %s %s version %d completed with %d deployments", rollout.kind, rollout.name, rollout.version, len(rollout.updated))
+	}
+}
+
+// advanceRefRollouts advances every config and secret rollout in progress.
+// The caller must hold the lock.
+func (s *DeploymentStore) advanceRefRollouts() {
+	for _, rollout := range s.refRollouts {
+		s.advanceRefRollout(rollout)
+	}
+}
+
+// configRollout returns the rollout as reported by the configs API.
+func (r *refRollout) configRollout() ConfigRollout {
+	return ConfigRollout{
+		Config:      r.name,
+		Version:     r.version,
+		BatchSize:   r.batch,
+		State:       r.state,
+		Updated:     slices.Clone(r.updated),
+		Pending:     append([]string{}, r.pending...),
+		HaltedBy:    r.haltedBy,
+		StartedAt:   r.startedAt,
+		CompletedAt: r.completedAt,
+	}
+}
+
+// secretRollout returns the rollout as reported by the secrets API.
+func (r *refRollout) secretRollout() SecretRollout {
+	return SecretRollout{
+		Secret:      r.name,
+		Version:     r.version,
+		BatchSize:   r.batch,
+		State:       r.state,
+		Updated:     slices.Clone(r.updated),
+		Pending:     append([]string{}, r.pending...),
+		HaltedBy:    r.haltedBy,
+		StartedAt:   r.startedAt,
+		CompletedAt: r.completedAt,
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestMediaTypes are the manifest formats accepted when resolving a tag.
+// Index types come first so multi-arch images resolve to their index digest.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// imageName is a parsed image reference.
+type imageName struct {
+	Registry   string `json:"registry"`   // e.g., "docker.io", "ghcr.io", "localhost:5000"
+	Repository string `json:"repository"` // e.g., "library/nginx"
+	Tag        string `json:"tag"`
+}
+
+// parseImageName splits a reference into registry, repository, and tag using
+// the same defaults as normalizeImageRef.
+func parseImageName(ref string) imageName {
+	normalized := normalizeImageRef(ref)
+	i := strings.LastIndex(normalized, ":")
+	name, tag := normalized[:i], normalized[i+1:]
+	j := strings.Index(name, "/")
+	return imageName{Registry: name[:j], Repository: name[j+1:], Tag: tag}
+}
+
+// pinnedImageRef returns the reference that pulls exactly the given digest of
+// an image, or the image URL unchanged if there is no digest.
+func pinnedImageRef(imageURL, digest string) string {
+	if digest == "" || strings.Contains(imageURL, "@") {
+		return imageURL
+	}
+	name := imageURL
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + "@" + digest
+}
+
+// RegistryClient talks to OCI distribution (Docker Registry v2) APIs.
+type RegistryClient struct {
+	httpClient *http.Client
+	breaker    *circuitBreaker
+	auths      map[string]string // registry host -> base64 "user:password"
+}
+
+// NewRegistryClient creates a registry client that authenticates with the
+// credentials found in the Docker config file, if any.
+func NewRegistryClient() *RegistryClient {
+	return &RegistryClient{
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		breaker:    newCircuitBreaker(),
+		auths:      loadDockerAuths(),
+	}
+}
+
+// unavailableError is a registry failure that says nothing about the image,
+// such as a network error or a 5xx response.
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string { return e.err.Error() }
+func (e *unavailableError) Unwrap() error { return e.err }
+
+// ResolveDigest returns the content digest that a tagged image currently
+// points to. Registries that keep failing are not contacted until their
+// circuit breaker lets a probe through.
+func (c *RegistryClient) ResolveDigest(ctx context.Context, ref string) (string, error) {
+	img := parseImageName(ref)
+	if err := c.breaker.allow(img.Registry); err != nil {
+		return "", err
+	}
+	digest, err := c.resolveDigest(ctx, ref, img)
+	var unavailable *unavailableError
+	if errors.As(err, &unavailable) {
+		c.breaker.record(img.Registry, err)
+	} else {
+		c.breaker.record(img.Registry, nil)
+	}
+	return digest, err
+}
+
+func (c *RegistryClient) resolveDigest(ctx context.Context, ref string, img imageName) (string, error) {
+	endpoint := fmt.Sprintf("%s/v2/%s/manifests/%s", registryBaseURL(img.Registry), img.Repository, img.Tag)
+
+	resp, err := c.do(ctx, http.MethodHead, endpoint, img)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+			return digest, nil
+		}
+	}
+
+	// Some registries omit the digest header on HEAD; fall back to hashing the manifest.
+	resp, err = c.do(ctx, http.MethodGet, endpoint, img)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return "", &unavailableError{fmt.Errorf("registry returned status %d for %s", resp.StatusCode, ref)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry returned status %d for %s", resp.StatusCode, ref)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not read manifest for %s: %w", ref, err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(body)), nil
+}
+
+// maxTagPages caps how many pages of a repository's tag list are fetched.
+const maxTagPages = 20
+
+// ListTags returns the tags of an image's repository, following the
+// registry's pagination links.
+func (c *RegistryClient) ListTags(ctx context.Context, ref string) ([]string, error) {
+	img := parseImageName(ref)
+	if err := c.breaker.allow(img.Registry); err != nil {
+		return nil, err
+	}
+	tags, err := c.listTags(ctx, img)
+	var unavailable *unavailableError
+	if errors.As(err, &unavailable) {
+		c.breaker.record(img.Registry, err)
+	} else {
+		c.breaker.record(img.Registry, nil)
+	}
+	return tags, err
+}
+
+func (c *RegistryClient) listTags(ctx context.Context, img imageName) ([]string, error) {
+	base := registryBaseURL(img.Registry)
+	endpoint := fmt.Sprintf("%s/v2/%s/tags/list", base, img.Repository)
+	var tags []string
+	for page := 0; endpoint != "" && page < maxTagPages; page++ {
+		resp, err := c.do(ctx, http.MethodGet, endpoint, img)
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		if resp.StatusCode >= 500 {
+			err = &unavailableError{fmt.Errorf("registry returned status %d listing tags of %s", resp.StatusCode, img.Repository)}
+		} else if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("registry returned status %d listing tags of %s", resp.StatusCode, img.Repository)
+		} else if err = json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(&list); err != nil {
+			err = fmt.Errorf("could not decode tags of %s: %w", img.Repository, err)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, list.Tags...)
+		endpoint = nextPageURL(base, resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// nextPageURL returns the URL of the next page from a Link header such as
+// `</v2/library/nginx/tags/list?last=1.25&n=100>; rel="next"`, or "" if
+// there is none.
+func nextPageURL(base, link string) string {
+	target, params, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	target = strings.Trim(strings.TrimSpace(target), "<>")
+	if strings.HasPrefix(target, "/") {
+		return base + target
+	}
+	return target
+}
+
+// do sends a manifest request, completing a bearer token challenge if the registry asks for one.
+func (c *RegistryClient) do(ctx context.Context, method, endpoint string, img imageName) (*http.Response, error) {
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, &unavailableError{fmt.Errorf("could not reach registry %s: %w", img.Registry, err)}
+		}
+		return resp, nil
+	}
+
+	authorization := ""
+	if auth, ok := c.auths[img.Registry]; ok {
+		authorization = "Basic " + auth
+	}
+	resp, err := send(authorization)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("registry %s requires authentication", img.Registry)
+	}
+	token, err := c.fetchToken(ctx, challenge, img)
+	if err != nil {
+		return nil, err
+	}
+	return send("Bearer " + token)
+}
+
+// fetchToken obtains a pull token from the realm named in a WWW-Authenticate challenge.
+func (c *RegistryClient) fetchToken(ctx context.Context, challenge string, img imageName) (string, error) {
+	params := parseAuthChallenge(challenge[len("bearer "):])
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("registry auth challenge has no realm")
+	}
+
+	q := url.Values{}
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", img.Repository)
+	}
+	q.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth, ok := c.auths[img.Registry]; ok {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", &unavailableError{fmt.Errorf("could not request registry token: %w", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("could not decode registry token: %w", err)
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+// parseAuthChallenge parses the key="value" pairs of a WWW-Authenticate header.
+func parseAuthChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		s = strings.TrimLeft(s, ", ")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if comma := strings.Index(s, ","); comma >= 0 {
+			value, s = s[:comma], s[comma:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// registryBaseURL maps a registry name to the URL of its API.
+func registryBaseURL(registry string) string {
+	if registry == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	if strings.HasPrefix(registry, "localhost") || strings.HasPrefix(registry, "127.0.0.1") {
+		return "http://" + registry
+	}
+	return "https://" + registry
+}
+
+// loadDockerAuths reads registry credentials from $DOCKER_CONFIG/config.json
+// (or ~/.docker/config.json). Missing or unreadable files yield no credentials.
+func loadDockerAuths() map[string]string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil
+	}
+
+	auths := make(map[string]string)
+	for host, entry := range config.Auths {
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+		host = strings.SplitN(host, "/", 2)[0]
+		if host == "index.docker.io" || host == "registry-1.docker.io" {
+			host = "docker.io"
+		}
+		switch {
+		case entry.Auth != "":
+			auths[host] = entry.Auth
+		case entry.Username != "":
+			auths[host] = base64.StdEncoding.EncodeToString([]byte(entry.Username + ":" + entry.Password))
+		}
+	}
+	return auths
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// requestIDHeader carries the ID of an API call in requests and responses.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds client-supplied request IDs.
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// withRequestID gives every API call an ID, taken from the caller's
+// X-Request-ID header if it is valid or generated otherwise. The ID is
+// returned in the X-Request-ID response header, including on errors, and is
+// logged with the outcome of the call so that a failure a user reports can be
+// found in the logs.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		logf(r.Context(), "%s %s %d %s", r.Method, r.URL.Path, sw.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to log
+// and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the ID of the API call ctx belongs to, if any.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logf logs a message about the API call ctx belongs to, prefixed with its
+// request ID.
+func logf(ctx context.Context, format string, args ...any) {
+	if id := requestID(ctx); id != "" {
+		format = "[" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultHookTimeout bounds a hook run unless the hook sets a timeout.
+	defaultHookTimeout = 5 * time.Minute
+	// maxHookResponse is how much of a failed webhook's response is kept as
+	// the reason.
+	maxHookResponse = 512
+)
+
+// validateHooks checks the hooks of a rollout request and fills in their
+// default timeouts.
+func validateHooks(hooks []RolloutHook) error {
+	names := make(map[string]bool, len(hooks))
+	for i := range hooks {
+		h := &hooks[i]
+		if !validAddonName(h.Name) {
+			return fmt.Errorf("invalid hook name %q: names must start with a letter and may only contain lowercase letters, digits, and dashes", h.Name)
+		}
+		if names[h.Name] {
+			return fmt.Errorf("hook %s is declared more than once", h.Name)
+		}
+		names[h.Name] = true
+		if h.Phase != "pre" && h.Phase != "post" {
+			return fmt.Errorf("hook %s: phase must be pre or post", h.Name)
+		}
+		if (h.Webhook == "") == (h.Job == nil) {
+			return fmt.Errorf("hook %s must set either webhook or job", h.Name)
+		}
+		if h.Webhook != "" {
+			u, err := url.Parse(h.Webhook)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("hook %s: invalid webhook URL %q", h.Name, h.Webhook)
+			}
+		}
+		if h.Job != nil && h.Job.Image == "" {
+			return fmt.Errorf("hook %s: job image is required", h.Name)
+		}
+		if h.TimeoutSeconds < 0 {
+			return fmt.Errorf("hook %s: timeout_seconds must not be negative", h.Name)
+		}
+		if h.TimeoutSeconds == 0 {
+			h.TimeoutSeconds = int(defaultHookTimeout / time.Second)
+		}
+	}
+	return nil
+}
+
+// startHooks starts the rollout's hooks of a phase for its current wave and
+// reports whether it has any. The caller must hold the lock.
+func (m *Rollouts) startHooks(r *Rollout, w *RolloutWave, phase string, now time.Time) bool {
+	started := false
+	for _, h := range r.Hooks {
+		if h.Phase != phase {
+			continue
+		}
+		started = true
+		run := HookRun{Hook: h.Name, Phase: phase, Status: "running", StartedAt: now}
+		if h.Job != nil {
+			run.Deployments = m.startHookJob(r, w, h)
+		}
+		w.Hooks = append(w.Hooks, run)
+		log.Printf("Rollout %s: %s hook %s of wave %d started", r.ID, phase, h.Name, r.CurrentWave+1)
+		if h.Webhook != "" {
+			payload, _ := json.Marshal(HookEvent{
+				Rollout:     r.ID,
+				Fleet:       r.Fleet,
+				Hook:        h.Name,
+				Phase:       phase,
+				Wave:        r.CurrentWave + 1,
+				Waves:       len(r.Waves),
+				ImageURL:    r.Deployment.ImageURL,
+				Agents:      w.Agents,
+				Deployments: w.Deployments,
+			})
+			go m.callHookWebhook(r.ID, r.CurrentWave, len(w.Hooks)-1, h, payload)
+		}
+	}
+	return started
+}
+
+// startHookJob creates the deployments that run a hook's job on the agents
+// of a wave, and returns them by agent ID. The runs of agents whose
+// deployment cannot be created are recorded as failed right away. The caller
+// must hold the lock.
+func (m *Rollouts) startHookJob(r *Rollout, w *RolloutWave, h RolloutHook) map[string]string {
+	s := m.server
+	deployments := make(map[string]string, len(w.Agents))
+	for _, agentID := range w.Agents {
+		item := DeploymentRequest{Fleet: r.Fleet, Hook: r.ID + "/" + h.Name, args: append([]string(nil), h.Job.Args...)}
+		item.AgentID, item.ImageURL, item.Project = agentID, h.Job.Image, r.Deployment.Project
+		var dep *Deployment
+		_, err := validateDeploymentRequest(context.Background(), s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &item)
+		if err == nil {
+			dep, err = s.deployments.Create(item)
+		}
+		if err != nil {
+			log.Printf("Rollout %s: hook %s could not start its job on agent %s: %v", r.ID, h.Name, agentID, err)
+			deployments[agentID] = ""
+			continue
+		}
+		s.deployments.RecordEvent(dep.ID, "hook", fmt.Sprintf("Runs the %s hook %s of rollout %s", h.Phase, h.Name, r.ID))
+		deployments[agentID] = dep.ID
+	}
+	return deployments
+}
+
+// callHookWebhook POSTs a hook event to a hook's webhook and records the
+// outcome of the run once it responds; any 2xx response is a success.
+func (m *Rollouts) callHookWebhook(rolloutID string, wave, run int, h RolloutHook, payload []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.TimeoutSeconds)*time.Second)
+	defer cancel()
+	reason := ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Webhook, bytes.NewReader(payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		if resp, err = m.httpClient.Do(req); err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHookResponse))
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				reason = fmt.Sprintf("Webhook responded %s: %s", resp.Status, bytes.TrimSpace(body))
+			}
+		}
+	}
+	if err != nil {
+		reason = fmt.Sprintf("Webhook failed: %v", err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	r, exists := m.rollouts[rolloutID]
+	if !exists {
+		return
+	}
+	if hr := &r.Waves[wave].Hooks[run]; hr.Status == "running" {
+		finishHook(r, hr, reason, time.Now().UTC())
+	}
+}
+
+// finishHook records the outcome of a hook run; an empty reason means it
+// succeeded. The caller must hold the lock.
+func finishHook(r *Rollout, run *HookRun, reason string, now time.Time) {
+	run.Status, run.Reason = "succeeded", reason
+	if reason != "" {
+		run.Status = "failed"
+	}
+	finished := now
+	run.FinishedAt = &finished
+	r.UpdatedAt = now
+	log.Printf("Rollout %s: %s hook %s %s", r.ID, run.Phase, run.Hook, run.Status)
+}
+
+// settleHooks checks the runs of a phase's hooks for the current wave:
+// webhooks record their own outcome, job runs succeed once every job
+// deployment succeeded, and runs time out. It reports whether all runs
+// finished and, if one that aborts the rollout failed, why. The caller must
+// hold the lock.
+func (m *Rollouts) settleHooks(r *Rollout, w *RolloutWave, phase string, now time.Time) (bool, string) {
+	hooks := make(map[string]RolloutHook, len(r.Hooks))
+	for _, h := range r.Hooks {
+		hooks[h.Name] = h
+	}
+	done, abort := true, ""
+	for i := range w.Hooks {
+		run := &w.Hooks[i]
+		if run.Phase != phase {
+			continue
+		}
+		h := hooks[run.Hook]
+		if run.Status == "running" && run.Deployments != nil {
+			if reason, finished := m.jobOutcome(run); finished {
+				finishHook(r, run, reason, now)
+			}
+		}
+		if run.Status == "running" && now.After(run.StartedAt.Add(time.Duration(h.TimeoutSeconds)*time.Second)) {
+			finishHook(r, run, fmt.Sprintf("Hook did not finish within %ds", h.TimeoutSeconds), now)
+		}
+		switch {
+		case run.Status == "running":
+			done = false
+		case run.Status == "failed" && h.AbortOnFailure && abort == "":
+			abort = fmt.Sprintf("%s hook %s of wave %d failed: %s", phase, run.Hook, r.CurrentWave+1, run.Reason)
+		}
+	}
+	return done, abort
+}
+
+// jobOutcome reports whether every deployment of a job hook run finished,
+// and why the run failed if one did not succeed.
+func (m *Rollouts) jobOutcome(run *HookRun) (string, bool) {
+	finished := true
+	for agentID, id := range run.Deployments {
+		if id == "" {
+			return fmt.Sprintf("Job could not be started on agent %s", agentID), true
+		}
+		dep, exists := m.server.deployments.Get(id)
+		switch {
+		case !exists || dep.ArchivedAt != nil:
+			return fmt.Sprintf("Job deployment %s was deleted", id), true
+		case dep.Status == "succeeded":
+		case dep.Status == "failed" || dep.Status == "cancelled" || retired(dep.Status):
+			return fmt.Sprintf("Job deployment %s on agent %s is %s: %s", id, agentID, dep.Status, dep.Reason), true
+		default:
+			finished = false
+		}
+	}
+	return "", finished
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// rolloutInterval is how often running rollouts are checked.
+	rolloutInterval = 5 * time.Second
+	// defaultWaveTimeout bounds how long a wave's deployments may take to run.
+	defaultWaveTimeout = 10 * time.Minute
+)
+
+// defaultWaves are the waves of a rollout that does not name its own.
+var defaultWaves = []string{"1", "10%", "50%", "100%"}
+
+// Rollouts deploys requests to fleets in waves and verifies each wave before
+// starting the next.
+type Rollouts struct {
+	sync.Mutex
+	rollouts   map[string]*Rollout
+	server     *Server           // Validates and creates the rollouts' deployments like the API does
+	approvers  map[string]string // Token to the name of the approver it identifies
+	httpClient *http.Client      // Calls the webhooks of rollout hooks
+}
+
+// NewRollouts creates an in-memory rollout manager for the server's stores.
+// Waves that require approval can be approved with the approvers' tokens.
+func NewRollouts(server *Server, approvers map[string]string) *Rollouts {
+	return &Rollouts{rollouts: make(map[string]*Rollout), server: server, approvers: approvers, httpClient: &http.Client{}}
+}
+
+// planWaves splits a fleet's agents into waves. Each wave names the
+// cumulative number of agents, or percentage of the fleet, rolled out once it
+// is done; agents the last wave does not reach get a wave of their own.
+func planWaves(agents []string, waves []string) ([]RolloutWave, error) {
+	var plan []RolloutWave
+	done := 0
+	for _, w := range waves {
+		var target int
+		if p, ok := strings.CutSuffix(w, "%"); ok {
+			percent, err := strconv.Atoi(p)
+			if err != nil || percent < 1 || percent > 100 {
+				return nil, fmt.Errorf("invalid wave %q: percentages must be between 1%% and 100%%", w)
+			}
+			target = (len(agents)*percent + 99) / 100
+		} else {
+			n, err := strconv.Atoi(w)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid wave %q: expected an agent count such as 1 or a percentage such as 10%%", w)
+			}
+			target = min(n, len(agents))
+		}
+		if target < done {
+			return nil, fmt.Errorf("invalid wave %q: waves must not shrink", w)
+		}
+		if target > done {
+			plan = append(plan, RolloutWave{Agents: agents[done:target], Status: "pending"})
+			done = target
+		}
+	}
+	if done < len(agents) {
+		plan = append(plan, RolloutWave{Agents: agents[done:], Status: "pending"})
+	}
+	return plan, nil
+}
+
+// Start plans and stores a rollout of a request to a fleet. Its first wave
+// starts right away.
+func (m *Rollouts) Start(fleet Fleet, req RolloutRequest) (*Rollout, error) {
+	if req.Deployment.AgentID != "" {
+		return nil, fmt.Errorf("deployment.agent_id must not be set; the fleet's agents are deployed to")
+	}
+	if req.Deployment.ScheduleAt != nil {
+		return nil, fmt.Errorf("deployment.schedule_at must not be set; rollouts start their waves themselves")
+	}
+	if len(fleet.Agents) == 0 {
+		return nil, fmt.Errorf("fleet %s has no agents", fleet.Name)
+	}
+	if req.MaxFailurePercent < 0 || req.MaxFailurePercent > 100 {
+		return nil, fmt.Errorf("max_failure_percent must be between 0 and 100")
+	}
+	if req.WaveTimeoutSeconds < 0 {
+		return nil, fmt.Errorf("wave_timeout_seconds must not be negative")
+	}
+	if req.WaveTimeoutSeconds == 0 {
+		req.WaveTimeoutSeconds = int(defaultWaveTimeout / time.Second)
+	}
+	if len(req.Waves) == 0 {
+		req.Waves = defaultWaves
+	}
+	waves, err := planWaves(append([]string(nil), fleet.Agents...), req.Waves)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.ApproveBefore) > 0 && len(m.approvers) == 0 {
+		return nil, fmt.Errorf("approve_before requires approvers; set ROLLOUT_APPROVERS on the control center")
+	}
+	for _, n := range req.ApproveBefore {
+		if n < 1 || n > len(waves) {
+			return nil, fmt.Errorf("invalid approve_before wave %d: the rollout has waves 1 to %d", n, len(waves))
+		}
+		waves[n-1].RequiresApproval = true
+	}
+	req.Hooks = append([]RolloutHook(nil), req.Hooks...)
+	if err := validateHooks(req.Hooks); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	r := &Rollout{
+		ID:                 fmt.Sprintf("rollout-%s", uuid.New().String()[:8]),
+		Fleet:              fleet.Name,
+		Deployment:         req.Deployment,
+		Waves:              waves,
+		MaxFailurePercent:  req.MaxFailurePercent,
+		Rollback:           req.Rollback,
+		WaveTimeoutSeconds: req.WaveTimeoutSeconds,
+		Hooks:              req.Hooks,
+		Status:             "running",
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.rollouts[r.ID] = r
+	log.Printf("Rollout %s of %s to fleet %s started in %d waves", r.ID, r.Deployment.ImageURL, r.Fleet, len(r.Waves))
+	m.advance(r, now)
+	return r, nil
+}
+
+// Get returns a copy of the rollout with the given ID.
+func (m *Rollouts) Get(id string) (Rollout, bool) {
+	m.Lock()
+	defer m.Unlock()
+	r, exists := m.rollouts[id]
+	if !exists {
+		return Rollout{}, false
+	}
+	return *r, true
+}
+
+// List returns copies of all rollouts, newest first.
+func (m *Rollouts) List() []Rollout {
+	m.Lock()
+	defer m.Unlock()
+	list := make([]Rollout, 0, len(m.rollouts))
+	for _, r := range m.rollouts {
+		list = append(list, *r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Run advances running rollouts until the process exits.
+func (m *Rollouts) Run() {
+	ticker := time.NewTicker(rolloutInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.Lock()
+		for _, r := range m.rollouts {
+			if r.Status == "running" {
+				m.advance(r, now.UTC())
+			}
+		}
+		m.Unlock()
+	}
+}
+
+// advance starts the current wave of a rollout, or verifies it and moves on
+// to the next one once all of its deployments settled. Its pre hooks run
+// before its deployments are created and its post hooks once they settled.
+// The caller must hold the lock.
+func (m *Rollouts) advance(r *Rollout, now time.Time) {
+	for r.Status == "running" {
+		w := &r.Waves[r.CurrentWave]
+		if w.Status == "pending" && w.RequiresApproval && w.Approval == nil {
+			r.Status = "awaiting_approval"
+			r.UpdatedAt = now
+			log.Printf("Rollout %s: wave %d of %d is awaiting approval", r.ID, r.CurrentWave+1, len(r.Waves))
+			return
+		}
+		if w.Status == "pending" {
+			// Waves wait for freezes of any of their agents to end.
+			for _, agentID := range w.Agents {
+				if f := m.server.freezes.Active(r.Deployment.Project, agentID, now); f != nil {
+					r.Reason = fmt.Sprintf("Waiting for freeze %s to end at %s", f.ID, f.End.Format(time.RFC3339))
+					return
+				}
+			}
+			r.Reason = ""
+			w.Status = "pre_hooks"
+			if !m.startHooks(r, w, "pre", now) {
+				m.startWave(r, w, now)
+			}
+		}
+		if w.Status == "pre_hooks" {
+			done, abort := m.settleHooks(r, w, "pre", now)
+			if !done {
+				return
+			}
+			if abort != "" {
+				w.Status = "failed"
+				m.halt(r, abort)
+				return
+			}
+			m.startWave(r, w, now)
+		}
+		if w.Status == "deploying" {
+			if !m.settle(r, w, now) {
+				return
+			}
+			deployed, failed := 0, 0
+			for _, wave := range r.Waves[:r.CurrentWave+1] {
+				deployed += len(wave.Agents)
+				failed += len(wave.Failures)
+			}
+			if failed*100 > r.MaxFailurePercent*deployed {
+				finished := now
+				w.FinishedAt = &finished
+				w.Status = "failed"
+				m.halt(r, fmt.Sprintf("%d of %d deployments failed by wave %d, more than the %d%% allowed", failed, deployed, r.CurrentWave+1, r.MaxFailurePercent))
+				return
+			}
+			w.Status = "post_hooks"
+			m.startHooks(r, w, "post", now)
+		}
+		done, abort := m.settleHooks(r, w, "post", now)
+		if !done {
+			return
+		}
+		finished := now
+		w.FinishedAt = &finished
+		r.UpdatedAt = now
+		if abort != "" {
+			w.Status = "failed"
+			m.halt(r, abort)
+			return
+		}
+		w.Status = "verified"
+		log.Printf("Rollout %s: wave %d of %d verified", r.ID, r.CurrentWave+1, len(r.Waves))
+		if r.CurrentWave == len(r.Waves)-1 {
+			r.Status = "completed"
+			log.Printf("Rollout %s completed", r.ID)
+			return
+		}
+		r.CurrentWave++
+	}
+}
+
+// startWave creates the deployments of a wave. Agents whose deployment
+// cannot be created count as failed. The caller must hold the lock.
+func (m *Rollouts) startWave(r *Rollout, w *RolloutWave, now time.Time) {
+	s := m.server
+	started := now
+	w.StartedAt = &started
+	w.Status = "deploying"
+	w.Deployments = make(map[string]string, len(w.Agents))
+	w.Failures = make(map[string]string)
+	for _, agentID := range w.Agents {
+		item := DeploymentRequest{DeploymentRequest: r.Deployment, Fleet: r.Fleet}
+		item.AgentID = agentID
+		item.Configs = append([]ConfigRef(nil), r.Deployment.Configs...)
+		item.Secrets = append([]SecretRef(nil), r.Deployment.Secrets...)
+		item.Addons = append([]Addon(nil), r.Deployment.Addons...)
+		if agent, exists := s.agents.Get(agentID); !exists || agent.ArchivedAt != nil {
+			w.Failures[agentID] = fmt.Sprintf("Agent %s not found", agentID)
+		} else if _, err := validateDeploymentRequest(context.Background(), s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &item); err != nil {
+			w.Failures[agentID] = err.Error()
+		} else if dep, err := s.deployments.Create(item); err != nil {
+			w.Failures[agentID] = err.Error()
+		} else {
+			w.Deployments[agentID] = dep.ID
+		}
+	}
+	r.UpdatedAt = now
+	log.Printf("Rollout %s: wave %d of %d started on %d agents", r.ID, r.CurrentWave+1, len(r.Waves), len(w.Agents))
+}
+
+// settle records the wave's deployments that failed or did not start running
+// in time, and reports whether all of them settled. The caller must hold the
+// lock.
+func (m *Rollouts) settle(r *Rollout, w *RolloutWave, now time.Time) bool {
+	deadline := w.StartedAt.Add(time.Duration(r.WaveTimeoutSeconds) * time.Second)
+	settled := true
+	for agentID, id := range w.Deployments {
+		if _, failed := w.Failures[agentID]; failed {
+			continue
+		}
+		dep, exists := m.server.deployments.Get(id)
+		switch {
+		case !exists || dep.ArchivedAt != nil:
+			w.Failures[agentID] = fmt.Sprintf("Deployment %s was deleted", id)
+		case dep.Status == "running":
+		case dep.Status == "failed" || dep.Status == "cancelled" || retired(dep.Status):
+			w.Failures[agentID] = fmt.Sprintf("Deployment %s is %s: %s", id, dep.Status, dep.Reason)
+		case now.After(deadline):
+			w.Failures[agentID] = fmt.Sprintf("Deployment %s was still %s after %ds", id, dep.Status, r.WaveTimeoutSeconds)
+		default:
+			settled = false
+		}
+	}
+	return settled
+}
+
+// halt stops a rollout and, if it rolls back, tears down every deployment it
+// created. The caller must hold the lock.
+func (m *Rollouts) halt(r *Rollout, reason string) {
+	r.Status = "halted"
+	r.Reason = reason
+	log.Printf("Rollout %s halted: %s", r.ID, reason)
+	if !r.Rollback {
+		return
+	}
+	for _, w := range r.Waves {
+		for _, id := range w.Deployments {
+			if _, _, err := m.server.deployments.Archive(id, 0, fmt.Sprintf("Rollout %s rolled back", r.ID)); err != nil {
+				log.Printf("Rollout %s: could not roll back deployment %s: %v", r.ID, id, err)
+				continue
+			}
+			m.server.admission.Cancel(id)
+		}
+	}
+	r.Status = "rolled_back"
+	log.Printf("Rollout %s rolled back", r.ID)
+}
+
+// handleStartRollout starts a rollout to a fleet.
+func (s *Server) handleStartRollout(w http.ResponseWriter, r *http.Request) {
+	fleet, exists := s.fleets.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Fleet not found", http.StatusNotFound)
+		return
+	}
+	var req RolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	rollout, err := s.rollouts.Start(fleet, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rollout)
+}
+
+// handleListRollouts lists rollouts, newest first.
+func (s *Server) handleListRollouts(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.rollouts.List())
+}
+
+// handleGetRollout returns a rollout and the state of its waves.
+func (s *Server) handleGetRollout(w http.ResponseWriter, r *http.Request) {
+	rollout, exists := s.rollouts.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Rollout not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rollout)
+}
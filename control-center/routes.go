@@ -0,0 +1,556 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// apiV1 and apiV2 are the path prefixes of the versions of the API. A version
+// only registers routes under its prefix for the endpoints it changed; see
+// apiVersions.
+const (
+	apiV1 = "/api/v1"
+	apiV2 = "/api/v2"
+)
+
+// middleware wraps a handler with behavior shared by several routes.
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h with the given middleware, the first being the outermost.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// jsonContent marks responses as JSON.
+func jsonContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// encodeList writes items as a JSON array one element at a time, so that
+// large lists go out as they are encoded instead of being encoded whole in
+// memory first. A nil list is written as [].
+func encodeList[T any](w io.Writer, items []T) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// Server holds the stores and services the API handlers use.
+type Server struct {
+	agents      *AgentStore
+	deployments *DeploymentStore
+	configs     *ConfigStore
+	secrets     *SecretStore
+	quotas      *QuotaStore
+	apps        *ApplicationStore
+	fleets      *FleetStore
+	freezes     *FreezeStore
+	channels    *ChannelStore
+	alerts      *AlertStore
+	usage       *UsageStore
+	gateway     *Gateway
+	rollouts    *Rollouts
+	engine      *PolicyEngine
+	admission   *Admission
+	registry    *RegistryClient
+	gitSyncer   *GitSyncer
+	bundles     *BundleStore
+	dashboard   *Dashboard
+	limits      Limits
+	versions    APIVersions
+	costs       Costs
+	tunnels     *TunnelHub
+	operations  *OperationStore
+	bootstrap   *BootstrapTokenStore
+	admin       *BackupSettings // Guards the admin endpoints with ADMIN_TOKEN
+	streams     *AgentService   // Builds the desired state heartbeats answer with
+	operator    *Operator       // nil unless KUBERNETES_OPERATOR is "true"
+}
+
+// routes returns the control center's router. Routes are matched on method
+// and path, so the router answers 404 and 405 itself and handlers read path
+// parameters with r.PathValue.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	api := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, chain(h, jsonContent))
+	}
+
+	// Deployments
+	api("GET "+apiV1+"/deployments", s.handleListDeployments)
+	api("GET "+apiV2+"/deployments", s.handleListDeploymentsV2)
+	api("POST "+apiV1+"/deployments", s.handleCreateDeployment)
+	api("GET "+apiV1+"/schemas/{name}", handleGetSchema)
+	api("POST "+apiV1+"/deployments:batch", s.handleBatch)
+	api("GET "+apiV1+"/deployments/{id}", s.handleGetDeployment)
+	api("PATCH "+apiV1+"/deployments/{id}", s.handlePatchDeployment)
+	api("DELETE "+apiV1+"/deployments/{id}", s.handleDeleteDeployment)
+	api("GET "+apiV1+"/deployments/{id}/events", s.handleDeploymentEvents)
+	api("GET "+apiV1+"/deployments/{id}/slo", s.handleDeploymentSLO)
+	api("GET "+apiV1+"/deployments/{id}/sandbox", s.handleDeploymentSandbox)
+	api("GET "+apiV1+"/deployments/{id}/manifest", s.handleDeploymentManifest)
+	api("POST "+apiV1+"/deployments/{id}/usage", s.handleReportUsage)
+	api("POST "+apiV1+"/deployments/{id}/status", s.handleDeploymentStatus)
+	api("POST "+apiV1+"/deployments/{id}/cancel", s.handleCancelDeployment)
+	api("POST "+apiV1+"/deployments/{id}/pause", s.handlePauseDeployment)
+	api("POST "+apiV1+"/deployments/{id}/resume", s.handleResumeDeployment)
+	api("POST "+apiV1+"/deployments/{id}/promote", s.handlePromoteDeployment)
+	// Forwarded connections are WebSockets.
+	mux.HandleFunc("GET "+apiV1+"/deployments/{id}/port-forward", s.handleDeploymentPortForward)
+
+	// Agents
+	api("GET "+apiV1+"/agents", s.handleListAgents)
+	api("POST "+apiV1+"/agents", s.handleRegisterAgent)
+	api("GET "+apiV1+"/agents/{id}", s.handleGetAgent)
+	api("DELETE "+apiV1+"/agents/{id}", s.handleDeleteAgent)
+	api("PUT "+apiV1+"/agents/{id}/image-rewrites", s.handleSetImageRewrites)
+	api("PUT "+apiV1+"/agents/{id}/maintenance", s.handleSetMaintenance)
+	api("DELETE "+apiV1+"/agents/{id}/maintenance", s.handleEndMaintenance)
+	api("GET "+apiV1+"/agents/{id}/queue", s.handleAdmissionQueue)
+	// The tunnel is a WebSocket, and proxied responses keep the content type
+	// of the agent's cluster.
+	mux.HandleFunc("GET "+apiV1+"/agents/{id}/tunnel", s.handleAgentTunnel)
+	mux.HandleFunc(apiV1+"/agents/{id}/proxy/{path...}", s.handleAgentProxy)
+	api("GET "+apiV1+"/agents/{id}/operations", s.handleListOperations)
+	api("POST "+apiV1+"/agents/{id}/operations", s.handleCreateOperation)
+	api("GET "+apiV1+"/agents/{id}/operations/{op}", s.handleGetOperation)
+	api("PUT "+apiV1+"/agents/{id}/prices", s.handleSetPrices)
+	api("DELETE "+apiV1+"/agents/{id}/prices", s.handleClearPrices)
+	api("GET "+apiV1+"/bootstrap-tokens", s.requireAdmin(s.handleListBootstrapTokens))
+	api("POST "+apiV1+"/bootstrap-tokens", s.requireAdmin(s.handleCreateBootstrapToken))
+	api("DELETE "+apiV1+"/bootstrap-tokens/{id}", s.requireAdmin(s.handleDeleteBootstrapToken))
+	mux.HandleFunc("POST "+apiV1+"/heartbeat", s.handleHeartbeat)
+	api("POST "+apiV1+"/purge", s.handlePurge)
+
+	// Fleets
+	api("GET "+apiV1+"/fleets", s.handleListFleets)
+	api("GET "+apiV1+"/fleets/{name}", s.handleGetFleet)
+	api("PUT "+apiV1+"/fleets/{name}", s.handlePutFleet)
+	api("DELETE "+apiV1+"/fleets/{name}", s.handleDeleteFleet)
+	api("POST "+apiV1+"/fleets/{name}/deployments", s.handleDeployToFleet)
+	api("POST "+apiV1+"/fleets/{name}/rollouts", s.handleStartRollout)
+	api("GET "+apiV1+"/rollouts", s.handleListRollouts)
+	api("GET "+apiV1+"/rollouts/{id}", s.handleGetRollout)
+	api("POST "+apiV1+"/rollouts/{id}/approve", s.handleApproveRollout)
+
+	// Freezes
+	api("GET "+apiV1+"/freezes", s.handleListFreezes)
+	api("POST "+apiV1+"/freezes", s.handleCreateFreeze)
+	api("GET "+apiV1+"/freezes/{id}", s.handleGetFreeze)
+	api("DELETE "+apiV1+"/freezes/{id}", s.handleDeleteFreeze)
+
+	api("GET "+apiV1+"/channels", s.handleListChannels)
+	api("GET "+apiV1+"/channels/{name}", s.handleGetChannel)
+	api("DELETE "+apiV1+"/channels/{name}", s.handleDeleteChannel)
+	api("POST "+apiV1+"/channels/{name}/releases", s.handlePublishRelease)
+
+	// Capacity and reports
+	api("GET "+apiV1+"/gpus", s.handleGPUCapacity)
+	api("GET "+apiV1+"/reports/costs", s.handleCostReport)
+	api("GET "+apiV1+"/reports/slos", s.handleSLOReport)
+	api("GET "+apiV1+"/reports/usage", s.handleUsageReport)
+
+	// Alerts
+	api("GET "+apiV1+"/alert-rules", s.handleListAlertRules)
+	api("GET "+apiV1+"/alert-rules/{name}", s.handleGetAlertRule)
+	api("PUT "+apiV1+"/alert-rules/{name}", s.handlePutAlertRule)
+	api("DELETE "+apiV1+"/alert-rules/{name}", s.handleDeleteAlertRule)
+	api("GET "+apiV1+"/alerts", s.handleListAlerts)
+
+	// Inference gateway
+	api("GET "+apiV1+"/gateway/endpoints", s.gateway.handleListEndpoints)
+	api("GET "+apiV1+"/gateway/shadows", s.gateway.handleListShadows)
+	api("GET "+gatewayPrefix+"/models", s.gateway.handleModels)
+	mux.HandleFunc("POST "+gatewayPrefix+"/{path...}", s.gateway.handleInference)
+
+	// Bundles
+	api("GET "+apiV1+"/bundles", s.requireBundles(s.handleListBundles))
+	api("POST "+apiV1+"/bundles", s.requireBundles(s.handleCreateBundle))
+	api("GET "+apiV1+"/bundles/{id}", s.requireBundles(s.handleGetBundle))
+	api("DELETE "+apiV1+"/bundles/{id}", s.requireBundles(s.handleDeleteBundle))
+	mux.HandleFunc("GET "+apiV1+"/bundles/{id}/content", s.requireBundles(s.handleBundleContent))
+
+	// Configs, their versions, and rollouts
+	api("GET "+apiV1+"/configs", s.handleListConfigs)
+	api("GET "+apiV1+"/configs/{name}", s.handleGetConfig)
+	api("PUT "+apiV1+"/configs/{name}", s.handlePutConfig)
+	api("DELETE "+apiV1+"/configs/{name}", s.handleDeleteConfig)
+	api("GET "+apiV1+"/configs/{name}/versions", s.handleConfigVersions)
+	api("GET "+apiV1+"/configs/{name}/versions/{version}", s.handleConfigVersion)
+	api("GET "+apiV1+"/configs/{name}/rollout", s.handleConfigRollout)
+
+	// Secrets
+	api("GET "+apiV1+"/secrets", s.handleListSecrets)
+	api("POST "+apiV1+"/secrets", s.handleCreateSecret)
+	api("GET "+apiV1+"/secrets/{name}", s.handleGetSecret)
+	api("DELETE "+apiV1+"/secrets/{name}", s.handleDeleteSecret)
+	api("POST "+apiV1+"/secrets/{name}/rotate", s.handleRotateSecret)
+	api("GET "+apiV1+"/secrets/{name}/rollout", s.handleSecretRollout)
+
+	// Admission policies
+	api("GET "+apiV1+"/policies", s.requirePolicies(s.handleListPolicies))
+	api("GET "+apiV1+"/policies/{id}", s.requirePolicies(s.handleGetPolicy))
+	api("PUT "+apiV1+"/policies/{id}", s.requirePolicies(s.handlePutPolicy))
+	api("DELETE "+apiV1+"/policies/{id}", s.requirePolicies(s.handleDeletePolicy))
+
+	// Quotas
+	api("GET "+apiV1+"/quotas", s.handleListQuotas)
+	api("GET "+apiV1+"/quotas/{scope}/{name}", s.handleGetQuota)
+	api("PUT "+apiV1+"/quotas/{scope}/{name}", s.handlePutQuota)
+	api("DELETE "+apiV1+"/quotas/{scope}/{name}", s.handleDeleteQuota)
+
+	// Applications
+	api("GET "+apiV1+"/applications", s.handleListApplications)
+	api("POST "+apiV1+"/applications", s.handleCreateApplication)
+	api("GET "+apiV1+"/applications/{id}", s.handleGetApplication)
+	api("PUT "+apiV1+"/applications/{id}", s.handleUpdateApplication)
+	api("DELETE "+apiV1+"/applications/{id}", s.handleDeleteApplication)
+	api("POST "+apiV1+"/applications/{id}/rollback", s.handleRollbackApplication)
+
+	// Administration and integrations
+	api("GET "+apiV1+"/admin/backup", s.requireAdmin(s.handleBackup))
+	api("POST "+apiV1+"/admin/restore", s.requireAdmin(s.handleRestore))
+	api("POST "+apiV1+"/hooks/registry", s.handleRegistryWebhook)
+	api("GET "+apiV1+"/registries", s.handleRegistries)
+	api("GET "+apiVersionsPath, s.handleAPIVersions)
+	api("GET "+apiV1+"/gitops/status", s.handleGitOpsStatus)
+	api("GET "+apiV1+"/kubernetes/deployments", s.requireOperator(s.handleListKubernetesDeployments))
+	api("POST "+apiV1+"/kubernetes/deployments/{namespace}/{name}/adopt", s.requireOperator(s.handleAdoptKubernetesDeployment))
+	api("POST "+apiV1+"/session", s.requireSessions(s.handleLogin))
+	api("GET "+apiV1+"/session", s.requireSessions(s.handleGetSession))
+	api("DELETE "+apiV1+"/session", s.requireSessions(s.handleLogout))
+
+	// Web dashboard
+	mux.Handle("GET /ui/", uiHandler())
+
+	return chain(mux, s.versions.negotiate(mux), withMetrics(mux), withRequestID, s.limits.rateLimit, s.limits.limitBody, s.dashboard.Wrap, withCompression)
+}
+
+// handleListDeployments lists an agent's deployments, with
+// ?include_archived=true to include deleted ones. It answers 304 if the
+// If-None-Match header names the list's current ETag.
+func (s *Server) handleListDeployments(w http.ResponseWriter, r *http.Request) {
+	agentID := r.URL.Query().Get("agent_id")
+	if agentID == "" {
+		http.Error(w, "agent_id query parameter is required", http.StatusBadRequest)
+		return
+	}
+	deps, revision := s.deployments.ListForAgentWithRevision(agentID, includeArchived(r))
+	if notModified(w, r, listETag(revision)) {
+		return
+	}
+	encodeList(w, deps)
+}
+
+// handleCreateDeployment creates a deployment, or with ?dry_run=true reports
+// what it would create.
+func (s *Server) handleCreateDeployment(w http.ResponseWriter, r *http.Request) {
+	var req DeploymentRequest
+	if !decodeDeploymentRequest(w, r, &req) {
+		return
+	}
+	if req.AgentID == "" && len(req.AgentSelector) > 0 {
+		s.handleDeployToSelector(w, r, req)
+		return
+	}
+	if code, err := validateDeploymentRequest(r.Context(), s.engine, s.agents, s.configs, s.secrets, s.bundles, s.channels, &req); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err := s.freezes.check(r, req.Project, req.AgentID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		s.handleDryRun(w, r, req)
+		return
+	}
+
+	dep, err := s.deployments.Create(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handleGetDeployment returns a single deployment and its ETag.
+func (s *Server) handleGetDeployment(w http.ResponseWriter, r *http.Request) {
+	dep, exists := s.deployments.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handlePatchDeployment changes a deployment's image or auto update setting.
+// It requires an If-Match header so that concurrent changes are not lost.
+func (s *Server) handlePatchDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if r.Header.Get("If-Match") == "" {
+		http.Error(w, "If-Match header is required; send the ETag from GET "+apiV1+"/deployments/"+id, http.StatusPreconditionRequired)
+		return
+	}
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var patch DeploymentPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if patch.ImageURL != nil && *patch.ImageURL == "" {
+		http.Error(w, "image_url must not be empty", http.StatusBadRequest)
+		return
+	}
+	if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dep, exists, err := s.deployments.Update(id, expected, patch)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handleDeleteDeployment tears down and archives a deployment.
+func (s *Server) handleDeleteDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dep, exists, err := s.deployments.Archive(id, expected, "Deployment deleted")
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.admission.Cancel(id)
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handleDeploymentEvents returns a deployment's event timeline, or streams it
+// with the deployment's changes to callers that accept text/event-stream.
+func (s *Server) handleDeploymentEvents(w http.ResponseWriter, r *http.Request) {
+	if wantsEventStream(r) {
+		s.streamDeploymentEvents(w, r, r.PathValue("id"))
+		return
+	}
+	events, exists := s.deployments.Events(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+// handleDeploymentStatus records a status change reported by an agent.
+func (s *Server) handleDeploymentStatus(w http.ResponseWriter, r *http.Request) {
+	var req StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.Status == "" {
+		http.Error(w, "status is required", http.StatusBadRequest)
+		return
+	}
+	if err := checkReportable(req.Status); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dep, exists, err := s.deployments.UpdateStatus(r.PathValue("id"), expected, req.Status, req.Reason)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handleCancelDeployment cancels a deployment before its agent starts it.
+func (s *Server) handleCancelDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidBody(w, err, "Invalid request body")
+			return
+		}
+	}
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dep, exists, err := s.deployments.Cancel(id, expected, req.Reason)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.admission.Cancel(id)
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
+
+// handleListAgents lists agents, with ?include_archived=true to include
+// deleted ones, and ?selector=<key>=<value>,... to list only the agents with
+// those labels. It answers 304 if the If-None-Match header names the list's
+// current ETag.
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	agents, revision := s.agents.ListWithRevision(includeArchived(r))
+	if v := r.URL.Query().Get("selector"); v != "" {
+		selector, err := parseSelector(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		matching := []*Agent{}
+		for _, agent := range agents {
+			if matchesSelector(agent.Labels, selector) {
+				matching = append(matching, agent)
+			}
+		}
+		agents = matching
+	}
+	if notModified(w, r, listETag(revision)) {
+		return
+	}
+	encodeList(w, agents)
+}
+
+// handleRegisterAgent registers a new agent.
+func (s *Server) handleRegisterAgent(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.Address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		http.Error(w, "Invalid timezone: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	gpus, err := validateGPUInventory(req.GPUs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.agents.CheckVersion(req.Version, req.ProtocolVersion); err != nil {
+		http.Error(w, "Registration denied: "+err.Error(), http.StatusUpgradeRequired)
+		return
+	}
+	token, err := s.bootstrap.Redeem(req.BootstrapToken)
+	if err != nil {
+		http.Error(w, "Registration denied: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	agent := s.agents.Register(req.Address, req.Timezone, gpus, req.Labels, token)
+	s.agents.SetVersion(agent.ID, req.Version, req.ProtocolVersion)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(agent)
+}
+
+// handleHeartbeat records a heartbeat from a registered agent and answers
+// with the digest of its desired state, so that agents polling their
+// deployments only list them when it changed.
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var req HeartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if err := s.agents.heartbeatVersion(req.ID, &StreamHeartbeat{Version: req.Version, ProtocolVersion: req.ProtocolVersion}); err != nil {
+		http.Error(w, "Heartbeat refused: "+err.Error(), http.StatusUpgradeRequired)
+		return
+	}
+	if !s.agents.Heartbeat(req.ID) {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(HeartbeatResponse{DesiredState: s.streams.desiredState(req.ID)})
+}
+
+// handleGitOpsStatus reports the state of the most recent GitOps sync.
+func (s *Server) handleGitOpsStatus(w http.ResponseWriter, r *http.Request) {
+	if s.gitSyncer == nil {
+		http.Error(w, "GitOps sync is not enabled", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(s.gitSyncer.Status())
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// deploymentLabel is the pod label that selects a deployment's workload.
+	deploymentLabel = "edgeorchestration.io/deployment"
+	// egressHostsAnnotation records the hosts a NetworkPolicy's addresses were
+	// resolved from, so that it can be regenerated when they change.
+	egressHostsAnnotation = "edgeorchestration.io/egress-hosts"
+	// defaultConfinement is the seccomp and AppArmor profile of sandboxed
+	// workloads unless they set one.
+	defaultConfinement = "runtime/default"
+	// egressLookupTimeout bounds resolving the hosts of a sandbox's egress rules.
+	egressLookupTimeout = 5 * time.Second
+)
+
+// validateSandbox checks a deployment's sandbox and fills in its default
+// confinement profiles.
+func validateSandbox(sb *Sandbox) error {
+	if sb == nil {
+		return nil
+	}
+	for _, rule := range sb.Egress {
+		switch {
+		case (rule.Host == "") == (rule.CIDR == ""):
+			return fmt.Errorf("egress rules must set either host or cidr")
+		case rule.Host != "" && !validEgressHost(rule.Host):
+			return fmt.Errorf("invalid egress host %q", rule.Host)
+		case rule.CIDR != "":
+			if _, err := netip.ParsePrefix(rule.CIDR); err != nil {
+				return fmt.Errorf("invalid egress cidr %q", rule.CIDR)
+			}
+		}
+		for _, port := range rule.Ports {
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("invalid egress port %d", port)
+			}
+		}
+	}
+	for _, p := range []*string{&sb.Seccomp, &sb.AppArmor} {
+		if *p == "" {
+			*p = defaultConfinement
+		}
+	}
+	if !validConfinement(sb.Seccomp) {
+		return fmt.Errorf("invalid seccomp profile %q: must be runtime/default, unconfined, or localhost/<profile>", sb.Seccomp)
+	}
+	if !validConfinement(sb.AppArmor) {
+		return fmt.Errorf("invalid apparmor profile %q: must be runtime/default, unconfined, or localhost/<profile>", sb.AppArmor)
+	}
+	return nil
+}
+
+// validEgressHost reports whether a host is an IP address or a DNS name.
+func validEgressHost(host string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validConfinement reports whether a seccomp or AppArmor profile is one
+// Kubernetes accepts in pod annotations.
+func validConfinement(profile string) bool {
+	if name, ok := strings.CutPrefix(profile, "localhost/"); ok {
+		return name != ""
+	}
+	return profile == "runtime/default" || profile == "unconfined"
+}
+
+// egressPeers resolves an egress rule to the network peers of a
+// NetworkPolicy, one per address of a host.
+func egressPeers(ctx context.Context, rule EgressRule) ([]any, error) {
+	if rule.CIDR != "" {
+		return []any{map[string]any{"ipBlock": map[string]any{"cidr": rule.CIDR}}}, nil
+	}
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(rule.Host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", rule.Host)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve egress host %s: %w", rule.Host, err)
+		}
+		addrs = ips
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+	peers := make([]any, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		prefix := netip.PrefixFrom(addr, addr.BitLen())
+		peers = append(peers, map[string]any{"ipBlock": map[string]any{"cidr": prefix.String()}})
+	}
+	return peers, nil
+}
+
+// tcpPorts returns the ports of a NetworkPolicy rule.
+func tcpPorts(ports []int) []any {
+	list := make([]any, len(ports))
+	for i, port := range ports {
+		list[i] = map[string]any{"protocol": "TCP", "port": port}
+	}
+	return list
+}
+
+// sandboxPolicy renders a deployment's sandbox as a NetworkPolicy that only
+// lets its pod reach DNS, its add-ons, and the destinations of its egress
+// rules, and as the pod annotations of its seccomp and AppArmor profiles.
+// The pod and its container are named after the deployment.
+func sandboxPolicy(ctx context.Context, dep Deployment) (SandboxPolicy, error) {
+	dns := map[string]any{"ports": []any{
+		map[string]any{"protocol": "UDP", "port": 53},
+		map[string]any{"protocol": "TCP", "port": 53},
+	}}
+	egress := []any{dns}
+	for _, addon := range dep.Addons {
+		egress = append(egress, map[string]any{"to": []any{
+			map[string]any{"podSelector": map[string]any{"matchLabels": map[string]any{deploymentLabel: addon.DeploymentID}}},
+		}})
+	}
+	var hosts []string
+	for _, rule := range dep.Sandbox.Egress {
+		peers, err := egressPeers(ctx, rule)
+		if err != nil {
+			return SandboxPolicy{}, err
+		}
+		if rule.Host != "" {
+			hosts = append(hosts, rule.Host)
+		}
+		egressRule := map[string]any{"to": peers}
+		if len(rule.Ports) > 0 {
+			egressRule["ports"] = tcpPorts(rule.Ports)
+		}
+		egress = append(egress, egressRule)
+	}
+
+	metadata := map[string]any{
+		"name":   dep.ID + "-sandbox",
+		"labels": map[string]any{deploymentLabel: dep.ID},
+	}
+	if len(hosts) > 0 {
+		metadata["annotations"] = map[string]any{egressHostsAnnotation: strings.Join(hosts, ",")}
+	}
+	return SandboxPolicy{
+		DeploymentID: dep.ID,
+		NetworkPolicy: map[string]any{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "NetworkPolicy",
+			"metadata":   metadata,
+			"spec": map[string]any{
+				"podSelector": map[string]any{"matchLabels": map[string]any{deploymentLabel: dep.ID}},
+				"policyTypes": []any{"Egress"},
+				"egress":      egress,
+			},
+		},
+		PodAnnotations: map[string]string{
+			"seccomp.security.alpha.kubernetes.io/pod":                 dep.Sandbox.Seccomp,
+			"container.apparmor.security.beta.kubernetes.io/" + dep.ID: dep.Sandbox.AppArmor,
+		},
+	}, nil
+}
+
+// handleDeploymentSandbox serves GET /api/v1/deployments/{id}/sandbox, the
+// NetworkPolicy and pod annotations that enforce a deployment's sandbox.
+// The hosts of its egress rules are resolved to their current addresses.
+func (s *Server) handleDeploymentSandbox(w http.ResponseWriter, r *http.Request) {
+	dep, exists := s.deployments.Get(r.PathValue("id"))
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if dep.Sandbox == nil {
+		http.Error(w, "Deployment has no sandbox", http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), egressLookupTimeout)
+	defer cancel()
+	policy, err := sandboxPolicy(ctx, *dep)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	json.NewEncoder(w).Encode(policy)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// severityLevels orders vulnerability severities from least to most severe.
+var severityLevels = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// ImageScanner scans images for vulnerabilities with the Trivy CLI, either
+// locally or against a remote Trivy server.
+type ImageScanner struct {
+	server    string
+	threshold string
+	block     bool
+}
+
+// NewImageScannerFromEnv creates a scanner from the IMAGE_SCAN* and
+// TRIVY_SERVER environment variables. It returns nil if scanning is off.
+func NewImageScannerFromEnv() (*ImageScanner, error) {
+	mode := os.Getenv("IMAGE_SCAN")
+	if mode == "" || mode == "off" {
+		return nil, nil
+	}
+	if mode != "warn" && mode != "block" {
+		return nil, fmt.Errorf("invalid IMAGE_SCAN %q: must be off, warn, or block", mode)
+	}
+
+	threshold := strings.ToUpper(os.Getenv("IMAGE_SCAN_SEVERITY"))
+	if threshold == "" {
+		threshold = "CRITICAL"
+	}
+	if severityRank(threshold) < 0 {
+		return nil, fmt.Errorf("invalid IMAGE_SCAN_SEVERITY %q: must be one of %s", threshold, strings.Join(severityLevels, ", "))
+	}
+
+	return &ImageScanner{
+		server:    os.Getenv("TRIVY_SERVER"),
+		threshold: threshold,
+		block:     mode == "block",
+	}, nil
+}
+
+// Scan runs Trivy against the image and summarizes its findings.
+func (s *ImageScanner) Scan(ctx context.Context, ref string) (*ScanSummary, error) {
+	args := []string{"image", "--quiet", "--format", "json", "--scanners", "vuln"}
+	if s.server != "" {
+		args = append(args, "--server", s.server)
+	}
+	args = append(args, ref)
+
+	cmd := exec.CommandContext(ctx, "trivy", args...)
+	cmd.WaitDelay = commandWaitDelay
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("trivy did not finish: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("trivy failed: %v: %s", err, lastLine(stderr.String()))
+	}
+
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				Severity string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return nil, fmt.Errorf("could not parse trivy report: %w", err)
+	}
+
+	summary := &ScanSummary{
+		Scanner:   "trivy",
+		Image:     ref,
+		ScannedAt: time.Now().UTC(),
+		Counts:    make(map[string]int),
+		Threshold: s.threshold,
+		Blocking:  s.block,
+		Passed:    true,
+	}
+	for _, level := range severityLevels {
+		summary.Counts[level] = 0
+	}
+	limit := severityRank(s.threshold)
+	for _, result := range report.Results {
+		for _, vuln := range result.Vulnerabilities {
+			severity := strings.ToUpper(vuln.Severity)
+			if severityRank(severity) < 0 {
+				severity = "UNKNOWN"
+			}
+			summary.Counts[severity]++
+			if severityRank(severity) >= limit {
+				summary.Passed = false
+			}
+		}
+	}
+	return summary, nil
+}
+
+// describeFindings describes the findings at or above a scan's threshold,
+// e.g. "2 CRITICAL, 5 HIGH".
+func describeFindings(s *ScanSummary) string {
+	var parts []string
+	for i := len(severityLevels) - 1; i >= severityRank(s.Threshold); i-- {
+		if n := s.Counts[severityLevels[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, severityLevels[i]))
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("no vulnerabilities at or above %s", s.Threshold)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func severityRank(severity string) int {
+	for i, level := range severityLevels {
+		if level == severity {
+			return i
+		}
+	}
+	return -1
+}
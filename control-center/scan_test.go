@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"edge-orchestration/api/types"
+)
+
+func TestSetScan(t *testing.T) {
+	tests := []struct {
+		name       string
+		summary    ScanSummary
+		goOn       bool
+		wantStatus DeploymentStatus
+		wantEvent  string
+	}{
+		{"passed", ScanSummary{Passed: true, Threshold: "HIGH"}, true, types.StatusPending, "scanned"},
+		{"warning", ScanSummary{Counts: map[string]int{"HIGH": 2}, Threshold: "HIGH"}, true, types.StatusPending, "scan_warning"},
+		{"blocking", ScanSummary{Counts: map[string]int{"CRITICAL": 1}, Threshold: "HIGH", Blocking: true}, false, types.StatusFailed, "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewDeploymentStore(NewQuotaStore(), NewAgentStore(), NewFreezeStore())
+			dep, err := store.Create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: "agent-1", ImageURL: "nginx:1.27"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, listRevision := store.ListForAgentWithRevision("agent-1", false)
+
+			if goOn := store.SetScan(dep.ID, dep.Revision, "nginx:1.27", &tt.summary); goOn != tt.goOn {
+				t.Errorf("SetScan = %v, want %v", goOn, tt.goOn)
+			}
+			got, _ := store.Get(dep.ID)
+			if got.Scan == nil || got.Status != tt.wantStatus {
+				t.Errorf("deployment has scan %v and status %s, want a scan and %s", got.Scan, got.Status, tt.wantStatus)
+			}
+			// Conditional requests see the scan.
+			if got.ResourceVersion == dep.ResourceVersion {
+				t.Error("resource version did not change")
+			}
+			if _, revision := store.ListForAgentWithRevision("agent-1", false); revision == listRevision {
+				t.Error("list revision did not change")
+			}
+			events, _ := store.Events(dep.ID)
+			if last := events[len(events)-1]; last.Type != tt.wantEvent {
+				t.Errorf("last event is %s, want %s", last.Type, tt.wantEvent)
+			}
+
+			if store.SetScan(dep.ID, dep.Revision+1, "nginx:1.27", &tt.summary) {
+				t.Error("SetScan of another revision went on")
+			}
+		})
+	}
+}
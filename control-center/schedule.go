@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// scheduleInterval is how often the scheduler looks for deferred deployments
+// and recurring redeploys that are due.
+const scheduleInterval = 15 * time.Second
+
+// deferred reports whether a deployment scheduled at the given time must wait
+// for it.
+func deferred(at *time.Time) bool {
+	return at != nil && at.After(time.Now())
+}
+
+// validateSchedule checks a request's cron schedule and time zone.
+func validateSchedule(req *DeploymentRequest) error {
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %v", err)
+	}
+	if req.Schedule == "" {
+		return nil
+	}
+	c, err := parseCron(req.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %v", err)
+	}
+	if _, ok := c.next(time.Now()); !ok {
+		return fmt.Errorf("invalid schedule: %q never runs", req.Schedule)
+	}
+	return nil
+}
+
+// timezone returns the time zone an agent reported, or "" if it reported none.
+func (s *AgentStore) timezone(id string) string {
+	s.Lock()
+	defer s.Unlock()
+	if agent, exists := s.agents[id]; exists {
+		return agent.Timezone
+	}
+	return ""
+}
+
+// schedule copies a request's schedule to its new deployment. Recurring
+// schedules run in the request's time zone, else in the one the agent
+// reported, else in UTC. The caller must hold the lock.
+func (s *DeploymentStore) schedule(dep *Deployment, req DeploymentRequest) {
+	if req.ScheduleAt != nil {
+		at := req.ScheduleAt.UTC()
+		dep.ScheduleAt = &at
+	}
+	if req.Schedule == "" {
+		return
+	}
+	dep.Schedule = req.Schedule
+	dep.Timezone = req.Timezone
+	if dep.Timezone == "" && s.agents != nil {
+		dep.Timezone = s.agents.timezone(dep.AgentID)
+	}
+	if dep.Timezone == "" {
+		dep.Timezone = "UTC"
+	}
+	from := dep.CreatedAt
+	if dep.ScheduleAt != nil && dep.ScheduleAt.After(from) {
+		from = *dep.ScheduleAt
+	}
+	planNextRun(dep, from)
+}
+
+// planNextRun sets when a deployment's schedule next redeploys it after the
+// given time, or clears it if the schedule never runs again.
+func planNextRun(dep *Deployment, after time.Time) {
+	dep.NextRun = nil
+	// The schedule and time zone were validated when the deployment was created.
+	c, err := parseCron(dep.Schedule)
+	if err != nil {
+		return
+	}
+	loc, err := time.LoadLocation(dep.Timezone)
+	if err != nil {
+		return
+	}
+	if next, ok := c.next(after.In(loc)); ok {
+		next = next.UTC()
+		dep.NextRun = &next
+	}
+}
+
+// RunScheduler starts deferred deployments and redeploys scheduled ones when
+// they are due, as well as channel releases held back by a freeze, and
+// advances config rollouts. It never returns.
+func (s *DeploymentStore) RunScheduler() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		started, redeployed := s.RunSchedules(now.UTC())
+		if started+redeployed > 0 {
+			log.Printf("Scheduler: %d deferred deployments started, %d deployments redeployed", started, redeployed)
+		}
+	}
+}
+
+// RunSchedules starts the deferred deployments and runs the recurring
+// redeploys that are due at the given time, deploys channel releases whose
+// freeze ended, and redeploys the next batch of every config and secret
+// rollout whose last batch is running.
+func (s *DeploymentStore) RunSchedules(now time.Time) (started, redeployed int) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, dep := range s.deployments {
+		switch {
+		case dep.Status == "deferred":
+			if dep.ScheduleAt != nil && now.Before(*dep.ScheduleAt) {
+				continue
+			}
+			if s.startDeferred(dep) {
+				started++
+			}
+		case dep.NextRun != nil && !now.Before(*dep.NextRun):
+			if s.runSchedule(dep, now) {
+				redeployed++
+			}
+		case dep.AvailableImage != "" && dep.ChannelStrategy == "immediate":
+			// A channel release was published during a freeze.
+			if !retired(dep.Status) && s.frozen(dep.Project, dep.AgentID) == nil {
+				s.applyRelease(dep)
+				redeployed++
+			}
+		}
+	}
+	s.advanceRefRollouts()
+	return started, redeployed
+}
+
+// startDeferred starts a deferred deployment that is due, unless a freeze
+// holds it. Like a new deployment, it must fit its quotas and its agent must
+// accept deployments; otherwise it fails or is queued. The caller must hold
+// the lock.
+func (s *DeploymentStore) startDeferred(dep *Deployment) bool {
+	if f := s.frozen(dep.Project, dep.AgentID); f != nil {
+		reason := fmt.Sprintf("Due, but freeze %s holds deployments until %s", f.ID, f.End.Format(time.RFC3339))
+		if dep.Reason != reason {
+			dep.Reason = reason
+			s.recordEvent(dep.ID, "frozen", reason)
+		}
+		return false
+	}
+	requested, _ := requestedAmounts(dep.Resources)
+	req := DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: dep.AgentID, Project: dep.Project}}
+	violations, queue := s.quotaViolations(req, requested)
+	held, err := s.maintenanceHold(dep.AgentID)
+	switch {
+	case len(violations) > 0 && !queue:
+		err = &QuotaExceededError{Violations: violations}
+		fallthrough
+	case err != nil:
+		s.setStatus(dep, types.StatusFailed)
+		dep.Reason = err.Error()
+		s.recordEvent(dep.ID, "failed", dep.Reason)
+	case len(violations) > 0 || held != "":
+		s.setStatus(dep, types.StatusQueued)
+		dep.Reason = held
+		if len(violations) > 0 {
+			dep.Reason = (&QuotaExceededError{Violations: violations}).Error()
+		}
+		s.recordEvent(dep.ID, "queued", dep.Reason)
+	default:
+		dep.Reason = ""
+		s.recordEvent(dep.ID, "due", "Scheduled time reached, starting deployment")
+		s.start(dep)
+	}
+	log.Printf("Deferred deployment %s is due and %s", dep.ID, dep.Status)
+	return true
+}
+
+// runSchedule redeploys a deployment as a new revision when its schedule is
+// due, and plans the next run. Runs are skipped while the deployment is
+// paused, queued, failed, or frozen; cancelled and retired deployments are
+// no longer scheduled. The caller must hold the lock.
+func (s *DeploymentStore) runSchedule(dep *Deployment, now time.Time) bool {
+	if retired(dep.Status) || dep.Status == "cancelled" || dep.ArchivedAt != nil {
+		dep.NextRun = nil
+		return false
+	}
+	planNextRun(dep, now)
+	switch dep.Status {
+	case "paused", "queued", "failed":
+		s.recordEvent(dep.ID, "skipped", fmt.Sprintf("Scheduled redeploy skipped while the deployment is %s", dep.Status))
+		return false
+	}
+	if f := s.frozen(dep.Project, dep.AgentID); f != nil {
+		s.recordEvent(dep.ID, "frozen", fmt.Sprintf("Scheduled redeploy skipped: freeze %s holds deployments until %s", f.ID, f.End.Format(time.RFC3339)))
+		return false
+	}
+	message := fmt.Sprintf("Schedule %q is due, redeploying as revision %d", dep.Schedule, dep.Revision+1)
+	if dep.ChannelStrategy == "scheduled" && dep.AvailableImage != "" {
+		dep.ImageURL, dep.AvailableImage = dep.AvailableImage, ""
+		message = fmt.Sprintf("Schedule %q is due, redeploying channel %s release %s as revision %d", dep.Schedule, dep.Channel, dep.ImageURL, dep.Revision+1)
+	}
+	dep.Revision++
+	dep.ImageDigest = ""
+	dep.Reason = ""
+	dep.Scan = nil
+	s.recordEvent(dep.ID, "updated", message)
+	log.Printf("Deployment %s redeploying on schedule as revision %d", dep.ID, dep.Revision)
+	s.start(dep)
+	return true
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// deploymentRequestSchema names the version of the deployment request schema
+// requests are validated against. Incompatible changes to the schema go into
+// a new version next to this one.
+const deploymentRequestSchema = "deployment-request.v1"
+
+//go:embed schemas
+var schemaFiles embed.FS
+
+// deploymentSchema is the compiled deploymentRequestSchema.
+var deploymentSchema = mustCompileSchema(deploymentRequestSchema)
+
+// mustCompileSchema compiles an embedded schema; the schemas are part of the
+// build, so an invalid one is a bug.
+func mustCompileSchema(name string) *jsonschema.Schema {
+	data, err := schemaFiles.ReadFile("schemas/" + name + ".json")
+	if err != nil {
+		panic(err)
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		panic(fmt.Sprintf("schema %s: %v", name, err))
+	}
+	c := jsonschema.NewCompiler()
+	c.AssertFormat()
+	if err := c.AddResource(name+".json", doc); err != nil {
+		panic(fmt.Sprintf("schema %s: %v", name, err))
+	}
+	schema, err := c.Compile(name + ".json")
+	if err != nil {
+		panic(fmt.Sprintf("schema %s: %v", name, err))
+	}
+	return schema
+}
+
+// invalidDeploymentRequest is the message of a ValidationError for a
+// deployment request.
+const invalidDeploymentRequest = "Deployment request does not match the " + deploymentRequestSchema + " schema"
+
+// deploymentRequestErrors checks a deployment request body against the
+// deployment request schema and returns the fields that do not match it. It
+// fails if the body is not JSON.
+func deploymentRequestErrors(body []byte) ([]FieldError, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var invalid *jsonschema.ValidationError
+	if err := deploymentSchema.Validate(doc); errors.As(err, &invalid) {
+		return fieldErrors(invalid, nil), nil
+	}
+	return nil, nil
+}
+
+// decodeDeploymentRequest checks the body of a deployment request against
+// the deployment request schema and decodes it. If the body does not match,
+// it answers 400 with a ValidationError listing the fields that do not and
+// returns false.
+func decodeDeploymentRequest(w http.ResponseWriter, r *http.Request, req *DeploymentRequest) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return false
+	}
+	fields, err := deploymentRequestErrors(body)
+	if err != nil {
+		invalidBody(w, err, "Invalid request body: "+err.Error())
+		return false
+	}
+	if len(fields) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationError{Message: invalidDeploymentRequest, Schema: deploymentRequestSchema, Errors: fields})
+		return false
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return false
+	}
+	return true
+}
+
+// schemaMessages prints the messages of schema errors without a more
+// specific explanation.
+var schemaMessages = message.NewPrinter(language.English)
+
+// fieldErrors appends an error for each field a schema validation error
+// found invalid, explained in the terms of the API.
+func fieldErrors(err *jsonschema.ValidationError, errs []FieldError) []FieldError {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			errs = fieldErrors(cause, errs)
+		}
+		return errs
+	}
+	field := fieldPath(err.InstanceLocation)
+	add := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	switch k := err.ErrorKind.(type) {
+	case *kind.Required:
+		for _, name := range k.Missing {
+			add(fieldPath(append(slices.Clip(err.InstanceLocation), name)), "is required")
+		}
+	case *kind.Type:
+		add(field, "must be of type %s, not %s", strings.Join(k.Want, " or "), k.Got)
+	case *kind.Enum:
+		want := make([]string, len(k.Want))
+		for i, v := range k.Want {
+			want[i] = strconv.Quote(fmt.Sprint(v))
+		}
+		add(field, "must be one of %s", strings.Join(want, ", "))
+	case *kind.Minimum:
+		add(field, "must be at least %s", k.Want.RatString())
+	case *kind.Maximum:
+		add(field, "must be at most %s", k.Want.RatString())
+	case *kind.ExclusiveMinimum:
+		add(field, "must be greater than %s", k.Want.RatString())
+	case *kind.ExclusiveMaximum:
+		add(field, "must be less than %s", k.Want.RatString())
+	case *kind.MinLength:
+		add(field, "must not be empty")
+	case *kind.Pattern:
+		add(field, "%q does not match the pattern %s", k.Got, k.Want)
+	case *kind.Format:
+		add(field, "%q is not a valid %s", fmt.Sprint(k.Got), k.Want)
+	default:
+		add(field, "%s", k.LocalizedString(schemaMessages))
+	}
+	return errs
+}
+
+// fieldPath renders the location of a value in a request body the way
+// fields are referred to in errors, e.g. volumes[0].mount_path.
+func fieldPath(location []string) string {
+	var b strings.Builder
+	for _, token := range location {
+		if _, err := strconv.Atoi(token); err == nil {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// handleGetSchema serves GET /api/v1/schemas/{name}, a JSON Schema that
+// request bodies are validated against, e.g. deployment-request.v1.
+func handleGetSchema(w http.ResponseWriter, r *http.Request) {
+	data, err := schemaFiles.ReadFile("schemas/" + r.PathValue("name") + ".json")
+	if err != nil {
+		http.Error(w, "Schema not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(data)
+}
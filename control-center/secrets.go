@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSecretSize caps the size of a secret value accepted by the API.
+const maxSecretSize = 64 << 10
+
+// secretProviders maps the providers secrets are stored for to the
+// environment variable their SDKs read the API key from.
+var secretProviders = map[string]string{
+	"openai":    "OPENAI_API_KEY",
+	"anthropic": "ANTHROPIC_API_KEY",
+	"generic":   "",
+}
+
+// SecretStore manages secrets. It keeps the value of every version that a
+// deployment still uses, so that deployments not yet restarted after a
+// rotation keep working, until Prune drops it.
+type SecretStore struct {
+	sync.Mutex
+	secrets map[string]*Secret
+	values  map[string]map[int]string // Value of every version kept, by secret name
+}
+
+// NewSecretStore creates a new in-memory secret store.
+func NewSecretStore() *SecretStore {
+	return &SecretStore{secrets: make(map[string]*Secret), values: make(map[string]map[int]string)}
+}
+
+// Create stores a new secret as version 1.
+func (s *SecretStore) Create(req SecretRequest) (Secret, error) {
+	if !validConfigKey(req.Name) {
+		return Secret{}, fmt.Errorf("invalid secret name %q: names may only contain letters, digits, dashes, underscores, and dots", req.Name)
+	}
+	if req.Provider == "" {
+		req.Provider = "generic"
+	}
+	if _, known := secretProviders[req.Provider]; !known {
+		return Secret{}, fmt.Errorf("unknown provider %q: must be openai, anthropic, or generic", req.Provider)
+	}
+	if req.Value == "" {
+		return Secret{}, fmt.Errorf("value is required")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.secrets[req.Name]; exists {
+		return Secret{}, fmt.Errorf("secret %s already exists; rotate it to change its value", req.Name)
+	}
+	now := time.Now().UTC()
+	secret := &Secret{Name: req.Name, Provider: req.Provider, Version: 1, CreatedAt: now, RotatedAt: now}
+	s.secrets[req.Name] = secret
+	s.values[req.Name] = map[int]string{1: req.Value}
+	log.Printf("Secret %s created for provider %s", req.Name, req.Provider)
+	return *secret, nil
+}
+
+// Rotate stores a new value of a secret as its next version. It reports
+// false if the secret does not exist.
+func (s *SecretStore) Rotate(name, value string) (Secret, bool) {
+	s.Lock()
+	defer s.Unlock()
+	secret, exists := s.secrets[name]
+	if !exists {
+		return Secret{}, false
+	}
+	secret.Version++
+	secret.RotatedAt = time.Now().UTC()
+	s.values[name][secret.Version] = value
+	log.Printf("Secret %s rotated to version %d", name, secret.Version)
+	return *secret, true
+}
+
+// Get returns the secret with the given name, without its value.
+func (s *SecretStore) Get(name string) (Secret, bool) {
+	s.Lock()
+	defer s.Unlock()
+	secret, exists := s.secrets[name]
+	if !exists {
+		return Secret{}, false
+	}
+	return *secret, true
+}
+
+// Value returns the value of a version of a secret.
+func (s *SecretStore) Value(name string, version int) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	value, exists := s.values[name][version]
+	return value, exists
+}
+
+// List returns all secrets ordered by name, without their values.
+func (s *SecretStore) List() []Secret {
+	s.Lock()
+	defer s.Unlock()
+	list := make([]Secret, 0, len(s.secrets))
+	for _, secret := range s.secrets {
+		list = append(list, *secret)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete removes a secret and all its versions. It reports false if the
+// secret did not exist.
+func (s *SecretStore) Delete(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, exists := s.secrets[name]; !exists {
+		return false
+	}
+	delete(s.secrets, name)
+	delete(s.values, name)
+	log.Printf("Secret %s deleted", name)
+	return true
+}
+
+// Prune drops the values of superseded secret versions that are not in use,
+// so that a value rotated out because it leaked cannot be read or restored
+// once its last deployment moved on. inUse holds the versions deployments
+// use, by secret name. The current version of a secret is always kept.
+func (s *SecretStore) Prune(inUse map[string]map[int]bool) int {
+	s.Lock()
+	defer s.Unlock()
+	pruned := 0
+	for name, values := range s.values {
+		for version := range values {
+			if version < s.secrets[name].Version && !inUse[name][version] {
+				delete(values, version)
+				log.Printf("Secret %s version %d pruned", name, version)
+				pruned++
+			}
+		}
+	}
+	return pruned
+}
+
+// Resolve checks that every referenced secret exists, fills in the
+// environment variable of the secret's provider where none is given, and
+// records the current secret versions in refs.
+func (s *SecretStore) Resolve(refs []SecretRef) error {
+	seen := make(map[string]bool, len(refs))
+	for i, ref := range refs {
+		secret, exists := s.Get(ref.Name)
+		if !exists {
+			return fmt.Errorf("secret %s not found", ref.Name)
+		}
+		if ref.Env == "" {
+			ref.Env = secretProviders[secret.Provider]
+		}
+		if ref.Env == "" {
+			return fmt.Errorf("secret %s: env is required for %s secrets", ref.Name, secret.Provider)
+		}
+		if !isEnvName(ref.Env) {
+			return fmt.Errorf("secret %s: invalid env %q", ref.Name, ref.Env)
+		}
+		if seen[ref.Env] {
+			return fmt.Errorf("more than one secret is injected as %s", ref.Env)
+		}
+		seen[ref.Env] = true
+		refs[i].Env = ref.Env
+		refs[i].Version = secret.Version
+	}
+	return nil
+}
+
+// isEnvName reports whether a string is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// RolloutSecret starts restarting every active deployment that uses a secret
+// with its rotated version, batch at a time, or all at once if batch is 0.
+// RunSchedules restarts the next batch once the previous one is running. A
+// rollout replaces any earlier one of the same secret.
+func (s *DeploymentStore) RolloutSecret(name string, version, batch int) SecretRollout {
+	s.Lock()
+	defer s.Unlock()
+	return s.startRefRollout("secret", name, version, batch).secretRollout()
+}
+
+// SecretRollout returns the latest rollout of a secret.
+func (s *DeploymentStore) SecretRollout(name string) (SecretRollout, bool) {
+	s.Lock()
+	defer s.Unlock()
+	rollout, exists := s.refRollouts["secret/"+name]
+	if !exists {
+		return SecretRollout{}, false
+	}
+	return rollout.secretRollout(), true
+}
+
+// SecretUsers returns the IDs of active deployments that use the secret.
+func (s *DeploymentStore) SecretUsers(name string) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	var ids []string
+	for _, dep := range s.deployments {
+		if retired(dep.Status) {
+			continue
+		}
+		if refVersion(dep, "secret", name) != nil {
+			ids = append(ids, dep.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SecretVersions returns the secret versions that active deployments use, by
+// secret name.
+func (s *DeploymentStore) SecretVersions() map[string]map[int]bool {
+	s.Lock()
+	defer s.Unlock()
+
+	versions := make(map[string]map[int]bool)
+	for _, dep := range s.deployments {
+		if retired(dep.Status) || dep.ArchivedAt != nil {
+			continue
+		}
+		for _, ref := range dep.Secrets {
+			if versions[ref.Name] == nil {
+				versions[ref.Name] = make(map[int]bool)
+			}
+			versions[ref.Name][ref.Version] = true
+		}
+	}
+	return versions
+}
+
+// handleListSecrets lists secrets without their values.
+func (s *Server) handleListSecrets(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.secrets.List())
+}
+
+// handleCreateSecret stores a new secret.
+func (s *Server) handleCreateSecret(w http.ResponseWriter, r *http.Request) {
+	var req SecretRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSecretSize)).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	secret, err := s.secrets.Create(req)
+	if err != nil {
+		code := http.StatusBadRequest
+		if _, exists := s.secrets.Get(req.Name); exists {
+			code = http.StatusConflict
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(secret)
+}
+
+// handleGetSecret returns a secret without its value.
+func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
+	secret, exists := s.secrets.Get(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(secret)
+}
+
+// handleRotateSecret stores a new value of a secret and restarts the
+// deployments that use it. The old value is kept until none of them uses it. Rotations are accepted during freezes, since a
+// leaked key must not wait for one to end; frozen deployments are restarted
+// once their freeze ends.
+func (s *Server) handleRotateSecret(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req RotateSecretRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSecretSize)).Decode(&req); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if req.Value == "" {
+		http.Error(w, "value is required", http.StatusBadRequest)
+		return
+	}
+	if req.BatchSize < 0 {
+		http.Error(w, "batch_size must not be negative", http.StatusBadRequest)
+		return
+	}
+	secret, exists := s.secrets.Rotate(name, req.Value)
+	if !exists {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+	rollout := s.deployments.RolloutSecret(name, secret.Version, req.BatchSize)
+	// Without deployments left on it, the old value is dropped right away.
+	s.secrets.Prune(s.deployments.SecretVersions())
+	json.NewEncoder(w).Encode(rollout)
+}
+
+// handleSecretRollout returns the progress of the latest rollout of a
+// secret.
+func (s *Server) handleSecretRollout(w http.ResponseWriter, r *http.Request) {
+	rollout, exists := s.deployments.SecretRollout(r.PathValue("name"))
+	if !exists {
+		http.Error(w, "Secret has not been rotated", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(rollout)
+}
+
+// handleDeleteSecret deletes a secret that no deployment uses.
+func (s *Server) handleDeleteSecret(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if users := s.deployments.SecretUsers(name); len(users) > 0 {
+		http.Error(w, fmt.Sprintf("Secret %s is used by deployments %s", name, strings.Join(users, ", ")), http.StatusConflict)
+		return
+	}
+	if !s.secrets.Delete(name) {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"edge-orchestration/api/types"
+)
+
+func TestPruneSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		batch   int
+		remove  bool // Delete the deployment the rollout has not reached
+		wantOld bool
+	}{
+		{"all restarted", 0, false, false},
+		{"one left on the old version", 1, false, true},
+		{"old version's last deployment deleted", 1, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := NewSecretStore()
+			if _, err := secrets.Create(SecretRequest{Name: "openai", Provider: "openai", Value: "old"}); err != nil {
+				t.Fatal(err)
+			}
+			store := NewDeploymentStore(NewQuotaStore(), NewAgentStore(), NewFreezeStore())
+			for _, agent := range []string{"agent-1", "agent-2"} {
+				refs := []SecretRef{{Name: "openai"}}
+				if err := secrets.Resolve(refs); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := store.Create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: agent, ImageURL: "nginx:1.27", Secrets: refs}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			secret, _ := secrets.Rotate("openai", "new")
+			rollout := store.RolloutSecret("openai", secret.Version, tt.batch)
+			if tt.remove {
+				for _, id := range rollout.Pending {
+					if _, _, err := store.Archive(id, 0, "Deleted"); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			secrets.Prune(store.SecretVersions())
+
+			if _, kept := secrets.Value("openai", 1); kept != tt.wantOld {
+				t.Errorf("old version kept: %v, want %v", kept, tt.wantOld)
+			}
+			if _, kept := secrets.Value("openai", secret.Version); !kept {
+				t.Error("current version was pruned")
+			}
+		})
+	}
+}
+
+func TestMQTTSecrets(t *testing.T) {
+	agents := NewAgentStore()
+	agent := agents.Register("a:1", "", nil, nil, nil)
+	secrets := NewSecretStore()
+	if _, err := secrets.Create(SecretRequest{Name: "openai", Provider: "openai", Value: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	refs := []SecretRef{{Name: "openai"}}
+	if err := secrets.Resolve(refs); err != nil {
+		t.Fatal(err)
+	}
+	store := NewDeploymentStore(NewQuotaStore(), agents, NewFreezeStore())
+	if _, err := store.Create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: agent.ID, ImageURL: "nginx:1.27", Secrets: refs}}); err != nil {
+		t.Fatal(err)
+	}
+	svc := &AgentService{agents: agents, deployments: store, configs: NewConfigStore(), secrets: secrets}
+
+	stream := svc.deploymentsFor(agent.ID)
+	if stream.Secrets[refs[0].Key()] != "key" {
+		t.Errorf("stream got secrets %v", stream.Secrets)
+	}
+	published := (&MQTTBridge{svc: svc}).deploymentsFor(agent.ID)
+	if len(published.Secrets) > 0 {
+		t.Error("MQTT deployment list carries secret values")
+	}
+	if published.DesiredState != stream.DesiredState {
+		t.Error("MQTT desired state differs from the stream's")
+	}
+}
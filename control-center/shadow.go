@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxShadowInFlight caps the mirrored requests a shadow works on at once;
+	// requests beyond it are dropped rather than queued.
+	maxShadowInFlight = 16
+	// shadowTimeout bounds a mirrored request.
+	shadowTimeout = 5 * time.Minute
+	// latencySamples is how many recent latencies percentiles are computed
+	// over.
+	latencySamples = 1000
+)
+
+// latencies accumulates the latency and errors of requests.
+type latencies struct {
+	requests, errors int64
+	total            time.Duration
+	recent           []time.Duration // The latest latencySamples, oldest overwritten first
+	next             int
+}
+
+// add records a completed request.
+func (l *latencies) add(d time.Duration, failed bool) {
+	l.requests++
+	if failed {
+		l.errors++
+	}
+	l.total += d
+	if len(l.recent) < latencySamples {
+		l.recent = append(l.recent, d)
+		return
+	}
+	l.recent[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+// stats summarizes the recorded requests.
+func (l *latencies) stats() LatencyStats {
+	s := LatencyStats{Requests: l.requests, Errors: l.errors}
+	if l.requests == 0 {
+		return s
+	}
+	s.ErrorRate = 100 * float64(l.errors) / float64(l.requests)
+	s.MeanMillis = millis(l.total / time.Duration(l.requests))
+	sorted := slices.Clone(l.recent)
+	slices.Sort(sorted)
+	s.P50Millis = millis(sorted[len(sorted)*50/100])
+	s.P95Millis = millis(sorted[len(sorted)*95/100])
+	return s
+}
+
+// millis converts a duration to fractional milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// shadowCounts is what the gateway measured for one shadow deployment.
+type shadowCounts struct {
+	mirrored, dropped int64
+	primary, shadow   latencies
+}
+
+// ShadowStore keeps the measurements of shadow deployments, by deployment
+// ID.
+type ShadowStore struct {
+	sync.Mutex
+	counts map[string]*shadowCounts
+}
+
+// NewShadowStore creates an empty shadow store.
+func NewShadowStore() *ShadowStore {
+	return &ShadowStore{counts: make(map[string]*shadowCounts)}
+}
+
+// get returns the measurements of a shadow. The caller must hold the lock.
+func (s *ShadowStore) get(id string) *shadowCounts {
+	c := s.counts[id]
+	if c == nil {
+		c = &shadowCounts{}
+		s.counts[id] = c
+	}
+	return c
+}
+
+// mirrored counts a request mirrored to a shadow, or dropped if it was too
+// busy.
+func (s *ShadowStore) mirrored(id string, dropped bool) {
+	s.Lock()
+	defer s.Unlock()
+	if dropped {
+		s.get(id).dropped++
+	} else {
+		s.get(id).mirrored++
+	}
+}
+
+// recordPrimary records how the deployment that served a request did, for
+// each shadow the request was mirrored to.
+func (s *ShadowStore) recordPrimary(ids []string, d time.Duration, failed bool) {
+	s.Lock()
+	defer s.Unlock()
+	for _, id := range ids {
+		s.get(id).primary.add(d, failed)
+	}
+}
+
+// recordShadow records how a shadow did with a mirrored request.
+func (s *ShadowStore) recordShadow(id string, d time.Duration, failed bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.get(id).shadow.add(d, failed)
+}
+
+// fill adds the measurements of a shadow to its stats.
+func (s *ShadowStore) fill(stats *ShadowStats) {
+	s.Lock()
+	defer s.Unlock()
+	c, exists := s.counts[stats.DeploymentID]
+	if !exists {
+		return
+	}
+	stats.Mirrored, stats.Dropped = c.mirrored, c.dropped
+	stats.Primary, stats.Shadow = c.primary.stats(), c.shadow.stats()
+}
+
+// shadowDeployments returns the active shadow deployments, ordered by the
+// model they shadow and their ID.
+func (s *DeploymentStore) shadowDeployments() []ShadowStats {
+	s.Lock()
+	defer s.Unlock()
+	list := []ShadowStats{}
+	for _, dep := range s.deployments {
+		if dep.ModelServing == nil || dep.ModelServing.Shadow == nil || dep.ArchivedAt != nil || retired(dep.Status) {
+			continue
+		}
+		list = append(list, ShadowStats{
+			DeploymentID: dep.ID,
+			AgentID:      dep.AgentID,
+			Model:        dep.ModelServing.Model,
+			ShadowOf:     dep.ModelServing.Shadow.Model,
+			Percent:      dep.ModelServing.Shadow.Percent,
+			Status:       dep.Status,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ShadowOf != list[j].ShadowOf {
+			return list[i].ShadowOf < list[j].ShadowOf
+		}
+		return list[i].DeploymentID < list[j].DeploymentID
+	})
+	return list
+}
+
+// Shadows returns the active shadow deployments and how they compare with
+// the deployments serving the requests mirrored to them.
+func (g *Gateway) Shadows() []ShadowStats {
+	list := g.deployments.shadowDeployments()
+	for i := range list {
+		g.shadows.fill(&list[i])
+	}
+	return list
+}
+
+// mirror sends copies of a request for a model to the running shadows of
+// the model, each with its share of the requests, and returns the IDs of
+// the shadows it was sent to. Their responses are discarded.
+func (g *Gateway) mirror(r *http.Request, model string, body []byte) []string {
+	var ids []string
+	for _, e := range g.deployments.modelEndpoints(g.agents.onlineAddresses()) {
+		if e.ShadowOf != model || rand.IntN(100) >= e.ShadowPercent {
+			continue
+		}
+		g.mu.Lock()
+		busy := g.inFlight[e.DeploymentID] >= maxShadowInFlight
+		if !busy {
+			g.inFlight[e.DeploymentID]++
+		}
+		g.mu.Unlock()
+		g.shadows.mirrored(e.DeploymentID, busy)
+		if busy {
+			continue
+		}
+		ids = append(ids, e.DeploymentID)
+		go g.sendShadow(e, r.URL, r.Header.Get("Content-Type"), shadowBody(body, e.Model))
+	}
+	return ids
+}
+
+// shadowBody returns a request body naming the shadow's model instead of
+// the one it shadows.
+func shadowBody(body []byte, model string) []byte {
+	var req map[string]any
+	if json.Unmarshal(body, &req) != nil || req["model"] == model {
+		return body
+	}
+	req["model"] = model
+	data, err := json.Marshal(req)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// sendShadow sends a mirrored request to a shadow, reads its whole response,
+// and records its latency, errors, and usage.
+func (g *Gateway) sendShadow(e ModelEndpoint, u *url.URL, contentType string, body []byte) {
+	defer func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.inFlight[e.DeploymentID]--; g.inFlight[e.DeploymentID] <= 0 {
+			delete(g.inFlight, e.DeploymentID)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	target, _ := url.Parse(e.URL)
+	target.Path, target.RawPath, target.RawQuery = u.Path, u.RawPath, u.RawQuery
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		g.shadows.recordShadow(e.DeploymentID, time.Since(start), true)
+		return
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := g.transport.RoundTrip(req)
+	if err != nil {
+		g.shadows.recordShadow(e.DeploymentID, time.Since(start), true)
+		g.usage.Record(e.DeploymentID, UsageSample{Requests: 1, Errors: 1}, time.Now().UTC())
+		return
+	}
+	failed := resp.StatusCode >= 400
+	meter := &usageMeter{
+		ReadCloser: resp.Body,
+		stream:     strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"),
+		record: func(u tokenUsage) {
+			sample := UsageSample{Requests: 1, PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+			if failed {
+				sample.Errors = 1
+			}
+			g.usage.Record(e.DeploymentID, sample, time.Now().UTC())
+		},
+	}
+	_, err = io.Copy(io.Discard, meter)
+	meter.Close()
+	g.shadows.recordShadow(e.DeploymentID, time.Since(start), failed || err != nil)
+}
+
+// Promote makes a shadow deployment serve the requests for its own model.
+// It returns false if the deployment does not exist and an error if it is
+// not a shadow or not at the expected resource version.
+func (s *DeploymentStore) Promote(id string, expected int, summary string) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if dep.ModelServing == nil || dep.ModelServing.Shadow == nil {
+		return nil, true, fmt.Errorf("deployment %s is not a shadow", id)
+	}
+	if retired(dep.Status) || dep.ArchivedAt != nil {
+		return nil, true, fmt.Errorf("deployment %s is %s and cannot be promoted", id, dep.Status)
+	}
+	// Requests share the model serving spec, so it is replaced, not changed.
+	m := *dep.ModelServing
+	shadowOf := m.Shadow.Model
+	m.Shadow = nil
+	dep.ModelServing = &m
+	s.recordEvent(id, "promoted", fmt.Sprintf("Promoted from shadow of model %s to serve model %s; %s", shadowOf, m.Model, summary))
+	log.Printf("Deployment %s promoted from shadow of model %s", id, shadowOf)
+	return cloneDeployment(dep), true, nil
+}
+
+// shadowSummary describes how a shadow compared with the deployments it
+// shadowed, for the event recorded when it is promoted.
+func shadowSummary(stats ShadowStats) string {
+	if stats.Shadow.Requests == 0 {
+		return "no mirrored requests completed"
+	}
+	return fmt.Sprintf("after %d mirrored requests, p95 latency %.0fms vs %.0fms and error rate %.1f%% vs %.1f%%",
+		stats.Shadow.Requests, stats.Shadow.P95Millis, stats.Primary.P95Millis, stats.Shadow.ErrorRate, stats.Primary.ErrorRate)
+}
+
+// handleListShadows serves GET /api/v1/gateway/shadows, how the shadow
+// deployments compare with the deployments serving the requests mirrored to
+// them.
+func (g *Gateway) handleListShadows(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(g.Shadows())
+}
+
+// handlePromoteDeployment serves POST /api/v1/deployments/{id}/promote,
+// which makes a shadow deployment serve requests. Its measurements are
+// recorded with the promotion.
+func (s *Server) handlePromoteDeployment(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	expected, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.freezes.checkDeployment(r, s.deployments, id); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	summary := shadowSummary(ShadowStats{})
+	for _, stats := range s.gateway.Shadows() {
+		if stats.DeploymentID == id {
+			summary = shadowSummary(stats)
+		}
+	}
+	dep, exists, err := s.deployments.Promote(id, expected, summary)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("ETag", etag(dep.ResourceVersion))
+	json.NewEncoder(w).Encode(dep)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SignatureVerifier checks image signatures with the cosign CLI, either
+// against a public key or, for keyless signing, against the expected
+// certificate identity and OIDC issuer.
+type SignatureVerifier struct {
+	key            string
+	identity       string
+	identityRegexp string
+	issuer         string
+}
+
+// NewSignatureVerifierFromEnv creates a verifier from the COSIGN_* environment
+// variables. It returns nil if signature verification is not configured.
+func NewSignatureVerifierFromEnv() (*SignatureVerifier, error) {
+	v := &SignatureVerifier{
+		key:            os.Getenv("COSIGN_PUBLIC_KEY"),
+		identity:       os.Getenv("COSIGN_CERTIFICATE_IDENTITY"),
+		identityRegexp: os.Getenv("COSIGN_CERTIFICATE_IDENTITY_REGEXP"),
+		issuer:         os.Getenv("COSIGN_CERTIFICATE_OIDC_ISSUER"),
+	}
+	keyless := v.identity != "" || v.identityRegexp != "" || v.issuer != ""
+	switch {
+	case v.key == "" && !keyless:
+		return nil, nil
+	case v.key != "" && keyless:
+		return nil, errors.New("COSIGN_PUBLIC_KEY cannot be combined with keyless identity settings")
+	case keyless && (v.issuer == "" || (v.identity == "" && v.identityRegexp == "")):
+		return nil, errors.New("keyless verification requires COSIGN_CERTIFICATE_OIDC_ISSUER and COSIGN_CERTIFICATE_IDENTITY or COSIGN_CERTIFICATE_IDENTITY_REGEXP")
+	}
+	return v, nil
+}
+
+// Verify runs `cosign verify` for the image and returns an error describing
+// why verification failed.
+func (v *SignatureVerifier) Verify(ctx context.Context, ref string) error {
+	args := []string{"verify", "--output", "json"}
+	if v.key != "" {
+		args = append(args, "--key", v.key)
+	} else {
+		if v.identity != "" {
+			args = append(args, "--certificate-identity", v.identity)
+		} else {
+			args = append(args, "--certificate-identity-regexp", v.identityRegexp)
+		}
+		args = append(args, "--certificate-oidc-issuer", v.issuer)
+	}
+	args = append(args, ref)
+
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	cmd.WaitDelay = commandWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// commandWaitDelay bounds how long a cancelled command's output is awaited,
+// in case it left child processes holding its pipes open.
+const commandWaitDelay = 5 * time.Second
+
+// lastLine returns the last non-empty line of s, which for most CLIs is the
+// actual error message.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSLOWindow is the window SLOs are computed over unless they set one.
+	defaultSLOWindow = "30d"
+	// burnRateWindow is the recent period error budget burn is measured over.
+	burnRateWindow = time.Hour
+)
+
+// parseSLOWindow parses an SLO window, which is a duration such as "168h"
+// or a number of days such as "30d".
+func parseSLOWindow(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
+
+// validateSLO checks a deployment's SLO and fills in its default window.
+func validateSLO(slo *SLO) error {
+	if slo == nil {
+		return nil
+	}
+	if slo.Target <= 0 || slo.Target >= 100 {
+		return errors.New("slo target must be a percentage between 0 and 100, e.g. 99.5")
+	}
+	if slo.Window == "" {
+		slo.Window = defaultSLOWindow
+	}
+	window, err := parseSLOWindow(slo.Window)
+	if err != nil || window < burnRateWindow {
+		return fmt.Errorf("invalid slo window %q: must be at least 1h, e.g. 30d or 168h", slo.Window)
+	}
+	return nil
+}
+
+// availability returns how long a deployment's workload was up and down
+// between from and now according to its event timeline. It is up from the
+// agent reporting it running until it fails, and down from a failure until
+// it runs again. Time after it was deliberately stopped, e.g. paused or
+// deleted, counts as neither.
+func availability(events []DeploymentEvent, from, now time.Time) (up, down time.Duration) {
+	state := ""
+	var since time.Time
+	add := func(until time.Time) {
+		start := since
+		if start.Before(from) {
+			start = from
+		}
+		if !until.After(start) {
+			return
+		}
+		switch state {
+		case "up":
+			up += until.Sub(start)
+		case "down":
+			down += until.Sub(start)
+		}
+	}
+	for _, ev := range events {
+		next := state
+		switch {
+		case ev.Type == "running":
+			next = "up"
+		case ev.Type == "failed":
+			next = "down"
+		case workloadStops[ev.Type]:
+			next = ""
+		}
+		if next != state {
+			add(ev.Time)
+			state, since = next, ev.Time
+		}
+	}
+	add(now)
+	return up, down
+}
+
+// sloStatus computes a deployment's compliance with its SLO. The caller must
+// hold the lock.
+func (s *DeploymentStore) sloStatus(dep *Deployment, now time.Time) SLOStatus {
+	window, _ := parseSLOWindow(dep.SLO.Window)
+	from := now.Add(-window)
+	up, down := availability(s.events[dep.ID], from, now)
+	_, recent := availability(s.events[dep.ID], now.Add(-burnRateWindow), now)
+
+	allowed := 1 - dep.SLO.Target/100
+	budget := time.Duration(float64(window) * allowed)
+	status := SLOStatus{
+		DeploymentID:    dep.ID,
+		AgentID:         dep.AgentID,
+		Project:         dep.Project,
+		SLO:             *dep.SLO,
+		WindowStart:     from,
+		Availability:    100,
+		UptimeSeconds:   int64(up.Seconds()),
+		DowntimeSeconds: int64(down.Seconds()),
+		BudgetSeconds:   int64(budget.Seconds()),
+		BudgetRemaining: 100 * (1 - float64(down)/float64(budget)),
+		BurnRate:        float64(recent) / float64(burnRateWindow) / allowed,
+	}
+	if up+down > 0 {
+		status.Availability = 100 * float64(up) / float64(up+down)
+	}
+	status.Compliant = down <= budget
+	return status
+}
+
+// SLOStatus returns a deployment's compliance with its SLO. It returns false
+// if the deployment does not exist or has no SLO.
+func (s *DeploymentStore) SLOStatus(id string, now time.Time) (SLOStatus, bool) {
+	s.Lock()
+	defer s.Unlock()
+	dep, exists := s.deployments[id]
+	if !exists || dep.SLO == nil {
+		return SLOStatus{}, false
+	}
+	return s.sloStatus(dep, now), true
+}
+
+// SLOStatuses returns the compliance of the active deployments with an SLO,
+// optionally only those of a project or an agent, least budget left first.
+func (s *DeploymentStore) SLOStatuses(project, agentID string, now time.Time) []SLOStatus {
+	s.Lock()
+	defer s.Unlock()
+	list := []SLOStatus{}
+	for _, dep := range s.deployments {
+		if dep.SLO == nil || dep.ArchivedAt != nil || retired(dep.Status) {
+			continue
+		}
+		if project != "" && dep.Project != project || agentID != "" && dep.AgentID != agentID {
+			continue
+		}
+		list = append(list, s.sloStatus(dep, now))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].BudgetRemaining != list[j].BudgetRemaining {
+			return list[i].BudgetRemaining < list[j].BudgetRemaining
+		}
+		return list[i].DeploymentID < list[j].DeploymentID
+	})
+	return list
+}
+
+// handleDeploymentSLO serves GET /api/v1/deployments/{id}/slo, a
+// deployment's compliance with its SLO.
+func (s *Server) handleDeploymentSLO(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	status, ok := s.deployments.SLOStatus(id, time.Now().UTC())
+	if !ok {
+		if _, exists := s.deployments.Get(id); exists {
+			http.Error(w, "Deployment has no SLO", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleSLOReport serves GET /api/v1/reports/slos, the compliance of the
+// active deployments with an SLO, optionally only those of the project or
+// agent_id given as query parameters.
+func (s *Server) handleSLOReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	encodeList(w, s.deployments.SLOStatuses(q.Get("project"), q.Get("agent_id"), time.Now().UTC()))
+}
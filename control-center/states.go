@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// statusTransitions lists the statuses a deployment may move to from each
+// status, besides the ones every status that is not final may move to: a
+// new revision starts over as pending, waiting, or queued, and a deployment
+// can be torn down as expired, superseded, removed, or deleted.
+var statusTransitions = map[DeploymentStatus][]DeploymentStatus{
+	types.StatusDeferred:    {types.StatusFailed, types.StatusCancelled},
+	types.StatusQueued:      {types.StatusPaused, types.StatusCancelled},
+	types.StatusWaiting:     {types.StatusPaused, types.StatusCancelled},
+	types.StatusPending:     {types.StatusScheduled, types.StatusFailed, types.StatusPaused, types.StatusCancelled},
+	types.StatusScheduled:   {types.StatusDeploying, types.StatusRunning, types.StatusFailed, types.StatusSucceeded, types.StatusPaused, types.StatusCancelled},
+	types.StatusDeploying:   {types.StatusRunning, types.StatusDegraded, types.StatusRollingBack, types.StatusFailed, types.StatusSucceeded, types.StatusPaused},
+	types.StatusRunning:     {types.StatusDegraded, types.StatusRollingBack, types.StatusFailed, types.StatusSucceeded, types.StatusPaused},
+	types.StatusDegraded:    {types.StatusRunning, types.StatusRollingBack, types.StatusFailed, types.StatusPaused},
+	types.StatusRollingBack: {types.StatusRunning, types.StatusDegraded, types.StatusFailed, types.StatusPaused},
+	types.StatusFailed:      {types.StatusRollingBack, types.StatusPaused},
+	types.StatusPaused:      {},
+	types.StatusCancelled:   {},
+}
+
+// reportableStatuses are the statuses agents report for a scheduled
+// deployment's workload.
+var reportableStatuses = []DeploymentStatus{
+	types.StatusDeploying, types.StatusRunning, types.StatusDegraded, types.StatusRollingBack, types.StatusFailed, types.StatusSucceeded,
+}
+
+// checkReportable fails if agents may not report a status.
+func checkReportable(status DeploymentStatus) error {
+	if !slices.Contains(reportableStatuses, reportedStatus(status)) {
+		return fmt.Errorf("status %s cannot be reported; agents report deploying, running, degraded, rolling_back, failed, or succeeded", status)
+	}
+	return nil
+}
+
+// canTransition reports whether a deployment may move from one status to
+// another. Staying in a status is always allowed, so that agents can report
+// progress; final statuses cannot be left.
+func canTransition(from, to DeploymentStatus) bool {
+	switch {
+	case from == to:
+		return true
+	case retired(from):
+		return false
+	}
+	switch to {
+	case types.StatusPending, types.StatusWaiting, types.StatusQueued,
+		types.StatusExpired, types.StatusSuperseded, types.StatusRemoved, types.StatusDeleted:
+		return true
+	}
+	return slices.Contains(statusTransitions[from], to)
+}
+
+// TransitionError is returned when a deployment cannot move to a status
+// from the one it is in.
+type TransitionError struct {
+	ID   string
+	From DeploymentStatus
+	To   DeploymentStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("deployment %s is %s and cannot become %s", e.ID, e.From, e.To)
+}
+
+// setStatus moves a deployment to a status and records when it entered it.
+// Transitions the state machine does not allow are refused and logged; it
+// reports whether the deployment moved. The caller must hold the lock.
+func (s *DeploymentStore) setStatus(dep *Deployment, to DeploymentStatus) bool {
+	if !canTransition(dep.Status, to) {
+		log.Printf("Deployment %s: refused transition from %s to %s", dep.ID, dep.Status, to)
+		return false
+	}
+	if dep.Status != to || dep.StatusTimes[to].IsZero() {
+		if dep.StatusTimes == nil {
+			dep.StatusTimes = make(map[DeploymentStatus]time.Time)
+		}
+		dep.StatusTimes[to] = time.Now().UTC()
+	}
+	dep.Status = to
+	return true
+}
+
+// reportedStatus returns the status an agent reported in the terms of the
+// state machine. Agents released before the deploying status report it as
+// pulling.
+func reportedStatus(status DeploymentStatus) DeploymentStatus {
+	if status == "pulling" {
+		return types.StatusDeploying
+	}
+	return status
+}
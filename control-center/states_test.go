@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"edge-orchestration/api/types"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to DeploymentStatus
+		want     bool
+	}{
+		{types.StatusPending, types.StatusPending, true},
+		{types.StatusPending, types.StatusScheduled, true},
+		{types.StatusPending, types.StatusRunning, false},
+		{types.StatusScheduled, types.StatusDeploying, true},
+		{types.StatusScheduled, types.StatusRunning, true},
+		{types.StatusDeploying, types.StatusRunning, true},
+		{types.StatusDeploying, types.StatusCancelled, false},
+		{types.StatusRunning, types.StatusDegraded, true},
+		{types.StatusRunning, types.StatusScheduled, false},
+		{types.StatusRunning, types.StatusCancelled, false},
+		{types.StatusDegraded, types.StatusRunning, true},
+		{types.StatusRollingBack, types.StatusRunning, true},
+		{types.StatusFailed, types.StatusRollingBack, true},
+		{types.StatusFailed, types.StatusRunning, false},
+		{types.StatusQueued, types.StatusCancelled, true},
+		{types.StatusQueued, types.StatusScheduled, false},
+		{types.StatusDeferred, types.StatusCancelled, true},
+		{types.StatusDeferred, types.StatusRunning, false},
+		{types.StatusPaused, types.StatusRunning, false},
+		{types.StatusCancelled, types.StatusRunning, false},
+
+		// Every status that is not final may start over or be torn down.
+		{types.StatusRunning, types.StatusPending, true},
+		{types.StatusPaused, types.StatusQueued, true},
+		{types.StatusCancelled, types.StatusWaiting, true},
+		{types.StatusFailed, types.StatusDeleted, true},
+		{types.StatusDeploying, types.StatusSuperseded, true},
+		{types.StatusScheduled, types.StatusExpired, true},
+		{types.StatusQueued, types.StatusRemoved, true},
+
+		// Final statuses cannot be left.
+		{types.StatusSucceeded, types.StatusSucceeded, true},
+		{types.StatusSucceeded, types.StatusPending, false},
+		{types.StatusSucceeded, types.StatusDeleted, false},
+		{types.StatusSuperseded, types.StatusRunning, false},
+		{types.StatusSuperseded, types.StatusPending, false},
+		{types.StatusRemoved, types.StatusDeleted, false},
+		{types.StatusExpired, types.StatusRunning, false},
+		{types.StatusDeleted, types.StatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// TestDeploymentCopies reads deployments while their status changes, as the
+// API handlers do; run it with -race.
+func TestDeploymentCopies(t *testing.T) {
+	store := NewDeploymentStore(NewQuotaStore(), NewAgentStore(), NewFreezeStore())
+	dep, err := store.Create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: "agent-1", ImageURL: "nginx:1.27"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.MarkScheduled(dep.ID, dep.Revision, "") {
+		t.Fatal("deployment was not scheduled")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			status := types.StatusRunning
+			if i%2 == 1 {
+				status = types.StatusDegraded
+			}
+			if _, _, err := store.UpdateStatus(dep.ID, 0, status, ""); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			got, _ := store.Get(dep.ID)
+			if _, err := json.Marshal(got); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := json.Marshal(store.ListForAgent("agent-1", true)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	// The copy Create returned is read as well, while its original changes.
+	if _, err := json.Marshal(dep); err != nil {
+		t.Error(err)
+	}
+	wg.Wait()
+
+	got, _ := store.Get(dep.ID)
+	got.StatusTimes[types.StatusFailed] = got.CreatedAt
+	got.Status = types.StatusFailed
+	if again, _ := store.Get(dep.ID); again.Status == types.StatusFailed || !again.StatusTimes[types.StatusFailed].IsZero() {
+		t.Error("changing a copy Get returned changed the stored deployment")
+	}
+}
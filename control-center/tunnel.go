@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/yamux"
+
+	"edge-orchestration/api/wsconn"
+)
+
+// tunnelUpgrader accepts the WebSocket connections agents open tunnels over.
+// Agents are not browsers, so the origin is not checked.
+var tunnelUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin:     func(*http.Request) bool { return true },
+}
+
+// TunnelHub keeps the reverse tunnels agents open to the control center, so
+// that it can reach the clusters of agents behind NAT: the agent dials out
+// over a WebSocket, and the control center opens a yamux stream over it for
+// each request it proxies to the agent's cluster API.
+type TunnelHub struct {
+	sync.Mutex
+	tunnels map[string]*tunnel // By agent ID
+}
+
+// tunnel is an agent's open tunnel.
+type tunnel struct {
+	session   *yamux.Session
+	transport http.RoundTripper
+}
+
+// NewTunnelHub returns a hub without tunnels.
+func NewTunnelHub() *TunnelHub {
+	return &TunnelHub{tunnels: make(map[string]*tunnel)}
+}
+
+// open starts the control center's side of a tunnel over an agent's
+// connection, replacing any tunnel the agent had open, and returns when the
+// tunnel closes.
+func (h *TunnelHub) open(agentID string, conn io.ReadWriteCloser) error {
+	cfg := yamux.DefaultConfig()
+	cfg.LogOutput = log.Writer()
+	session, err := yamux.Client(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	t := &tunnel{
+		session: session,
+		// Every request to the agent's cluster gets a stream of its own.
+		transport: &instrumentedTransport{cluster: agentID, next: &http.Transport{
+			DialContext: func(context.Context, string, string) (net.Conn, error) {
+				return session.Open()
+			},
+			DisableKeepAlives: true,
+		}},
+	}
+
+	h.Lock()
+	previous := h.tunnels[agentID]
+	h.tunnels[agentID] = t
+	h.Unlock()
+	if previous != nil {
+		previous.session.Close()
+	}
+
+	<-session.CloseChan()
+	h.Lock()
+	if h.tunnels[agentID] == t {
+		delete(h.tunnels, agentID)
+	}
+	h.Unlock()
+	return nil
+}
+
+// get returns an agent's open tunnel, or nil.
+func (h *TunnelHub) get(agentID string) *tunnel {
+	h.Lock()
+	defer h.Unlock()
+	return h.tunnels[agentID]
+}
+
+// handleAgentTunnel serves GET /api/v1/agents/{id}/tunnel, where an agent
+// opens its reverse tunnel by upgrading to a WebSocket, sending the
+// credential it registered with. The connection stays open until the tunnel
+// closes.
+func (s *Server) handleAgentTunnel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	agent, exists := s.agents.Get(id)
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	if agent.ArchivedAt != nil {
+		http.Error(w, fmt.Sprintf("Agent %s is archived", id), http.StatusConflict)
+		return
+	}
+	if !s.agents.checkCredential(id, r.Header.Get(agentCredentialHeader)) {
+		http.Error(w, "Only the agent can open its tunnel; send its credential in "+agentCredentialHeader, http.StatusUnauthorized)
+		return
+	}
+	ws, err := tunnelUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered the request.
+		logf(r.Context(), "Agent %s: could not open tunnel: %v", id, err)
+		return
+	}
+	logf(r.Context(), "Agent %s opened a tunnel from %s", id, r.RemoteAddr)
+	if err := s.tunnels.open(id, wsconn.New(ws)); err != nil {
+		logf(r.Context(), "Agent %s: could not open tunnel: %v", id, err)
+		return
+	}
+	logf(r.Context(), "Agent %s closed its tunnel", id)
+}
+
+// handleAgentProxy serves /api/v1/agents/{id}/proxy/{path...}, passing any
+// request on through the agent's tunnel to its cluster's API, e.g. GET
+// .../proxy/api/v1/namespaces/default/pods/web/log?follow=true. Responses
+// are streamed as they arrive, and upgrades such as exec go through as well.
+func (s *Server) handleAgentProxy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	t := s.tunnels.get(id)
+	if t == nil {
+		if _, exists := s.agents.Get(id); !exists {
+			http.Error(w, "Agent not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Agent %s has no tunnel open", id), http.StatusServiceUnavailable)
+		return
+	}
+	logf(r.Context(), "Agent %s: proxying %s /%s", id, r.Method, r.PathValue("path"))
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// The agent authenticates to its cluster itself, so the
+			// caller's credentials for the control center stay here.
+			pr.Out.Header.Del("Authorization")
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = id
+			pr.Out.URL.Path = "/" + pr.In.PathValue("path")
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = ""
+			pr.SetXForwarded()
+		},
+		Transport:     t.transport,
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logf(r.Context(), "Agent %s: proxy error: %v", id, err)
+			http.Error(w, fmt.Sprintf("Could not reach agent %s through its tunnel", id), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,132 @@
+package main
+
+import "edge-orchestration/api/types"
+
+// The bodies of the HTTP API and the messages of the agent stream are shared
+// with agents and clients.
+type (
+	Agent                   = types.Agent
+	ImageRewrite            = types.ImageRewrite
+	Maintenance             = types.Maintenance
+	Deployment              = types.Deployment
+	DeploymentStatus        = types.DeploymentStatus
+	DeploymentEvent         = types.DeploymentEvent
+	DeploymentPatch         = types.DeploymentPatch
+	BatchRequest            = types.BatchRequest
+	BatchResult             = types.BatchResult
+	BatchResponse           = types.BatchResponse
+	DeploymentPage          = types.DeploymentPage
+	Resources               = types.Resources
+	ScanSummary             = types.ScanSummary
+	Volume                  = types.Volume
+	Artifact                = types.Artifact
+	PVCSource               = types.PVCSource
+	HostPathSource          = types.HostPathSource
+	EmptyDirSource          = types.EmptyDirSource
+	Config                  = types.Config
+	ConfigRef               = types.ConfigRef
+	ConfigRollout           = types.ConfigRollout
+	Secret                  = types.Secret
+	SecretRequest           = types.SecretRequest
+	RotateSecretRequest     = types.RotateSecretRequest
+	SecretRef               = types.SecretRef
+	SecretRollout           = types.SecretRollout
+	Addon                   = types.Addon
+	Sandbox                 = types.Sandbox
+	EgressRule              = types.EgressRule
+	SandboxPolicy           = types.SandboxPolicy
+	Shadow                  = types.Shadow
+	ShadowStats             = types.ShadowStats
+	LatencyStats            = types.LatencyStats
+	RolloutHook             = types.RolloutHook
+	HookJob                 = types.HookJob
+	HookRun                 = types.HookRun
+	HookEvent               = types.HookEvent
+	KubernetesWorkload      = types.KubernetesWorkload
+	AdoptRequest            = types.AdoptRequest
+	DryRun                  = types.DryRun
+	ValidationError         = types.ValidationError
+	FieldError              = types.FieldError
+	Quota                   = types.Quota
+	QuotaUsage              = types.QuotaUsage
+	QuotaStatus             = types.QuotaStatus
+	Policy                  = types.Policy
+	Application             = types.Application
+	ApplicationRequest      = types.ApplicationRequest
+	ApplicationComponent    = types.ApplicationComponent
+	RollbackRequest         = types.RollbackRequest
+	Bundle                  = types.Bundle
+	Fleet                   = types.Fleet
+	FleetRequest            = types.FleetRequest
+	FleetStatus             = types.FleetStatus
+	RolloutRequest          = types.RolloutRequest
+	Rollout                 = types.Rollout
+	RolloutWave             = types.RolloutWave
+	RolloutApproval         = types.RolloutApproval
+	Freeze                  = types.Freeze
+	FreezeRequest           = types.FreezeRequest
+	FreezeOverride          = types.FreezeOverride
+	Channel                 = types.Channel
+	ChannelRelease          = types.ChannelRelease
+	PublishRequest          = types.PublishRequest
+	PublishResult           = types.PublishResult
+	Prices                  = types.Prices
+	DeploymentCost          = types.DeploymentCost
+	ProjectCost             = types.ProjectCost
+	CostReport              = types.CostReport
+	AlertRule               = types.AlertRule
+	AlertReceiver           = types.AlertReceiver
+	Alert                   = types.Alert
+	SLO                     = types.SLO
+	SLOStatus               = types.SLOStatus
+	ModelServing            = types.ModelServing
+	ModelEndpoint           = types.ModelEndpoint
+	GPUInventory            = types.GPUInventory
+	AgentGPUs               = types.AgentGPUs
+	AdmissionQueue          = types.AdmissionQueue
+	UsageSample             = types.UsageSample
+	DeploymentUsage         = types.DeploymentUsage
+	ProjectUsage            = types.ProjectUsage
+	UsageReport             = types.UsageReport
+	BundleRequest           = types.BundleRequest
+	RegistryHealth          = types.RegistryHealth
+	APIVersionInfo          = types.APIVersionInfo
+	RestoreResult           = types.RestoreResult
+	AgentMessage            = types.AgentMessage
+	StreamRegister          = types.StreamRegister
+	StreamHeartbeat         = types.StreamHeartbeat
+	StreamStatus            = types.StreamStatus
+	StreamSync              = types.StreamSync
+	StreamOperationResult   = types.StreamOperationResult
+	ClusterOperation        = types.ClusterOperation
+	ClusterOperationRequest = types.ClusterOperationRequest
+	BootstrapToken          = types.BootstrapToken
+	BootstrapTokenRequest   = types.BootstrapTokenRequest
+	ObjectResult            = types.ObjectResult
+	ControlMessage          = types.ControlMessage
+	StreamRegistered        = types.StreamRegistered
+	StreamDeployments       = types.StreamDeployments
+	StreamHeartbeatReply    = types.StreamHeartbeatReply
+	StreamError             = types.StreamError
+)
+
+// DeploymentRequest is a request for a deployment as the control center
+// handles it: the body of a POST /deployments request, and the application
+// component the deployment is for, if any.
+type DeploymentRequest struct {
+	types.DeploymentRequest
+
+	// Set when the deployment is a component of an application.
+	Application  string   `json:"-"`
+	Component    string   `json:"-"`
+	dependsOnIDs []string // Deployments that must be running before this one starts
+
+	Fleet string `json:"-"` // Set when the deployment is made to a fleet
+
+	// Set when the deployment runs the job of a rollout hook.
+	Hook string `json:"-"`
+
+	AdoptedFrom string `json:"-"` // Set when the deployment adopts a Kubernetes Deployment
+
+	args []string // Container arguments of a hook's job or an adopted workload
+}
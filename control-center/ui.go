@@ -0,0 +1,21 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles holds the web dashboard, a single page that uses the API.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded web dashboard under /ui/.
+func uiHandler() http.Handler {
+	sub, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(sub)))
+}
@@ -0,0 +1,282 @@
+// Dashboard for the control center. It polls the API every few seconds and
+// offers the most common actions. When dashboard sessions are enabled, it logs
+// in and sends the session's CSRF token with every state-changing request.
+"use strict";
+
+const refreshInterval = 5000;
+const retired = new Set(["superseded", "removed", "deleted", "expired", "cancelled", "succeeded"]);
+let csrfToken = "";
+
+async function api(method, path, body, headers = {}) {
+  if (method !== "GET") {
+    headers["Content-Type"] = "application/json";
+    if (csrfToken) {
+      headers["X-CSRF-Token"] = csrfToken;
+    }
+  }
+  const resp = await fetch(path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+    credentials: "same-origin",
+  });
+  if (resp.status === 401 && path !== "/api/v1/session") {
+    showLogin();
+    throw new Error("Login required");
+  }
+  if (!resp.ok) {
+    throw new Error((await resp.text()).trim() || resp.statusText);
+  }
+  if (resp.status === 204) {
+    return { resp, data: null };
+  }
+  return { resp, data: await resp.json() };
+}
+
+function el(tag, attrs = {}, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs)) {
+    if (key.startsWith("on")) {
+      node.addEventListener(key.slice(2), value);
+    } else {
+      node.setAttribute(key, value);
+    }
+  }
+  for (const child of children) {
+    node.append(child);
+  }
+  return node;
+}
+
+function statusCell(status) {
+  return el("td", { class: `status status-${status}` }, status);
+}
+
+function button(label, action) {
+  return el("button", {
+    onclick: async () => {
+      try {
+        await action();
+        await refresh();
+      } catch (err) {
+        showError(err);
+      }
+    },
+  }, label);
+}
+
+function showError(err) {
+  const node = document.getElementById("error");
+  node.textContent = err ? err.message : "";
+  node.hidden = !err;
+}
+
+function showLogin() {
+  document.getElementById("login").hidden = false;
+  document.getElementById("app").hidden = true;
+  document.getElementById("logout").hidden = true;
+}
+
+function showApp() {
+  document.getElementById("login").hidden = true;
+  document.getElementById("app").hidden = false;
+}
+
+// startSession fetches the CSRF token of the current session. It reports
+// false if the user must log in first.
+async function startSession() {
+  const resp = await fetch("/api/v1/session", { credentials: "same-origin" });
+  if (resp.status === 404) {
+    return true; // Sessions are not enabled.
+  }
+  if (!resp.ok) {
+    return false;
+  }
+  csrfToken = (await resp.json()).csrf_token;
+  document.getElementById("logout").hidden = false;
+  return true;
+}
+
+async function refresh() {
+  const { data: agents } = await api("GET", "/api/v1/agents");
+  agents.sort((a, b) => a.id.localeCompare(b.id));
+  renderAgents(agents);
+
+  const deployments = [];
+  for (const agent of agents) {
+    const { data } = await api("GET", `/api/v1/deployments?agent_id=${encodeURIComponent(agent.id)}`);
+    deployments.push(...data);
+  }
+  deployments.sort((a, b) => b.created_at.localeCompare(a.created_at));
+  const { data: slos } = await api("GET", "/api/v1/reports/slos");
+  renderDeployments(deployments, new Map(slos.map((s) => [s.deployment_id, s])));
+
+  const { data: applications } = await api("GET", "/api/v1/applications");
+  renderApplications(applications);
+
+  document.getElementById("refreshed").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+}
+
+function renderAgents(agents) {
+  const select = document.getElementById("deploy-agent");
+  const selected = select.value;
+  select.replaceChildren(...agents.map((a) => el("option", { value: a.id }, `${a.id.slice(0, 8)} (${a.address})`)));
+  if (selected) {
+    select.value = selected;
+  }
+  document.getElementById("agents").replaceChildren(...agents.map((a) => el("tr", {},
+    el("td", { class: "id" }, a.id),
+    el("td", {}, a.address),
+    statusCell(a.status),
+    el("td", {}, new Date(a.last_seen).toLocaleString()),
+  )));
+}
+
+// sloCell shows a deployment's availability against its SLO and how much of
+// its error budget is left.
+function sloCell(slo) {
+  if (!slo) {
+    return el("td", {}, "");
+  }
+  const text = `${slo.availability.toFixed(3)}% of ${slo.slo.target}% (${Math.round(slo.budget_remaining)}% budget left)`;
+  return el("td", { class: slo.compliant ? "" : "error", title: `Burn rate ${slo.burn_rate.toFixed(1)} over the last hour` }, text);
+}
+
+function renderDeployments(deployments, slos) {
+  document.getElementById("deployments").replaceChildren(...deployments.map((d) => {
+    const actions = el("td", {}, button("Events", () => showEvents(d.id)));
+    if (!retired.has(d.status)) {
+      actions.append(
+        button("Set image", () => setImage(d)),
+        button("Delete", () => confirm(`Delete deployment ${d.id}?`) && api("DELETE", `/api/v1/deployments/${d.id}`)),
+      );
+    }
+    if (["deferred", "queued", "waiting", "pending", "scheduled"].includes(d.status)) {
+      actions.append(button("Cancel", () => api("POST", `/api/v1/deployments/${d.id}/cancel`)));
+    }
+    if (["queued", "waiting", "pending", "scheduled", "deploying", "running", "degraded", "rolling_back", "failed"].includes(d.status)) {
+      actions.append(button("Pause", () => api("POST", `/api/v1/deployments/${d.id}/pause`)));
+    }
+    if (d.status === "paused") {
+      actions.append(button("Resume", () => api("POST", `/api/v1/deployments/${d.id}/resume`)));
+    }
+    return el("tr", {},
+      el("td", { class: "id" }, d.id),
+      el("td", { class: "id" }, d.agent_id.slice(0, 8)),
+      el("td", {}, d.image_url),
+      statusCell(d.status),
+      el("td", {}, String(d.revision)),
+      el("td", {}, d.reason || ""),
+      sloCell(slos.get(d.id)),
+      actions,
+    );
+  }));
+}
+
+function renderApplications(applications) {
+  document.getElementById("applications").replaceChildren(...applications.map((a) => el("tr", {},
+    el("td", {}, a.name),
+    el("td", { class: "id" }, a.agent_id.slice(0, 8)),
+    el("td", {}, a.components.map((c) => `${c.name} (${c.image_url})`).join(", ")),
+    statusCell(a.status),
+    el("td", {}, String(a.revision)),
+    el("td", {}, a.revision > 1 ? button("Roll back", () => rollback(a)) : ""),
+  )));
+}
+
+// setImage redeploys a deployment with a new image, conditional on the
+// deployment not having changed since it was fetched.
+async function setImage(d) {
+  const image = prompt(`New image for ${d.id}`, d.image_url);
+  if (!image || image === d.image_url) {
+    return;
+  }
+  const { resp } = await api("GET", `/api/v1/deployments/${d.id}`);
+  await api("PATCH", `/api/v1/deployments/${d.id}`, { image_url: image }, { "If-Match": resp.headers.get("ETag") });
+}
+
+async function rollback(a) {
+  const revision = prompt(`Roll ${a.name} back to revision`, String(a.revision - 1));
+  if (!revision) {
+    return;
+  }
+  await api("POST", `/api/v1/applications/${a.id}/rollback`, { revision: Number(revision) });
+}
+
+async function showEvents(id) {
+  const { data: events } = await api("GET", `/api/v1/deployments/${id}/events`);
+  document.getElementById("events-id").textContent = id;
+  document.getElementById("events-log").textContent = events
+    .map((e) => `${e.time}  ${e.type.padEnd(12)} ${e.message || ""}`)
+    .join("\n");
+  document.getElementById("events").hidden = false;
+}
+
+document.getElementById("events-close").addEventListener("click", () => {
+  document.getElementById("events").hidden = true;
+});
+
+document.getElementById("deploy-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  try {
+    await api("POST", "/api/v1/deployments", {
+      agent_id: form.get("agent_id"),
+      image_url: form.get("image_url"),
+      project: form.get("project") || undefined,
+      auto_update: form.get("auto_update") === "on",
+    });
+    event.target.reset();
+    showError(null);
+    await refresh();
+  } catch (err) {
+    showError(err);
+  }
+});
+
+document.getElementById("login-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const password = new FormData(event.target).get("password");
+  try {
+    const { data } = await api("POST", "/api/v1/session", { password });
+    csrfToken = data.csrf_token;
+    event.target.reset();
+    document.getElementById("logout").hidden = false;
+    showApp();
+    await refresh();
+  } catch (err) {
+    alert(err.message);
+  }
+});
+
+document.getElementById("logout").addEventListener("click", async () => {
+  await api("DELETE", "/api/v1/session");
+  csrfToken = "";
+  showLogin();
+});
+
+async function main() {
+  if (!(await startSession())) {
+    showLogin();
+    return;
+  }
+  showApp();
+  try {
+    await refresh();
+  } catch (err) {
+    showError(err);
+  }
+  setInterval(async () => {
+    if (document.getElementById("app").hidden) {
+      return;
+    }
+    try {
+      await refresh();
+      showError(null);
+    } catch (err) {
+      showError(err);
+    }
+  }, refreshInterval);
+}
+
+main();
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// semver is a parsed semantic version tag such as "1.4.2" or "v2.0.0-rc.1".
+type semver struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseSemver parses a tag of the form [v]MAJOR.MINOR.PATCH[-PRERELEASE].
+// Build metadata after "+" is ignored.
+func parseSemver(tag string) (semver, bool) {
+	tag, _, _ = strings.Cut(strings.TrimPrefix(tag, "v"), "+")
+	core, pre, _ := strings.Cut(tag, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p != strconv.Itoa(n) {
+			return semver{}, false
+		}
+		nums[i] = n
+	}
+	return semver{major: nums[0], minor: nums[1], patch: nums[2], pre: pre}, true
+}
+
+// less reports whether v is an earlier version than o. A pre-release comes
+// before the release of the same version.
+func (v semver) less(o semver) bool {
+	switch {
+	case v.major != o.major:
+		return v.major < o.major
+	case v.minor != o.minor:
+		return v.minor < o.minor
+	case v.patch != o.patch:
+		return v.patch < o.patch
+	case v.pre == "" || o.pre == "":
+		return v.pre != "" && o.pre == ""
+	}
+	return comparePrerelease(v.pre, o.pre) < 0
+}
+
+// comparePrerelease orders pre-release versions as semantic versioning
+// does: identifier by identifier, numeric identifiers as numbers and before
+// alphanumeric ones, and a version with fewer identifiers first if all of
+// them are equal. So rc.2 comes before rc.10, and rc before rc.1.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := cmp.Compare(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+// validateUpdatePolicy checks that a request with an update policy deploys
+// an image with a semantic version tag.
+func validateUpdatePolicy(req *DeploymentRequest) error {
+	switch req.UpdatePolicy {
+	case "":
+		return nil
+	case "patch", "minor", "major":
+	default:
+		return errors.New("update_policy must be patch, minor, or major")
+	}
+	if req.Bundle != "" || req.Channel != "" {
+		return errors.New("update_policy cannot be combined with bundle or channel")
+	}
+	if strings.Contains(req.ImageURL, "@") {
+		return errors.New("update_policy requires an image tag, not a digest")
+	}
+	if _, ok := parseSemver(parseImageName(req.ImageURL).Tag); !ok {
+		return fmt.Errorf("update_policy requires a semantic version tag such as 1.4.2, got %s", req.ImageURL)
+	}
+	return nil
+}
+
+// newestAllowed returns the newest release tag the policy allows updating
+// from the current tag to, or "" if none is newer. Pre-releases are never
+// picked.
+func newestAllowed(policy, current string, tags []string) string {
+	cur, ok := parseSemver(current)
+	if !ok {
+		return ""
+	}
+	best, bestTag := cur, ""
+	for _, tag := range tags {
+		v, ok := parseSemver(tag)
+		if !ok || v.pre != "" || !best.less(v) {
+			continue
+		}
+		if policy == "patch" && (v.major != cur.major || v.minor != cur.minor) || policy == "minor" && v.major != cur.major {
+			continue
+		}
+		best, bestTag = v, tag
+	}
+	return bestTag
+}
+
+// imageWithTag returns an image reference with its tag replaced.
+func imageWithTag(imageURL, tag string) string {
+	name := imageURL
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + ":" + tag
+}
+
+// UpdatePoller polls registries for new tags of the images of deployments
+// with an update policy, and rolls matching releases out a few deployments
+// at a time.
+type UpdatePoller struct {
+	deployments *DeploymentStore
+	registry    *RegistryClient
+	interval    time.Duration
+	batchSize   int               // Deployments updated to an image at a time
+	halted      map[string]string // Images whose rollout halted, to the deployment that failed with them; only used by Poll
+}
+
+// NewUpdatePollerFromEnv creates an update poller that polls every
+// UPDATE_POLL_INTERVAL (5m) and updates UPDATE_BATCH_SIZE (1) deployments
+// at a time. It returns nil if there is no registry client, since tags cannot
+// be listed without one.
+func NewUpdatePollerFromEnv(deployments *DeploymentStore, registry *RegistryClient) (*UpdatePoller, error) {
+	p := &UpdatePoller{deployments: deployments, registry: registry, interval: 5 * time.Minute, batchSize: 1, halted: make(map[string]string)}
+	if v := os.Getenv("UPDATE_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid UPDATE_POLL_INTERVAL %q: must be a positive duration", v)
+		}
+		p.interval = d
+	}
+	if v := os.Getenv("UPDATE_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid UPDATE_BATCH_SIZE %q: must be a positive number", v)
+		}
+		p.batchSize = n
+	}
+	if registry == nil {
+		log.Printf("Update policies are not polled: registry access is disabled by RESOLVE_IMAGE_DIGESTS=false")
+		return nil, nil
+	}
+	return p, nil
+}
+
+// Run polls for updates on every interval. It never returns.
+func (p *UpdatePoller) Run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.Poll(context.Background())
+	}
+}
+
+// Poll lists the tags of every repository deployments with an update policy
+// use, and rolls out the newest release each policy allows. Halted rollouts
+// resume once the deployment that failed is deleted, recovers, or moves to
+// another image.
+func (p *UpdatePoller) Poll(ctx context.Context) {
+	for target, failed := range p.halted {
+		if !p.deployments.failedWith(failed, target) {
+			delete(p.halted, target)
+			log.Printf("Update poller: rollout of %s resumed, deployment %s no longer fails with it", target, failed)
+		}
+	}
+
+	tags := make(map[string][]string) // By repository
+	targets := make(map[string][]string)
+	for _, dep := range p.deployments.withUpdatePolicy() {
+		repository := imageRepository(dep.ImageURL)
+		if _, listed := tags[repository]; !listed {
+			list, err := p.registry.ListTags(ctx, dep.ImageURL)
+			if err != nil {
+				log.Printf("Update poller: could not list tags of %s: %v", repository, err)
+			}
+			tags[repository] = list
+		}
+		if tag := newestAllowed(dep.UpdatePolicy, parseImageName(dep.ImageURL).Tag, tags[repository]); tag != "" {
+			target := imageWithTag(dep.ImageURL, tag)
+			targets[target] = append(targets[target], dep.ID)
+		}
+	}
+
+	for target, ids := range targets {
+		if _, halted := p.halted[target]; halted {
+			continue
+		}
+		digest, err := p.registry.ResolveDigest(ctx, target)
+		if err != nil {
+			log.Printf("Update poller: could not resolve %s: %v", target, err)
+			continue
+		}
+		if failed := p.deployments.RollOutUpdate(target, digest, ids, p.batchSize); failed != "" {
+			p.halted[target] = failed
+			p.deployments.HaltUpdate(target, ids, failed)
+			log.Printf("Update poller: rollout of %s halted, deployment %s failed with it", target, failed)
+		}
+	}
+}
+
+// withUpdatePolicy returns copies of the active deployments with an update
+// policy.
+func (s *DeploymentStore) withUpdatePolicy() []Deployment {
+	s.Lock()
+	defer s.Unlock()
+	var list []Deployment
+	for _, dep := range s.deployments {
+		if dep.UpdatePolicy != "" && dep.ArchivedAt == nil && !retired(dep.Status) {
+			list = append(list, *cloneDeployment(dep))
+		}
+	}
+	return list
+}
+
+// RollOutUpdate redeploys running deployments with the newer image their
+// update policy found, as long as fewer than batch deployments already moved
+// to it are still starting. Frozen deployments wait for their freeze to end.
+// If a deployment moved to the image failed, nothing is updated and its ID is
+// returned.
+func (s *DeploymentStore) RollOutUpdate(target, digest string, ids []string, batch int) (failed string) {
+	s.Lock()
+	defer s.Unlock()
+
+	starting := 0
+	for _, dep := range s.deployments {
+		if dep.UpdatePolicy == "" || dep.ImageURL != target || dep.ArchivedAt != nil {
+			continue
+		}
+		switch dep.Status {
+		case "failed":
+			return dep.ID
+		case "waiting", "pending", "scheduled", "deploying":
+			starting++
+		}
+	}
+
+	for _, dep := range s.lookup(ids) {
+		if dep.UpdatePolicy == "" || dep.ImageURL == target {
+			continue
+		}
+		var wait string
+		switch {
+		case dep.Status != "running":
+			wait = "it is updated once it is running"
+		case s.frozen(dep.Project, dep.AgentID) != nil:
+			wait = "it is updated once its freeze ends"
+		case starting >= batch:
+			wait = "it is updated once the deployments updated before it are running"
+		}
+		if wait != "" {
+			if dep.AvailableImage != target {
+				dep.AvailableImage = target
+				s.recordEvent(dep.ID, "update_available", fmt.Sprintf("Update policy %s found %s; %s", dep.UpdatePolicy, target, wait))
+			}
+			continue
+		}
+		// The revision deploys the digest the release was found with, even if
+		// the tag moves before it is admitted.
+		dep.ImageURL = target
+		dep.ImageDigest = digest
+		dep.AvailableImage = ""
+		dep.Revision++
+		dep.Reason = ""
+		dep.Scan = nil
+		s.recordEvent(dep.ID, "updated", fmt.Sprintf("Update policy %s found %s (%s), redeploying as revision %d", dep.UpdatePolicy, target, digest, dep.Revision))
+		log.Printf("Deployment %s updated by its %s policy to %s as revision %d", dep.ID, dep.UpdatePolicy, target, dep.Revision)
+		s.start(dep)
+		starting++
+	}
+	return ""
+}
+
+// failedWith reports whether a deployment is still failed with an image.
+func (s *DeploymentStore) failedWith(id, image string) bool {
+	s.Lock()
+	defer s.Unlock()
+	dep, exists := s.deployments[id]
+	return exists && dep.ArchivedAt == nil && dep.ImageURL == image && dep.Status == types.StatusFailed
+}
+
+// HaltUpdate records on the deployments still waiting for an image that its
+// rollout halted because a deployment failed with it.
+func (s *DeploymentStore) HaltUpdate(target string, ids []string, failed string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, dep := range s.lookup(ids) {
+		dep.AvailableImage = target
+		s.recordEvent(dep.ID, "update_halted", fmt.Sprintf("Update to %s halted: deployment %s failed with it", target, failed))
+	}
+}
+
+// lookup returns the deployments with the given IDs ordered by creation time,
+// leaving out unknown ones. The caller must hold the lock.
+func (s *DeploymentStore) lookup(ids []string) []*Deployment {
+	list := make([]*Deployment, 0, len(ids))
+	for _, id := range ids {
+		if dep, exists := s.deployments[id]; exists {
+			list = append(list, dep)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
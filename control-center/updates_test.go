@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"edge-orchestration/api/types"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want semver
+		ok   bool
+	}{
+		{"1.4.2", semver{1, 4, 2, ""}, true},
+		{"v2.0.0", semver{2, 0, 0, ""}, true},
+		{"1.5.0-rc.1", semver{1, 5, 0, "rc.1"}, true},
+		{"1.5.0-rc.1+build.7", semver{1, 5, 0, "rc.1"}, true},
+		{"1.5.0+build.7", semver{1, 5, 0, ""}, true},
+		{"0.0.0", semver{0, 0, 0, ""}, true},
+		{"1.4", semver{}, false},
+		{"1.4.2.1", semver{}, false},
+		{"01.4.2", semver{}, false},
+		{"1.-4.2", semver{}, false},
+		{"1.4.x", semver{}, false},
+		{"latest", semver{}, false},
+		{"stable-1.4.2", semver{}, false},
+		{"", semver{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSemver(tt.tag)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseSemver(%q) = %+v, %v, want %+v, %v", tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSemverLess(t *testing.T) {
+	// Each version is earlier than the next, as in the semantic versioning
+	// specification's example.
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0-rc.2", "1.0.0-rc.10", "1.0.0", "1.0.1", "1.1.0", "2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := parseSemver(ordered[i])
+			b, _ := parseSemver(ordered[j])
+			if got := a.less(b); got != (i < j) {
+				t.Errorf("%s < %s = %v, want %v", ordered[i], ordered[j], got, i < j)
+			}
+		}
+	}
+}
+
+func TestNewestAllowed(t *testing.T) {
+	tags := []string{"latest", "1.4.1", "1.4.2", "1.4.3", "1.4.10", "1.5.0", "1.6.0-rc.1", "1.6.0-rc.10", "2.0.0", "2.1.0-beta", "v3.0.0", "nightly-2024"}
+	tests := []struct {
+		policy, current string
+		tags            []string
+		want            string
+	}{
+		{"patch", "1.4.2", tags, "1.4.10"},
+		{"minor", "1.4.2", tags, "1.5.0"},
+		{"major", "1.4.2", tags, "v3.0.0"},
+		{"patch", "1.4.10", tags, ""},
+		{"minor", "1.5.0", tags, ""},
+		{"major", "v3.0.0", tags, ""},
+		{"minor", "1.6.0-rc.1", tags, ""},
+		{"patch", "1.6.0-rc.10", []string{"1.6.0-rc.2", "1.6.0"}, "1.6.0"},
+		{"major", "2.0.0", []string{"2.0.1-rc.1", "2.1.0-beta"}, ""},
+		{"patch", "1.4.2", []string{"1.4.2", "1.4.1"}, ""},
+		{"patch", "latest", tags, ""},
+		{"major", "1.4.2", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := newestAllowed(tt.policy, tt.current, tt.tags); got != tt.want {
+			t.Errorf("newestAllowed(%s, %s) = %q, want %q", tt.policy, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestImageWithTag(t *testing.T) {
+	tests := []struct {
+		image, tag, want string
+	}{
+		{"nginx:1.27", "1.28", "nginx:1.28"},
+		{"nginx", "1.28", "nginx:1.28"},
+		{"ghcr.io/acme/web:1.4.2", "1.4.3", "ghcr.io/acme/web:1.4.3"},
+		{"registry.local:5000/acme/web:1.4.2", "1.4.3", "registry.local:5000/acme/web:1.4.3"},
+		{"registry.local:5000/acme/web", "1.4.3", "registry.local:5000/acme/web:1.4.3"},
+		{"localhost:5000/web:v1.0.0-rc.1", "v1.0.0", "localhost:5000/web:v1.0.0"},
+	}
+	for _, tt := range tests {
+		if got := imageWithTag(tt.image, tt.tag); got != tt.want {
+			t.Errorf("imageWithTag(%q, %q) = %q, want %q", tt.image, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestRollOutUpdatePinsDigest(t *testing.T) {
+	store := NewDeploymentStore(NewQuotaStore(), NewAgentStore(), NewFreezeStore())
+	var admitted []string
+	store.SetPendingHandler(func(id, agentID string, revision int, imageURL string) {
+		admitted = append(admitted, imageURL)
+	})
+	dep, err := store.Create(DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: "agent-1", ImageURL: "ghcr.io/acme/web:1.4.2", UpdatePolicy: "patch"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.MarkScheduled(dep.ID, dep.Revision, "sha256:old")
+	store.UpdateStatus(dep.ID, 0, types.StatusRunning, "")
+
+	if failed := store.RollOutUpdate("ghcr.io/acme/web:1.4.3", "sha256:new", []string{dep.ID}, 1); failed != "" {
+		t.Fatalf("rollout halted on %s", failed)
+	}
+	got, _ := store.Get(dep.ID)
+	if got.ImageURL != "ghcr.io/acme/web:1.4.3" || got.ImageDigest != "sha256:new" {
+		t.Errorf("updated deployment has image %s and digest %s, want ghcr.io/acme/web:1.4.3 and sha256:new", got.ImageURL, got.ImageDigest)
+	}
+	if last := admitted[len(admitted)-1]; last != "ghcr.io/acme/web@sha256:new" {
+		t.Errorf("update was admitted with %s, want the resolved digest", last)
+	}
+
+	// Once the update fails, the rollout halts until the deployment recovers.
+	store.MarkScheduled(dep.ID, got.Revision, "sha256:new")
+	store.UpdateStatus(dep.ID, 0, types.StatusFailed, "crash")
+	if !store.failedWith(dep.ID, "ghcr.io/acme/web:1.4.3") {
+		t.Error("failed deployment does not halt the rollout")
+	}
+	store.UpdateStatus(dep.ID, 0, types.StatusRollingBack, "")
+	if store.failedWith(dep.ID, "ghcr.io/acme/web:1.4.3") {
+		t.Error("recovering deployment still halts the rollout")
+	}
+}
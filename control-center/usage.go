@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// usageBucket is the granularity inference usage is kept at.
+	usageBucket = time.Hour
+	// usageRetention is how long inference usage is kept.
+	usageRetention = 90 * 24 * time.Hour
+	// maxMeteredBody is the largest response, or streamed line, the gateway
+	// looks for token usage in.
+	maxMeteredBody = 1 << 20
+)
+
+// UsageStore keeps the inference requests and tokens deployments served, in
+// hourly buckets, for chargeback.
+type UsageStore struct {
+	sync.Mutex
+	buckets map[string]map[time.Time]*UsageSample // By deployment ID and hour
+}
+
+// NewUsageStore creates an empty usage store.
+func NewUsageStore() *UsageStore {
+	return &UsageStore{buckets: make(map[string]map[time.Time]*UsageSample)}
+}
+
+// Record adds a sample to a deployment's usage in the hour of at, and drops
+// usage older than the retention period.
+func (s *UsageStore) Record(id string, sample UsageSample, at time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	hour := at.UTC().Truncate(usageBucket)
+	if s.buckets[id] == nil {
+		s.buckets[id] = make(map[time.Time]*UsageSample)
+	}
+	b := s.buckets[id][hour]
+	if b == nil {
+		b = &UsageSample{}
+		s.buckets[id][hour] = b
+	}
+	b.Requests += sample.Requests
+	b.Errors += sample.Errors
+	b.PromptTokens += sample.PromptTokens
+	b.CompletionTokens += sample.CompletionTokens
+
+	cutoff := at.Add(-usageRetention)
+	for depID, hours := range s.buckets {
+		for h := range hours {
+			if h.Before(cutoff) {
+				delete(hours, h)
+			}
+		}
+		if len(hours) == 0 {
+			delete(s.buckets, depID)
+		}
+	}
+}
+
+// Report sums the usage of deployments in the hours from since until until,
+// optionally only those of a project or an agent.
+func (s *UsageStore) Report(deployments *DeploymentStore, project, agentID string, since, until time.Time) UsageReport {
+	s.Lock()
+	totals := make(map[string]UsageSample)
+	for id, hours := range s.buckets {
+		for h, b := range hours {
+			if h.Before(since.Truncate(usageBucket)) || !h.Before(until) {
+				continue
+			}
+			t := totals[id]
+			t.Requests += b.Requests
+			t.Errors += b.Errors
+			t.PromptTokens += b.PromptTokens
+			t.CompletionTokens += b.CompletionTokens
+			totals[id] = t
+		}
+	}
+	s.Unlock()
+
+	report := UsageReport{Since: since, Until: until, Deployments: []DeploymentUsage{}, Projects: []ProjectUsage{}}
+	projects := make(map[string]*ProjectUsage)
+	for id, t := range totals {
+		u := DeploymentUsage{DeploymentID: id, Requests: t.Requests, Errors: t.Errors, PromptTokens: t.PromptTokens, CompletionTokens: t.CompletionTokens, TotalTokens: t.PromptTokens + t.CompletionTokens}
+		if dep, exists := deployments.Get(id); exists {
+			u.AgentID, u.Project = dep.AgentID, dep.Project
+			if dep.ModelServing != nil {
+				u.Model = dep.ModelServing.Model
+			}
+		}
+		if project != "" && u.Project != project || agentID != "" && u.AgentID != agentID {
+			continue
+		}
+		report.Deployments = append(report.Deployments, u)
+		p := projects[u.Project]
+		if p == nil {
+			p = &ProjectUsage{Project: u.Project}
+			projects[u.Project] = p
+		}
+		p.Deployments++
+		p.Requests += u.Requests
+		p.Errors += u.Errors
+		p.PromptTokens += u.PromptTokens
+		p.CompletionTokens += u.CompletionTokens
+		p.TotalTokens += u.TotalTokens
+	}
+	sort.Slice(report.Deployments, func(i, j int) bool {
+		a, b := report.Deployments[i], report.Deployments[j]
+		if a.TotalTokens != b.TotalTokens {
+			return a.TotalTokens > b.TotalTokens
+		}
+		return a.DeploymentID < b.DeploymentID
+	})
+	for _, p := range projects {
+		report.Projects = append(report.Projects, *p)
+	}
+	sort.Slice(report.Projects, func(i, j int) bool { return report.Projects[i].Project < report.Projects[j].Project })
+	return report
+}
+
+// tokenUsage is the usage object of OpenAI-compatible responses.
+type tokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// usageMeter passes a model server's response through while picking up the
+// token usage it reports, either in a JSON body or in the last chunk of a
+// stream, and records it once the response is closed.
+type usageMeter struct {
+	io.ReadCloser
+	stream  bool
+	buf     []byte
+	skipped bool // The body was too large to look for usage in
+	usage   tokenUsage
+	once    sync.Once
+	record  func(tokenUsage)
+}
+
+func (m *usageMeter) Read(p []byte) (int, error) {
+	n, err := m.ReadCloser.Read(p)
+	m.scan(p[:n])
+	return n, err
+}
+
+// scan looks for usage in the data read so far: in each complete line of a
+// stream, or in the whole body otherwise.
+func (m *usageMeter) scan(data []byte) {
+	if m.skipped {
+		return
+	}
+	m.buf = append(m.buf, data...)
+	for m.stream {
+		i := bytes.IndexByte(m.buf, '\n')
+		if i < 0 {
+			break
+		}
+		m.parse(bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(m.buf[:i]), []byte("data:"))))
+		m.buf = m.buf[i+1:]
+	}
+	if len(m.buf) > maxMeteredBody {
+		m.buf, m.skipped = nil, !m.stream
+	}
+}
+
+// parse takes the usage from a JSON object that reports it.
+func (m *usageMeter) parse(data []byte) {
+	var chunk struct {
+		Usage *tokenUsage `json:"usage"`
+	}
+	if bytes.Contains(data, []byte(`"usage"`)) && json.Unmarshal(data, &chunk) == nil && chunk.Usage != nil {
+		m.usage = *chunk.Usage
+	}
+}
+
+func (m *usageMeter) Close() error {
+	m.once.Do(func() {
+		if !m.stream && !m.skipped {
+			m.parse(m.buf)
+		}
+		m.record(m.usage)
+	})
+	return m.ReadCloser.Close()
+}
+
+// validateUsageSample checks that a sample's counts are not negative and
+// that no more requests failed than were served.
+func validateUsageSample(s UsageSample) error {
+	if s.Requests < 0 || s.Errors < 0 || s.PromptTokens < 0 || s.CompletionTokens < 0 {
+		return errors.New("usage counts must not be negative")
+	}
+	if s.Errors > s.Requests {
+		return errors.New("errors must not exceed requests")
+	}
+	return nil
+}
+
+// handleReportUsage serves POST /api/v1/deployments/{id}/usage, which adds
+// the requests and tokens a deployment served since its previous sample, as
+// counted by a sidecar or exporter next to the workload.
+func (s *Server) handleReportUsage(w http.ResponseWriter, r *http.Request) {
+	var sample UsageSample
+	if err := json.NewDecoder(r.Body).Decode(&sample); err != nil {
+		invalidBody(w, err, "Invalid request body")
+		return
+	}
+	if err := validateUsageSample(sample); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if _, exists := s.deployments.Get(id); !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	s.usage.Record(id, sample, time.Now().UTC())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUsageReport serves GET /api/v1/reports/usage, the inference usage of
+// deployments, optionally only those of the project or agent_id given as
+// query parameters, in the hours from since until until (RFC 3339 times).
+// The report covers everything retained by default.
+func (s *Server) handleUsageReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	until := time.Now().UTC()
+	since := until.Add(-usageRetention)
+	for name, t := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s %q: must be an RFC 3339 time", name, v), http.StatusBadRequest)
+				return
+			}
+			*t = parsed.UTC()
+		}
+	}
+	json.NewEncoder(w).Encode(s.usage.Report(s.deployments, q.Get("project"), q.Get("agent_id"), since, until))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-orchestration/api/types"
+)
+
+// VersionConflictError is returned when a conditional update names a
+// resource version that is no longer current.
+type VersionConflictError struct {
+	ID       string
+	Expected int
+	Current  int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("deployment %s is at resource version %d, not %d; fetch it again and retry", e.ID, e.Current, e.Expected)
+}
+
+// etag renders a resource version as an HTTP entity tag.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// listEpoch sets the ETags of lists from this process apart from those of
+// earlier ones, whose store revisions started over from zero.
+var listEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// listETag renders a store revision as the entity tag of a list.
+func listETag(revision int) string {
+	return strconv.Quote(listEpoch + "-" + strconv.Itoa(revision))
+}
+
+// notModified sets a list's ETag on the response and answers 304 Not
+// Modified if the request's If-None-Match names it, in which case it returns
+// true and the list need not be encoded.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch returns the resource version named by an If-Match header. It
+// returns 0 if the header is absent or "*", which match any version.
+func parseIfMatch(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	if strings.Contains(value, ",") {
+		return 0, fmt.Errorf("If-Match must name a single resource version")
+	}
+	unquoted, err := strconv.Unquote(strings.TrimPrefix(value, "W/"))
+	if err != nil {
+		unquoted = value
+	}
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match %q: expected a resource version such as \"3\"", value)
+	}
+	return version, nil
+}
+
+// checkVersion returns a *VersionConflictError if expected is set and does
+// not match the deployment's resource version.
+func checkVersion(dep *Deployment, expected int) error {
+	if expected != 0 && expected != dep.ResourceVersion {
+		return &VersionConflictError{ID: dep.ID, Expected: expected, Current: dep.ResourceVersion}
+	}
+	return nil
+}
+
+// Update applies a patch to a deployment if it is still at the expected
+// resource version. A new image starts a new revision. It returns false if
+// the deployment does not exist.
+func (s *DeploymentStore) Update(id string, expected int, patch DeploymentPatch) (*Deployment, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	dep, exists := s.deployments[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := checkVersion(dep, expected); err != nil {
+		return nil, true, err
+	}
+	if retired(dep.Status) {
+		return nil, true, fmt.Errorf("deployment %s is %s and can no longer be updated", id, dep.Status)
+	}
+
+	if patch.AutoUpdate != nil && *patch.AutoUpdate != dep.AutoUpdate {
+		dep.AutoUpdate = *patch.AutoUpdate
+		s.recordEvent(id, "updated", fmt.Sprintf("Auto update set to %t", dep.AutoUpdate))
+	}
+	if patch.ImageURL == nil || *patch.ImageURL == dep.ImageURL {
+		return cloneDeployment(dep), true, nil
+	}
+	if dep.Bundle != "" {
+		return nil, true, fmt.Errorf("deployment %s runs bundle %s; deploy a new bundle instead of changing the image", id, dep.Bundle)
+	}
+
+	// Failed and cancelled deployments release their quota, so restarting
+	// them must fit the quota again. Paused deployments check it on resume,
+	// and deferred ones once they are due.
+	var violations []string
+	if !consumesQuota(dep.Status) && dep.Status != "queued" && dep.Status != "paused" && dep.Status != "deferred" {
+		requested, _ := requestedAmounts(dep.Resources)
+		req := DeploymentRequest{DeploymentRequest: types.DeploymentRequest{AgentID: dep.AgentID, Project: dep.Project}}
+		var queueable bool
+		violations, queueable = s.quotaViolations(req, requested)
+		if len(violations) > 0 && !queueable {
+			return nil, true, &QuotaExceededError{Violations: violations}
+		}
+	}
+
+	dep.ImageURL = *patch.ImageURL
+	dep.ImageDigest = ""
+	if dep.AvailableImage == dep.ImageURL {
+		dep.AvailableImage = ""
+	}
+	dep.Revision++
+	dep.Reason = ""
+	dep.Scan = nil
+	s.recordEvent(id, "updated", fmt.Sprintf("Image changed to %s, redeploying as revision %d", dep.ImageURL, dep.Revision))
+	log.Printf("Deployment %s updated to image %s as revision %d", id, dep.ImageURL, dep.Revision)
+	switch {
+	case len(violations) > 0:
+		s.setStatus(dep, types.StatusQueued)
+		dep.Reason = (&QuotaExceededError{Violations: violations}).Error()
+		s.recordEvent(id, "queued", dep.Reason)
+	case dep.Status == "queued":
+		// Still waiting for quota with the new image.
+	case dep.Status == "paused":
+		// The new image is deployed when the deployment is resumed.
+	case dep.Status == "deferred":
+		// The new image is deployed when the deployment is due.
+	default:
+		s.start(dep)
+	}
+	return cloneDeployment(dep), true, nil
+}
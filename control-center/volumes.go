@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// validateVolumes checks that volume names and mount paths are unique and
+// that every volume has exactly one valid source.
+func validateVolumes(volumes []Volume) error {
+	names := make(map[string]bool, len(volumes))
+	mounts := make(map[string]bool, len(volumes))
+	for _, v := range volumes {
+		if v.Name == "" {
+			return fmt.Errorf("every volume needs a name")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate volume %q", v.Name)
+		}
+		names[v.Name] = true
+		if !path.IsAbs(v.MountPath) {
+			return fmt.Errorf("volume %s: mount_path must be an absolute path", v.Name)
+		}
+		if mounts[path.Clean(v.MountPath)] {
+			return fmt.Errorf("volume %s: mount_path %s is already in use", v.Name, v.MountPath)
+		}
+		mounts[path.Clean(v.MountPath)] = true
+
+		sources := 0
+		if v.PVC != nil {
+			sources++
+			if v.PVC.Size == "" {
+				return fmt.Errorf("volume %s: pvc size is required", v.Name)
+			}
+			if _, err := parseMemory(v.PVC.Size); err != nil {
+				return fmt.Errorf("volume %s: invalid pvc size %q", v.Name, v.PVC.Size)
+			}
+		}
+		if v.HostPath != nil {
+			sources++
+			if !path.IsAbs(v.HostPath.Path) {
+				return fmt.Errorf("volume %s: host_path path must be an absolute path", v.Name)
+			}
+		}
+		if v.EmptyDir != nil {
+			sources++
+			if v.EmptyDir.Medium != "" && v.EmptyDir.Medium != "Memory" {
+				return fmt.Errorf("volume %s: empty_dir medium must be empty or Memory", v.Name)
+			}
+			if _, err := parseMemory(v.EmptyDir.SizeLimit); err != nil {
+				return fmt.Errorf("volume %s: invalid empty_dir size_limit %q", v.Name, v.EmptyDir.SizeLimit)
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("volume %s: exactly one of pvc, host_path, or empty_dir is required", v.Name)
+		}
+	}
+	return nil
+}
+
+// claimNames fills in the default claim name of PVC volumes for a deployment.
+func claimNames(deploymentID string, volumes []Volume) []Volume {
+	if len(volumes) == 0 {
+		return nil
+	}
+	out := make([]Volume, len(volumes))
+	for i, v := range volumes {
+		if v.PVC != nil && v.PVC.ClaimName == "" {
+			pvc := *v.PVC
+			pvc.ClaimName = deploymentID + "-" + v.Name
+			v.PVC = &pvc
+		}
+		out[i] = v
+	}
+	return out
+}
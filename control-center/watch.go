@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// watchKeepalive is how often a quiet event stream sends a comment, so that
+// proxies in between do not close it, and checks for changes it was not
+// signalled about.
+const watchKeepalive = 15 * time.Second
+
+// wantsEventStream reports whether a request asks for a Server-Sent Events
+// stream rather than a JSON document.
+func wantsEventStream(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(part); mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamDeploymentEvents streams a deployment's changes as Server-Sent
+// Events: a "deployment" event with the deployment whenever it changes, and
+// an "event" event for each entry of its timeline, starting with the ones it
+// already has. The stream ends when the caller goes away or the deployment
+// is purged.
+func (s *Server) streamDeploymentEvents(w http.ResponseWriter, r *http.Request, id string) {
+	dep, exists := s.deployments.Get(id)
+	if !exists {
+		http.Error(w, "Deployment not found", http.StatusNotFound)
+		return
+	}
+	changes, stop := s.deployments.Watch(dep.AgentID)
+	defer stop()
+	keepalive := time.NewTicker(watchKeepalive)
+	defer keepalive.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	version, sent := -1, 0
+	for {
+		dep, exists := s.deployments.Get(id)
+		if !exists {
+			return
+		}
+		if dep.ResourceVersion != version {
+			version = dep.ResourceVersion
+			if err := writeServerSentEvent(w, "deployment", dep); err != nil {
+				return
+			}
+		}
+		events, _ := s.deployments.Events(id)
+		for _, event := range events[min(sent, len(events)):] {
+			if err := writeServerSentEvent(w, "event", event); err != nil {
+				return
+			}
+		}
+		sent = len(events)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changes:
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeServerSentEvent writes v as the JSON data of a Server-Sent Event.
+func writeServerSentEvent(w io.Writer, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
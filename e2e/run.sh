@@ -0,0 +1,147 @@
+#!/usr/bin/env bash
+# End-to-end test of the control center, an agent, and cctl: registers the
+# agent, deploys a workload to it, waits for it to run, applies and deletes
+# its Kubernetes manifests in the agent's cluster's default namespace, and
+# deletes it.
+#
+# E2E_CLUSTER selects the cluster the agent carries out operations in:
+#
+#   kind       A kind cluster created for the run and deleted after it (the
+#              default if kind is installed). E2E_KIND_CLUSTER names it
+#              (edge-e2e); an existing cluster of that name is reused and kept.
+#   existing   The cluster in KUBECONFIG, e.g. one started by envtest.
+#   simulated  The agent's simulated cluster; needs no Kubernetes at all.
+#
+# E2E_API_PORT (18080) and E2E_GRPC_PORT (18081) are the control center's
+# ports, and E2E_KEEP_LOGS=true keeps the logs of passing runs.
+set -euo pipefail
+
+root=$(cd "$(dirname "$0")/.." && pwd)
+work=$(mktemp -d)
+api_port=${E2E_API_PORT:-18080}
+grpc_port=${E2E_GRPC_PORT:-18081}
+kind_cluster=${E2E_KIND_CLUSTER:-edge-e2e}
+created_cluster=false
+pids=()
+
+cluster=${E2E_CLUSTER:-}
+if [[ -z $cluster ]]; then
+	if command -v kind >/dev/null; then cluster=kind; else cluster=simulated; fi
+fi
+
+log() { printf '==> %s\n' "$*"; }
+
+fail() {
+	printf 'FAIL: %s\n' "$*" >&2
+	for f in "$work"/*.log; do
+		[[ -e $f ]] || continue
+		printf -- '--- %s\n' "$(basename "$f")" >&2
+		tail -n 30 "$f" >&2
+	done
+	exit 1
+}
+
+cleanup() {
+	status=$?
+	for pid in "${pids[@]}"; do kill "$pid" 2>/dev/null || true; done
+	if $created_cluster; then kind delete cluster --name "$kind_cluster" >/dev/null 2>&1 || true; fi
+	if [[ $status -eq 0 && ${E2E_KEEP_LOGS:-} != true ]]; then
+		rm -rf "$work"
+	else
+		printf 'Logs are in %s\n' "$work" >&2
+	fi
+}
+trap cleanup EXIT
+
+# eventually runs a command until it succeeds, for up to 60 seconds.
+eventually() {
+	for _ in $(seq 60); do
+		if "$@" >/dev/null 2>&1; then return 0; fi
+		sleep 1
+	done
+	return 1
+}
+
+log "Building the control center, agent, and cctl"
+for module in control-center agent cctl; do
+	(cd "$root/$module" && go build -o "$work/bin/$module" .)
+done
+cctl() { "$work/bin/cctl" "$@"; }
+
+case $cluster in
+kind)
+	command -v kubectl >/dev/null || fail "E2E_CLUSTER=kind needs kubectl"
+	# grep -q stops reading at the first match, which under pipefail would
+	# fail the pipeline with SIGPIPE, so outputs are captured before grepping.
+	clusters=$(kind get clusters 2>/dev/null || true)
+	if grep -qx "$kind_cluster" <<<"$clusters"; then
+		log "Using kind cluster $kind_cluster"
+	else
+		log "Creating kind cluster $kind_cluster"
+		kind create cluster --name "$kind_cluster" --wait 120s >"$work/kind.log" 2>&1 || fail "could not create kind cluster"
+		created_cluster=true
+	fi
+	kind get kubeconfig --name "$kind_cluster" >"$work/kubeconfig"
+	export KUBECONFIG=$work/kubeconfig
+	agent_kubernetes=true
+	;;
+existing)
+	[[ -n ${KUBECONFIG:-} ]] || fail "E2E_CLUSTER=existing needs KUBECONFIG"
+	command -v kubectl >/dev/null || fail "E2E_CLUSTER=existing needs kubectl"
+	agent_kubernetes=true
+	;;
+simulated)
+	agent_kubernetes=simulated
+	;;
+*)
+	fail "unknown E2E_CLUSTER $cluster: must be kind, existing, or simulated"
+	;;
+esac
+log "Testing against a $cluster cluster"
+
+export CONTROL_CENTER_ADDR=http://127.0.0.1:$api_port
+API_ADDR=127.0.0.1:$api_port AGENT_GRPC_ADDR=127.0.0.1:$grpc_port RESOLVE_IMAGE_DIGESTS=false \
+	"$work/bin/control-center" >"$work/control-center.log" 2>&1 &
+pids+=($!)
+eventually cctl agents list || fail "control center did not start"
+
+CONTROL_CENTER_GRPC_ADDR=127.0.0.1:$grpc_port AGENT_KUBERNETES=$agent_kubernetes AGENT_LABELS=e2e-run=$$ \
+	"$work/bin/agent" >"$work/agent.log" 2>&1 &
+pids+=($!)
+
+log "Register"
+agent_id() { cctl agents list --selector "e2e-run=$$" | awk 'NR == 2 && $3 == "online" { print $1 }'; }
+registered() { [[ -n $(agent_id) ]]; }
+eventually registered || fail "agent did not register"
+agent=$(agent_id)
+log "Agent $agent registered"
+
+log "Deploy"
+cctl deploy --agent "$agent" --image nginx:1.27 --wait --no-color >"$work/deploy.out" || fail "deployment did not come up: $(cat "$work/deploy.out")"
+deployment=$(awk '$1 == "ID:" { print $2; exit }' "$work/deploy.out")
+[[ -n $deployment ]] || fail "deploy printed no deployment ID"
+
+log "Status of $deployment"
+status=$(cctl deployments describe "$deployment") || fail "could not describe deployment $deployment"
+grep -q '^Status: *running' <<<"$status" || fail "deployment $deployment is not running"
+
+log "Apply manifests in the cluster"
+cctl cluster apply "$agent" --deployment "$deployment" --wait >"$work/apply.out" || fail "apply failed: $(cat "$work/apply.out")"
+grep -q applied "$work/apply.out" || fail "apply reported no applied objects: $(cat "$work/apply.out")"
+if [[ $agent_kubernetes == true ]]; then
+	kubectl get deployment "$deployment" >/dev/null || fail "Deployment $deployment was not created in the cluster"
+fi
+
+log "Delete manifests from the cluster"
+cctl cluster delete "$agent" --deployment "$deployment" --wait >"$work/delete.out" || fail "delete failed: $(cat "$work/delete.out")"
+if [[ $agent_kubernetes == true ]]; then
+	eventually bash -c "! kubectl get deployment '$deployment'" || fail "Deployment $deployment was not deleted from the cluster"
+fi
+
+log "Delete"
+cctl deployments delete "$deployment" >/dev/null || fail "could not delete deployment $deployment"
+status=$(cctl deployments describe "$deployment") || fail "could not describe deployment $deployment"
+grep -q '^Status: *deleted' <<<"$status" || fail "deployment $deployment is not deleted"
+eventually grep -q "Deployment $deployment deleted, stopping workload" "$work/agent.log" || fail "agent did not stop the workload"
+
+log "PASS"